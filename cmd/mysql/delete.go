@@ -10,6 +10,7 @@ import (
 )
 
 var confirmed = false
+var forceDelete = false
 
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
@@ -64,7 +65,7 @@ func runDeleteEverything(cmd *cobra.Command, args []string) {
 }
 
 func runDeleteTarget(cmd *cobra.Command, args []string) {
-	deleteHandler, err := NewMySQLDeleteHandler()
+	deleteHandler, err := NewMySQLDeleteHandler(internal.AllowDeleteLastFullBackup(forceDelete))
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	bname := args[0]                                                   // backup name
@@ -92,6 +93,7 @@ func init() {
 	cmd.AddCommand(deleteCmd)
 	deleteCmd.AddCommand(deleteBeforeCmd, deleteRetainCmd, deleteEverythingCmd, deleteTargetCmd)
 	deleteCmd.PersistentFlags().BoolVar(&confirmed, internal.ConfirmFlag, false, "Confirms backup deletion")
+	deleteTargetCmd.Flags().BoolVar(&forceDelete, internal.ForceFlag, false, internal.ForceDeleteDescription)
 }
 
 func makeLessFunc(folder storage.Folder) func(object1, object2 storage.Object) bool {
@@ -108,21 +110,24 @@ func makeLessFunc(folder storage.Folder) func(object1, object2 storage.Object) b
 	}
 }
 
-func NewMySQLDeleteHandler() (*DeleteHandler, error) {
+func NewMySQLDeleteHandler(options ...internal.DeleteHandlerOption) (*DeleteHandler, error) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	backupObjects, err := internal.FindBackupObjects(folder)
 	tracelog.ErrorLogger.FatalOnError(err)
 
-	permanentBackups := internal.FindPermanentBackups(folder, mysql.NewGenericMetaFetcher())
+	permanentBackups, err := internal.FindPermanentBackups(folder, mysql.NewGenericMetaFetcher())
+	if err != nil {
+		return nil, err
+	}
 
+	options = append([]internal.DeleteHandlerOption{
+		internal.IsPermanentFunc(func(object storage.Object) bool {
+			return internal.IsPermanent(object.GetName(), permanentBackups)
+		})}, options...)
 	return &DeleteHandler{
-		DeleteHandler: internal.NewDeleteHandler(folder, backupObjects, makeLessFunc(folder),
-			internal.IsPermanentFunc(func(object storage.Object) bool {
-				return internal.IsPermanent(object.GetName(), permanentBackups, internal.StreamBackupNameLength)
-			}),
-		),
+		DeleteHandler:    internal.NewDeleteHandler(folder, backupObjects, makeLessFunc(folder), options...),
 		permanentObjects: permanentBackups,
 	}, nil
 }
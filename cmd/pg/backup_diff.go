@@ -0,0 +1,38 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const (
+	backupDiffShortDescription = "Compares a backup with a live data directory without modifying anything"
+	backupDiffJSONDescription  = "Show output in JSON format."
+)
+
+var backupDiffJSON bool
+
+// backupDiffCmd represents the backupDiff command
+var backupDiffCmd = &cobra.Command{
+	Use:   "backup-diff live_directory backup_name | LATEST",
+	Short: backupDiffShortDescription,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		backupSelector, err := internal.NewTargetBackupSelector("", args[1], postgres.NewGenericMetaFetcher())
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		postgres.HandleBackupDiff(folder, backupSelector, args[0], os.Stdout, backupDiffJSON)
+	},
+}
+
+func init() {
+	backupDiffCmd.Flags().BoolVar(&backupDiffJSON, "json", false, backupDiffJSONDescription)
+	Cmd.AddCommand(backupDiffCmd)
+}
@@ -0,0 +1,35 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const (
+	backupDuplicatesShortDescription = "Reports backups with identical content, never deletes anything"
+	backupDuplicatesJSONDescription  = "Show output in JSON format."
+)
+
+var backupDuplicatesJSON bool
+
+// backupDuplicatesCmd represents the backupDuplicates command
+var backupDuplicatesCmd = &cobra.Command{
+	Use:   "backup-duplicates",
+	Short: backupDuplicatesShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		postgres.HandleBackupDuplicates(folder, os.Stdout, backupDuplicatesJSON)
+	},
+}
+
+func init() {
+	backupDuplicatesCmd.Flags().BoolVar(&backupDuplicatesJSON, "json", false, backupDuplicatesJSONDescription)
+	Cmd.AddCommand(backupDuplicatesCmd)
+}
@@ -2,9 +2,12 @@ package pg
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/wal-g/wal-g/internal/databases/postgres"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
@@ -21,6 +24,34 @@ For information about pattern syntax view: https://golang.org/pkg/path/filepath/
 	reverseDeltaUnpackDescription = "Unpack delta backups in reverse order (beta feature)"
 	skipRedundantTarsDescription  = "Skip tars with no useful data (requires reverse delta unpack)"
 	targetUserDataDescription     = "Fetch storage backup which has the specified user data"
+	changedSinceDescription       = "Fetches only files modified after the specified time (RFC3339)"
+	onlyPrefixDescription         = "Fetches only files which path relative to destination_directory starts with the prefix"
+	forensicDescription           = "Report page checksum failures as warnings and keep the corrupt files"
+	mirrorToDescription           = "Storage config of the second storage to mirror the fetched backup to"
+	cleanOnFailureDescription     = "Remove everything written by the restore if it fails or is cancelled"
+	estimateDescription           = "Print the estimated restore duration and exit without fetching"
+	dryRunDescription             = "Report which files the restore would create, overwrite or skip without writing anything"
+	keepRelcacheInitDescription   = "Restore the pg_internal.init relation cache files instead of skipping them"
+	sampleDescription             = "Restore only the specified number of the selected files to check the backup is readable"
+	sampleRandomDescription       = "Choose the sampled files randomly instead of the first ones by name"
+	partAllowlistDescription      = "Path to file listing the tar part keys to restore from, the other parts are skipped"
+	unwrapListDescription         = "Path to file listing the backup files to restore, one path relative to destination_directory per line"
+	merkleTreeDescription         = "Path to write the Merkle tree of the restored files to, the root hash is logged"
+	unwrapReportDescription       = "Path to write the JSON report of the completed and incremented files of every restored backup to"
+	resumeManifestDescription     = "Path to the manifest of the restored files to resume the interrupted restore from"
+	relocateDatabaseDescription   = "Restore the databases to the alternate empty directories: database_oid=/path,..."
+	tablespaceMappingDescription  = "Restore the tablespaces to the new locations: tablespace_oid=/path,..."
+	pathMapDescription            = "Rewrite the absolute symlink targets and hardlink sources of the backup host: /old/prefix=/new/prefix,..."
+	strictBackupLabelDescription  = "Fail the restore if the restored backup_label does not match the backup sentinel LSNs"
+	strictChecksumsDescription    = "Fail the restore if the restored data checksums setting does not match WALG_RESTORE_DATA_CHECKSUMS"
+	maxBytesDescription           = "Stop restoring the new files once the restored files reach the specified number of bytes"
+	forceNonEmptyDescription      = "Restore into the data directory holding the files not allowed by WALG_RESTORE_ALLOWED_FILES"
+	bestEffortDescription         = "Continue the restore past the files failed to restore and fail with their summary at the end"
+	excludeDescription            = "Skip the files which path relative to destination_directory matches the shell file pattern, repeatable"
+	targetLSNFlag                 = "target-lsn"
+	targetLSNDescription          = "Fetch the most recent backup finished at or before the specified LSN, e.g. 0/16B3740"
+	targetTimelineFlag            = "target-timeline"
+	targetTimelineDescription     = "Timeline of the target LSN, the latest timeline of the backups if not set"
 )
 
 var fileMask string
@@ -28,9 +59,35 @@ var restoreSpec string
 var reverseDeltaUnpack bool
 var skipRedundantTars bool
 var fetchTargetUserData string
+var changedSince string
+var onlyPrefix string
+var forensicRestore bool
+var mirrorToConfigFile string
+var cleanOnFailure bool
+var estimateOnly bool
+var dryRun bool
+var keepRelcacheInit bool
+var sampleSize int
+var sampleRandomly bool
+var partAllowlistFile string
+var unwrapListFile string
+var merkleTreeFile string
+var unwrapReportFile string
+var resumeManifestFile string
+var relocatedDatabases map[string]string
+var tablespaceMapping map[string]string
+var pathMap map[string]string
+var strictBackupLabel bool
+var strictDataChecksums bool
+var maxBytes int64
+var forceNonEmpty bool
+var bestEffortRestore bool
+var excludePatterns []string
+var fetchTargetLSN string
+var fetchTargetTimeline uint32
 
 var backupFetchCmd = &cobra.Command{
-	Use:   "backup-fetch destination_directory [backup_name | --target-user-data <data>]",
+	Use:   "backup-fetch destination_directory [backup_name | --target-user-data <data> | --target-lsn <lsn>]",
 	Short: backupFetchShortDescription, // TODO : improve description
 	Args:  cobra.RangeArgs(1, 2),
 	Run: func(cmd *cobra.Command, args []string) {
@@ -43,13 +100,26 @@ var backupFetchCmd = &cobra.Command{
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
 
-		var pgFetcher func(folder storage.Folder, backup internal.Backup)
+		if estimateOnly {
+			postgres.HandleRestoreEstimate(folder, targetBackupSelector, os.Stdout)
+			return
+		}
+
 		reverseDeltaUnpack = reverseDeltaUnpack || viper.GetBool(internal.UseReverseUnpackSetting)
 		skipRedundantTars = skipRedundantTars || viper.GetBool(internal.SkipRedundantTarsSetting)
-		if reverseDeltaUnpack {
-			pgFetcher = postgres.GetPgFetcherNew(args[0], fileMask, restoreSpec, skipRedundantTars)
+		if resumeManifestFile != "" && (reverseDeltaUnpack || dryRun) {
+			tracelog.ErrorLogger.Fatal("--resume-manifest can't be used with the reverse delta unpack or --dry-run\n")
+		}
+		fetchOptions, err := createFetchOptions(args[0])
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		var pgFetcher func(folder storage.Folder, backup internal.Backup)
+		if dryRun {
+			pgFetcher = postgres.GetPgFetcherDryRun(args[0], fileMask, fetchOptions, os.Stdout)
+		} else if reverseDeltaUnpack {
+			pgFetcher = postgres.GetPgFetcherNew(args[0], fileMask, restoreSpec, skipRedundantTars, fetchOptions)
 		} else {
-			pgFetcher = postgres.GetPgFetcherOld(args[0], fileMask, restoreSpec)
+			pgFetcher = postgres.GetPgFetcherOld(args[0], fileMask, restoreSpec, fetchOptions)
 		}
 
 		internal.HandleBackupFetch(folder, targetBackupSelector, pgFetcher)
@@ -64,7 +134,13 @@ func createTargetFetchBackupSelector(cmd *cobra.Command,
 		targetName = args[1]
 	}
 
-	backupSelector, err := internal.NewTargetBackupSelector(targetUserData, targetName, postgres.NewGenericMetaFetcher())
+	var backupSelector internal.BackupSelector
+	var err error
+	if fetchTargetLSN != "" {
+		backupSelector, err = createTargetLSNBackupSelector(targetName, targetUserData, fetchTargetLSN, fetchTargetTimeline)
+	} else {
+		backupSelector, err = internal.NewTargetBackupSelector(targetUserData, targetName, postgres.NewGenericMetaFetcher())
+	}
 	if err != nil {
 		fmt.Println(cmd.UsageString())
 		return nil, err
@@ -72,6 +148,196 @@ func createTargetFetchBackupSelector(cmd *cobra.Command,
 	return backupSelector, nil
 }
 
+// createTargetLSNBackupSelector creates the BackupSelector to select the backup to recover to the target LSN,
+// the backup can't be selected by the name or the user data at the same time
+func createTargetLSNBackupSelector(targetName, targetUserData, targetLSN string,
+	targetTimeline uint32) (internal.BackupSelector, error) {
+	if targetName != "" || targetUserData != "" {
+		return nil, errors.New("incorrect arguments. Specify target backup name, userdata OR target LSN, not several")
+	}
+	tracelog.InfoLogger.Printf("Selecting the backup to recover to LSN %s...\n", targetLSN)
+	return postgres.NewBackupLSNSelector(targetLSN, targetTimeline)
+}
+
+func createFetchOptions(dbDataDirectory string) (postgres.FetchOptions, error) {
+	options := postgres.FetchOptions{
+		CleanUpOnFailure:       cleanOnFailure,
+		StrictBackupLabel:      strictBackupLabel,
+		StrictDataChecksums:    strictDataChecksums,
+		KeepRelcacheInitFiles:  keepRelcacheInit,
+		OnlyPrefix:             onlyPrefix,
+		SampleSize:             sampleSize,
+		SampleRandomly:         sampleRandomly,
+		AllowNonEmptyDirectory: forceNonEmpty,
+		WalgVersion:            walgVersion,
+	}
+	if sampleSize < 0 {
+		return postgres.FetchOptions{}, fmt.Errorf("sample size must not be negative, got %d", sampleSize)
+	}
+	if maxBytes < 0 {
+		return postgres.FetchOptions{}, fmt.Errorf("max bytes must not be negative, got %d", maxBytes)
+	}
+	if maxBytes > 0 {
+		options.ByteBudget = postgres.NewRestoreByteBudget(maxBytes)
+	}
+	if len(excludePatterns) > 0 {
+		exclusion, err := postgres.NewRestoreExclusion(excludePatterns)
+		if err != nil {
+			return postgres.FetchOptions{}, err
+		}
+		options.Exclusion = exclusion
+	}
+	if changedSince != "" {
+		since, err := time.Parse(time.RFC3339, changedSince)
+		if err != nil {
+			return postgres.FetchOptions{}, fmt.Errorf("invalid --changed-since value: %v", err)
+		}
+		options.ChangedSince = &since
+	}
+	concurrencyLimiter, err := postgres.ConfigureRestoreConcurrencyLimiter()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	options.ConcurrencyLimiter = concurrencyLimiter
+	unsyncedDataLimiter, err := postgres.ConfigureUnsyncedDataLimiter()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	options.UnsyncedDataLimiter = unsyncedDataLimiter
+	capacityGuard, err := postgres.ConfigureRestoreCapacityGuard(dbDataDirectory)
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	options.CapacityGuard = capacityGuard
+	inodeCheck, err := postgres.ConfigureRestoreInodeCheck()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	options.InodeCheck = inodeCheck
+	spaceCheck, err := postgres.ConfigureRestoreSpaceCheck()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	options.SpaceCheck = spaceCheck
+	options.PageVerifier = postgres.ConfigureRestoredPageVerifier(forensicRestore)
+	if mirrorToConfigFile != "" {
+		mirrorFolder, err := internal.FolderFromConfig(mirrorToConfigFile)
+		if err != nil {
+			return postgres.FetchOptions{}, err
+		}
+		options.BackupMirror = postgres.NewBackupMirror(mirrorFolder)
+	}
+	if partAllowlistFile != "" {
+		partAllowlist, err := postgres.ReadTarPartAllowlist(partAllowlistFile)
+		if err != nil {
+			return postgres.FetchOptions{}, err
+		}
+		options.PartAllowlist = partAllowlist
+	}
+	if bestEffortRestore {
+		if cleanOnFailure {
+			return postgres.FetchOptions{}, fmt.Errorf("--best-effort can't be used with --clean-on-failure")
+		}
+		options.BestEffort = postgres.NewBestEffortRestore()
+	}
+	if unwrapListFile != "" {
+		unwrapList, err := postgres.ReadUnwrapList(unwrapListFile)
+		if err != nil {
+			return postgres.FetchOptions{}, err
+		}
+		options.UnwrapList = unwrapList
+	}
+	if merkleTreeFile != "" {
+		options.MerkleTree = postgres.NewRestoreMerkleTree(merkleTreeFile)
+	}
+	if unwrapReportFile != "" {
+		options.UnwrapReport = postgres.NewRestoreUnwrapReport(unwrapReportFile)
+	}
+	if resumeManifestFile != "" {
+		if cleanOnFailure {
+			return postgres.FetchOptions{}, fmt.Errorf("--resume-manifest can't be used with --clean-on-failure")
+		}
+		if viper.GetBool(internal.TarDisableFsyncSetting) {
+			// the files recorded as restored before they are synced may be lost by the host crash
+			return postgres.FetchOptions{}, fmt.Errorf("--resume-manifest can't be used with %s",
+				internal.TarDisableFsyncSetting)
+		}
+		resumeManifest, err := postgres.OpenRestoreResumeManifest(resumeManifestFile, dbDataDirectory)
+		if err != nil {
+			return postgres.FetchOptions{}, err
+		}
+		options.ResumeManifest = resumeManifest
+	}
+	if len(relocatedDatabases) > 0 {
+		relocation, err := postgres.NewDatabaseRelocation(relocatedDatabases)
+		if err != nil {
+			return postgres.FetchOptions{}, err
+		}
+		options.DatabaseRelocation = relocation
+	}
+	if len(tablespaceMapping) > 0 {
+		mapping, err := postgres.NewRestoreTablespaceMapping(tablespaceMapping)
+		if err != nil {
+			return postgres.FetchOptions{}, err
+		}
+		options.TablespaceMapping = mapping
+	}
+	if len(pathMap) > 0 {
+		restorePathMap, err := postgres.NewRestorePathMap(pathMap)
+		if err != nil {
+			return postgres.FetchOptions{}, err
+		}
+		options.PathMap = restorePathMap
+	}
+	ownership, err := postgres.ConfigureRestoreOwnership()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	options.Ownership = ownership
+	options.Xattrs = postgres.ConfigureRestoreXattrs()
+	options.CompletionMarker = postgres.ConfigureRestoreCompletionMarker()
+	verifyCommand, err := postgres.ConfigureRestoreVerifyCommand()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	options.VerifyCommand = verifyCommand
+	progress, err := postgres.ConfigureRestoreProgress()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	options.Progress = progress
+	var plugins postgres.MultiRestorePlugin
+	webhookPlugin, err := postgres.ConfigureWebhookRestorePlugin()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	if webhookPlugin != nil {
+		plugins = append(plugins, webhookPlugin)
+	}
+	statsdPlugin, err := postgres.ConfigureStatsdRestorePlugin()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	if statsdPlugin != nil {
+		plugins = append(plugins, statsdPlugin)
+	}
+	progressLogPlugin, err := postgres.ConfigureProgressLogRestorePlugin()
+	if err != nil {
+		return postgres.FetchOptions{}, err
+	}
+	if progressLogPlugin != nil {
+		plugins = append(plugins, progressLogPlugin)
+	}
+	if metrics := postgres.ConfigureRestoreMetrics(); metrics != nil {
+		options.Metrics = metrics
+		plugins = append(plugins, metrics)
+	}
+	if len(plugins) > 0 {
+		options.RestorePlugin = plugins
+	}
+	return options, nil
+}
+
 func init() {
 	backupFetchCmd.Flags().StringVar(&fileMask, "mask", "", maskFlagDescription)
 	backupFetchCmd.Flags().StringVar(&restoreSpec, "restore-spec", "", restoreSpecDescription)
@@ -81,5 +347,31 @@ func init() {
 		false, skipRedundantTarsDescription)
 	backupFetchCmd.Flags().StringVar(&fetchTargetUserData, "target-user-data",
 		"", targetUserDataDescription)
+	backupFetchCmd.Flags().StringVar(&changedSince, "changed-since", "", changedSinceDescription)
+	backupFetchCmd.Flags().StringVar(&onlyPrefix, "only-prefix", "", onlyPrefixDescription)
+	backupFetchCmd.Flags().BoolVar(&forensicRestore, "forensic", false, forensicDescription)
+	backupFetchCmd.Flags().StringVar(&mirrorToConfigFile, "mirror-to", "", mirrorToDescription)
+	backupFetchCmd.Flags().BoolVar(&cleanOnFailure, "clean-on-failure", false, cleanOnFailureDescription)
+	backupFetchCmd.Flags().BoolVar(&estimateOnly, "estimate", false, estimateDescription)
+	backupFetchCmd.Flags().BoolVar(&dryRun, "dry-run", false, dryRunDescription)
+	backupFetchCmd.Flags().BoolVar(&keepRelcacheInit, "keep-relcache-init", false, keepRelcacheInitDescription)
+	backupFetchCmd.Flags().IntVar(&sampleSize, "sample", 0, sampleDescription)
+	backupFetchCmd.Flags().BoolVar(&sampleRandomly, "sample-random", false, sampleRandomDescription)
+	backupFetchCmd.Flags().StringVar(&partAllowlistFile, "part-allowlist", "", partAllowlistDescription)
+	backupFetchCmd.Flags().StringVar(&unwrapListFile, "unwrap-list", "", unwrapListDescription)
+	backupFetchCmd.Flags().StringVar(&merkleTreeFile, "merkle-tree", "", merkleTreeDescription)
+	backupFetchCmd.Flags().StringVar(&unwrapReportFile, "unwrap-report", "", unwrapReportDescription)
+	backupFetchCmd.Flags().StringVar(&resumeManifestFile, "resume-manifest", "", resumeManifestDescription)
+	backupFetchCmd.Flags().StringToStringVar(&relocatedDatabases, "relocate-database", nil, relocateDatabaseDescription)
+	backupFetchCmd.Flags().StringToStringVar(&tablespaceMapping, "tablespace-mapping", nil, tablespaceMappingDescription)
+	backupFetchCmd.Flags().StringToStringVar(&pathMap, "path-map", nil, pathMapDescription)
+	backupFetchCmd.Flags().BoolVar(&strictBackupLabel, "strict-backup-label", false, strictBackupLabelDescription)
+	backupFetchCmd.Flags().BoolVar(&strictDataChecksums, "strict-data-checksums", false, strictChecksumsDescription)
+	backupFetchCmd.Flags().Int64Var(&maxBytes, "max-bytes", 0, maxBytesDescription)
+	backupFetchCmd.Flags().BoolVar(&forceNonEmpty, "force", false, forceNonEmptyDescription)
+	backupFetchCmd.Flags().BoolVar(&bestEffortRestore, "best-effort", false, bestEffortDescription)
+	backupFetchCmd.Flags().StringArrayVar(&excludePatterns, "exclude", nil, excludeDescription)
+	backupFetchCmd.Flags().StringVar(&fetchTargetLSN, targetLSNFlag, "", targetLSNDescription)
+	backupFetchCmd.Flags().Uint32Var(&fetchTargetTimeline, targetTimelineFlag, 0, targetTimelineDescription)
 	Cmd.AddCommand(backupFetchCmd)
 }
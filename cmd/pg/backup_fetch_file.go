@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const backupFetchFileShortDescription = "Writes the content of a single backup file to stdout"
+
+// backupFetchFileCmd represents the backupFetchFile command
+var backupFetchFileCmd = &cobra.Command{
+	Use:   "backup-fetch-file backup_name | LATEST file_name",
+	Short: backupFetchFileShortDescription,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		backupSelector, err := internal.NewTargetBackupSelector("", args[0], postgres.NewGenericMetaFetcher())
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		postgres.HandleBackupFetchFile(folder, backupSelector, args[1], os.Stdout)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(backupFetchFileCmd)
+}
@@ -0,0 +1,31 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const backupRestoreDeletedShortDescription = "Moves the deleted objects of a backup back from the trash, " +
+	"all the deleted objects if no backup is specified"
+
+// backupRestoreDeletedCmd represents the backupRestoreDeleted command
+var backupRestoreDeletedCmd = &cobra.Command{
+	Use:   "backup-restore-deleted [backup_name]",
+	Short: backupRestoreDeletedShortDescription,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		backupName := ""
+		if len(args) > 0 {
+			backupName = args[0]
+		}
+		internal.HandleBackupRestoreDeleted(folder, backupName)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(backupRestoreDeletedCmd)
+}
@@ -0,0 +1,38 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const (
+	backupShowFilesShortDescription = "Lists the files of a backup by its metadata without downloading the backup data"
+	backupShowFilesJSONDescription  = "Show output in JSON format."
+)
+
+var backupShowFilesJSON bool
+
+// backupShowFilesCmd represents the backupShowFiles command
+var backupShowFilesCmd = &cobra.Command{
+	Use:   "backup-show-files backup_name | LATEST",
+	Short: backupShowFilesShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		backupSelector, err := internal.NewTargetBackupSelector("", args[0], postgres.NewGenericMetaFetcher())
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		postgres.HandleBackupShowFiles(folder, backupSelector, os.Stdout, backupShowFilesJSON)
+	},
+}
+
+func init() {
+	backupShowFilesCmd.Flags().BoolVar(&backupShowFilesJSON, "json", false, backupShowFilesJSONDescription)
+	Cmd.AddCommand(backupShowFilesCmd)
+}
@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const backupStreamShortDescription = "Writes the backup contents to stdout as a standalone tar"
+
+// backupStreamCmd represents the backupStream command
+var backupStreamCmd = &cobra.Command{
+	Use:   "backup-stream backup_name | LATEST",
+	Short: backupStreamShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		backupSelector, err := internal.NewTargetBackupSelector("", args[0], postgres.NewGenericMetaFetcher())
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		postgres.HandleBackupStream(folder, backupSelector, os.Stdout)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(backupStreamCmd)
+}
@@ -0,0 +1,37 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const (
+	backupSynthesizeShortDescription = "Converts the increment chain of a backup into an independent full backup"
+	backupSynthesizeLongDescription  = `Reconstructs the full backup and the increments of the backup chain in the work directory
+	and uploads the result as the new full backup named after the last increment. The uploaded backup is restored back
+	and compared with the reconstructed chain before its sentinel is uploaded, so it becomes visible only when verified.
+	The work directory must be empty and have the space for two copies of the data directory.`
+)
+
+// backupSynthesizeCmd represents the backupSynthesize command
+var backupSynthesizeCmd = &cobra.Command{
+	Use:   "backup-synthesize backup_name | LATEST work_directory",
+	Short: backupSynthesizeShortDescription,
+	Long:  backupSynthesizeLongDescription,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		backupSelector, err := internal.NewTargetBackupSelector("", args[0], postgres.NewGenericMetaFetcher())
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		uploader, err := internal.ConfigureUploader()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		postgres.HandleSyntheticFull(uploader, backupSelector, args[1])
+	},
+}
+
+func init() {
+	Cmd.AddCommand(backupSynthesizeCmd)
+}
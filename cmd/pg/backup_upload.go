@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const (
+	backupUploadShortDescription = "Uploads the local copy of a backup to the storage"
+	backupUploadLongDescription  = `Uploads the local directory containing the backup files and the backup sentinel.
+	Interrupted upload can be resumed by running the command again: already uploaded files are skipped.`
+)
+
+// backupUploadCmd represents the backupUpload command
+var backupUploadCmd = &cobra.Command{
+	Use:   "backup-upload local_directory backup_name",
+	Short: backupUploadShortDescription,
+	Long:  backupUploadLongDescription,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		postgres.HandleBackupUpload(folder, args[0], args[1])
+	},
+}
+
+func init() {
+	Cmd.AddCommand(backupUploadCmd)
+}
@@ -0,0 +1,35 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const (
+	backupVerifyShortDescription = "Verifies that increment chains and tar parts of all backups are intact"
+	backupVerifyJSONDescription  = "Show output in JSON format."
+)
+
+var backupVerifyJSON bool
+
+// backupVerifyCmd represents the backupVerify command
+var backupVerifyCmd = &cobra.Command{
+	Use:   "backup-verify",
+	Short: backupVerifyShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		postgres.HandleBackupVerify(folder, os.Stdout, backupVerifyJSON)
+	},
+}
+
+func init() {
+	backupVerifyCmd.Flags().BoolVar(&backupVerifyJSON, "json", false, backupVerifyJSONDescription)
+	Cmd.AddCommand(backupVerifyCmd)
+}
@@ -10,9 +10,12 @@ import (
 const (
 	CatchupFetchShortDescription = "Fetches an incremental backup from storage"
 	UseNewUnwrapDescription      = "Use the new implementation of catchup unwrap (beta)"
+	DeltaApplyDescription        = "Apply only the changed blocks to the existing files, checking their page counts " +
+		"(implies the new unwrap)"
 )
 
 var useNewUnwrap bool
+var deltaApply bool
 
 // catchupFetchCmd represents the catchup-fetch command
 var catchupFetchCmd = &cobra.Command{
@@ -22,12 +25,14 @@ var catchupFetchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
-		postgres.HandleCatchupFetch(folder, args[0], args[1], useNewUnwrap)
+		postgres.HandleCatchupFetch(folder, args[0], args[1], useNewUnwrap, deltaApply)
 	},
 }
 
 func init() {
 	catchupFetchCmd.Flags().BoolVar(&useNewUnwrap, "use-new-unwrap",
 		false, UseNewUnwrapDescription)
+	catchupFetchCmd.Flags().BoolVar(&deltaApply, "delta-apply",
+		false, DeltaApplyDescription)
 	Cmd.AddCommand(catchupFetchCmd)
 }
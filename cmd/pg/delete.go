@@ -1,6 +1,10 @@
 package pg
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
@@ -13,10 +17,23 @@ const DeleteGarbageExamples = `  garbage           Deletes outdated WAL archives
   garbage ARCHIVES  Deletes only outdated WAL archives from storage
   garbage BACKUPS   Deletes only leftover backups files from storage`
 const DeleteGarbageUse = "garbage [ARCHIVES|BACKUPS]"
+const DeleteWalUse = "wal"
+const DeleteWalShortDescription = "Deletes WAL archives which are not needed by any backup, keeps all backups"
+const DeleteWalExamples = `  wal                      Deletes WAL archives older than the oldest non-permanent backup
+  wal --min-retention 72h  Also keeps WAL archives modified within the last 72 hours`
+const MinRetentionFlag = "min-retention"
+const MinRetentionDescription = "Keep WAL archives modified within the specified period"
+const DeleteTargetLSNDescription = "delete the most recent storage backup finished at or before the specified LSN"
+const DeleteTargetLSNExamples = `
+  target --target-lsn 0/16B3740	delete the most recent backup finished at or before the LSN and all dependant delta backups`
 
 var confirmed = false
 var useSentinelTime = false
 var deleteTargetUserData = ""
+var deleteWalMinRetention time.Duration
+var forceDelete = false
+var deleteTargetLSN = ""
+var deleteTargetTimeline uint32
 
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
@@ -48,8 +65,8 @@ var deleteEverythingCmd = &cobra.Command{
 
 var deleteTargetCmd = &cobra.Command{
 	Use:     internal.DeleteTargetUsageExample, // TODO : improve description
-	Example: internal.DeleteTargetExamples,
-	Args:    internal.DeleteTargetArgsValidator,
+	Example: internal.DeleteTargetExamples + DeleteTargetLSNExamples,
+	Args:    deleteTargetArgsValidator,
 	Run:     runDeleteTarget,
 }
 
@@ -60,13 +77,24 @@ var deleteGarbageCmd = &cobra.Command{
 	Run:     runDeleteGarbage,
 }
 
+var deleteWalCmd = &cobra.Command{
+	Use:     DeleteWalUse,
+	Short:   DeleteWalShortDescription,
+	Example: DeleteWalExamples,
+	Args:    cobra.NoArgs,
+	Run:     runDeleteWal,
+}
+
 func runDeleteBefore(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
+	folder = internal.ConfigureListingCacheFolder(folder)
 
-	permanentBackups, permanentWals := postgres.GetPermanentBackupsAndWals(folder)
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
 
-	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, useSentinelTime)
+	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, useSentinelTime,
+		internal.DeleteMetrics(internal.ConfigurePrometheusMetrics("delete")), configureDeleteEvents())
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	deleteHandler.HandleDeleteBefore(args, confirmed)
@@ -75,10 +103,13 @@ func runDeleteBefore(cmd *cobra.Command, args []string) {
 func runDeleteRetain(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
+	folder = internal.ConfigureListingCacheFolder(folder)
 
-	permanentBackups, permanentWals := postgres.GetPermanentBackupsAndWals(folder)
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
 
-	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, useSentinelTime)
+	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, useSentinelTime,
+		internal.DeleteMetrics(internal.ConfigurePrometheusMetrics("delete")), configureDeleteEvents())
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	deleteHandler.HandleDeleteRetain(args, confirmed)
@@ -87,10 +118,13 @@ func runDeleteRetain(cmd *cobra.Command, args []string) {
 func runDeleteEverything(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
+	folder = internal.ConfigureListingCacheFolder(folder)
 
-	permanentBackups, permanentWals := postgres.GetPermanentBackupsAndWals(folder)
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
 
-	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, useSentinelTime)
+	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, useSentinelTime,
+		internal.DeleteMetrics(internal.ConfigurePrometheusMetrics("delete")), configureDeleteEvents())
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	deleteHandler.HandleDeleteEverything(args, permanentBackups, confirmed)
@@ -99,8 +133,10 @@ func runDeleteEverything(cmd *cobra.Command, args []string) {
 func runDeleteTarget(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
+	folder = internal.ConfigureListingCacheFolder(folder)
 
-	permanentBackups, permanentWals := postgres.GetPermanentBackupsAndWals(folder)
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
 
 	findFullBackup := false
 	modifier := internal.ExtractDeleteTargetModifierFromArgs(args)
@@ -110,26 +146,85 @@ func runDeleteTarget(cmd *cobra.Command, args []string) {
 		args = args[1:]
 	}
 
-	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, useSentinelTime)
+	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, useSentinelTime,
+		internal.AllowDeleteLastFullBackup(forceDelete), internal.DeleteMetrics(internal.ConfigurePrometheusMetrics("delete")),
+		configureDeleteEvents())
 	tracelog.ErrorLogger.FatalOnError(err)
-	targetBackupSelector, err := internal.CreateTargetDeleteBackupSelector(cmd, args, deleteTargetUserData, postgres.NewGenericMetaFetcher())
+	targetBackupSelector, err := createTargetDeleteBackupSelector(cmd, args)
 	tracelog.ErrorLogger.FatalOnError(err)
 	deleteHandler.HandleDeleteTarget(targetBackupSelector, confirmed, findFullBackup)
 }
 
+// createTargetDeleteBackupSelector creates the BackupSelector to select the backup to delete,
+// the backup is selected by the target LSN if --target-lsn is set
+func createTargetDeleteBackupSelector(cmd *cobra.Command, args []string) (internal.BackupSelector, error) {
+	if deleteTargetLSN == "" {
+		return internal.CreateTargetDeleteBackupSelector(cmd, args, deleteTargetUserData, postgres.NewGenericMetaFetcher())
+	}
+	targetName := ""
+	if len(args) > 0 {
+		targetName = args[0]
+	}
+	var backupSelector internal.BackupSelector
+	var err error
+	if cmd.Flags().Changed(internal.DeleteTargetAfterFlag) || cmd.Flags().Changed(internal.DeleteTargetBeforeFlag) ||
+		cmd.Flags().Changed(internal.DeleteTargetPatternFlag) {
+		err = errors.New("incorrect arguments. Specify target LSN without time range or pattern")
+	} else {
+		backupSelector, err = createTargetLSNBackupSelector(targetName, deleteTargetUserData, deleteTargetLSN, deleteTargetTimeline)
+	}
+	if err != nil {
+		fmt.Println(cmd.UsageString())
+		return nil, err
+	}
+	return backupSelector, nil
+}
+
+// deleteTargetArgsValidator allows no target backup name if the backup is selected by the target LSN
+func deleteTargetArgsValidator(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && cmd.Flags().Changed(targetLSNFlag) {
+		return nil
+	}
+	return internal.DeleteTargetArgsValidator(cmd, args)
+}
+
 func runDeleteGarbage(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
+	folder = internal.ConfigureListingCacheFolder(folder)
 
-	permanentBackups, permanentWals := postgres.GetPermanentBackupsAndWals(folder)
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
 
-	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, false)
+	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, false, configureDeleteEvents())
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	err = deleteHandler.HandleDeleteGarbage(args, folder, confirmed)
 	tracelog.ErrorLogger.FatalOnError(err)
 }
 
+func runDeleteWal(cmd *cobra.Command, args []string) {
+	folder, err := internal.ConfigureFolder()
+	tracelog.ErrorLogger.FatalOnError(err)
+	folder = internal.ConfigureListingCacheFolder(folder)
+
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, false, configureDeleteEvents())
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	err = deleteHandler.HandleDeleteWal(folder, deleteWalMinRetention, confirmed)
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+// configureDeleteEvents makes the delete handler write the delete events to WALG_DELETE_EVENT_LOG, if set
+func configureDeleteEvents() internal.DeleteHandlerOption {
+	logger, err := internal.ConfigureDeleteEventLogger()
+	tracelog.ErrorLogger.FatalOnError(err)
+	return internal.DeleteEvents(logger)
+}
+
 func DeleteGarbageArgsValidator(cmd *cobra.Command, args []string) error {
 	modifiers := []string{postgres.DeleteGarbageArchivesModifier, postgres.DeleteGarbageBackupsModifier}
 	return internal.DeleteArgsValidator(args, modifiers, 0, 1)
@@ -140,8 +235,18 @@ func init() {
 
 	deleteTargetCmd.Flags().StringVar(
 		&deleteTargetUserData, internal.DeleteTargetUserDataFlag, "", internal.DeleteTargetUserDataDescription)
-
-	deleteCmd.AddCommand(deleteRetainCmd, deleteBeforeCmd, deleteEverythingCmd, deleteTargetCmd, deleteGarbageCmd)
+	deleteTargetCmd.Flags().BoolVar(&forceDelete, internal.ForceFlag, false, internal.ForceDeleteDescription)
+	deleteTargetCmd.Flags().String(internal.DeleteTargetAfterFlag, "", internal.DeleteTargetAfterDescription)
+	deleteTargetCmd.Flags().String(internal.DeleteTargetBeforeFlag, "", internal.DeleteTargetBeforeDescription)
+	deleteTargetCmd.Flags().String(internal.DeleteTargetPatternFlag, "", internal.DeleteTargetPatternDescription)
+	deleteTargetCmd.Flags().Lookup(internal.DeleteTargetPatternFlag).NoOptDefVal = internal.GlobPatternMode
+	deleteTargetCmd.Flags().StringVar(&deleteTargetLSN, targetLSNFlag, "", DeleteTargetLSNDescription)
+	deleteTargetCmd.Flags().Uint32Var(&deleteTargetTimeline, targetTimelineFlag, 0, targetTimelineDescription)
+
+	deleteWalCmd.Flags().DurationVar(&deleteWalMinRetention, MinRetentionFlag, 0, MinRetentionDescription)
+
+	deleteCmd.AddCommand(deleteRetainCmd, deleteBeforeCmd, deleteEverythingCmd, deleteTargetCmd, deleteGarbageCmd,
+		deleteWalCmd)
 	deleteCmd.PersistentFlags().BoolVar(&confirmed, internal.ConfirmFlag, false, "Confirms backup deletion")
 	deleteCmd.PersistentFlags().BoolVar(&useSentinelTime, UseSentinelTimeFlag, false, UseSentinelTimeDescription)
 }
@@ -0,0 +1,59 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const restoreLatestShortDescription = "Restores the latest backup and configures the recovery " +
+	"to the latest point reachable with the WAL in storage"
+
+// restoreLatestCmd represents the restoreLatest command
+var restoreLatestCmd = &cobra.Command{
+	Use:   "restore-latest destination_directory",
+	Short: restoreLatestShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		fetchOptions, err := createFetchOptions(args[0])
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		var pgFetcher func(folder storage.Folder, backup internal.Backup)
+		if viper.GetBool(internal.UseReverseUnpackSetting) {
+			pgFetcher = postgres.GetPgFetcherNew(args[0], "", "",
+				viper.GetBool(internal.SkipRedundantTarsSetting), fetchOptions)
+		} else {
+			pgFetcher = postgres.GetPgFetcherOld(args[0], "", "", fetchOptions)
+		}
+
+		restoreCommand, err := getRestoreCommand()
+		tracelog.ErrorLogger.FatalOnError(err)
+		postgres.HandleRestoreLatest(folder, args[0], restoreCommand, pgFetcher, os.Stdout)
+	},
+}
+
+// getRestoreCommand returns the restore_command which fetches WAL with the running wal-g binary and config
+func getRestoreCommand() (string, error) {
+	walgBinaryPath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	restoreCommand := fmt.Sprintf("%s wal-fetch \"%%f\" \"%%p\"", walgBinaryPath)
+	if internal.CfgFile != "" {
+		restoreCommand += fmt.Sprintf(" --config %s", internal.CfgFile)
+	}
+	return restoreCommand, nil
+}
+
+func init() {
+	Cmd.AddCommand(restoreLatestCmd)
+}
@@ -0,0 +1,25 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+const resumeManifestVerifyShortDescription = "Checks the files recorded in the resume manifest of backup-fetch " +
+	"exist with the recorded sizes, the stale entries are pruned"
+
+// resumeManifestVerifyCmd represents the resumeManifestVerify command
+var resumeManifestVerifyCmd = &cobra.Command{
+	Use:   "resume-manifest-verify destination_directory manifest_path",
+	Short: resumeManifestVerifyShortDescription,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		postgres.HandleResumeManifestVerify(args[1], args[0], os.Stdout)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(resumeManifestVerifyCmd)
+}
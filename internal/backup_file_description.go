@@ -13,10 +13,40 @@ type BackupFileDescription struct {
 	MTime         time.Time
 	CorruptBlocks *CorruptBlocksInfo `json:",omitempty"`
 	UpdatesCount  uint64
+	// ExternalObject is set if the file content is stored outside of the backup tars
+	ExternalObject *ExternalObjectRef `json:",omitempty"`
+	// IncrementBlocks is the number of the pages stored in the increment of the incremented file,
+	// it is not recorded by the older versions
+	IncrementBlocks *int64 `json:",omitempty"`
+	// Checksum is the checksum of the file content stored in the backup tars,
+	// it is not recorded for the incremented files and by the older versions
+	Checksum *FileChecksum `json:",omitempty"`
+	// Size is the size of the file in the data directory, which the restored file has,
+	// it is not recorded by the older versions
+	Size *int64 `json:",omitempty"`
 }
 
 func NewBackupFileDescription(isIncremented, isSkipped bool, modTime time.Time) *BackupFileDescription {
-	return &BackupFileDescription{isIncremented, isSkipped, modTime, nil, 0}
+	return &BackupFileDescription{isIncremented, isSkipped, modTime, nil, 0, nil, nil, nil, nil}
+}
+
+// Crc32cChecksumAlgorithm is the CRC-32 checksum with the Castagnoli polynomial
+const Crc32cChecksumAlgorithm = "crc32c"
+
+// FileChecksum is the checksum of the file content computed with the algorithm
+type FileChecksum struct {
+	Algorithm string
+	// Value is the hex encoded checksum
+	Value string
+}
+
+// ExternalObjectRef references the separately stored object holding the whole file content
+type ExternalObjectRef struct {
+	// Path is the object path relative to the backup folder,
+	// its extension selects the decompressor, if any
+	Path string
+	Size int64
+	Mode int64
 }
 
 type CorruptBlocksInfo struct {
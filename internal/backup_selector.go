@@ -2,8 +2,11 @@ package internal
 
 import (
 	"fmt"
+	"path"
 	"reflect"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/wal-g/wal-g/utility"
 
@@ -19,6 +22,12 @@ type BackupSelector interface {
 	Select(folder storage.Folder) (string, error)
 }
 
+// Select the names of several storage backups chosen according to the internal rules
+type MultipleBackupSelector interface {
+	BackupSelector
+	SelectAll(folder storage.Folder) ([]string, error)
+}
+
 // Select the latest backup from storage
 type LatestBackupSelector struct {
 }
@@ -134,6 +143,173 @@ func (s BackupNameSelector) Select(folder storage.Folder) (string, error) {
 	return s.backupName, nil
 }
 
+// Select the backups created within the time range, at or after its start and before its end
+type BackupTimeRangeSelector struct {
+	after            *time.Time
+	before           *time.Time
+	metaFetcher      GenericMetaFetcher
+	includePermanent bool
+}
+
+// NewBackupTimeRangeSelector creates the selector of the backups created within the time range,
+// the nil bound leaves the range open from that side. The permanent backups are never selected
+// unless includePermanent is set.
+func NewBackupTimeRangeSelector(after, before *time.Time, metaFetcher GenericMetaFetcher,
+	includePermanent bool) (BackupTimeRangeSelector, error) {
+	if after == nil && before == nil {
+		return BackupTimeRangeSelector{}, errors.New("the time range has neither start nor end")
+	}
+	if after != nil && before != nil && !after.Before(*before) {
+		return BackupTimeRangeSelector{}, errors.Errorf("inverted time range: the start %s is not before the end %s",
+			after.Format(time.RFC3339), before.Format(time.RFC3339))
+	}
+	return BackupTimeRangeSelector{after: after, before: before, metaFetcher: metaFetcher,
+		includePermanent: includePermanent}, nil
+}
+
+func (s BackupTimeRangeSelector) String() string {
+	start, end := "-inf", "+inf"
+	if s.after != nil {
+		start = s.after.Format(time.RFC3339Nano)
+	}
+	if s.before != nil {
+		end = s.before.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("[%s, %s)", start, end)
+}
+
+func (s BackupTimeRangeSelector) contains(backupTime time.Time) bool {
+	return (s.after == nil || !backupTime.Before(*s.after)) && (s.before == nil || backupTime.Before(*s.before))
+}
+
+// SelectAll returns the names of the backups within the range, from the oldest one
+func (s BackupTimeRangeSelector) SelectAll(folder storage.Folder) ([]string, error) {
+	backupTimes, err := GetBackups(folder.GetSubFolder(utility.BaseBackupPath))
+	if err != nil {
+		return nil, err
+	}
+	SortBackupTimeSlices(backupTimes)
+
+	permanentBackups := map[string]bool{}
+	if !s.includePermanent {
+		permanentBackups, err = FindPermanentBackups(folder, s.metaFetcher)
+		if err != nil {
+			return nil, err
+		}
+	}
+	backupNames := make([]string, 0)
+	for _, backupTime := range backupTimes {
+		if !s.contains(backupTime.Time) {
+			continue
+		}
+		if permanentBackups[backupTime.BackupName] {
+			tracelog.InfoLogger.Printf("Skipping the permanent backup %s within the time range\n", backupTime.BackupName)
+			continue
+		}
+		backupNames = append(backupNames, backupTime.BackupName)
+	}
+	if len(backupNames) == 0 {
+		return nil, errors.Errorf("no impermanent backups found in the time range %s", s)
+	}
+	return backupNames, nil
+}
+
+func (s BackupTimeRangeSelector) Select(folder storage.Folder) (string, error) {
+	backupNames, err := s.SelectAll(folder)
+	if err != nil {
+		return "", err
+	}
+	if len(backupNames) > 1 {
+		return "", fmt.Errorf("too many backups (%d) found in the time range %s: %s",
+			len(backupNames), s, strings.Join(backupNames, " "))
+	}
+	return backupNames[0], nil
+}
+
+const (
+	GlobPatternMode  = "glob"
+	RegexPatternMode = "regex"
+)
+
+// Select the backups which names match the glob pattern or the regular expression
+type BackupNamePatternSelector struct {
+	pattern          string
+	match            func(backupName string) bool
+	metaFetcher      GenericMetaFetcher
+	includePermanent bool
+}
+
+// NewBackupNamePatternSelector creates the selector of the backups which whole names match the pattern.
+// The permanent backups are never selected unless includePermanent is set.
+func NewBackupNamePatternSelector(pattern, patternMode string, metaFetcher GenericMetaFetcher,
+	includePermanent bool) (BackupNamePatternSelector, error) {
+	selector := BackupNamePatternSelector{pattern: pattern, metaFetcher: metaFetcher, includePermanent: includePermanent}
+	switch patternMode {
+	case GlobPatternMode:
+		if _, err := path.Match(pattern, ""); err != nil {
+			return BackupNamePatternSelector{}, errors.Wrapf(err, "invalid glob pattern '%s'", pattern)
+		}
+		selector.match = func(backupName string) bool {
+			matched, _ := path.Match(pattern, backupName)
+			return matched
+		}
+	case RegexPatternMode:
+		expression, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return BackupNamePatternSelector{}, errors.Wrapf(err, "invalid regular expression '%s'", pattern)
+		}
+		selector.match = expression.MatchString
+	default:
+		return BackupNamePatternSelector{}, errors.Errorf("unknown pattern mode '%s', expected '%s' or '%s'",
+			patternMode, GlobPatternMode, RegexPatternMode)
+	}
+	return selector, nil
+}
+
+// SelectAll returns the names of the backups matching the pattern, from the oldest one
+func (s BackupNamePatternSelector) SelectAll(folder storage.Folder) ([]string, error) {
+	backupTimes, err := GetBackups(folder.GetSubFolder(utility.BaseBackupPath))
+	if err != nil {
+		return nil, err
+	}
+	SortBackupTimeSlices(backupTimes)
+
+	permanentBackups := map[string]bool{}
+	if !s.includePermanent {
+		permanentBackups, err = FindPermanentBackups(folder, s.metaFetcher)
+		if err != nil {
+			return nil, err
+		}
+	}
+	backupNames := make([]string, 0)
+	for _, backupTime := range backupTimes {
+		if !s.match(backupTime.BackupName) {
+			continue
+		}
+		if permanentBackups[backupTime.BackupName] {
+			tracelog.InfoLogger.Printf("Skipping the permanent backup %s matching the pattern\n", backupTime.BackupName)
+			continue
+		}
+		backupNames = append(backupNames, backupTime.BackupName)
+	}
+	if len(backupNames) == 0 {
+		return nil, errors.Errorf("no impermanent backups found matching the pattern '%s'", s.pattern)
+	}
+	return backupNames, nil
+}
+
+func (s BackupNamePatternSelector) Select(folder storage.Folder) (string, error) {
+	backupNames, err := s.SelectAll(folder)
+	if err != nil {
+		return "", err
+	}
+	if len(backupNames) > 1 {
+		return "", fmt.Errorf("too many backups (%d) found matching the pattern '%s': %s",
+			len(backupNames), s.pattern, strings.Join(backupNames, " "))
+	}
+	return backupNames[0], nil
+}
+
 func NewTargetBackupSelector(targetUserData, targetName string, metaFetcher GenericMetaFetcher) (BackupSelector, error) {
 	var err error
 	switch {
@@ -0,0 +1,254 @@
+package internal_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/test/mocks"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+var timeRangeTestBase = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func createTimeRangeTestFolder(t *testing.T) storage.Folder {
+	mockController := gomock.NewController(t)
+	objects := []storage.Object{
+		storage.NewLocalObject("base_000000010000000000000002"+utility.SentinelSuffix, timeRangeTestBase, 0),
+		storage.NewLocalObject("base_000000010000000000000004"+utility.SentinelSuffix, timeRangeTestBase.Add(time.Hour), 0),
+		storage.NewLocalObject("base_000000010000000000000006"+utility.SentinelSuffix,
+			timeRangeTestBase.Add(2*time.Hour), 0),
+	}
+	baseBackupFolder := mocks.NewMockFolder(mockController)
+	baseBackupFolder.EXPECT().ListFolder().Return(objects, nil, nil).AnyTimes()
+	folder := mocks.NewMockFolder(mockController)
+	folder.EXPECT().GetSubFolder(utility.BaseBackupPath).Return(baseBackupFolder).AnyTimes()
+	return folder
+}
+
+func timeRef(value time.Time) *time.Time {
+	return &value
+}
+
+func TestBackupTimeRangeSelector_Boundaries(t *testing.T) {
+	// the start of the range is included, the end is not
+	selector, err := internal.NewBackupTimeRangeSelector(timeRef(timeRangeTestBase), timeRef(timeRangeTestBase.Add(2*time.Hour)),
+		permanentTestMetaFetcher{}, false)
+	require.NoError(t, err)
+
+	backupNames, err := selector.SelectAll(createTimeRangeTestFolder(t))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base_000000010000000000000002", "base_000000010000000000000004"}, backupNames)
+}
+
+func TestBackupTimeRangeSelector_OpenRange(t *testing.T) {
+	selector, err := internal.NewBackupTimeRangeSelector(nil, timeRef(timeRangeTestBase.Add(time.Hour)),
+		permanentTestMetaFetcher{}, false)
+	require.NoError(t, err)
+
+	backupName, err := selector.Select(createTimeRangeTestFolder(t))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "base_000000010000000000000002", backupName)
+}
+
+func TestBackupTimeRangeSelector_TimeZone(t *testing.T) {
+	// 15:00 at UTC+3 is 12:00 UTC, so only the backups made after 12:00 UTC are selected
+	after, err := time.Parse(time.RFC3339, "2022-03-01T15:00:01+03:00")
+	require.NoError(t, err)
+	selector, err := internal.NewBackupTimeRangeSelector(&after, nil, permanentTestMetaFetcher{}, false)
+	require.NoError(t, err)
+
+	backupNames, err := selector.SelectAll(createTimeRangeTestFolder(t))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base_000000010000000000000004", "base_000000010000000000000006"}, backupNames)
+}
+
+func TestBackupTimeRangeSelector_NoBackupsInRange(t *testing.T) {
+	selector, err := internal.NewBackupTimeRangeSelector(timeRef(timeRangeTestBase.Add(3*time.Hour)), nil,
+		permanentTestMetaFetcher{}, false)
+	require.NoError(t, err)
+
+	_, err = selector.SelectAll(createTimeRangeTestFolder(t))
+
+	assert.EqualError(t, err, "no impermanent backups found in the time range [2022-03-01T15:00:00Z, +inf)")
+}
+
+func TestBackupTimeRangeSelector_SkipsPermanentBackups(t *testing.T) {
+	metaFetcher := permanentTestMetaFetcher{permanent: map[string]bool{"base_000000010000000000000004": true}}
+	selector, err := internal.NewBackupTimeRangeSelector(timeRef(timeRangeTestBase), nil, metaFetcher, false)
+	require.NoError(t, err)
+
+	backupNames, err := selector.SelectAll(createTimeRangeTestFolder(t))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base_000000010000000000000002", "base_000000010000000000000006"}, backupNames)
+
+	selector, err = internal.NewBackupTimeRangeSelector(timeRef(timeRangeTestBase.Add(time.Hour)),
+		timeRef(timeRangeTestBase.Add(2*time.Hour)), metaFetcher, false)
+	require.NoError(t, err)
+	_, err = selector.SelectAll(createTimeRangeTestFolder(t))
+	assert.EqualError(t, err, "no impermanent backups found in the time range [2022-03-01T13:00:00Z, 2022-03-01T14:00:00Z)")
+}
+
+func TestBackupTimeRangeSelector_TooManyBackupsForSelect(t *testing.T) {
+	selector, err := internal.NewBackupTimeRangeSelector(timeRef(timeRangeTestBase), nil, permanentTestMetaFetcher{}, false)
+	require.NoError(t, err)
+
+	_, err = selector.Select(createTimeRangeTestFolder(t))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "too many backups (3)")
+}
+
+func TestNewBackupTimeRangeSelector_InvertedRange(t *testing.T) {
+	_, err := internal.NewBackupTimeRangeSelector(timeRef(timeRangeTestBase), timeRef(timeRangeTestBase),
+		permanentTestMetaFetcher{}, false)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "inverted time range")
+}
+
+func TestNewBackupTimeRangeSelector_EmptyRange(t *testing.T) {
+	_, err := internal.NewBackupTimeRangeSelector(nil, nil, permanentTestMetaFetcher{}, false)
+
+	assert.Error(t, err)
+}
+
+func newTimeRangeTestCommand(t *testing.T, flags ...string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().String(internal.DeleteTargetAfterFlag, "", "")
+	cmd.Flags().String(internal.DeleteTargetBeforeFlag, "", "")
+	require.NoError(t, cmd.Flags().Parse(flags))
+	return cmd
+}
+
+func TestCreateTargetDeleteBackupSelector_TimeRange(t *testing.T) {
+	cmd := newTimeRangeTestCommand(t, "--after", "2022-03-01T13:00:00Z", "--before", "2022-03-01T17:00:00+03:00")
+
+	selector, err := internal.CreateTargetDeleteBackupSelector(cmd, nil, "", permanentTestMetaFetcher{})
+
+	require.NoError(t, err)
+	backupName, err := selector.Select(createTimeRangeTestFolder(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "base_000000010000000000000004", backupName)
+}
+
+func TestCreateTargetDeleteBackupSelector_TimeRangeWithName(t *testing.T) {
+	cmd := newTimeRangeTestCommand(t, "--after", "2022-03-01T13:00:00Z")
+
+	_, err := internal.CreateTargetDeleteBackupSelector(cmd, []string{"base_000000010000000000000004"}, "", nil)
+
+	assert.Error(t, err)
+}
+
+func TestCreateTargetDeleteBackupSelector_InvalidTime(t *testing.T) {
+	cmd := newTimeRangeTestCommand(t, "--before", "2022-03-01 13:00:00")
+
+	_, err := internal.CreateTargetDeleteBackupSelector(cmd, nil, "", permanentTestMetaFetcher{})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid --before time")
+}
+
+func createPatternTestFolder(t *testing.T) storage.Folder {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	for _, name := range []string{"base_test_1", "base_test_2", "base_test_3", "base_prod_1"} {
+		require.NoError(t, folder.PutObject(utility.BaseBackupPath+name+utility.SentinelSuffix, &bytes.Buffer{}))
+	}
+	return folder
+}
+
+func selectByPattern(t *testing.T, pattern, patternMode string, includePermanent bool) ([]string, error) {
+	metaFetcher := permanentTestMetaFetcher{permanent: map[string]bool{"base_test_3": true}}
+	selector, err := internal.NewBackupNamePatternSelector(pattern, patternMode, metaFetcher, includePermanent)
+	require.NoError(t, err)
+	return selector.SelectAll(createPatternTestFolder(t))
+}
+
+func TestBackupNamePatternSelector_MatchesNone(t *testing.T) {
+	_, err := selectByPattern(t, "base_dev_*", internal.GlobPatternMode, false)
+
+	assert.EqualError(t, err, "no impermanent backups found matching the pattern 'base_dev_*'")
+}
+
+func TestBackupNamePatternSelector_MatchesOne(t *testing.T) {
+	backupNames, err := selectByPattern(t, "base_prod_?", internal.GlobPatternMode, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base_prod_1"}, backupNames)
+}
+
+func TestBackupNamePatternSelector_MatchesMultipleSkippingPermanent(t *testing.T) {
+	backupNames, err := selectByPattern(t, "base_test_*", internal.GlobPatternMode, false)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"base_test_1", "base_test_2"}, backupNames)
+}
+
+func TestBackupNamePatternSelector_IncludesPermanentIfAllowed(t *testing.T) {
+	backupNames, err := selectByPattern(t, "base_test_*", internal.GlobPatternMode, true)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"base_test_1", "base_test_2", "base_test_3"}, backupNames)
+}
+
+func TestBackupNamePatternSelector_MatchesOnlyPermanent(t *testing.T) {
+	_, err := selectByPattern(t, "base_test_3", internal.GlobPatternMode, false)
+
+	assert.Error(t, err)
+}
+
+func TestBackupNamePatternSelector_RegexMatchesWholeName(t *testing.T) {
+	backupNames, err := selectByPattern(t, "base_(test|prod)_1", internal.RegexPatternMode, false)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"base_test_1", "base_prod_1"}, backupNames)
+
+	_, err = selectByPattern(t, "test", internal.RegexPatternMode, false)
+	assert.Error(t, err)
+}
+
+func TestBackupNamePatternSelector_SelectSingle(t *testing.T) {
+	selector, err := internal.NewBackupNamePatternSelector("base_test_*", internal.GlobPatternMode,
+		permanentTestMetaFetcher{}, false)
+	require.NoError(t, err)
+
+	_, err = selector.Select(createPatternTestFolder(t))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "too many backups (3)")
+}
+
+func TestNewBackupNamePatternSelector_InvalidPattern(t *testing.T) {
+	_, err := internal.NewBackupNamePatternSelector("base_[", internal.GlobPatternMode, nil, false)
+	assert.Error(t, err)
+
+	_, err = internal.NewBackupNamePatternSelector("base_(", internal.RegexPatternMode, nil, false)
+	assert.Error(t, err)
+
+	_, err = internal.NewBackupNamePatternSelector("base_*", "wildcard", nil, false)
+	assert.Error(t, err)
+}
+
+func TestCreateTargetDeleteBackupSelector_Pattern(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String(internal.DeleteTargetPatternFlag, "", "")
+	cmd.Flags().Lookup(internal.DeleteTargetPatternFlag).NoOptDefVal = internal.GlobPatternMode
+	require.NoError(t, cmd.Flags().Parse([]string{"--pattern"}))
+
+	selector, err := internal.CreateTargetDeleteBackupSelector(cmd, []string{"base_prod_*"}, "", permanentTestMetaFetcher{})
+
+	require.NoError(t, err)
+	backupName, err := selector.Select(createPatternTestFolder(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "base_prod_1", backupName)
+}
@@ -216,7 +216,8 @@ func DeleteGarbage(folder storage.Folder, garbage []string) error {
 		}
 	}
 	tracelog.DebugLogger.Printf("Garbage keys will be deleted: %+v\n", keys)
-	return folder.DeleteObjects(keys)
+	_, err := storage.DeleteUnlockedObjects(folder, keys)
+	return err
 }
 
 // DeleteBackups purges given backups files
@@ -237,7 +238,7 @@ func DeleteBackups(folder storage.Folder, backups []string) error {
 	}
 
 	tracelog.DebugLogger.Printf("Backup keys will be deleted: %+v\n", keys)
-	if err := folder.DeleteObjects(keys); err != nil {
+	if _, err := storage.DeleteUnlockedObjects(folder, keys); err != nil {
 		return err
 	}
 	return nil
@@ -91,3 +91,40 @@ func TestGetGarbageFromPrefix_emptyFolders(t *testing.T) {
 	garbage := internal.GetGarbageFromPrefix(folders, nonGarbage)
 	assert.Equal(t, garbage, make([]string, 0))
 }
+
+// listCountingFolder counts the listings of the folder
+type listCountingFolder struct {
+	storage.Folder
+	listCount *int
+}
+
+func (folder listCountingFolder) ListFolder() ([]storage.Object, []storage.Folder, error) {
+	*folder.listCount++
+	return folder.Folder.ListFolder()
+}
+
+func (folder listCountingFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return listCountingFolder{Folder: folder.Folder.GetSubFolder(subFolderRelativePath), listCount: folder.listCount}
+}
+
+func TestGetBackups_ListingCacheReusesListing(t *testing.T) {
+	listCount := 0
+	underlying := listCountingFolder{Folder: testtools.MakeDefaultInMemoryStorageFolder(), listCount: &listCount}
+	_ = underlying.PutObject(utility.BaseBackupPath+"base_000000010000000000000002"+utility.SentinelSuffix, &bytes.Buffer{})
+	folder := storage.NewListingCacheFolder(underlying)
+
+	for i := 0; i < 3; i++ {
+		backups, err := internal.GetBackups(folder.GetSubFolder(utility.BaseBackupPath))
+		assert.NoError(t, err)
+		assert.Len(t, backups, 1)
+		sentinels, err := internal.GetBackupSentinelObjects(folder)
+		assert.NoError(t, err)
+		assert.Len(t, sentinels, 1)
+	}
+	assert.Equal(t, 1, listCount)
+
+	assert.NoError(t, folder.DeleteObjects([]string{utility.BaseBackupPath + "base_000000010000000000000002" + utility.SentinelSuffix}))
+	_, err := internal.GetBackups(folder.GetSubFolder(utility.BaseBackupPath))
+	assert.Error(t, err)
+	assert.Equal(t, 2, listCount)
+}
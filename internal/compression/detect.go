@@ -0,0 +1,28 @@
+package compression
+
+import "bytes"
+
+// magicNumbers are the leading bytes of the compressed streams by the file extensions of their decompressors.
+// The brotli stream has no magic number, so it is recognized by the file extension only.
+var magicNumbers = map[string][]byte{
+	"lz4":  {0x04, 0x22, 0x4d, 0x18},
+	"zst":  {0x28, 0xb5, 0x2f, 0xfd},
+	"gz":   {0x1f, 0x8b},
+	"lzo":  {0x89, 'L', 'Z', 'O', 0x00, 0x0d, 0x0a, 0x1a, 0x0a},
+	"lzma": {0x5d, 0x00, 0x00},
+}
+
+// MaxMagicNumberLength is the number of the leading bytes of the stream enough to detect its compression
+const MaxMagicNumberLength = 9
+
+// DetectDecompressor returns the registered decompressor of the stream which starts with the given bytes,
+// the stream compressed with the algorithm unknown or not supported on this platform gives nil
+func DetectDecompressor(header []byte) Decompressor {
+	for _, decompressor := range Decompressors {
+		magicNumber, ok := magicNumbers[decompressor.FileExtension()]
+		if ok && bytes.HasPrefix(header, magicNumber) {
+			return decompressor
+		}
+	}
+	return nil
+}
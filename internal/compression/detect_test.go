@@ -0,0 +1,29 @@
+package compression
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectDecompressor(t *testing.T) {
+	for name, compressor := range Compressors {
+		var compressed bytes.Buffer
+		writer := compressor.NewWriter(&compressed)
+		_, err := writer.Write([]byte("some data to compress"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		decompressor := DetectDecompressor(compressed.Bytes())
+		if _, ok := magicNumbers[compressor.FileExtension()]; !ok {
+			assert.Nil(t, decompressor, name)
+			continue
+		}
+		require.NotNil(t, decompressor, name)
+		assert.Equal(t, compressor.FileExtension(), decompressor.FileExtension())
+	}
+	assert.Nil(t, DetectDecompressor([]byte("plain text")))
+	assert.Nil(t, DetectDecompressor(nil))
+}
@@ -26,61 +26,125 @@ const (
 	MONGO     = "MONGO"
 	GP        = "GP"
 
-	DownloadConcurrencySetting   = "WALG_DOWNLOAD_CONCURRENCY"
-	UploadConcurrencySetting     = "WALG_UPLOAD_CONCURRENCY"
-	UploadDiskConcurrencySetting = "WALG_UPLOAD_DISK_CONCURRENCY"
-	UploadQueueSetting           = "WALG_UPLOAD_QUEUE"
-	SentinelUserDataSetting      = "WALG_SENTINEL_USER_DATA"
-	PreventWalOverwriteSetting   = "WALG_PREVENT_WAL_OVERWRITE"
-	UploadWalMetadata            = "WALG_UPLOAD_WAL_METADATA"
-	DeltaMaxStepsSetting         = "WALG_DELTA_MAX_STEPS"
-	DeltaOriginSetting           = "WALG_DELTA_ORIGIN"
-	CompressionMethodSetting     = "WALG_COMPRESSION_METHOD"
-	StoragePrefixSetting         = "WALG_STORAGE_PREFIX"
-	DiskRateLimitSetting         = "WALG_DISK_RATE_LIMIT"
-	NetworkRateLimitSetting      = "WALG_NETWORK_RATE_LIMIT"
-	UseWalDeltaSetting           = "WALG_USE_WAL_DELTA"
-	UseReverseUnpackSetting      = "WALG_USE_REVERSE_UNPACK"
-	SkipRedundantTarsSetting     = "WALG_SKIP_REDUNDANT_TARS"
-	VerifyPageChecksumsSetting   = "WALG_VERIFY_PAGE_CHECKSUMS"
-	StoreAllCorruptBlocksSetting = "WALG_STORE_ALL_CORRUPT_BLOCKS"
-	UseRatingComposerSetting     = "WALG_USE_RATING_COMPOSER"
-	UseCopyComposerSetting       = "WALG_USE_COPY_COMPOSER"
-	WithoutFilesMetadataSetting  = "WALG_WITHOUT_FILES_METADATA"
-	DeltaFromNameSetting         = "WALG_DELTA_FROM_NAME"
-	DeltaFromUserDataSetting     = "WALG_DELTA_FROM_USER_DATA"
-	FetchTargetUserDataSetting   = "WALG_FETCH_TARGET_USER_DATA"
-	LogLevelSetting              = "WALG_LOG_LEVEL"
-	TarSizeThresholdSetting      = "WALG_TAR_SIZE_THRESHOLD"
-	TarDisableFsyncSetting       = "WALG_TAR_DISABLE_FSYNC"
-	CseKmsIDSetting              = "WALG_CSE_KMS_ID"
-	CseKmsRegionSetting          = "WALG_CSE_KMS_REGION"
-	LibsodiumKeySetting          = "WALG_LIBSODIUM_KEY"
-	LibsodiumKeyPathSetting      = "WALG_LIBSODIUM_KEY_PATH"
-	LibsodiumKeyTransform        = "WALG_LIBSODIUM_KEY_TRANSFORM"
-	GpgKeyIDSetting              = "GPG_KEY_ID"
-	PgpKeySetting                = "WALG_PGP_KEY"
-	PgpKeyPathSetting            = "WALG_PGP_KEY_PATH"
-	PgpKeyPassphraseSetting      = "WALG_PGP_KEY_PASSPHRASE"
-	PgDataSetting                = "PGDATA"
-	UserSetting                  = "USER" // TODO : do something with it
-	PgPortSetting                = "PGPORT"
-	PgUserSetting                = "PGUSER"
-	PgHostSetting                = "PGHOST"
-	PgPasswordSetting            = "PGPASSWORD"
-	PgDatabaseSetting            = "PGDATABASE"
-	PgSslModeSetting             = "PGSSLMODE"
-	PgSlotName                   = "WALG_SLOTNAME"
-	PgWalSize                    = "WALG_PG_WAL_SIZE"
-	TotalBgUploadedLimit         = "TOTAL_BG_UPLOADED_LIMIT"
-	NameStreamCreateCmd          = "WALG_STREAM_CREATE_COMMAND"
-	NameStreamRestoreCmd         = "WALG_STREAM_RESTORE_COMMAND"
-	MaxDelayedSegmentsCount      = "WALG_INTEGRITY_MAX_DELAYED_WALS"
-	PrefetchDir                  = "WALG_PREFETCH_DIR"
-	PgReadyRename                = "PG_READY_RENAME"
-	SerializerTypeSetting        = "WALG_SERIALIZER_TYPE"
-	StreamSplitterPartitions     = "WALG_STREAM_SPLITTER_PARTITIONS"
-	StreamSplitterBlockSize      = "WALG_STREAM_SPLITTER_BLOCK_SIZE"
+	DownloadConcurrencySetting         = "WALG_DOWNLOAD_CONCURRENCY"
+	UploadConcurrencySetting           = "WALG_UPLOAD_CONCURRENCY"
+	UploadDiskConcurrencySetting       = "WALG_UPLOAD_DISK_CONCURRENCY"
+	UploadQueueSetting                 = "WALG_UPLOAD_QUEUE"
+	SentinelUserDataSetting            = "WALG_SENTINEL_USER_DATA"
+	PreventWalOverwriteSetting         = "WALG_PREVENT_WAL_OVERWRITE"
+	UploadWalMetadata                  = "WALG_UPLOAD_WAL_METADATA"
+	DeltaMaxStepsSetting               = "WALG_DELTA_MAX_STEPS"
+	DeltaOriginSetting                 = "WALG_DELTA_ORIGIN"
+	CompressionMethodSetting           = "WALG_COMPRESSION_METHOD"
+	StoragePrefixSetting               = "WALG_STORAGE_PREFIX"
+	DiskRateLimitSetting               = "WALG_DISK_RATE_LIMIT"
+	NetworkRateLimitSetting            = "WALG_NETWORK_RATE_LIMIT"
+	UseWalDeltaSetting                 = "WALG_USE_WAL_DELTA"
+	UseReverseUnpackSetting            = "WALG_USE_REVERSE_UNPACK"
+	SkipRedundantTarsSetting           = "WALG_SKIP_REDUNDANT_TARS"
+	VerifyPageChecksumsSetting         = "WALG_VERIFY_PAGE_CHECKSUMS"
+	StoreAllCorruptBlocksSetting       = "WALG_STORE_ALL_CORRUPT_BLOCKS"
+	UseRatingComposerSetting           = "WALG_USE_RATING_COMPOSER"
+	UseCopyComposerSetting             = "WALG_USE_COPY_COMPOSER"
+	WithoutFilesMetadataSetting        = "WALG_WITHOUT_FILES_METADATA"
+	DeltaFromNameSetting               = "WALG_DELTA_FROM_NAME"
+	DeltaFromUserDataSetting           = "WALG_DELTA_FROM_USER_DATA"
+	FetchTargetUserDataSetting         = "WALG_FETCH_TARGET_USER_DATA"
+	LogLevelSetting                    = "WALG_LOG_LEVEL"
+	TarSizeThresholdSetting            = "WALG_TAR_SIZE_THRESHOLD"
+	TarDisableFsyncSetting             = "WALG_TAR_DISABLE_FSYNC"
+	TarFsyncRetriesSetting             = "WALG_TAR_FSYNC_RETRIES"
+	TarOpenRetriesSetting              = "WALG_TAR_OPEN_RETRIES"
+	TarExtractConcurrencySetting       = "WALG_TAR_EXTRACT_CONCURRENCY"
+	TarFsyncBatchSizeSetting           = "WALG_TAR_FSYNC_BATCH_SIZE"
+	TarMaxUnsyncedBytesSetting         = "WALG_TAR_MAX_UNSYNCED_BYTES"
+	VerifyRestoredSizesSetting         = "WALG_VERIFY_RESTORED_SIZES"
+	VerifyRestoredPagesSetting         = "WALG_VERIFY_RESTORED_PAGES"
+	TablespaceConcurrencySetting       = "WALG_TABLESPACE_CONCURRENCY"
+	DeviceConcurrencySetting           = "WALG_DEVICE_CONCURRENCY"
+	DecompressorFallbackSetting        = "WALG_DECOMPRESSOR_FALLBACK"
+	RestoreRateScheduleSetting         = "WALG_RESTORE_RATE_SCHEDULE"
+	RestoreRateLimitSetting            = "WALG_RESTORE_RATE_LIMIT"
+	RestorePreserveOwnerSetting        = "WALG_RESTORE_PRESERVE_OWNER"
+	RestoreUidMapSetting               = "WALG_RESTORE_UID_MAP"
+	RestoreGidMapSetting               = "WALG_RESTORE_GID_MAP"
+	RestoreUidSetting                  = "WALG_RESTORE_UID"
+	RestoreGidSetting                  = "WALG_RESTORE_GID"
+	RestoreOwnerStrictSetting          = "WALG_RESTORE_OWNER_STRICT"
+	RestoreXattrsSetting               = "WALG_RESTORE_XATTRS"
+	RestoreStrictTypeflagSetting       = "WALG_RESTORE_STRICT_TYPEFLAG"
+	RestoreSpecialFilesSetting         = "WALG_RESTORE_SPECIAL_FILES"
+	RestoreDirModeSetting              = "WALG_RESTORE_DIR_MODE"
+	RestoredChecksumsSetting           = "WALG_VERIFY_RESTORED_CHECKSUMS"
+	MetaFetchConcurrencySetting        = "WALG_META_FETCH_CONCURRENCY"
+	DeleteConcurrencySetting           = "WALG_DELETE_CONCURRENCY"
+	DeleteTrashPrefixSetting           = "WALG_DELETE_TRASH_PREFIX"
+	DeleteTrashRetentionSetting        = "WALG_DELETE_TRASH_RETENTION"
+	StorageListingCacheSetting         = "WALG_STORAGE_LISTING_CACHE"
+	RestoreAllowedFilesSetting         = "WALG_RESTORE_ALLOWED_FILES"
+	RestoreLogIntervalSetting          = "WALG_RESTORE_LOG_INTERVAL"
+	PrometheusTextfileSetting          = "WALG_PROMETHEUS_TEXTFILE_DIR"
+	PrometheusPushgatewaySetting       = "WALG_PROMETHEUS_PUSHGATEWAY_URL"
+	PrometheusJobSetting               = "WALG_PROMETHEUS_JOB"
+	DeleteEventLogSetting              = "WALG_DELETE_EVENT_LOG"
+	RestoreRampUpSetting               = "WALG_RESTORE_RAMP_UP"
+	RestoreRampUpStartSetting          = "WALG_RESTORE_RAMP_UP_START"
+	RestoreRampUpWindowSetting         = "WALG_RESTORE_RAMP_UP_WINDOW"
+	CatchupReflinkBaseSetting          = "WALG_CATCHUP_REFLINK_BASE"
+	CseKmsIDSetting                    = "WALG_CSE_KMS_ID"
+	CseKmsRegionSetting                = "WALG_CSE_KMS_REGION"
+	LibsodiumKeySetting                = "WALG_LIBSODIUM_KEY"
+	LibsodiumKeyPathSetting            = "WALG_LIBSODIUM_KEY_PATH"
+	LibsodiumKeyTransform              = "WALG_LIBSODIUM_KEY_TRANSFORM"
+	GpgKeyIDSetting                    = "GPG_KEY_ID"
+	PgpKeySetting                      = "WALG_PGP_KEY"
+	PgpKeyPathSetting                  = "WALG_PGP_KEY_PATH"
+	PgpKeyPassphraseSetting            = "WALG_PGP_KEY_PASSPHRASE"
+	PgDataSetting                      = "PGDATA"
+	UserSetting                        = "USER" // TODO : do something with it
+	PgPortSetting                      = "PGPORT"
+	PgUserSetting                      = "PGUSER"
+	PgHostSetting                      = "PGHOST"
+	PgPasswordSetting                  = "PGPASSWORD"
+	PgDatabaseSetting                  = "PGDATABASE"
+	PgSslModeSetting                   = "PGSSLMODE"
+	PgSlotName                         = "WALG_SLOTNAME"
+	PgWalSize                          = "WALG_PG_WAL_SIZE"
+	TotalBgUploadedLimit               = "TOTAL_BG_UPLOADED_LIMIT"
+	NameStreamCreateCmd                = "WALG_STREAM_CREATE_COMMAND"
+	NameStreamRestoreCmd               = "WALG_STREAM_RESTORE_COMMAND"
+	MaxDelayedSegmentsCount            = "WALG_INTEGRITY_MAX_DELAYED_WALS"
+	PrefetchDir                        = "WALG_PREFETCH_DIR"
+	PgReadyRename                      = "PG_READY_RENAME"
+	RestoreWebhookURLSetting           = "WALG_RESTORE_WEBHOOK_URL"
+	RestoreWebhookTimeoutSetting       = "WALG_RESTORE_WEBHOOK_TIMEOUT"
+	RestoreWebhookRetriesSetting       = "WALG_RESTORE_WEBHOOK_RETRIES"
+	RestoreStatsdAddressSetting        = "WALG_RESTORE_STATSD_ADDRESS"
+	RestoreStatsdPrefixSetting         = "WALG_RESTORE_STATSD_PREFIX"
+	RestoreCapacityCheckSetting        = "WALG_RESTORE_CAPACITY_CHECK"
+	RestoreThroughputSetting           = "WALG_RESTORE_THROUGHPUT"
+	RestoreInodeCheckSetting           = "WALG_RESTORE_INODE_CHECK"
+	RestoreInodeMarginSetting          = "WALG_RESTORE_INODE_MARGIN"
+	RestoreSpaceCheckSetting           = "WALG_RESTORE_SPACE_CHECK"
+	RestoreSpaceMarginSetting          = "WALG_RESTORE_SPACE_MARGIN"
+	RestoreSparseFilesSetting          = "WALG_RESTORE_SPARSE_FILES"
+	RestoreFileTimesSetting            = "WALG_RESTORE_FILE_TIMES"
+	RestoreParallelDeltasSetting       = "WALG_RESTORE_PARALLEL_DELTAS"
+	RestoreVerifyCommandSetting        = "WALG_RESTORE_VERIFY_COMMAND"
+	RestorePostHookSetting             = "WALG_RESTORE_POST_HOOK"
+	RestoreVerifyConcurrencySetting    = "WALG_RESTORE_VERIFY_CONCURRENCY"
+	RestoreVerifyMinSizeSetting        = "WALG_RESTORE_VERIFY_MIN_SIZE"
+	RestoreExistingTablespacesSetting  = "WALG_RESTORE_EXISTING_TABLESPACES"
+	TablespaceCollisionSetting         = "WALG_RESTORE_TABLESPACE_COLLISION"
+	CreateTablespacesSetting           = "WALG_RESTORE_CREATE_TABLESPACES"
+	RestoreProgressSetting             = "WALG_RESTORE_PROGRESS"
+	RestoreProgressIntervalSetting     = "WALG_RESTORE_PROGRESS_INTERVAL"
+	RestoreCompletionMarkerSetting     = "WALG_RESTORE_COMPLETION_MARKER"
+	RestoreCompletionMarkerPathSetting = "WALG_RESTORE_COMPLETION_MARKER_PATH"
+	RestoreDataChecksumsSetting        = "WALG_RESTORE_DATA_CHECKSUMS"
+	SerializerTypeSetting              = "WALG_SERIALIZER_TYPE"
+	StreamSplitterPartitions           = "WALG_STREAM_SPLITTER_PARTITIONS"
+	StreamSplitterBlockSize            = "WALG_STREAM_SPLITTER_BLOCK_SIZE"
 
 	MongoDBUriSetting               = "MONGODB_URI"
 	MongoDBLastWriteUpdateInterval  = "MONGODB_LAST_WRITE_UPDATE_INTERVAL"
@@ -156,6 +220,29 @@ var (
 		UseWalDeltaSetting:           "false",
 		TarSizeThresholdSetting:      "1073741823", // (1 << 30) - 1
 		TarDisableFsyncSetting:       "false",
+		TarFsyncRetriesSetting:       "0",
+		TarOpenRetriesSetting:        "3",
+		TarExtractConcurrencySetting: "1",
+		TarFsyncBatchSizeSetting:     "0",
+		VerifyRestoredSizesSetting:   "false",
+		VerifyRestoredPagesSetting:   "false",
+		DecompressorFallbackSetting:  "false",
+		RestorePreserveOwnerSetting:  "false",
+		RestoreOwnerStrictSetting:    "false",
+		RestoreXattrsSetting:         "false",
+		RestoreStrictTypeflagSetting: "false",
+		RestoreSpecialFilesSetting:   "false",
+		RestoreDirModeSetting:        "0700",
+		RestoredChecksumsSetting:     "false",
+		MetaFetchConcurrencySetting:  "10",
+		DeleteConcurrencySetting:     "10",
+		DeleteTrashRetentionSetting:  "168h",
+		StorageListingCacheSetting:   "false",
+		RestoreAllowedFilesSetting:   "lost+found",
+		PrometheusJobSetting:         "wal-g",
+		RestoreRampUpSetting:         "false",
+		RestoreRampUpStartSetting:    "1",
+		RestoreRampUpWindowSetting:   "30s",
 		TotalBgUploadedLimit:         "32",
 		UseReverseUnpackSetting:      "false",
 		SkipRedundantTarsSetting:     "false",
@@ -189,8 +276,22 @@ var (
 	}
 
 	PGDefaultSettings = map[string]string{
-		PgWalSize:        "16",
-		PgBackRestStanza: "main",
+		PgWalSize:                       "16",
+		PgBackRestStanza:                "main",
+		RestoreWebhookTimeoutSetting:    "10s",
+		RestoreWebhookRetriesSetting:    "3",
+		RestoreStatsdPrefixSetting:      "walg.restore",
+		RestoreInodeMarginSetting:       "10",
+		RestoreSpaceMarginSetting:       "10",
+		RestoreSparseFilesSetting:       "true",
+		RestoreFileTimesSetting:         "true",
+		RestoreParallelDeltasSetting:    "false",
+		RestoreVerifyConcurrencySetting: "2",
+		RestoreVerifyMinSizeSetting:     "0",
+		TablespaceCollisionSetting:      "fail",
+		CreateTablespacesSetting:        "false",
+		RestoreProgressIntervalSetting:  "30s",
+		RestoreCompletionMarkerSetting:  "false",
 	}
 
 	GPDefaultSettings = map[string]string{
@@ -223,6 +324,44 @@ var (
 		LogLevelSetting:              true,
 		TarSizeThresholdSetting:      true,
 		TarDisableFsyncSetting:       true,
+		TarFsyncRetriesSetting:       true,
+		TarOpenRetriesSetting:        true,
+		TarExtractConcurrencySetting: true,
+		TarFsyncBatchSizeSetting:     true,
+		TarMaxUnsyncedBytesSetting:   true,
+		VerifyRestoredSizesSetting:   true,
+		VerifyRestoredPagesSetting:   true,
+		TablespaceConcurrencySetting: true,
+		DeviceConcurrencySetting:     true,
+		DecompressorFallbackSetting:  true,
+		RestoreRateScheduleSetting:   true,
+		RestoreRateLimitSetting:      true,
+		RestorePreserveOwnerSetting:  true,
+		RestoreUidMapSetting:         true,
+		RestoreGidMapSetting:         true,
+		RestoreUidSetting:            true,
+		RestoreGidSetting:            true,
+		RestoreOwnerStrictSetting:    true,
+		RestoreXattrsSetting:         true,
+		RestoreStrictTypeflagSetting: true,
+		RestoreSpecialFilesSetting:   true,
+		RestoreDirModeSetting:        true,
+		RestoredChecksumsSetting:     true,
+		MetaFetchConcurrencySetting:  true,
+		DeleteConcurrencySetting:     true,
+		DeleteTrashPrefixSetting:     true,
+		DeleteTrashRetentionSetting:  true,
+		StorageListingCacheSetting:   true,
+		RestoreAllowedFilesSetting:   true,
+		RestoreLogIntervalSetting:    true,
+		PrometheusTextfileSetting:    true,
+		PrometheusPushgatewaySetting: true,
+		PrometheusJobSetting:         true,
+		DeleteEventLogSetting:        true,
+		RestoreRampUpSetting:         true,
+		RestoreRampUpStartSetting:    true,
+		RestoreRampUpWindowSetting:   true,
+		CatchupReflinkBaseSetting:    true,
 		"WALG_" + GpgKeyIDSetting:    true,
 		"WALE_" + GpgKeyIDSetting:    true,
 		PgpKeySetting:                true,
@@ -338,6 +477,33 @@ var (
 		PrefetchDir:       true,
 		PgReadyRename:     true,
 		PgBackRestStanza:  true,
+
+		RestoreWebhookURLSetting:           true,
+		RestoreWebhookTimeoutSetting:       true,
+		RestoreWebhookRetriesSetting:       true,
+		RestoreStatsdAddressSetting:        true,
+		RestoreStatsdPrefixSetting:         true,
+		RestoreCapacityCheckSetting:        true,
+		RestoreThroughputSetting:           true,
+		RestoreInodeCheckSetting:           true,
+		RestoreInodeMarginSetting:          true,
+		RestoreSpaceCheckSetting:           true,
+		RestoreSpaceMarginSetting:          true,
+		RestoreSparseFilesSetting:          true,
+		RestoreFileTimesSetting:            true,
+		RestoreParallelDeltasSetting:       true,
+		RestoreVerifyCommandSetting:        true,
+		RestorePostHookSetting:             true,
+		RestoreVerifyConcurrencySetting:    true,
+		RestoreVerifyMinSizeSetting:        true,
+		RestoreExistingTablespacesSetting:  true,
+		TablespaceCollisionSetting:         true,
+		CreateTablespacesSetting:           true,
+		RestoreProgressSetting:             true,
+		RestoreProgressIntervalSetting:     true,
+		RestoreCompletionMarkerSetting:     true,
+		RestoreCompletionMarkerPathSetting: true,
+		RestoreDataChecksumsSetting:        true,
 	}
 
 	MongoAllowedSettings = map[string]bool{
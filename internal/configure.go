@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/wal-g/wal-g/internal/crypto/yckms"
@@ -122,6 +123,24 @@ func configureLimiters() {
 		limiters.NetworkLimiter = rate.NewLimiter(rate.Limit(netLimit),
 			int(netLimit+DefaultDataBurstRateLimit)) // Add 8 pages to possible bursts
 	}
+
+	if viper.IsSet(RestoreRateScheduleSetting) {
+		schedule, err := limiters.ParseRateSchedule(viper.GetString(RestoreRateScheduleSetting))
+		tracelog.ErrorLogger.FatalfOnError("Failed to parse "+RestoreRateScheduleSetting+": %v\n", err)
+		limiters.RestoreLimiter = limiters.NewScheduledLimiter(schedule, DefaultDataBurstRateLimit)
+	}
+
+	if viper.IsSet(RestoreRateLimitSetting) {
+		restoreLimit := viper.GetInt64(RestoreRateLimitSetting)
+		if restoreLimit < 0 {
+			tracelog.ErrorLogger.Fatalf("%s must not be negative, got %d\n", RestoreRateLimitSetting, restoreLimit)
+		}
+		if restoreLimit > 0 {
+			// the download and the write of the restored data are limited separately, since the data is compressed
+			limiters.RestoreNetworkLimiter = limiters.NewRateLimiter(restoreLimit, DefaultDataBurstRateLimit)
+			limiters.RestoreDiskLimiter = limiters.NewRateLimiter(restoreLimit, DefaultDataBurstRateLimit)
+		}
+	}
 }
 
 // TODO : unit tests
@@ -134,6 +153,15 @@ func ConfigureFolder() (storage.Folder, error) {
 	return ConfigureStoragePrefix(folder), nil
 }
 
+// ConfigureListingCacheFolder decorates the folder with the cache of its listings
+// if WALG_STORAGE_LISTING_CACHE is enabled, returns the folder as is otherwise
+func ConfigureListingCacheFolder(folder storage.Folder) storage.Folder {
+	if !viper.GetBool(StorageListingCacheSetting) {
+		return folder
+	}
+	return storage.NewListingCacheFolder(folder)
+}
+
 func ConfigureStoragePrefix(folder storage.Folder) storage.Folder {
 	prefix := viper.GetString(StoragePrefixSetting)
 	if prefix != "" {
@@ -142,6 +170,22 @@ func ConfigureStoragePrefix(folder storage.Folder) storage.Folder {
 	return folder
 }
 
+// GetStorageLocation returns the prefix of the storage chosen by ConfigureFolder, e.g. s3://bucket/path,
+// or the empty string if no storage is configured
+func GetStorageLocation() string {
+	for _, adapter := range StorageAdapters {
+		prefix, ok := getWaleCompatibleSetting(adapter.prefixName)
+		if !ok {
+			continue
+		}
+		if storagePrefix := viper.GetString(StoragePrefixSetting); storagePrefix != "" {
+			return strings.TrimSuffix(prefix, "/") + "/" + storagePrefix
+		}
+		return prefix
+	}
+	return ""
+}
+
 // TODO: something with that
 // when provided multiple 'keys' in the config,
 // this function will always return only one concrete 'folder'.
@@ -28,9 +28,12 @@ func NewDeleteHandler(folder storage.Folder) (*DeleteHandler, error) {
 		return obj1.GetLastModified().Before(obj2.GetLastModified())
 	}
 
-	permanentBackups := internal.FindPermanentBackups(folder, NewGenericMetaFetcher())
+	permanentBackups, err := internal.FindPermanentBackups(folder, NewGenericMetaFetcher())
+	if err != nil {
+		return nil, err
+	}
 	isPermanentFunc := func(obj storage.Object) bool {
-		return internal.IsPermanent(obj.GetName(), permanentBackups, BackupNameLength)
+		return internal.IsPermanent(obj.GetName(), permanentBackups)
 	}
 
 	isIgnoredFunc := func(obj storage.Object) bool {
@@ -117,7 +120,10 @@ func (h *DeleteHandler) DeleteBeforeTarget(target internal.BackupObject, confirm
 		tracelog.InfoLogger.Printf("Processing segment %d (backupId=%s)\n", meta.ContentID, meta.BackupID)
 
 		segFolder := h.Folder.GetSubFolder(FormatSegmentStoragePrefix(meta.ContentID))
-		permanentBackups, permanentWals := postgres.GetPermanentBackupsAndWals(segFolder)
+		permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(segFolder)
+		if err != nil {
+			return err
+		}
 
 		segDeleteHandler, err := postgres.NewDeleteHandler(segFolder, permanentBackups, permanentWals, false)
 		if err != nil {
@@ -1,10 +1,16 @@
 package postgres
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
@@ -17,6 +23,8 @@ import (
 const (
 	PgControlPath     = "/global/pg_control"
 	FilesMetadataName = "files_metadata.json"
+	// RelcacheInitFileName is the name of the relation cache init files, which are rebuilt by PostgreSQL on demand
+	RelcacheInitFileName = "pg_internal.init"
 )
 
 var UnwrapAll map[string]bool = nil
@@ -36,6 +44,8 @@ type Backup struct {
 	internal.Backup
 	SentinelDto      *BackupSentinelDto // used for storage query caching
 	FilesMetadataDto *FilesMetadataDto
+	// SentinelUnknownFields are the sentinel fields unknown to the current schema, kept as they are
+	SentinelUnknownFields map[string]json.RawMessage
 }
 
 func ToPgBackup(source internal.Backup) (output Backup) {
@@ -72,26 +82,39 @@ func (backup *Backup) GetSentinel() (BackupSentinelDto, error) {
 		return *backup.SentinelDto, nil
 	}
 
-	// this utility struct is used for compatibility reasons, since
-	// previous WAL-G versions used to store the FilesMetadataDto in the s json
-	s := struct {
-		BackupSentinelDto
-		DeprecatedSentinelFields
-	}{}
-
-	err := backup.FetchSentinel(&s)
+	// the sentinel is decoded field by field since the previous WAL-G versions and WAL-E
+	// used the different schemas, e.g. stored the FilesMetadataDto in the sentinel json
+	var rawSentinel map[string]json.RawMessage
+	err := backup.FetchSentinel(&rawSentinel)
 	if err != nil {
 		return BackupSentinelDto{}, err
 	}
+	s, migrations, unknownFields, err := decodeBackupSentinel(rawSentinel)
+	if err != nil {
+		return BackupSentinelDto{}, errors.Wrapf(err, "failed to decode the sentinel of backup %s", backup.Name)
+	}
 
 	backup.SentinelDto = &s.BackupSentinelDto
+	backup.SentinelUnknownFields = unknownFields
 
 	err = backup.readDeprecatedFields(s.DeprecatedSentinelFields)
 	if err != nil {
 		return BackupSentinelDto{}, err
 	}
+	migration, err := backup.migrateLegacyDeltaFields(backup.SentinelDto)
+	if err != nil {
+		backup.SentinelDto = nil
+		return BackupSentinelDto{}, err
+	}
+	if migration != "" {
+		migrations = append(migrations, migration)
+	}
+	if len(migrations) > 0 {
+		tracelog.InfoLogger.Printf("Backup %s sentinel uses the legacy schema, migrated: %s\n",
+			backup.Name, strings.Join(migrations, ", "))
+	}
 
-	return s.BackupSentinelDto, nil
+	return *backup.SentinelDto, nil
 }
 
 // TODO : unit tests
@@ -183,9 +206,10 @@ func getFilesMetadataPath(backupName string) string {
 	return backupName + "/" + FilesMetadataName
 }
 
-func checkDBDirectoryForUnwrap(dbDataDirectory string, sentinelDto BackupSentinelDto, filesMeta FilesMetadataDto) error {
-	if !sentinelDto.IsIncremental() {
-		isEmpty, err := isDirectoryEmpty(dbDataDirectory)
+func checkDBDirectoryForUnwrap(dbDataDirectory string, sentinelDto BackupSentinelDto, filesMeta FilesMetadataDto,
+	interpreterOptions ...FileTarInterpreterOption) error {
+	if !sentinelDto.IsIncremental() && !allowsNonEmptyDirectory(interpreterOptions...) {
+		isEmpty, err := isDirectoryEmptyForRestore(dbDataDirectory)
 		if err != nil {
 			return err
 		}
@@ -210,7 +234,7 @@ func checkDBDirectoryForUnwrap(dbDataDirectory string, sentinelDto BackupSentine
 	}
 
 	if sentinelDto.TablespaceSpec != nil && !sentinelDto.TablespaceSpec.empty() {
-		err := setTablespacePaths(*sentinelDto.TablespaceSpec)
+		err := setTablespacePathsWithCleanup(*sentinelDto.TablespaceSpec, restoreCleanupOf(interpreterOptions...))
 		if err != nil {
 			return err
 		}
@@ -220,23 +244,47 @@ func checkDBDirectoryForUnwrap(dbDataDirectory string, sentinelDto BackupSentine
 }
 
 func setTablespacePaths(spec TablespaceSpec) error {
+	return setTablespacePathsWithCleanup(spec, nil)
+}
+
+// setTablespacePathsWithCleanup is setTablespacePaths tracking the created paths by the restore cleanup, if any
+func setTablespacePathsWithCleanup(spec TablespaceSpec, cleanup *RestoreCleanup) error {
 	basePrefix, ok := spec.BasePrefix()
 	if !ok {
 		return fmt.Errorf("tablespace specification base path is not set")
 	}
+	cleanup.trackPath(filepath.Join(basePrefix, TablespaceFolder))
 	err := fs.NewFolder(basePrefix, TablespaceFolder).EnsureExists()
 	if err != nil {
 		return fmt.Errorf("error creating pg_tblspc folder %v", err)
 	}
-	for _, location := range spec.tablespaceLocations() {
-		err := fs.NewFolder(location.Location, "").EnsureExists()
+	locations, err := resolveTablespaceCollisions(spec, basePrefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range spec.TablespaceNames() {
+		location, _ := spec.location(name)
+		targetLocation := locations[name]
+		cleanup.trackExternalDirectory(targetLocation)
+		err := fs.NewFolder(targetLocation, "").EnsureExists()
 		if err != nil {
 			return fmt.Errorf("error creating folder for tablespace %v", err)
 		}
-		err = os.Symlink(location.Location, filepath.Join(basePrefix, location.Symlink))
+		symlinkPath := filepath.Join(basePrefix, location.Symlink)
+		existingLocation, symlinkExists, err := readTablespaceSymlink(symlinkPath)
+		if err != nil {
+			return err
+		}
+		if symlinkExists && existingLocation == targetLocation {
+			// e.g. the symlink is created by the previous backup of the delta chain
+			continue
+		}
+		cleanup.trackPath(symlinkPath)
+		err = os.Symlink(targetLocation, symlinkPath)
 		if err != nil {
 			return fmt.Errorf("error creating tablespace symkink %v", err)
 		}
+		tracelog.InfoLogger.Printf("Tablespace %s is restored as the symlink to '%s'\n", name, targetLocation)
 	}
 	return nil
 }
@@ -245,13 +293,16 @@ func setTablespacePaths(spec TablespaceSpec) error {
 func (backup *Backup) unwrapToEmptyDirectory(
 	dbDataDirectory string, sentinelDto BackupSentinelDto,
 	filesMeta FilesMetadataDto, filesToUnwrap map[string]bool, createIncrementalFiles bool,
+	interpreterOptions ...FileTarInterpreterOption,
 ) error {
-	err := checkDBDirectoryForUnwrap(dbDataDirectory, sentinelDto, filesMeta)
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesMeta, filesToUnwrap,
+		createIncrementalFiles, interpreterOptions...)
+	err := checkDBDirectoryForUnwrap(dbDataDirectory, sentinelDto, filesMeta, interpreterOptions...)
 	if err != nil {
 		return err
 	}
 
-	return backup.unwrapOld(dbDataDirectory, sentinelDto, filesMeta, filesToUnwrap, createIncrementalFiles)
+	return backup.unwrapWithInterpreter(tarInterpreter)
 }
 
 // TODO : unit tests
@@ -259,37 +310,112 @@ func (backup *Backup) unwrapToEmptyDirectory(
 func (backup *Backup) unwrapOld(
 	dbDataDirectory string, sentinelDto BackupSentinelDto,
 	filesMeta FilesMetadataDto, filesToUnwrap map[string]bool, createIncrementalFiles bool,
+	interpreterOptions ...FileTarInterpreterOption,
 ) error {
-	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesMeta, filesToUnwrap, createIncrementalFiles)
-	tarsToExtract, pgControlKey, err := backup.getTarsToExtract(filesMeta, filesToUnwrap, false)
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesMeta, filesToUnwrap,
+		createIncrementalFiles, interpreterOptions...)
+	return backup.unwrapWithInterpreter(tarInterpreter)
+}
+
+// unwrapWithInterpreter unpacks the backup with the interpreter created for it
+func (backup *Backup) unwrapWithInterpreter(tarInterpreter *FileTarInterpreter) error {
+	tarInterpreter.backupName = backup.Name
+	err := CheckFilesMetadata(backup.Name, tarInterpreter.Sentinel, tarInterpreter.FilesMetadata)
 	if err != nil {
 		return err
 	}
+	tarsToExtract, pgControlKey, err := backup.getTarsToExtract(tarInterpreter.FilesMetadata,
+		tarInterpreter.FilesToUnwrap, false)
+	if err != nil {
+		return err
+	}
+	tarsToExtract = backup.skipRestoredTars(tarInterpreter, tarsToExtract)
+	tarsToExtract = backup.mirrorTars(tarInterpreter, backup.allowTars(tarInterpreter, tarsToExtract))
+	tarsToExtract = backup.sequenceTars(tarInterpreter, tarsToExtract)
 
 	// Check name for backwards compatibility. Will check for `pg_control` if WALG version of backup.
-	needPgControl := IsPgControlRequired(*backup, sentinelDto)
+	needPgControl := IsPgControlRequired(*backup, tarInterpreter.Sentinel)
 
 	if pgControlKey == "" && needPgControl {
 		return newPgControlNotFoundError()
 	}
+	backup.readPgControlData(tarInterpreter, pgControlKey)
+
+	err = extractTarsInStages(tarInterpreter, tarsToExtract)
+	if _, ok := err.(internal.NoFilesToExtractError); ok && (tarInterpreter.partAllowlist != nil ||
+		tarInterpreter.resumeManifest.isResuming() || hasExternalObjects(tarInterpreter.FilesMetadata)) {
+		// all the parts of the backup are excluded by the allowlist or restored by the previous run,
+		// or the backup files are stored outside of the tars only
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
 
-	err = internal.ExtractAll(tarInterpreter, tarsToExtract)
+	err = backup.resolveExternalObjects(tarInterpreter)
 	if err != nil {
 		return err
 	}
 
-	if needPgControl {
-		err = internal.ExtractAll(tarInterpreter, []internal.ReaderMaker{
-			internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)})
+	if needPgControl && backup.allowTar(tarInterpreter, pgControlKey) {
+		err = internal.ExtractAll(tarInterpreter, []internal.ReaderMaker{backup.mirrorTar(tarInterpreter,
+			internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey))})
 		if err != nil {
 			return errors.Wrap(err, "failed to extract pg_control")
 		}
 	}
 
 	tracelog.InfoLogger.Print("\nBackup extraction complete.\n")
+	tarInterpreter.reportUnwrapResult(backup.Name)
 	return nil
 }
 
+// mirrorTars wraps the tars to be mirrored while they are extracted, if the interpreter has the mirror
+func (backup *Backup) mirrorTars(tarInterpreter *FileTarInterpreter,
+	stages [][]internal.ReaderMaker) [][]internal.ReaderMaker {
+	for _, stage := range stages {
+		for i, readerMaker := range stage {
+			stage[i] = backup.mirrorTar(tarInterpreter, readerMaker)
+		}
+	}
+	return stages
+}
+
+func (backup *Backup) mirrorTar(tarInterpreter *FileTarInterpreter, readerMaker internal.ReaderMaker) internal.ReaderMaker {
+	if tarInterpreter.backupMirror == nil {
+		return readerMaker
+	}
+	return tarInterpreter.backupMirror.wrapReaderMaker(*backup, readerMaker.Path(), readerMaker)
+}
+
+// readPgControlData reads the pg_control data of the backup before its files are extracted, so the version
+// of the restored cluster is known to the whole extraction. The pg_control file itself is still restored last.
+func (backup *Backup) readPgControlData(tarInterpreter *FileTarInterpreter, pgControlKey string) {
+	if pgControlKey == "" || tarInterpreter.pgControlData != nil {
+		return
+	}
+	// the single attempt, the failure is retried by the extraction of pg_control at the end
+	reader := &pgControlDataReader{}
+	err := streamTar(reader, internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey),
+		internal.ConfigureCrypter())
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to read pg_control before the extraction: %v\n", err)
+		return
+	}
+	if reader.data != nil {
+		tarInterpreter.setPgControlData(reader.data)
+	}
+}
+
+// resolveExternalObjects restores the backup files stored outside of the backup tars, if any
+func (backup *Backup) resolveExternalObjects(tarInterpreter *FileTarInterpreter) error {
+	if !hasExternalObjects(tarInterpreter.FilesMetadata) {
+		return nil
+	}
+	resolver := NewExternalObjectResolver(backup.Folder.GetSubFolder(backup.Name), internal.ConfigureCrypter())
+	return resolver.ResolveAll(tarInterpreter)
+}
+
 func IsPgControlRequired(backup Backup, sentinelDto BackupSentinelDto) bool {
 	re := regexp.MustCompile(`^([^_]+._{1}[^_]+._{1})`)
 	walgBasebackupName := re.FindString(backup.Name) == ""
@@ -313,13 +439,13 @@ func isDirectoryEmpty(directoryPath string) (bool, error) {
 
 // TODO : init tests
 func (backup *Backup) getTarsToExtract(filesMeta FilesMetadataDto, filesToUnwrap map[string]bool,
-	skipRedundantTars bool) (tarsToExtract []internal.ReaderMaker, pgControlKey string, err error) {
+	skipRedundantTars bool) (tarsToExtract [][]internal.ReaderMaker, pgControlKey string, err error) {
 	tarNames, err := backup.GetTarNames()
 	if err != nil {
 		return nil, "", err
 	}
 	tracelog.DebugLogger.Printf("Tars to extract: '%+v'\n", tarNames)
-	tarsToExtract = make([]internal.ReaderMaker, 0, len(tarNames))
+	dataTarNames := make([]string, 0, len(tarNames))
 
 	pgControlRe := regexp.MustCompile(`^.*?pg_control\.tar(\..+$|$)`)
 	for _, tarName := range tarNames {
@@ -340,8 +466,15 @@ func (backup *Backup) getTarsToExtract(filesMeta FilesMetadataDto, filesToUnwrap
 			continue
 		}
 
-		tarToExtract := internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), tarName)
-		tarsToExtract = append(tarsToExtract, tarToExtract)
+		dataTarNames = append(dataTarNames, tarName)
+	}
+
+	for _, stage := range splitTarsByRestorePriority(dataTarNames, filesMeta) {
+		stageTars := make([]internal.ReaderMaker, 0, len(stage))
+		for _, tarName := range stage {
+			stageTars = append(stageTars, internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), tarName))
+		}
+		tarsToExtract = append(tarsToExtract, stageTars)
 	}
 	return tarsToExtract, pgControlKey, nil
 }
@@ -366,6 +499,112 @@ func (backup *Backup) GetFilesToUnwrap(fileMask string) (map[string]bool, error)
 	return utility.SelectMatchingFiles(fileMask, filesToUnwrap)
 }
 
+// SelectFilesChangedSince narrows the filesToUnwrap down to the files modified after the specified time.
+// Utility files are always kept, since they are needed to start the restored cluster.
+// Returns an error if the modification time of some selected file is not recorded in the files metadata.
+func SelectFilesChangedSince(files internal.BackupFileList, filesToUnwrap map[string]bool,
+	since time.Time) (map[string]bool, error) {
+	if len(files) == 0 || filesToUnwrap == nil {
+		return nil, errors.New("can't select files by modification time: backup has no files metadata")
+	}
+	result := make(map[string]bool)
+	for fileName := range filesToUnwrap {
+		if UtilityFilePaths[fileName] {
+			result[fileName] = true
+			continue
+		}
+		description, ok := files[fileName]
+		if !ok {
+			continue
+		}
+		if description.MTime.IsZero() {
+			return nil, errors.Errorf("can't select files by modification time: "+
+				"modification time of '%s' is not recorded in the files metadata", fileName)
+		}
+		if description.MTime.After(since) {
+			result[fileName] = true
+		}
+	}
+	tracelog.InfoLogger.Printf("Selected %d files changed since %s\n", len(result), since.Format(time.RFC3339))
+	return result, nil
+}
+
+// SelectFilesWithPrefix narrows the filesToUnwrap down to the files under the path prefix,
+// e.g. "pg_tblspc/16385/", the prefix is relative to the data directory.
+// Returns an error if no file of the backup matches the prefix.
+func SelectFilesWithPrefix(files internal.BackupFileList, filesToUnwrap map[string]bool,
+	prefix string) (map[string]bool, error) {
+	if len(files) == 0 || filesToUnwrap == nil {
+		return nil, errors.New("can't select files by path prefix: backup has no files metadata")
+	}
+	prefix = "/" + strings.TrimPrefix(prefix, "/")
+	result := make(map[string]bool)
+	for fileName := range filesToUnwrap {
+		if _, ok := files[fileName]; ok && strings.HasPrefix(fileName, prefix) {
+			result[fileName] = true
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.Errorf("no file of the backup matches the path prefix '%s'", prefix)
+	}
+	tracelog.InfoLogger.Printf("Selected %d files with the path prefix '%s'\n", len(result), prefix)
+	return result, nil
+}
+
+// SampleFilesToUnwrap narrows the filesToUnwrap down to the sampleSize files, either the first ones by name
+// or randomly chosen. Only the files recorded in the files metadata are sampled.
+func SampleFilesToUnwrap(files internal.BackupFileList, filesToUnwrap map[string]bool,
+	sampleSize int, random bool) (map[string]bool, error) {
+	if len(files) == 0 {
+		return nil, errors.New("can't sample the files: backup has no files metadata")
+	}
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		if filesToUnwrap == nil || filesToUnwrap[fileName] {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	sort.Strings(fileNames)
+	if random {
+		rand.New(rand.NewSource(time.Now().UnixNano())).Shuffle(len(fileNames), func(i, j int) {
+			fileNames[i], fileNames[j] = fileNames[j], fileNames[i]
+		})
+	}
+	if len(fileNames) > sampleSize {
+		fileNames = fileNames[:sampleSize]
+	}
+
+	result := make(map[string]bool, len(fileNames))
+	for _, fileName := range fileNames {
+		result[fileName] = true
+	}
+	tracelog.InfoLogger.Printf("Sampled %d files to restore\n", len(result))
+	return result, nil
+}
+
+// ExcludeRelcacheInitFiles removes the relation cache init files from the filesToUnwrap.
+// The stale cache files are useless after the restore, PostgreSQL rebuilds them at the first connection.
+// If the backup has no files metadata, nothing can be excluded and all the files are unwrapped.
+func ExcludeRelcacheInitFiles(filesToUnwrap map[string]bool) map[string]bool {
+	if filesToUnwrap == nil {
+		tracelog.InfoLogger.Printf("Backup has no files metadata, %s files are restored as is\n", RelcacheInitFileName)
+		return filesToUnwrap
+	}
+	result := make(map[string]bool, len(filesToUnwrap))
+	excludedCount := 0
+	for fileName := range filesToUnwrap {
+		if path.Base(fileName) == RelcacheInitFileName {
+			excludedCount++
+			continue
+		}
+		result[fileName] = true
+	}
+	if excludedCount > 0 {
+		tracelog.InfoLogger.Printf("Skipping %d %s files\n", excludedCount, RelcacheInitFileName)
+	}
+	return result
+}
+
 func shouldUnwrapTar(tarName string, filesMeta FilesMetadataDto, filesToUnwrap map[string]bool) bool {
 	// in case of base backup created with WALG_WITHOUT_FILES_METADATA
 	if len(filesMeta.TarFileSets) == 0 {
@@ -0,0 +1,383 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/walparser/parsingutil"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// BackupFileDiff describes the backup file which differs from the file of the live data directory
+type BackupFileDiff struct {
+	Name          string
+	IsRelation    bool
+	MissingInLive bool `json:",omitempty"`
+	BackupSize    int64
+	LiveSize      int64
+	// ContentDiffers is set for the non-relation files with the different contents
+	ContentDiffers bool `json:",omitempty"`
+	// DifferentBlocks are the numbers of the different pages of the relation file
+	DifferentBlocks []uint32 `json:",omitempty"`
+}
+
+// BackupDiffResult is the result of the backup comparison with the live data directory
+type BackupDiffResult struct {
+	BackupName    string
+	LiveDirectory string
+	ComparedFiles int
+	Differences   []BackupFileDiff
+}
+
+// backupDiffFile is the comparison state of the single file across the backups of the increment chain
+type backupDiffFile struct {
+	mutex      sync.Mutex
+	isRelation bool
+	// backupSize is set by the newest backup containing the file
+	backupSize    int64
+	hasBackupSize bool
+	// coveredBlocks are compared already with the pages of the newer backups
+	coveredBlocks   map[uint32]bool
+	contentDiffers  bool
+	differentBlocks []uint32
+	missingInLive   bool
+}
+
+// backupDiffInterpreter compares the backup files with the live data directory, it never modifies anything.
+// The backups of the increment chain are interpreted from the newest one: the pages stored by the newer
+// backups take precedence, so the older versions of them are not compared.
+type backupDiffInterpreter struct {
+	liveDirectory string
+	sentinel      BackupSentinelDto
+	filesMetadata FilesMetadataDto
+	filesToUnwrap map[string]bool
+
+	mutex *sync.Mutex
+	files map[string]*backupDiffFile
+}
+
+func (interpreter *backupDiffInterpreter) Interpret(reader io.Reader, header *tar.Header) error {
+	if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+		return nil
+	}
+	if interpreter.filesToUnwrap != nil && !interpreter.filesToUnwrap[header.Name] {
+		return nil
+	}
+	if isRewrittenByEveryBackup(header.Name) {
+		return nil
+	}
+	livePath, err := getTargetPath(interpreter.liveDirectory, header.Name)
+	if err != nil {
+		return err
+	}
+	fileDescription, haveFileDescription := interpreter.filesMetadata.Files[header.Name]
+	isIncrement := interpreter.sentinel.IsIncremental() && haveFileDescription && fileDescription.IsIncremented
+	liveFile, err := os.Open(livePath)
+	if os.IsNotExist(err) {
+		file := interpreter.getFile(header.Name)
+		file.mutex.Lock()
+		defer file.mutex.Unlock()
+		file.missingInLive = true
+		if !isIncrement {
+			file.setBackupSize(header.Size)
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to open the live file '%s'", livePath)
+	}
+	defer utility.LoggedClose(liveFile, "")
+
+	if isIncrement {
+		return interpreter.compareIncrement(reader, header.Name, liveFile)
+	}
+	return interpreter.compareFile(reader, header, liveFile)
+}
+
+func (interpreter *backupDiffInterpreter) getFile(name string) *backupDiffFile {
+	interpreter.mutex.Lock()
+	defer interpreter.mutex.Unlock()
+	file, ok := interpreter.files[name]
+	if !ok {
+		file = &backupDiffFile{isRelation: isRelationFileName(name), coveredBlocks: make(map[uint32]bool)}
+		interpreter.files[name] = file
+	}
+	return file
+}
+
+// isRelationFileName checks the file is the paged relation file by its archive name
+func isRelationFileName(name string) bool {
+	name = strings.TrimPrefix(name, "/")
+	return (strings.HasPrefix(name, DefaultTablespace+"/") || strings.HasPrefix(name, TablespaceFolder+"/") ||
+		strings.HasPrefix(name, "global/")) && pagedFilenameRegexp.MatchString(path.Base(name))
+}
+
+// compareIncrement compares the pages stored in the increment with the live file
+func (interpreter *backupDiffInterpreter) compareIncrement(increment io.Reader, name string, liveFile *os.File) error {
+	err := ReadIncrementFileHeader(increment)
+	if err != nil {
+		return err
+	}
+	var fileSize uint64
+	var diffBlockCount uint32
+	err = parsingutil.ParseMultipleFieldsFromReader([]parsingutil.FieldToParse{
+		{Field: &fileSize, Name: "fileSize"},
+		{Field: &diffBlockCount, Name: "diffBlockCount"},
+	}, increment)
+	if err != nil {
+		return err
+	}
+	diffMap := make([]byte, diffBlockCount*sizeofInt32)
+	if _, err = io.ReadFull(increment, diffMap); err != nil {
+		return err
+	}
+
+	file := interpreter.getFile(name)
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	file.setBackupSize(int64(fileSize))
+	page := make([]byte, DatabasePageSize)
+	for i := uint32(0); i < diffBlockCount; i++ {
+		blockNo := binary.LittleEndian.Uint32(diffMap[i*sizeofInt32 : (i+1)*sizeofInt32])
+		if _, err = io.ReadFull(increment, page); err != nil {
+			return err
+		}
+		if err = file.comparePage(blockNo, page, liveFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareFile compares the whole backup file with the live file, page by page for the relation files
+func (interpreter *backupDiffInterpreter) compareFile(reader io.Reader, header *tar.Header, liveFile *os.File) error {
+	file := interpreter.getFile(header.Name)
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	file.setBackupSize(header.Size)
+	if !file.isRelation {
+		same, err := readersEqual(reader, liveFile)
+		if err != nil {
+			return errors.Wrapf(err, "failed to compare '%s'", header.Name)
+		}
+		file.contentDiffers = file.contentDiffers || !same
+		return nil
+	}
+	page := make([]byte, DatabasePageSize)
+	for blockNo := uint32(0); ; blockNo++ {
+		n, err := io.ReadFull(reader, page)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if err = file.comparePage(blockNo, page[:n], liveFile); err != nil {
+			return err
+		}
+	}
+}
+
+// readersEqual checks the readers have the same contents
+func readersEqual(left, right io.Reader) (bool, error) {
+	leftChunk := make([]byte, DatabasePageSize)
+	rightChunk := make([]byte, DatabasePageSize)
+	for {
+		leftCount, leftErr := io.ReadFull(left, leftChunk)
+		if leftErr != nil && leftErr != io.EOF && leftErr != io.ErrUnexpectedEOF {
+			return false, leftErr
+		}
+		rightCount, rightErr := io.ReadFull(right, rightChunk)
+		if rightErr != nil && rightErr != io.EOF && rightErr != io.ErrUnexpectedEOF {
+			return false, rightErr
+		}
+		if !bytes.Equal(leftChunk[:leftCount], rightChunk[:rightCount]) {
+			return false, nil
+		}
+		if leftErr != nil || rightErr != nil {
+			// both readers have ended, since the chunks are equal
+			return leftErr != nil && rightErr != nil, nil
+		}
+	}
+}
+
+func (file *backupDiffFile) setBackupSize(size int64) {
+	if !file.hasBackupSize {
+		file.backupSize = size
+		file.hasBackupSize = true
+	}
+}
+
+// comparePage compares the backup page with the live one, unless the page is compared with the newer backup already
+func (file *backupDiffFile) comparePage(blockNo uint32, page []byte, liveFile *os.File) error {
+	if file.coveredBlocks[blockNo] {
+		return nil
+	}
+	file.coveredBlocks[blockNo] = true
+	livePage := make([]byte, len(page))
+	n, err := liveFile.ReadAt(livePage, int64(blockNo)*DatabasePageSize)
+	if err != nil && err != io.EOF {
+		return errors.Wrapf(err, "failed to read the live file '%s'", liveFile.Name())
+	}
+	if n != len(page) || !bytes.Equal(page, livePage) {
+		file.differentBlocks = append(file.differentBlocks, blockNo)
+	}
+	return nil
+}
+
+// DiffBackup compares the backup with the live data directory. The increment chain of the delta backup
+// is followed down to the full backup, so every file is compared in the state it has in the backup.
+func DiffBackup(folder storage.Folder, backupName, liveDirectory string) (BackupDiffResult, error) {
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	backup := NewBackup(baseBackupFolder, backupName)
+	filesToUnwrap, err := backup.GetFilesToUnwrap("")
+	if err != nil {
+		return BackupDiffResult{}, err
+	}
+	mutex := &sync.Mutex{}
+	files := make(map[string]*backupDiffFile)
+	for {
+		sentinelDto, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+		if err != nil {
+			return BackupDiffResult{}, err
+		}
+		tracelog.InfoLogger.Printf("Comparing backup %s with %s\n", backup.Name, liveDirectory)
+		interpreter := &backupDiffInterpreter{liveDirectory: liveDirectory, sentinel: sentinelDto,
+			filesMetadata: filesMeta, filesToUnwrap: filesToUnwrap, mutex: mutex, files: files}
+		err = backup.compareTars(interpreter, filesMeta, filesToUnwrap)
+		if err != nil {
+			return BackupDiffResult{}, errors.Wrapf(err, "failed to compare backup %s", backup.Name)
+		}
+		if !sentinelDto.IsIncremental() {
+			break
+		}
+		filesToUnwrap, err = GetBaseFilesToUnwrap(filesMeta.Files, filesToUnwrap)
+		if err != nil {
+			return BackupDiffResult{}, err
+		}
+		backup = NewBackup(baseBackupFolder, *sentinelDto.IncrementFrom)
+	}
+	return collectBackupDiffResult(backupName, liveDirectory, files)
+}
+
+func (backup *Backup) compareTars(interpreter *backupDiffInterpreter, filesMeta FilesMetadataDto,
+	filesToUnwrap map[string]bool) error {
+	stages, pgControlKey, err := backup.getTarsToExtract(filesMeta, filesToUnwrap, false)
+	if err != nil {
+		return err
+	}
+	if pgControlKey != "" {
+		stages = append(stages, []internal.ReaderMaker{
+			internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)})
+	}
+	err = extractTarsInStages(interpreter, stages)
+	if _, ok := err.(internal.NoFilesToExtractError); ok {
+		// the files of the delta are all taken from its base
+		return nil
+	}
+	return err
+}
+
+func collectBackupDiffResult(backupName, liveDirectory string,
+	files map[string]*backupDiffFile) (BackupDiffResult, error) {
+	result := BackupDiffResult{BackupName: backupName, LiveDirectory: liveDirectory, ComparedFiles: len(files),
+		Differences: make([]BackupFileDiff, 0)}
+	for name, file := range files {
+		diff := BackupFileDiff{Name: name, IsRelation: file.isRelation, BackupSize: file.backupSize,
+			MissingInLive: file.missingInLive}
+		if !file.missingInLive {
+			liveInfo, err := os.Stat(path.Join(liveDirectory, name))
+			if err != nil {
+				return BackupDiffResult{}, err
+			}
+			diff.LiveSize = liveInfo.Size()
+			diff.ContentDiffers = file.contentDiffers
+			diff.DifferentBlocks = file.differentBlocks
+			sort.Slice(diff.DifferentBlocks, func(i, j int) bool {
+				return diff.DifferentBlocks[i] < diff.DifferentBlocks[j]
+			})
+			// the pages beyond the end of the backup file are not compared
+			if diff.LiveSize == diff.BackupSize && !diff.ContentDiffers && len(diff.DifferentBlocks) == 0 {
+				continue
+			}
+		}
+		result.Differences = append(result.Differences, diff)
+	}
+	// the relation files are the interesting ones, they go first
+	sort.Slice(result.Differences, func(i, j int) bool {
+		left, right := result.Differences[i], result.Differences[j]
+		if left.IsRelation != right.IsRelation {
+			return left.IsRelation
+		}
+		return left.Name < right.Name
+	})
+	return result, nil
+}
+
+// HandleBackupDiff reports the differences between the backup and the live data directory
+func HandleBackupDiff(folder storage.Folder, backupSelector internal.BackupSelector, liveDirectory string,
+	output io.Writer, useJSON bool) {
+	backupName, err := backupSelector.Select(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
+	result, err := DiffBackup(folder, backupName, liveDirectory)
+	tracelog.ErrorLogger.FatalfOnError("Failed to compare the backup: %v", err)
+
+	if useJSON {
+		err = json.NewEncoder(output).Encode(result)
+	} else {
+		err = writeBackupDiffResult(result, output)
+	}
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+func writeBackupDiffResult(result BackupDiffResult, output io.Writer) error {
+	_, err := fmt.Fprintf(output, "[backup-diff] compared files: %d, different files: %d\n",
+		result.ComparedFiles, len(result.Differences))
+	if err != nil {
+		return err
+	}
+	for _, diff := range result.Differences {
+		if _, err = fmt.Fprintln(output, "[backup-diff] "+describeBackupFileDiff(diff)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeBackupFileDiff(diff BackupFileDiff) string {
+	kind := "file"
+	if diff.IsRelation {
+		kind = "relation"
+	}
+	if diff.MissingInLive {
+		return fmt.Sprintf("%s %s: missing in the live directory", kind, diff.Name)
+	}
+	details := make([]string, 0)
+	if diff.BackupSize != diff.LiveSize {
+		details = append(details, fmt.Sprintf("size %d in backup, %d live", diff.BackupSize, diff.LiveSize))
+	}
+	if diff.ContentDiffers {
+		details = append(details, "content differs")
+	}
+	if len(diff.DifferentBlocks) > 0 {
+		blocks := make([]string, 0, len(diff.DifferentBlocks))
+		for _, blockNo := range diff.DifferentBlocks {
+			blocks = append(blocks, fmt.Sprint(blockNo))
+		}
+		details = append(details, fmt.Sprintf("%d pages differ: %s", len(blocks), strings.Join(blocks, ", ")))
+	}
+	return fmt.Sprintf("%s %s: %s", kind, diff.Name, strings.Join(details, "; "))
+}
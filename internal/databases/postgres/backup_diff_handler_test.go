@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	diffTestFullBackup  = "base_000000010000000000000002"
+	diffTestDeltaBackup = "base_000000010000000000000004_D_000000010000000000000002"
+)
+
+func makeDiffTestPage(fill byte) string {
+	return strings.Repeat(string([]byte{fill}), int(DatabasePageSize))
+}
+
+func makeDiffTestIncrement(fileSize uint64, pages map[uint32]string) string {
+	var increment bytes.Buffer
+	increment.Write(IncrementFileHeader)
+	_ = binary.Write(&increment, binary.LittleEndian, fileSize)
+	_ = binary.Write(&increment, binary.LittleEndian, uint32(len(pages)))
+	blockNumbers := make([]uint32, 0, len(pages))
+	for blockNo := range pages {
+		blockNumbers = append(blockNumbers, blockNo)
+	}
+	sort.Slice(blockNumbers, func(i, j int) bool { return blockNumbers[i] < blockNumbers[j] })
+	for _, blockNo := range blockNumbers {
+		_ = binary.Write(&increment, binary.LittleEndian, blockNo)
+	}
+	for _, blockNo := range blockNumbers {
+		increment.WriteString(pages[blockNo])
+	}
+	return increment.String()
+}
+
+func putDiffTestBackup(t *testing.T, folder storage.Folder, name, sentinel string, files internal.BackupFileList,
+	entries ...testTarEntry) {
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	require.NoError(t, baseBackupFolder.PutObject(name+utility.SentinelSuffix, strings.NewReader(sentinel)))
+	filesMetadata, err := json.Marshal(FilesMetadataDto{Files: files})
+	require.NoError(t, err)
+	require.NoError(t, baseBackupFolder.PutObject(getFilesMetadataPath(name), bytes.NewReader(filesMetadata)))
+	tarFolder := baseBackupFolder.GetSubFolder(name + internal.TarPartitionFolderName)
+	require.NoError(t, tarFolder.PutObject("part_1.tar.lz4", bytes.NewReader(makeCompressedTestTar(t, entries...))))
+}
+
+func TestDiffBackup(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putDiffTestBackup(t, folder, diffTestFullBackup, "{}", internal.BackupFileList{
+		"/base/1/1259": {}, "/PG_VERSION": {}, "/global/1262": {},
+	},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestPage('a') + makeDiffTestPage('b') + makeDiffTestPage('c')},
+		testTarEntry{name: "/PG_VERSION", content: "14\n"},
+		testTarEntry{name: "/global/1262", content: makeDiffTestPage('g')})
+	// the delta changes the second page of the relation
+	putDiffTestBackup(t, folder, diffTestDeltaBackup,
+		`{"LSN":67108904,"DeltaFrom":"`+diffTestFullBackup+`","DeltaLSN":33554472,`+
+			`"DeltaFullName":"`+diffTestFullBackup+`","DeltaCount":1}`,
+		internal.BackupFileList{
+			"/base/1/1259": {IsIncremented: true}, "/PG_VERSION": {IsSkipped: true}, "/global/1262": {IsSkipped: true},
+		},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestIncrement(uint64(3*DatabasePageSize),
+			map[uint32]string{1: makeDiffTestPage('B')})})
+
+	liveDirectory := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(liveDirectory, "base", "1"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(liveDirectory, "base", "1", "1259"),
+		[]byte(makeDiffTestPage('a')+makeDiffTestPage('B')+makeDiffTestPage('x')), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(liveDirectory, "PG_VERSION"), []byte("15\n"), 0600))
+
+	result, err := DiffBackup(folder, diffTestDeltaBackup, liveDirectory)
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ComparedFiles)
+	assert.Equal(t, []BackupFileDiff{
+		{Name: "/base/1/1259", IsRelation: true, BackupSize: 3 * DatabasePageSize, LiveSize: 3 * DatabasePageSize,
+			DifferentBlocks: []uint32{2}},
+		{Name: "/global/1262", IsRelation: true, MissingInLive: true, BackupSize: DatabasePageSize},
+		{Name: "/PG_VERSION", BackupSize: 3, LiveSize: 3, ContentDiffers: true},
+	}, result.Differences)
+
+	var output bytes.Buffer
+	require.NoError(t, writeBackupDiffResult(result, &output))
+	assert.Equal(t, "[backup-diff] compared files: 3, different files: 3\n"+
+		"[backup-diff] relation /base/1/1259: 1 pages differ: 2\n"+
+		"[backup-diff] relation /global/1262: missing in the live directory\n"+
+		"[backup-diff] file /PG_VERSION: content differs\n", output.String())
+}
+
+func TestReadersEqual(t *testing.T) {
+	page := makeDiffTestPage('a')
+	for _, testCase := range []struct {
+		left, right string
+		equal       bool
+	}{
+		{"", "", true},
+		{page + "tail", page + "tail", true},
+		{page, page + "tail", false},
+		{page + "tail", page, false},
+		{"tail", "tall", false},
+	} {
+		equal, err := readersEqual(strings.NewReader(testCase.left), strings.NewReader(testCase.right))
+		require.NoError(t, err)
+		assert.Equal(t, testCase.equal, equal)
+	}
+}
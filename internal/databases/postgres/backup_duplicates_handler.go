@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// DuplicateBackup is the backup which has the same content as the original backup of its group
+type DuplicateBackup struct {
+	BackupName string
+	// Increments are the delta backups based on this backup, they have to be deleted together with it
+	Increments []string `json:",omitempty"`
+}
+
+// DuplicateBackupGroup is the set of backups with the identical files manifests
+type DuplicateBackupGroup struct {
+	// Original is the oldest backup of the group, it is never suggested for deletion
+	Original   string
+	Duplicates []DuplicateBackup
+}
+
+type DuplicateBackupsResult struct {
+	ComparedBackups int
+	// SkippedBackups are the backups which manifests can't be compared reliably
+	SkippedBackups []string
+	Groups         []DuplicateBackupGroup
+}
+
+// FindDuplicateBackups groups the backups with the identical files manifests. The manifests are compared
+// by the file names and modification times, the files rewritten by every backup (utility files and
+// relation cache init files) are ignored, as well as the delta-specific flags of the files.
+// The backups without the files metadata or without the modification times of some files are skipped,
+// so the result is conservative: the backups are reported only if their content is certainly the same.
+func FindDuplicateBackups(folder storage.Folder) (DuplicateBackupsResult, error) {
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	backupTimes, err := internal.GetBackups(baseBackupFolder)
+	if err != nil {
+		return DuplicateBackupsResult{}, err
+	}
+	// the oldest backups go first, so they become the originals of the groups
+	sort.SliceStable(backupTimes, func(i, j int) bool {
+		if backupTimes[i].Time.Equal(backupTimes[j].Time) {
+			return backupTimes[i].BackupName < backupTimes[j].BackupName
+		}
+		return backupTimes[i].Time.Before(backupTimes[j].Time)
+	})
+
+	result := DuplicateBackupsResult{SkippedBackups: make([]string, 0), Groups: make([]DuplicateBackupGroup, 0)}
+	increments := make(map[string][]string)
+	groupIndexes := make(map[string]int)
+	groupOriginals := make(map[string]string)
+	for _, backupTime := range backupTimes {
+		backup := NewBackup(baseBackupFolder, backupTime.BackupName)
+		sentinelDto, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+		if err != nil {
+			return DuplicateBackupsResult{}, errors.Wrapf(err, "failed to fetch the metadata of backup '%s'", backup.Name)
+		}
+		if sentinelDto.IsIncremental() {
+			increments[*sentinelDto.IncrementFrom] = append(increments[*sentinelDto.IncrementFrom], backup.Name)
+		}
+		digest, ok := getManifestDigest(filesMeta.Files)
+		if !ok {
+			tracelog.InfoLogger.Printf("Backup %s has no comparable files manifest, skipping it\n", backup.Name)
+			result.SkippedBackups = append(result.SkippedBackups, backup.Name)
+			continue
+		}
+		result.ComparedBackups++
+
+		original, exists := groupOriginals[digest]
+		if !exists {
+			groupOriginals[digest] = backup.Name
+			continue
+		}
+		index, exists := groupIndexes[digest]
+		if !exists {
+			index = len(result.Groups)
+			groupIndexes[digest] = index
+			result.Groups = append(result.Groups, DuplicateBackupGroup{Original: original})
+		}
+		result.Groups[index].Duplicates = append(result.Groups[index].Duplicates,
+			DuplicateBackup{BackupName: backup.Name})
+	}
+
+	for i := range result.Groups {
+		for j := range result.Groups[i].Duplicates {
+			duplicate := &result.Groups[i].Duplicates[j]
+			duplicate.Increments = increments[duplicate.BackupName]
+		}
+	}
+	return result, nil
+}
+
+// getManifestDigest returns the digest of the file names and modification times of the manifest.
+// Returns false if the manifest is empty or some modification time is not recorded.
+func getManifestDigest(files internal.BackupFileList) (string, bool) {
+	names := make([]string, 0, len(files))
+	for name, description := range files {
+		if isRewrittenByEveryBackup(name) {
+			continue
+		}
+		if description.MTime.IsZero() {
+			return "", false
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		// the names can't contain the zero byte, so the entries are unambiguous
+		_, _ = fmt.Fprintf(hash, "%s\x00%s\x00", name, files[name].MTime.UTC().Format(time.RFC3339Nano))
+	}
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
+
+func isRewrittenByEveryBackup(name string) bool {
+	return UtilityFilePaths[name] || UtilityFilePaths[strings.TrimPrefix(name, "/")] ||
+		path.Base(name) == RelcacheInitFileName
+}
+
+// HandleBackupDuplicates reports the duplicate backups, it never deletes anything
+func HandleBackupDuplicates(folder storage.Folder, output io.Writer, useJSON bool) {
+	result, err := FindDuplicateBackups(folder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to find duplicate backups: %v", err)
+
+	if useJSON {
+		err = json.NewEncoder(output).Encode(result)
+	} else {
+		err = writeDuplicateBackupsResult(result, output)
+	}
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+func writeDuplicateBackupsResult(result DuplicateBackupsResult, output io.Writer) error {
+	duplicateCount := 0
+	for _, group := range result.Groups {
+		duplicateCount += len(group.Duplicates)
+	}
+	_, err := fmt.Fprintf(output, "[backup-duplicates] compared backups: %d, skipped backups: %d, duplicates: %d\n",
+		result.ComparedBackups, len(result.SkippedBackups), duplicateCount)
+	if err != nil {
+		return err
+	}
+	for _, group := range result.Groups {
+		for _, duplicate := range group.Duplicates {
+			line := fmt.Sprintf("[backup-duplicates] %s: duplicate of %s", duplicate.BackupName, group.Original)
+			if len(duplicate.Increments) > 0 {
+				line += fmt.Sprintf(" (base of %s)", strings.Join(duplicate.Increments, ", "))
+			}
+			if _, err = fmt.Fprintln(output, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
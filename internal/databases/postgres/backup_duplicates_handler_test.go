@@ -0,0 +1,111 @@
+package postgres_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+var duplicatesTestTime = time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func putTestFilesMetadata(t *testing.T, folder storage.Folder, backupName string, files internal.BackupFileList) {
+	data, err := json.Marshal(postgres.FilesMetadataDto{Files: files})
+	require.NoError(t, err)
+	err = folder.GetSubFolder(utility.BaseBackupPath).
+		PutObject(backupName+"/"+postgres.FilesMetadataName, strings.NewReader(string(data)))
+	require.NoError(t, err)
+}
+
+func makeDuplicatesTestFiles(tableMTime time.Time) internal.BackupFileList {
+	return internal.BackupFileList{
+		"/base/1/1259":                      *internal.NewBackupFileDescription(false, false, duplicatesTestTime),
+		"/base/1/16384":                     *internal.NewBackupFileDescription(false, false, tableMTime),
+		"/global/pg_internal.init":          *internal.NewBackupFileDescription(false, false, tableMTime),
+		postgres.PgControlPath:              *internal.NewBackupFileDescription(false, false, tableMTime),
+		"/PG_VERSION":                       *internal.NewBackupFileDescription(false, false, duplicatesTestTime),
+		"/pg_xact/0000":                     *internal.NewBackupFileDescription(false, false, duplicatesTestTime),
+		"/pg_logical/replorigin_checkpoint": *internal.NewBackupFileDescription(false, false, duplicatesTestTime),
+	}
+}
+
+func TestFindDuplicateBackups(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putTestSentinel(t, folder, verifyFullBackup, makeTestSentinel(0x2000000, "", "", 0))
+	putTestFilesMetadata(t, folder, verifyFullBackup, makeDuplicatesTestFiles(duplicatesTestTime))
+
+	// the delta backup skipping all the files has the same content as its base
+	putTestSentinel(t, folder, verifyDeltaBackup,
+		makeTestSentinel(0x4000000, verifyFullBackup, verifyFullBackup, 0x2000000))
+	deltaFiles := makeDuplicatesTestFiles(duplicatesTestTime)
+	for name, description := range deltaFiles {
+		description.IsSkipped = true
+		deltaFiles[name] = description
+	}
+	deltaFiles[postgres.PgControlPath] = *internal.NewBackupFileDescription(false, false, time.Now())
+	putTestFilesMetadata(t, folder, verifyDeltaBackup, deltaFiles)
+
+	putTestSentinel(t, folder, verifyDelta2Backup,
+		makeTestSentinel(0x6000000, verifyDeltaBackup, verifyFullBackup, 0x4000000))
+	putTestFilesMetadata(t, folder, verifyDelta2Backup, makeDuplicatesTestFiles(duplicatesTestTime.Add(time.Hour)))
+
+	result, err := postgres.FindDuplicateBackups(folder)
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ComparedBackups)
+	assert.Empty(t, result.SkippedBackups)
+	assert.Equal(t, []postgres.DuplicateBackupGroup{{
+		Original: verifyFullBackup,
+		Duplicates: []postgres.DuplicateBackup{
+			{BackupName: verifyDeltaBackup, Increments: []string{verifyDelta2Backup}},
+		},
+	}}, result.Groups)
+}
+
+func TestFindDuplicateBackups_SkipsIncomparableManifests(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putTestSentinel(t, folder, verifyFullBackup, makeTestSentinel(0x2000000, "", "", 0))
+	putTestFilesMetadata(t, folder, verifyFullBackup, makeDuplicatesTestFiles(duplicatesTestTime))
+
+	secondBackup := "base_000000010000000000000004"
+	putTestSentinel(t, folder, secondBackup, makeTestSentinel(0x4000000, "", "", 0))
+	files := makeDuplicatesTestFiles(duplicatesTestTime)
+	files["/base/1/16384"] = *internal.NewBackupFileDescription(false, false, time.Time{})
+	putTestFilesMetadata(t, folder, secondBackup, files)
+
+	thirdBackup := "base_000000010000000000000006"
+	putTestSentinel(t, folder, thirdBackup, makeTestSentinel(0x6000000, "", "", 0))
+
+	result, err := postgres.FindDuplicateBackups(folder)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.ComparedBackups)
+	assert.ElementsMatch(t, []string{secondBackup, thirdBackup}, result.SkippedBackups)
+	assert.Empty(t, result.Groups)
+}
+
+func TestHandleBackupDuplicates_NeverDeletes(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	secondBackup := "base_000000010000000000000004"
+	putTestSentinel(t, folder, verifyFullBackup, makeTestSentinel(0x2000000, "", "", 0))
+	putTestFilesMetadata(t, folder, verifyFullBackup, makeDuplicatesTestFiles(duplicatesTestTime))
+	putTestSentinel(t, folder, secondBackup, makeTestSentinel(0x4000000, "", "", 0))
+	putTestFilesMetadata(t, folder, secondBackup, makeDuplicatesTestFiles(duplicatesTestTime))
+
+	var output bytes.Buffer
+	postgres.HandleBackupDuplicates(folder, &output, false)
+
+	assert.Contains(t, output.String(), secondBackup+": duplicate of "+verifyFullBackup)
+	exists, err := folder.GetSubFolder(utility.BaseBackupPath).Exists(secondBackup + utility.SentinelSuffix)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
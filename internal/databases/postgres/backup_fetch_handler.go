@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
@@ -36,6 +38,292 @@ func (err PgControlNotFoundError) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+// FetchOptions contains the optional parameters of the backup fetch
+type FetchOptions struct {
+	// ChangedSince, if set, restricts the fetch to the files modified after the specified time
+	ChangedSince *time.Time
+	// OnlyPrefix, if set, restricts the fetch to the files under the path prefix relative to the data directory
+	OnlyPrefix string
+	// UnwrapList, if set, restricts the fetch to the listed backup files
+	UnwrapList []string
+	// RestorePlugin, if set, is notified about the restore lifecycle events
+	RestorePlugin RestorePlugin
+	// ConcurrencyLimiter, if set, limits the number of files concurrently written to the same tablespace or device
+	ConcurrencyLimiter *RestoreConcurrencyLimiter
+	// UnsyncedDataLimiter, if set, caps the size of the restored data written without fsync
+	UnsyncedDataLimiter *UnsyncedDataLimiter
+	// CapacityGuard, if set, makes the restore fail before the bounded restore target overflows
+	CapacityGuard *RestoreCapacityGuard
+	// InodeCheck, if set, makes the restore fail before it starts if there are not enough free inodes
+	InodeCheck *RestoreInodeCheck
+	// SpaceCheck, if set, makes the restore fail before it starts if there is not enough free space
+	SpaceCheck *RestoreSpaceCheck
+	// PageVerifier, if set, verifies the page checksums of the restored relation files
+	PageVerifier *RestoredPageVerifier
+	// BackupMirror, if set, mirrors the restored backups to the second storage
+	BackupMirror *BackupMirror
+	// PartAllowlist, if set, restricts the restore to the listed tar parts
+	PartAllowlist *TarPartAllowlist
+	// MerkleTree, if set, is built over the restored files to attest their integrity with the root hash
+	MerkleTree *RestoreMerkleTree
+	// UnwrapReport, if set, collects the unwrap results of the restored backups to write them as the JSON report
+	UnwrapReport *RestoreUnwrapReport
+	// DatabaseRelocation, if set, restores the specified databases to the alternate directories
+	DatabaseRelocation *DatabaseRelocation
+	// Ownership, if set, applies the stored owner translated by the id maps, or the override, to the restored files
+	Ownership *RestoreOwnership
+	// Xattrs, if set, reapplies the stored extended attributes to the restored files
+	Xattrs *RestoreXattrs
+	// TablespaceMapping, if set, restores the mapped tablespaces to the new locations
+	TablespaceMapping *RestoreTablespaceMapping
+	// PathMap, if set, rewrites the absolute symlink targets, tablespace locations and hardlink sources
+	// of the backup host to the ones of the restore host
+	PathMap *RestorePathMap
+	// VerifyCommand, if set, runs the custom command against every restored file
+	VerifyCommand *RestoreVerifyCommand
+	// ByteBudget, if set, stops the restore of the new files once the restored files reach the budget
+	ByteBudget *RestoreByteBudget
+	// Exclusion, if set, skips the regular files matching the exclusion patterns
+	Exclusion *RestoreExclusion
+	// Progress, if set, periodically logs the restore progress in bytes or increment blocks
+	Progress *RestoreProgress
+	// Metrics, if set, records the restore metrics, it should receive the restore events as the RestorePlugin as well
+	Metrics *RestoreMetrics
+	// ResumeManifest, if set, records the restored files, so the interrupted restore can be resumed skipping them
+	ResumeManifest *RestoreResumeManifest
+	// CompletionMarker, if set, is written once the restore has completed, for the automation waiting for it
+	CompletionMarker *RestoreCompletionMarker
+	// BestEffort, if set, makes the restore continue past the failed files and fail with their summary at the end
+	BestEffort *BestEffortRestore
+	// AllowNonEmptyDirectory makes the full backup be restored over the files in the data directory
+	// not allowed by WALG_RESTORE_ALLOWED_FILES, they are only logged
+	AllowNonEmptyDirectory bool
+	// CleanUpOnFailure makes the restore remove everything it has written if it fails or is cancelled
+	CleanUpOnFailure bool
+	// StrictBackupLabel makes the restore fail if the restored backup_label does not match the sentinel
+	StrictBackupLabel bool
+	// StrictDataChecksums makes the restore fail if the data checksums setting of the restored pg_control
+	// does not match WALG_RESTORE_DATA_CHECKSUMS
+	StrictDataChecksums bool
+	// KeepRelcacheInitFiles makes the restore fetch the pg_internal.init files, which are skipped by default
+	KeepRelcacheInitFiles bool
+	// SampleSize, if positive, restricts the fetch to the specified number of the selected files
+	SampleSize int
+	// SampleRandomly makes the sampled files be chosen randomly instead of the first ones by name
+	SampleRandomly bool
+	// WalgVersion is recorded into the restore provenance
+	WalgVersion string
+}
+
+// getInterpreterOptions returns the options of FileTarInterpreter according to the fetch options
+func (options FetchOptions) getInterpreterOptions(plugin RestorePlugin,
+	cleanup *RestoreCleanup) []FileTarInterpreterOption {
+	interpreterOptions := []FileTarInterpreterOption{WithRestorePlugin(plugin)}
+	if cleanup != nil {
+		interpreterOptions = append(interpreterOptions, WithRestoreCleanup(cleanup))
+	}
+	if options.ConcurrencyLimiter != nil {
+		interpreterOptions = append(interpreterOptions, WithConcurrencyLimiter(options.ConcurrencyLimiter))
+	}
+	if options.UnsyncedDataLimiter != nil {
+		interpreterOptions = append(interpreterOptions, WithUnsyncedDataLimiter(options.UnsyncedDataLimiter))
+	}
+	if options.CapacityGuard != nil {
+		interpreterOptions = append(interpreterOptions, WithCapacityGuard(options.CapacityGuard))
+	}
+	if options.BackupMirror != nil {
+		interpreterOptions = append(interpreterOptions, WithBackupMirror(options.BackupMirror))
+	}
+	if options.PartAllowlist != nil {
+		interpreterOptions = append(interpreterOptions, WithPartAllowlist(options.PartAllowlist))
+	}
+	if options.MerkleTree != nil {
+		interpreterOptions = append(interpreterOptions, WithMerkleTree(options.MerkleTree))
+	}
+	if options.UnwrapReport != nil {
+		interpreterOptions = append(interpreterOptions, WithUnwrapReport(options.UnwrapReport))
+	}
+	if options.DatabaseRelocation != nil {
+		interpreterOptions = append(interpreterOptions, WithDatabaseRelocation(options.DatabaseRelocation))
+	}
+	if options.Ownership != nil {
+		interpreterOptions = append(interpreterOptions, WithRestoreOwnership(options.Ownership))
+	}
+	if options.Xattrs != nil {
+		interpreterOptions = append(interpreterOptions, WithRestoreXattrs(options.Xattrs))
+	}
+	if options.TablespaceMapping != nil {
+		interpreterOptions = append(interpreterOptions, WithTablespaceMapping(options.TablespaceMapping))
+	}
+	if options.PathMap != nil {
+		interpreterOptions = append(interpreterOptions, WithPathMap(options.PathMap))
+	}
+	if options.VerifyCommand != nil {
+		interpreterOptions = append(interpreterOptions, WithVerifyCommand(options.VerifyCommand))
+	}
+	if options.ByteBudget != nil {
+		interpreterOptions = append(interpreterOptions, WithByteBudget(options.ByteBudget))
+	}
+	if options.Exclusion != nil {
+		interpreterOptions = append(interpreterOptions, WithRestoreExclusion(options.Exclusion))
+	}
+	if options.Progress != nil {
+		interpreterOptions = append(interpreterOptions, WithRestoreProgress(options.Progress))
+	}
+	if options.Metrics != nil {
+		interpreterOptions = append(interpreterOptions, WithRestoreMetrics(options.Metrics))
+	}
+	if options.ResumeManifest != nil {
+		interpreterOptions = append(interpreterOptions, WithResumeManifest(options.ResumeManifest))
+	}
+	if options.BestEffort != nil {
+		interpreterOptions = append(interpreterOptions, WithBestEffort(options.BestEffort))
+	}
+	if options.CompletionMarker != nil {
+		interpreterOptions = append(interpreterOptions, WithCompletionMarker(options.CompletionMarker))
+	}
+	if options.AllowNonEmptyDirectory {
+		interpreterOptions = append(interpreterOptions, WithNonEmptyDirectoryAllowed())
+	}
+	return interpreterOptions
+}
+
+// startRestore notifies the restore plugin about the restore start and returns the plugin
+// which should receive the rest of the restore events
+func (options FetchOptions) startRestore(backupName, dbDataDirectory string) RestorePlugin {
+	plugin := newTablespaceTrackingPlugin(options.RestorePlugin)
+	plugin.OnRestoreStart(RestoreStartInfo{BackupName: backupName, DBDataDirectory: dbDataDirectory})
+	return plugin
+}
+
+// startProgress starts the periodic restore progress reports, if enabled
+func (options FetchOptions) startProgress(backup Backup, folder storage.Folder, filesToUnwrap map[string]bool) error {
+	if options.Progress == nil {
+		return nil
+	}
+	return options.Progress.start(backup, folder, filesToUnwrap)
+}
+
+// finishProgress stops the restore progress reports and logs the final progress
+func (options FetchOptions) finishProgress() {
+	if options.Progress != nil {
+		options.Progress.finish()
+	}
+}
+
+// finishBestEffort logs the summary of the files failed to restore in the best-effort restore
+// and returns PartialRestoreError if there are any
+func (options FetchOptions) finishBestEffort() error {
+	if options.BestEffort == nil {
+		return nil
+	}
+	return options.BestEffort.Finish()
+}
+
+// startCleanup returns the cleanup of the failed restore, if enabled, watching for the restore cancellation
+func (options FetchOptions) startCleanup(dbDataDirectory string) (*RestoreCleanup, func(), error) {
+	if !options.CleanUpOnFailure {
+		return nil, func() {}, nil
+	}
+	cleanup, err := NewRestoreCleanup(dbDataDirectory)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cleanup, cleanup.WatchSignals(), nil
+}
+
+// finishCleanup stops watching for the cancellation and cleans up the restore if it has failed
+func finishCleanup(cleanup *RestoreCleanup, stopWatching func(), restoreErr error) {
+	stopWatching()
+	if cleanup == nil || restoreErr == nil {
+		return
+	}
+	err := cleanup.Cleanup()
+	if err != nil {
+		tracelog.ErrorLogger.Printf("Failed to clean up the failed restore: %v\n", err)
+	}
+}
+
+// checkRestoreTarget verifies that the restore target can hold the backup before the restore starts
+func (options FetchOptions) checkRestoreTarget(backup Backup, dbDataDirectory string,
+	filesToUnwrap map[string]bool, tablespaceSpec *TablespaceSpec) error {
+	if err := removeRestoreTemporaryFiles(dbDataDirectory); err != nil {
+		return err
+	}
+	if err := options.checkDataDirectoryEmpty(dbDataDirectory); err != nil {
+		return err
+	}
+	if options.InodeCheck == nil && options.SpaceCheck == nil {
+		return nil
+	}
+	sentinelDto, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+	if err != nil {
+		return err
+	}
+	if options.InodeCheck != nil {
+		if err = options.InodeCheck.Check(dbDataDirectory, filesMeta, filesToUnwrap); err != nil {
+			return err
+		}
+	}
+	if options.SpaceCheck != nil {
+		tablespaceSpec = chooseTablespaceSpecification(sentinelDto.TablespaceSpec, tablespaceSpec)
+		return options.SpaceCheck.Check(dbDataDirectory, filesMeta, filesToUnwrap, tablespaceSpec)
+	}
+	return nil
+}
+
+// selectFilesToUnwrap returns the files of the backup which should be fetched according to the options
+func (options FetchOptions) selectFilesToUnwrap(backup Backup, fileMask string) (map[string]bool, error) {
+	filesToUnwrap, err := backup.GetFilesToUnwrap(fileMask)
+	if err != nil {
+		return nil, err
+	}
+	if options.ChangedSince != nil {
+		_, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+		if err != nil {
+			return nil, err
+		}
+		filesToUnwrap, err = SelectFilesChangedSince(filesMeta.Files, filesToUnwrap, *options.ChangedSince)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if options.OnlyPrefix != "" {
+		_, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+		if err != nil {
+			return nil, err
+		}
+		filesToUnwrap, err = SelectFilesWithPrefix(filesMeta.Files, filesToUnwrap, options.OnlyPrefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if options.UnwrapList != nil {
+		_, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+		if err != nil {
+			return nil, err
+		}
+		filesToUnwrap, err = SelectListedFiles(filesMeta.Files, filesToUnwrap, options.UnwrapList)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !options.KeepRelcacheInitFiles {
+		filesToUnwrap = ExcludeRelcacheInitFiles(filesToUnwrap)
+	}
+	if options.SampleSize > 0 {
+		_, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+		if err != nil {
+			return nil, err
+		}
+		filesToUnwrap, err = SampleFilesToUnwrap(filesMeta.Files, filesToUnwrap, options.SampleSize, options.SampleRandomly)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filesToUnwrap, nil
+}
+
 func readRestoreSpec(path string, spec *TablespaceSpec) (err error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -63,7 +351,7 @@ func chooseTablespaceSpecification(sentinelDtoSpec, spec *TablespaceSpec) *Table
 // TODO : unit tests
 // deltaFetchRecursion function composes Backup object and recursively searches for necessary base backup
 func deltaFetchRecursionOld(backup Backup, folder storage.Folder, dbDataDirectory string,
-	tablespaceSpec *TablespaceSpec, filesToUnwrap map[string]bool) error {
+	tablespaceSpec *TablespaceSpec, filesToUnwrap map[string]bool, interpreterOptions ...FileTarInterpreterOption) error {
 	sentinelDto, filesMetaDto, err := backup.GetSentinelAndFilesMetadata()
 	if err != nil {
 		return err
@@ -78,7 +366,8 @@ func deltaFetchRecursionOld(backup Backup, folder storage.Folder, dbDataDirector
 			return err
 		}
 		incrementFrom := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), *sentinelDto.IncrementFrom)
-		err = deltaFetchRecursionOld(incrementFrom, folder, dbDataDirectory, tablespaceSpec, baseFilesToUnwrap)
+		err = deltaFetchRecursionOld(incrementFrom, folder, dbDataDirectory, tablespaceSpec, baseFilesToUnwrap,
+			interpreterOptions...)
 		if err != nil {
 			return err
 		}
@@ -86,13 +375,15 @@ func deltaFetchRecursionOld(backup Backup, folder storage.Folder, dbDataDirector
 			*(sentinelDto.IncrementFrom), *(sentinelDto.IncrementFromLSN), *(sentinelDto.BackupStartLSN))
 	}
 
-	return backup.unwrapToEmptyDirectory(dbDataDirectory, sentinelDto, filesMetaDto, filesToUnwrap, false)
+	return backup.unwrapToEmptyDirectory(dbDataDirectory, sentinelDto, filesMetaDto, filesToUnwrap, false,
+		interpreterOptions...)
 }
 
-func GetPgFetcherOld(dbDataDirectory, fileMask, restoreSpecPath string) func(rootFolder storage.Folder, backup internal.Backup) {
+func GetPgFetcherOld(dbDataDirectory, fileMask, restoreSpecPath string,
+	options FetchOptions) func(rootFolder storage.Folder, backup internal.Backup) {
 	return func(rootFolder storage.Folder, backup internal.Backup) {
 		pgBackup := ToPgBackup(backup)
-		filesToUnwrap, err := pgBackup.GetFilesToUnwrap(fileMask)
+		filesToUnwrap, err := options.selectFilesToUnwrap(pgBackup, fileMask)
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
 
 		var spec *TablespaceSpec
@@ -102,11 +393,152 @@ func GetPgFetcherOld(dbDataDirectory, fileMask, restoreSpecPath string) func(roo
 			errMessege := fmt.Sprintf("Invalid restore specification path %s\n", restoreSpecPath)
 			tracelog.ErrorLogger.FatalfOnError(errMessege, err)
 		}
-		err = deltaFetchRecursionOld(pgBackup, rootFolder, utility.ResolveSymlink(dbDataDirectory), spec, filesToUnwrap)
+		spec, err = options.remapTablespaces(pgBackup, spec)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		resolvedDataDirectory := utility.ResolveSymlink(dbDataDirectory)
+		err = options.checkRestoreTarget(pgBackup, resolvedDataDirectory, filesToUnwrap, spec)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = options.startCompletionMarker(resolvedDataDirectory)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		cleanup, stopWatching, err := options.startCleanup(resolvedDataDirectory)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = options.startProgress(pgBackup, rootFolder, filesToUnwrap)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		plugin := options.startRestore(pgBackup.Name, resolvedDataDirectory)
+		fetchDeltaChain := deltaFetchRecursionOld
+		if viper.GetBool(internal.RestoreParallelDeltasSetting) {
+			if options.ResumeManifest == nil {
+				fetchDeltaChain = deltaFetchParallelOld
+			} else {
+				tracelog.WarningLogger.Println("The delta chain layers are restored sequentially to resume the restore")
+			}
+		}
+		err = fetchDeltaChain(pgBackup, rootFolder, resolvedDataDirectory, spec, filesToUnwrap,
+			options.getInterpreterOptions(plugin, cleanup)...)
+		options.finishProgress()
+		if err == nil {
+			err = options.finishBestEffort()
+		}
+		if err == nil {
+			err = options.validateRestoredDataDirectory(pgBackup, resolvedDataDirectory)
+		}
+		if err == nil {
+			err = options.writeProvenance(pgBackup.Name, resolvedDataDirectory)
+		}
+		if err == nil {
+			err = RunRestorePostHook(resolvedDataDirectory, options.UnsyncedDataLimiter)
+		}
+		err = options.finishCompletionMarker(pgBackup, resolvedDataDirectory, fileMask, err)
+		finishCleanup(cleanup, stopWatching, err)
+		options.finishResume(err)
+		plugin.OnRestoreFinish(RestoreFinishInfo{BackupName: pgBackup.Name, DBDataDirectory: resolvedDataDirectory, Err: err})
+		options.finishMirror(err)
+		options.reportExcludedParts()
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
 	}
 }
 
+// finishResume closes the resume manifest, it is kept only if the restore has failed
+func (options FetchOptions) finishResume(restoreErr error) {
+	if options.ResumeManifest != nil {
+		options.ResumeManifest.Finish(restoreErr)
+	}
+}
+
+// finishMirror completes the mirroring of the successfully restored backup. The mirror failures
+// are reported separately and do not affect the restore result.
+func (options FetchOptions) finishMirror(restoreErr error) {
+	if options.BackupMirror == nil {
+		return
+	}
+	if restoreErr != nil {
+		tracelog.WarningLogger.Println("Mirror: the restore has failed, the backup is not mirrored")
+		return
+	}
+	options.BackupMirror.Finish()
+}
+
+// reportExcludedParts reports the files which were not restored because of the part allowlist or the byte budget
+func (options FetchOptions) reportExcludedParts() {
+	if options.PartAllowlist != nil {
+		options.PartAllowlist.LogReport()
+	}
+	if options.ByteBudget != nil {
+		options.ByteBudget.LogReport()
+	}
+}
+
+// validateRestoredDataDirectory runs the optional checks of the restored data directory
+func (options FetchOptions) validateRestoredDataDirectory(backup Backup, dbDataDirectory string) error {
+	if viper.GetBool(internal.VerifyRestoredSizesSetting) {
+		err := ValidateRelationSegmentSizes(dbDataDirectory)
+		if err != nil {
+			return err
+		}
+	}
+	if options.PageVerifier != nil {
+		sentinel, err := backup.GetSentinel()
+		if err != nil {
+			return err
+		}
+		var backupStartLSN uint64
+		if sentinel.BackupStartLSN != nil {
+			backupStartLSN = *sentinel.BackupStartLSN
+		}
+		err = options.PageVerifier.VerifyDataDirectory(dbDataDirectory, backupStartLSN)
+		if err != nil {
+			return err
+		}
+	}
+	if options.VerifyCommand != nil {
+		err := options.VerifyCommand.VerifyFiles()
+		if err != nil {
+			return err
+		}
+	}
+	sentinelDto, err := backup.GetSentinel()
+	if err != nil {
+		return err
+	}
+	err = CheckBackupLabel(dbDataDirectory, sentinelDto, options.StrictBackupLabel)
+	if err != nil {
+		return err
+	}
+	expectedDataChecksums, err := ConfigureExpectedDataChecksums()
+	if err != nil {
+		return err
+	}
+	err = CheckDataChecksums(dbDataDirectory, expectedDataChecksums, options.StrictDataChecksums)
+	if err != nil {
+		return err
+	}
+	if options.MerkleTree != nil {
+		err := options.MerkleTree.Finish()
+		if err != nil {
+			return err
+		}
+	}
+	if options.UnwrapReport != nil {
+		err := options.UnwrapReport.Finish()
+		if err != nil {
+			return err
+		}
+	}
+	if options.ByteBudget != nil && len(options.ByteBudget.SkippedFiles()) > 0 {
+		tracelog.InfoLogger.Printf("Restore stopped at the byte budget, the restored data directory is incomplete " +
+			"and can't be used to start the cluster\n")
+	}
+	if options.OnlyPrefix != "" {
+		tracelog.InfoLogger.Printf("Restore of the files with the path prefix '%s' succeeded, the restored data directory "+
+			"is incomplete and can't be used to start the cluster\n", options.OnlyPrefix)
+	}
+	if options.SampleSize > 0 {
+		tracelog.InfoLogger.Printf("Sample restore succeeded, the restored data directory is incomplete " +
+			"and can't be used to start the cluster\n")
+	}
+	return nil
+}
+
 func GetBaseFilesToUnwrap(backupFileStates internal.BackupFileList, currentFilesToUnwrap map[string]bool) (map[string]bool, error) {
 	baseFilesToUnwrap := make(map[string]bool)
 	for file := range currentFilesToUnwrap {
@@ -10,10 +10,10 @@ import (
 )
 
 func GetPgFetcherNew(dbDataDirectory, fileMask, restoreSpecPath string, skipRedundantTars bool,
-) func(folder storage.Folder, backup internal.Backup) {
+	options FetchOptions) func(folder storage.Folder, backup internal.Backup) {
 	return func(folder storage.Folder, backup internal.Backup) {
 		pgBackup := ToPgBackup(backup)
-		filesToUnwrap, err := pgBackup.GetFilesToUnwrap(fileMask)
+		filesToUnwrap, err := options.selectFilesToUnwrap(pgBackup, fileMask)
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
 
 		var spec *TablespaceSpec
@@ -23,18 +23,40 @@ func GetPgFetcherNew(dbDataDirectory, fileMask, restoreSpecPath string, skipRedu
 			errMessage := fmt.Sprintf("Invalid restore specification path %s\n", restoreSpecPath)
 			tracelog.ErrorLogger.FatalfOnError(errMessage, err)
 		}
-
-		// directory must be empty before starting a deltaFetch
-		isEmpty, err := isDirectoryEmpty(dbDataDirectory)
+		spec, err = options.remapTablespaces(pgBackup, spec)
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
 
-		if !isEmpty {
-			tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n",
-				NewNonEmptyDBDataDirectoryError(dbDataDirectory))
-		}
-		config := NewFetchConfig(pgBackup.Name,
-			utility.ResolveSymlink(dbDataDirectory), folder, spec, filesToUnwrap, skipRedundantTars)
+		resolvedDataDirectory := utility.ResolveSymlink(dbDataDirectory)
+		err = options.checkRestoreTarget(pgBackup, resolvedDataDirectory, filesToUnwrap, spec)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = options.startCompletionMarker(resolvedDataDirectory)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		cleanup, stopWatching, err := options.startCleanup(resolvedDataDirectory)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = options.startProgress(pgBackup, folder, filesToUnwrap)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		plugin := options.startRestore(pgBackup.Name, resolvedDataDirectory)
+		config := NewFetchConfig(pgBackup.Name, resolvedDataDirectory, folder, spec, filesToUnwrap, skipRedundantTars,
+			options.getInterpreterOptions(plugin, cleanup)...)
 		err = deltaFetchRecursionNew(config)
+		options.finishProgress()
+		if err == nil {
+			err = options.finishBestEffort()
+		}
+		if err == nil {
+			err = options.validateRestoredDataDirectory(pgBackup, resolvedDataDirectory)
+		}
+		if err == nil {
+			err = options.writeProvenance(pgBackup.Name, resolvedDataDirectory)
+		}
+		if err == nil {
+			err = RunRestorePostHook(resolvedDataDirectory, options.UnsyncedDataLimiter)
+		}
+		err = options.finishCompletionMarker(pgBackup, resolvedDataDirectory, fileMask, err)
+		finishCleanup(cleanup, stopWatching, err)
+		plugin.OnRestoreFinish(RestoreFinishInfo{BackupName: pgBackup.Name, DBDataDirectory: resolvedDataDirectory, Err: err})
+		options.finishMirror(err)
+		options.reportExcludedParts()
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
 	}
 }
@@ -57,7 +79,7 @@ func deltaFetchRecursionNew(cfg *FetchConfig) error {
 			return err
 		}
 		unwrapResult, err := backup.unwrapNew(cfg.dbDataDirectory, sentinelDto, filesMetaDto, cfg.filesToUnwrap,
-			false, cfg.skipRedundantTars)
+			false, cfg.skipRedundantTars, cfg.interpreterOptions...)
 		if err != nil {
 			return err
 		}
@@ -80,6 +102,6 @@ func deltaFetchRecursionNew(cfg *FetchConfig) error {
 
 	tracelog.InfoLogger.Printf("%x reached. Applying base backup... \n", *(sentinelDto.BackupStartLSN))
 	_, err = backup.unwrapNew(cfg.dbDataDirectory, sentinelDto, filesMetaDto, cfg.filesToUnwrap,
-		false, cfg.skipRedundantTars)
+		false, cfg.skipRedundantTars, cfg.interpreterOptions...)
 	return err
 }
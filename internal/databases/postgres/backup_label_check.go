@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+const (
+	backupLabelStartWalLocation = "START WAL LOCATION"
+	backupLabelCheckpoint       = "CHECKPOINT LOCATION"
+)
+
+// BackupLabel contains the backup_label values cross-checked with the sentinel
+type BackupLabel struct {
+	StartLSN      uint64
+	CheckpointLSN uint64
+	// StartWalFile is the name of the WAL segment containing the start LSN
+	StartWalFile string
+}
+
+type BackupLabelMismatchError struct {
+	error
+}
+
+func newBackupLabelMismatchError(inconsistencies []string) BackupLabelMismatchError {
+	return BackupLabelMismatchError{errors.Errorf("restored backup_label does not match the backup sentinel, "+
+		"the backup may be corrupted or incorrectly assembled: %s", strings.Join(inconsistencies, "; "))}
+}
+
+func (err BackupLabelMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// ParseBackupLabel parses the start WAL location and the checkpoint location of the backup_label contents, e.g.
+// START WAL LOCATION: 0/2000028 (file 000000010000000000000002)
+// CHECKPOINT LOCATION: 0/2000060
+func ParseBackupLabel(content []byte) (BackupLabel, error) {
+	var label BackupLabel
+	var hasStart, hasCheckpoint bool
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, found := cutString(scanner.Text(), ": ")
+		if !found {
+			continue
+		}
+		switch key {
+		case backupLabelStartWalLocation:
+			var lsn, walFile string
+			_, err := fmt.Sscanf(value, "%s (file %24s)", &lsn, &walFile)
+			if err != nil {
+				return BackupLabel{}, errors.Errorf("invalid %s '%s'", backupLabelStartWalLocation, value)
+			}
+			label.StartLSN, err = parseBackupLabelLSN(lsn)
+			if err != nil {
+				return BackupLabel{}, err
+			}
+			label.StartWalFile = walFile
+			hasStart = true
+		case backupLabelCheckpoint:
+			var err error
+			label.CheckpointLSN, err = parseBackupLabelLSN(value)
+			if err != nil {
+				return BackupLabel{}, err
+			}
+			hasCheckpoint = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return BackupLabel{}, err
+	}
+	if !hasStart || !hasCheckpoint {
+		return BackupLabel{}, errors.Errorf("backup_label does not contain %s and %s",
+			backupLabelStartWalLocation, backupLabelCheckpoint)
+	}
+	return label, nil
+}
+
+func cutString(value, separator string) (before, after string, found bool) {
+	if i := strings.Index(value, separator); i >= 0 {
+		return value[:i], value[i+len(separator):], true
+	}
+	return value, "", false
+}
+
+func parseBackupLabelLSN(value string) (uint64, error) {
+	lsn, err := pglogrepl.ParseLSN(strings.TrimSpace(value))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid LSN '%s' in backup_label", value)
+	}
+	return uint64(lsn), nil
+}
+
+// findInconsistencies returns the descriptions of the label values contradicting the sentinel
+func (label BackupLabel) findInconsistencies(sentinelDto BackupSentinelDto) []string {
+	inconsistencies := make([]string, 0)
+	if sentinelDto.BackupStartLSN != nil {
+		startLSN := *sentinelDto.BackupStartLSN
+		if label.StartLSN != startLSN {
+			inconsistencies = append(inconsistencies, fmt.Sprintf("start LSN is %s, but the sentinel records %s",
+				formatLSN(label.StartLSN), formatLSN(startLSN)))
+		}
+		if label.CheckpointLSN < startLSN {
+			inconsistencies = append(inconsistencies, fmt.Sprintf("checkpoint LSN %s precedes the start LSN %s",
+				formatLSN(label.CheckpointLSN), formatLSN(startLSN)))
+		}
+	}
+	if sentinelDto.BackupFinishLSN != nil && label.CheckpointLSN > *sentinelDto.BackupFinishLSN {
+		inconsistencies = append(inconsistencies, fmt.Sprintf("checkpoint LSN %s follows the finish LSN %s",
+			formatLSN(label.CheckpointLSN), formatLSN(*sentinelDto.BackupFinishLSN)))
+	}
+	_, segmentNo, err := ParseWALFilename(label.StartWalFile)
+	if err != nil {
+		inconsistencies = append(inconsistencies, fmt.Sprintf("invalid start WAL file '%s'", label.StartWalFile))
+	} else if segmentNo != getSegmentNoFromLsn(label.StartLSN) {
+		inconsistencies = append(inconsistencies, fmt.Sprintf("start WAL file %s does not contain the start LSN %s",
+			label.StartWalFile, formatLSN(label.StartLSN)))
+	}
+	return inconsistencies
+}
+
+// CheckBackupLabel cross-checks the restored backup_label with the LSNs recorded in the sentinel.
+// The mismatch is logged as the error, it fails the check only if strict is set.
+// The check is skipped if backup_label was not restored, e.g. because of the file mask.
+func CheckBackupLabel(dbDataDirectory string, sentinelDto BackupSentinelDto, strict bool) error {
+	content, err := os.ReadFile(filepath.Join(dbDataDirectory, BackupLabelFilename))
+	if os.IsNotExist(err) {
+		tracelog.InfoLogger.Printf("%s is not restored, its consistency check is skipped\n", BackupLabelFilename)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", BackupLabelFilename)
+	}
+	var inconsistencies []string
+	label, err := ParseBackupLabel(content)
+	if err != nil {
+		inconsistencies = []string{err.Error()}
+	} else {
+		inconsistencies = label.findInconsistencies(sentinelDto)
+	}
+	if len(inconsistencies) == 0 {
+		tracelog.DebugLogger.Printf("%s is consistent with the backup sentinel\n", BackupLabelFilename)
+		return nil
+	}
+	mismatchErr := newBackupLabelMismatchError(inconsistencies)
+	if strict {
+		return mismatchErr
+	}
+	tracelog.ErrorLogger.Printf("WARNING: %v\n", mismatchErr)
+	return nil
+}
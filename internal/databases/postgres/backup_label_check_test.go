@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBackupLabel = "START WAL LOCATION: 0/2000028 (file 000000010000000000000002)\n" +
+	"CHECKPOINT LOCATION: 0/2000060\n" +
+	"BACKUP METHOD: streamed\n" +
+	"BACKUP FROM: primary\n" +
+	"START TIME: 2022-03-01 10:00:00 UTC\n" +
+	"LABEL: 2022-03-01 10:00:00.000000 +0000 UTC\n" +
+	"START TIMELINE: 1\n"
+
+func newBackupLabelTestSentinel(startLSN, finishLSN uint64) BackupSentinelDto {
+	return BackupSentinelDto{BackupStartLSN: &startLSN, BackupFinishLSN: &finishLSN}
+}
+
+func TestParseBackupLabel(t *testing.T) {
+	label, err := ParseBackupLabel([]byte(testBackupLabel))
+
+	require.NoError(t, err)
+	assert.Equal(t, BackupLabel{StartLSN: 0x2000028, CheckpointLSN: 0x2000060,
+		StartWalFile: "000000010000000000000002"}, label)
+}
+
+func TestParseBackupLabel_Incomplete(t *testing.T) {
+	_, err := ParseBackupLabel([]byte("CHECKPOINT LOCATION: 0/2000060\n"))
+
+	assert.Error(t, err)
+}
+
+func TestBackupLabel_FindInconsistencies(t *testing.T) {
+	label, err := ParseBackupLabel([]byte(testBackupLabel))
+	require.NoError(t, err)
+
+	assert.Empty(t, label.findInconsistencies(newBackupLabelTestSentinel(0x2000028, 0x2000138)))
+	assert.Len(t, label.findInconsistencies(newBackupLabelTestSentinel(0x3000028, 0x3000138)), 2)
+	// the checkpoint can't follow the end of the backup
+	assert.Len(t, label.findInconsistencies(newBackupLabelTestSentinel(0x2000028, 0x2000030)), 1)
+
+	label.StartWalFile = "000000010000000000000003"
+	assert.Len(t, label.findInconsistencies(newBackupLabelTestSentinel(0x2000028, 0x2000138)), 1)
+}
+
+func TestCheckBackupLabel(t *testing.T) {
+	dataDir := t.TempDir()
+	sentinel := newBackupLabelTestSentinel(0x3000028, 0x3000138)
+
+	// nothing to check
+	assert.NoError(t, CheckBackupLabel(dataDir, sentinel, true))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, BackupLabelFilename), []byte(testBackupLabel), 0600))
+	assert.NoError(t, CheckBackupLabel(dataDir, sentinel, false))
+	err := CheckBackupLabel(dataDir, sentinel, true)
+	assert.IsType(t, BackupLabelMismatchError{}, err)
+}
@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// BackupLSNSelector selects the most recent backup which finish LSN is at or before the target LSN,
+// i.e. the base backup to recover to the target LSN from. The backup has to be taken on the target
+// timeline or on its parent timeline before the target timeline branched off of it.
+type BackupLSNSelector struct {
+	targetLSN      uint64
+	targetTimeline uint32
+}
+
+var _ internal.BackupSelector = BackupLSNSelector{}
+
+// NewBackupLSNSelector creates the selector of the backup to recover to the target LSN, e.g. 0/16B3740.
+// The zero target timeline is the latest timeline of the backups in storage.
+func NewBackupLSNSelector(targetLSN string, targetTimeline uint32) (BackupLSNSelector, error) {
+	lsn, err := pgx.ParseLSN(targetLSN)
+	if err != nil {
+		return BackupLSNSelector{}, errors.Wrapf(err, "invalid target LSN '%s'", targetLSN)
+	}
+	return BackupLSNSelector{targetLSN: lsn, targetTimeline: targetTimeline}, nil
+}
+
+func (s BackupLSNSelector) Select(folder storage.Folder) (string, error) {
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	backupTimes, err := internal.GetBackups(baseBackupFolder)
+	if err != nil {
+		return "", err
+	}
+
+	backupTimelines := make(map[string]uint32, len(backupTimes))
+	targetTimeline := s.targetTimeline
+	for _, backupTime := range backupTimes {
+		timeline, err := ParseTimelineFromBackupName(backupTime.BackupName)
+		if err != nil {
+			tracelog.WarningLogger.Printf("Failed to parse the timeline of backup '%s', skipping it: %v\n",
+				backupTime.BackupName, err)
+			continue
+		}
+		backupTimelines[backupTime.BackupName] = timeline
+		if s.targetTimeline == 0 && timeline > targetTimeline {
+			targetTimeline = timeline
+		}
+	}
+	timelineEnds, err := getParentTimelineEnds(targetTimeline, folder.GetSubFolder(utility.WalPath))
+	if err != nil {
+		return "", err
+	}
+
+	selectedName, selectedLSN := "", uint64(0)
+	for _, backupTime := range backupTimes {
+		timeline, ok := backupTimelines[backupTime.BackupName]
+		if !ok {
+			continue
+		}
+		maxFinishLSN := s.targetLSN
+		if timeline != targetTimeline {
+			// the backup of the parent timeline is usable only if it is finished before the switch
+			timelineEnd, isParent := timelineEnds[timeline]
+			if !isParent {
+				continue
+			}
+			if timelineEnd < maxFinishLSN {
+				maxFinishLSN = timelineEnd
+			}
+		}
+		backup := NewBackup(baseBackupFolder, backupTime.BackupName)
+		sentinel, err := backup.GetSentinel()
+		if err != nil {
+			tracelog.WarningLogger.Printf("Failed to fetch the sentinel of backup '%s', skipping it: %v\n",
+				backupTime.BackupName, err)
+			continue
+		}
+		if sentinel.BackupFinishLSN == nil {
+			tracelog.WarningLogger.Printf("Backup '%s' has no finish LSN, skipping it\n", backupTime.BackupName)
+			continue
+		}
+		finishLSN := *sentinel.BackupFinishLSN
+		if finishLSN <= maxFinishLSN && (selectedName == "" || finishLSN > selectedLSN) {
+			selectedName, selectedLSN = backupTime.BackupName, finishLSN
+		}
+	}
+	if selectedName == "" {
+		return "", errors.Errorf("no backups found finished at or before LSN %s on timeline %d",
+			formatLSN(s.targetLSN), targetTimeline)
+	}
+	tracelog.InfoLogger.Printf("Selected backup '%s' finished at LSN %s\n", selectedName, formatLSN(selectedLSN))
+	return selectedName, nil
+}
+
+// getParentTimelineEnds returns the LSNs the parent timelines of the timeline were switched from at,
+// by the timeline history file in storage
+func getParentTimelineEnds(timeline uint32, walFolder storage.Folder) (map[uint32]uint64, error) {
+	timelineEnds := make(map[uint32]uint64)
+	if timeline <= 1 {
+		return timelineEnds, nil
+	}
+	historyRecords, err := getTimeLineHistoryRecords(timeline, walFolder)
+	if _, ok := err.(HistoryFileNotFoundError); ok {
+		tracelog.WarningLogger.Printf("The history of timeline %d is not found, only its backups are considered\n", timeline)
+		return timelineEnds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range historyRecords {
+		timelineEnds[record.timeline] = record.lsn
+	}
+	return timelineEnds, nil
+}
@@ -0,0 +1,107 @@
+package postgres_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	lsnSelectorOldBackup      = "base_000000010000000000000002"
+	lsnSelectorNewBackup      = "base_000000010000000000000006"
+	lsnSelectorTimelineBackup = "base_000000020000000000000008"
+	// timeline 2 branched off of timeline 1 between the finish LSNs of its backups
+	lsnSelectorSwitchLSN = 0x5000080
+)
+
+func putLSNSelectorTestSentinel(t *testing.T, folder storage.Folder, backupName string, startLSN, finishLSN uint64) {
+	sentinel := makeTestSentinel(startLSN, "", "", 0)
+	sentinel.BackupFinishLSN = &finishLSN
+	putTestSentinel(t, folder, backupName, sentinel)
+}
+
+func createLSNSelectorTestFolder(t *testing.T, withHistory bool) storage.Folder {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putLSNSelectorTestSentinel(t, folder, lsnSelectorOldBackup, 0x2000028, 0x3000100)
+	putLSNSelectorTestSentinel(t, folder, lsnSelectorNewBackup, 0x6000028, 0x7000100)
+	putLSNSelectorTestSentinel(t, folder, lsnSelectorTimelineBackup, 0x8000028, 0x9000100)
+	if withHistory {
+		historyContents := fmt.Sprintf("%d\t0/%X\tno recovery target specified\n", 1, lsnSelectorSwitchLSN)
+		historyName, historyFile, err := newTimelineHistoryFile(historyContents, 2)
+		require.NoError(t, err)
+		require.NoError(t, folder.GetSubFolder(utility.WalPath).PutObject(historyName, historyFile))
+	}
+	return folder
+}
+
+func selectBackupByLSN(t *testing.T, folder storage.Folder, targetLSN string, targetTimeline uint32) (string, error) {
+	selector, err := postgres.NewBackupLSNSelector(targetLSN, targetTimeline)
+	require.NoError(t, err)
+	return selector.Select(folder)
+}
+
+func TestBackupLSNSelector_SelectsLatestFinishedBeforeTarget(t *testing.T) {
+	folder := createLSNSelectorTestFolder(t, true)
+
+	backupName, err := selectBackupByLSN(t, folder, "0/A000000", 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, lsnSelectorTimelineBackup, backupName)
+}
+
+func TestBackupLSNSelector_SelectsBackupFinishedAtTarget(t *testing.T) {
+	folder := createLSNSelectorTestFolder(t, true)
+
+	backupName, err := selectBackupByLSN(t, folder, "0/9000100", 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, lsnSelectorTimelineBackup, backupName)
+}
+
+func TestBackupLSNSelector_SkipsParentTimelineBackupsAfterSwitch(t *testing.T) {
+	// the newer backup of timeline 1 is finished after timeline 2 branched off, so it is not its base
+	folder := createLSNSelectorTestFolder(t, true)
+
+	backupName, err := selectBackupByLSN(t, folder, "0/8000000", 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, lsnSelectorOldBackup, backupName)
+}
+
+func TestBackupLSNSelector_SelectsByTargetTimeline(t *testing.T) {
+	folder := createLSNSelectorTestFolder(t, true)
+
+	backupName, err := selectBackupByLSN(t, folder, "0/A000000", 1)
+
+	require.NoError(t, err)
+	assert.Equal(t, lsnSelectorNewBackup, backupName)
+}
+
+func TestBackupLSNSelector_NoHistory(t *testing.T) {
+	// without the history of timeline 2 its parent timeline backups can't be used
+	folder := createLSNSelectorTestFolder(t, false)
+
+	_, err := selectBackupByLSN(t, folder, "0/8000000", 0)
+
+	assert.Error(t, err)
+}
+
+func TestBackupLSNSelector_NoBackupBeforeTarget(t *testing.T) {
+	folder := createLSNSelectorTestFolder(t, true)
+
+	_, err := selectBackupByLSN(t, folder, "0/3000000", 0)
+
+	assert.Error(t, err)
+}
+
+func TestNewBackupLSNSelector_InvalidLSN(t *testing.T) {
+	_, err := postgres.NewBackupLSNSelector("16B3740", 0)
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,295 @@
+package postgres
+
+import (
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// defaultMirrorBufferChunks is the number of read chunks which may wait for the mirror upload
+const defaultMirrorBufferChunks = 256
+
+var errMirrorTooSlow = errors.New("mirror upload is slower than the restore, the buffer is full")
+
+// MirroredBackupStatus describes the result of mirroring the single restored backup
+type MirroredBackupStatus struct {
+	BackupName string
+	// TeedParts is the number of tar parts mirrored while being restored
+	TeedParts int
+	// CopiedParts is the number of tar parts which were not read or failed to be mirrored
+	// while being restored, so they were copied to the mirror after the restore
+	CopiedParts int
+	Err         error
+}
+
+// BackupMirror uploads the tar parts of the restored backups to the second storage
+// while they are read by the restore. The mirror never slows the restore down:
+// if the upload can not keep up, the part is abandoned and copied after the restore.
+// Backup sentinels are uploaded only after all the parts are mirrored, the sentinel of the delta backup
+// only if its base backup is in the mirror too.
+type BackupMirror struct {
+	folder       storage.Folder
+	bufferChunks int
+
+	pendingUploads sync.WaitGroup
+
+	mutex   sync.Mutex
+	backups map[string]Backup
+	// partErrors contains the teeing results of the tar parts by their paths relative to the root folder
+	partErrors map[string]error
+}
+
+func NewBackupMirror(folder storage.Folder) *BackupMirror {
+	return &BackupMirror{
+		folder:       folder,
+		bufferChunks: defaultMirrorBufferChunks,
+		backups:      make(map[string]Backup),
+		partErrors:   make(map[string]error),
+	}
+}
+
+// wrapReaderMaker makes the tar part of the backup be mirrored while it is read
+func (mirror *BackupMirror) wrapReaderMaker(backup Backup, tarName string,
+	readerMaker internal.ReaderMaker) internal.ReaderMaker {
+	mirror.mutex.Lock()
+	mirror.backups[backup.Name] = backup
+	mirror.mutex.Unlock()
+	return &mirroringReaderMaker{ReaderMaker: readerMaker, mirror: mirror, objectPath: getMirrorPartPath(backup, tarName)}
+}
+
+func (mirror *BackupMirror) setPartResult(objectPath string, err error) {
+	mirror.mutex.Lock()
+	defer mirror.mutex.Unlock()
+	mirror.partErrors[objectPath] = err
+}
+
+func getMirrorPartPath(backup Backup, tarName string) string {
+	return utility.BaseBackupPath + backup.Name + internal.TarPartitionFolderName + tarName
+}
+
+// Finish copies the parts which were not mirrored during the restore, uploads the sentinels
+// of the completely mirrored backups and reports the mirroring results
+func (mirror *BackupMirror) Finish() []MirroredBackupStatus {
+	mirror.pendingUploads.Wait()
+	mirror.mutex.Lock()
+	defer mirror.mutex.Unlock()
+	backupNames := make([]string, 0, len(mirror.backups))
+	for name := range mirror.backups {
+		backupNames = append(backupNames, name)
+	}
+	sort.Strings(backupNames)
+
+	finished := make(map[string]MirroredBackupStatus, len(backupNames))
+	statuses := make([]MirroredBackupStatus, 0, len(backupNames))
+	for _, name := range backupNames {
+		statuses = append(statuses, mirror.finishBackupOnce(name, finished))
+	}
+	return statuses
+}
+
+// finishBackupOnce finishes the restored backup after its base backup, if it is restored too
+func (mirror *BackupMirror) finishBackupOnce(name string, finished map[string]MirroredBackupStatus) MirroredBackupStatus {
+	if status, ok := finished[name]; ok {
+		return status
+	}
+	status := mirror.finishBackup(mirror.backups[name], finished)
+	if status.Err != nil {
+		tracelog.WarningLogger.Printf("Mirror: failed to mirror backup '%s': %v\n", name, status.Err)
+	} else {
+		tracelog.InfoLogger.Printf("Mirror: backup '%s' is mirrored, %d parts teed during the restore, %d copied\n",
+			name, status.TeedParts, status.CopiedParts)
+	}
+	finished[name] = status
+	return status
+}
+
+// checkBaseMirrored checks the base backup of the delta backup is mirrored by this restore or is in the mirror
+func (mirror *BackupMirror) checkBaseMirrored(backup Backup, finished map[string]MirroredBackupStatus) error {
+	sentinel, err := backup.GetSentinel()
+	if err != nil {
+		return err
+	}
+	if !sentinel.IsIncremental() {
+		return nil
+	}
+	baseName := *sentinel.IncrementFrom
+	if _, ok := mirror.backups[baseName]; ok {
+		if baseStatus := mirror.finishBackupOnce(baseName, finished); baseStatus.Err != nil {
+			return errors.Errorf("the base backup '%s' is not mirrored", baseName)
+		}
+		return nil
+	}
+	exists, err := mirror.folder.Exists(utility.BaseBackupPath + baseName + utility.SentinelSuffix)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Errorf("the base backup '%s' is not in the mirror", baseName)
+	}
+	return nil
+}
+
+func (mirror *BackupMirror) finishBackup(backup Backup, finished map[string]MirroredBackupStatus) MirroredBackupStatus {
+	status := MirroredBackupStatus{BackupName: backup.Name}
+	// the delta backup can't be restored from the mirror without its base
+	if err := mirror.checkBaseMirrored(backup, finished); err != nil {
+		status.Err = err
+		return status
+	}
+	tarNames, err := backup.GetTarNames()
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	for _, tarName := range tarNames {
+		objectPath := getMirrorPartPath(backup, tarName)
+		teeErr, teed := mirror.partErrors[objectPath]
+		if teed && teeErr == nil {
+			status.TeedParts++
+			continue
+		}
+		if teed {
+			tracelog.WarningLogger.Printf("Mirror: failed to tee '%s', copying it: %v\n", objectPath, teeErr)
+		}
+		err = copyObject(backup.getTarPartitionFolder(), tarName, mirror.folder, objectPath)
+		if err != nil {
+			status.Err = err
+			return status
+		}
+		status.CopiedParts++
+	}
+
+	// the sentinel goes last, so the mirrored backup becomes visible only when complete
+	backupObjects, _, err := backup.Folder.GetSubFolder(backup.Name).ListFolder()
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	for _, object := range backupObjects {
+		err = copyObject(backup.Folder.GetSubFolder(backup.Name), object.GetName(),
+			mirror.folder, utility.BaseBackupPath+backup.Name+"/"+object.GetName())
+		if err != nil {
+			status.Err = err
+			return status
+		}
+	}
+	sentinelName := backup.Name + utility.SentinelSuffix
+	status.Err = copyObject(backup.Folder, sentinelName, mirror.folder, utility.BaseBackupPath+sentinelName)
+	return status
+}
+
+func copyObject(from storage.Folder, fromPath string, to storage.Folder, toPath string) error {
+	reader, err := from.ReadObject(fromPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read '%s'", fromPath)
+	}
+	defer utility.LoggedClose(reader, "")
+	return errors.Wrapf(to.PutObject(toPath, reader), "failed to upload '%s' to the mirror", toPath)
+}
+
+type mirroringReaderMaker struct {
+	internal.ReaderMaker
+	mirror     *BackupMirror
+	objectPath string
+}
+
+func (readerMaker *mirroringReaderMaker) Reader() (io.ReadCloser, error) {
+	reader, err := readerMaker.ReaderMaker.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return newMirroringReadCloser(reader, readerMaker.mirror, readerMaker.objectPath), nil
+}
+
+// mirroringReadCloser passes the read data to the background mirror upload without blocking
+type mirroringReadCloser struct {
+	io.ReadCloser
+	mirror     *BackupMirror
+	objectPath string
+	reachedEOF bool
+
+	chunks       chan []byte
+	pipeWriter   *io.PipeWriter
+	uploadResult chan error
+	teeErr       error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newMirroringReadCloser(reader io.ReadCloser, mirror *BackupMirror, objectPath string) *mirroringReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	readCloser := &mirroringReadCloser{
+		ReadCloser:   reader,
+		mirror:       mirror,
+		objectPath:   objectPath,
+		chunks:       make(chan []byte, mirror.bufferChunks),
+		pipeWriter:   pipeWriter,
+		uploadResult: make(chan error, 1),
+	}
+	mirror.pendingUploads.Add(1)
+	go func() {
+		err := mirror.folder.PutObject(objectPath, pipeReader)
+		// unblock the pending writes if the upload has stopped reading
+		_ = pipeReader.CloseWithError(io.ErrClosedPipe)
+		readCloser.uploadResult <- err
+	}()
+	go func() {
+		for chunk := range readCloser.chunks {
+			_, _ = pipeWriter.Write(chunk)
+		}
+		_ = pipeWriter.Close()
+	}()
+	return readCloser
+}
+
+func (readCloser *mirroringReadCloser) Read(p []byte) (int, error) {
+	n, err := readCloser.ReadCloser.Read(p)
+	if n > 0 && readCloser.teeErr == nil {
+		chunk := make([]byte, n)
+		copy(chunk, p[:n])
+		select {
+		case readCloser.chunks <- chunk:
+		default:
+			readCloser.teeErr = errMirrorTooSlow
+			_ = readCloser.pipeWriter.CloseWithError(errMirrorTooSlow)
+		}
+	}
+	if err == io.EOF {
+		readCloser.reachedEOF = true
+	}
+	return n, err
+}
+
+// Close lets the mirror upload complete in background.
+// The part is mirrored only if the restore has read it completely. The repeated Close does nothing.
+func (readCloser *mirroringReadCloser) Close() error {
+	readCloser.closeOnce.Do(func() {
+		readCloser.closeErr = readCloser.close()
+	})
+	return readCloser.closeErr
+}
+
+func (readCloser *mirroringReadCloser) close() error {
+	if !readCloser.reachedEOF && readCloser.teeErr == nil {
+		readCloser.teeErr = errors.New("the part was not read completely")
+		_ = readCloser.pipeWriter.CloseWithError(readCloser.teeErr)
+	}
+	close(readCloser.chunks)
+	teeErr := readCloser.teeErr
+	go func() {
+		defer readCloser.mirror.pendingUploads.Done()
+		uploadErr := <-readCloser.uploadResult
+		if teeErr != nil {
+			uploadErr = teeErr
+		}
+		readCloser.mirror.setPartResult(readCloser.objectPath, uploadErr)
+	}()
+	return readCloser.ReadCloser.Close()
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const testMirrorBackupName = "base_000000010000000000000002"
+
+type blockingPutFolder struct {
+	storage.Folder
+	release chan struct{}
+}
+
+func (folder *blockingPutFolder) PutObject(name string, content io.Reader) error {
+	<-folder.release
+	return folder.Folder.PutObject(name, content)
+}
+
+func newTestMirrorSource(t *testing.T) Backup {
+	rootFolder := memory.NewFolder("", memory.NewStorage())
+	baseBackupFolder := rootFolder.GetSubFolder(utility.BaseBackupPath)
+	require.NoError(t, baseBackupFolder.PutObject(testMirrorBackupName+utility.SentinelSuffix, strings.NewReader("{}")))
+	require.NoError(t, baseBackupFolder.PutObject(testMirrorBackupName+"/"+utility.MetadataFileName, strings.NewReader("{}")))
+	tarFolder := baseBackupFolder.GetSubFolder(testMirrorBackupName + internal.TarPartitionFolderName)
+	require.NoError(t, tarFolder.PutObject("part_1.tar.lz4", strings.NewReader("first part")))
+	require.NoError(t, tarFolder.PutObject("part_2.tar.lz4", strings.NewReader("second part")))
+	return NewBackup(baseBackupFolder, testMirrorBackupName)
+}
+
+func readMirrored(t *testing.T, mirror *BackupMirror, backup Backup, tarName string, chunkSize int) {
+	readerMaker := mirror.wrapReaderMaker(backup, tarName, internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), tarName))
+	reader, err := readerMaker.Reader()
+	require.NoError(t, err)
+	buffer := make([]byte, chunkSize)
+	for {
+		_, err = reader.Read(buffer)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	require.NoError(t, reader.Close())
+}
+
+func readMirrorObject(t *testing.T, folder storage.Folder, objectPath string) string {
+	reader, err := folder.ReadObject(objectPath)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestBackupMirror_TeesReadPartsAndCopiesTheRest(t *testing.T) {
+	backup := newTestMirrorSource(t)
+	mirrorFolder := memory.NewFolder("", memory.NewStorage())
+	mirror := NewBackupMirror(mirrorFolder)
+
+	readMirrored(t, mirror, backup, "part_1.tar.lz4", 4)
+	statuses := mirror.Finish()
+
+	assert.Equal(t, []MirroredBackupStatus{{BackupName: testMirrorBackupName, TeedParts: 1, CopiedParts: 1}}, statuses)
+	tarPath := utility.BaseBackupPath + testMirrorBackupName + internal.TarPartitionFolderName
+	assert.Equal(t, "first part", readMirrorObject(t, mirrorFolder, tarPath+"part_1.tar.lz4"))
+	assert.Equal(t, "second part", readMirrorObject(t, mirrorFolder, tarPath+"part_2.tar.lz4"))
+	assert.Equal(t, "{}", readMirrorObject(t, mirrorFolder,
+		utility.BaseBackupPath+testMirrorBackupName+"/"+utility.MetadataFileName))
+	assert.Equal(t, "{}", readMirrorObject(t, mirrorFolder,
+		utility.BaseBackupPath+testMirrorBackupName+utility.SentinelSuffix))
+}
+
+func TestBackupMirror_SlowMirrorDoesNotBlockRestore(t *testing.T) {
+	backup := newTestMirrorSource(t)
+	mirrorFolder := memory.NewFolder("", memory.NewStorage())
+	slowFolder := &blockingPutFolder{Folder: mirrorFolder, release: make(chan struct{})}
+	mirror := NewBackupMirror(slowFolder)
+	mirror.bufferChunks = 1
+
+	// the mirror upload is blocked, so the read must overflow the buffer instead of waiting
+	readMirrored(t, mirror, backup, "part_1.tar.lz4", 1)
+	close(slowFolder.release)
+	statuses := mirror.Finish()
+
+	assert.Equal(t, []MirroredBackupStatus{{BackupName: testMirrorBackupName, CopiedParts: 2}}, statuses)
+	tarPath := utility.BaseBackupPath + testMirrorBackupName + internal.TarPartitionFolderName
+	assert.Equal(t, "first part", readMirrorObject(t, mirrorFolder, tarPath+"part_1.tar.lz4"))
+}
+
+func TestBackupMirror_IncompleteReadIsNotTeed(t *testing.T) {
+	backup := newTestMirrorSource(t)
+	mirrorFolder := memory.NewFolder("", memory.NewStorage())
+	mirror := NewBackupMirror(mirrorFolder)
+
+	readerMaker := mirror.wrapReaderMaker(backup, "part_1.tar.lz4",
+		internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), "part_1.tar.lz4"))
+	reader, err := readerMaker.Reader()
+	require.NoError(t, err)
+	_, err = reader.Read(make([]byte, 2))
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	statuses := mirror.Finish()
+
+	assert.Equal(t, 0, statuses[0].TeedParts)
+	tarPath := utility.BaseBackupPath + testMirrorBackupName + internal.TarPartitionFolderName
+	assert.Equal(t, "first part", readMirrorObject(t, mirrorFolder, tarPath+"part_1.tar.lz4"))
+}
+
+func TestBackupMirror_RepeatedClose(t *testing.T) {
+	backup := newTestMirrorSource(t)
+	mirror := NewBackupMirror(memory.NewFolder("", memory.NewStorage()))
+	readerMaker := mirror.wrapReaderMaker(backup, "part_1.tar.lz4",
+		internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), "part_1.tar.lz4"))
+	reader, err := readerMaker.Reader()
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+
+	require.NoError(t, reader.Close())
+	assert.NotPanics(t, func() { _ = reader.Close() })
+	assert.Equal(t, 1, mirror.Finish()[0].TeedParts)
+}
+
+const testMirrorDeltaName = "base_000000010000000000000004_D_000000010000000000000002"
+
+func putTestMirrorDelta(t *testing.T, base Backup) Backup {
+	require.NoError(t, base.Folder.PutObject(testMirrorDeltaName+utility.SentinelSuffix, strings.NewReader(
+		`{"LSN":67108904,"DeltaLSN":33554472,"DeltaFrom":"`+testMirrorBackupName+`","DeltaFullName":"`+testMirrorBackupName+`"}`)))
+	tarFolder := base.Folder.GetSubFolder(testMirrorDeltaName + internal.TarPartitionFolderName)
+	require.NoError(t, tarFolder.PutObject("part_1.tar.lz4", strings.NewReader("delta part")))
+	return NewBackup(base.Folder, testMirrorDeltaName)
+}
+
+func TestBackupMirror_DeltaWithoutMirroredBase(t *testing.T) {
+	delta := putTestMirrorDelta(t, newTestMirrorSource(t))
+	mirrorFolder := memory.NewFolder("", memory.NewStorage())
+	mirror := NewBackupMirror(mirrorFolder)
+
+	readMirrored(t, mirror, delta, "part_1.tar.lz4", 4)
+	statuses := mirror.Finish()
+
+	require.Len(t, statuses, 1)
+	assert.Error(t, statuses[0].Err)
+	exists, err := mirrorFolder.Exists(utility.BaseBackupPath + testMirrorDeltaName + utility.SentinelSuffix)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestBackupMirror_DeltaWithMirroredBase(t *testing.T) {
+	base := newTestMirrorSource(t)
+	delta := putTestMirrorDelta(t, base)
+	mirrorFolder := memory.NewFolder("", memory.NewStorage())
+	mirror := NewBackupMirror(mirrorFolder)
+
+	readMirrored(t, mirror, delta, "part_1.tar.lz4", 4)
+	readMirrored(t, mirror, base, "part_1.tar.lz4", 4)
+	statuses := mirror.Finish()
+
+	require.Len(t, statuses, 2)
+	for _, status := range statuses {
+		assert.NoError(t, status.Err, status.BackupName)
+	}
+	for _, name := range []string{testMirrorBackupName, testMirrorDeltaName} {
+		exists, err := mirrorFolder.Exists(utility.BaseBackupPath + name + utility.SentinelSuffix)
+		require.NoError(t, err)
+		assert.True(t, exists, name)
+	}
+}
@@ -15,7 +15,9 @@ import (
 var useNewUnwrapImplementation = false
 
 // UnwrapResult stores information about
-// the result of single backup unwrap operation
+// the result of single backup unwrap operation.
+// Each field is guarded by its own mutex, the consistent snapshot
+// of all of them is taken by locking them in the order of the fields.
 type UnwrapResult struct {
 	// completely restored files
 	completedFiles      []string
@@ -28,15 +30,31 @@ type UnwrapResult struct {
 	// store count of written increment blocks
 	writtenIncrementFiles      map[string]int64
 	writtenIncrementFilesMutex sync.Mutex
+	// for each entry interpreted in the dry run
+	// store the action the restore would do with it
+	plannedActions      map[string]RestoreAction
+	plannedActionsMutex sync.Mutex
+	// the existing files which are not rewritten: the skipped ones, e.g. since they are newer,
+	// and the identical ones, which are restored already
+	skippedFiles      []string
+	identicalFiles    []string
+	skippedFilesMutex sync.Mutex
+	// the files failed to restore in the best-effort restore with their errors
+	failedFiles      map[string]string
+	failedFilesMutex sync.Mutex
 }
 
 func newUnwrapResult() *UnwrapResult {
 	return &UnwrapResult{make([]string, 0), sync.Mutex{},
 		make(map[string]int64), sync.Mutex{},
-		make(map[string]int64), sync.Mutex{}}
+		make(map[string]int64), sync.Mutex{},
+		make(map[string]RestoreAction), sync.Mutex{},
+		make([]string, 0), make([]string, 0), sync.Mutex{},
+		make(map[string]string), sync.Mutex{}}
 }
 
-func checkDBDirectoryForUnwrapNew(dbDataDirectory string, sentinelDto BackupSentinelDto, filesMetaDto FilesMetadataDto) error {
+func checkDBDirectoryForUnwrapNew(dbDataDirectory string, sentinelDto BackupSentinelDto, filesMetaDto FilesMetadataDto,
+	interpreterOptions ...FileTarInterpreterOption) error {
 	tracelog.DebugLogger.Println("DB data directory before applying backup:")
 	_ = filepath.Walk(dbDataDirectory,
 		func(path string, info os.FileInfo, err error) error {
@@ -56,7 +74,7 @@ func checkDBDirectoryForUnwrapNew(dbDataDirectory string, sentinelDto BackupSent
 	}
 
 	if sentinelDto.TablespaceSpec != nil && !sentinelDto.TablespaceSpec.empty() {
-		err := setTablespacePaths(*sentinelDto.TablespaceSpec)
+		err := setTablespacePathsWithCleanup(*sentinelDto.TablespaceSpec, restoreCleanupOf(interpreterOptions...))
 		if err != nil {
 			return err
 		}
@@ -69,18 +87,25 @@ func checkDBDirectoryForUnwrapNew(dbDataDirectory string, sentinelDto BackupSent
 // Do the job of unpacking Backup object
 func (backup *Backup) unwrapNew(
 	dbDataDirectory string, sentinelDto BackupSentinelDto, filesMetaDto FilesMetadataDto, filesToUnwrap map[string]bool,
-	createIncrementalFiles, skipRedundantTars bool) (*UnwrapResult, error) {
+	createIncrementalFiles, skipRedundantTars bool, interpreterOptions ...FileTarInterpreterOption) (*UnwrapResult, error) {
 	useNewUnwrapImplementation = true
-	err := checkDBDirectoryForUnwrapNew(dbDataDirectory, sentinelDto, filesMetaDto)
+	err := CheckFilesMetadata(backup.Name, sentinelDto, filesMetaDto)
+	if err != nil {
+		return nil, err
+	}
+	err = checkDBDirectoryForUnwrapNew(dbDataDirectory, sentinelDto, filesMetaDto, interpreterOptions...)
 	if err != nil {
 		return nil, err
 	}
 
-	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesMetaDto, filesToUnwrap, createIncrementalFiles)
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesMetaDto, filesToUnwrap,
+		createIncrementalFiles, interpreterOptions...)
+	tarInterpreter.backupName = backup.Name
 	tarsToExtract, pgControlKey, err := backup.getTarsToExtract(filesMetaDto, filesToUnwrap, skipRedundantTars)
 	if err != nil {
 		return nil, err
 	}
+	tarsToExtract = backup.mirrorTars(tarInterpreter, backup.allowTars(tarInterpreter, tarsToExtract))
 
 	// Check name for backwards compatibility. Will check for `pg_control` if WALG version of backup.
 	needPgControl := IsPgControlRequired(*backup, sentinelDto)
@@ -88,19 +113,30 @@ func (backup *Backup) unwrapNew(
 	if pgControlKey == "" && needPgControl {
 		return nil, newPgControlNotFoundError()
 	}
+	backup.readPgControlData(tarInterpreter, pgControlKey)
 
-	err = internal.ExtractAll(tarInterpreter, tarsToExtract)
+	err = extractTarsInStages(tarInterpreter, tarsToExtract)
 	if _, ok := err.(internal.NoFilesToExtractError); ok {
-		// in case of no tars to extract, just ignore this backup and proceed to the next
-		tracelog.InfoLogger.Println("Skipping backup: no useful files found.")
-		return tarInterpreter.UnwrapResult, nil
+		if !hasExternalObjects(filesMetaDto) {
+			// in case of no tars to extract, just ignore this backup and proceed to the next
+			tracelog.InfoLogger.Println("Skipping backup: no useful files found.")
+			tarInterpreter.reportUnwrapResult(backup.Name)
+			return tarInterpreter.UnwrapResult, nil
+		}
+		err = nil
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	if needPgControl {
-		readerMakers := []internal.ReaderMaker{internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)}
+	err = backup.resolveExternalObjects(tarInterpreter)
+	if err != nil {
+		return nil, err
+	}
+
+	if needPgControl && backup.allowTar(tarInterpreter, pgControlKey) {
+		readerMakers := []internal.ReaderMaker{backup.mirrorTar(tarInterpreter,
+			internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey))}
 		err = internal.ExtractAll(tarInterpreter, readerMakers)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to extract pg_control")
@@ -108,5 +144,6 @@ func (backup *Backup) unwrapNew(
 	}
 
 	tracelog.InfoLogger.Print("\nBackup extraction complete.\n")
+	tarInterpreter.reportUnwrapResult(backup.Name)
 	return tarInterpreter.UnwrapResult, nil
 }
@@ -6,6 +6,10 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/utility"
 )
 
 func createTempDir(prefix string) (name string, err error) {
@@ -87,3 +91,52 @@ func TestIsDirectoryEmpty_ReturnsTrue_WhenDirectoryDoesntExist(t *testing.T) {
 
 	assert.True(t, actual)
 }
+
+func TestSelectFilesToUnwrap_SkipsRelcacheInitFilesByDefault(t *testing.T) {
+	backup := makeRelcacheInitTestBackup()
+
+	filesToUnwrap, err := FetchOptions{}.selectFilesToUnwrap(backup, "")
+
+	assert.NoError(t, err)
+	assert.False(t, filesToUnwrap["/base/1/"+RelcacheInitFileName])
+	assert.True(t, filesToUnwrap["/base/1/1259"])
+}
+
+func TestSelectFilesToUnwrap_KeepsRelcacheInitFiles(t *testing.T) {
+	backup := makeRelcacheInitTestBackup()
+
+	filesToUnwrap, err := FetchOptions{KeepRelcacheInitFiles: true}.selectFilesToUnwrap(backup, "")
+
+	assert.NoError(t, err)
+	assert.True(t, filesToUnwrap["/base/1/"+RelcacheInitFileName])
+	assert.True(t, filesToUnwrap["/base/1/1259"])
+}
+
+func makeRelcacheInitTestBackup() Backup {
+	backup := NewBackup(memory.NewFolder("", memory.NewStorage()), "base_000000010000000000000002")
+	backup.SentinelDto = &BackupSentinelDto{}
+	backup.FilesMetadataDto = &FilesMetadataDto{Files: internal.BackupFileList{
+		"/base/1/1259":                    {},
+		"/base/1/" + RelcacheInitFileName: {},
+	}}
+	return backup
+}
+
+func TestFetchOnlyPrefix(t *testing.T) {
+	folder := putSyntheticTestChain(t)
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), diffTestDeltaBackup)
+	dbDataDirectory := t.TempDir()
+
+	filesToUnwrap, err := FetchOptions{OnlyPrefix: "base/1/1259"}.selectFilesToUnwrap(backup, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/base/1/1259": true}, filesToUnwrap)
+	require.NoError(t, deltaFetchRecursionOld(backup, folder, dbDataDirectory, nil, filesToUnwrap))
+
+	content, err := os.ReadFile(filepath.Join(dbDataDirectory, "base", "1", "1259"))
+	require.NoError(t, err)
+	assert.Equal(t, makeDiffTestPage('a')+makeDiffTestPage('B')+makeDiffTestPage('c'), string(content))
+	for _, name := range []string{"base/1/1260", "PG_VERSION", "global/pg_control"} {
+		_, err = os.Stat(filepath.Join(dbDataDirectory, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
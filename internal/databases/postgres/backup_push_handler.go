@@ -71,6 +71,7 @@ type CurBackupInfo struct {
 	uncompressedSize int64
 	compressedSize   int64
 	incrementCount   int
+	tarChecksums     map[string]internal.FileChecksum
 }
 
 // PrevBackupInfo holds all information that is harvest during the backup process
@@ -235,7 +236,8 @@ func (bh *BackupHandler) uploadBackup() TarFileSets {
 	bundle := bh.workers.bundle
 	// Start a new tar bundle, walk the pgDataDirectory and upload everything there.
 	tracelog.InfoLogger.Println("Starting a new tar bundle")
-	err := bundle.StartQueue(internal.NewStorageTarBallMaker(bh.curBackupInfo.name, bh.workers.uploader.Uploader))
+	tarBallMaker := internal.NewStorageTarBallMaker(bh.curBackupInfo.name, bh.workers.uploader.Uploader)
+	err := bundle.StartQueue(tarBallMaker)
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	tarBallComposerMaker, err := NewTarBallComposerMaker(bh.arguments.tarBallComposerType, bh.workers.conn,
@@ -285,6 +287,7 @@ func (bh *BackupHandler) uploadBackup() TarFileSets {
 	if bh.workers.uploader.Failed.Load().(bool) {
 		tracelog.ErrorLogger.Fatalf("Uploading failed during '%s' backup.\n", bh.curBackupInfo.name)
 	}
+	bh.curBackupInfo.tarChecksums = tarBallMaker.StreamChecksums()
 	if timelineChanged {
 		tracelog.ErrorLogger.Fatalf("Cannot finish backup because of changed timeline.")
 	}
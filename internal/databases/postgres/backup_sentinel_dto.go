@@ -32,6 +32,12 @@ type BackupSentinelDto struct {
 	UserData interface{} `json:"UserData,omitempty"`
 
 	FilesMetadataDisabled bool `json:"FilesMetadataDisabled,omitempty"`
+
+	// TarChecksums are the checksums of the decompressed streams of the backup tars by the tar names,
+	// verified by the fetch to detect the truncated tars. The pg_control and the backup_label tars are recorded
+	// and verified too, as they are made by the same tarball maker after the data tars. The tars read
+	// without the restore, e.g. by backup-stream, are not verified. They are not recorded by the older versions.
+	TarChecksums map[string]internal.FileChecksum `json:"TarChecksums,omitempty"`
 }
 
 func NewBackupSentinelDto(bh *BackupHandler, tbsSpec *TablespaceSpec) BackupSentinelDto {
@@ -57,6 +63,7 @@ func NewBackupSentinelDto(bh *BackupHandler, tbsSpec *TablespaceSpec) BackupSent
 	sentinel.UncompressedSize = bh.curBackupInfo.uncompressedSize
 	sentinel.CompressedSize = bh.curBackupInfo.compressedSize
 	sentinel.FilesMetadataDisabled = bh.arguments.withoutFilesMetadata
+	sentinel.TarChecksums = bh.curBackupInfo.tarChecksums
 	return sentinel
 }
 
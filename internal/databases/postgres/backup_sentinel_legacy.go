@@ -0,0 +1,205 @@
+package postgres
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+// The keys of the WAL-E backup stop sentinel
+const (
+	walEBackupStartSegment = "wal_segment_backup_start"
+	walEBackupStartOffset  = "wal_segment_offset_backup_start"
+	walEBackupStopSegment  = "wal_segment_backup_stop"
+	walEBackupStopOffset   = "wal_segment_offset_backup_stop"
+	walEExpandedSize       = "expanded_size_bytes"
+)
+
+// sentinelLSNFields are the LSN keys of the sentinel, the legacy sentinels may store them as strings
+var sentinelLSNFields = []string{"LSN", "DeltaLSN", "FinishLSN", "DeltaFromLSN"}
+
+// legacySentinelDto is the sentinel decoded from any supported schema
+type legacySentinelDto struct {
+	BackupSentinelDto
+	DeprecatedSentinelFields
+}
+
+// decodeBackupSentinel decodes the sentinel written by any WAL-G version or by WAL-E into the current schema.
+// It returns the decoded sentinel, the descriptions of the applied migrations and the fields unknown
+// to the current schema, which are kept as they are.
+func decodeBackupSentinel(rawSentinel map[string]json.RawMessage) (legacySentinelDto,
+	[]string, map[string]json.RawMessage, error) {
+	migrations := make([]string, 0)
+	migration, err := migrateWalESentinel(rawSentinel)
+	if err != nil {
+		return legacySentinelDto{}, nil, nil, err
+	}
+	if migration != "" {
+		migrations = append(migrations, migration)
+	}
+	for _, field := range sentinelLSNFields {
+		migrated, err := migrateStringLSN(rawSentinel, field)
+		if err != nil {
+			return legacySentinelDto{}, nil, nil, err
+		}
+		if migrated {
+			migrations = append(migrations, field+" is stored as a string")
+		}
+	}
+	if _, ok := rawSentinel["DeltaFromLSN"]; ok {
+		migrations = append(migrations, "DeltaFromLSN is renamed to DeltaLSN")
+	}
+	if _, ok := rawSentinel["Files"]; ok {
+		migrations = append(migrations, "files metadata is stored in the sentinel")
+	}
+
+	data, err := json.Marshal(rawSentinel)
+	if err != nil {
+		return legacySentinelDto{}, nil, nil, err
+	}
+	var sentinel legacySentinelDto
+	if err = json.Unmarshal(data, &sentinel); err != nil {
+		return legacySentinelDto{}, nil, nil, err
+	}
+
+	knownFields := make(map[string]bool)
+	collectJSONFields(reflect.TypeOf(BackupSentinelDtoV2{}), knownFields)
+	collectJSONFields(reflect.TypeOf(DeprecatedSentinelFields{}), knownFields)
+	unknownFields := make(map[string]json.RawMessage)
+	for key, value := range rawSentinel {
+		if !knownFields[key] {
+			unknownFields[key] = value
+		}
+	}
+	return sentinel, migrations, unknownFields, nil
+}
+
+// migrateWalESentinel translates the WAL-E sentinel fields into their WAL-G counterparts
+func migrateWalESentinel(rawSentinel map[string]json.RawMessage) (string, error) {
+	if _, ok := rawSentinel[walEBackupStartSegment]; !ok {
+		return "", nil
+	}
+	if _, ok := rawSentinel["LSN"]; ok {
+		return "", nil
+	}
+	for lsnField, keys := range map[string][2]string{
+		"LSN":       {walEBackupStartSegment, walEBackupStartOffset},
+		"FinishLSN": {walEBackupStopSegment, walEBackupStopOffset},
+	} {
+		lsn, ok, err := parseWalELSN(rawSentinel, keys[0], keys[1])
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			rawSentinel[lsnField] = json.RawMessage(strconv.FormatUint(lsn, 10))
+		}
+	}
+	if expandedSize, ok := rawSentinel[walEExpandedSize]; ok {
+		if _, ok := rawSentinel["UncompressedSize"]; !ok {
+			rawSentinel["UncompressedSize"] = expandedSize
+		}
+	}
+	return "WAL-E sentinel", nil
+}
+
+// parseWalELSN computes the LSN from the WAL-E segment name and the hexadecimal offset in the segment
+func parseWalELSN(rawSentinel map[string]json.RawMessage, segmentKey, offsetKey string) (uint64, bool, error) {
+	var segment, offset string
+	if value, ok := rawSentinel[segmentKey]; !ok || json.Unmarshal(value, &segment) != nil || segment == "" {
+		return 0, false, nil
+	}
+	if value, ok := rawSentinel[offsetKey]; ok {
+		if err := json.Unmarshal(value, &offset); err != nil {
+			return 0, false, errors.Wrapf(err, "invalid %s in the WAL-E sentinel", offsetKey)
+		}
+	}
+	_, logSegNo, err := ParseWALFilename(segment)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid %s in the WAL-E sentinel", segmentKey)
+	}
+	var segmentOffset uint64
+	if offset != "" {
+		segmentOffset, err = strconv.ParseUint(offset, hexadecimal, 64)
+		if err != nil {
+			return 0, false, errors.Wrapf(err, "invalid %s in the WAL-E sentinel", offsetKey)
+		}
+	}
+	return logSegNo*WalSegmentSize + segmentOffset, true, nil
+}
+
+// migrateStringLSN replaces the LSN stored as the decimal string or in the X/X form with the number
+func migrateStringLSN(rawSentinel map[string]json.RawMessage, field string) (bool, error) {
+	var decoded interface{}
+	raw, ok := rawSentinel[field]
+	if !ok || json.Unmarshal(raw, &decoded) != nil {
+		return false, nil
+	}
+	value, isString := decoded.(string)
+	if !isString {
+		return false, nil
+	}
+	var lsn uint64
+	var err error
+	if strings.Contains(value, "/") {
+		lsn, err = pgx.ParseLSN(value)
+	} else {
+		lsn, err = strconv.ParseUint(value, 10, 64)
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid %s '%s' in the sentinel", field, value)
+	}
+	rawSentinel[field] = json.RawMessage(strconv.FormatUint(lsn, 10))
+	return true, nil
+}
+
+// collectJSONFields collects the JSON keys of the struct fields including the embedded structs
+func collectJSONFields(structType reflect.Type, fields map[string]bool) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectJSONFields(field.Type, fields)
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = true
+	}
+}
+
+// migrateLegacyDeltaFields fills the delta chain fields, which the old WAL-G versions did not store, from the base backup
+func (backup *Backup) migrateLegacyDeltaFields(sentinel *BackupSentinelDto) (string, error) {
+	if sentinel.IncrementFrom == nil ||
+		(sentinel.IncrementFromLSN != nil && sentinel.IncrementFullName != nil && sentinel.IncrementCount != nil) {
+		return "", nil
+	}
+	base := NewBackup(backup.Folder, *sentinel.IncrementFrom)
+	baseSentinel, err := base.GetSentinel()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to fetch the base backup %s to migrate the sentinel of %s",
+			base.Name, backup.Name)
+	}
+	if sentinel.IncrementFromLSN == nil {
+		if baseSentinel.BackupStartLSN == nil {
+			return "", errors.Errorf("neither backup %s stores DeltaLSN nor its base backup %s stores LSN",
+				backup.Name, base.Name)
+		}
+		sentinel.IncrementFromLSN = baseSentinel.BackupStartLSN
+	}
+	fullName, count := base.Name, 1
+	if baseSentinel.IsIncremental() {
+		fullName, count = *baseSentinel.IncrementFullName, *baseSentinel.IncrementCount+1
+	}
+	if sentinel.IncrementFullName == nil {
+		sentinel.IncrementFullName = &fullName
+	}
+	if sentinel.IncrementCount == nil {
+		sentinel.IncrementCount = &count
+	}
+	return "delta chain fields are filled from the base backup", nil
+}
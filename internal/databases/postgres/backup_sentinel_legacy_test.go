@@ -0,0 +1,102 @@
+package postgres_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const legacySentinelsPath = "../../../test/testdata/sentinels"
+
+func putLegacyTestSentinel(t *testing.T, folder *memory.Folder, backupName, fileName string) {
+	sentinel, err := os.ReadFile(filepath.Join(legacySentinelsPath, fileName))
+	require.NoError(t, err)
+	require.NoError(t, folder.PutObject(backupName+utility.SentinelSuffix, bytes.NewReader(sentinel)))
+}
+
+func TestGetSentinel_WalESentinel(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putLegacyTestSentinel(t, folder, "base_000000010000000000000002_00000028", "wale.json")
+	backup := postgres.NewBackup(folder, "base_000000010000000000000002_00000028")
+
+	sentinel, err := backup.GetSentinel()
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x2000028), *sentinel.BackupStartLSN)
+	assert.Equal(t, uint64(0x30000F8), *sentinel.BackupFinishLSN)
+	assert.Equal(t, int64(26931047), sentinel.UncompressedSize)
+	assert.False(t, sentinel.IsIncremental())
+	assert.Equal(t, json.RawMessage(`"000000010000000000000002"`),
+		backup.SentinelUnknownFields["wal_segment_backup_start"])
+}
+
+func TestGetSentinel_LegacyDeltaSentinel(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putLegacyTestSentinel(t, folder, "base_000000010000000000000002", "walg_v0_full.json")
+	putLegacyTestSentinel(t, folder, "base_000000010000000000000003_D_000000010000000000000002", "walg_v0_delta.json")
+	backup := postgres.NewBackup(folder, "base_000000010000000000000003_D_000000010000000000000002")
+
+	sentinel, filesMetadata, err := backup.GetSentinelAndFilesMetadata()
+
+	require.NoError(t, err)
+	require.True(t, sentinel.IsIncremental())
+	assert.Equal(t, uint64(33554472), *sentinel.IncrementFromLSN)
+	assert.Equal(t, "base_000000010000000000000002", *sentinel.IncrementFullName)
+	assert.Equal(t, 1, *sentinel.IncrementCount)
+	assert.Equal(t, 90605, sentinel.PgVersion)
+	assert.True(t, filesMetadata.Files["/base/1/1259"].IsIncremented)
+	assert.True(t, filesMetadata.Files["/PG_VERSION"].IsSkipped)
+	assert.Empty(t, backup.SentinelUnknownFields)
+}
+
+func TestGetSentinel_StringLSNAndUnknownFields(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putLegacyTestSentinel(t, folder, "base_000000010000000000000002", "walg_string_lsn.json")
+	backup := postgres.NewBackup(folder, "base_000000010000000000000002")
+
+	sentinel, err := backup.GetSentinel()
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x2000028), *sentinel.BackupStartLSN)
+	assert.Equal(t, uint64(33554680), *sentinel.BackupFinishLSN)
+	assert.Equal(t, int64(24576), sentinel.UncompressedSize)
+	// Hostname is the field of the sentinel V2, so it is not unknown
+	assert.Equal(t, map[string]json.RawMessage{"BackupSource": json.RawMessage(`"replica"`)}, backup.SentinelUnknownFields)
+}
+
+func TestGetSentinel_CurrentSchema(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	lsn, finishLSN := uint64(33554472), uint64(33554680)
+	sentinel, err := json.Marshal(postgres.NewBackupSentinelDtoV2(postgres.BackupSentinelDto{
+		BackupStartLSN: &lsn, BackupFinishLSN: &finishLSN, PgVersion: 140005,
+	}, postgres.ExtendedMetadataDto{Hostname: "db1"}))
+	require.NoError(t, err)
+	require.NoError(t, folder.PutObject("base_000000010000000000000002"+utility.SentinelSuffix, bytes.NewReader(sentinel)))
+	backup := postgres.NewBackup(folder, "base_000000010000000000000002")
+
+	decoded, err := backup.GetSentinel()
+
+	require.NoError(t, err)
+	assert.Equal(t, lsn, *decoded.BackupStartLSN)
+	assert.Equal(t, 140005, decoded.PgVersion)
+	assert.Empty(t, backup.SentinelUnknownFields)
+}
+
+func TestGetSentinel_InvalidStringLSN(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	require.NoError(t, folder.PutObject("base_000000010000000000000002"+utility.SentinelSuffix,
+		bytes.NewReader([]byte(`{"LSN":"not an lsn"}`))))
+	backup := postgres.NewBackup(folder, "base_000000010000000000000002")
+
+	_, err := backup.GetSentinel()
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// BackupShowFile describes the file stored in the backup
+type BackupShowFile struct {
+	Name string
+	// Size is the size of the file in the data directory, it is not recorded by the older versions
+	Size          *int64 `json:",omitempty"`
+	IsIncremented bool
+	// IncrementBlocks is the number of the pages stored in the increment of the incremented file
+	IncrementBlocks *int64 `json:",omitempty"`
+	// IsSkipped is set for the file unchanged since the base backup, which is not stored in the backup tars
+	IsSkipped bool `json:",omitempty"`
+	// TarName is the name of the tar part containing the file, empty if the backup does not record it
+	TarName string `json:",omitempty"`
+	// ExternalObject is the path of the object storing the file outside of the backup tars
+	ExternalObject string `json:",omitempty"`
+}
+
+// BackupShowFilesResult lists the files of the backup
+type BackupShowFilesResult struct {
+	BackupName string
+	// IncrementFrom is the base backup of the delta backup
+	IncrementFrom string `json:",omitempty"`
+	Files         []BackupShowFile
+}
+
+// ListBackupFiles lists the files of the backup by its sentinel and files metadata, the backup tars
+// are not downloaded
+func ListBackupFiles(folder storage.Folder, backupName string) (BackupShowFilesResult, error) {
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupName)
+	sentinelDto, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+	if err != nil {
+		return BackupShowFilesResult{}, errors.Wrapf(err, "failed to fetch the metadata of backup '%s'", backupName)
+	}
+	if sentinelDto.FilesMetadataDisabled {
+		return BackupShowFilesResult{}, errors.Errorf("backup '%s' is taken without the files metadata", backupName)
+	}
+	if len(filesMeta.Files) == 0 {
+		return BackupShowFilesResult{}, errors.Errorf("no files metadata is found for backup '%s'", backupName)
+	}
+
+	result := BackupShowFilesResult{BackupName: backupName, Files: make([]BackupShowFile, 0, len(filesMeta.Files))}
+	if sentinelDto.IsIncremental() {
+		result.IncrementFrom = *sentinelDto.IncrementFrom
+	}
+	tarNames := make(map[string]string)
+	for tarName, fileNames := range filesMeta.TarFileSets {
+		for _, fileName := range fileNames {
+			tarNames[fileName] = tarName
+		}
+	}
+	for name, description := range filesMeta.Files {
+		file := BackupShowFile{
+			Name:            name,
+			Size:            description.Size,
+			IsIncremented:   description.IsIncremented,
+			IncrementBlocks: description.IncrementBlocks,
+			IsSkipped:       description.IsSkipped,
+			TarName:         tarNames[name],
+		}
+		if description.ExternalObject != nil {
+			file.ExternalObject = description.ExternalObject.Path
+		}
+		result.Files = append(result.Files, file)
+	}
+	sort.Slice(result.Files, func(i, j int) bool { return result.Files[i].Name < result.Files[j].Name })
+	return result, nil
+}
+
+// HandleBackupShowFiles is invoked to perform wal-g backup-show-files
+func HandleBackupShowFiles(folder storage.Folder, backupSelector internal.BackupSelector, output io.Writer, useJSON bool) {
+	backupName, err := backupSelector.Select(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
+	result, err := ListBackupFiles(folder, backupName)
+	tracelog.ErrorLogger.FatalfOnError("Failed to list the backup files: %v", err)
+
+	if useJSON {
+		err = json.NewEncoder(output).Encode(result)
+	} else {
+		err = writeBackupShowFilesResult(result, output)
+	}
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+func writeBackupShowFilesResult(result BackupShowFilesResult, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(writer, "name\tsize\tincremented\tlocation")
+	for _, file := range result.Files {
+		size := "-"
+		if file.Size != nil {
+			size = strconv.FormatInt(*file.Size, 10)
+		}
+		incremented := "no"
+		if file.IsIncremented {
+			incremented = "yes"
+			if file.IncrementBlocks != nil {
+				incremented = fmt.Sprintf("yes (%d blocks)", *file.IncrementBlocks)
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", file.Name, size, incremented, describeBackupShowFileLocation(file))
+	}
+	return writer.Flush()
+}
+
+func describeBackupShowFileLocation(file BackupShowFile) string {
+	switch {
+	case file.IsSkipped:
+		return "unchanged, not stored"
+	case file.ExternalObject != "":
+		return "external " + file.ExternalObject
+	case file.TarName != "":
+		return file.TarName
+	default:
+		return "-"
+	}
+}
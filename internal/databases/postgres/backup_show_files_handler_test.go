@@ -0,0 +1,102 @@
+package postgres_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const showFilesTestMetadata = `{
+	"Files": {
+		"/PG_VERSION": {"IsIncremented": false, "IsSkipped": false, "MTime": "2023-01-01T00:00:00Z", "Size": 3},
+		"/base/1/1259": {"IsIncremented": true, "IsSkipped": false, "MTime": "2023-01-01T00:00:00Z",
+			"IncrementBlocks": 2, "Size": 73728},
+		"/base/1/1249": {"IsIncremented": false, "IsSkipped": true, "MTime": "2023-01-01T00:00:00Z"},
+		"/global/pg_control": {"IsIncremented": false, "IsSkipped": false, "MTime": "2023-01-01T00:00:00Z", "Size": 8192}
+	},
+	"TarFileSets": {
+		"part_001.tar.lz4": ["/PG_VERSION", "/base/1/1259"],
+		"pg_control.tar.lz4": ["/global/pg_control"]
+	}
+}`
+
+// createShowFilesTestFolder puts only the metadata objects of the delta backup, there are no backup tars
+func createShowFilesTestFolder(t *testing.T) storage.Folder {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putTestSentinel(t, folder, verifyDeltaBackup, makeTestSentinel(0x4000000, verifyFullBackup, verifyFullBackup, 0x2000000))
+	err := folder.GetSubFolder(utility.BaseBackupPath).
+		PutObject(verifyDeltaBackup+"/"+postgres.FilesMetadataName, strings.NewReader(showFilesTestMetadata))
+	require.NoError(t, err)
+	return folder
+}
+
+func TestListBackupFiles(t *testing.T) {
+	folder := createShowFilesTestFolder(t)
+
+	result, err := postgres.ListBackupFiles(folder, verifyDeltaBackup)
+
+	require.NoError(t, err)
+	size := func(value int64) *int64 { return &value }
+	assert.Equal(t, postgres.BackupShowFilesResult{
+		BackupName:    verifyDeltaBackup,
+		IncrementFrom: verifyFullBackup,
+		Files: []postgres.BackupShowFile{
+			{Name: "/PG_VERSION", Size: size(3), TarName: "part_001.tar.lz4"},
+			{Name: "/base/1/1249", IsSkipped: true},
+			{Name: "/base/1/1259", Size: size(73728), IsIncremented: true, IncrementBlocks: size(2),
+				TarName: "part_001.tar.lz4"},
+			{Name: "/global/pg_control", Size: size(8192), TarName: "pg_control.tar.lz4"},
+		},
+	}, result)
+}
+
+func TestListBackupFiles_MissingMetadata(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putTestSentinel(t, folder, verifyFullBackup, makeTestSentinel(0x2000000, "", "", 0))
+
+	_, err := postgres.ListBackupFiles(folder, verifyFullBackup)
+
+	assert.Error(t, err)
+}
+
+func newShowFilesTestSelector(t *testing.T) internal.BackupSelector {
+	backupSelector, err := internal.NewBackupNameSelector(verifyDeltaBackup, true)
+	require.NoError(t, err)
+	return backupSelector
+}
+
+func TestHandleBackupShowFiles_Table(t *testing.T) {
+	folder := createShowFilesTestFolder(t)
+
+	var output bytes.Buffer
+	postgres.HandleBackupShowFiles(folder, newShowFilesTestSelector(t), &output, false)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, []string{"name", "size", "incremented", "location"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"/PG_VERSION", "3", "no", "part_001.tar.lz4"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"/base/1/1249", "-", "no", "unchanged,", "not", "stored"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"/base/1/1259", "73728", "yes", "(2", "blocks)", "part_001.tar.lz4"},
+		strings.Fields(lines[3]))
+}
+
+func TestHandleBackupShowFiles_JSON(t *testing.T) {
+	folder := createShowFilesTestFolder(t)
+
+	var output bytes.Buffer
+	postgres.HandleBackupShowFiles(folder, newShowFilesTestSelector(t), &output, true)
+
+	var result postgres.BackupShowFilesResult
+	require.NoError(t, json.Unmarshal(output.Bytes(), &result))
+	assert.Equal(t, verifyDeltaBackup, result.BackupName)
+	assert.Len(t, result.Files, 4)
+}
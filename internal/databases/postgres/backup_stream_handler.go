@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// TarStreamInterpreter writes the interpreted entries of the backup tars to the single tar stream.
+// The names are made relative, the tablespace files are written under pg_tblspc as regular directories.
+type TarStreamInterpreter struct {
+	writer *tar.Writer
+}
+
+func NewTarStreamInterpreter(output io.Writer) *TarStreamInterpreter {
+	return &TarStreamInterpreter{writer: tar.NewWriter(output)}
+}
+
+func (interpreter *TarStreamInterpreter) Interpret(reader io.Reader, header *tar.Header) error {
+	streamedHeader := *header
+	streamedHeader.Name = strings.TrimPrefix(header.Name, "/")
+	if streamedHeader.Name == "" {
+		return nil
+	}
+	err := interpreter.writer.WriteHeader(&streamedHeader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write the header of '%s'", header.Name)
+	}
+	if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+		_, err = io.Copy(interpreter.writer, reader)
+		return errors.Wrapf(err, "failed to write '%s'", header.Name)
+	}
+	return nil
+}
+
+// Close writes the tar trailer
+func (interpreter *TarStreamInterpreter) Close() error {
+	return interpreter.writer.Close()
+}
+
+// HandleBackupStream writes the backup contents to the output as a standalone tar.
+// The full backups are streamed directly from storage. The delta backups and the backups with
+// external objects are reconstructed in a temporary directory first, which is then streamed.
+func HandleBackupStream(folder storage.Folder, backupSelector internal.BackupSelector, output io.Writer) {
+	backupName, err := backupSelector.Select(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupName)
+	sentinelDto, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	if sentinelDto.IsIncremental() || hasExternalObjects(filesMeta) {
+		err = streamReconstructedBackup(folder, backup, sentinelDto, output)
+	} else {
+		err = streamFullBackup(backup, filesMeta, output)
+	}
+	tracelog.ErrorLogger.FatalfOnError("Failed to stream backup: %v\n", err)
+}
+
+// streamFullBackup streams the tars of the full backup one by one, since the stream can't be retried
+func streamFullBackup(backup Backup, filesMeta FilesMetadataDto, output io.Writer) error {
+	stages, pgControlKey, err := backup.getTarsToExtract(filesMeta, UnwrapAll, false)
+	if err != nil {
+		return err
+	}
+	if pgControlKey != "" {
+		stages = append(stages, []internal.ReaderMaker{
+			internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)})
+	}
+
+	interpreter := NewTarStreamInterpreter(output)
+	crypter := internal.ConfigureCrypter()
+	for _, stage := range stages {
+		for _, readerMaker := range stage {
+			err = streamTar(interpreter, readerMaker, crypter)
+			if err != nil {
+				return errors.Wrapf(err, "failed to stream '%s'", readerMaker.Path())
+			}
+		}
+	}
+	return interpreter.Close()
+}
+
+func streamTar(interpreter internal.TarInterpreter, readerMaker internal.ReaderMaker, crypter crypto.Crypter) error {
+	readCloser, err := readerMaker.Reader()
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(readCloser, "")
+	tarStream, err := internal.DecryptAndDecompressTar(readCloser, readerMaker.Path(), crypter)
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(tarStream, "")
+
+	tarReader := tar.NewReader(tarStream)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = interpreter.Interpret(tarReader, header)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// streamReconstructedBackup applies the delta chain in a temporary directory and streams its contents.
+// The tablespaces are restored inside the temporary directory too.
+func streamReconstructedBackup(folder storage.Folder, backup Backup, sentinelDto BackupSentinelDto,
+	output io.Writer) error {
+	tempDirectory, err := os.MkdirTemp("", "wal-g-backup-stream")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDirectory); err != nil {
+			tracelog.WarningLogger.Printf("Failed to remove the temporary directory '%s': %v\n", tempDirectory, err)
+		}
+	}()
+	dbDataDirectory := filepath.Join(tempDirectory, "data")
+	spec := NewTablespaceSpec(dbDataDirectory)
+	if sentinelDto.TablespaceSpec != nil {
+		for _, name := range sentinelDto.TablespaceSpec.TablespaceNames() {
+			spec.addTablespace(name, filepath.Join(tempDirectory, "tablespaces", name))
+		}
+	}
+
+	tracelog.InfoLogger.Printf("Reconstructing backup %s in '%s'\n", backup.Name, tempDirectory)
+	err = deltaFetchRecursionOld(backup, folder, dbDataDirectory, &spec, UnwrapAll)
+	if err != nil {
+		return err
+	}
+
+	writer := tar.NewWriter(output)
+	err = writeDirectoryToTar(writer, dbDataDirectory, "")
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// writeDirectoryToTar writes the directory tree to the tar under the namePrefix.
+// The tablespace symlinks in pg_tblspc are followed, so the tar is self-contained.
+func writeDirectoryToTar(writer *tar.Writer, directory, namePrefix string) error {
+	return filepath.Walk(directory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(directory, filePath)
+		if err != nil {
+			return err
+		}
+		name := path.Join(namePrefix, filepath.ToSlash(relativePath))
+		if relativePath == "." {
+			if namePrefix == "" {
+				return nil
+			}
+			name = namePrefix
+		}
+
+		linkTarget := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			linkTarget, err = os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			if path.Dir(name) == TablespaceFolder {
+				return writeDirectoryToTar(writer, linkTarget, name)
+			}
+		}
+		header, err := tar.FileInfoHeader(info, linkTarget)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		err = writer.WriteHeader(header)
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		return copyFileToTar(writer, filePath)
+	})
+}
+
+func copyFileToTar(writer *tar.Writer, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(file, "")
+	_, err = io.Copy(writer, file)
+	return err
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const testStreamBackupName = "base_000000010000000000000002"
+
+type testTarEntry struct {
+	name    string
+	content string
+	isDir   bool
+}
+
+func makeCompressedTestTar(t *testing.T, entries ...testTarEntry) []byte {
+	var tarBuffer bytes.Buffer
+	writer := tar.NewWriter(&tarBuffer)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(entry.content))}
+		if entry.isDir {
+			header = &tar.Header{Name: entry.name, Typeflag: tar.TypeDir, Mode: 0700}
+		}
+		require.NoError(t, writer.WriteHeader(header))
+		_, err := writer.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	compressed, err := io.ReadAll(internal.CompressAndEncrypt(&tarBuffer, compression.Compressors[lz4.AlgorithmName], nil))
+	require.NoError(t, err)
+	return compressed
+}
+
+func readTestTar(t *testing.T, reader io.Reader) map[string]string {
+	entries := make(map[string]string)
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		entries[header.Name] = string(content)
+	}
+}
+
+func createTestStreamFolder(t *testing.T) storage.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	require.NoError(t, baseBackupFolder.PutObject(testStreamBackupName+utility.SentinelSuffix, strings.NewReader("{}")))
+	tarFolder := baseBackupFolder.GetSubFolder(testStreamBackupName + internal.TarPartitionFolderName)
+	require.NoError(t, tarFolder.PutObject("part_1.tar.lz4", bytes.NewReader(makeCompressedTestTar(t,
+		testTarEntry{name: "/base", isDir: true}, testTarEntry{name: "/base/1", content: "relation"}))))
+	require.NoError(t, tarFolder.PutObject("pg_control.tar.lz4", bytes.NewReader(makeCompressedTestTar(t,
+		testTarEntry{name: PgControlPath, content: "control"}))))
+	return folder
+}
+
+func TestHandleBackupStream_FullBackup(t *testing.T) {
+	folder := createTestStreamFolder(t)
+	backupSelector, err := internal.NewBackupNameSelector(testStreamBackupName, true)
+	require.NoError(t, err)
+
+	var output bytes.Buffer
+	HandleBackupStream(folder, backupSelector, &output)
+
+	assert.Equal(t, map[string]string{"base": "", "base/1": "relation", "global/pg_control": "control"},
+		readTestTar(t, &output))
+}
+
+func TestStreamReconstructedBackup(t *testing.T) {
+	folder := createTestStreamFolder(t)
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), testStreamBackupName)
+
+	var output bytes.Buffer
+	err := streamReconstructedBackup(folder, backup, BackupSentinelDto{}, &output)
+
+	require.NoError(t, err)
+	entries := readTestTar(t, &output)
+	assert.Equal(t, "relation", entries["base/1"])
+	assert.Equal(t, "control", entries["global/pg_control"])
+}
+
+func TestWriteDirectoryToTar_FollowsTablespaceSymlinks(t *testing.T) {
+	tempDirectory := t.TempDir()
+	dataDirectory := filepath.Join(tempDirectory, "data")
+	tablespaceDirectory := filepath.Join(tempDirectory, "tablespace")
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDirectory, TablespaceFolder), 0700))
+	require.NoError(t, os.MkdirAll(tablespaceDirectory, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDirectory, "PG_VERSION"), []byte("15"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tablespaceDirectory, "16385"), []byte("data"), 0600))
+	require.NoError(t, os.Symlink(tablespaceDirectory, filepath.Join(dataDirectory, TablespaceFolder, "16384")))
+
+	var output bytes.Buffer
+	writer := tar.NewWriter(&output)
+	require.NoError(t, writeDirectoryToTar(writer, dataDirectory, ""))
+	require.NoError(t, writer.Close())
+
+	assert.Equal(t, map[string]string{
+		"PG_VERSION":            "15",
+		"pg_tblspc/":            "",
+		"pg_tblspc/16384/":      "",
+		"pg_tblspc/16384/16385": "data",
+	}, readTestTar(t, &output))
+}
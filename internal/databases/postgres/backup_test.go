@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/wal-g/wal-g/internal/databases/postgres"
 
@@ -170,3 +171,117 @@ func TestGetLastBackupNameWithGarbage(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "base_000", latestBackup)
 }
+
+func TestSelectFilesChangedSince(t *testing.T) {
+	since := time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC)
+	files := internal.BackupFileList{
+		"/base/1/old": *internal.NewBackupFileDescription(false, false, since.Add(-time.Hour)),
+		"/base/1/new": *internal.NewBackupFileDescription(false, false, since.Add(time.Hour)),
+	}
+	filesToUnwrap := map[string]bool{"/base/1/old": true, "/base/1/new": true, postgres.PgControlPath: true}
+
+	selected, err := postgres.SelectFilesChangedSince(files, filesToUnwrap, since)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/base/1/new": true, postgres.PgControlPath: true}, selected)
+}
+
+func TestSelectFilesChangedSince_NoMTime(t *testing.T) {
+	files := testtools.NewBackupFileListBuilder().WithSimple().Build()
+
+	_, err := postgres.SelectFilesChangedSince(files, map[string]bool{testtools.SimplePath: true}, time.Now())
+
+	assert.Error(t, err)
+}
+
+func makeSampleTestFiles() internal.BackupFileList {
+	return internal.BackupFileList{
+		"/base/1/1": {}, "/base/1/2": {}, "/base/1/3": {}, "/base/1/4": {}, "/base/1/5": {},
+	}
+}
+
+func TestSampleFilesToUnwrap_FirstFiles(t *testing.T) {
+	selected, err := postgres.SampleFilesToUnwrap(makeSampleTestFiles(), postgres.UnwrapAll, 2, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/base/1/1": true, "/base/1/2": true}, selected)
+}
+
+func TestSampleFilesToUnwrap_WithinSelectedFiles(t *testing.T) {
+	filesToUnwrap := map[string]bool{"/base/1/2": true, "/base/1/4": true, "/base/1/5": true, postgres.PgControlPath: true}
+
+	selected, err := postgres.SampleFilesToUnwrap(makeSampleTestFiles(), filesToUnwrap, 2, true)
+
+	assert.NoError(t, err)
+	assert.Len(t, selected, 2)
+	for fileName := range selected {
+		assert.True(t, filesToUnwrap[fileName])
+		assert.NotEqual(t, postgres.PgControlPath, fileName)
+	}
+}
+
+func TestSampleFilesToUnwrap_SampleLargerThanBackup(t *testing.T) {
+	selected, err := postgres.SampleFilesToUnwrap(makeSampleTestFiles(), postgres.UnwrapAll, 100, true)
+
+	assert.NoError(t, err)
+	assert.Len(t, selected, 5)
+}
+
+func TestSampleFilesToUnwrap_NoFilesMetadata(t *testing.T) {
+	_, err := postgres.SampleFilesToUnwrap(internal.BackupFileList{}, postgres.UnwrapAll, 2, false)
+
+	assert.Error(t, err)
+}
+
+func TestExcludeRelcacheInitFiles(t *testing.T) {
+	filesToUnwrap := map[string]bool{
+		"/base/1/1259": true,
+		"/base/1/" + postgres.RelcacheInitFileName: true,
+		"/global/" + postgres.RelcacheInitFileName: true,
+		postgres.PgControlPath:                     true,
+	}
+
+	selected := postgres.ExcludeRelcacheInitFiles(filesToUnwrap)
+
+	assert.Equal(t, map[string]bool{"/base/1/1259": true, postgres.PgControlPath: true}, selected)
+}
+
+func TestExcludeRelcacheInitFiles_NoFilesMetadata(t *testing.T) {
+	assert.Nil(t, postgres.ExcludeRelcacheInitFiles(postgres.UnwrapAll))
+}
+
+func TestSelectFilesChangedSince_NoFilesMetadata(t *testing.T) {
+	_, err := postgres.SelectFilesChangedSince(internal.BackupFileList{}, postgres.UnwrapAll, time.Now())
+
+	assert.Error(t, err)
+}
+
+func TestSelectFilesWithPrefix(t *testing.T) {
+	files := internal.BackupFileList{
+		"/pg_tblspc/16385/PG_14_202107181/16386/16387": {}, "/pg_tblspc/16390/PG_14_202107181/16391/16392": {},
+		"/base/1/1259": {},
+	}
+	filesToUnwrap := map[string]bool{
+		"/pg_tblspc/16385/PG_14_202107181/16386/16387": true, "/pg_tblspc/16390/PG_14_202107181/16391/16392": true,
+		"/base/1/1259": true, postgres.PgControlPath: true,
+	}
+
+	selected, err := postgres.SelectFilesWithPrefix(files, filesToUnwrap, "pg_tblspc/16385/")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/pg_tblspc/16385/PG_14_202107181/16386/16387": true}, selected)
+}
+
+func TestSelectFilesWithPrefix_MatchesNothing(t *testing.T) {
+	files := internal.BackupFileList{"/base/1/1259": {}}
+
+	_, err := postgres.SelectFilesWithPrefix(files, map[string]bool{"/base/1/1259": true}, "pg_tblspc/16385/")
+
+	assert.Error(t, err)
+}
+
+func TestSelectFilesWithPrefix_NoFilesMetadata(t *testing.T) {
+	_, err := postgres.SelectFilesWithPrefix(internal.BackupFileList{}, postgres.UnwrapAll, "base/1/")
+
+	assert.Error(t, err)
+}
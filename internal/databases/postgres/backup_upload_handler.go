@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/limiters"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+	"golang.org/x/sync/semaphore"
+)
+
+type UploadedObjectVerificationError struct {
+	error
+}
+
+func newUploadedObjectVerificationError(objectPath string, expectedSize, actualSize int64) UploadedObjectVerificationError {
+	return UploadedObjectVerificationError{errors.Errorf(
+		"uploaded object '%s' has size %d, expected %d", objectPath, actualSize, expectedSize)}
+}
+
+func (err UploadedObjectVerificationError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type localBackupFile struct {
+	localPath  string
+	objectPath string
+	size       int64
+}
+
+// HandleBackupUpload is invoked to perform wal-g backup-upload
+func HandleBackupUpload(folder storage.Folder, localDirectory, backupName string) {
+	concurrency, err := internal.GetMaxUploadConcurrency()
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	err = UploadLocalBackup(folder, localDirectory, backupName, concurrency)
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload backup: %v\n", err)
+}
+
+// UploadLocalBackup uploads the local copy of the backup to the storage. The local directory must have
+// the same layout as the backup folder in storage and must contain the backup sentinel file.
+// Files which are already uploaded by the previous interrupted attempt are skipped, if the object in storage has
+// the same size and the local file has the checksum recorded by that attempt, see backupUploadState.
+// Every uploaded file is verified by its size and the sentinel is uploaded last, so the backup becomes visible only when all of its files are in place.
+// Uploads are throttled by the network rate limiter.
+func UploadLocalBackup(folder storage.Folder, localDirectory, backupName string, concurrency int) error {
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	backup := NewBackup(baseBackupFolder, backupName)
+	exists, err := backup.SentinelExists()
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errors.Errorf("backup '%s' already exists in storage", backupName)
+	}
+
+	sentinelName := backupName + utility.SentinelSuffix
+	sentinelInfo, err := os.Stat(filepath.Join(localDirectory, sentinelName))
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the sentinel of backup '%s'", backupName)
+	}
+	files, err := listLocalBackupFiles(localDirectory, backupName, sentinelName)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadBackupUploadState(localDirectory)
+	if err != nil {
+		return err
+	}
+	uploadedSizes, err := getUploadedObjectSizes(baseBackupFolder.GetSubFolder(backupName))
+	if err != nil {
+		return err
+	}
+	filesToUpload := make([]localBackupFile, 0, len(files))
+	for _, file := range files {
+		size, ok := uploadedSizes[strings.TrimPrefix(file.objectPath, backupName+"/")]
+		if ok {
+			uploaded, err := state.isUploaded(file, size)
+			if err != nil {
+				return err
+			}
+			if uploaded {
+				tracelog.InfoLogger.Printf("Skipping '%s': already uploaded\n", file.objectPath)
+				continue
+			}
+		}
+		filesToUpload = append(filesToUpload, file)
+	}
+	tracelog.InfoLogger.Printf("Uploading %d of %d backup files\n", len(filesToUpload), len(files))
+
+	err = uploadLocalBackupFiles(baseBackupFolder, filesToUpload, concurrency, state)
+	if err != nil {
+		return err
+	}
+
+	err = uploadLocalBackupFile(baseBackupFolder, localBackupFile{
+		localPath:  filepath.Join(localDirectory, sentinelName),
+		objectPath: sentinelName,
+		size:       sentinelInfo.Size(),
+	}, nil)
+	if err != nil {
+		return err
+	}
+	state.remove()
+	return nil
+}
+
+// listLocalBackupFiles lists the files of the local backup excluding the sentinel and the upload state
+func listLocalBackupFiles(localDirectory, backupName, sentinelName string) ([]localBackupFile, error) {
+	files := make([]localBackupFile, 0)
+	err := filepath.Walk(localDirectory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(localDirectory, filePath)
+		if err != nil {
+			return err
+		}
+		if relativePath == sentinelName || strings.HasPrefix(relativePath, backupUploadStateFileName) {
+			return nil
+		}
+		files = append(files, localBackupFile{
+			localPath:  filePath,
+			objectPath: path.Join(backupName, filepath.ToSlash(relativePath)),
+			size:       info.Size(),
+		})
+		return nil
+	})
+	return files, errors.Wrapf(err, "failed to list the local backup files in '%s'", localDirectory)
+}
+
+// getUploadedObjectSizes returns the sizes of already uploaded backup objects by their paths in the backup folder
+func getUploadedObjectSizes(backupFolder storage.Folder) (map[string]int64, error) {
+	objects, err := storage.ListFolderRecursively(backupFolder)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the uploaded backup objects")
+	}
+	sizes := make(map[string]int64, len(objects))
+	for _, object := range objects {
+		sizes[object.GetName()] = object.GetSize()
+	}
+	return sizes, nil
+}
+
+func uploadLocalBackupFiles(baseBackupFolder storage.Folder, files []localBackupFile, concurrency int,
+	state *backupUploadState) error {
+	ctx := context.Background()
+	sem := semaphore.NewWeighted(int64(concurrency))
+	var errMutex sync.Mutex
+	var firstErr error
+
+	for _, file := range files {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return err
+		}
+		file := file
+		go func() {
+			defer sem.Release(1)
+			err := uploadLocalBackupFile(baseBackupFolder, file, state)
+			if err != nil {
+				errMutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMutex.Unlock()
+			}
+		}()
+	}
+	if err := sem.Acquire(ctx, int64(concurrency)); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// uploadLocalBackupFile uploads and verifies the file, then records its checksum to the state if there is one
+func uploadLocalBackupFile(baseBackupFolder storage.Folder, file localBackupFile, state *backupUploadState) error {
+	localFile, err := os.Open(file.localPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open '%s'", file.localPath)
+	}
+	defer utility.LoggedClose(localFile, "")
+
+	hash := sha256.New()
+	err = baseBackupFolder.PutObject(file.objectPath, limiters.NewNetworkLimitReader(io.TeeReader(localFile, hash)))
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload '%s'", file.objectPath)
+	}
+	err = verifyUploadedObject(baseBackupFolder, file.objectPath, file.size)
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		if err = state.markUploaded(file.objectPath, hex.EncodeToString(hash.Sum(nil))); err != nil {
+			return err
+		}
+	}
+	tracelog.InfoLogger.Printf("Uploaded '%s'\n", file.objectPath)
+	return nil
+}
+
+func verifyUploadedObject(folder storage.Folder, objectPath string, expectedSize int64) error {
+	dir, name := path.Split(objectPath)
+	objects, _, err := folder.GetSubFolder(dir).ListFolder()
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify uploaded object '%s'", objectPath)
+	}
+	for _, object := range objects {
+		if object.GetName() != name {
+			continue
+		}
+		if object.GetSize() != expectedSize {
+			return newUploadedObjectVerificationError(objectPath, expectedSize, object.GetSize())
+		}
+		return nil
+	}
+	return newUploadedObjectVerificationError(objectPath, expectedSize, 0)
+}
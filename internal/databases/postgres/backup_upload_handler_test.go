@@ -0,0 +1,136 @@
+package postgres_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const uploadTestBackup = "base_000000010000000000000002"
+
+func createLocalBackup(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		filePath := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	}
+	return dir
+}
+
+func readTestObject(t *testing.T, folder storage.Folder, objectPath string) string {
+	reader, err := folder.ReadObject(objectPath)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestUploadLocalBackup(t *testing.T) {
+	dir := createLocalBackup(t, map[string]string{
+		uploadTestBackup + utility.SentinelSuffix: "{}",
+		"metadata.json":                 "{}",
+		"tar_partitions/part_1.tar.lz4": "part_1",
+		"tar_partitions/part_2.tar.lz4": "part_2",
+	})
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+
+	err := postgres.UploadLocalBackup(folder, dir, uploadTestBackup, 2)
+
+	require.NoError(t, err)
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	assert.Equal(t, "part_1", readTestObject(t, baseBackupFolder, uploadTestBackup+"/tar_partitions/part_1.tar.lz4"))
+	assert.Equal(t, "part_2", readTestObject(t, baseBackupFolder, uploadTestBackup+"/tar_partitions/part_2.tar.lz4"))
+	assert.Equal(t, "{}", readTestObject(t, baseBackupFolder, uploadTestBackup+"/metadata.json"))
+	assert.Equal(t, "{}", readTestObject(t, baseBackupFolder, uploadTestBackup+utility.SentinelSuffix))
+}
+
+func TestUploadLocalBackup_ResumesPartialUpload(t *testing.T) {
+	dir := createLocalBackup(t, map[string]string{
+		uploadTestBackup + utility.SentinelSuffix: "{}",
+		"tar_partitions/part_1.tar.lz4":           "part_1",
+		"tar_partitions/part_2.tar.lz4":           "part_2",
+		"tar_partitions/part_3.tar.lz4":           "part_3",
+	})
+	// the previous attempt has uploaded part_3 completely
+	part3Checksum := sha256.Sum256([]byte("part_3"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".walg_upload_state"), []byte(fmt.Sprintf(`{"%s":"%s"}`,
+		uploadTestBackup+"/tar_partitions/part_3.tar.lz4", hex.EncodeToString(part3Checksum[:]))), 0600))
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	// the truncated part and the part of the same size but not recorded by the previous attempt are uploaded again
+	require.NoError(t, baseBackupFolder.PutObject(uploadTestBackup+"/tar_partitions/part_1.tar.lz4",
+		bytes.NewBufferString("par")))
+	require.NoError(t, baseBackupFolder.PutObject(uploadTestBackup+"/tar_partitions/part_2.tar.lz4",
+		bytes.NewBufferString("prev_2")))
+	require.NoError(t, baseBackupFolder.PutObject(uploadTestBackup+"/tar_partitions/part_3.tar.lz4",
+		bytes.NewBufferString("part_3")))
+
+	err := postgres.UploadLocalBackup(folder, dir, uploadTestBackup, 1)
+
+	require.NoError(t, err)
+	assert.Equal(t, "part_1", readTestObject(t, baseBackupFolder, uploadTestBackup+"/tar_partitions/part_1.tar.lz4"))
+	assert.Equal(t, "part_2", readTestObject(t, baseBackupFolder, uploadTestBackup+"/tar_partitions/part_2.tar.lz4"))
+	assert.Equal(t, "part_3", readTestObject(t, baseBackupFolder, uploadTestBackup+"/tar_partitions/part_3.tar.lz4"))
+	exists, err := baseBackupFolder.Exists(uploadTestBackup + "/.walg_upload_state")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	// the state of the finished upload is removed
+	_, err = os.Stat(filepath.Join(dir, ".walg_upload_state"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUploadLocalBackup_ChangedLocalFile(t *testing.T) {
+	dir := createLocalBackup(t, map[string]string{
+		uploadTestBackup + utility.SentinelSuffix: "{}",
+		"tar_partitions/part_1.tar.lz4":           "part_1",
+	})
+	staleChecksum := sha256.Sum256([]byte("prev_1"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".walg_upload_state"), []byte(fmt.Sprintf(`{"%s":"%s"}`,
+		uploadTestBackup+"/tar_partitions/part_1.tar.lz4", hex.EncodeToString(staleChecksum[:]))), 0600))
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	require.NoError(t, baseBackupFolder.PutObject(uploadTestBackup+"/tar_partitions/part_1.tar.lz4",
+		bytes.NewBufferString("prev_1")))
+
+	err := postgres.UploadLocalBackup(folder, dir, uploadTestBackup, 1)
+
+	require.NoError(t, err)
+	assert.Equal(t, "part_1", readTestObject(t, baseBackupFolder, uploadTestBackup+"/tar_partitions/part_1.tar.lz4"))
+}
+
+func TestUploadLocalBackup_BackupExists(t *testing.T) {
+	dir := createLocalBackup(t, map[string]string{
+		uploadTestBackup + utility.SentinelSuffix: "{}",
+	})
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	require.NoError(t, folder.GetSubFolder(utility.BaseBackupPath).
+		PutObject(uploadTestBackup+utility.SentinelSuffix, bytes.NewBufferString("{}")))
+
+	err := postgres.UploadLocalBackup(folder, dir, uploadTestBackup, 1)
+
+	assert.Error(t, err)
+}
+
+func TestUploadLocalBackup_NoSentinel(t *testing.T) {
+	dir := createLocalBackup(t, map[string]string{
+		"tar_partitions/part_1.tar.lz4": "part_1",
+	})
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+
+	err := postgres.UploadLocalBackup(folder, dir, uploadTestBackup, 1)
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// backupUploadStateFileName is the file of the local backup directory recording the checksums of the uploaded files
+const backupUploadStateFileName = ".walg_upload_state"
+
+// backupUploadState records the checksum of every file uploaded by backup-upload, so the resumed upload
+// skips only the objects uploaded completely from the same local content. The object of the same size
+// may be left by the other upload or the local file may be changed since, such objects are uploaded again.
+type backupUploadState struct {
+	path      string
+	mutex     sync.Mutex
+	checksums map[string]string
+}
+
+func loadBackupUploadState(localDirectory string) (*backupUploadState, error) {
+	state := &backupUploadState{
+		path:      filepath.Join(localDirectory, backupUploadStateFileName),
+		checksums: make(map[string]string),
+	}
+	data, err := os.ReadFile(state.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the upload state '%s'", state.path)
+	}
+	if err = json.Unmarshal(data, &state.checksums); err != nil {
+		tracelog.WarningLogger.Printf("Failed to parse the upload state '%s', all files will be uploaded: %v\n",
+			state.path, err)
+		state.checksums = make(map[string]string)
+	}
+	return state, nil
+}
+
+// isUploaded checks the object of the local file size is uploaded from the same content
+func (state *backupUploadState) isUploaded(file localBackupFile, uploadedSize int64) (bool, error) {
+	state.mutex.Lock()
+	checksum, ok := state.checksums[file.objectPath]
+	state.mutex.Unlock()
+	if !ok || uploadedSize != file.size {
+		return false, nil
+	}
+	localFile, err := os.Open(file.localPath)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to open '%s'", file.localPath)
+	}
+	defer utility.LoggedClose(localFile, "")
+	hash := sha256.New()
+	if _, err = io.Copy(hash, localFile); err != nil {
+		return false, errors.Wrapf(err, "failed to read '%s'", file.localPath)
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == checksum, nil
+}
+
+func (state *backupUploadState) markUploaded(objectPath, checksum string) error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.checksums[objectPath] = checksum
+	data, err := json.Marshal(state.checksums)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(writeFileAtomically(state.path, data), "failed to record the upload state")
+}
+
+// remove removes the state of the finished upload
+func (state *backupUploadState) remove() {
+	if err := os.Remove(state.path); err != nil && !os.IsNotExist(err) {
+		tracelog.WarningLogger.Printf("Failed to remove the upload state '%s': %v\n", state.path, err)
+	}
+}
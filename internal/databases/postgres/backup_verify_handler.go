@@ -0,0 +1,317 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+	"golang.org/x/sync/semaphore"
+)
+
+// BrokenChainLink describes the first broken link found
+// while walking the increment chain of some backup
+type BrokenChainLink struct {
+	BackupName  string `json:"backup_name"`
+	BrokenAt    string `json:"broken_at"`
+	MissingBase string `json:"missing_base,omitempty"`
+	Reason      string `json:"reason"`
+}
+
+// BrokenBackupFiles describes the files of some backup which can't be restored from storage:
+// the tar parts listed in the files metadata but missing in storage and the incremented files
+// which are missing in the files metadata of the increment base
+type BrokenBackupFiles struct {
+	BackupName       string   `json:"backup_name"`
+	MissingParts     []string `json:"missing_parts,omitempty"`
+	Base             string   `json:"base,omitempty"`
+	UnreachableFiles []string `json:"unreachable_files,omitempty"`
+}
+
+// BackupChainsVerifyResult contains the result of the increment chains verification
+type BackupChainsVerifyResult struct {
+	CheckedChains int                 `json:"checked_chains"`
+	BrokenChains  []BrokenChainLink   `json:"broken_chains"`
+	BrokenBackups []BrokenBackupFiles `json:"broken_backups"`
+}
+
+func (result BackupChainsVerifyResult) IsOk() bool {
+	return len(result.BrokenChains) == 0 && len(result.BrokenBackups) == 0
+}
+
+// VerifyBackupChain walks the increment chain of the specified backup down to the full backup and checks
+// that every increment base is present in storage and is consistent with the increment which references it.
+// Returns nil if the chain is intact.
+func VerifyBackupChain(baseBackupFolder storage.Folder, backupName string) (*BrokenChainLink, error) {
+	visited := make(map[string]bool)
+	var fullBackupName *string
+	currentName := backupName
+	for {
+		visited[currentName] = true
+		backup := NewBackup(baseBackupFolder, currentName)
+		sentinel, err := backup.GetSentinel()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch sentinel of backup '%s'", currentName)
+		}
+		if !isSentinelIncrementInfoComplete(sentinel) {
+			return &BrokenChainLink{BackupName: backupName, BrokenAt: currentName,
+				Reason: "inconsistent increment information in sentinel"}, nil
+		}
+		if !sentinel.IsIncremental() {
+			if fullBackupName != nil && *fullBackupName != currentName {
+				return &BrokenChainLink{BackupName: backupName, BrokenAt: currentName,
+					Reason: fmt.Sprintf("chain terminates in '%s', but increments reference full backup '%s'",
+						currentName, *fullBackupName)}, nil
+			}
+			return nil, nil
+		}
+		if fullBackupName == nil {
+			fullBackupName = sentinel.IncrementFullName
+		}
+
+		baseName := *sentinel.IncrementFrom
+		if visited[baseName] {
+			return &BrokenChainLink{BackupName: backupName, BrokenAt: currentName,
+				Reason: fmt.Sprintf("increment chain loops back to '%s'", baseName)}, nil
+		}
+		base := NewBackup(baseBackupFolder, baseName)
+		exists, err := base.SentinelExists()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to check the existence of backup '%s'", baseName)
+		}
+		if !exists {
+			return &BrokenChainLink{BackupName: backupName, BrokenAt: currentName, MissingBase: baseName,
+				Reason: "increment base is missing"}, nil
+		}
+		baseSentinel, err := base.GetSentinel()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch sentinel of backup '%s'", baseName)
+		}
+		if baseSentinel.BackupStartLSN == nil || *baseSentinel.BackupStartLSN != *sentinel.IncrementFromLSN {
+			return &BrokenChainLink{BackupName: backupName, BrokenAt: currentName,
+				Reason: fmt.Sprintf("increment base '%s' LSN does not match the increment DeltaLSN %x",
+					baseName, *sentinel.IncrementFromLSN)}, nil
+		}
+		currentName = baseName
+	}
+}
+
+func isSentinelIncrementInfoComplete(sentinel BackupSentinelDto) bool {
+	if sentinel.IncrementFrom == nil {
+		return true
+	}
+	return sentinel.IncrementFromLSN != nil && sentinel.IncrementFullName != nil && sentinel.IncrementCount != nil
+}
+
+// VerifyBackupFiles checks, using the files metadata only, that the files of the specified backup can be restored:
+// every tar part listed in the files metadata is present in storage and every incremented file of the delta backup
+// is present in its increment base. Returns nil if the files are intact. The missing increment base is reported
+// by VerifyBackupChain, so are the backups without the files metadata skipped.
+func VerifyBackupFiles(baseBackupFolder storage.Folder, backupName string) (*BrokenBackupFiles, error) {
+	backup := NewBackup(baseBackupFolder, backupName)
+	sentinel, filesMetadata, err := backup.GetSentinelAndFilesMetadata()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch files metadata of backup '%s'", backupName)
+	}
+	brokenFiles := BrokenBackupFiles{BackupName: backupName}
+
+	if len(filesMetadata.TarFileSets) > 0 {
+		tarNames, err := backup.GetTarNames()
+		if err != nil {
+			return nil, err
+		}
+		storedTarNames := make(map[string]bool, len(tarNames))
+		for _, tarName := range tarNames {
+			storedTarNames[tarName] = true
+		}
+		for tarName := range filesMetadata.TarFileSets {
+			if !storedTarNames[tarName] {
+				brokenFiles.MissingParts = append(brokenFiles.MissingParts, tarName)
+			}
+		}
+		sort.Strings(brokenFiles.MissingParts)
+	}
+
+	if sentinel.IsIncremental() {
+		unreachableFiles, err := findUnreachableIncrementedFiles(baseBackupFolder, *sentinel.IncrementFrom, filesMetadata)
+		if err != nil {
+			return nil, err
+		}
+		if len(unreachableFiles) > 0 {
+			brokenFiles.Base = *sentinel.IncrementFrom
+			brokenFiles.UnreachableFiles = unreachableFiles
+		}
+	}
+
+	if len(brokenFiles.MissingParts) == 0 && len(brokenFiles.UnreachableFiles) == 0 {
+		return nil, nil
+	}
+	return &brokenFiles, nil
+}
+
+// findUnreachableIncrementedFiles returns the incremented and the skipped files of the delta backup
+// which are missing in the files metadata of its base, so they can't be restored
+func findUnreachableIncrementedFiles(baseBackupFolder storage.Folder, baseName string,
+	filesMetadata FilesMetadataDto) ([]string, error) {
+	if len(filesMetadata.Files) == 0 {
+		return nil, nil
+	}
+	base := NewBackup(baseBackupFolder, baseName)
+	exists, err := base.SentinelExists()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to check the existence of backup '%s'", baseName)
+	}
+	if !exists {
+		return nil, nil
+	}
+	_, baseFilesMetadata, err := base.GetSentinelAndFilesMetadata()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch files metadata of backup '%s'", baseName)
+	}
+	if len(baseFilesMetadata.Files) == 0 {
+		tracelog.DebugLogger.Printf("Backup '%s' has no files metadata, skipping the incremented files check\n", baseName)
+		return nil, nil
+	}
+
+	unreachableFiles := make([]string, 0)
+	for fileName, description := range filesMetadata.Files {
+		if !description.IsIncremented && !description.IsSkipped {
+			continue
+		}
+		if _, ok := baseFilesMetadata.Files[fileName]; !ok {
+			unreachableFiles = append(unreachableFiles, fileName)
+		}
+	}
+	sort.Strings(unreachableFiles)
+	return unreachableFiles, nil
+}
+
+// VerifyBackupChains concurrently verifies the increment chains and the files of all the backups in storage
+func VerifyBackupChains(folder storage.Folder) (BackupChainsVerifyResult, error) {
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	backupObjects, err := internal.FindBackupObjects(folder)
+	if err != nil {
+		return BackupChainsVerifyResult{}, err
+	}
+
+	concurrency, err := internal.GetMaxDownloadConcurrency()
+	if err != nil {
+		return BackupChainsVerifyResult{}, err
+	}
+
+	ctx := context.Background()
+	sem := semaphore.NewWeighted(int64(concurrency))
+	var mu sync.Mutex
+	var firstErr error
+	result := BackupChainsVerifyResult{
+		BrokenChains:  make([]BrokenChainLink, 0),
+		BrokenBackups: make([]BrokenBackupFiles, 0),
+	}
+
+	for _, backupObject := range backupObjects {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return BackupChainsVerifyResult{}, err
+		}
+		backupName := backupObject.GetBackupName()
+		go func() {
+			defer sem.Release(1)
+			brokenLink, err := VerifyBackupChain(baseBackupFolder, backupName)
+			var brokenFiles *BrokenBackupFiles
+			if err == nil {
+				brokenFiles, err = VerifyBackupFiles(baseBackupFolder, backupName)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			result.CheckedChains++
+			if brokenLink != nil {
+				tracelog.WarningLogger.Printf("Backup '%s' has a broken increment chain at '%s': %s\n",
+					brokenLink.BackupName, brokenLink.BrokenAt, brokenLink.Reason)
+				result.BrokenChains = append(result.BrokenChains, *brokenLink)
+			}
+			if brokenFiles != nil {
+				tracelog.WarningLogger.Printf("Backup '%s' has %d missing tar parts and %d unreachable incremented files\n",
+					brokenFiles.BackupName, len(brokenFiles.MissingParts), len(brokenFiles.UnreachableFiles))
+				result.BrokenBackups = append(result.BrokenBackups, *brokenFiles)
+			}
+		}()
+	}
+	if err := sem.Acquire(ctx, int64(concurrency)); err != nil {
+		return BackupChainsVerifyResult{}, err
+	}
+	if firstErr != nil {
+		return BackupChainsVerifyResult{}, firstErr
+	}
+
+	sort.Slice(result.BrokenChains, func(i, j int) bool {
+		return result.BrokenChains[i].BackupName < result.BrokenChains[j].BackupName
+	})
+	sort.Slice(result.BrokenBackups, func(i, j int) bool {
+		return result.BrokenBackups[i].BackupName < result.BrokenBackups[j].BackupName
+	})
+	return result, nil
+}
+
+// HandleBackupVerify is invoked to perform wal-g backup-verify
+func HandleBackupVerify(folder storage.Folder, output io.Writer, useJSON bool) {
+	result, err := VerifyBackupChains(folder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to verify backup chains: %v", err)
+
+	if useJSON {
+		err = json.NewEncoder(output).Encode(result)
+	} else {
+		err = writeBackupChainsVerifyResult(result, output)
+	}
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	if !result.IsOk() {
+		tracelog.ErrorLogger.Fatalf("Found %d broken increment chains and %d backups with broken files\n",
+			len(result.BrokenChains), len(result.BrokenBackups))
+	}
+}
+
+func writeBackupChainsVerifyResult(result BackupChainsVerifyResult, output io.Writer) error {
+	_, err := fmt.Fprintf(output, "[backup-verify] checked chains: %d, broken chains: %d, backups with broken files: %d\n",
+		result.CheckedChains, len(result.BrokenChains), len(result.BrokenBackups))
+	if err != nil {
+		return err
+	}
+	for _, link := range result.BrokenChains {
+		line := fmt.Sprintf("[backup-verify] %s: broken at %s: %s", link.BackupName, link.BrokenAt, link.Reason)
+		if link.MissingBase != "" {
+			line += fmt.Sprintf(" (missing base %s)", link.MissingBase)
+		}
+		if _, err = fmt.Fprintln(output, line); err != nil {
+			return err
+		}
+	}
+	for _, brokenFiles := range result.BrokenBackups {
+		for _, tarName := range brokenFiles.MissingParts {
+			_, err = fmt.Fprintf(output, "[backup-verify] %s: missing tar part %s\n", brokenFiles.BackupName, tarName)
+			if err != nil {
+				return err
+			}
+		}
+		for _, fileName := range brokenFiles.UnreachableFiles {
+			_, err = fmt.Fprintf(output, "[backup-verify] %s: incremented file %s is missing in base %s\n",
+				brokenFiles.BackupName, fileName, brokenFiles.Base)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
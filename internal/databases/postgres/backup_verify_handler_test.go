@@ -0,0 +1,189 @@
+package postgres_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	verifyFullBackup   = "base_000000010000000000000002"
+	verifyDeltaBackup  = "base_000000010000000000000004_D_000000010000000000000002"
+	verifyDelta2Backup = "base_000000010000000000000006_D_000000010000000000000004"
+	verifyOrphanBackup = "base_000000010000000000000008_D_000000010000000000000007"
+)
+
+func putTestSentinel(t *testing.T, folder storage.Folder, backupName string, sentinel postgres.BackupSentinelDto) {
+	bytes, err := json.Marshal(&sentinel)
+	require.NoError(t, err)
+	err = folder.GetSubFolder(utility.BaseBackupPath).
+		PutObject(backupName+utility.SentinelSuffix, strings.NewReader(string(bytes)))
+	require.NoError(t, err)
+}
+
+func makeTestSentinel(startLSN uint64, incrementFrom, incrementFull string, incrementFromLSN uint64) postgres.BackupSentinelDto {
+	sentinel := postgres.BackupSentinelDto{BackupStartLSN: &startLSN}
+	if incrementFrom != "" {
+		count := 1
+		sentinel.IncrementFrom = &incrementFrom
+		sentinel.IncrementFullName = &incrementFull
+		sentinel.IncrementFromLSN = &incrementFromLSN
+		sentinel.IncrementCount = &count
+	}
+	return sentinel
+}
+
+func createVerifyTestFolder(t *testing.T) storage.Folder {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putTestSentinel(t, folder, verifyFullBackup, makeTestSentinel(0x2000000, "", "", 0))
+	putTestSentinel(t, folder, verifyDeltaBackup,
+		makeTestSentinel(0x4000000, verifyFullBackup, verifyFullBackup, 0x2000000))
+	putTestSentinel(t, folder, verifyDelta2Backup,
+		makeTestSentinel(0x6000000, verifyDeltaBackup, verifyFullBackup, 0x4000000))
+	return folder
+}
+
+func TestVerifyBackupChain_Intact(t *testing.T) {
+	folder := createVerifyTestFolder(t)
+
+	brokenLink, err := postgres.VerifyBackupChain(folder.GetSubFolder(utility.BaseBackupPath), verifyDelta2Backup)
+
+	assert.NoError(t, err)
+	assert.Nil(t, brokenLink)
+}
+
+func TestVerifyBackupChain_MissingBase(t *testing.T) {
+	folder := createVerifyTestFolder(t)
+	putTestSentinel(t, folder, verifyOrphanBackup,
+		makeTestSentinel(0x8000000, "base_000000010000000000000007", verifyFullBackup, 0x7000000))
+
+	brokenLink, err := postgres.VerifyBackupChain(folder.GetSubFolder(utility.BaseBackupPath), verifyOrphanBackup)
+
+	assert.NoError(t, err)
+	require.NotNil(t, brokenLink)
+	assert.Equal(t, "base_000000010000000000000007", brokenLink.MissingBase)
+	assert.Equal(t, verifyOrphanBackup, brokenLink.BrokenAt)
+}
+
+func TestVerifyBackupChain_LSNMismatch(t *testing.T) {
+	folder := createVerifyTestFolder(t)
+	putTestSentinel(t, folder, verifyDelta2Backup,
+		makeTestSentinel(0x6000000, verifyDeltaBackup, verifyFullBackup, 0x5000000))
+
+	brokenLink, err := postgres.VerifyBackupChain(folder.GetSubFolder(utility.BaseBackupPath), verifyDelta2Backup)
+
+	assert.NoError(t, err)
+	require.NotNil(t, brokenLink)
+	assert.Empty(t, brokenLink.MissingBase)
+	assert.Equal(t, verifyDelta2Backup, brokenLink.BrokenAt)
+}
+
+func TestVerifyBackupChains_ReportsOnlyBrokenChains(t *testing.T) {
+	folder := createVerifyTestFolder(t)
+	putTestSentinel(t, folder, verifyOrphanBackup,
+		makeTestSentinel(0x8000000, "base_000000010000000000000007", verifyFullBackup, 0x7000000))
+
+	result, err := postgres.VerifyBackupChains(folder)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.CheckedChains)
+	require.Len(t, result.BrokenChains, 1)
+	assert.Equal(t, verifyOrphanBackup, result.BrokenChains[0].BackupName)
+	assert.Equal(t, "base_000000010000000000000007", result.BrokenChains[0].MissingBase)
+}
+
+func putVerifyTestFilesMetadata(t *testing.T, folder storage.Folder, backupName string,
+	files internal.BackupFileList, storedTarParts map[string][]string, missingTarParts ...string) {
+	filesMetadata := postgres.FilesMetadataDto{Files: files, TarFileSets: make(map[string][]string)}
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	for tarName, tarFiles := range storedTarParts {
+		err := baseBackupFolder.PutObject(backupName+internal.TarPartitionFolderName+tarName, strings.NewReader("tar"))
+		require.NoError(t, err)
+		filesMetadata.TarFileSets[tarName] = tarFiles
+	}
+	for _, tarName := range missingTarParts {
+		filesMetadata.TarFileSets[tarName] = []string{"/base/1/missing"}
+	}
+	bytes, err := json.Marshal(&filesMetadata)
+	require.NoError(t, err)
+	err = baseBackupFolder.PutObject(backupName+"/"+postgres.FilesMetadataName, strings.NewReader(string(bytes)))
+	require.NoError(t, err)
+}
+
+func createVerifyFilesTestFolder(t *testing.T) storage.Folder {
+	folder := createVerifyTestFolder(t)
+	putVerifyTestFilesMetadata(t, folder, verifyFullBackup, internal.BackupFileList{
+		"/base/1/1259": {},
+		"/base/1/1260": {},
+	}, map[string][]string{"part_1.tar.lz4": {"/base/1/1259", "/base/1/1260"}})
+	putVerifyTestFilesMetadata(t, folder, verifyDeltaBackup, internal.BackupFileList{
+		"/base/1/1259": {IsIncremented: true},
+		"/base/1/1260": {IsSkipped: true},
+		"/base/1/1261": {},
+	}, map[string][]string{"part_1.tar.lz4": {"/base/1/1259", "/base/1/1261"}})
+	return folder
+}
+
+func TestVerifyBackupFiles_Intact(t *testing.T) {
+	folder := createVerifyFilesTestFolder(t)
+
+	brokenFiles, err := postgres.VerifyBackupFiles(folder.GetSubFolder(utility.BaseBackupPath), verifyDeltaBackup)
+
+	assert.NoError(t, err)
+	assert.Nil(t, brokenFiles)
+}
+
+func TestVerifyBackupFiles_MissingTarPart(t *testing.T) {
+	folder := createVerifyFilesTestFolder(t)
+	putVerifyTestFilesMetadata(t, folder, verifyFullBackup, internal.BackupFileList{"/base/1/1259": {}},
+		map[string][]string{"part_1.tar.lz4": {"/base/1/1259"}}, "part_2.tar.lz4", "part_3.tar.lz4")
+
+	brokenFiles, err := postgres.VerifyBackupFiles(folder.GetSubFolder(utility.BaseBackupPath), verifyFullBackup)
+
+	assert.NoError(t, err)
+	require.NotNil(t, brokenFiles)
+	assert.Equal(t, []string{"part_2.tar.lz4", "part_3.tar.lz4"}, brokenFiles.MissingParts)
+	assert.Empty(t, brokenFiles.UnreachableFiles)
+}
+
+func TestVerifyBackupFiles_UnreachableIncrementedFiles(t *testing.T) {
+	folder := createVerifyFilesTestFolder(t)
+	// the base of the increment does not contain the incremented and the skipped files anymore
+	putVerifyTestFilesMetadata(t, folder, verifyFullBackup, internal.BackupFileList{"/base/1/1261": {}},
+		map[string][]string{"part_1.tar.lz4": {"/base/1/1261"}})
+
+	brokenFiles, err := postgres.VerifyBackupFiles(folder.GetSubFolder(utility.BaseBackupPath), verifyDeltaBackup)
+
+	assert.NoError(t, err)
+	require.NotNil(t, brokenFiles)
+	assert.Empty(t, brokenFiles.MissingParts)
+	assert.Equal(t, verifyFullBackup, brokenFiles.Base)
+	assert.Equal(t, []string{"/base/1/1259", "/base/1/1260"}, brokenFiles.UnreachableFiles)
+}
+
+func TestVerifyBackupChains_ReportsBrokenFiles(t *testing.T) {
+	folder := createVerifyFilesTestFolder(t)
+	putVerifyTestFilesMetadata(t, folder, verifyDelta2Backup, internal.BackupFileList{"/base/1/1262": {IsIncremented: true}},
+		nil, "part_1.tar.lz4")
+	putTestSentinel(t, folder, verifyOrphanBackup,
+		makeTestSentinel(0x8000000, "base_000000010000000000000007", verifyFullBackup, 0x7000000))
+
+	result, err := postgres.VerifyBackupChains(folder)
+
+	assert.NoError(t, err)
+	assert.False(t, result.IsOk())
+	require.Len(t, result.BrokenChains, 1)
+	assert.Equal(t, verifyOrphanBackup, result.BrokenChains[0].BackupName)
+	require.Len(t, result.BrokenBackups, 1)
+	assert.Equal(t, verifyDelta2Backup, result.BrokenBackups[0].BackupName)
+	assert.Equal(t, []string{"part_1.tar.lz4"}, result.BrokenBackups[0].MissingParts)
+	assert.Equal(t, []string{"/base/1/1262"}, result.BrokenBackups[0].UnreachableFiles)
+}
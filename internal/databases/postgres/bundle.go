@@ -47,6 +47,9 @@ func init() {
 		"log", "pg_log", "pg_xlog", "pg_wal", // Directories
 		"pgsql_tmp", "postgresql.auto.conf.tmp", "postmaster.pid", "postmaster.opts", "recovery.conf", // Files
 		"pg_dynshmem", "pg_notify", "pg_replslot", "pg_serial", "pg_stat_tmp", "pg_snapshots", "pg_subtrans", // Directories
+
+		RestoreProvenanceFilename,       // Written by the restore
+		RestoreCompletionMarkerFilename, // Written by the restore
 	}
 
 	for _, filename := range filesToExclude {
@@ -260,6 +263,8 @@ func (bundle *Bundle) HandleWalkedFSObject(path string, info os.FileInfo, err er
 func (bundle *Bundle) addToBundle(path string, info os.FileInfo) error {
 	fileName := info.Name()
 	_, excluded := ExcludedFilenames[fileName]
+	// the files left by the interrupted restore are never complete
+	excluded = excluded || strings.HasSuffix(fileName, restoreTemporaryFileSuffix)
 	isDir := info.IsDir()
 
 	if excluded && !isDir {
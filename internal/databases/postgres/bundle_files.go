@@ -29,12 +29,14 @@ type RegularBundleFiles struct {
 
 func (files *RegularBundleFiles) AddSkippedFile(tarHeader *tar.Header, fileInfo os.FileInfo) {
 	files.AddFileDescription(tarHeader.Name,
-		internal.BackupFileDescription{IsSkipped: true, IsIncremented: false, MTime: fileInfo.ModTime()})
+		internal.BackupFileDescription{IsSkipped: true, IsIncremented: false, MTime: fileInfo.ModTime(),
+			Size: getFileSize(fileInfo)})
 }
 
 func (files *RegularBundleFiles) AddFile(tarHeader *tar.Header, fileInfo os.FileInfo, isIncremented bool) {
 	files.AddFileDescription(tarHeader.Name,
-		internal.BackupFileDescription{IsSkipped: false, IsIncremented: isIncremented, MTime: fileInfo.ModTime()})
+		internal.BackupFileDescription{IsSkipped: false, IsIncremented: isIncremented, MTime: fileInfo.ModTime(),
+			IncrementBlocks: getIncrementBlocks(tarHeader, isIncremented), Size: getFileSize(fileInfo)})
 }
 
 func (files *RegularBundleFiles) AddFileDescription(name string, backupFileDescription internal.BackupFileDescription) {
@@ -43,11 +45,29 @@ func (files *RegularBundleFiles) AddFileDescription(name string, backupFileDescr
 
 func (files *RegularBundleFiles) AddFileWithCorruptBlocks(tarHeader *tar.Header, fileInfo os.FileInfo,
 	isIncremented bool, corruptedBlocks []uint32, storeAllBlocks bool) {
-	fileDescription := internal.BackupFileDescription{IsSkipped: false, IsIncremented: isIncremented, MTime: fileInfo.ModTime()}
+	fileDescription := internal.BackupFileDescription{IsSkipped: false, IsIncremented: isIncremented, MTime: fileInfo.ModTime(),
+		IncrementBlocks: getIncrementBlocks(tarHeader, isIncremented), Size: getFileSize(fileInfo)}
 	fileDescription.SetCorruptBlocks(corruptedBlocks, storeAllBlocks)
 	files.AddFileDescription(tarHeader.Name, fileDescription)
 }
 
+// getIncrementBlocks returns the number of the pages in the increment of the incremented file.
+// The tar header of the incremented file holds the increment size.
+func getIncrementBlocks(tarHeader *tar.Header, isIncremented bool) *int64 {
+	if !isIncremented {
+		return nil
+	}
+	blocks := incrementBlockCount(tarHeader.Size)
+	return &blocks
+}
+
+// getFileSize returns the size of the file in the data directory, the tar header of the incremented file
+// holds the increment size instead
+func getFileSize(fileInfo os.FileInfo) *int64 {
+	size := fileInfo.Size()
+	return &size
+}
+
 func (files *RegularBundleFiles) GetUnderlyingMap() *sync.Map {
 	return &files.Map
 }
@@ -70,7 +90,7 @@ func (files *StatBundleFiles) AddFileWithCorruptBlocks(tarHeader *tar.Header,
 	storeAllBlocks bool) {
 	updatesCount := files.fileStats.getFileUpdateCount(tarHeader.Name)
 	fileDescription := internal.BackupFileDescription{IsSkipped: false, IsIncremented: isIncremented, MTime: fileInfo.ModTime(),
-		UpdatesCount: updatesCount}
+		UpdatesCount: updatesCount, IncrementBlocks: getIncrementBlocks(tarHeader, isIncremented), Size: getFileSize(fileInfo)}
 	fileDescription.SetCorruptBlocks(corruptedBlocks, storeAllBlocks)
 	files.AddFileDescription(tarHeader.Name, fileDescription)
 }
@@ -79,14 +99,15 @@ func (files *StatBundleFiles) AddSkippedFile(tarHeader *tar.Header, fileInfo os.
 	updatesCount := files.fileStats.getFileUpdateCount(tarHeader.Name)
 	files.AddFileDescription(tarHeader.Name,
 		internal.BackupFileDescription{IsSkipped: true, IsIncremented: false,
-			MTime: fileInfo.ModTime(), UpdatesCount: updatesCount})
+			MTime: fileInfo.ModTime(), UpdatesCount: updatesCount, Size: getFileSize(fileInfo)})
 }
 
 func (files *StatBundleFiles) AddFile(tarHeader *tar.Header, fileInfo os.FileInfo, isIncremented bool) {
 	updatesCount := files.fileStats.getFileUpdateCount(tarHeader.Name)
 	files.AddFileDescription(tarHeader.Name,
 		internal.BackupFileDescription{IsSkipped: false, IsIncremented: isIncremented,
-			MTime: fileInfo.ModTime(), UpdatesCount: updatesCount})
+			MTime: fileInfo.ModTime(), UpdatesCount: updatesCount, IncrementBlocks: getIncrementBlocks(tarHeader, isIncremented),
+			Size: getFileSize(fileInfo)})
 }
 
 func (files *StatBundleFiles) AddFileDescription(name string, backupFileDescription internal.BackupFileDescription) {
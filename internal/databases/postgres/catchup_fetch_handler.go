@@ -7,8 +7,9 @@ import (
 	"github.com/wal-g/wal-g/utility"
 )
 
-// HandleCatchupFetch is invoked to perform wal-g catchup-fetch
-func HandleCatchupFetch(folder storage.Folder, dbDirectory, backupName string, useNewUnwrap bool) {
+// HandleCatchupFetch is invoked to perform wal-g catchup-fetch. With deltaApply, only the changed blocks
+// of the increments are applied in place to the existing files, validated to match the increments page counts.
+func HandleCatchupFetch(folder storage.Folder, dbDirectory, backupName string, useNewUnwrap, deltaApply bool) {
 	dbDirectory = utility.ResolveSymlink(dbDirectory)
 
 	backup, err := internal.GetBackupByName(backupName, utility.CatchupPath, folder)
@@ -21,8 +22,23 @@ func HandleCatchupFetch(folder storage.Folder, dbDirectory, backupName string, u
 	sentinelDto, filesMetaDto, err := pgBackup.GetSentinelAndFilesMetadata()
 	tracelog.ErrorLogger.FatalfOnError("Failed get backup sentinel: %v", err)
 
-	// testing the new unwrap implementation
-	if useNewUnwrap {
+	reflinkBase, err := ConfigureCatchupReflinkBase()
+	tracelog.ErrorLogger.FatalfOnError("Failed to configure the reflink base: %v", err)
+
+	if deltaApply {
+		if reflinkBase != nil {
+			tracelog.WarningLogger.Printf("%s is not used by the delta apply, the created files have to be "+
+				"in the increments completely\n", internal.CatchupReflinkBaseSetting)
+		}
+		// the delta apply is implemented by the new unwrap only
+		_, err = pgBackup.unwrapNew(dbDirectory, sentinelDto, filesMetaDto, filesToUnwrap, true, false,
+			WithFileUnwrapperType(DeltaApplyBackupFileUnwrapper))
+	} else if reflinkBase != nil {
+		// the created page files are cloned from the reflink base by the new unwrap only
+		_, err = pgBackup.unwrapNew(dbDirectory, sentinelDto, filesMetaDto, filesToUnwrap, true, false,
+			WithCatchupReflinkBase(reflinkBase))
+	} else if useNewUnwrap {
+		// testing the new unwrap implementation
 		_, err = pgBackup.unwrapNew(dbDirectory, sentinelDto, filesMetaDto, filesToUnwrap, true, false)
 	} else {
 		err = pgBackup.unwrapOld(dbDirectory, sentinelDto, filesMetaDto, filesToUnwrap, true)
@@ -26,6 +26,11 @@ func clearLocalFile(file *os.File) error {
 func (u *CatchupFileUnwrapper) UnwrapNewFile(reader io.Reader, header *tar.Header,
 	file *os.File, fsync bool) (*FileUnwrapResult, error) {
 	if u.options.isIncremented {
+		if u.options.reflinkBase != nil {
+			if basePath, ok := u.options.reflinkBase.basePath(header.Name); ok {
+				return createFileFromIncrementOverBase(reader, file, u.options.reflinkBase, basePath)
+			}
+		}
 		targetReadWriterAt, err := NewReadWriterAtFrom(file)
 		if err != nil {
 			return nil, err
@@ -43,6 +48,23 @@ func (u *CatchupFileUnwrapper) UnwrapNewFile(reader io.Reader, header *tar.Heade
 	return NewCompletedResult(), nil
 }
 
+// createFileFromIncrementOverBase clones the base file into the new local file and writes the increment over it
+func createFileFromIncrementOverBase(reader io.Reader, file *os.File,
+	reflinkBase *CatchupReflinkBase, basePath string) (*FileUnwrapResult, error) {
+	if err := reflinkBase.cloneTo(file, basePath); err != nil {
+		return nil, err
+	}
+	targetReadWriterAt, err := NewReadWriterAtFrom(file)
+	if err != nil {
+		return nil, err
+	}
+	missingBlockCount, err := CreateFileFromIncrementOverBase(reader, targetReadWriterAt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Interpret: failed to create file from increment over base '%s'", file.Name())
+	}
+	return NewCreatedFromIncrementResult(missingBlockCount), nil
+}
+
 func (u *CatchupFileUnwrapper) UnwrapExistingFile(reader io.Reader, header *tar.Header,
 	file *os.File, fsync bool) (*FileUnwrapResult, error) {
 	if u.options.isIncremented {
@@ -57,8 +79,16 @@ func (u *CatchupFileUnwrapper) UnwrapExistingFile(reader io.Reader, header *tar.
 		return NewWroteIncrementBlocksResult(restoredBlockCount), nil
 	}
 
+	identical, err := u.isIdenticalToLocalFile(header, file)
+	if err != nil {
+		return nil, err
+	}
+	if identical {
+		return NewSkippedIdenticalResult(), nil
+	}
+
 	// clear the local file because there is a newer version for it
-	err := clearLocalFile(file)
+	err = clearLocalFile(file)
 	if err != nil {
 		return nil, err
 	}
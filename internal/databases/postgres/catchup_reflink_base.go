@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// CatchupReflinkBase is the base copy of the data directory, e.g. the copy-on-write snapshot of the replica,
+// which the page files catchup-fetch creates from the increments are cloned from before the increment is written.
+// On the filesystems supporting the reflinks, e.g. btrfs or XFS, the clone shares the blocks with the base file,
+// otherwise the base file is copied.
+type CatchupReflinkBase struct {
+	directory string
+	// reflink clones the content of the source file into the empty target file
+	reflink func(target, source *os.File) error
+
+	mutex            sync.Mutex
+	warnedNotSupport bool
+}
+
+// ConfigureCatchupReflinkBase creates the reflink base of WALG_CATCHUP_REFLINK_BASE if it is set, returns nil otherwise
+func ConfigureCatchupReflinkBase() (*CatchupReflinkBase, error) {
+	directory := viper.GetString(internal.CatchupReflinkBaseSetting)
+	if directory == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", internal.CatchupReflinkBaseSetting)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("%s '%s' is not a directory", internal.CatchupReflinkBaseSetting, directory)
+	}
+	return newCatchupReflinkBase(directory, reflinkFile), nil
+}
+
+func newCatchupReflinkBase(directory string, reflink func(target, source *os.File) error) *CatchupReflinkBase {
+	return &CatchupReflinkBase{directory: directory, reflink: reflink}
+}
+
+// basePath returns the path of the base copy of the backup file, if it is the regular file
+func (base *CatchupReflinkBase) basePath(fileName string) (string, bool) {
+	basePath := path.Join(base.directory, fileName)
+	info, err := os.Stat(basePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return basePath, true
+}
+
+// cloneTo fills the empty file with the content of the base file, by the reflink if the filesystem supports it,
+// by the copy otherwise
+func (base *CatchupReflinkBase) cloneTo(file *os.File, basePath string) error {
+	baseFile, err := os.Open(basePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open the base file '%s'", basePath)
+	}
+	defer utility.LoggedClose(baseFile, "")
+
+	err = base.reflink(file, baseFile)
+	if err == nil {
+		tracelog.DebugLogger.Printf("'%s' is cloned from the base file '%s'\n", file.Name(), basePath)
+		return nil
+	}
+	if !isReflinkNotSupported(err) {
+		return errors.Wrapf(err, "failed to clone the base file '%s' to '%s'", basePath, file.Name())
+	}
+	base.warnNotSupported(err)
+	if _, err = io.Copy(file, baseFile); err != nil {
+		return errors.Wrapf(err, "failed to copy the base file '%s' to '%s'", basePath, file.Name())
+	}
+	return nil
+}
+
+// warnNotSupported warns once that the base files are copied instead of being cloned
+func (base *CatchupReflinkBase) warnNotSupported(err error) {
+	base.mutex.Lock()
+	defer base.mutex.Unlock()
+	if base.warnedNotSupport {
+		return
+	}
+	base.warnedNotSupport = true
+	tracelog.WarningLogger.Printf("The reflinks are not supported, the base files of %s are copied instead: %v\n",
+		internal.CatchupReflinkBaseSetting, err)
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package postgres
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var errReflinkNotSupported = errors.New("the reflinks are supported on Linux only")
+
+func reflinkFile(target, source *os.File) error {
+	return errReflinkNotSupported
+}
+
+func isReflinkNotSupported(err error) bool {
+	return errors.Is(err, errReflinkNotSupported)
+}
@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package postgres
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ficloneRequest is the FICLONE ioctl request, _IOW(0x94, 9, int)
+const ficloneRequest = 0x40049409
+
+// reflinkFile makes the target file share the blocks of the source file by the FICLONE ioctl
+func reflinkFile(target, source *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, target.Fd(), ficloneRequest, source.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isReflinkNotSupported checks if the filesystem can't clone the file, e.g. it has no reflinks
+// or the base file is on another filesystem
+func isReflinkNotSupported(err error) bool {
+	return errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.EXDEV) ||
+		errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOSYS)
+}
@@ -0,0 +1,111 @@
+//go:build linux
+// +build linux
+
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reflinkTestFileName = "/base/1/16384"
+
+func createReflinkTestBase(t *testing.T, content string, reflink func(target, source *os.File) error) *CatchupReflinkBase {
+	directory := t.TempDir()
+	basePath := filepath.Join(directory, reflinkTestFileName)
+	require.NoError(t, os.MkdirAll(filepath.Dir(basePath), 0700))
+	require.NoError(t, os.WriteFile(basePath, []byte(content), 0600))
+	return newCatchupReflinkBase(directory, reflink)
+}
+
+func unwrapReflinkTestFile(reflinkBase *CatchupReflinkBase, file *os.File, increment string) (*FileUnwrapResult, error) {
+	unwrapper := NewFileUnwrapper(CatchupBackupFileUnwrapper,
+		&BackupFileOptions{isIncremented: true, reflinkBase: reflinkBase})
+	return unwrapper.UnwrapNewFile(strings.NewReader(increment), &tar.Header{Name: reflinkTestFileName}, file, false)
+}
+
+func TestCatchupReflinkBase_FallsBackToCopyIfNotSupported(t *testing.T) {
+	reflinkCalls := 0
+	reflinkBase := createReflinkTestBase(t, strings.Repeat(makeDiffTestPage('a'), 3),
+		func(target, source *os.File) error {
+			reflinkCalls++
+			return syscall.EOPNOTSUPP
+		})
+	file := openDeltaApplyTestFile(t, "")
+	increment := makeDiffTestIncrement(uint64(4*DatabasePageSize),
+		map[uint32]string{1: makeDiffTestPage('b'), 3: makeDiffTestPage('c')})
+
+	result, err := unwrapReflinkTestFile(reflinkBase, file, increment)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, reflinkCalls)
+	assert.Equal(t, CreatedFromIncrement, result.FileUnwrapResultType)
+	assert.Equal(t, int64(0), result.blockCount)
+	assert.Equal(t, makeDiffTestPage('a')+makeDiffTestPage('b')+makeDiffTestPage('a')+makeDiffTestPage('c'),
+		readDeltaApplyTestFile(t, file))
+}
+
+func TestCatchupReflinkBase_CountsBlocksMissingInBase(t *testing.T) {
+	reflinkBase := createReflinkTestBase(t, makeDiffTestPage('a'), reflinkFile)
+	file := openDeltaApplyTestFile(t, "")
+	// the file grew since the base by two pages, only the last one is in the increment
+	increment := makeDiffTestIncrement(uint64(3*DatabasePageSize), map[uint32]string{2: makeDiffTestPage('c')})
+
+	result, err := unwrapReflinkTestFile(reflinkBase, file, increment)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.blockCount)
+	assert.Equal(t, makeDiffTestPage('a')+strings.Repeat("\x00", int(DatabasePageSize))+makeDiffTestPage('c'),
+		readDeltaApplyTestFile(t, file))
+}
+
+func TestCatchupReflinkBase_TruncatesLongerBase(t *testing.T) {
+	reflinkBase := createReflinkTestBase(t, strings.Repeat(makeDiffTestPage('a'), 4), reflinkFile)
+	file := openDeltaApplyTestFile(t, "")
+	increment := makeDiffTestIncrement(uint64(2*DatabasePageSize), map[uint32]string{0: makeDiffTestPage('b')})
+
+	_, err := unwrapReflinkTestFile(reflinkBase, file, increment)
+
+	require.NoError(t, err)
+	assert.Equal(t, makeDiffTestPage('b')+makeDiffTestPage('a'), readDeltaApplyTestFile(t, file))
+}
+
+func TestCatchupReflinkBase_ReflinkFailure(t *testing.T) {
+	reflinkBase := createReflinkTestBase(t, makeDiffTestPage('a'), func(target, source *os.File) error {
+		return syscall.EIO
+	})
+	file := openDeltaApplyTestFile(t, "")
+	increment := makeDiffTestIncrement(uint64(DatabasePageSize), map[uint32]string{})
+
+	_, err := unwrapReflinkTestFile(reflinkBase, file, increment)
+
+	assert.Error(t, err)
+}
+
+func TestCatchupReflinkBase_WithoutBaseFile(t *testing.T) {
+	reflinkBase := newCatchupReflinkBase(t.TempDir(), func(target, source *os.File) error {
+		t.Fatal("the missing base file must not be cloned")
+		return nil
+	})
+	file := openDeltaApplyTestFile(t, "")
+	increment := makeDiffTestIncrement(uint64(2*DatabasePageSize), map[uint32]string{1: makeDiffTestPage('b')})
+
+	result, err := unwrapReflinkTestFile(reflinkBase, file, increment)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.blockCount)
+	assert.Equal(t, strings.Repeat("\x00", int(DatabasePageSize))+makeDiffTestPage('b'), readDeltaApplyTestFile(t, file))
+}
+
+func TestIsReflinkNotSupported(t *testing.T) {
+	assert.True(t, isReflinkNotSupported(syscall.EOPNOTSUPP))
+	assert.True(t, isReflinkNotSupported(syscall.EXDEV))
+	assert.False(t, isReflinkNotSupported(syscall.EIO))
+}
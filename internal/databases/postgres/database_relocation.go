@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// DatabaseRelocation redirects the files of the databases from the default tablespace directory
+// base/<database_oid> to the alternate directories. The database directory of the restored cluster
+// becomes the symlink to the alternate one, so the file paths derived from the catalog stay valid
+// and no catalog changes are required. The database files stored in the other tablespaces are not relocated.
+type DatabaseRelocation struct {
+	// targets are the alternate directories by the database OIDs
+	targets map[string]string
+
+	mutex        sync.Mutex
+	createdLinks map[string]bool
+}
+
+// NewDatabaseRelocation validates the alternate directories: they must be the existing empty directories
+func NewDatabaseRelocation(targets map[string]string) (*DatabaseRelocation, error) {
+	relocation := &DatabaseRelocation{targets: make(map[string]string, len(targets)),
+		createdLinks: make(map[string]bool)}
+	usedTargets := make(map[string]string, len(targets))
+	for databaseOid, target := range targets {
+		if _, err := strconv.ParseUint(databaseOid, 10, 32); err != nil {
+			return nil, errors.Errorf("invalid database OID '%s' in the relocation mapping", databaseOid)
+		}
+		if !filepath.IsAbs(target) {
+			return nil, errors.Errorf("relocation target '%s' of database %s must be an absolute path", target, databaseOid)
+		}
+		target = filepath.Clean(target)
+		if otherOid, ok := usedTargets[target]; ok {
+			return nil, errors.Errorf("databases %s and %s are relocated to the same directory '%s'",
+				otherOid, databaseOid, target)
+		}
+		usedTargets[target] = databaseOid
+		err := checkRelocationTarget(target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid relocation target of database %s", databaseOid)
+		}
+		relocation.targets[databaseOid] = target
+	}
+	return relocation, nil
+}
+
+func checkRelocationTarget(target string) error {
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.Errorf("'%s' is not a directory", target)
+	}
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return errors.Errorf("directory '%s' is not empty", target)
+	}
+	return nil
+}
+
+// getRelocatedDatabaseOid returns the OID of the relocated database the archive file belongs to, if any
+func (relocation *DatabaseRelocation) getRelocatedDatabaseOid(fileName string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(fileName, "/"), "/")
+	if len(parts) < 2 || parts[0] != DefaultTablespace {
+		return "", false
+	}
+	_, ok := relocation.targets[parts[1]]
+	return parts[1], ok
+}
+
+// prepare links the database directory to its alternate directory before the first file of the database
+// is written. The restored database directory which exists already, e.g. restored by the base backup
+// of the delta, is left as is.
+func (relocation *DatabaseRelocation) prepare(dbDataDirectory, fileName string) error {
+	databaseOid, ok := relocation.getRelocatedDatabaseOid(fileName)
+	if !ok {
+		return nil
+	}
+	relocation.mutex.Lock()
+	defer relocation.mutex.Unlock()
+	if relocation.createdLinks[databaseOid] {
+		return nil
+	}
+	linkPath := path.Join(dbDataDirectory, DefaultTablespace, databaseOid)
+	if _, err := os.Lstat(linkPath); err == nil {
+		relocation.createdLinks[databaseOid] = true
+		return nil
+	}
+	err := os.MkdirAll(path.Join(dbDataDirectory, DefaultTablespace), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create the '%s' directory", DefaultTablespace)
+	}
+	err = os.Symlink(relocation.targets[databaseOid], linkPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to relocate database %s", databaseOid)
+	}
+	tracelog.InfoLogger.Printf("Database %s is relocated to '%s'\n", databaseOid, relocation.targets[databaseOid])
+	relocation.createdLinks[databaseOid] = true
+	return nil
+}
@@ -0,0 +1,71 @@
+package postgres_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func TestDatabaseRelocation_RestoresToAlternateDirectory(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	target := t.TempDir()
+	relocation, err := postgres.NewDatabaseRelocation(map[string]string{"16384": target})
+	require.NoError(t, err)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithDatabaseRelocation(relocation))
+
+	require.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{}, &tar.Header{
+		Name: "/base/16384", Typeflag: tar.TypeDir, Mode: 0700}))
+	require.NoError(t, interpretTestFile(t, tarInterpreter, "/base/16384/1259"))
+	require.NoError(t, interpretTestFile(t, tarInterpreter, "/base/1/1259"))
+
+	linkTarget, err := os.Readlink(filepath.Join(dbDataDirectory, "base", "16384"))
+	require.NoError(t, err)
+	assert.Equal(t, target, linkTarget)
+	content, err := os.ReadFile(filepath.Join(target, "1259"))
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+	info, err := os.Lstat(filepath.Join(dbDataDirectory, "base", "1"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestDatabaseRelocation_KeepsRestoredDirectory(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dbDataDirectory, "base", "16384"), 0755))
+	relocation, err := postgres.NewDatabaseRelocation(map[string]string{"16384": t.TempDir()})
+	require.NoError(t, err)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithDatabaseRelocation(relocation))
+
+	require.NoError(t, interpretTestFile(t, tarInterpreter, "/base/16384/1259"))
+
+	_, err = os.Stat(filepath.Join(dbDataDirectory, "base", "16384", "1259"))
+	assert.NoError(t, err)
+}
+
+func TestNewDatabaseRelocation_ValidatesTargets(t *testing.T) {
+	nonEmpty := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(nonEmpty, "file"), nil, 0600))
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+	target := t.TempDir()
+
+	for name, targets := range map[string]map[string]string{
+		"non-empty":     {"16384": nonEmpty},
+		"missing":       {"16384": filepath.Join(target, "missing")},
+		"not directory": {"16384": file},
+		"relative":      {"16384": "relative/path"},
+		"invalid oid":   {"db": target},
+		"same target":   {"16384": target, "16390": target},
+	} {
+		_, err := postgres.NewDatabaseRelocation(targets)
+		assert.Error(t, err, name)
+	}
+}
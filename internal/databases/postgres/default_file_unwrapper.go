@@ -48,7 +48,14 @@ func (u *DefaultFileUnwrapper) UnwrapExistingFile(reader io.Reader, header *tar.
 	}
 
 	if u.options.isPageFile {
-		err := RestoreMissingPages(reader, targetReadWriterAt)
+		identical, err := u.isIdenticalToLocalFile(header, file)
+		if err != nil {
+			return nil, err
+		}
+		if identical {
+			return NewSkippedIdenticalResult(), nil
+		}
+		err = RestoreMissingPages(reader, targetReadWriterAt)
 		if err != nil {
 			return nil, errors.Wrapf(err, "Interpret: failed to restore pages for file '%s'", file.Name())
 		}
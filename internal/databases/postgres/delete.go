@@ -21,7 +21,7 @@ const (
 )
 
 func NewDeleteHandler(folder storage.Folder, permanentBackups, permanentWals map[string]bool,
-	useSentinelTime bool,
+	useSentinelTime bool, options ...internal.DeleteHandlerOption,
 ) (*DeleteHandler, error) {
 	backups, err := internal.GetBackupSentinelObjects(folder)
 	if err != nil {
@@ -47,14 +47,21 @@ func NewDeleteHandler(folder storage.Folder, permanentBackups, permanentWals map
 		return nil, err
 	}
 
+	// the trashed objects are moved back by backup-restore-deleted, which only PostgreSQL has
+	trash, err := internal.ConfigureDeleteTrash()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to configure the delete trash")
+	}
+	options = append([]internal.DeleteHandlerOption{
+		internal.IsPermanentFunc(makePermanentFunc(permanentBackups, permanentWals)),
+		internal.DeleteToTrash(trash)}, options...)
 	deleteHandler :=
 		&DeleteHandler{
 			*internal.NewDeleteHandler(
 				folder,
 				postgresBackups,
 				lessFunc,
-				internal.IsPermanentFunc(
-					makePermanentFunc(permanentBackups, permanentWals))),
+				options...),
 		}
 
 	return deleteHandler, nil
@@ -207,7 +214,12 @@ func getIncrementInfo(folder storage.Folder, object storage.Object) (string, str
 
 // HandleDeleteGarbage delete outdated WAL archives and leftover backup files
 func (dh *DeleteHandler) HandleDeleteGarbage(args []string, folder storage.Folder, confirm bool) error {
-	predicate := ExtractDeleteGarbagePredicate(args)
+	return dh.deleteBeforeOldestNonPermanentBackup(folder, confirm, ExtractDeleteGarbagePredicate(args))
+}
+
+// deleteBeforeOldestNonPermanentBackup deletes the selected objects older than the oldest non-permanent backup
+func (dh *DeleteHandler) deleteBeforeOldestNonPermanentBackup(folder storage.Folder, confirm bool,
+	predicate func(storage.Object) bool) error {
 	oldestBackup, err := findOldestNonPermanentBackup(folder.GetSubFolder(utility.BaseBackupPath))
 	if err != nil {
 		if _, ok := err.(internal.NoBackupsFoundError); ok {
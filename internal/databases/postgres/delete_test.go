@@ -1,15 +1,23 @@
 package postgres_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/wal-g/wal-g/internal/databases/postgres"
 
 	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"github.com/wal-g/wal-g/test/mocks"
@@ -269,17 +277,172 @@ func TestDeleteBeforeTargetWithPermanentBackups(t *testing.T) {
 	// attempt delete
 	target := storage.NewLocalObject("", utility.TimeNowCrossPlatformLocal().Add(time.Duration(1*int(time.Minute))), 0)
 
-	permanentBackups, permanentWals := postgres.GetPermanentBackupsAndWals(folder)
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+	require.NoError(t, err)
 	isPermanent := makeTestPermanentFunc(permanentBackups, permanentWals)
 	deleteHandler := newTestDeleteHandler(folder, lessByTime, internal.IsPermanentFunc(isPermanent))
 
-	err := deleteHandler.DeleteBeforeTarget(TestPostgresBackupObject{target}, true)
+	err = deleteHandler.DeleteBeforeTarget(TestPostgresBackupObject{target}, true)
 	assert.NoError(t, err)
 
 	// verify expected permanent still exists
 	verifyThatExistBackupsAndWals(t, expectBackupExistAfterDelete, expectWalExistAfterDelete, folder)
 }
 
+func getTestDeleteTargets(t *testing.T, folder storage.Folder, backupNames ...string) []internal.BackupObject {
+	objects, err := getBackupObjects(folder)
+	assert.NoError(t, err)
+	targets := make([]internal.BackupObject, 0, len(backupNames))
+	for _, object := range objects {
+		for _, backupName := range backupNames {
+			if utility.StripRightmostBackupName(object.GetName()) == backupName {
+				targets = append(targets, TestPostgresBackupObject{object})
+			}
+		}
+	}
+	return targets
+}
+
+func getTestRemainingBackups(t *testing.T, folder storage.Folder) []string {
+	objects, err := getBackupObjects(folder)
+	assert.NoError(t, err)
+	backupNames := make([]string, 0, len(objects))
+	for _, object := range objects {
+		backupNames = append(backupNames, utility.StripRightmostBackupName(object.GetName()))
+	}
+	return backupNames
+}
+
+func TestDeleteTargets_ForbidsDeletingLastFullBackups(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	deleteHandler := newTestDeleteHandler(folder, lessByName)
+	targets := getTestDeleteTargets(t, folder, "base_000000010000000000000003", "base_000000010000000000000007")
+
+	err := deleteHandler.DeleteTargets(targets, true)
+
+	assert.IsType(t, utility.ForbiddenActionError{}, err)
+	assert.Contains(t, err.Error(), "[base_000000010000000000000003 base_000000010000000000000007]")
+	assert.Contains(t, err.Error(), "[base_000000010000000000000005_D_000000010000000000000003 "+
+		"base_000000010000000000000009_D_000000010000000000000007] would be orphaned")
+	assert.Len(t, getTestRemainingBackups(t, folder), 4)
+}
+
+func TestDeleteTargets_DeletesLastFullBackupsWithForce(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	deleteHandler := newTestDeleteHandler(folder, lessByName, internal.AllowDeleteLastFullBackup(true))
+	targets := getTestDeleteTargets(t, folder, "base_000000010000000000000003", "base_000000010000000000000007")
+
+	err := deleteHandler.DeleteTargets(targets, true)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"base_000000010000000000000005_D_000000010000000000000003",
+		"base_000000010000000000000009_D_000000010000000000000007",
+	}, getTestRemainingBackups(t, folder))
+}
+
+func TestDeleteTargets_DeletesFullBackupWhenOtherRemains(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	deleteHandler := newTestDeleteHandler(folder, lessByName)
+	targets := getTestDeleteTargets(t, folder,
+		"base_000000010000000000000003", "base_000000010000000000000005_D_000000010000000000000003")
+
+	err := deleteHandler.DeleteTargets(targets, true)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"base_000000010000000000000007",
+		"base_000000010000000000000009_D_000000010000000000000007",
+	}, getTestRemainingBackups(t, folder))
+}
+
+func TestDeleteTargets_RecordsMetrics(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	textfileDirectory := t.TempDir()
+	metrics := internal.NewPrometheusMetrics("delete", textfileDirectory, "", "wal-g")
+	deleteHandler := newTestDeleteHandler(folder, lessByName, internal.DeleteMetrics(metrics))
+	targets := getTestDeleteTargets(t, folder,
+		"base_000000010000000000000003", "base_000000010000000000000005_D_000000010000000000000003")
+
+	// the dry run deletes nothing and records nothing
+	assert.NoError(t, deleteHandler.DeleteTargets(targets, false))
+	assert.Empty(t, metrics.Format())
+
+	assert.NoError(t, deleteHandler.DeleteTargets(targets, true))
+	assert.Equal(t, float64(2), metrics.Value("deleted_backups"))
+	assert.Equal(t, float64(2), metrics.Value("deleted_objects"))
+	assert.Equal(t, float64(1), metrics.Value("success"))
+	textfile, err := os.ReadFile(filepath.Join(textfileDirectory, "walg_delete.prom"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(textfile), "walg_delete_deleted_backups 2\n")
+}
+
+func readTestDeleteEvents(t *testing.T, output *bytes.Buffer) map[string]internal.DeleteEvent {
+	events := make(map[string]internal.DeleteEvent)
+	decoder := json.NewDecoder(output)
+	for decoder.More() {
+		var event internal.DeleteEvent
+		require.NoError(t, decoder.Decode(&event))
+		events[event.Object] = event
+	}
+	return events
+}
+
+func TestDeleteBeforeTarget_LogsDeleteEvents(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	permanentSentinel := utility.BaseBackupPath + "base_000000010000000000000003" + utility.SentinelSuffix
+	deletedSentinel := utility.BaseBackupPath + "base_000000010000000000000005_D_000000010000000000000003" +
+		utility.SentinelSuffix
+	var output bytes.Buffer
+	deleteHandler, err := postgres.NewDeleteHandler(folder, map[string]bool{"base_000000010000000000000003": true},
+		map[string]bool{}, false, internal.DeleteEvents(internal.NewJSONDeleteEventLogger(&output)))
+	require.NoError(t, err)
+	target, err := deleteHandler.FindTargetByName("base_000000010000000000000007")
+	require.NoError(t, err)
+
+	require.NoError(t, deleteHandler.DeleteBeforeTarget(target, true))
+
+	events := readTestDeleteEvents(t, &output)
+	require.Len(t, events, 4)
+	permanentEvent := events[permanentSentinel]
+	assert.True(t, permanentEvent.Permanent)
+	assert.Equal(t, internal.DeleteEventActionKeep, permanentEvent.Action)
+	assert.Equal(t, "permanent", permanentEvent.Reason)
+	assert.False(t, permanentEvent.DryRun)
+	deletedEvent := events[deletedSentinel]
+	assert.False(t, deletedEvent.Permanent)
+	assert.Equal(t, internal.DeleteEventActionDelete, deletedEvent.Action)
+	assert.Equal(t, "older than the target backup base_000000010000000000000007", deletedEvent.Reason)
+	targetEvent := events[utility.BaseBackupPath+"base_000000010000000000000007"+utility.SentinelSuffix]
+	assert.Equal(t, internal.DeleteEventActionKeep, targetEvent.Action)
+	assert.ElementsMatch(t, []string{
+		"base_000000010000000000000003",
+		"base_000000010000000000000007",
+		"base_000000010000000000000009_D_000000010000000000000007",
+	}, getTestRemainingBackups(t, folder))
+}
+
+func TestDeleteTargets_LogsDryRunDeleteEvents(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	var output bytes.Buffer
+	deleteHandler := newTestDeleteHandler(folder, lessByName,
+		internal.DeleteEvents(internal.NewJSONDeleteEventLogger(&output)))
+	targets := getTestDeleteTargets(t, folder, "base_000000010000000000000009_D_000000010000000000000007")
+
+	require.NoError(t, deleteHandler.DeleteTargets(targets, false))
+
+	events := readTestDeleteEvents(t, &output)
+	require.Len(t, events, 4)
+	deletedEvent := events[utility.BaseBackupPath+"base_000000010000000000000009_D_000000010000000000000007"+
+		utility.SentinelSuffix]
+	assert.Equal(t, internal.DeleteEventActionDelete, deletedEvent.Action)
+	assert.True(t, deletedEvent.DryRun)
+	keptEvent := events[utility.BaseBackupPath+"base_000000010000000000000007"+utility.SentinelSuffix]
+	assert.Equal(t, internal.DeleteEventActionKeep, keptEvent.Action)
+	assert.Equal(t, "not a delete target", keptEvent.Reason)
+	assert.Len(t, getTestRemainingBackups(t, folder), 4)
+}
+
 func createMockFolderWithTime(t *testing.T, baseTime time.Time) *mocks.MockFolder {
 	baseNamePrefix := "base_"
 	deltaMark := "_D_"
@@ -379,3 +542,74 @@ func makeTestPermanentFunc(permanentBackups, permanentWals map[string]bool) func
 		return postgres.IsPermanent(object.GetName(), permanentBackups, permanentWals)
 	}
 }
+
+// failingDeleteFolder fails to delete the objects with the given base names
+type failingDeleteFolder struct {
+	storage.Folder
+	failingObjects map[string]bool
+}
+
+func (folder *failingDeleteFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return &failingDeleteFolder{folder.Folder.GetSubFolder(subFolderRelativePath), folder.failingObjects}
+}
+
+func (folder *failingDeleteFolder) DeleteObjects(objectRelativePaths []string) error {
+	for _, objectRelativePath := range objectRelativePaths {
+		if folder.failingObjects[path.Base(objectRelativePath)] {
+			return errors.New("injected delete failure")
+		}
+	}
+	return folder.Folder.DeleteObjects(objectRelativePaths)
+}
+
+func TestDeleteTargets_ReportsFailedObjects(t *testing.T) {
+	failedSentinel := "base_000000010000000000000005_D_000000010000000000000003" + utility.SentinelSuffix
+	folder := &failingDeleteFolder{testtools.CreateMockStorageFolderWithDeltaBackups(t), map[string]bool{failedSentinel: true}}
+	deleteHandler := newTestDeleteHandler(folder, lessByName, internal.DeleteConcurrency(4))
+	targets := getTestDeleteTargets(t, folder, "base_000000010000000000000005_D_000000010000000000000003",
+		"base_000000010000000000000009_D_000000010000000000000007")
+
+	err := deleteHandler.DeleteTargets(targets, true)
+
+	require.IsType(t, internal.DeleteObjectsError{}, err)
+	assert.Equal(t, []string{failedSentinel}, err.(internal.DeleteObjectsError).FailedObjects)
+	// the failure to delete one object does not stop the deletion of the others
+	assert.ElementsMatch(t, []string{
+		"base_000000010000000000000003",
+		"base_000000010000000000000005_D_000000010000000000000003",
+		"base_000000010000000000000007",
+	}, getTestRemainingBackups(t, folder))
+}
+
+// countingDeleteFolder records the number of the objects deleted by every DeleteObjects call
+type countingDeleteFolder struct {
+	storage.Folder
+	mutex      *sync.Mutex
+	batchSizes *[]int
+}
+
+func (folder countingDeleteFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return countingDeleteFolder{folder.Folder.GetSubFolder(subFolderRelativePath), folder.mutex, folder.batchSizes}
+}
+
+func (folder countingDeleteFolder) DeleteObjects(objectRelativePaths []string) error {
+	folder.mutex.Lock()
+	*folder.batchSizes = append(*folder.batchSizes, len(objectRelativePaths))
+	folder.mutex.Unlock()
+	return folder.Folder.DeleteObjects(objectRelativePaths)
+}
+
+func TestDeleteTargets_DeletesObjectsInOneBatch(t *testing.T) {
+	batchSizes := make([]int, 0)
+	folder := countingDeleteFolder{testtools.CreateMockStorageFolderWithDeltaBackups(t), &sync.Mutex{}, &batchSizes}
+	deleteHandler := newTestDeleteHandler(folder, lessByName, internal.DeleteConcurrency(4))
+	targets := getTestDeleteTargets(t, folder, "base_000000010000000000000005_D_000000010000000000000003",
+		"base_000000010000000000000009_D_000000010000000000000007")
+
+	require.NoError(t, deleteHandler.DeleteTargets(targets, true))
+
+	// both sentinels are deleted by one storage request
+	assert.Equal(t, []int{2}, batchSizes)
+	assert.ElementsMatch(t, []string{"base_000000010000000000000003", "base_000000010000000000000007"},
+		getTestRemainingBackups(t, folder))
+}
@@ -3,21 +3,36 @@ package postgres
 import (
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"github.com/wal-g/wal-g/utility"
 )
 
-func GetPermanentBackupsAndWals(folder storage.Folder) (map[string]bool, map[string]bool) {
+// TimelineSwitch is the switch from the parent timeline to the child one at the LSN, as recorded
+// in the .history file
+type TimelineSwitch struct {
+	ParentTimeline uint32
+	ChildTimeline  uint32
+	Lsn            uint64
+}
+
+// GetPermanentBackupsAndWals finds the permanent backups and the WAL segments required to restore them.
+// The failure to list the backups is returned, so delete does not treat the permanent backups as impermanent.
+func GetPermanentBackupsAndWals(folder storage.Folder) (map[string]bool, map[string]bool, error) {
 	tracelog.InfoLogger.Println("retrieving permanent objects")
 	backupTimes, err := internal.GetBackups(folder.GetSubFolder(utility.BaseBackupPath))
+	if _, ok := err.(internal.NoBackupsFoundError); ok {
+		return map[string]bool{}, map[string]bool{}, nil
+	}
 	if err != nil {
-		return map[string]bool{}, map[string]bool{}
+		return nil, nil, errors.Wrap(err, "failed to list the backups to find the permanent ones")
 	}
 
 	permanentBackups := map[string]bool{}
-	permanentWals := map[string]bool{}
+	metas := map[string]ExtendedMetadataDto{}
+	var firstTimeline uint32
 	for _, backupTime := range backupTimes {
 		backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupTime.BackupName)
 		meta, err := backup.FetchMeta()
@@ -33,20 +48,105 @@ func GetPermanentBackupsAndWals(folder storage.Folder) (map[string]bool, map[str
 					backupTime.BackupName, err.Error())
 				continue
 			}
-
-			startWalSegmentNo := newWalSegmentNo(meta.StartLsn - 1)
-			endWalSegmentNo := newWalSegmentNo(meta.FinishLsn - 1)
-			for walSegmentNo := startWalSegmentNo; walSegmentNo <= endWalSegmentNo; walSegmentNo = walSegmentNo.next() {
-				permanentWals[walSegmentNo.getFilename(timelineID)] = true
+			if firstTimeline == 0 || timelineID < firstTimeline {
+				firstTimeline = timelineID
 			}
+			metas[backupTime.BackupName] = meta
 			permanentBackups[backupTime.BackupName] = true
 		}
 	}
-	if len(permanentBackups) > 0 {
-		tracelog.InfoLogger.Printf("Found permanent objects: backups=%v, wals=%v\n",
-			permanentBackups, permanentWals)
+	if len(permanentBackups) == 0 {
+		return permanentBackups, map[string]bool{}, nil
+	}
+	switches := fetchTimelineSwitches(firstTimeline, folder.GetSubFolder(utility.WalPath))
+	permanentWals := GetPermanentWals(permanentBackups, metas, switches)
+	tracelog.InfoLogger.Printf("Found permanent objects: backups=%v, wals=%v\n",
+		permanentBackups, permanentWals)
+	return permanentBackups, permanentWals, nil
+}
+
+// GetPermanentWals returns the names of the WAL segments required to restore the permanent backups,
+// from the start to the finish LSN recorded in their metadata. If the timeline was switched while the backup
+// was taken, the segments past the switch are treated as permanent on the child timeline too.
+func GetPermanentWals(permanentBackups map[string]bool, metas map[string]ExtendedMetadataDto,
+	switches []TimelineSwitch) map[string]bool {
+	permanentWals := map[string]bool{}
+	for backupName := range permanentBackups {
+		meta, ok := metas[backupName]
+		if !ok {
+			tracelog.WarningLogger.Printf("backup %s has no metadata, its WAL is not treated as permanent\n", backupName)
+			continue
+		}
+		timelineID, err := ParseTimelineFromBackupName(backupName)
+		if err != nil {
+			tracelog.ErrorLogger.Printf("failed to parse backup timeline for backup %s with error %s, ignoring...",
+				backupName, err.Error())
+			continue
+		}
+		addRequiredWals(permanentWals, meta.StartLsn-1, meta.FinishLsn-1, timelineID, switches)
+	}
+	return permanentWals
+}
+
+// addRequiredWals adds the names of the segments holding the LSN range on the timeline, and on the child
+// timelines past the switches which happened within the range
+func addRequiredWals(wals map[string]bool, startLsn, finishLsn uint64, timeline uint32, switches []TimelineSwitch) {
+	endWalSegmentNo := newWalSegmentNo(finishLsn)
+	for walSegmentNo := newWalSegmentNo(startLsn); walSegmentNo <= endWalSegmentNo; walSegmentNo = walSegmentNo.next() {
+		wals[walSegmentNo.getFilename(timeline)] = true
+	}
+	for _, timelineSwitch := range switches {
+		if timelineSwitch.ParentTimeline == timeline && timelineSwitch.ChildTimeline > timeline &&
+			timelineSwitch.Lsn >= startLsn && timelineSwitch.Lsn <= finishLsn {
+			addRequiredWals(wals, timelineSwitch.Lsn, finishLsn, timelineSwitch.ChildTimeline, switches)
+		}
+	}
+}
+
+// LsnToWalSegmentName returns the name of the WAL segment holding the LSN on the timeline
+func LsnToWalSegmentName(lsn uint64, timeline uint32) string {
+	return newWalSegmentNo(lsn).getFilename(timeline)
+}
+
+// newTimelineSwitches returns the switches recorded in the .history file of the timeline
+func newTimelineSwitches(timeline uint32, historyRecords []*TimelineHistoryRecord) []TimelineSwitch {
+	switches := make([]TimelineSwitch, 0, len(historyRecords))
+	for i, record := range historyRecords {
+		childTimeline := timeline
+		if i+1 < len(historyRecords) {
+			childTimeline = historyRecords[i+1].timeline
+		}
+		switches = append(switches, TimelineSwitch{
+			ParentTimeline: record.timeline,
+			ChildTimeline:  childTimeline,
+			Lsn:            record.lsn,
+		})
+	}
+	return switches
+}
+
+// fetchTimelineSwitches reads the .history files of the timelines following the first one,
+// until the first missing one
+func fetchTimelineSwitches(firstTimeline uint32, walFolder storage.Folder) []TimelineSwitch {
+	switches := make([]TimelineSwitch, 0)
+	seen := make(map[TimelineSwitch]bool)
+	for timeline := firstTimeline + 1; ; timeline++ {
+		historyRecords, err := getTimeLineHistoryRecords(timeline, walFolder)
+		if _, ok := err.(HistoryFileNotFoundError); ok {
+			return switches
+		}
+		if err != nil {
+			tracelog.WarningLogger.Printf("failed to read the history of timeline %d, "+
+				"the later timeline switches are ignored: %v\n", timeline, err)
+			return switches
+		}
+		for _, timelineSwitch := range newTimelineSwitches(timeline, historyRecords) {
+			if !seen[timelineSwitch] {
+				seen[timelineSwitch] = true
+				switches = append(switches, timelineSwitch)
+			}
+		}
 	}
-	return permanentBackups, permanentWals
 }
 
 func IsPermanent(objectName string, permanentBackups, permanentWals map[string]bool) bool {
@@ -54,10 +154,5 @@ func IsPermanent(objectName string, permanentBackups, permanentWals map[string]b
 		wal := objectName[len(utility.WalPath) : len(utility.WalPath)+24]
 		return permanentWals[wal]
 	}
-	if strings.HasPrefix(objectName, utility.BaseBackupPath) {
-		backup := utility.StripLeftmostBackupName(objectName[len(utility.BaseBackupPath):])
-		return permanentBackups[backup]
-	}
-	// should not reach here, default to false
-	return false
+	return internal.IsPermanent(objectName, permanentBackups)
 }
@@ -0,0 +1,126 @@
+package postgres_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/test/mocks"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const permanentTestBackup = "base_000000010000000000000003"
+
+func makePermanentTestMeta(startLsn, finishLsn uint64) postgres.ExtendedMetadataDto {
+	return postgres.ExtendedMetadataDto{StartLsn: startLsn, FinishLsn: finishLsn, IsPermanent: true}
+}
+
+func TestLsnToWalSegmentName(t *testing.T) {
+	assert.Equal(t, "000000010000000000000005", postgres.LsnToWalSegmentName(5*postgres.WalSegmentSize+100, 1))
+	assert.Equal(t, "000000020000000100000000", postgres.LsnToWalSegmentName(0x100000000, 2))
+}
+
+func TestGetPermanentWals(t *testing.T) {
+	permanentBackups := map[string]bool{permanentTestBackup: true}
+	metas := map[string]postgres.ExtendedMetadataDto{
+		permanentTestBackup: makePermanentTestMeta(0x3000100, 0x5000100),
+	}
+
+	permanentWals := postgres.GetPermanentWals(permanentBackups, metas, nil)
+
+	assert.Equal(t, map[string]bool{
+		"000000010000000000000003": true,
+		"000000010000000000000004": true,
+		"000000010000000000000005": true,
+	}, permanentWals)
+}
+
+func TestGetPermanentWals_SpansTimeline(t *testing.T) {
+	permanentBackups := map[string]bool{permanentTestBackup: true}
+	metas := map[string]postgres.ExtendedMetadataDto{
+		permanentTestBackup: makePermanentTestMeta(0x3000100, 0x6000100),
+	}
+	switches := []postgres.TimelineSwitch{
+		{ParentTimeline: 1, ChildTimeline: 2, Lsn: 0x5000080},
+		// the switch past the finish of the backup does not matter
+		{ParentTimeline: 2, ChildTimeline: 3, Lsn: 0x7000000},
+	}
+
+	permanentWals := postgres.GetPermanentWals(permanentBackups, metas, switches)
+
+	assert.Equal(t, map[string]bool{
+		"000000010000000000000003": true,
+		"000000010000000000000004": true,
+		"000000010000000000000005": true,
+		"000000010000000000000006": true,
+		"000000020000000000000005": true,
+		"000000020000000000000006": true,
+	}, permanentWals)
+	assert.True(t, postgres.IsPermanent(utility.WalPath+"000000020000000000000006.lz4", permanentBackups, permanentWals))
+	assert.False(t, postgres.IsPermanent(utility.WalPath+"000000020000000000000007.lz4", permanentBackups, permanentWals))
+}
+
+func TestGetPermanentWals_NoMeta(t *testing.T) {
+	permanentBackups := map[string]bool{permanentTestBackup: true}
+
+	assert.Empty(t, postgres.GetPermanentWals(permanentBackups, map[string]postgres.ExtendedMetadataDto{}, nil))
+}
+
+func TestGetPermanentBackupsAndWals_SpansTimeline(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putTestSentinel(t, folder, permanentTestBackup, makeTestSentinel(0x3000100, "", "", 0))
+	metaBytes, err := json.Marshal(makePermanentTestMeta(0x3000100, 0x5000100))
+	require.NoError(t, err)
+	require.NoError(t, folder.GetSubFolder(utility.BaseBackupPath).
+		PutObject(permanentTestBackup+"/"+utility.MetadataFileName, strings.NewReader(string(metaBytes))))
+	putTestSentinel(t, folder, "base_000000020000000000000008", makeTestSentinel(0x8000100, "", "", 0))
+
+	historyContents := fmt.Sprintf("%d\t0/%X\tno recovery target specified\n", 1, 0x4000080)
+	historyName, historyFile, err := newTimelineHistoryFile(historyContents, 2)
+	require.NoError(t, err)
+	require.NoError(t, folder.GetSubFolder(utility.WalPath).PutObject(historyName, historyFile))
+
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]bool{permanentTestBackup: true}, permanentBackups)
+	assert.Equal(t, map[string]bool{
+		"000000010000000000000003": true,
+		"000000010000000000000004": true,
+		"000000010000000000000005": true,
+		"000000020000000000000004": true,
+		"000000020000000000000005": true,
+	}, permanentWals)
+}
+
+func TestGetPermanentBackupsAndWals_NoBackups(t *testing.T) {
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(testtools.MakeDefaultInMemoryStorageFolder())
+
+	assert.NoError(t, err)
+	assert.Empty(t, permanentBackups)
+	assert.Empty(t, permanentWals)
+}
+
+func TestGetPermanentBackupsAndWals_ReturnsListingError(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	folder := mocks.NewMockFolder(mockController)
+	baseBackupFolder := mocks.NewMockFolder(mockController)
+	folder.EXPECT().GetSubFolder(utility.BaseBackupPath).Return(baseBackupFolder)
+	listErr := errors.New("storage is unavailable")
+	baseBackupFolder.EXPECT().ListFolder().Return(nil, nil, listErr)
+
+	permanentBackups, permanentWals, err := postgres.GetPermanentBackupsAndWals(folder)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), listErr.Error())
+	assert.Nil(t, permanentBackups)
+	assert.Nil(t, permanentWals)
+}
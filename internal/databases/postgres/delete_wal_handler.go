@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// HandleDeleteWal deletes the WAL segments preceding the oldest non-permanent backup as "delete garbage ARCHIVES"
+// does, the backups themselves are never deleted. The segments modified within the minRetention period are kept.
+func (dh *DeleteHandler) HandleDeleteWal(folder storage.Folder, minRetention time.Duration, confirm bool) error {
+	isWal := storagePrefixFilter(utility.WalPath)
+	if minRetention <= 0 {
+		return dh.deleteBeforeOldestNonPermanentBackup(folder, confirm, isWal)
+	}
+	retentionStart := utility.TimeNowCrossPlatformUTC().Add(-minRetention)
+	return dh.deleteBeforeOldestNonPermanentBackup(folder, confirm, func(object storage.Object) bool {
+		return isWal(object) && object.GetLastModified().Before(retentionStart)
+	})
+}
@@ -0,0 +1,156 @@
+package postgres_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// putDeleteWalTestBackup puts the backup whose start is ordered by the start hour
+func putDeleteWalTestBackup(t *testing.T, folder storage.Folder, backupName string, startHour int, isPermanent bool) {
+	_, segmentNo, ok := postgres.TryFetchTimelineAndLogSegNo(backupName)
+	require.True(t, ok)
+	putTestSentinel(t, folder, backupName, makeTestSentinel(segmentNo<<24, "", "", 0))
+	startTime := time.Date(2024, 1, 1, startHour, 0, 0, 0, time.UTC)
+	metadata, err := json.Marshal(postgres.ExtendedMetadataDto{StartTime: startTime, FinishTime: startTime,
+		StartLsn: segmentNo << 24, IsPermanent: isPermanent})
+	require.NoError(t, err)
+	require.NoError(t, folder.GetSubFolder(utility.BaseBackupPath).
+		PutObject(backupName+"/"+utility.MetadataFileName, bytes.NewReader(metadata)))
+}
+
+func createDeleteWalTestFolder(t *testing.T, walNames ...string) storage.Folder {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	if len(walNames) == 0 {
+		walNames = []string{
+			"000000010000000000000001.lz4",
+			"000000010000000000000002.lz4",
+			"000000010000000000000003.lz4",
+			"000000010000000000000004.lz4",
+			"000000010000000000000005.lz4",
+			"000000010000000000000006.lz4",
+			"00000002.history.lz4",
+		}
+	}
+	for _, name := range walNames {
+		require.NoError(t, walFolder.PutObject(name, strings.NewReader("")))
+	}
+	return folder
+}
+
+func handleDeleteWal(t *testing.T, folder storage.Folder, permanentBackups, permanentWals map[string]bool,
+	minRetention time.Duration, confirm bool) {
+	deleteHandler, err := postgres.NewDeleteHandler(folder, permanentBackups, permanentWals, false)
+	require.NoError(t, err)
+	require.NoError(t, deleteHandler.HandleDeleteWal(folder, minRetention, confirm))
+}
+
+func getExistingWals(t *testing.T, folder storage.Folder) []string {
+	objects, _, err := folder.GetSubFolder(utility.WalPath).ListFolder()
+	require.NoError(t, err)
+	names := make([]string, 0, len(objects))
+	for _, object := range objects {
+		names = append(names, object.GetName())
+	}
+	return names
+}
+
+func TestHandleDeleteWal(t *testing.T) {
+	folder := createDeleteWalTestFolder(t)
+	putDeleteWalTestBackup(t, folder, "base_000000010000000000000002", 1, false)
+	putDeleteWalTestBackup(t, folder, "base_000000010000000000000005", 2, false)
+
+	handleDeleteWal(t, folder, map[string]bool{}, map[string]bool{}, 0, true)
+
+	assert.ElementsMatch(t, []string{
+		"000000010000000000000002.lz4",
+		"000000010000000000000003.lz4",
+		"000000010000000000000004.lz4",
+		"000000010000000000000005.lz4",
+		"000000010000000000000006.lz4",
+		"00000002.history.lz4",
+	}, getExistingWals(t, folder))
+	// the backups are kept
+	backup := postgres.NewBackup(folder.GetSubFolder(utility.BaseBackupPath), "base_000000010000000000000002")
+	_, err := backup.GetSentinel()
+	assert.NoError(t, err)
+}
+
+func TestHandleDeleteWal_PermanentBackup(t *testing.T) {
+	folder := createDeleteWalTestFolder(t)
+	putDeleteWalTestBackup(t, folder, "base_000000010000000000000002", 1, true)
+	putDeleteWalTestBackup(t, folder, "base_000000010000000000000005", 2, false)
+	permanentBackups := map[string]bool{"base_000000010000000000000002": true}
+	permanentWals := map[string]bool{"000000010000000000000002": true}
+
+	handleDeleteWal(t, folder, permanentBackups, permanentWals, 0, true)
+
+	assert.ElementsMatch(t, []string{
+		"000000010000000000000002.lz4",
+		"000000010000000000000005.lz4",
+		"000000010000000000000006.lz4",
+		"00000002.history.lz4",
+	}, getExistingWals(t, folder))
+}
+
+func TestHandleDeleteWal_ComparesTimelines(t *testing.T) {
+	folder := createDeleteWalTestFolder(t,
+		"000000010000000000000004.lz4",
+		"000000020000000000000002.lz4",
+		"000000020000000000000003.lz4",
+		"000000020000000000000004.lz4",
+		"00000002.history.lz4",
+	)
+	putDeleteWalTestBackup(t, folder, "base_000000020000000000000003", 1, false)
+
+	handleDeleteWal(t, folder, map[string]bool{}, map[string]bool{}, 0, true)
+
+	// the segment of the earlier timeline precedes the backup despite its greater number
+	assert.ElementsMatch(t, []string{
+		"000000020000000000000003.lz4",
+		"000000020000000000000004.lz4",
+		"00000002.history.lz4",
+	}, getExistingWals(t, folder))
+}
+
+func TestHandleDeleteWal_MinRetention(t *testing.T) {
+	folder := createDeleteWalTestFolder(t)
+	putDeleteWalTestBackup(t, folder, "base_000000010000000000000005", 1, false)
+
+	handleDeleteWal(t, folder, map[string]bool{}, map[string]bool{}, time.Hour, true)
+
+	assert.Len(t, getExistingWals(t, folder), 7)
+}
+
+func TestHandleDeleteWal_DryRun(t *testing.T) {
+	folder := createDeleteWalTestFolder(t)
+	putDeleteWalTestBackup(t, folder, "base_000000010000000000000005", 1, false)
+
+	handleDeleteWal(t, folder, map[string]bool{}, map[string]bool{}, 0, false)
+
+	assert.Len(t, getExistingWals(t, folder), 7)
+}
+
+func TestHandleDeleteWal_OnlyPermanentBackups(t *testing.T) {
+	folder := createDeleteWalTestFolder(t)
+	putDeleteWalTestBackup(t, folder, "base_000000010000000000000002", 1, true)
+	putDeleteWalTestBackup(t, folder, "base_000000010000000000000005", 2, true)
+	permanentBackups := map[string]bool{
+		"base_000000010000000000000002": true,
+		"base_000000010000000000000005": true,
+	}
+
+	handleDeleteWal(t, folder, permanentBackups, map[string]bool{}, 0, true)
+
+	assert.Len(t, getExistingWals(t, folder), 7)
+}
@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// PageCountMismatchError indicates that the local file does not match the state the increment was taken against,
+// so applying only the changed blocks of the increment would leave the file inconsistent
+type PageCountMismatchError struct {
+	error
+}
+
+func newPageCountMismatchError(fileName string, localPageCount, incrementPageCount, missingBlockNo int64) PageCountMismatchError {
+	return PageCountMismatchError{errors.Errorf(
+		"local file '%s' has %d pages, the increment expects %d pages, but block %d is not in the increment",
+		fileName, localPageCount, incrementPageCount, missingBlockNo)}
+}
+
+func (err PageCountMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// DeltaApplyFileUnwrapper applies only the changed blocks of the increments to the existing files
+// of the data directory, e.g. of the running replica catching up with catchup-fetch --delta-apply.
+// Every local file the increment is applied to is validated to match the page count the increment expects.
+type DeltaApplyFileUnwrapper struct {
+	BackupFileUnwrapper
+}
+
+func (u *DeltaApplyFileUnwrapper) UnwrapNewFile(reader io.Reader, header *tar.Header,
+	file *os.File, fsync bool) (*FileUnwrapResult, error) {
+	if u.options.isIncremented {
+		// the missing file is the empty one, so the increment has to contain all of its blocks
+		return applyIncrementToLocalFile(reader, file)
+	}
+	err := WriteLocalFile(reader, header, file, fsync)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompletedResult(), nil
+}
+
+func (u *DeltaApplyFileUnwrapper) UnwrapExistingFile(reader io.Reader, header *tar.Header,
+	file *os.File, fsync bool) (*FileUnwrapResult, error) {
+	if u.options.isIncremented {
+		return applyIncrementToLocalFile(reader, file)
+	}
+
+	identical, err := u.isIdenticalToLocalFile(header, file)
+	if err != nil {
+		return nil, err
+	}
+	if identical {
+		return NewSkippedIdenticalResult(), nil
+	}
+
+	// clear the local file because there is a newer version for it
+	err = clearLocalFile(file)
+	if err != nil {
+		return nil, err
+	}
+	err = WriteLocalFile(reader, header, file, fsync)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompletedResult(), nil
+}
+
+func applyIncrementToLocalFile(reader io.Reader, file *os.File) (*FileUnwrapResult, error) {
+	targetReadWriterAt, err := NewReadWriterAtFrom(file)
+	if err != nil {
+		return nil, err
+	}
+	restoredBlockCount, err := ApplyIncrementInPlace(reader, targetReadWriterAt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Interpret: failed to apply increment to file '%s'", file.Name())
+	}
+	return NewWroteIncrementBlocksResult(restoredBlockCount), nil
+}
+
+// ApplyIncrementInPlace overwrites the blocks of the local file with the changed blocks of the increment.
+// Before any block is written, the local file is checked to consist of the whole pages and every page
+// the file lacks up to the size the increment expects to be in the increment, otherwise PageCountMismatchError
+// is returned. The file longer than the increment expects is truncated, since the relation was truncated since.
+func ApplyIncrementInPlace(increment io.Reader, target ReadWriterAt) (int64, error) {
+	tracelog.DebugLogger.Printf("Applying increment in place: %s\n", target.Name())
+
+	fileSize, diffBlockCount, diffMap, err := GetIncrementHeaderFields(increment)
+	if err != nil {
+		return 0, err
+	}
+	if target.Size()%DatabasePageSize != 0 {
+		return 0, errors.Errorf("local file '%s' size %d is not a multiple of the page size %d",
+			target.Name(), target.Size(), DatabasePageSize)
+	}
+	localPageCount := target.Size() / DatabasePageSize
+	incrementPageCount := int64(fileSize / uint64(DatabasePageSize))
+
+	deltaBlockNumbers := make(map[int64]bool, diffBlockCount)
+	for i := uint32(0); i < diffBlockCount; i++ {
+		blockNo := binary.LittleEndian.Uint32(diffMap[i*sizeofInt32 : (i+1)*sizeofInt32])
+		deltaBlockNumbers[int64(blockNo)] = true
+	}
+	for blockNo := localPageCount; blockNo < incrementPageCount; blockNo++ {
+		if !deltaBlockNumbers[blockNo] {
+			return 0, newPageCountMismatchError(target.Name(), localPageCount, incrementPageCount, blockNo)
+		}
+	}
+	if localPageCount > incrementPageCount {
+		sizeTarget, ok := target.(truncater)
+		if !ok {
+			return 0, errors.Errorf("local file '%s' has %d pages, the increment expects %d pages and it can't be truncated",
+				target.Name(), localPageCount, incrementPageCount)
+		}
+		if err = sizeTarget.Truncate(incrementPageCount * DatabasePageSize); err != nil {
+			return 0, err
+		}
+	}
+
+	restoredBlockCount := int64(0)
+	for i := uint32(0); i < diffBlockCount; i++ {
+		blockNo := int64(binary.LittleEndian.Uint32(diffMap[i*sizeofInt32 : (i+1)*sizeofInt32]))
+		if blockNo >= incrementPageCount {
+			_, err := io.CopyN(io.Discard, increment, DatabasePageSize)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if _, err = writePage(target, blockNo, increment, true); err != nil {
+			return 0, err
+		}
+		restoredBlockCount++
+	}
+	// at this point, we should have empty increment reader
+	if isEmpty := isTarReaderEmpty(increment); !isEmpty {
+		return 0, newUnexpectedTarDataError()
+	}
+	return restoredBlockCount, nil
+}
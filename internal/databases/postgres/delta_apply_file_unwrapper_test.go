@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openDeltaApplyTestFile(t *testing.T, content string) *os.File {
+	filePath := filepath.Join(t.TempDir(), "16384")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0600)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = file.Close() })
+	return file
+}
+
+func readDeltaApplyTestFile(t *testing.T, file *os.File) string {
+	content, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestApplyIncrementInPlace_MatchingPageCount(t *testing.T) {
+	file := openDeltaApplyTestFile(t, strings.Repeat(makeDiffTestPage('a'), 3))
+	target, err := NewReadWriterAtFrom(file)
+	require.NoError(t, err)
+	// the file grew by the last page since the base, so the new page is in the increment
+	increment := makeDiffTestIncrement(uint64(4*DatabasePageSize),
+		map[uint32]string{1: makeDiffTestPage('b'), 3: makeDiffTestPage('c')})
+
+	restoredBlockCount, err := ApplyIncrementInPlace(strings.NewReader(increment), target)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), restoredBlockCount)
+	assert.Equal(t, makeDiffTestPage('a')+makeDiffTestPage('b')+makeDiffTestPage('a')+makeDiffTestPage('c'),
+		readDeltaApplyTestFile(t, file))
+}
+
+func TestApplyIncrementInPlace_MismatchingPageCount(t *testing.T) {
+	content := strings.Repeat(makeDiffTestPage('a'), 2)
+	file := openDeltaApplyTestFile(t, content)
+	target, err := NewReadWriterAtFrom(file)
+	require.NoError(t, err)
+	// the local file lacks the block 2, which is not in the increment
+	increment := makeDiffTestIncrement(uint64(4*DatabasePageSize),
+		map[uint32]string{1: makeDiffTestPage('b'), 3: makeDiffTestPage('c')})
+
+	_, err = ApplyIncrementInPlace(strings.NewReader(increment), target)
+
+	assert.IsType(t, PageCountMismatchError{}, err)
+	// no block is written to the mismatching file
+	assert.Equal(t, content, readDeltaApplyTestFile(t, file))
+}
+
+func TestApplyIncrementInPlace_TruncatesLongerFile(t *testing.T) {
+	file := openDeltaApplyTestFile(t, strings.Repeat(makeDiffTestPage('a'), 4))
+	target, err := NewReadWriterAtFrom(file)
+	require.NoError(t, err)
+	increment := makeDiffTestIncrement(uint64(2*DatabasePageSize), map[uint32]string{0: makeDiffTestPage('b')})
+
+	_, err = ApplyIncrementInPlace(strings.NewReader(increment), target)
+
+	require.NoError(t, err)
+	assert.Equal(t, makeDiffTestPage('b')+makeDiffTestPage('a'), readDeltaApplyTestFile(t, file))
+}
+
+func TestApplyIncrementInPlace_PartialPageFile(t *testing.T) {
+	file := openDeltaApplyTestFile(t, makeDiffTestPage('a')+"partial")
+	target, err := NewReadWriterAtFrom(file)
+	require.NoError(t, err)
+	increment := makeDiffTestIncrement(uint64(DatabasePageSize), map[uint32]string{0: makeDiffTestPage('b')})
+
+	_, err = ApplyIncrementInPlace(strings.NewReader(increment), target)
+
+	assert.Error(t, err)
+}
+
+func TestDeltaApplyFileUnwrapper_NewIncrementedFile(t *testing.T) {
+	unwrapper := NewFileUnwrapper(DeltaApplyBackupFileUnwrapper, &BackupFileOptions{isIncremented: true})
+	header := &tar.Header{Name: "/base/1/16384"}
+
+	// the increment of the file created since the base contains all of its blocks
+	file := openDeltaApplyTestFile(t, "")
+	increment := makeDiffTestIncrement(uint64(2*DatabasePageSize),
+		map[uint32]string{0: makeDiffTestPage('a'), 1: makeDiffTestPage('b')})
+	result, err := unwrapper.UnwrapNewFile(strings.NewReader(increment), header, file, false)
+	require.NoError(t, err)
+	assert.Equal(t, WroteIncrementBlocks, result.FileUnwrapResultType)
+	assert.Equal(t, makeDiffTestPage('a')+makeDiffTestPage('b'), readDeltaApplyTestFile(t, file))
+
+	// the one with the unchanged blocks does not match the missing file
+	file = openDeltaApplyTestFile(t, "")
+	increment = makeDiffTestIncrement(uint64(2*DatabasePageSize), map[uint32]string{1: makeDiffTestPage('b')})
+	_, err = unwrapper.UnwrapNewFile(strings.NewReader(increment), header, file, false)
+	assert.IsType(t, PageCountMismatchError{}, errors.Cause(err))
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package postgres
+
+import (
+	"os"
+	"syscall"
+)
+
+// getDeviceID returns the ID of the device containing the file
+func getDeviceID(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package postgres
+
+import "os"
+
+// getDeviceID returns the ID of the device containing the file, device detection is not supported on Windows
+func getDeviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
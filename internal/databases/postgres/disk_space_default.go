@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package postgres
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// getAvailableDiskSpace returns the number of bytes available to the unprivileged user
+// on the filesystem containing the path
+func getAvailableDiskSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get the filesystem statistics of '%s'", path)
+	}
+	return int64(uint64(stat.Bavail) * uint64(stat.Bsize)), nil
+}
+
+// getFilesystemInodes returns the total and free number of inodes on the filesystem containing the path.
+// The total number is zero if the filesystem allocates inodes dynamically.
+func getFilesystemInodes(path string) (total, free uint64, err error) {
+	var stat syscall.Statfs_t
+	err = syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to get the filesystem statistics of '%s'", path)
+	}
+	return uint64(stat.Files), uint64(stat.Ffree), nil
+}
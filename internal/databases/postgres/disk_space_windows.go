@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package postgres
+
+import "github.com/pkg/errors"
+
+// getAvailableDiskSpace returns the number of bytes available on the filesystem containing the path,
+// it is not supported on Windows
+func getAvailableDiskSpace(path string) (int64, error) {
+	return 0, errors.New("detecting the available disk space is not supported on Windows")
+}
+
+// getFilesystemInodes returns the total and free number of inodes on the filesystem containing the path,
+// it is not supported on Windows
+func getFilesystemInodes(path string) (total, free uint64, err error) {
+	return 0, 0, errors.New("detecting the free inodes is not supported on Windows")
+}
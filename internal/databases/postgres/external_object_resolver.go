@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	externalObjectFetchRetries = 3
+	minExternalObjectRetryWait = time.Second
+	maxExternalObjectRetryWait = 30 * time.Second
+)
+
+type ExternalObjectFetchError struct {
+	error
+}
+
+func newExternalObjectFetchError(fileName string, ref internal.ExternalObjectRef, err error) ExternalObjectFetchError {
+	return ExternalObjectFetchError{errors.Wrapf(err,
+		"failed to restore '%s' from the external object '%s'", fileName, ref.Path)}
+}
+
+func (err ExternalObjectFetchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// ExternalObjectResolver restores the backup files which content is stored in the separate objects
+// referenced from the files metadata instead of the backup tars
+type ExternalObjectResolver struct {
+	backupFolder storage.Folder
+	crypter      crypto.Crypter
+	retries      int
+	sleeper      internal.Sleeper
+}
+
+func NewExternalObjectResolver(backupFolder storage.Folder, crypter crypto.Crypter) *ExternalObjectResolver {
+	return &ExternalObjectResolver{
+		backupFolder: backupFolder,
+		crypter:      crypter,
+		retries:      externalObjectFetchRetries,
+		sleeper:      internal.NewExponentialSleeper(minExternalObjectRetryWait, maxExternalObjectRetryWait),
+	}
+}
+
+// hasExternalObjects checks if any of the backup files is stored in an external object
+func hasExternalObjects(filesMeta FilesMetadataDto) bool {
+	for _, description := range filesMeta.Files {
+		if description.ExternalObject != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveAll restores all the externally stored files of the backup via the interpreter
+func (resolver *ExternalObjectResolver) ResolveAll(tarInterpreter *FileTarInterpreter) error {
+	fileNames := make([]string, 0)
+	for fileName, description := range tarInterpreter.FilesMetadata.Files {
+		if description.ExternalObject != nil && !tarInterpreter.isRestoredBefore(fileName) {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	sort.Strings(fileNames)
+
+	for _, fileName := range fileNames {
+		err := resolver.Resolve(tarInterpreter, fileName, *tarInterpreter.FilesMetadata.Files[fileName].ExternalObject)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve fetches the external object and restores it as the file with the given archive name.
+// The failed attempts are retried only if the file did not exist before the restore,
+// so the partially written file can be safely removed.
+func (resolver *ExternalObjectResolver) Resolve(tarInterpreter *FileTarInterpreter,
+	fileName string, ref internal.ExternalObjectRef) error {
+	targetPath := path.Join(tarInterpreter.DBDataDirectory, fileName)
+	_, statErr := os.Lstat(targetPath)
+	canRetry := os.IsNotExist(statErr)
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = resolver.fetch(tarInterpreter, fileName, ref)
+		if err == nil {
+			tracelog.DebugLogger.Printf("Restored '%s' from the external object '%s'\n", fileName, ref.Path)
+			return nil
+		}
+		if !canRetry || attempt >= resolver.retries {
+			return newExternalObjectFetchError(fileName, ref, err)
+		}
+		tracelog.WarningLogger.Printf("Failed to restore '%s' from the external object '%s', will retry: %v\n",
+			fileName, ref.Path, err)
+		if removeErr := os.Remove(targetPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			return newExternalObjectFetchError(fileName, ref, removeErr)
+		}
+		resolver.sleeper.Sleep()
+	}
+}
+
+func (resolver *ExternalObjectResolver) fetch(tarInterpreter *FileTarInterpreter,
+	fileName string, ref internal.ExternalObjectRef) error {
+	objectReader, err := resolver.backupFolder.ReadObject(ref.Path)
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(objectReader, "")
+
+	var reader io.Reader = objectReader
+	if resolver.crypter != nil {
+		reader, err = resolver.crypter.Decrypt(reader)
+		if err != nil {
+			return errors.Wrap(err, "decrypt failed")
+		}
+	}
+	if decompressor := compression.FindDecompressor(utility.GetFileExtension(ref.Path)); decompressor != nil {
+		decompressedReader, err := decompressor.Decompress(reader)
+		if err != nil {
+			return errors.Wrap(err, "decompress failed")
+		}
+		defer utility.LoggedClose(decompressedReader, "")
+		reader = decompressedReader
+	}
+
+	return tarInterpreter.Interpret(reader, &tar.Header{
+		Name:     fileName,
+		Typeflag: tar.TypeReg,
+		Mode:     ref.Mode,
+		Size:     ref.Size,
+	})
+}
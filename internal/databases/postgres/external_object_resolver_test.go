@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+type failingReadFolder struct {
+	storage.Folder
+	failures int
+}
+
+func (folder *failingReadFolder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	if folder.failures > 0 {
+		folder.failures--
+		return nil, errors.New("temporary failure")
+	}
+	return folder.Folder.ReadObject(objectRelativePath)
+}
+
+func newTestExternalObjectInterpreter(t *testing.T, content []byte) (*FileTarInterpreter, *memory.Folder) {
+	backupFolder := memory.NewFolder("", memory.NewStorage())
+	require.NoError(t, backupFolder.PutObject("external/1259", bytes.NewReader(content)))
+	filesMeta := FilesMetadataDto{Files: internal.BackupFileList{
+		"/base/1/1259": {ExternalObject: &internal.ExternalObjectRef{
+			Path: "external/1259", Size: int64(len(content)), Mode: 0600}},
+		"/base/1/1260": {},
+	}}
+	return NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, filesMeta, nil, false), backupFolder
+}
+
+func TestExternalObjectResolver_ResolveAll(t *testing.T) {
+	content := []byte("large object content")
+	tarInterpreter, backupFolder := newTestExternalObjectInterpreter(t, content)
+	resolver := NewExternalObjectResolver(backupFolder, nil)
+
+	require.NoError(t, resolver.ResolveAll(tarInterpreter))
+
+	restored, err := os.ReadFile(path.Join(tarInterpreter.DBDataDirectory, "/base/1/1259"))
+	require.NoError(t, err)
+	assert.Equal(t, content, restored)
+	_, err = os.Stat(path.Join(tarInterpreter.DBDataDirectory, "/base/1/1260"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExternalObjectResolver_Retries(t *testing.T) {
+	content := []byte("large object content")
+	tarInterpreter, backupFolder := newTestExternalObjectInterpreter(t, content)
+	resolver := NewExternalObjectResolver(&failingReadFolder{Folder: backupFolder, failures: 2}, nil)
+	resolver.sleeper = nopSleeper{}
+
+	require.NoError(t, resolver.ResolveAll(tarInterpreter))
+
+	restored, err := os.ReadFile(path.Join(tarInterpreter.DBDataDirectory, "/base/1/1259"))
+	require.NoError(t, err)
+	assert.Equal(t, content, restored)
+}
+
+func TestExternalObjectResolver_RetriesExhausted(t *testing.T) {
+	tarInterpreter, backupFolder := newTestExternalObjectInterpreter(t, []byte("content"))
+	resolver := NewExternalObjectResolver(&failingReadFolder{Folder: backupFolder, failures: 10}, nil)
+	resolver.sleeper = nopSleeper{}
+
+	err := resolver.ResolveAll(tarInterpreter)
+
+	assert.IsType(t, ExternalObjectFetchError{}, err)
+}
+
+func TestHasExternalObjects(t *testing.T) {
+	assert.False(t, hasExternalObjects(FilesMetadataDto{Files: internal.BackupFileList{"/base/1/1259": {}}}))
+	assert.True(t, hasExternalObjects(FilesMetadataDto{Files: internal.BackupFileList{
+		"/base/1/1259": {ExternalObject: &internal.ExternalObjectRef{Path: "external/1259"}}}}))
+}
+
+func TestUnwrapOld_ExternalObjectsOnly(t *testing.T) {
+	content := []byte("large object content")
+	tarInterpreter, _ := newTestExternalObjectInterpreter(t, content)
+	baseBackupFolder := memory.NewFolder("", memory.NewStorage())
+	// the name of the backup made not by WAL-G, so no pg_control is required
+	backup := NewBackup(baseBackupFolder, "external_objects_backup")
+	require.NoError(t, baseBackupFolder.PutObject(backup.Name+"/external/1259", bytes.NewReader(content)))
+
+	// the backup has no tars, all its files are stored outside of them
+	err := backup.unwrapOld(tarInterpreter.DBDataDirectory, BackupSentinelDto{}, tarInterpreter.FilesMetadata, nil, false)
+
+	require.NoError(t, err)
+	restored, err := os.ReadFile(path.Join(tarInterpreter.DBDataDirectory, "/base/1/1259"))
+	require.NoError(t, err)
+	assert.Equal(t, content, restored)
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func NewFetchConfig(backupName, dbDataDirectory string, folder storage.Folder, spec *TablespaceSpec,
-	filesToUnwrap map[string]bool, skipRedundantTars bool) *FetchConfig {
+	filesToUnwrap map[string]bool, skipRedundantTars bool, interpreterOptions ...FileTarInterpreterOption) *FetchConfig {
 	fetchConfig := &FetchConfig{
 		filesToUnwrap:     filesToUnwrap,
 		missingBlocks:     make(map[string]int64),
@@ -15,6 +15,8 @@ func NewFetchConfig(backupName, dbDataDirectory string, folder storage.Folder, s
 		folder:            folder,
 		dbDataDirectory:   dbDataDirectory,
 		skipRedundantTars: skipRedundantTars,
+
+		interpreterOptions: interpreterOptions,
 	}
 	return fetchConfig
 }
@@ -28,12 +30,16 @@ type FetchConfig struct {
 	folder            storage.Folder
 	dbDataDirectory   string
 	skipRedundantTars bool
+	// interpreterOptions are passed to every FileTarInterpreter created during the fetch
+	interpreterOptions []FileTarInterpreterOption
 }
 
 func (fc *FetchConfig) SkipRedundantFiles(unwrapResult *UnwrapResult) {
 	fc.processCreatedPageFiles(unwrapResult.createdPageFiles)
 	fc.processWrittenIncrementFiles(unwrapResult.writtenIncrementFiles)
 	fc.excludeCompletedFiles(unwrapResult.completedFiles)
+	// the identical files have the content of the newer backup already
+	fc.excludeCompletedFiles(unwrapResult.identicalFiles)
 }
 
 func (fc *FetchConfig) excludeCompletedFile(filePath string) {
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"archive/tar"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// FileStreamInterpreter writes the content of the single backup file to the output, e.g. to pipe it
+// into another process, the entries of the other files are ignored. The file is selected by FilesToUnwrap.
+// The output can't be rewound, so the tars are to be interpreted sequentially, without the retries.
+type FileStreamInterpreter struct {
+	FilesToUnwrap map[string]bool
+
+	output     io.Writer
+	isStreamed bool
+}
+
+var _ BackupTarInterpreter = &FileStreamInterpreter{}
+
+func NewFileStreamInterpreter(fileName string, output io.Writer) *FileStreamInterpreter {
+	return &FileStreamInterpreter{FilesToUnwrap: map[string]bool{fileName: true}, output: output}
+}
+
+// SelectedFiles returns the backup file to stream, FilesToUnwrap
+func (interpreter *FileStreamInterpreter) SelectedFiles() map[string]bool {
+	return interpreter.FilesToUnwrap
+}
+
+func (interpreter *FileStreamInterpreter) Interpret(reader io.Reader, header *tar.Header) error {
+	if !isSelectedFile(interpreter, header.Name) {
+		return nil
+	}
+	if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+		return errors.Errorf("'%s' is not a regular file", header.Name)
+	}
+	if interpreter.isStreamed {
+		return errors.Errorf("'%s' is found in the backup tars more than once", header.Name)
+	}
+	interpreter.isStreamed = true
+	_, err := io.Copy(interpreter.output, reader)
+	return errors.Wrapf(err, "failed to stream '%s'", header.Name)
+}
+
+// IsStreamed returns whether the selected file is found in the interpreted tars and written to the output
+func (interpreter *FileStreamInterpreter) IsStreamed() bool {
+	return interpreter.isStreamed
+}
+
+// HandleBackupFetchFile writes the content of the single file of the backup to the output
+func HandleBackupFetchFile(folder storage.Folder, backupSelector internal.BackupSelector, fileName string, output io.Writer) {
+	backupName, err := backupSelector.Select(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupName)
+	err = StreamBackupFile(backup, fileName, output)
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch the backup file: %v\n", err)
+}
+
+// StreamBackupFile writes the content of the backup file named as in the backup tars, e.g. /PG_VERSION,
+// to the output. Only the tars containing the file by the files metadata are read. The file unchanged since
+// the base backup is streamed from the base backup, the incremented files can't be streamed.
+func StreamBackupFile(backup Backup, fileName string, output io.Writer) error {
+	fileName = "/" + strings.TrimPrefix(fileName, "/")
+	sentinelDto, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+	if err != nil {
+		return err
+	}
+	if description, ok := filesMeta.Files[fileName]; ok {
+		switch {
+		case description.IsSkipped && sentinelDto.IsIncremental():
+			tracelog.InfoLogger.Printf("'%s' is unchanged since '%s', it is fetched from there\n",
+				fileName, *sentinelDto.IncrementFrom)
+			return StreamBackupFile(NewBackup(backup.Folder, *sentinelDto.IncrementFrom), fileName, output)
+		case description.IsIncremented:
+			return errors.Errorf("'%s' is stored as the increment in backup '%s', "+
+				"the backup has to be restored to get its content", fileName, backup.Name)
+		case description.ExternalObject != nil:
+			return errors.Errorf("'%s' is stored outside of the tars of backup '%s'", fileName, backup.Name)
+		}
+	}
+
+	interpreter := NewFileStreamInterpreter(fileName, output)
+	stages, pgControlKey, err := backup.getTarsToExtract(filesMeta, interpreter.SelectedFiles(), true)
+	if err != nil {
+		return err
+	}
+	if pgControlKey != "" && fileName == PgControlPath {
+		stages = append(stages, []internal.ReaderMaker{
+			internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)})
+	}
+	crypter := internal.ConfigureCrypter()
+	for _, stage := range stages {
+		for _, readerMaker := range stage {
+			err = streamTar(interpreter, readerMaker, crypter)
+			if err != nil {
+				return errors.Wrapf(err, "failed to stream '%s'", readerMaker.Path())
+			}
+		}
+	}
+	if !interpreter.IsStreamed() {
+		return errors.Errorf("'%s' is not found in backup '%s'", fileName, backup.Name)
+	}
+	return nil
+}
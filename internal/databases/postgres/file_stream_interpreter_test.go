@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func interpretTestTar(t *testing.T, interpreter BackupTarInterpreter, entries ...testTarEntry) error {
+	var tarBuffer bytes.Buffer
+	writer := tar.NewWriter(&tarBuffer)
+	for _, entry := range entries {
+		require.NoError(t, writer.WriteHeader(&tar.Header{
+			Name: entry.name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(entry.content))}))
+		_, err := writer.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	tarReader := tar.NewReader(&tarBuffer)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		require.NoError(t, err)
+		if err = interpreter.Interpret(tarReader, header); err != nil {
+			return err
+		}
+	}
+}
+
+func TestFileStreamInterpreter_StreamsSelectedFile(t *testing.T) {
+	var output bytes.Buffer
+	interpreter := NewFileStreamInterpreter("/base/1/2", &output)
+
+	err := interpretTestTar(t, interpreter, testTarEntry{name: "/base/1/1", content: "first"},
+		testTarEntry{name: "/base/1/2", content: "second"}, testTarEntry{name: "/base/1/3", content: "third"})
+
+	require.NoError(t, err)
+	assert.True(t, interpreter.IsStreamed())
+	assert.Equal(t, "second", output.String())
+}
+
+func TestFileStreamInterpreter_MissingFile(t *testing.T) {
+	var output bytes.Buffer
+	interpreter := NewFileStreamInterpreter("/base/1/4", &output)
+
+	err := interpretTestTar(t, interpreter, testTarEntry{name: "/base/1/1", content: "first"})
+
+	require.NoError(t, err)
+	assert.False(t, interpreter.IsStreamed())
+	assert.Empty(t, output.String())
+}
+
+func TestStreamBackupFile(t *testing.T) {
+	folder := createTestStreamFolder(t)
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), testStreamBackupName)
+
+	var output bytes.Buffer
+	require.NoError(t, StreamBackupFile(backup, "base/1", &output))
+	assert.Equal(t, "relation", output.String())
+
+	output.Reset()
+	require.NoError(t, StreamBackupFile(backup, PgControlPath, &output))
+	assert.Equal(t, "control", output.String())
+
+	assert.Error(t, StreamBackupFile(backup, "/base/2", io.Discard))
+}
@@ -2,8 +2,13 @@ package postgres
 
 import (
 	"archive/tar"
+	"encoding/hex"
 	"io"
 	"os"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
 )
 
 type FileUnwrapperType int
@@ -12,6 +17,7 @@ type FileUnwrapResultType int
 const (
 	DefaultBackupFileUnwrapper FileUnwrapperType = iota + 1
 	CatchupBackupFileUnwrapper
+	DeltaApplyBackupFileUnwrapper
 )
 
 const (
@@ -19,6 +25,8 @@ const (
 	CreatedFromIncrement
 	WroteIncrementBlocks
 	Skipped
+	// SkippedIdentical means the existing file is identical to the backup one, so it is not rewritten
+	SkippedIdentical
 )
 
 func NewFileUnwrapper(unwrapperType FileUnwrapperType, options *BackupFileOptions) IBackupFileUnwrapper {
@@ -27,6 +35,8 @@ func NewFileUnwrapper(unwrapperType FileUnwrapperType, options *BackupFileOption
 		return &DefaultFileUnwrapper{BackupFileUnwrapper{options}}
 	case CatchupBackupFileUnwrapper:
 		return &CatchupFileUnwrapper{BackupFileUnwrapper{options}}
+	case DeltaApplyBackupFileUnwrapper:
+		return &DeltaApplyFileUnwrapper{BackupFileUnwrapper{options}}
 	default:
 		return &DefaultFileUnwrapper{BackupFileUnwrapper{options}}
 	}
@@ -53,9 +63,27 @@ func NewSkippedResult() *FileUnwrapResult {
 	return &FileUnwrapResult{Skipped, 0}
 }
 
+func NewSkippedIdenticalResult() *FileUnwrapResult {
+	return &FileUnwrapResult{SkippedIdentical, 0}
+}
+
 type BackupFileOptions struct {
 	isIncremented bool
 	isPageFile    bool
+	// checksum is the checksum of the file content recorded in the files metadata, if any
+	checksum *internal.FileChecksum
+	// reflinkBase, if set, is the base copy of the data directory the created page files are cloned from
+	reflinkBase *CatchupReflinkBase
+}
+
+// IsIncremented returns whether the tar entry is the increment of the file rather than its whole content
+func (options *BackupFileOptions) IsIncremented() bool {
+	return options.isIncremented
+}
+
+// IsPageFile returns whether the local file the entry is restored to consists of the database pages
+func (options *BackupFileOptions) IsPageFile() bool {
+	return options.isPageFile
 }
 
 type IBackupFileUnwrapper interface {
@@ -66,3 +94,28 @@ type IBackupFileUnwrapper interface {
 type BackupFileUnwrapper struct {
 	options *BackupFileOptions
 }
+
+// isIdenticalToLocalFile returns whether the existing local file has the size of the tar entry and the checksum
+// recorded for the backup file, so it doesn't need to be rewritten. The local file is only read, at the offsets
+// independent of the file position. The increments and the files without the recorded checksum are never identical.
+func (u *BackupFileUnwrapper) isIdenticalToLocalFile(header *tar.Header, file *os.File) (bool, error) {
+	if u.options.isIncremented || u.options.checksum == nil {
+		return false, nil
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if fileInfo.Size() != header.Size {
+		return false, nil
+	}
+	checksum, err := newFileChecksumHash(u.options.checksum.Algorithm)
+	if err != nil {
+		tracelog.DebugLogger.Printf("'%s' is not compared with the backup file: %v\n", file.Name(), err)
+		return false, nil
+	}
+	if _, err = io.Copy(checksum, io.NewSectionReader(file, 0, fileInfo.Size())); err != nil {
+		return false, errors.Wrapf(err, "failed to read '%s' to compare it with the backup file", file.Name())
+	}
+	return hex.EncodeToString(checksum.Sum(nil)) == u.options.checksum.Value, nil
+}
@@ -0,0 +1,40 @@
+package postgres
+
+import "sync"
+
+// FileUnwrapperPredicate checks whether the custom unwrapper handles the tar entry with the given name
+type FileUnwrapperPredicate func(name string) bool
+
+// FileUnwrapperFactory creates the custom unwrapper of the tar entry
+type FileUnwrapperFactory func(options *BackupFileOptions) IBackupFileUnwrapper
+
+type customFileUnwrapper struct {
+	predicate FileUnwrapperPredicate
+	factory   FileUnwrapperFactory
+}
+
+var (
+	customFileUnwrappersMutex sync.RWMutex
+	customFileUnwrappers      []customFileUnwrapper
+)
+
+// RegisterFileUnwrapper registers the unwrapper of the special files, e.g. of a custom compressed format.
+// The registered unwrappers are consulted before the default and catchup ones in the registration order,
+// the first one which predicate matches the tar entry name unwraps the entry.
+func RegisterFileUnwrapper(predicate FileUnwrapperPredicate, factory FileUnwrapperFactory) {
+	customFileUnwrappersMutex.Lock()
+	defer customFileUnwrappersMutex.Unlock()
+	customFileUnwrappers = append(customFileUnwrappers, customFileUnwrapper{predicate, factory})
+}
+
+// newCustomFileUnwrapper returns the registered unwrapper of the tar entry or nil if none matches it
+func newCustomFileUnwrapper(name string, options *BackupFileOptions) IBackupFileUnwrapper {
+	customFileUnwrappersMutex.RLock()
+	defer customFileUnwrappersMutex.RUnlock()
+	for _, unwrapper := range customFileUnwrappers {
+		if unwrapper.predicate(name) {
+			return unwrapper.factory(options)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedFileUnwrapper writes its name instead of the content of the tar entry
+type namedFileUnwrapper struct {
+	name    string
+	options *BackupFileOptions
+}
+
+func (unwrapper *namedFileUnwrapper) UnwrapNewFile(reader io.Reader, header *tar.Header,
+	file *os.File, fsync bool) (*FileUnwrapResult, error) {
+	_, err := file.WriteString(unwrapper.name)
+	return NewCompletedResult(), err
+}
+
+func (unwrapper *namedFileUnwrapper) UnwrapExistingFile(reader io.Reader, header *tar.Header,
+	file *os.File, fsync bool) (*FileUnwrapResult, error) {
+	return unwrapper.UnwrapNewFile(reader, header, file, fsync)
+}
+
+func registerNamedFileUnwrapper(name string, predicate FileUnwrapperPredicate) {
+	RegisterFileUnwrapper(predicate, func(options *BackupFileOptions) IBackupFileUnwrapper {
+		return &namedFileUnwrapper{name: name, options: options}
+	})
+}
+
+func resetCustomFileUnwrappers() {
+	customFileUnwrappersMutex.Lock()
+	defer customFileUnwrappersMutex.Unlock()
+	customFileUnwrappers = nil
+}
+
+func TestGetFileUnwrapper_DefaultWithoutCustomUnwrappers(t *testing.T) {
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	header := &tar.Header{Name: "/base/1/1259"}
+
+	assert.IsType(t, &DefaultFileUnwrapper{}, getFileUnwrapper(tarInterpreter, header, "/nonexistent"))
+	tarInterpreter = NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, FilesMetadataDto{}, nil, true)
+	assert.IsType(t, &CatchupFileUnwrapper{}, getFileUnwrapper(tarInterpreter, header, "/nonexistent"))
+	tarInterpreter = NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, FilesMetadataDto{}, nil, true,
+		WithFileUnwrapperType(DeltaApplyBackupFileUnwrapper))
+	assert.IsType(t, &DeltaApplyFileUnwrapper{}, getFileUnwrapper(tarInterpreter, header, "/nonexistent"))
+}
+
+func TestGetFileUnwrapper_CustomUnwrappersPrecedence(t *testing.T) {
+	defer resetCustomFileUnwrappers()
+	registerNamedFileUnwrapper("zst", func(name string) bool { return strings.HasSuffix(name, ".zst") })
+	registerNamedFileUnwrapper("custom", func(name string) bool { return strings.HasPrefix(name, "/custom/") })
+	registerNamedFileUnwrapper("shadowed", func(name string) bool { return strings.HasSuffix(name, ".zst") })
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, FilesMetadataDto{}, nil, true)
+	getName := func(name string) string {
+		unwrapper, ok := getFileUnwrapper(tarInterpreter, &tar.Header{Name: name}, "/nonexistent").(*namedFileUnwrapper)
+		if !ok {
+			return ""
+		}
+		return unwrapper.name
+	}
+
+	// the first registered matching unwrapper wins
+	assert.Equal(t, "zst", getName("/custom/file.zst"))
+	assert.Equal(t, "zst", getName("/base/1/file.zst"))
+	assert.Equal(t, "custom", getName("/custom/file"))
+	// the entries no custom unwrapper matches are unwrapped as before
+	assert.IsType(t, &CatchupFileUnwrapper{}, getFileUnwrapper(tarInterpreter, &tar.Header{Name: "/base/1/1259"}, "/nonexistent"))
+}
+
+func TestUnwrapRegularFileNew_UsesCustomUnwrapper(t *testing.T) {
+	defer resetCustomFileUnwrappers()
+	registerNamedFileUnwrapper("custom", func(name string) bool { return name == "/special" })
+	dataDir := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	targetPath := filepath.Join(dataDir, "special")
+
+	require.NoError(t, tarInterpreter.unwrapRegularFileNew(strings.NewReader("data"),
+		&tar.Header{Name: "/special", Typeflag: tar.TypeReg, Mode: 0600, Size: 4}, targetPath, false, nil))
+
+	content, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, "custom", string(content))
+}
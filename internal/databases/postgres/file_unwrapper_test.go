@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const identicalTestContent = "the content of the backup file"
+
+func makeIdenticalTestChecksum(t *testing.T, content string) *internal.FileChecksum {
+	checksum, err := newFileChecksumHash(internal.Crc32cChecksumAlgorithm)
+	require.NoError(t, err)
+	_, err = checksum.Write([]byte(content))
+	require.NoError(t, err)
+	return &internal.FileChecksum{Algorithm: internal.Crc32cChecksumAlgorithm, Value: hex.EncodeToString(checksum.Sum(nil))}
+}
+
+func unwrapIdenticalTestFile(t *testing.T, localContent string) (*FileUnwrapResult, string) {
+	unwrapper := NewFileUnwrapper(CatchupBackupFileUnwrapper,
+		&BackupFileOptions{checksum: makeIdenticalTestChecksum(t, identicalTestContent)})
+	header := &tar.Header{Name: "/base/1/16384", Size: int64(len(identicalTestContent))}
+	file := openDeltaApplyTestFile(t, localContent)
+
+	result, err := unwrapper.UnwrapExistingFile(strings.NewReader(identicalTestContent), header, file, false)
+
+	require.NoError(t, err)
+	return result, readDeltaApplyTestFile(t, file)
+}
+
+func TestUnwrapExistingFile_Identical(t *testing.T) {
+	result, content := unwrapIdenticalTestFile(t, identicalTestContent)
+
+	assert.Equal(t, SkippedIdentical, result.FileUnwrapResultType)
+	assert.Equal(t, identicalTestContent, content)
+}
+
+func TestUnwrapExistingFile_SizeDiffers(t *testing.T) {
+	result, content := unwrapIdenticalTestFile(t, identicalTestContent+" and more")
+
+	assert.Equal(t, Completed, result.FileUnwrapResultType)
+	assert.Equal(t, identicalTestContent, content)
+}
+
+func TestUnwrapExistingFile_ContentDiffers(t *testing.T) {
+	// the local file has the same size, but the different content
+	result, content := unwrapIdenticalTestFile(t, strings.ToUpper(identicalTestContent))
+
+	assert.Equal(t, Completed, result.FileUnwrapResultType)
+	assert.Equal(t, identicalTestContent, content)
+}
+
+func TestUnwrapExistingFile_NoChecksum(t *testing.T) {
+	unwrapper := NewFileUnwrapper(CatchupBackupFileUnwrapper, &BackupFileOptions{})
+	header := &tar.Header{Name: "/base/1/16384", Size: int64(len(identicalTestContent))}
+	file := openDeltaApplyTestFile(t, identicalTestContent)
+
+	result, err := unwrapper.UnwrapExistingFile(strings.NewReader(identicalTestContent), header, file, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, Completed, result.FileUnwrapResultType)
+}
+
+func TestAddFileUnwrapResult_CountsSkippedFilesDistinctly(t *testing.T) {
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+
+	tarInterpreter.AddFileUnwrapResult(NewSkippedResult(), "/base/1/1249")
+	tarInterpreter.AddFileUnwrapResult(NewSkippedIdenticalResult(), "/base/1/1259")
+	tarInterpreter.AddFileUnwrapResult(NewSkippedIdenticalResult(), "/base/1/16384")
+
+	totals := tarInterpreter.UnwrapResult.Totals()
+	assert.Equal(t, 1, totals.SkippedFiles)
+	assert.Equal(t, 2, totals.IdenticalFiles)
+	assert.Equal(t, 0, totals.CompletedFiles)
+	assert.Equal(t, []string{"/base/1/1259", "/base/1/16384"}, tarInterpreter.UnwrapResult.ToDto().IdenticalFiles)
+}
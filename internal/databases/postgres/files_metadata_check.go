@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// maxListedInconsistentFiles limits the number of the file names of every kind listed in the error message
+const maxListedInconsistentFiles = 20
+
+// FilesMetadataMismatchError indicates that the files metadata does not match the backup sentinel
+// or the file sets of the backup tars, so the restore would misclassify the files and corrupt them
+type FilesMetadataMismatchError struct {
+	error
+	// UnstoredFiles are described as stored in the tars, but are not listed in any tar file set
+	UnstoredFiles []string
+	// UnexpectedIncrements are described as the increments or as the skipped files of the full backup
+	UnexpectedIncrements []string
+}
+
+func newFilesMetadataMismatchError(backupName string, unstoredFiles, unexpectedIncrements []string) FilesMetadataMismatchError {
+	inconsistencies := make([]string, 0, 2)
+	if len(unstoredFiles) > 0 {
+		inconsistencies = append(inconsistencies, "not stored in any tar: "+listInconsistentFiles(unstoredFiles))
+	}
+	if len(unexpectedIncrements) > 0 {
+		inconsistencies = append(inconsistencies,
+			"incremented or skipped in the full backup: "+listInconsistentFiles(unexpectedIncrements))
+	}
+	return FilesMetadataMismatchError{
+		error: errors.Errorf("files metadata of backup '%s' does not match the backup, "+
+			"it may be corrupted or belong to another backup: %s", backupName, strings.Join(inconsistencies, "; ")),
+		UnstoredFiles:        unstoredFiles,
+		UnexpectedIncrements: unexpectedIncrements,
+	}
+}
+
+func (err FilesMetadataMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func listInconsistentFiles(fileNames []string) string {
+	if len(fileNames) <= maxListedInconsistentFiles {
+		return strings.Join(fileNames, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(fileNames[:maxListedInconsistentFiles], ", "),
+		len(fileNames)-maxListedInconsistentFiles)
+}
+
+// CheckFilesMetadata cross-checks the files metadata with the sentinel and the tar file sets before the restore:
+// the full backup can't have the incremented or the skipped files, and every file described as stored in the tars
+// has to be listed in some tar file set. The files listed in the tar file sets but not described are only warned
+// about, since these are the files removed while the backup was taken. The backups without the files metadata
+// or the tar file sets, e.g. the WAL-E ones, are not checked.
+func CheckFilesMetadata(backupName string, sentinel BackupSentinelDto, filesMetadata FilesMetadataDto) error {
+	if len(filesMetadata.Files) == 0 {
+		return nil
+	}
+
+	unexpectedIncrements := make([]string, 0)
+	if !sentinel.IsIncremental() {
+		for fileName, description := range filesMetadata.Files {
+			if description.IsIncremented || description.IsSkipped {
+				unexpectedIncrements = append(unexpectedIncrements, fileName)
+			}
+		}
+	}
+
+	unstoredFiles := make([]string, 0)
+	if len(filesMetadata.TarFileSets) > 0 {
+		storedFiles := make(map[string]bool)
+		for _, fileNames := range filesMetadata.TarFileSets {
+			for _, fileName := range fileNames {
+				storedFiles[fileName] = true
+			}
+		}
+		for fileName, description := range filesMetadata.Files {
+			if !description.IsSkipped && description.ExternalObject == nil &&
+				!UtilityFilePaths[fileName] && !storedFiles[fileName] {
+				unstoredFiles = append(unstoredFiles, fileName)
+			}
+		}
+		undescribedFiles := make([]string, 0)
+		for fileName := range storedFiles {
+			if _, ok := filesMetadata.Files[fileName]; !ok && !UtilityFilePaths[fileName] {
+				undescribedFiles = append(undescribedFiles, fileName)
+			}
+		}
+		if len(undescribedFiles) > 0 {
+			sort.Strings(undescribedFiles)
+			tracelog.WarningLogger.Printf("Files listed in the tars of backup '%s' are not described by its files metadata, "+
+				"they are restored as the whole files: %s\n", backupName, listInconsistentFiles(undescribedFiles))
+		}
+	}
+
+	if len(unstoredFiles) == 0 && len(unexpectedIncrements) == 0 {
+		return nil
+	}
+	sort.Strings(unstoredFiles)
+	sort.Strings(unexpectedIncrements)
+	return newFilesMetadataMismatchError(backupName, unstoredFiles, unexpectedIncrements)
+}
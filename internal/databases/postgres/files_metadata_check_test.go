@@ -0,0 +1,102 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func makeFilesMetadataCheckTestDto() postgres.FilesMetadataDto {
+	return postgres.FilesMetadataDto{
+		Files: internal.BackupFileList{
+			"/base":              {},
+			"/base/1/1249":       {},
+			"/base/1/16384":      {IsIncremented: true},
+			"/base/1/16385":      {IsSkipped: true},
+			"/global/pg_control": {},
+		},
+		TarFileSets: map[string][]string{
+			"part_1.tar.lz4": {"/base", "/base/1/1249"},
+			"part_2.tar.lz4": {"/base/1/16384"},
+		},
+	}
+}
+
+func makeFilesMetadataCheckTestSentinel() postgres.BackupSentinelDto {
+	return makeTestSentinel(0x4000028, "base_000000010000000000000002", "base_000000010000000000000002", 0x2000028)
+}
+
+func TestCheckFilesMetadata_Consistent(t *testing.T) {
+	err := postgres.CheckFilesMetadata("base_000000010000000000000004_D_000000010000000000000002",
+		makeFilesMetadataCheckTestSentinel(), makeFilesMetadataCheckTestDto())
+
+	assert.NoError(t, err)
+}
+
+func TestCheckFilesMetadata_UndescribedFilesAreTolerated(t *testing.T) {
+	// the files removed while the backup was taken are listed in the tar file sets only
+	filesMetadata := makeFilesMetadataCheckTestDto()
+	filesMetadata.TarFileSets["part_2.tar.lz4"] = append(filesMetadata.TarFileSets["part_2.tar.lz4"], "/base/1/16386")
+
+	err := postgres.CheckFilesMetadata("base_000000010000000000000004_D_000000010000000000000002",
+		makeFilesMetadataCheckTestSentinel(), filesMetadata)
+
+	assert.NoError(t, err)
+}
+
+func TestCheckFilesMetadata_UnstoredFiles(t *testing.T) {
+	filesMetadata := makeFilesMetadataCheckTestDto()
+	filesMetadata.Files["/base/1/2619"] = internal.BackupFileDescription{}
+	filesMetadata.Files["/base/1/2608"] = internal.BackupFileDescription{IsIncremented: true}
+
+	err := postgres.CheckFilesMetadata("base_000000010000000000000004_D_000000010000000000000002",
+		makeFilesMetadataCheckTestSentinel(), filesMetadata)
+
+	require.Error(t, err)
+	mismatchError, ok := err.(postgres.FilesMetadataMismatchError)
+	require.True(t, ok)
+	assert.Equal(t, []string{"/base/1/2608", "/base/1/2619"}, mismatchError.UnstoredFiles)
+	assert.Empty(t, mismatchError.UnexpectedIncrements)
+	assert.Contains(t, err.Error(), "/base/1/2608, /base/1/2619")
+}
+
+func TestCheckFilesMetadata_IncrementsInFullBackup(t *testing.T) {
+	err := postgres.CheckFilesMetadata("base_000000010000000000000004",
+		makeTestSentinel(0x4000028, "", "", 0), makeFilesMetadataCheckTestDto())
+
+	require.Error(t, err)
+	mismatchError, ok := err.(postgres.FilesMetadataMismatchError)
+	require.True(t, ok)
+	assert.Equal(t, []string{"/base/1/16384", "/base/1/16385"}, mismatchError.UnexpectedIncrements)
+	assert.Empty(t, mismatchError.UnstoredFiles)
+}
+
+func TestCheckFilesMetadata_WithoutTarFileSets(t *testing.T) {
+	// the unstored files can't be found without the tar file sets, e.g. of the backups taken by the older versions
+	filesMetadata := makeFilesMetadataCheckTestDto()
+	filesMetadata.TarFileSets = nil
+
+	err := postgres.CheckFilesMetadata("base_000000010000000000000004_D_000000010000000000000002",
+		makeFilesMetadataCheckTestSentinel(), filesMetadata)
+
+	assert.NoError(t, err)
+}
+
+func TestCheckFilesMetadata_ListsLimitedNumberOfFiles(t *testing.T) {
+	filesMetadata := postgres.FilesMetadataDto{
+		Files:       internal.BackupFileList{},
+		TarFileSets: map[string][]string{"part_1.tar.lz4": {}},
+	}
+	for i := 0; i < 25; i++ {
+		filesMetadata.Files[string(rune('a'+i))] = internal.BackupFileDescription{}
+	}
+
+	err := postgres.CheckFilesMetadata("base_000000010000000000000004", makeTestSentinel(0x4000028, "", "", 0), filesMetadata)
+
+	require.Error(t, err)
+	assert.Len(t, err.(postgres.FilesMetadataMismatchError).UnstoredFiles, 25)
+	assert.Contains(t, err.Error(), "and 5 more")
+}
@@ -165,3 +165,12 @@ func (pageReader *IncrementalPageReader) SelectNewValidPage(pageBytes []byte, bl
 	}
 	return
 }
+
+// incrementBlockCount returns the number of the pages stored in the increment of the specified size
+func incrementBlockCount(incrementSize int64) int64 {
+	headerSize := int64(len(IncrementFileHeader)) + sizeofInt64 + sizeofInt32
+	if incrementSize <= headerSize {
+		return 0
+	}
+	return (incrementSize - headerSize) / (sizeofInt32 + DatabasePageSize)
+}
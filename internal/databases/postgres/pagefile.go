@@ -200,7 +200,8 @@ func ApplyFileIncrement(fileName string, increment io.Reader, createNewIncrement
 		openFlags = openFlags | os.O_CREATE
 	}
 
-	file, err := os.OpenFile(fileName, openFlags, 0666)
+	// the created file is accessible by its owner only until the caller applies the stored mode
+	file, err := openRestoredFile(fileName, openFlags, 0600)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return errors.Wrap(err, "incremented file should always exist")
@@ -208,7 +209,7 @@ func ApplyFileIncrement(fileName string, increment io.Reader, createNewIncrement
 		return errors.Wrap(err, "can't open file to increment")
 	}
 	defer utility.LoggedClose(file, "")
-	defer utility.LoggedSync(file, "", fsync)
+	defer loggedSyncRestoredFile(file, fsync)
 
 	err = file.Truncate(int64(fileSize))
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/walparser/parsingutil"
 )
@@ -63,7 +64,8 @@ func RestoreMissingPages(base io.Reader, target ReadWriterAt) error {
 }
 
 // CreateFileFromIncrement writes the pages from the increment to local file
-// and write empty blocks in place of pages which are not present in the increment
+// and write empty blocks in place of pages which are not present in the increment.
+// If the sparse restore is enabled, the empty blocks are left as the holes of the truncated file instead.
 func CreateFileFromIncrement(increment io.Reader, target ReadWriterAt) (int64, error) {
 	tracelog.DebugLogger.Printf("Creating from increment: %s\n", target.Name())
 
@@ -71,6 +73,15 @@ func CreateFileFromIncrement(increment io.Reader, target ReadWriterAt) (int64, e
 	if err != nil {
 		return 0, err
 	}
+	pageCount := int64(fileSize / uint64(DatabasePageSize))
+	sparseTarget, isSparse := target.(truncater)
+	// the holes read as zeros only if the file is empty
+	isSparse = isSparse && target.Size() == 0 && isSparseRestoreEnabled()
+	if isSparse {
+		if err = sparseTarget.Truncate(pageCount * DatabasePageSize); err != nil {
+			return 0, err
+		}
+	}
 
 	// set represents all block numbers with non-empty pages
 	deltaBlockNumbers := make(map[int64]bool, diffBlockCount)
@@ -78,7 +89,6 @@ func CreateFileFromIncrement(increment io.Reader, target ReadWriterAt) (int64, e
 		blockNo := binary.LittleEndian.Uint32(diffMap[i*sizeofInt32 : (i+1)*sizeofInt32])
 		deltaBlockNumbers[int64(blockNo)] = true
 	}
-	pageCount := int64(fileSize / uint64(DatabasePageSize))
 	emptyPage := make([]byte, DatabasePageSize)
 	missingBlockCount := pageCount
 	for i := int64(0); i < pageCount; i++ {
@@ -88,7 +98,7 @@ func CreateFileFromIncrement(increment io.Reader, target ReadWriterAt) (int64, e
 				return 0, err
 			}
 			missingBlockCount--
-		} else {
+		} else if !isSparse {
 			_, err = target.WriteAt(emptyPage, i*DatabasePageSize)
 			if err != nil {
 				return 0, err
@@ -102,6 +112,49 @@ func CreateFileFromIncrement(increment io.Reader, target ReadWriterAt) (int64, e
 	return missingBlockCount, nil
 }
 
+// CreateFileFromIncrementOverBase writes the pages from the increment over the copy of the base file in the local file,
+// resized to the size recorded in the increment. The pages not present in the increment keep the base file content,
+// the pages beyond the end of the base file are left empty and counted as missing.
+func CreateFileFromIncrementOverBase(increment io.Reader, target ReadWriterAt) (int64, error) {
+	tracelog.DebugLogger.Printf("Creating from increment over base: %s\n", target.Name())
+
+	fileSize, diffBlockCount, diffMap, err := GetIncrementHeaderFields(increment)
+	if err != nil {
+		return 0, err
+	}
+	sizeTarget, ok := target.(truncater)
+	if !ok {
+		return 0, errors.Errorf("local file '%s' can't be resized to the size of the increment", target.Name())
+	}
+	basePageCount := target.Size() / DatabasePageSize
+	pageCount := int64(fileSize / uint64(DatabasePageSize))
+	if err = sizeTarget.Truncate(pageCount * DatabasePageSize); err != nil {
+		return 0, err
+	}
+
+	deltaBlockNumbers := make(map[int64]bool, diffBlockCount)
+	for i := uint32(0); i < diffBlockCount; i++ {
+		blockNo := binary.LittleEndian.Uint32(diffMap[i*sizeofInt32 : (i+1)*sizeofInt32])
+		deltaBlockNumbers[int64(blockNo)] = true
+	}
+	missingBlockCount := int64(0)
+	for i := int64(0); i < pageCount; i++ {
+		if deltaBlockNumbers[i] {
+			_, err = writePage(target, i, increment, true)
+			if err != nil {
+				return 0, err
+			}
+		} else if i >= basePageCount {
+			missingBlockCount++
+		}
+	}
+	// check if some extra delta blocks left in increment
+	if isEmpty := isTarReaderEmpty(increment); !isEmpty {
+		tracelog.DebugLogger.Printf("Skipping extra increment blocks, target: %s\n", target.Name())
+	}
+	return missingBlockCount, nil
+}
+
 // WritePagesFromIncrement writes pages from delta backup according to diffMap
 func WritePagesFromIncrement(increment io.Reader, target ReadWriterAt, overwriteExisting bool) (int64, error) {
 	tracelog.DebugLogger.Printf("Writing pages from increment: %s\n", target.Name())
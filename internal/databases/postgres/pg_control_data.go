@@ -15,9 +15,23 @@ const pgControlSize = 8192
 type PgControlData struct {
 	systemIdentifier uint64 // systemIdentifier represents system ID of PG cluster (f.e. [0-8] bytes in pg_control)
 	currentTimeline  uint32 // currentTimeline represents current timeline of PG cluster (f.e. [48-52] bytes in pg_control v. 1100+)
+	pgControlVersion uint32 // pgControlVersion represents PG_CONTROL_VERSION of PG cluster ([8-12] bytes in pg_control)
+	// dataChecksumVersion represents data_checksum_version of PG cluster, zero if the data checksums are disabled
+	dataChecksumVersion    uint32
+	hasDataChecksumVersion bool
 	// Any data from pg_control
 }
 
+// pgControlDataChecksumOffsets maps PG_CONTROL_VERSION to the offset of data_checksum_version in pg_control
+var pgControlDataChecksumOffsets = map[uint32]int{
+	960:  252,
+	1002: 252,
+	1100: 244,
+	1201: 252,
+	1300: 252,
+	1700: 252,
+}
+
 // ExtractPgControl extract pg_control data of cluster by storage
 func ExtractPgControl(folder string) (*PgControlData, error) {
 	pgControlReadCloser, err := os.Open(path.Join(folder, PgControlPath))
@@ -59,10 +73,16 @@ func extractPgControlData(pgControlReader io.Reader) (*PgControlData, error) {
 	}
 
 	// Parse bytes from pg_control file and share this data
-	return &PgControlData{
+	data := &PgControlData{
 		systemIdentifier: systemID,
 		currentTimeline:  currentTimeline,
-	}, nil
+		pgControlVersion: pgControlVersion,
+	}
+	if offset, ok := pgControlDataChecksumOffsets[pgControlVersion]; ok {
+		data.dataChecksumVersion = binary.LittleEndian.Uint32(bytes[offset : offset+4])
+		data.hasDataChecksumVersion = true
+	}
+	return data, nil
 }
 
 func (data *PgControlData) GetSystemIdentifier() uint64 {
@@ -72,3 +92,54 @@ func (data *PgControlData) GetSystemIdentifier() uint64 {
 func (data *PgControlData) GetCurrentTimeline() uint32 {
 	return data.currentTimeline
 }
+
+func (data *PgControlData) GetPgControlVersion() uint32 {
+	return data.pgControlVersion
+}
+
+// GetDataChecksumVersion returns data_checksum_version and false if its location in this pg_control version is unknown
+func (data *PgControlData) GetDataChecksumVersion() (uint32, bool) {
+	return data.dataChecksumVersion, data.hasDataChecksumVersion
+}
+
+// pgControlVersions maps the first PostgreSQL version (PG_VERSION_NUM) using some PG_CONTROL_VERSION to it
+var pgControlVersions = []struct {
+	minPgVersion     int
+	pgControlVersion uint32
+}{
+	{170000, 1700},
+	{130000, 1300},
+	{120000, 1201},
+	{110000, 1100},
+	{100000, 1002},
+	{90600, 960},
+	{90500, 942},
+	{90400, 937},
+}
+
+// GetExpectedPgControlVersion returns PG_CONTROL_VERSION used by the specified PostgreSQL version (PG_VERSION_NUM)
+func GetExpectedPgControlVersion(pgVersion int) (uint32, bool) {
+	for _, version := range pgControlVersions {
+		if pgVersion >= version.minPgVersion {
+			return version.pgControlVersion, true
+		}
+	}
+	return 0, false
+}
+
+// CheckPgControlVersion checks that the pg_control version matches the PostgreSQL version recorded in the sentinel
+// and warns on mismatch. Returns false if the versions do not match.
+func CheckPgControlVersion(data *PgControlData, pgVersion int) bool {
+	expectedVersion, ok := GetExpectedPgControlVersion(pgVersion)
+	if !ok {
+		tracelog.DebugLogger.Printf("Unknown pg_control version for PostgreSQL version %d, skipping the check\n", pgVersion)
+		return true
+	}
+	if data.pgControlVersion != expectedVersion {
+		tracelog.WarningLogger.Printf("pg_control version %d does not match PostgreSQL version %d "+
+			"recorded in the backup sentinel (expected pg_control version %d)\n",
+			data.pgControlVersion, pgVersion, expectedVersion)
+		return false
+	}
+	return true
+}
@@ -3,9 +3,15 @@ package postgres
 import (
 	bytes2 "bytes"
 	"encoding/binary"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/utility"
 )
 
 func TestExtractPgControlData_IncorrectPgControlSize(t *testing.T) {
@@ -53,3 +59,99 @@ func TestExtractPgControlData_NewVersion(t *testing.T) {
 	assert.Equal(t, uint64(9876), pgControlData.GetSystemIdentifier())
 	assert.Equal(t, uint32(7), pgControlData.GetCurrentTimeline())
 }
+
+func TestGetExpectedPgControlVersion(t *testing.T) {
+	version, ok := GetExpectedPgControlVersion(140005)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1300), version)
+
+	version, ok = GetExpectedPgControlVersion(120010)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1201), version)
+
+	version, ok = GetExpectedPgControlVersion(90624)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(960), version)
+
+	_, ok = GetExpectedPgControlVersion(90300)
+	assert.False(t, ok)
+}
+
+func TestCheckPgControlVersion(t *testing.T) {
+	pgControlData := &PgControlData{pgControlVersion: 1300}
+
+	assert.True(t, CheckPgControlVersion(pgControlData, 150002))
+	assert.False(t, CheckPgControlVersion(pgControlData, 110015))
+	assert.True(t, CheckPgControlVersion(pgControlData, 80400))
+}
+
+func TestExtractPgControlData_DataChecksumVersion(t *testing.T) {
+	bytes := make([]byte, pgControlSize)
+	binary.LittleEndian.PutUint32(bytes[8:12], 1100)
+	binary.LittleEndian.PutUint32(bytes[244:248], 1)
+
+	pgControlData, err := extractPgControlData(bytes2.NewReader(bytes))
+	assert.Nil(t, err)
+	checksumVersion, ok := pgControlData.GetDataChecksumVersion()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1), checksumVersion)
+
+	binary.LittleEndian.PutUint32(bytes[8:12], 1099)
+	pgControlData, err = extractPgControlData(bytes2.NewReader(bytes))
+	assert.Nil(t, err)
+	_, ok = pgControlData.GetDataChecksumVersion()
+	assert.False(t, ok)
+}
+
+func newPgControlTestBackup(t *testing.T, dataTar []byte) Backup {
+	pgControl := make([]byte, pgControlSize)
+	binary.LittleEndian.PutUint32(pgControl[8:12], 1300)
+	baseBackupFolder := memory.NewFolder("", memory.NewStorage()).GetSubFolder(utility.BaseBackupPath)
+	tarFolder := baseBackupFolder.GetSubFolder(testStreamBackupName + internal.TarPartitionFolderName)
+	require.NoError(t, tarFolder.PutObject("pg_control.tar.lz4", bytes2.NewReader(makeCompressedTestTar(t,
+		testTarEntry{name: PgControlPath, content: string(pgControl)}))))
+	require.NoError(t, tarFolder.PutObject("part_1.tar.lz4", bytes2.NewReader(dataTar)))
+	return NewBackup(baseBackupFolder, testStreamBackupName)
+}
+
+func TestReadPgControlData_BeforeExtraction(t *testing.T) {
+	backup := newPgControlTestBackup(t, makeCompressedTestTar(t, testTarEntry{name: "/PG_VERSION", content: "14\n"}))
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{PgVersion: 140005}, FilesMetadataDto{}, nil, false)
+
+	backup.readPgControlData(tarInterpreter, "pg_control.tar.lz4")
+
+	require.NotNil(t, tarInterpreter.GetPgControlData())
+	assert.Equal(t, uint32(1300), tarInterpreter.GetPgControlData().GetPgControlVersion())
+	// nothing is restored until the extraction
+	_, err := os.Stat(path.Join(tarInterpreter.DBDataDirectory, PgControlPath))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// pgControlVersionPlugin records the pg_control version known to the interpreter when each file is restored
+type pgControlVersionPlugin struct {
+	NopRestorePlugin
+	tarInterpreter *FileTarInterpreter
+	versions       map[string]uint32
+}
+
+func (plugin *pgControlVersionPlugin) OnFileComplete(info RestoreFileInfo) {
+	if data := plugin.tarInterpreter.GetPgControlData(); data != nil {
+		plugin.versions[info.Name] = data.GetPgControlVersion()
+	}
+}
+
+func TestUnwrap_ReadsPgControlDataBeforeDataTars(t *testing.T) {
+	backup := newPgControlTestBackup(t, makeCompressedTestTar(t, testTarEntry{name: "/PG_VERSION", content: "14\n"}))
+	plugin := &pgControlVersionPlugin{versions: make(map[string]uint32)}
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{PgVersion: 140005}, FilesMetadataDto{}, nil, false,
+		WithRestorePlugin(plugin))
+	plugin.tarInterpreter = tarInterpreter
+
+	err := backup.unwrapWithInterpreter(tarInterpreter)
+
+	require.NoError(t, err)
+	// the data files are restored knowing the version, pg_control is still restored
+	assert.Equal(t, map[string]uint32{"/PG_VERSION": 1300, PgControlPath: 1300}, plugin.versions)
+	_, err = os.Stat(path.Join(tarInterpreter.DBDataDirectory, PgControlPath))
+	assert.NoError(t, err)
+}
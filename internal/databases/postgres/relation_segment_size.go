@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+type RelationSegmentSizeError struct {
+	error
+}
+
+func newRelationSegmentSizeError(filePath string, size int64) RelationSegmentSizeError {
+	return RelationSegmentSizeError{errors.Errorf(
+		"restored relation segment '%s' has invalid size %d: it should be a multiple of %d and not exceed %d",
+		filePath, size, DatabasePageSize, RelFileSizeBound)}
+}
+
+func (err RelationSegmentSizeError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type relationSegment struct {
+	path   string
+	number int
+	size   int64
+}
+
+// ValidateRelationSegmentSizes checks that the restored relation files obey the PostgreSQL 1GB segmentation rules.
+// Every segment must be page-aligned and must not exceed RelFileSizeBound. Segments other than the last one
+// are normally exactly RelFileSizeBound long, but the relation may be extended while the backup is taken,
+// so a short non-final segment is only reported as a warning: WAL replay brings it to the full size.
+func ValidateRelationSegmentSizes(dbDataDirectory string) error {
+	segmentSizes, err := getRelationSegmentSizes(dbDataDirectory)
+	if err != nil {
+		return err
+	}
+	return checkRelationSegmentSizes(segmentSizes)
+}
+
+// getRelationSegmentSizes returns the sizes of the relation segments in the data directory and tablespaces
+// by their paths relative to the data directory
+func getRelationSegmentSizes(dbDataDirectory string) (map[string]int64, error) {
+	segmentSizes := make(map[string]int64)
+	err := collectRelationSegmentSizes(dbDataDirectory, "", segmentSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	tablespaceLinks, err := filepath.Glob(filepath.Join(dbDataDirectory, TablespaceFolder, "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range tablespaceLinks {
+		err = collectRelationSegmentSizes(utility.ResolveSymlink(link),
+			filepath.Join(TablespaceFolder, filepath.Base(link)), segmentSizes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return segmentSizes, nil
+}
+
+// collectRelationSegmentSizes walks the root and stores the sizes of relation segments
+// by their paths relative to the data directory, rootPrefix is the root location inside the data directory
+func collectRelationSegmentSizes(root, rootPrefix string, segmentSizes map[string]int64) error {
+	return filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrapf(err, "failed to walk '%s'", filePath)
+		}
+		if info.IsDir() || !info.Mode().IsRegular() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.Join(rootPrefix, relativePath)
+		if isRelationSegmentPath(relativePath) {
+			segmentSizes[relativePath] = info.Size()
+		}
+		return nil
+	})
+}
+
+func isRelationSegmentPath(filePath string) bool {
+	return (strings.HasPrefix(filePath, DefaultTablespace+"/") || strings.HasPrefix(filePath, NonDefaultTablespace+"/")) &&
+		pagedFilenameRegexp.MatchString(path.Base(filePath))
+}
+
+func checkRelationSegmentSizes(segmentSizes map[string]int64) error {
+	relations := make(map[string][]relationSegment)
+	for filePath, size := range segmentSizes {
+		segmentNo, err := GetRelFileIDFrom(filePath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse the segment number of '%s'", filePath)
+		}
+		match := pagedFilenameRegexp.FindStringSubmatch(path.Base(filePath))
+		relation := path.Join(path.Dir(filePath), match[1])
+		relations[relation] = append(relations[relation], relationSegment{filePath, segmentNo, size})
+	}
+
+	for _, segments := range relations {
+		sort.Slice(segments, func(i, j int) bool {
+			return segments[i].number < segments[j].number
+		})
+		for i, segment := range segments {
+			if segment.size > RelFileSizeBound || segment.size%DatabasePageSize != 0 {
+				return newRelationSegmentSizeError(segment.path, segment.size)
+			}
+			isLast := i == len(segments)-1
+			if !isLast && segment.size < RelFileSizeBound {
+				tracelog.WarningLogger.Printf("Relation segment '%s' is shorter than %d bytes (%d) "+
+					"but is followed by the other segments, "+
+					"probably the relation was extended during the backup\n",
+					segment.path, RelFileSizeBound, segment.size)
+			}
+		}
+	}
+	return nil
+}
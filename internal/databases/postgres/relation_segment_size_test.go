@@ -0,0 +1,83 @@
+package postgres_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func createRelationSegments(t *testing.T, dir string, sizes map[string]int64) {
+	for name, size := range sizes {
+		filePath := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		file, err := os.Create(filePath)
+		require.NoError(t, err)
+		require.NoError(t, file.Truncate(size))
+		require.NoError(t, file.Close())
+	}
+}
+
+func TestValidateRelationSegmentSizes_MultiSegmentWithShortTail(t *testing.T) {
+	dir := t.TempDir()
+	createRelationSegments(t, dir, map[string]int64{
+		"base/1/16384":   postgres.RelFileSizeBound,
+		"base/1/16384.1": postgres.RelFileSizeBound,
+		"base/1/16384.2": 10 * postgres.DatabasePageSize,
+	})
+
+	assert.NoError(t, postgres.ValidateRelationSegmentSizes(dir))
+}
+
+func TestValidateRelationSegmentSizes_ShortNonFinalSegment(t *testing.T) {
+	dir := t.TempDir()
+	createRelationSegments(t, dir, map[string]int64{
+		"base/1/16384":   postgres.RelFileSizeBound,
+		"base/1/16384.1": postgres.RelFileSizeBound - postgres.DatabasePageSize,
+		"base/1/16384.2": postgres.DatabasePageSize,
+	})
+
+	assert.NoError(t, postgres.ValidateRelationSegmentSizes(dir))
+}
+
+func TestValidateRelationSegmentSizes_OversizedSegment(t *testing.T) {
+	dir := t.TempDir()
+	createRelationSegments(t, dir, map[string]int64{
+		"base/1/16384":   postgres.RelFileSizeBound,
+		"base/1/16384.1": postgres.RelFileSizeBound + postgres.DatabasePageSize,
+	})
+
+	err := postgres.ValidateRelationSegmentSizes(dir)
+
+	assert.IsType(t, postgres.RelationSegmentSizeError{}, err)
+}
+
+func TestValidateRelationSegmentSizes_TornTailSegment(t *testing.T) {
+	dir := t.TempDir()
+	createRelationSegments(t, dir, map[string]int64{
+		"base/1/16384":           postgres.RelFileSizeBound,
+		"base/1/16384.1":         postgres.DatabasePageSize + 100,
+		"base/1/pg_filenode.map": 100,
+	})
+
+	err := postgres.ValidateRelationSegmentSizes(dir)
+
+	assert.IsType(t, postgres.RelationSegmentSizeError{}, err)
+}
+
+func TestValidateRelationSegmentSizes_Tablespace(t *testing.T) {
+	dir := t.TempDir()
+	location := t.TempDir()
+	createRelationSegments(t, location, map[string]int64{
+		"PG_14_202107181/16385/16386": 100,
+	})
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pg_tblspc"), 0755))
+	require.NoError(t, os.Symlink(location, filepath.Join(dir, "pg_tblspc", "16390")))
+
+	err := postgres.ValidateRelationSegmentSizes(dir)
+
+	assert.IsType(t, postgres.RelationSegmentSizeError{}, err)
+}
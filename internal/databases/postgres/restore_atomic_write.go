@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"archive/tar"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// restoreTemporaryFileSuffix is appended to the path of the new file while it is written.
+// Such files are excluded from the backups and the ones left by the crash are removed by the next restore.
+const restoreTemporaryFileSuffix = ".walg_tmp"
+
+// writeRestoredFileAtomically writes the new file to the temporary sibling path and renames it into place
+// once it is written, so the target path never holds the partially written file. Unless the fsyncs are disabled,
+// the temporary file is synced before the rename and the parent directory after it, so the rename is durable too.
+// The fsync is never batched: the restore of the entry continues at the target path, so the rename can't wait
+// for the batch.
+func writeRestoredFileAtomically(header *tar.Header, targetPath string, fsync bool, dirMode os.FileMode,
+	write func(file *os.File) error) error {
+	err := PrepareDirs(header.Name, targetPath, dirMode)
+	if err != nil {
+		return errors.Wrap(err, "Interpret: failed to create all directories")
+	}
+	temporaryPath := targetPath + restoreTemporaryFileSuffix
+	temporaryFile, err := openRestoredFile(temporaryPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, restoredFileCreateMode(header))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create new file: '%s'", temporaryPath)
+	}
+	err = write(temporaryFile)
+	if err == nil && fsync {
+		if err = syncRestoredFile(temporaryFile); err != nil {
+			err = errors.Wrap(err, "Interpret: fsync failed")
+		}
+	}
+	if closeErr := temporaryFile.Close(); err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed to close '%s'", temporaryPath)
+	}
+	if err == nil {
+		if err = os.Rename(temporaryPath, targetPath); err != nil {
+			err = errors.Wrapf(err, "failed to rename '%s' to '%s'", temporaryPath, targetPath)
+		}
+	}
+	if err != nil {
+		if removeErr := os.Remove(temporaryPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			tracelog.WarningLogger.Printf("Failed to remove the partially written '%s': %v\n", temporaryPath, removeErr)
+		}
+		return err
+	}
+	if fsync {
+		// the directories can't be synced on some platforms
+		if err = syncDirectory(filepath.Dir(targetPath)); err != nil {
+			tracelog.WarningLogger.Printf("Failed to sync %s after writing %s: %v\n",
+				filepath.Dir(targetPath), filepath.Base(targetPath), err)
+		}
+	}
+	return nil
+}
+
+// removeRestoreTemporaryFiles removes the temporary files left in the data directory and in its tablespaces
+// by the crashed restore
+func removeRestoreTemporaryFiles(dbDataDirectory string) error {
+	directories := []string{dbDataDirectory}
+	tablespaceLinks, _ := filepath.Glob(filepath.Join(dbDataDirectory, TablespaceFolder, "*"))
+	directories = append(directories, tablespaceLinks...)
+	removedCount := 0
+	for _, directory := range directories {
+		err := filepath.WalkDir(utility.ResolveSymlink(directory), func(path string, entry fs.DirEntry, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), restoreTemporaryFileSuffix) {
+				return nil
+			}
+			if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "failed to remove the temporary file '%s' left by the previous restore", path)
+			}
+			removedCount++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if removedCount > 0 {
+		tracelog.InfoLogger.Printf("Removed %d temporary files left by the previous restore\n", removedCount)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestUnwrapRegularFileOld_KeepsPreviousFileOnWriteError(t *testing.T) {
+	dataDir := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	targetPath := filepath.Join(dataDir, "base", "1", "1259")
+	require.NoError(t, os.MkdirAll(filepath.Dir(targetPath), 0700))
+	require.NoError(t, os.WriteFile(targetPath, []byte("previous"), 0600))
+	reader := io.MultiReader(strings.NewReader("partial"), &failingReader{err: errors.New("connection reset")})
+
+	err := tarInterpreter.unwrapRegularFileOld(reader,
+		&tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Size: 16}, targetPath, true)
+
+	assert.Error(t, err)
+	content, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", string(content))
+	_, err = os.Stat(targetPath + restoreTemporaryFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestInterpret_BatchedAtomicWriteRenamesAfterFsync(t *testing.T) {
+	viper.Set(internal.TarFsyncBatchSizeSetting, 10)
+	defer viper.Set(internal.TarFsyncBatchSizeSetting, 0)
+	dataDir := t.TempDir()
+	targetPath := filepath.Join(dataDir, "base", "1", "1259")
+	var syncedPaths []string
+	defaultSyncRestoredFile := syncRestoredFile
+	syncRestoredFile = func(file syncedFile) error {
+		_, err := os.Stat(targetPath)
+		assert.True(t, os.IsNotExist(err), "the target is renamed before the fsync")
+		syncedPaths = append(syncedPaths, file.Name())
+		return defaultSyncRestoredFile(file)
+	}
+	defer func() { syncRestoredFile = defaultSyncRestoredFile }()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	batchTarInterpreter, finish := tarInterpreter.StartTarBatch()
+
+	err := batchTarInterpreter.Interpret(strings.NewReader("data"),
+		&tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Mode: 0600, Size: 4})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{targetPath + restoreTemporaryFileSuffix}, syncedPaths)
+	content, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(content))
+	_, err = os.Stat(targetPath + restoreTemporaryFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, finish())
+}
+
+func TestRemoveRestoreTemporaryFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	tablespaceLocation := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "base", "1"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, TablespaceFolder), 0700))
+	require.NoError(t, os.Symlink(tablespaceLocation, filepath.Join(dataDir, TablespaceFolder, "16385")))
+	leftovers := []string{
+		filepath.Join(dataDir, "base", "1", "1259"+restoreTemporaryFileSuffix),
+		filepath.Join(tablespaceLocation, "16386"+restoreTemporaryFileSuffix),
+	}
+	kept := filepath.Join(dataDir, "base", "1", "1249")
+	for _, path := range append(leftovers, kept) {
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+	}
+
+	require.NoError(t, removeRestoreTemporaryFiles(dataDir))
+
+	for _, path := range leftovers {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+	_, err := os.Stat(kept)
+	assert.NoError(t, err)
+	assert.NoError(t, removeRestoreTemporaryFiles(filepath.Join(dataDir, "missing")))
+}
@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// PartialRestoreError indicates that the best-effort restore has completed, but some files failed to restore
+type PartialRestoreError struct {
+	error
+	FailedFiles []RestoreFileFailure
+}
+
+func newPartialRestoreError(failedFiles []RestoreFileFailure) PartialRestoreError {
+	return PartialRestoreError{errors.Errorf("%d files failed to restore, the restored data directory is incomplete",
+		len(failedFiles)), failedFiles}
+}
+
+func (err PartialRestoreError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// RestoreFileFailure is the file of the backup which failed to restore
+type RestoreFileFailure struct {
+	BackupName string
+	// Name is the file path relative to the data directory
+	Name  string
+	Error string
+}
+
+// BestEffortRestore makes the restore continue past the errors of the single files, e.g. to salvage
+// what is readable from the damaged backup. The failed files are logged and collected, they may be left
+// partially written. The failed file is not restored from the other backups of the delta chain either,
+// since their increments can't be applied to it, but the retried tar of the same backup restores it again.
+type BestEffortRestore struct {
+	mutex    sync.Mutex
+	failures map[string]RestoreFileFailure
+}
+
+func NewBestEffortRestore() *BestEffortRestore {
+	return &BestEffortRestore{failures: make(map[string]RestoreFileFailure)}
+}
+
+func (restore *BestEffortRestore) trackFailure(backupName, fileName string, err error) {
+	tracelog.ErrorLogger.Printf("Failed to restore '%s' of backup '%s', the restore continues: %v\n",
+		fileName, backupName, err)
+	restore.mutex.Lock()
+	defer restore.mutex.Unlock()
+	restore.failures[fileName] = RestoreFileFailure{BackupName: backupName, Name: fileName, Error: err.Error()}
+}
+
+// trackSuccess forgets the failure of the file restored by the retried tar of the same backup
+func (restore *BestEffortRestore) trackSuccess(backupName, fileName string) {
+	restore.mutex.Lock()
+	defer restore.mutex.Unlock()
+	if failure, ok := restore.failures[fileName]; ok && failure.BackupName == backupName {
+		delete(restore.failures, fileName)
+	}
+}
+
+// isFailedInOtherBackup returns whether the file has failed to restore from the other backup of the delta chain
+func (restore *BestEffortRestore) isFailedInOtherBackup(backupName, fileName string) bool {
+	restore.mutex.Lock()
+	defer restore.mutex.Unlock()
+	failure, ok := restore.failures[fileName]
+	return ok && failure.BackupName != backupName
+}
+
+// FailedFiles returns the files which failed to restore, sorted by name
+func (restore *BestEffortRestore) FailedFiles() []RestoreFileFailure {
+	restore.mutex.Lock()
+	defer restore.mutex.Unlock()
+	failedFiles := make([]RestoreFileFailure, 0, len(restore.failures))
+	for _, failure := range restore.failures {
+		failedFiles = append(failedFiles, failure)
+	}
+	sort.Slice(failedFiles, func(i, j int) bool {
+		return failedFiles[i].Name < failedFiles[j].Name
+	})
+	return failedFiles
+}
+
+// Finish logs the summary of the failed files and returns PartialRestoreError if there are any
+func (restore *BestEffortRestore) Finish() error {
+	failedFiles := restore.FailedFiles()
+	if len(failedFiles) == 0 {
+		tracelog.InfoLogger.Println("Best-effort restore: all files are restored")
+		return nil
+	}
+	tracelog.ErrorLogger.Printf("Best-effort restore: %d files failed to restore:\n", len(failedFiles))
+	for _, failure := range failedFiles {
+		tracelog.ErrorLogger.Printf("  %s of backup %s: %s\n", failure.Name, failure.BackupName, failure.Error)
+	}
+	return newPartialRestoreError(failedFiles)
+}
+
+// unwrapBestEffort runs the unwrap of the regular file, in the best-effort restore its error is collected
+// instead of being returned, unless the restore is cancelled
+func (tarInterpreter *FileTarInterpreter) unwrapBestEffort(fileName string, unwrap func() error) error {
+	bestEffort := tarInterpreter.policy.bestEffort
+	if bestEffort == nil {
+		return unwrap()
+	}
+	if bestEffort.isFailedInOtherBackup(tarInterpreter.backupName, fileName) {
+		tracelog.DebugLogger.Printf("'%s' has failed to restore from the other backup, it is skipped\n", fileName)
+		tarInterpreter.metrics.trackSkippedFile()
+		return nil
+	}
+	err := unwrap()
+	var cancelledError RestoreCancelledError
+	if errors.As(err, &cancelledError) {
+		return err
+	}
+	if err != nil {
+		tarInterpreter.addToFailedFiles(fileName, err)
+		bestEffort.trackFailure(tarInterpreter.backupName, fileName, err)
+		return nil
+	}
+	tarInterpreter.removeFromFailedFiles(fileName)
+	bestEffort.trackSuccess(tarInterpreter.backupName, fileName)
+	return nil
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBestEffortTestInterpreter(dbDataDirectory, backupName string, bestEffort *BestEffortRestore) *FileTarInterpreter {
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithBestEffort(bestEffort))
+	tarInterpreter.backupName = backupName
+	return tarInterpreter
+}
+
+func interpretBestEffortTestFile(tarInterpreter *FileTarInterpreter, name string, fileReader io.Reader) error {
+	return tarInterpreter.Interpret(fileReader, &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     int64(len("content")),
+	})
+}
+
+func TestBestEffortRestore_ContinuesPastFailedFiles(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	bestEffort := NewBestEffortRestore()
+	tarInterpreter := newBestEffortTestInterpreter(dbDataDirectory, "base_000000010000000000000002", bestEffort)
+
+	require.NoError(t, interpretBestEffortTestFile(tarInterpreter, "/base/1/2619",
+		iotest.ErrReader(errors.New("corrupted tar"))))
+	require.NoError(t, interpretBestEffortTestFile(tarInterpreter, "/base/1/1259", bytes.NewReader([]byte("content"))))
+	require.NoError(t, interpretBestEffortTestFile(tarInterpreter, "/base/1/1249",
+		iotest.ErrReader(errors.New("decryption failed"))))
+
+	content, err := os.ReadFile(filepath.Join(dbDataDirectory, "base", "1", "1259"))
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+
+	assert.Equal(t, 2, tarInterpreter.UnwrapResult.Totals().FailedFiles)
+	failedFiles := tarInterpreter.UnwrapResult.ToDto().FailedFiles
+	require.Len(t, failedFiles, 2)
+	assert.Equal(t, "/base/1/1249", failedFiles[0].Path)
+	assert.Contains(t, failedFiles[0].Error, "decryption failed")
+	assert.Equal(t, "/base/1/2619", failedFiles[1].Path)
+	assert.Contains(t, failedFiles[1].Error, "corrupted tar")
+
+	err = bestEffort.Finish()
+	require.Error(t, err)
+	partialError, ok := err.(PartialRestoreError)
+	require.True(t, ok)
+	require.Len(t, partialError.FailedFiles, 2)
+	assert.Equal(t, "/base/1/1249", partialError.FailedFiles[0].Name)
+	assert.Equal(t, "/base/1/2619", partialError.FailedFiles[1].Name)
+	assert.Equal(t, "base_000000010000000000000002", partialError.FailedFiles[1].BackupName)
+	assert.Contains(t, err.Error(), "2 files failed to restore")
+}
+
+func TestBestEffortRestore_NoFailures(t *testing.T) {
+	bestEffort := NewBestEffortRestore()
+	tarInterpreter := newBestEffortTestInterpreter(t.TempDir(), "base_000000010000000000000002", bestEffort)
+
+	require.NoError(t, interpretBestEffortTestFile(tarInterpreter, "/base/1/1259", bytes.NewReader([]byte("content"))))
+
+	assert.NoError(t, bestEffort.Finish())
+	assert.Empty(t, tarInterpreter.UnwrapResult.ToDto().FailedFiles)
+}
+
+func TestBestEffortRestore_SkipsFileFailedInOtherBackup(t *testing.T) {
+	// the base backup file the delta increment applies to has failed, so the increment is not applied
+	dbDataDirectory := t.TempDir()
+	bestEffort := NewBestEffortRestore()
+	baseInterpreter := newBestEffortTestInterpreter(dbDataDirectory, "base_000000010000000000000002", bestEffort)
+	require.NoError(t, interpretBestEffortTestFile(baseInterpreter, "/base/1/2619",
+		iotest.ErrReader(errors.New("corrupted tar"))))
+
+	deltaInterpreter := newBestEffortTestInterpreter(dbDataDirectory,
+		"base_000000010000000000000004_D_000000010000000000000002", bestEffort)
+	require.NoError(t, interpretBestEffortTestFile(deltaInterpreter, "/base/1/2619", bytes.NewReader([]byte("content"))))
+
+	_, err := os.Stat(filepath.Join(dbDataDirectory, "base", "1", "2619"))
+	assert.True(t, os.IsNotExist(err))
+	failedFiles := bestEffort.FailedFiles()
+	require.Len(t, failedFiles, 1)
+	assert.Equal(t, "base_000000010000000000000002", failedFiles[0].BackupName)
+}
+
+func TestBestEffortRestore_RetriedFileOfSameBackupIsRestored(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	bestEffort := NewBestEffortRestore()
+	tarInterpreter := newBestEffortTestInterpreter(dbDataDirectory, "base_000000010000000000000002", bestEffort)
+
+	require.NoError(t, interpretBestEffortTestFile(tarInterpreter, "/base/1/2619",
+		iotest.ErrReader(errors.New("connection reset"))))
+	require.NoError(t, interpretBestEffortTestFile(tarInterpreter, "/base/1/2619", bytes.NewReader([]byte("content"))))
+
+	assert.Empty(t, bestEffort.FailedFiles())
+	assert.Equal(t, 0, tarInterpreter.UnwrapResult.Totals().FailedFiles)
+	assert.NoError(t, bestEffort.Finish())
+}
+
+func TestBestEffortRestore_PropagatesCancellation(t *testing.T) {
+	bestEffort := NewBestEffortRestore()
+	tarInterpreter := newBestEffortTestInterpreter(t.TempDir(), "base_000000010000000000000002", bestEffort)
+
+	err := interpretBestEffortTestFile(tarInterpreter, "/base/1/2619",
+		iotest.ErrReader(errors.Wrap(newRestoreCancelledError(), "read failed")))
+
+	var cancelledError RestoreCancelledError
+	assert.True(t, errors.As(err, &cancelledError))
+	assert.Empty(t, bestEffort.FailedFiles())
+}
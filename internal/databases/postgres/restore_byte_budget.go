@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/wal-g/tracelog"
+)
+
+// RestoreByteBudget stops the restore of the new files once the restored files reach the byte budget.
+// The files are restored in the order of the restore stages, so the infrastructure files go first.
+// The file which does not fit into the remaining budget is not written at all, so the restored files
+// are always complete.
+type RestoreByteBudget struct {
+	budget int64
+
+	mutex        sync.Mutex
+	usedBytes    int64
+	exhausted    bool
+	fileSizes    map[string]int64
+	skippedFiles map[string]bool
+}
+
+func NewRestoreByteBudget(budget int64) *RestoreByteBudget {
+	return &RestoreByteBudget{
+		budget:       budget,
+		fileSizes:    make(map[string]int64),
+		skippedFiles: make(map[string]bool),
+	}
+}
+
+// allowFile accounts the file which is about to be written and returns false if it should be skipped.
+// The file restored several times (e.g. by the delta backups) is accounted by its largest size
+// and is never stopped halfway, while the skipped file stays skipped, so its increments are not applied.
+func (budget *RestoreByteBudget) allowFile(fileName string, size int64) bool {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	if budget.skippedFiles[fileName] {
+		return false
+	}
+	if restoredSize, ok := budget.fileSizes[fileName]; ok {
+		if size > restoredSize {
+			budget.usedBytes += size - restoredSize
+			budget.fileSizes[fileName] = size
+		}
+		return true
+	}
+	if budget.exhausted || budget.usedBytes+size > budget.budget {
+		if !budget.exhausted {
+			tracelog.InfoLogger.Printf("Restore byte budget of %d bytes is reached at '%s', "+
+				"the rest of the files are not restored\n", budget.budget, fileName)
+		}
+		budget.exhausted = true
+		budget.skippedFiles[fileName] = true
+		return false
+	}
+	budget.usedBytes += size
+	budget.fileSizes[fileName] = size
+	return true
+}
+
+// RestoredFiles returns the sorted names of the files restored within the budget
+func (budget *RestoreByteBudget) RestoredFiles() []string {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	files := make([]string, 0, len(budget.fileSizes))
+	for file := range budget.fileSizes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// SkippedFiles returns the sorted names of the files which were not restored because of the budget
+func (budget *RestoreByteBudget) SkippedFiles() []string {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	files := make([]string, 0, len(budget.skippedFiles))
+	for file := range budget.skippedFiles {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// UsedBytes returns the total size of the files restored within the budget
+func (budget *RestoreByteBudget) UsedBytes() int64 {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	return budget.usedBytes
+}
+
+// LogReport logs which files were and were not restored because of the budget
+func (budget *RestoreByteBudget) LogReport() {
+	restoredFiles := budget.RestoredFiles()
+	skippedFiles := budget.SkippedFiles()
+	tracelog.InfoLogger.Printf("Restore byte budget: %d files of %d bytes are restored, %d files are not restored\n",
+		len(restoredFiles), budget.UsedBytes(), len(skippedFiles))
+	if len(skippedFiles) == 0 {
+		return
+	}
+	for _, file := range restoredFiles {
+		tracelog.InfoLogger.Printf("Restored: %s\n", file)
+	}
+	for _, file := range skippedFiles {
+		tracelog.WarningLogger.Printf("Not restored: %s\n", file)
+	}
+}
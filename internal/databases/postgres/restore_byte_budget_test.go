@@ -0,0 +1,74 @@
+package postgres_test
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func interpretBudgetTestFile(t *testing.T, tarInterpreter *postgres.FileTarInterpreter, name, content string) {
+	err := tarInterpreter.Interpret(strings.NewReader(content), &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     int64(len(content)),
+	})
+	require.NoError(t, err)
+}
+
+func TestInterpretStopsAtByteBudget(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	budget := postgres.NewRestoreByteBudget(10)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithByteBudget(budget))
+
+	interpretBudgetTestFile(t, tarInterpreter, "PG_VERSION", "14\n")
+	interpretBudgetTestFile(t, tarInterpreter, "base/1/1259", "12345678")
+	// the budget is exhausted, so the smaller files following the skipped one are not restored too
+	interpretBudgetTestFile(t, tarInterpreter, "base/1/1260", "1")
+
+	_, err := os.Stat(filepath.Join(dbDataDirectory, "PG_VERSION"))
+	assert.NoError(t, err)
+	for _, name := range []string{"base/1/1259", "base/1/1260"} {
+		_, err = os.Stat(filepath.Join(dbDataDirectory, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+	assert.Equal(t, []string{"PG_VERSION"}, budget.RestoredFiles())
+	assert.Equal(t, []string{"base/1/1259", "base/1/1260"}, budget.SkippedFiles())
+	assert.Equal(t, int64(3), budget.UsedBytes())
+}
+
+func TestInterpretByteBudgetIgnoresFilesNotToUnwrap(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	budget := postgres.NewRestoreByteBudget(5)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, map[string]bool{"PG_VERSION": true}, false, postgres.WithByteBudget(budget))
+
+	interpretBudgetTestFile(t, tarInterpreter, "base/1/1259", "12345678")
+	interpretBudgetTestFile(t, tarInterpreter, "PG_VERSION", "14\n")
+
+	assert.Equal(t, []string{"PG_VERSION"}, budget.RestoredFiles())
+	assert.Empty(t, budget.SkippedFiles())
+}
+
+func TestRestoreByteBudget_FileRestoredSeveralTimes(t *testing.T) {
+	budget := postgres.NewRestoreByteBudget(10)
+	tarInterpreter := postgres.NewFileTarInterpreter(t.TempDir(), postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithByteBudget(budget))
+
+	interpretBudgetTestFile(t, tarInterpreter, "base/1/1259", "123456")
+	interpretBudgetTestFile(t, tarInterpreter, "base/1/1260", "12345678")
+	// the restored file is rewritten even if the budget is exhausted, the skipped one stays skipped
+	interpretBudgetTestFile(t, tarInterpreter, "base/1/1259", "12345678")
+	interpretBudgetTestFile(t, tarInterpreter, "base/1/1260", "1")
+
+	assert.Equal(t, []string{"base/1/1259"}, budget.RestoredFiles())
+	assert.Equal(t, []string{"base/1/1260"}, budget.SkippedFiles())
+	assert.Equal(t, int64(8), budget.UsedBytes())
+}
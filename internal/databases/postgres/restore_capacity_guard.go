@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+type InsufficientCapacityError struct {
+	error
+}
+
+func newInsufficientCapacityError(fileName string, required, capacity int64) InsufficientCapacityError {
+	return InsufficientCapacityError{errors.Errorf(
+		"restoring '%s' requires %d bytes in total, but the restore target capacity is %d bytes",
+		fileName, required, capacity)}
+}
+
+func (err InsufficientCapacityError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// RestoreCapacityGuard makes the restore fail before the bounded restore target (e.g. a filesystem
+// inside a pre-sized image file) overflows. The files restored into tablespaces are not accounted,
+// since tablespaces are usually located on other filesystems.
+type RestoreCapacityGuard struct {
+	capacity int64
+
+	mutex         sync.Mutex
+	reservedBytes int64
+	fileSizes     map[string]int64
+}
+
+func NewRestoreCapacityGuard(capacity int64) *RestoreCapacityGuard {
+	return &RestoreCapacityGuard{capacity: capacity, fileSizes: make(map[string]int64)}
+}
+
+// ConfigureRestoreCapacityGuard detects the capacity of the filesystem containing the data directory
+// if the capacity enforcement is enabled, returns nil otherwise
+func ConfigureRestoreCapacityGuard(dbDataDirectory string) (*RestoreCapacityGuard, error) {
+	if !viper.GetBool(internal.RestoreCapacityCheckSetting) {
+		return nil, nil
+	}
+	capacity, err := getAvailableDiskSpace(findExistingDirectory(dbDataDirectory))
+	if err != nil {
+		return nil, err
+	}
+	tracelog.InfoLogger.Printf("Restore target capacity is %d bytes\n", capacity)
+	return NewRestoreCapacityGuard(capacity), nil
+}
+
+// findExistingDirectory returns the directory or its nearest existing parent
+func findExistingDirectory(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// Reserve accounts the file which is about to be written and returns InsufficientCapacityError
+// if the restored data does not fit into the target. The file restored several times
+// (e.g. by the delta backups) is accounted by its largest size.
+func (guard *RestoreCapacityGuard) Reserve(fileName string, size int64) error {
+	if _, ok := getTablespaceName(fileName); ok {
+		return nil
+	}
+
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+	additionalBytes := size - guard.fileSizes[fileName]
+	if additionalBytes <= 0 {
+		return nil
+	}
+	if guard.reservedBytes+additionalBytes > guard.capacity {
+		return newInsufficientCapacityError(fileName, guard.reservedBytes+additionalBytes, guard.capacity)
+	}
+	guard.reservedBytes += additionalBytes
+	guard.fileSizes[fileName] = size
+	return nil
+}
+
+// GetReservedBytes returns the total size of the accounted files
+func (guard *RestoreCapacityGuard) GetReservedBytes() int64 {
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+	return guard.reservedBytes
+}
+
+// reserveCapacity reserves the capacity for the file which is going to be written,
+// the files skipped as not selected or restored by the previous run are not accounted
+func (tarInterpreter *FileTarInterpreter) reserveCapacity(fileInfo *tar.Header) error {
+	if tarInterpreter.policy.capacityGuard == nil {
+		return nil
+	}
+	if !isSelectedFile(tarInterpreter, fileInfo.Name) || tarInterpreter.isRestoredBefore(fileInfo.Name) {
+		return nil
+	}
+	return tarInterpreter.policy.capacityGuard.Reserve(fileInfo.Name, fileInfo.Size)
+}
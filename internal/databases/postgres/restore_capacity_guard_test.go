@@ -0,0 +1,75 @@
+package postgres_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func TestRestoreCapacityGuard_Reserve(t *testing.T) {
+	guard := postgres.NewRestoreCapacityGuard(100)
+
+	assert.NoError(t, guard.Reserve("/base/1/1259", 60))
+	assert.NoError(t, guard.Reserve("/base/1/1260", 40))
+	assert.IsType(t, postgres.InsufficientCapacityError{}, guard.Reserve("/base/1/1261", 1))
+	assert.Equal(t, int64(100), guard.GetReservedBytes())
+}
+
+func TestRestoreCapacityGuard_FileRestoredSeveralTimes(t *testing.T) {
+	guard := postgres.NewRestoreCapacityGuard(100)
+
+	assert.NoError(t, guard.Reserve("/base/1/1259", 60))
+	assert.NoError(t, guard.Reserve("/base/1/1259", 30))
+	assert.NoError(t, guard.Reserve("/base/1/1259", 80))
+	assert.Equal(t, int64(80), guard.GetReservedBytes())
+}
+
+func TestRestoreCapacityGuard_IgnoresTablespaces(t *testing.T) {
+	guard := postgres.NewRestoreCapacityGuard(10)
+
+	assert.NoError(t, guard.Reserve("/pg_tblspc/16385/PG_14_202107181/1/1259", 60))
+	assert.Equal(t, int64(0), guard.GetReservedBytes())
+}
+
+func TestInterpretFailsBeforeOverflow(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithCapacityGuard(postgres.NewRestoreCapacityGuard(4)))
+
+	content := []byte("content")
+	err := tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+		Name:     "/base/1/1259",
+		Typeflag: tar.TypeReg,
+		Size:     int64(len(content)),
+	})
+
+	assert.IsType(t, postgres.InsufficientCapacityError{}, err)
+	_, err = os.Stat(path.Join(dbDataDirectory, "/base/1/1259"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestInterpretReservesOnlySelectedFiles(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	guard := postgres.NewRestoreCapacityGuard(10)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, map[string]bool{"/base/1/1259": true}, false, postgres.WithCapacityGuard(guard))
+
+	content := []byte("content")
+	for _, name := range []string{"/base/1/1249", "/base/1/1259"} {
+		err := tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Size:     int64(len(content)),
+		})
+		require.NoError(t, err, name)
+	}
+
+	// the skipped file does not take the capacity of the selected one
+	assert.Equal(t, int64(len(content)), guard.GetReservedBytes())
+}
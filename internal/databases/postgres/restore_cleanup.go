@@ -0,0 +1,238 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+type RestoreCancelledError struct {
+	error
+}
+
+func newRestoreCancelledError() RestoreCancelledError {
+	return RestoreCancelledError{errors.New("the restore is cancelled")}
+}
+
+func (err RestoreCancelledError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// RestoreCleanup makes the restore "all or nothing": if the restore fails or is cancelled,
+// everything written during this run is removed. The paths created by FileTarInterpreter
+// are tracked, and if the data directory was empty before the restore, it is emptied again.
+// The directories created outside of the data directory for the tablespace locations are removed too.
+type RestoreCleanup struct {
+	dbDataDirectory string
+	wasEmpty        bool
+
+	cancelled int32
+	// writesMutex orders the start of the writes and the cancellation
+	writesMutex sync.Mutex
+	writes      sync.WaitGroup
+
+	createdPathsMutex sync.Mutex
+	createdPaths      map[string]bool
+	// createdExternalPaths are the topmost directories created outside of the data directory,
+	// everything inside them is written by the restore
+	createdExternalPaths map[string]bool
+}
+
+func NewRestoreCleanup(dbDataDirectory string) (*RestoreCleanup, error) {
+	wasEmpty := true
+	if _, err := os.Stat(dbDataDirectory); err == nil {
+		wasEmpty, err = isDirectoryEmpty(dbDataDirectory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &RestoreCleanup{
+		dbDataDirectory:      filepath.Clean(dbDataDirectory),
+		wasEmpty:             wasEmpty,
+		createdPaths:         make(map[string]bool),
+		createdExternalPaths: make(map[string]bool),
+	}, nil
+}
+
+// beginWrite registers the write of the restored entry, it returns false if the restore is cancelled
+func (cleanup *RestoreCleanup) beginWrite() bool {
+	cleanup.writesMutex.Lock()
+	defer cleanup.writesMutex.Unlock()
+	if cleanup.isCancelled() {
+		return false
+	}
+	cleanup.writes.Add(1)
+	return true
+}
+
+func (cleanup *RestoreCleanup) endWrite() {
+	cleanup.writes.Done()
+}
+
+func (cleanup *RestoreCleanup) isCancelled() bool {
+	return atomic.LoadInt32(&cleanup.cancelled) != 0
+}
+
+// trackPath records the path inside the data directory and its parent directories which do not exist yet
+// and are going to be created
+func (cleanup *RestoreCleanup) trackPath(targetPath string) {
+	if cleanup == nil {
+		return
+	}
+	cleanup.createdPathsMutex.Lock()
+	defer cleanup.createdPathsMutex.Unlock()
+	for currentPath := filepath.Clean(targetPath); isInsideDirectory(cleanup.dbDataDirectory, currentPath) &&
+		currentPath != cleanup.dbDataDirectory; currentPath = filepath.Dir(currentPath) {
+		if _, err := os.Lstat(currentPath); err == nil {
+			break
+		}
+		cleanup.createdPaths[currentPath] = true
+	}
+}
+
+// trackExternalDirectory records the topmost of the directory and its parents which do not exist yet
+// and are going to be created outside of the data directory, e.g. for the tablespace location
+func (cleanup *RestoreCleanup) trackExternalDirectory(directory string) {
+	if cleanup == nil {
+		return
+	}
+	directory = filepath.Clean(directory)
+	if isInsideDirectory(cleanup.dbDataDirectory, directory) {
+		cleanup.trackPath(directory)
+		return
+	}
+	topmostPath := ""
+	for currentPath := directory; currentPath != filepath.Dir(currentPath); currentPath = filepath.Dir(currentPath) {
+		if _, err := os.Lstat(currentPath); err == nil {
+			break
+		}
+		topmostPath = currentPath
+	}
+	if topmostPath == "" {
+		return
+	}
+	cleanup.createdPathsMutex.Lock()
+	defer cleanup.createdPathsMutex.Unlock()
+	cleanup.createdExternalPaths[topmostPath] = true
+}
+
+// wrapReader makes the reads of the restored file fail as soon as the restore is cancelled
+func (cleanup *RestoreCleanup) wrapReader(reader io.Reader) io.Reader {
+	return &cancellableReader{Reader: reader, cleanup: cleanup}
+}
+
+// Cancel stops the restore writes and waits for the writes in progress to stop
+func (cleanup *RestoreCleanup) Cancel() {
+	cleanup.writesMutex.Lock()
+	atomic.StoreInt32(&cleanup.cancelled, 1)
+	cleanup.writesMutex.Unlock()
+	cleanup.writes.Wait()
+}
+
+// Cleanup cancels the restore and removes everything written during it.
+// The failures to remove the separate paths are logged and do not stop the cleanup.
+func (cleanup *RestoreCleanup) Cleanup() error {
+	cleanup.Cancel()
+	tracelog.InfoLogger.Printf("Removing the files written by the failed restore to '%s'\n", cleanup.dbDataDirectory)
+
+	cleanup.createdPathsMutex.Lock()
+	createdPaths := make([]string, 0, len(cleanup.createdPaths))
+	for createdPath := range cleanup.createdPaths {
+		createdPaths = append(createdPaths, createdPath)
+	}
+	cleanup.createdPathsMutex.Unlock()
+	// the deeper paths go first, so the directories are empty when removed
+	sort.Slice(createdPaths, func(i, j int) bool {
+		return strings.Count(createdPaths[i], string(filepath.Separator)) >
+			strings.Count(createdPaths[j], string(filepath.Separator))
+	})
+
+	var failedCount int
+	for _, createdPath := range createdPaths {
+		err := os.Remove(createdPath)
+		if err != nil && !os.IsNotExist(err) {
+			tracelog.WarningLogger.Printf("Failed to remove '%s': %v\n", createdPath, err)
+			failedCount++
+		}
+	}
+
+	if cleanup.wasEmpty {
+		entries, err := os.ReadDir(cleanup.dbDataDirectory)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to clean up '%s'", cleanup.dbDataDirectory)
+		}
+		for _, entry := range entries {
+			entryPath := filepath.Join(cleanup.dbDataDirectory, entry.Name())
+			if err := os.RemoveAll(entryPath); err != nil {
+				tracelog.WarningLogger.Printf("Failed to remove '%s': %v\n", entryPath, err)
+				failedCount++
+			}
+		}
+	}
+
+	cleanup.createdPathsMutex.Lock()
+	createdExternalPaths := make([]string, 0, len(cleanup.createdExternalPaths))
+	for createdPath := range cleanup.createdExternalPaths {
+		createdExternalPaths = append(createdExternalPaths, createdPath)
+	}
+	cleanup.createdPathsMutex.Unlock()
+	for _, createdPath := range createdExternalPaths {
+		if err := os.RemoveAll(createdPath); err != nil {
+			tracelog.WarningLogger.Printf("Failed to remove '%s': %v\n", createdPath, err)
+			failedCount++
+		}
+	}
+
+	if failedCount > 0 {
+		return errors.Errorf("failed to remove %d paths written by the restore to '%s'",
+			failedCount, cleanup.dbDataDirectory)
+	}
+	tracelog.InfoLogger.Printf("Removed %d paths written by the restore\n", len(createdPaths)+len(createdExternalPaths))
+	return nil
+}
+
+// WatchSignals cleans up and exits when the restore is interrupted by SIGINT or SIGTERM.
+// The returned function stops watching.
+func (cleanup *RestoreCleanup) WatchSignals() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-done:
+			return
+		default:
+		}
+		err := cleanup.Cleanup()
+		tracelog.ErrorLogger.FatalfOnError("Failed to clean up the cancelled restore: %v\n", err)
+		tracelog.ErrorLogger.Fatal("The restore is cancelled\n")
+	}()
+	return func() {
+		close(done)
+		_ = signalHandler.Close()
+	}
+}
+
+type cancellableReader struct {
+	io.Reader
+	cleanup *RestoreCleanup
+}
+
+func (reader *cancellableReader) Read(p []byte) (int, error) {
+	if reader.cleanup.isCancelled() {
+		return 0, newRestoreCancelledError()
+	}
+	return reader.Reader.Read(p)
+}
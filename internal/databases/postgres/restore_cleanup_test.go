@@ -0,0 +1,75 @@
+package postgres_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func interpretTestFile(t *testing.T, tarInterpreter *postgres.FileTarInterpreter, name string) error {
+	content := []byte("content")
+	return tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     int64(len(content)),
+	})
+}
+
+func TestRestoreCleanup_EmptiesDataDirectory(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	cleanup, err := postgres.NewRestoreCleanup(dbDataDirectory)
+	require.NoError(t, err)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithRestoreCleanup(cleanup))
+
+	require.NoError(t, interpretTestFile(t, tarInterpreter, "/base/1/1259"))
+	require.NoError(t, interpretTestFile(t, tarInterpreter, "/global/1260"))
+	require.NoError(t, cleanup.Cleanup())
+
+	entries, err := os.ReadDir(dbDataDirectory)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRestoreCleanup_KeepsPreexistingFiles(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dbDataDirectory, "base", "1"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dbDataDirectory, "base", "1", "1000"), []byte("old"), 0600))
+	cleanup, err := postgres.NewRestoreCleanup(dbDataDirectory)
+	require.NoError(t, err)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithRestoreCleanup(cleanup))
+
+	require.NoError(t, interpretTestFile(t, tarInterpreter, "/base/1/1259"))
+	require.NoError(t, interpretTestFile(t, tarInterpreter, "/base/2/2600"))
+	require.NoError(t, cleanup.Cleanup())
+
+	_, err = os.Stat(filepath.Join(dbDataDirectory, "base", "1", "1000"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dbDataDirectory, "base", "1", "1259"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dbDataDirectory, "base", "2"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreCleanup_StopsWritesAfterCancel(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	cleanup, err := postgres.NewRestoreCleanup(dbDataDirectory)
+	require.NoError(t, err)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithRestoreCleanup(cleanup))
+
+	cleanup.Cancel()
+	err = interpretTestFile(t, tarInterpreter, "/base/1/1259")
+
+	assert.IsType(t, postgres.RestoreCancelledError{}, err)
+	_, err = os.Stat(filepath.Join(dbDataDirectory, "base"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// RestoreCompletionMarkerFilename is the marker written to the data directory once the restore has completed,
+// unless WALG_RESTORE_COMPLETION_MARKER_PATH sets the other path. It is excluded from the backups.
+const RestoreCompletionMarkerFilename = ".walg_restore_complete.json"
+
+// RestoreCompletionMarkerFormatVersion is incremented on the incompatible changes of RestoreCompletionMarkerDto
+const RestoreCompletionMarkerFormatVersion = 1
+
+// RestoreCompletionMarkerDto describes the completed restore for the automation waiting for it
+type RestoreCompletionMarkerDto struct {
+	FormatVersion int    `json:"format_version"`
+	BackupName    string `json:"backup_name"`
+	// StartLSN and FinishLSN are the LSNs of the restored backup recorded in its sentinel, e.g. 0/2000028
+	StartLSN  string `json:"start_lsn,omitempty"`
+	FinishLSN string `json:"finish_lsn,omitempty"`
+	// Backups are the names of the restored backups of the delta chain
+	Backups     []string                  `json:"backups"`
+	Files       RestoreCompletionFilesDto `json:"files"`
+	CompletedAt time.Time                 `json:"completed_at"`
+}
+
+// RestoreCompletionFilesDto is the sum of the unwrap result totals of the restored backups
+type RestoreCompletionFilesDto struct {
+	CompletedFiles   int   `json:"completed_files"`
+	CreatedPageFiles int   `json:"created_page_files"`
+	MissingBlocks    int64 `json:"missing_blocks"`
+	IncrementFiles   int   `json:"increment_files"`
+	IncrementBlocks  int64 `json:"increment_blocks"`
+	SkippedFiles     int   `json:"skipped_files"`
+	IdenticalFiles   int   `json:"identical_files"`
+}
+
+func (files *RestoreCompletionFilesDto) add(totals UnwrapResultTotals) {
+	files.CompletedFiles += totals.CompletedFiles
+	files.CreatedPageFiles += totals.CreatedPageFiles
+	files.MissingBlocks += totals.MissingBlocks
+	files.IncrementFiles += totals.IncrementFiles
+	files.IncrementBlocks += totals.IncrementBlocks
+	files.SkippedFiles += totals.SkippedFiles
+	files.IdenticalFiles += totals.IdenticalFiles
+}
+
+// RestoreCompletionMarker collects the unwrap results of the restored backups to write the completion marker
+// after the restore has succeeded. The stale marker is removed before the restore starts, so the failed
+// restore leaves no marker.
+type RestoreCompletionMarker struct {
+	// outputPath, if set, overrides the marker path in the data directory
+	outputPath string
+
+	mutex   sync.Mutex
+	backups []string
+	files   RestoreCompletionFilesDto
+}
+
+// ConfigureRestoreCompletionMarker creates the completion marker if WALG_RESTORE_COMPLETION_MARKER is enabled,
+// returns nil otherwise
+func ConfigureRestoreCompletionMarker() *RestoreCompletionMarker {
+	if !viper.GetBool(internal.RestoreCompletionMarkerSetting) {
+		return nil
+	}
+	return NewRestoreCompletionMarker(viper.GetString(internal.RestoreCompletionMarkerPathSetting))
+}
+
+func NewRestoreCompletionMarker(outputPath string) *RestoreCompletionMarker {
+	return &RestoreCompletionMarker{outputPath: outputPath, backups: make([]string, 0)}
+}
+
+// GetPath returns the path of the marker of the restore to the data directory
+func (marker *RestoreCompletionMarker) GetPath(dbDataDirectory string) string {
+	if marker.outputPath != "" {
+		return marker.outputPath
+	}
+	return filepath.Join(dbDataDirectory, RestoreCompletionMarkerFilename)
+}
+
+// RemoveStale removes the marker left by the previous restore
+func (marker *RestoreCompletionMarker) RemoveStale(dbDataDirectory string) error {
+	markerPath := marker.GetPath(dbDataDirectory)
+	err := os.Remove(markerPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to remove the stale restore completion marker '%s'", markerPath)
+	}
+	tracelog.InfoLogger.Printf("Removed the stale restore completion marker '%s'\n", markerPath)
+	return nil
+}
+
+func (marker *RestoreCompletionMarker) trackBackup(backupName string, result *UnwrapResult) {
+	totals := result.Totals()
+	marker.mutex.Lock()
+	defer marker.mutex.Unlock()
+	marker.backups = append(marker.backups, backupName)
+	marker.files.add(totals)
+}
+
+// Build returns the marker of the restored backup
+func (marker *RestoreCompletionMarker) Build(backupName string, sentinel BackupSentinelDto,
+	completedAt time.Time) RestoreCompletionMarkerDto {
+	marker.mutex.Lock()
+	backups := append(make([]string, 0, len(marker.backups)), marker.backups...)
+	files := marker.files
+	marker.mutex.Unlock()
+	sort.Strings(backups)
+
+	dto := RestoreCompletionMarkerDto{
+		FormatVersion: RestoreCompletionMarkerFormatVersion,
+		BackupName:    backupName,
+		Backups:       backups,
+		Files:         files,
+		CompletedAt:   completedAt.UTC(),
+	}
+	if sentinel.BackupStartLSN != nil {
+		dto.StartLSN = formatLSN(*sentinel.BackupStartLSN)
+	}
+	if sentinel.BackupFinishLSN != nil {
+		dto.FinishLSN = formatLSN(*sentinel.BackupFinishLSN)
+	}
+	return dto
+}
+
+// Write writes the marker of the restored backup atomically, so it is either absent or complete
+func (marker *RestoreCompletionMarker) Write(dbDataDirectory, backupName string, sentinel BackupSentinelDto,
+	completedAt time.Time) error {
+	data, err := json.MarshalIndent(marker.Build(backupName, sentinel, completedAt), "", "  ")
+	if err != nil {
+		return err
+	}
+	markerPath := marker.GetPath(dbDataDirectory)
+	if err = writeFileAtomically(markerPath, data); err != nil {
+		return errors.Wrap(err, "failed to write the restore completion marker")
+	}
+	tracelog.InfoLogger.Printf("Restore completion marker is written to '%s'\n", markerPath)
+	return nil
+}
+
+// ReadRestoreCompletionMarker reads the completion marker at the path
+func ReadRestoreCompletionMarker(markerPath string) (RestoreCompletionMarkerDto, error) {
+	var dto RestoreCompletionMarkerDto
+	data, err := os.ReadFile(markerPath)
+	if err != nil {
+		return dto, errors.Wrapf(err, "failed to read the restore completion marker '%s'", markerPath)
+	}
+	if err = json.Unmarshal(data, &dto); err != nil {
+		return dto, errors.Wrapf(err, "failed to unmarshal the restore completion marker '%s'", markerPath)
+	}
+	return dto, nil
+}
+
+// startCompletionMarker removes the completion marker left by the previous restore before the restore starts
+func (options FetchOptions) startCompletionMarker(dbDataDirectory string) error {
+	if options.CompletionMarker == nil {
+		return nil
+	}
+	return options.CompletionMarker.RemoveStale(dbDataDirectory)
+}
+
+// finishCompletionMarker writes the completion marker of the successfully restored backup once the files left
+// unsynced are synced. The failed and the partial restores, e.g. of the selected files only, are not marked.
+func (options FetchOptions) finishCompletionMarker(backup Backup, dbDataDirectory, fileMask string, restoreErr error) error {
+	if options.CompletionMarker == nil || restoreErr != nil {
+		return restoreErr
+	}
+	if options.isPartialRestore(fileMask) {
+		tracelog.InfoLogger.Println("The restore is partial, the restore completion marker is not written")
+		return nil
+	}
+	if options.UnsyncedDataLimiter != nil {
+		if err := options.UnsyncedDataLimiter.SyncAll(); err != nil {
+			return err
+		}
+	}
+	sentinelDto, err := backup.GetSentinel()
+	if err != nil {
+		return err
+	}
+	return options.CompletionMarker.Write(dbDataDirectory, backup.Name, sentinelDto, time.Now())
+}
+
+// isPartialRestore returns whether only some of the backup files are selected to restore
+func (options FetchOptions) isPartialRestore(fileMask string) bool {
+	return fileMask != "" || options.OnlyPrefix != "" || options.ChangedSince != nil || len(options.UnwrapList) > 0 ||
+		options.SampleSize > 0 || (options.PartAllowlist != nil && len(options.PartAllowlist.ExcludedParts()) > 0) ||
+		(options.ByteBudget != nil && len(options.ByteBudget.SkippedFiles()) > 0) || options.Exclusion != nil
+}
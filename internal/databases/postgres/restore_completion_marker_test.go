@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	completionMarkerTestBackup = "base_000000010000000000000004_D_000000010000000000000002"
+	completionMarkerTestBase   = "base_000000010000000000000002"
+)
+
+func makeCompletionMarkerTestBackup() Backup {
+	startLSN, finishLSN := uint64(0x4000028), uint64(0x4000100)
+	return Backup{SentinelDto: &BackupSentinelDto{BackupStartLSN: &startLSN, BackupFinishLSN: &finishLSN}}
+}
+
+// restoreCompletionMarkerTestChain unwraps the files of the delta backup and of its base with the completion marker
+func restoreCompletionMarkerTestChain(t *testing.T, dbDataDirectory string, marker *RestoreCompletionMarker) {
+	for backupName, fileNames := range map[string][]string{
+		completionMarkerTestBackup: {"/base/1/1259"},
+		completionMarkerTestBase:   {"/base/1/1249", "/global/1260"},
+	} {
+		tarInterpreter := NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+			WithCompletionMarker(marker))
+		for _, fileName := range fileNames {
+			content := []byte("content")
+			require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+				Name:     fileName,
+				Typeflag: tar.TypeReg,
+				Mode:     0600,
+				Size:     int64(len(content)),
+			}))
+		}
+		tarInterpreter.reportUnwrapResult(backupName)
+	}
+}
+
+func TestRestoreCompletionMarker_WrittenOnSuccess(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	markerPath := filepath.Join(dbDataDirectory, RestoreCompletionMarkerFilename)
+	require.NoError(t, os.WriteFile(markerPath, []byte("stale"), 0600))
+	options := FetchOptions{CompletionMarker: NewRestoreCompletionMarker("")}
+	backup := makeCompletionMarkerTestBackup()
+	backup.Backup.Name = completionMarkerTestBackup
+
+	require.NoError(t, options.startCompletionMarker(dbDataDirectory))
+	restoreCompletionMarkerTestChain(t, dbDataDirectory, options.CompletionMarker)
+	before := time.Now()
+	require.NoError(t, options.finishCompletionMarker(backup, dbDataDirectory, "", nil))
+
+	marker, err := ReadRestoreCompletionMarker(markerPath)
+	require.NoError(t, err)
+	assert.Equal(t, RestoreCompletionMarkerFormatVersion, marker.FormatVersion)
+	assert.Equal(t, completionMarkerTestBackup, marker.BackupName)
+	assert.Equal(t, "0/4000028", marker.StartLSN)
+	assert.Equal(t, "0/4000100", marker.FinishLSN)
+	assert.Equal(t, []string{completionMarkerTestBase, completionMarkerTestBackup}, marker.Backups)
+	assert.Equal(t, RestoreCompletionFilesDto{CompletedFiles: 3}, marker.Files)
+	assert.False(t, marker.CompletedAt.Before(before.Truncate(time.Second)))
+	assert.Equal(t, time.UTC, marker.CompletedAt.Location())
+}
+
+func TestRestoreCompletionMarker_AbsentOnFailure(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	markerPath := filepath.Join(dbDataDirectory, RestoreCompletionMarkerFilename)
+	require.NoError(t, os.WriteFile(markerPath, []byte("stale"), 0600))
+	options := FetchOptions{CompletionMarker: NewRestoreCompletionMarker("")}
+	restoreErr := errors.New("post-restore hook has failed")
+
+	require.NoError(t, options.startCompletionMarker(dbDataDirectory))
+	restoreCompletionMarkerTestChain(t, dbDataDirectory, options.CompletionMarker)
+	err := options.finishCompletionMarker(makeCompletionMarkerTestBackup(), dbDataDirectory, "", restoreErr)
+
+	assert.Equal(t, restoreErr, err)
+	_, err = os.Stat(markerPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreCompletionMarker_AbsentOnPartialRestore(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	options := FetchOptions{CompletionMarker: NewRestoreCompletionMarker(""), OnlyPrefix: "/base"}
+
+	restoreCompletionMarkerTestChain(t, dbDataDirectory, options.CompletionMarker)
+	require.NoError(t, options.finishCompletionMarker(makeCompletionMarkerTestBackup(), dbDataDirectory, "", nil))
+	options.OnlyPrefix = ""
+	require.NoError(t, options.finishCompletionMarker(makeCompletionMarkerTestBackup(), dbDataDirectory, "base/*", nil))
+
+	_, err := os.Stat(filepath.Join(dbDataDirectory, RestoreCompletionMarkerFilename))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreCompletionMarker_ConfiguredPath(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	markerPath := filepath.Join(t.TempDir(), "restore.json")
+	options := FetchOptions{CompletionMarker: NewRestoreCompletionMarker(markerPath)}
+
+	require.NoError(t, options.finishCompletionMarker(makeCompletionMarkerTestBackup(), dbDataDirectory, "", nil))
+
+	_, err := ReadRestoreCompletionMarker(markerPath)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dbDataDirectory, RestoreCompletionMarkerFilename))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreCompletionMarkerIsExcludedFromBackups(t *testing.T) {
+	_, ok := ExcludedFilenames[RestoreCompletionMarkerFilename]
+	assert.True(t, ok)
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/wal-g/internal"
+	"golang.org/x/sync/semaphore"
+)
+
+// DefaultTablespaceName is the name used in the tablespace concurrency settings for the files
+// located in the data directory itself
+const DefaultTablespaceName = "pg_default"
+
+// RestoreConcurrencyLimiter limits the number of files which are concurrently written
+// to the same tablespace or to the same destination device during the restore
+type RestoreConcurrencyLimiter struct {
+	tablespaceLimits map[string]int
+	deviceLimit      int
+
+	mutex      sync.Mutex
+	semaphores map[string]*semaphore.Weighted
+	dirKeys    map[string]string
+}
+
+// NewRestoreConcurrencyLimiter creates the limiter. tablespaceLimits are applied to the files of the configured
+// tablespaces, deviceLimit (if positive) is applied per detected device to the files of the other tablespaces.
+func NewRestoreConcurrencyLimiter(tablespaceLimits map[string]int, deviceLimit int) *RestoreConcurrencyLimiter {
+	return &RestoreConcurrencyLimiter{
+		tablespaceLimits: tablespaceLimits,
+		deviceLimit:      deviceLimit,
+		semaphores:       make(map[string]*semaphore.Weighted),
+		dirKeys:          make(map[string]string),
+	}
+}
+
+// ConfigureRestoreConcurrencyLimiter creates the limiter from the settings.
+// Returns nil if no per-tablespace or per-device limits are configured,
+// so only the global download concurrency limit is applied.
+func ConfigureRestoreConcurrencyLimiter() (*RestoreConcurrencyLimiter, error) {
+	tablespaceLimits, err := ParseTablespaceConcurrency(viper.GetString(internal.TablespaceConcurrencySetting))
+	if err != nil {
+		return nil, err
+	}
+	deviceLimit := viper.GetInt(internal.DeviceConcurrencySetting)
+	if deviceLimit < 0 {
+		return nil, errors.Errorf("%s should not be negative, got %d", internal.DeviceConcurrencySetting, deviceLimit)
+	}
+	if len(tablespaceLimits) == 0 && deviceLimit == 0 {
+		return nil, nil
+	}
+	return NewRestoreConcurrencyLimiter(tablespaceLimits, deviceLimit), nil
+}
+
+// ParseTablespaceConcurrency parses the comma-separated list of tablespace:limit pairs, e.g. "pg_default:4,16385:1".
+// Tablespaces are identified by their names in pg_tblspc.
+func ParseTablespaceConcurrency(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	if strings.TrimSpace(value) == "" {
+		return limits, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), ":")
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid tablespace concurrency '%s', expected tablespace:limit", pair)
+		}
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil || limit < 1 {
+			return nil, errors.Errorf("invalid concurrency limit for tablespace '%s': '%s'", parts[0], parts[1])
+		}
+		limits[parts[0]] = limit
+	}
+	return limits, nil
+}
+
+// Acquire blocks until the file can be written and returns the function which must be called after the write
+func (limiter *RestoreConcurrencyLimiter) Acquire(fileName, targetPath string) func() {
+	sem := limiter.getSemaphore(fileName, targetPath)
+	if sem == nil {
+		return func() {}
+	}
+	// context.Background() is never canceled, so Acquire could not fail
+	_ = sem.Acquire(context.Background(), 1)
+	return func() {
+		sem.Release(1)
+	}
+}
+
+func (limiter *RestoreConcurrencyLimiter) getSemaphore(fileName, targetPath string) *semaphore.Weighted {
+	tablespaceName, ok := getTablespaceName(fileName)
+	if !ok {
+		tablespaceName = DefaultTablespaceName
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	if limit, ok := limiter.tablespaceLimits[tablespaceName]; ok {
+		return limiter.getOrCreateSemaphore("tablespace:"+tablespaceName, limit)
+	}
+	if limiter.deviceLimit == 0 {
+		return nil
+	}
+	key, ok := limiter.getDeviceKey(filepath.Dir(targetPath))
+	if !ok {
+		return nil
+	}
+	return limiter.getOrCreateSemaphore(key, limiter.deviceLimit)
+}
+
+func (limiter *RestoreConcurrencyLimiter) getOrCreateSemaphore(key string, limit int) *semaphore.Weighted {
+	sem, ok := limiter.semaphores[key]
+	if !ok {
+		sem = semaphore.NewWeighted(int64(limit))
+		limiter.semaphores[key] = sem
+	}
+	return sem
+}
+
+// getDeviceKey detects the device of the directory or of its nearest existing parent
+func (limiter *RestoreConcurrencyLimiter) getDeviceKey(dir string) (string, bool) {
+	if key, ok := limiter.dirKeys[dir]; ok {
+		return key, key != ""
+	}
+	for current := dir; ; current = filepath.Dir(current) {
+		info, err := os.Stat(current)
+		if err == nil {
+			key := ""
+			if deviceID, ok := getDeviceID(info); ok {
+				key = fmt.Sprintf("device:%d", deviceID)
+			}
+			// the missing directory may be created later on the other device, so cache only the existing one
+			if current == dir {
+				limiter.dirKeys[dir] = key
+			}
+			return key, key != ""
+		}
+		if filepath.Dir(current) == current {
+			return "", false
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package postgres_test
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func TestParseTablespaceConcurrency(t *testing.T) {
+	limits, err := postgres.ParseTablespaceConcurrency("pg_default:4, 16385:1")
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"pg_default": 4, "16385": 1}, limits)
+}
+
+func TestParseTablespaceConcurrency_Empty(t *testing.T) {
+	limits, err := postgres.ParseTablespaceConcurrency("")
+
+	require.NoError(t, err)
+	assert.Empty(t, limits)
+}
+
+func TestParseTablespaceConcurrency_Invalid(t *testing.T) {
+	for _, value := range []string{"16385", "16385:0", "16385:x", ":2"} {
+		_, err := postgres.ParseTablespaceConcurrency(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func measureMaxConcurrency(limiter *postgres.RestoreConcurrencyLimiter, fileName, targetPath string) int32 {
+	var current, maxCurrent int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := limiter.Acquire(fileName, targetPath)
+			defer release()
+			value := atomic.AddInt32(&current, 1)
+			for {
+				prev := atomic.LoadInt32(&maxCurrent)
+				if value <= prev || atomic.CompareAndSwapInt32(&maxCurrent, prev, value) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&current, -1)
+		}()
+	}
+	wg.Wait()
+	return maxCurrent
+}
+
+func TestRestoreConcurrencyLimiter_TablespaceLimit(t *testing.T) {
+	limiter := postgres.NewRestoreConcurrencyLimiter(map[string]int{"16385": 2}, 0)
+
+	maxConcurrency := measureMaxConcurrency(limiter, "/pg_tblspc/16385/PG_14_202107181/1/1259", "/tmp/1259")
+
+	assert.LessOrEqual(t, maxConcurrency, int32(2))
+}
+
+func TestRestoreConcurrencyLimiter_DeviceLimit(t *testing.T) {
+	dir := t.TempDir()
+	limiter := postgres.NewRestoreConcurrencyLimiter(map[string]int{}, 1)
+
+	maxConcurrency := measureMaxConcurrency(limiter, "/base/1/1259", filepath.Join(dir, "base", "1", "1259"))
+
+	assert.Equal(t, int32(1), maxConcurrency)
+}
+
+func TestRestoreConcurrencyLimiter_Unlimited(t *testing.T) {
+	limiter := postgres.NewRestoreConcurrencyLimiter(map[string]int{"16385": 1}, 0)
+
+	maxConcurrency := measureMaxConcurrency(limiter, "/base/1/1259", "/tmp/1259")
+
+	assert.Greater(t, maxConcurrency, int32(1))
+}
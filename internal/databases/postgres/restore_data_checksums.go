@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+type DataChecksumsMismatchError struct {
+	error
+}
+
+func newDataChecksumsMismatchError(message string) DataChecksumsMismatchError {
+	return DataChecksumsMismatchError{errors.New(message)}
+}
+
+func (err DataChecksumsMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// ConfigureExpectedDataChecksums returns whether the restored cluster is expected to have the data checksums
+// enabled, nil if WALG_RESTORE_DATA_CHECKSUMS is not set
+func ConfigureExpectedDataChecksums() (*bool, error) {
+	if !viper.IsSet(internal.RestoreDataChecksumsSetting) {
+		return nil, nil
+	}
+	expected, err := strconv.ParseBool(viper.GetString(internal.RestoreDataChecksumsSetting))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", internal.RestoreDataChecksumsSetting)
+	}
+	return &expected, nil
+}
+
+func describeDataChecksums(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// CheckDataChecksums reads the data checksums setting from the restored pg_control and compares it
+// with the expected one. Without the expectation the setting is only logged. The mismatch is logged
+// as the error, it fails the check only if strict is set, as does the setting which can't be read
+// while some setting is expected. The check is skipped if pg_control was not restored.
+func CheckDataChecksums(dbDataDirectory string, expected *bool, strict bool) error {
+	_, err := os.Stat(filepath.Join(dbDataDirectory, PgControlPath))
+	if os.IsNotExist(err) {
+		tracelog.InfoLogger.Printf("%s is not restored, the data checksums check is skipped\n", PgControlPath)
+		return nil
+	}
+	pgControlData, err := ExtractPgControl(dbDataDirectory)
+	var checksumVersion uint32
+	known := false
+	if err == nil {
+		checksumVersion, known = pgControlData.GetDataChecksumVersion()
+	}
+	if !known {
+		message := fmt.Sprintf("failed to read the data checksums setting from the restored %s", PgControlPath)
+		if err != nil {
+			message = fmt.Sprintf("%s: %v", message, err)
+		}
+		if strict && expected != nil {
+			return newDataChecksumsMismatchError(message)
+		}
+		tracelog.WarningLogger.Println(message)
+		return nil
+	}
+
+	enabled := checksumVersion != 0
+	if expected == nil {
+		tracelog.InfoLogger.Printf("Data checksums are %s in the restored cluster\n", describeDataChecksums(enabled))
+		return nil
+	}
+	if enabled == *expected {
+		tracelog.DebugLogger.Printf("Data checksums are %s in the restored cluster as expected\n",
+			describeDataChecksums(enabled))
+		return nil
+	}
+	mismatchErr := newDataChecksumsMismatchError(fmt.Sprintf(
+		"data checksums are %s in the restored cluster, but expected to be %s",
+		describeDataChecksums(enabled), describeDataChecksums(*expected)))
+	if strict {
+		return mismatchErr
+	}
+	tracelog.ErrorLogger.Printf("WARNING: %v\n", mismatchErr)
+	return nil
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeChecksumsTestPgControl(t *testing.T, checksumVersion uint32) string {
+	dbDataDirectory := t.TempDir()
+	pgControl := make([]byte, pgControlSize)
+	binary.LittleEndian.PutUint32(pgControl[8:12], 1300)
+	binary.LittleEndian.PutUint32(pgControl[252:256], checksumVersion)
+	require.NoError(t, os.MkdirAll(filepath.Join(dbDataDirectory, "global"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dbDataDirectory, PgControlPath), pgControl, 0600))
+	return dbDataDirectory
+}
+
+func TestCheckDataChecksums(t *testing.T) {
+	enabled, disabled := true, false
+	withChecksums := writeChecksumsTestPgControl(t, 1)
+	withoutChecksums := writeChecksumsTestPgControl(t, 0)
+
+	assert.NoError(t, CheckDataChecksums(withChecksums, &enabled, true))
+	assert.NoError(t, CheckDataChecksums(withoutChecksums, nil, true))
+	// the mismatch only warns unless strict
+	assert.NoError(t, CheckDataChecksums(withoutChecksums, &enabled, false))
+	assert.IsType(t, DataChecksumsMismatchError{}, CheckDataChecksums(withoutChecksums, &enabled, true))
+	assert.IsType(t, DataChecksumsMismatchError{}, CheckDataChecksums(withChecksums, &disabled, true))
+}
+
+func TestCheckDataChecksums_UnreadablePgControl(t *testing.T) {
+	expected := true
+	dbDataDirectory := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dbDataDirectory, "global"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dbDataDirectory, PgControlPath), []byte("short"), 0600))
+
+	assert.NoError(t, CheckDataChecksums(dbDataDirectory, &expected, false))
+	assert.Error(t, CheckDataChecksums(dbDataDirectory, &expected, true))
+	// pg_control is not restored
+	assert.NoError(t, CheckDataChecksums(t.TempDir(), &expected, true))
+}
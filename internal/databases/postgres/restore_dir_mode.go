@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"strconv"
+
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// DefaultRestoreDirMode is the mode of the restored directories which have no mode stored in the backup,
+// PostgreSQL requires the data directory to be accessible by its owner only
+const DefaultRestoreDirMode os.FileMode = 0700
+
+// configureRestoreDirMode returns the mode of the restored directories without the stored mode
+// from WALG_RESTORE_DIR_MODE, the invalid setting falls back to the default with the warning
+func configureRestoreDirMode() os.FileMode {
+	value := viper.GetString(internal.RestoreDirModeSetting)
+	if value == "" {
+		return DefaultRestoreDirMode
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		tracelog.WarningLogger.Printf("Invalid %s '%s', expected the octal permission bits, %#o is used\n",
+			internal.RestoreDirModeSetting, value, DefaultRestoreDirMode)
+		return DefaultRestoreDirMode
+	}
+	return os.FileMode(mode)
+}
+
+// getDirMode returns the mode of the missing parent directories created for the restored entries
+func (tarInterpreter *FileTarInterpreter) getDirMode() os.FileMode {
+	if tarInterpreter.dirMode == 0 {
+		return DefaultRestoreDirMode
+	}
+	return tarInterpreter.dirMode
+}
+
+// getEntryDirMode returns the mode stored in the directory entry, or the default one if it has none
+func (tarInterpreter *FileTarInterpreter) getEntryDirMode(fileInfo *tar.Header) os.FileMode {
+	if mode := os.FileMode(fileInfo.Mode).Perm(); mode != 0 {
+		return mode
+	}
+	return tarInterpreter.getDirMode()
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestInterpretTypeDir_RestoresStoredMode(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "pgdata")
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+
+	require.NoError(t, tarInterpreter.Interpret(strings.NewReader(""),
+		&tar.Header{Name: "/base", Typeflag: tar.TypeDir, Mode: 0700}))
+	require.NoError(t, tarInterpreter.Interpret(strings.NewReader(""),
+		&tar.Header{Name: "/pg_stat", Typeflag: tar.TypeDir}))
+
+	for _, name := range []string{"", "base", "pg_stat"} {
+		info, err := os.Stat(filepath.Join(dataDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), name)
+	}
+}
+
+func TestUnwrapRegularFileNew_CreatesParentsWithDirMode(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "pgdata")
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	targetPath := filepath.Join(dataDir, "base", "1", "1259")
+
+	require.NoError(t, tarInterpreter.unwrapRegularFileNew(strings.NewReader("data"),
+		&tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Size: 4}, targetPath, false, nil))
+
+	for _, name := range []string{"", "base", "base/1"} {
+		info, err := os.Stat(filepath.Join(dataDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), name)
+	}
+}
+
+func TestConfigureRestoreDirMode(t *testing.T) {
+	defer viper.Set(internal.RestoreDirModeSetting, nil)
+
+	viper.Set(internal.RestoreDirModeSetting, "0750")
+	assert.Equal(t, os.FileMode(0750), configureRestoreDirMode())
+
+	viper.Set(internal.RestoreDirModeSetting, "rwx")
+	assert.Equal(t, DefaultRestoreDirMode, configureRestoreDirMode())
+
+	viper.Set(internal.RestoreDirModeSetting, "17777")
+	assert.Equal(t, DefaultRestoreDirMode, configureRestoreDirMode())
+}
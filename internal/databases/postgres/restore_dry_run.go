@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// RestoreAction is what the restore would do with the tar entry
+type RestoreAction string
+
+const (
+	// RestoreActionCreate means the entry would be created since its path does not exist
+	RestoreActionCreate RestoreAction = "create"
+	// RestoreActionOverwrite means the existing path, or the one written by the previous backup of the chain,
+	// would be overwritten in place
+	RestoreActionOverwrite RestoreAction = "overwrite"
+	// RestoreActionSkip means the file would not be written since it is not among the files to unwrap or is excluded
+	RestoreActionSkip RestoreAction = "skip"
+)
+
+var restoreActions = []RestoreAction{RestoreActionCreate, RestoreActionOverwrite, RestoreActionSkip}
+
+// RestoreDryRun makes FileTarInterpreter record the intended action for every tar entry instead of writing it.
+// The paths which would be written are remembered across the backups of the delta chain, so the files
+// restored by the base backup are reported as overwritten by the increments.
+type RestoreDryRun struct {
+	mutex   sync.Mutex
+	planned map[string]bool
+	counts  map[RestoreAction]int
+	sizes   map[RestoreAction]int64
+}
+
+func NewRestoreDryRun() *RestoreDryRun {
+	return &RestoreDryRun{
+		planned: make(map[string]bool),
+		counts:  make(map[RestoreAction]int),
+		sizes:   make(map[RestoreAction]int64),
+	}
+}
+
+// plan records the action the restore would do with the entry written to the target path
+func (dryRun *RestoreDryRun) plan(tarInterpreter *FileTarInterpreter, fileInfo *tar.Header, targetPath string) {
+	isRegular := fileInfo.Typeflag == tar.TypeReg || fileInfo.Typeflag == tar.TypeRegA
+	action := RestoreActionCreate
+	if isRegular && tarInterpreter.FilesToUnwrap != nil && !tarInterpreter.FilesToUnwrap[fileInfo.Name] {
+		action = RestoreActionSkip
+	}
+	if isRegular && tarInterpreter.policy.exclusion.excludes(fileInfo.Name) {
+		action = RestoreActionSkip
+	}
+
+	dryRun.mutex.Lock()
+	if action != RestoreActionSkip {
+		if _, err := os.Lstat(targetPath); err == nil || dryRun.planned[targetPath] {
+			action = RestoreActionOverwrite
+		}
+		dryRun.planned[targetPath] = true
+	}
+	dryRun.counts[action]++
+	if isRegular {
+		dryRun.sizes[action] += fileInfo.Size
+	}
+	dryRun.mutex.Unlock()
+
+	tracelog.DebugLogger.Printf("Dry run: %s '%s'\n", action, fileInfo.Name)
+	tarInterpreter.addToPlannedActions(fileInfo.Name, action)
+}
+
+// WriteSummary writes the table of the number of the tar entries and the bytes of the regular files per action
+func (dryRun *RestoreDryRun) WriteSummary(output io.Writer) error {
+	dryRun.mutex.Lock()
+	defer dryRun.mutex.Unlock()
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(writer, "action\tentries\tbytes")
+	for _, action := range restoreActions {
+		fmt.Fprintf(writer, "%s\t%d\t%d\n", action, dryRun.counts[action], dryRun.sizes[action])
+	}
+	return writer.Flush()
+}
+
+func (tarInterpreter *FileTarInterpreter) addToPlannedActions(fileName string, action RestoreAction) {
+	tarInterpreter.UnwrapResult.plannedActionsMutex.Lock()
+	tarInterpreter.UnwrapResult.plannedActions[fileName] = action
+	tarInterpreter.UnwrapResult.plannedActionsMutex.Unlock()
+}
+
+// GetPgFetcherDryRun returns the fetcher which walks the delta chain of the backup and reports
+// what the restore would write to the data directory without touching it
+func GetPgFetcherDryRun(dbDataDirectory, fileMask string, options FetchOptions,
+	output io.Writer) func(rootFolder storage.Folder, backup internal.Backup) {
+	return func(rootFolder storage.Folder, backup internal.Backup) {
+		pgBackup := ToPgBackup(backup)
+		filesToUnwrap, err := options.selectFilesToUnwrap(pgBackup, fileMask)
+		tracelog.ErrorLogger.FatalfOnError("Failed to plan the restore: %v\n", err)
+		resolvedDataDirectory := utility.ResolveSymlink(dbDataDirectory)
+		dryRun := NewRestoreDryRun()
+		interpreterOptions := []FileTarInterpreterOption{WithRestoreDryRun(dryRun)}
+		if options.Exclusion != nil {
+			interpreterOptions = append(interpreterOptions, WithRestoreExclusion(options.Exclusion))
+		}
+		if options.PartAllowlist != nil {
+			interpreterOptions = append(interpreterOptions, WithPartAllowlist(options.PartAllowlist))
+		}
+		if options.UnwrapReport != nil {
+			interpreterOptions = append(interpreterOptions, WithUnwrapReport(options.UnwrapReport))
+		}
+		err = deltaFetchRecursionDryRun(pgBackup, rootFolder, resolvedDataDirectory, filesToUnwrap,
+			interpreterOptions...)
+		if err == nil && options.UnwrapReport != nil {
+			err = options.UnwrapReport.Finish()
+		}
+		tracelog.ErrorLogger.FatalfOnError("Failed to plan the restore: %v\n", err)
+		tracelog.InfoLogger.Printf("Dry run of the restore of %s to %s, nothing is written\n",
+			pgBackup.Name, resolvedDataDirectory)
+		tracelog.ErrorLogger.FatalOnError(dryRun.WriteSummary(output))
+	}
+}
+
+// deltaFetchRecursionDryRun is the same as deltaFetchRecursionOld, but neither checks nor prepares
+// the data directory, since the tar interpreter does not write to it
+func deltaFetchRecursionDryRun(backup Backup, folder storage.Folder, dbDataDirectory string,
+	filesToUnwrap map[string]bool, interpreterOptions ...FileTarInterpreterOption) error {
+	sentinelDto, filesMetaDto, err := backup.GetSentinelAndFilesMetadata()
+	if err != nil {
+		return err
+	}
+	if sentinelDto.IsIncremental() {
+		baseFilesToUnwrap, err := GetBaseFilesToUnwrap(filesMetaDto.Files, filesToUnwrap)
+		if err != nil {
+			return err
+		}
+		incrementFrom := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), *sentinelDto.IncrementFrom)
+		err = deltaFetchRecursionDryRun(incrementFrom, folder, dbDataDirectory, baseFilesToUnwrap, interpreterOptions...)
+		if err != nil {
+			return err
+		}
+	} else if isEmpty, err := isDirectoryEmptyForRestore(dbDataDirectory); err == nil && !isEmpty &&
+		!allowsNonEmptyDirectory(interpreterOptions...) {
+		tracelog.WarningLogger.Printf("The restore would fail: %v\n", NewNonEmptyDBDataDirectoryError(dbDataDirectory))
+	}
+	return backup.unwrapOld(dbDataDirectory, sentinelDto, filesMetaDto, filesToUnwrap, false, interpreterOptions...)
+}
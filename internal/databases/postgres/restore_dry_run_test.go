@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestDeltaFetchRecursionDryRun(t *testing.T) {
+	folder := putSyntheticTestChain(t)
+	dbDataDirectory := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dbDataDirectory, "PG_VERSION"), []byte("13\n"), 0600))
+	deltaBackup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), diffTestDeltaBackup)
+	filesToUnwrap, err := deltaBackup.GetFilesToUnwrap("")
+	require.NoError(t, err)
+	delete(filesToUnwrap, "/base/1/1260")
+	dryRun := NewRestoreDryRun()
+	report := NewRestoreUnwrapReport("")
+
+	err = deltaFetchRecursionDryRun(deltaBackup, folder, dbDataDirectory, filesToUnwrap,
+		WithRestoreDryRun(dryRun), WithUnwrapReport(report))
+
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dbDataDirectory)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	content, err := os.ReadFile(filepath.Join(dbDataDirectory, "PG_VERSION"))
+	require.NoError(t, err)
+	assert.Equal(t, "13\n", string(content))
+
+	backups := report.Build().Backups
+	require.Len(t, backups, 2)
+	assert.Equal(t, []PlannedActionDto{
+		{"/PG_VERSION", RestoreActionOverwrite},
+		{"/base", RestoreActionCreate},
+		{"/base/1", RestoreActionCreate},
+		{"/base/1/1259", RestoreActionCreate},
+		{"/base/1/1260", RestoreActionSkip},
+		// pg_control is restored from the fetched backup only
+		{PgControlPath, RestoreActionSkip},
+	}, backups[0].PlannedActions)
+	// the file restored by the base backup is overwritten by its increment
+	assert.Equal(t, []PlannedActionDto{
+		{"/base/1/1259", RestoreActionOverwrite},
+		{PgControlPath, RestoreActionCreate},
+	}, backups[1].PlannedActions)
+
+	var summary bytes.Buffer
+	require.NoError(t, dryRun.WriteSummary(&summary))
+	assert.Regexp(t, `^action +entries +bytes\ncreate +4 +24581\noverwrite +2 +\d+\nskip +2 +8196\n$`, summary.String())
+}
@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// maxReportedForeignFiles limits the number of the foreign files listed in the error
+const maxReportedForeignFiles = 10
+
+func newForeignFilesInDataDirectoryError(dbDataDirectory string, foreignFiles []string) NonEmptyDBDataDirectoryError {
+	return NonEmptyDBDataDirectoryError{errors.Errorf(
+		"directory %v must be empty or hold only the files allowed by %s, but it holds: %s; "+
+			"use --force to restore over them", dbDataDirectory, internal.RestoreAllowedFilesSetting,
+		describeForeignFiles(foreignFiles))}
+}
+
+func describeForeignFiles(foreignFiles []string) string {
+	if len(foreignFiles) <= maxReportedForeignFiles {
+		return strings.Join(foreignFiles, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(foreignFiles[:maxReportedForeignFiles], ", "),
+		len(foreignFiles)-maxReportedForeignFiles)
+}
+
+// getRestoreAllowedFiles returns the glob patterns of WALG_RESTORE_ALLOWED_FILES, matched against
+// the slash-separated paths relative to the data directory
+func getRestoreAllowedFiles() ([]string, error) {
+	patterns := make([]string, 0)
+	for _, pattern := range strings.Split(viper.GetString(internal.RestoreAllowedFilesSetting), ",") {
+		pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern '%s' in %s", pattern, internal.RestoreAllowedFilesSetting)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func isAllowedFile(relativePath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, relativePath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// findForeignFiles returns the sorted relative paths of the files and directories in the directory
+// not matched by the patterns. The contents of the allowed or foreign directory are not inspected.
+func findForeignFiles(directoryPath string, patterns []string) ([]string, error) {
+	foreignFiles := make([]string, 0)
+	err := filepath.Walk(directoryPath, func(filePath string, info os.FileInfo, err error) error {
+		if filePath == directoryPath {
+			// the missing directory is empty
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(directoryPath, filePath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if !isAllowedFile(relativePath, patterns) {
+			foreignFiles = append(foreignFiles, relativePath)
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't check, that directory: '%s' is empty", directoryPath)
+	}
+	sort.Strings(foreignFiles)
+	return foreignFiles, nil
+}
+
+// isDirectoryEmptyForRestore returns whether the directory holds nothing but the files allowed
+// by WALG_RESTORE_ALLOWED_FILES, such as lost+found of the dedicated file system
+func isDirectoryEmptyForRestore(directoryPath string) (bool, error) {
+	patterns, err := getRestoreAllowedFiles()
+	if err != nil {
+		return false, err
+	}
+	foreignFiles, err := findForeignFiles(directoryPath, patterns)
+	if err != nil {
+		return false, err
+	}
+	for _, foreignFile := range foreignFiles {
+		tracelog.InfoLogger.Printf("found file '%s' in directory: '%s'\n", foreignFile, directoryPath)
+	}
+	return len(foreignFiles) == 0, nil
+}
+
+// allowsNonEmptyDirectory returns whether the interpreter options let the full backup be unwrapped
+// into the non-empty directory: the resumed restore continues in the directory partially restored
+// by the previous run, and the forced one is checked by the fetch pre-flight
+func allowsNonEmptyDirectory(interpreterOptions ...FileTarInterpreterOption) bool {
+	tarInterpreter := &FileTarInterpreter{}
+	for _, option := range interpreterOptions {
+		option(tarInterpreter)
+	}
+	return tarInterpreter.allowNonEmptyDirectory || tarInterpreter.resumeManifest.isResuming()
+}
+
+// restoreCleanupOf returns the restore cleanup set by the interpreter options, if any
+func restoreCleanupOf(interpreterOptions ...FileTarInterpreterOption) *RestoreCleanup {
+	tarInterpreter := &FileTarInterpreter{}
+	for _, option := range interpreterOptions {
+		option(tarInterpreter)
+	}
+	return tarInterpreter.cleanup
+}
+
+// checkDataDirectoryEmpty verifies before the fetch starts that the data directory is empty or holds only
+// the allowed files. The foreign files fail the check unless AllowNonEmptyDirectory is set, then they are
+// only logged. The resumed restore is not checked.
+func (options FetchOptions) checkDataDirectoryEmpty(dbDataDirectory string) error {
+	if options.ResumeManifest.isResuming() {
+		return nil
+	}
+	patterns, err := getRestoreAllowedFiles()
+	if err != nil {
+		return err
+	}
+	foreignFiles, err := findForeignFiles(dbDataDirectory, patterns)
+	if err != nil || len(foreignFiles) == 0 {
+		return err
+	}
+	if !options.AllowNonEmptyDirectory {
+		return newForeignFilesInDataDirectoryError(dbDataDirectory, foreignFiles)
+	}
+	tracelog.WarningLogger.Printf("Restoring over the files in %s: %s\n", dbDataDirectory,
+		describeForeignFiles(foreignFiles))
+	return nil
+}
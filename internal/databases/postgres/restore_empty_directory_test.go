@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func writeEmptyDirectoryTestFiles(t *testing.T, dbDataDirectory string, fileNames ...string) {
+	for _, fileName := range fileNames {
+		filePath := filepath.Join(dbDataDirectory, fileName)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0700))
+		require.NoError(t, os.WriteFile(filePath, []byte("data"), 0600))
+	}
+}
+
+func TestCheckDataDirectoryEmpty(t *testing.T) {
+	viper.Set(internal.RestoreAllowedFilesSetting, "lost+found, *.conf")
+	defer viper.Set(internal.RestoreAllowedFilesSetting, nil)
+	options := FetchOptions{}
+
+	// the empty or missing directory
+	dbDataDirectory := t.TempDir()
+	assert.NoError(t, options.checkDataDirectoryEmpty(dbDataDirectory))
+	assert.NoError(t, options.checkDataDirectoryEmpty(filepath.Join(dbDataDirectory, "missing")))
+
+	// only the allowed files, the contents of the allowed directory are not inspected
+	writeEmptyDirectoryTestFiles(t, dbDataDirectory, "lost+found/#123", "postgresql.conf")
+	assert.NoError(t, options.checkDataDirectoryEmpty(dbDataDirectory))
+	isEmpty, err := isDirectoryEmptyForRestore(dbDataDirectory)
+	assert.NoError(t, err)
+	assert.True(t, isEmpty)
+}
+
+func TestCheckDataDirectoryEmpty_PartiallyRestored(t *testing.T) {
+	viper.Set(internal.RestoreAllowedFilesSetting, "lost+found")
+	defer viper.Set(internal.RestoreAllowedFilesSetting, nil)
+	dbDataDirectory := t.TempDir()
+	writeEmptyDirectoryTestFiles(t, dbDataDirectory, "lost+found/#123", "base/1/1259", "base/1/1249", "PG_VERSION")
+
+	foreignFiles, err := findForeignFiles(dbDataDirectory, []string{"lost+found"})
+	require.NoError(t, err)
+	// the foreign directory is reported as a whole
+	assert.Equal(t, []string{"PG_VERSION", "base"}, foreignFiles)
+
+	err = FetchOptions{}.checkDataDirectoryEmpty(dbDataDirectory)
+	assert.IsType(t, NonEmptyDBDataDirectoryError{}, err)
+	assert.Contains(t, err.Error(), "PG_VERSION, base")
+	assert.NoError(t, FetchOptions{AllowNonEmptyDirectory: true}.checkDataDirectoryEmpty(dbDataDirectory))
+}
+
+func TestCheckDataDirectoryEmpty_ForeignContent(t *testing.T) {
+	viper.Set(internal.RestoreAllowedFilesSetting, "")
+	defer viper.Set(internal.RestoreAllowedFilesSetting, nil)
+	dbDataDirectory := t.TempDir()
+	writeEmptyDirectoryTestFiles(t, dbDataDirectory, "lost+found/#123")
+	for i := 0; i < maxReportedForeignFiles+2; i++ {
+		writeEmptyDirectoryTestFiles(t, dbDataDirectory, filepath.Join("other", string(rune('a'+i))), string(rune('a'+i)))
+	}
+
+	err := FetchOptions{}.checkDataDirectoryEmpty(dbDataDirectory)
+	assert.IsType(t, NonEmptyDBDataDirectoryError{}, err)
+	assert.Contains(t, err.Error(), "and 4 more")
+	isEmpty, err := isDirectoryEmptyForRestore(dbDataDirectory)
+	assert.NoError(t, err)
+	assert.False(t, isEmpty)
+
+	manifest, err := OpenRestoreResumeManifest(filepath.Join(t.TempDir(), "manifest"), dbDataDirectory)
+	require.NoError(t, err)
+	defer manifest.Finish(nil)
+	manifest.markRestored("base_000000010000000000000002", "PG_VERSION", "")
+	// the resumed restore continues in the partially restored directory
+	assert.NoError(t, FetchOptions{ResumeManifest: manifest}.checkDataDirectoryEmpty(dbDataDirectory))
+	assert.True(t, allowsNonEmptyDirectory(WithResumeManifest(manifest)))
+	assert.True(t, allowsNonEmptyDirectory(WithNonEmptyDirectoryAllowed()))
+	assert.False(t, allowsNonEmptyDirectory())
+}
+
+func TestGetRestoreAllowedFiles_InvalidPattern(t *testing.T) {
+	viper.Set(internal.RestoreAllowedFilesSetting, "lost+found,[")
+	defer viper.Set(internal.RestoreAllowedFilesSetting, nil)
+
+	_, err := getRestoreAllowedFiles()
+	assert.Error(t, err)
+}
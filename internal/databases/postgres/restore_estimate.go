@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// DefaultStreamThroughput is the conservative download and extraction throughput of a single
+// restore worker used when the restore throughput is not seeded by the past restores
+const DefaultStreamThroughput = 8 * 1024 * 1024
+
+// RestoreEstimate is the rough estimation of the backup restore duration
+type RestoreEstimate struct {
+	BackupName string
+	// BackupCount is the number of backups in the delta chain which have to be fetched
+	BackupCount int
+	// DownloadSize is the total compressed size of the backups in the chain
+	DownloadSize int64
+	// Throughput is the expected restore throughput in bytes per second
+	Throughput int64
+	// Seeded is true if the throughput is taken from the past restore metrics
+	Seeded   bool
+	Duration time.Duration
+}
+
+// EstimateRestoreDuration estimates how long the backup restore takes. The estimation is based on the total
+// compressed size of the delta chain and the restore throughput. If the throughput measured on the past
+// restores is not provided (zero), it is assumed to be DefaultStreamThroughput per download worker.
+// The result is accurate to an order of magnitude at best.
+func EstimateRestoreDuration(baseBackupFolder storage.Folder, backupName string,
+	concurrency int, seededThroughput int64) (RestoreEstimate, error) {
+	estimate := RestoreEstimate{BackupName: backupName, Throughput: seededThroughput, Seeded: seededThroughput > 0}
+	if !estimate.Seeded {
+		estimate.Throughput = int64(concurrency) * DefaultStreamThroughput
+	}
+	if estimate.Throughput <= 0 {
+		return RestoreEstimate{}, errors.Errorf("invalid restore throughput %d", estimate.Throughput)
+	}
+
+	for currentName := backupName; ; {
+		backup := NewBackup(baseBackupFolder, currentName)
+		sentinelDto, err := backup.GetSentinel()
+		if err != nil {
+			return RestoreEstimate{}, err
+		}
+		estimate.BackupCount++
+		size := sentinelDto.CompressedSize
+		if size == 0 {
+			// the old backups do not store the compressed size, so be conservative
+			size = sentinelDto.UncompressedSize
+		}
+		estimate.DownloadSize += size
+		if !sentinelDto.IsIncremental() {
+			break
+		}
+		currentName = *sentinelDto.IncrementFrom
+	}
+
+	estimate.Duration = time.Duration(float64(estimate.DownloadSize) / float64(estimate.Throughput) * float64(time.Second))
+	return estimate, nil
+}
+
+// HandleRestoreEstimate prints the estimated duration of the selected backup restore
+func HandleRestoreEstimate(folder storage.Folder, backupSelector internal.BackupSelector, output io.Writer) {
+	backupName, err := backupSelector.Select(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
+	concurrency, err := internal.GetMaxDownloadConcurrency()
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	estimate, err := EstimateRestoreDuration(folder.GetSubFolder(utility.BaseBackupPath), backupName, concurrency,
+		viper.GetInt64(internal.RestoreThroughputSetting))
+	tracelog.ErrorLogger.FatalfOnError("Failed to estimate the restore duration: %v\n", err)
+
+	throughputSource := "default"
+	if estimate.Seeded {
+		throughputSource = "seeded"
+	}
+	_, err = fmt.Fprintf(output, "Backup %s: %d backups to fetch, %d bytes to download at %d bytes/s (%s), "+
+		"estimated restore duration %s\n", estimate.BackupName, estimate.BackupCount, estimate.DownloadSize,
+		estimate.Throughput, throughputSource, estimate.Duration.Round(time.Second))
+	tracelog.ErrorLogger.FatalOnError(err)
+}
@@ -0,0 +1,62 @@
+package postgres_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestEstimateRestoreDuration_DeltaChain(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	fullSentinel := makeTestSentinel(100, "", "", 0)
+	fullSentinel.CompressedSize = 64 * 1024 * 1024
+	deltaSentinel := makeTestSentinel(200, "base_full", "base_full", 100)
+	deltaSentinel.CompressedSize = 16 * 1024 * 1024
+	putTestSentinel(t, folder, "base_full", fullSentinel)
+	putTestSentinel(t, folder, "base_delta", deltaSentinel)
+
+	estimate, err := postgres.EstimateRestoreDuration(folder.GetSubFolder(utility.BaseBackupPath), "base_delta", 2, 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, estimate.BackupCount)
+	assert.Equal(t, int64(80*1024*1024), estimate.DownloadSize)
+	assert.False(t, estimate.Seeded)
+	assert.Equal(t, int64(2*postgres.DefaultStreamThroughput), estimate.Throughput)
+	assert.Equal(t, 5*time.Second, estimate.Duration)
+}
+
+func TestEstimateRestoreDuration_SeededThroughput(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	sentinel := makeTestSentinel(100, "", "", 0)
+	sentinel.UncompressedSize = 3000
+	putTestSentinel(t, folder, "base_full", sentinel)
+
+	estimate, err := postgres.EstimateRestoreDuration(folder.GetSubFolder(utility.BaseBackupPath), "base_full", 10, 1000)
+
+	require.NoError(t, err)
+	assert.True(t, estimate.Seeded)
+	assert.Equal(t, int64(3000), estimate.DownloadSize)
+	assert.Equal(t, 3*time.Second, estimate.Duration)
+}
+
+func TestHandleRestoreEstimate(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	sentinel := makeTestSentinel(100, "", "", 0)
+	sentinel.CompressedSize = 8 * 1024 * 1024
+	putTestSentinel(t, folder, "base_full", sentinel)
+	selector, err := internal.NewBackupNameSelector("base_full", true)
+	require.NoError(t, err)
+
+	var output bytes.Buffer
+	postgres.HandleRestoreEstimate(folder, selector, &output)
+
+	assert.Contains(t, output.String(), "Backup base_full: 1 backups to fetch")
+	assert.Contains(t, output.String(), "estimated restore duration")
+}
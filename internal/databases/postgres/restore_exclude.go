@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"archive/tar"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// RestoreExclusion makes the restore skip the regular files matching any of the shell file patterns.
+// The patterns are matched against the path relative to the data directory and against each of its parent
+// directories, e.g. "pg_wal" excludes all the files under pg_wal. The directories themselves are still created,
+// so the excluded pg_wal or the database directory is left empty as PostgreSQL requires.
+// The utility files needed to start the restored cluster, e.g. pg_control, are never excluded.
+type RestoreExclusion struct {
+	patterns []string
+}
+
+func NewRestoreExclusion(patterns []string) (*RestoreExclusion, error) {
+	exclusion := &RestoreExclusion{patterns: make([]string, 0, len(patterns))}
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" {
+			return nil, errors.New("the restore exclusion pattern must not be empty")
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid restore exclusion pattern '%s'", pattern)
+		}
+		exclusion.patterns = append(exclusion.patterns, pattern)
+	}
+	return exclusion, nil
+}
+
+// excludes returns true if the backup file matches any of the patterns
+func (exclusion *RestoreExclusion) excludes(fileName string) bool {
+	if exclusion == nil {
+		return false
+	}
+	name := strings.TrimPrefix(fileName, "/")
+	if UtilityFilePaths[fileName] || UtilityFilePaths[name] || UtilityFilePaths["/"+name] {
+		return false
+	}
+	for ; name != "." && name != ""; name = path.Dir(name) {
+		for _, pattern := range exclusion.patterns {
+			// the patterns are validated by NewRestoreExclusion
+			if matched, _ := filepath.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipExcludedFile records the excluded file as skipped, its directory is created if the tar has no entry for it
+func (tarInterpreter *FileTarInterpreter) skipExcludedFile(fileInfo *tar.Header, targetPath string) error {
+	tracelog.DebugLogger.Printf("'%s' is excluded from the restore\n", fileInfo.Name)
+	tarInterpreter.addToSkippedFiles(fileInfo.Name, false)
+	tarInterpreter.metrics.trackSkippedFile()
+	return errors.Wrapf(PrepareDirs(fileInfo.Name, targetPath, tarInterpreter.getDirMode()),
+		"failed to create the directory of the excluded file '%s'", fileInfo.Name)
+}
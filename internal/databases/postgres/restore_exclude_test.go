@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interpretExclusionTestEntries interprets the directory entries and the regular files of the backup
+func interpretExclusionTestEntries(t *testing.T, tarInterpreter *FileTarInterpreter, dirs, files []string) {
+	for _, dir := range dirs {
+		require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil), &tar.Header{
+			Name:     dir,
+			Typeflag: tar.TypeDir,
+			Mode:     0700,
+		}))
+	}
+	for _, fileName := range files {
+		content := []byte("content")
+		require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+			Name:     fileName,
+			Typeflag: tar.TypeReg,
+			Mode:     0600,
+			Size:     int64(len(content)),
+		}))
+	}
+}
+
+func newExclusionTestInterpreter(t *testing.T, dbDataDirectory string, patterns ...string) *FileTarInterpreter {
+	exclusion, err := NewRestoreExclusion(patterns)
+	require.NoError(t, err)
+	return NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithRestoreExclusion(exclusion))
+}
+
+func TestRestoreExclusion_ExcludesPgWal(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := newExclusionTestInterpreter(t, dbDataDirectory, "pg_wal")
+
+	interpretExclusionTestEntries(t, tarInterpreter, []string{"/pg_wal", "/pg_wal/archive_status"},
+		[]string{"/pg_wal/000000010000000000000002", "/pg_wal/archive_status/000000010000000000000002.done",
+			"/base/1/1259", PgControlPath})
+
+	for _, dir := range []string{"pg_wal", "pg_wal/archive_status"} {
+		entries, err := os.ReadDir(filepath.Join(dbDataDirectory, dir))
+		require.NoError(t, err)
+		assert.Len(t, entries, map[string]int{"pg_wal": 1, "pg_wal/archive_status": 0}[dir])
+	}
+	_, err := os.Stat(filepath.Join(dbDataDirectory, "pg_wal", "000000010000000000000002"))
+	assert.True(t, os.IsNotExist(err))
+	for _, fileName := range []string{"/base/1/1259", PgControlPath} {
+		_, err = os.Stat(filepath.Join(dbDataDirectory, fileName))
+		assert.NoError(t, err)
+	}
+	assert.ElementsMatch(t, []string{"/pg_wal/000000010000000000000002",
+		"/pg_wal/archive_status/000000010000000000000002.done"}, tarInterpreter.UnwrapResult.ToDto().SkippedFiles)
+	assert.Equal(t, 2, tarInterpreter.UnwrapResult.Totals().CompletedFiles)
+}
+
+func TestRestoreExclusion_ExcludesRelation(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := newExclusionTestInterpreter(t, dbDataDirectory, "base/1/16384", "/base/1/16384.*")
+
+	// the tar has no entry of the database directory, it is still created for the excluded files
+	interpretExclusionTestEntries(t, tarInterpreter, nil,
+		[]string{"/base/1/16384", "/base/1/16384.1", "/base/1/16384_fsm", "/base/1/163840"})
+
+	entries, err := os.ReadDir(filepath.Join(dbDataDirectory, "base", "1"))
+	require.NoError(t, err)
+	restored := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		restored = append(restored, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"16384_fsm", "163840"}, restored)
+	assert.ElementsMatch(t, []string{"/base/1/16384", "/base/1/16384.1"}, tarInterpreter.UnwrapResult.ToDto().SkippedFiles)
+	assert.Equal(t, 2, tarInterpreter.UnwrapResult.Totals().SkippedFiles)
+}
+
+func TestRestoreExclusion_KeepsEmptyDatabaseDirectory(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := newExclusionTestInterpreter(t, dbDataDirectory, "base/16384/*")
+
+	interpretExclusionTestEntries(t, tarInterpreter, nil, []string{"/base/16384/1259"})
+
+	entries, err := os.ReadDir(filepath.Join(dbDataDirectory, "base", "16384"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRestoreExclusion_NeverExcludesUtilityFiles(t *testing.T) {
+	exclusion, err := NewRestoreExclusion([]string{"global", "backup_label", "*"})
+	require.NoError(t, err)
+
+	for utilityFilePath := range UtilityFilePaths {
+		assert.False(t, exclusion.excludes(utilityFilePath), utilityFilePath)
+	}
+	assert.True(t, exclusion.excludes("/global/1260"))
+}
+
+func TestNewRestoreExclusion_InvalidPattern(t *testing.T) {
+	_, err := NewRestoreExclusion([]string{"base/[1"})
+	assert.Error(t, err)
+	_, err = NewRestoreExclusion([]string{"/"})
+	assert.Error(t, err)
+}
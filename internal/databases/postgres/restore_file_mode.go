@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// restoredFileCreateMode returns the mode the restored file is created with: the stored permissions, further
+// masked by the process umask, with the owner read and write added, since the restore writes the file and may
+// reopen it. So the file is never more accessible than stored while it is written, e.g. the server.key.
+func restoredFileCreateMode(header *tar.Header) os.FileMode {
+	return os.FileMode(header.Mode).Perm() | 0600
+}
+
+// applyStoredFileMode sets the stored mode to the written file. The file created by the restore gets the exact
+// stored mode, while the existing file is only tightened to it, so the restore never loosens the permissions
+// of the file it updates. The entry without the stored mode leaves the file as is.
+func applyStoredFileMode(targetPath string, header *tar.Header, isNewFile bool) error {
+	storedMode := os.FileMode(header.Mode).Perm()
+	if storedMode == 0 {
+		return nil
+	}
+	mode := storedMode
+	if !isNewFile {
+		info, err := os.Stat(targetPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to stat '%s'", targetPath)
+		}
+		mode = info.Mode().Perm() & storedMode
+		if mode == info.Mode().Perm() {
+			return nil
+		}
+	}
+	if err := os.Chmod(targetPath, mode); err != nil {
+		return errors.Wrapf(err, "Interpret: chmod of '%s' failed", targetPath)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoredFileCreateMode(t *testing.T) {
+	assert.Equal(t, os.FileMode(0600), restoredFileCreateMode(&tar.Header{Mode: 0600}))
+	assert.Equal(t, os.FileMode(0640), restoredFileCreateMode(&tar.Header{Mode: 0640}))
+	// the owner always can write the file while it is restored
+	assert.Equal(t, os.FileMode(0640), restoredFileCreateMode(&tar.Header{Mode: 0440}))
+	assert.Equal(t, os.FileMode(0600), restoredFileCreateMode(&tar.Header{}))
+}
+
+func TestInterpretRestoresStoredFileModes(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	modes := map[string]os.FileMode{
+		"/server.key":      0600,
+		"/postgresql.conf": 0640,
+		"/base/1/1259":     0600,
+		// the group write bit is usually masked by the umask
+		"/pg_hba.conf": 0664,
+		"/script.sh":   0750,
+	}
+
+	for name, mode := range modes {
+		err := tarInterpreter.Interpret(bytes.NewReader([]byte("data")), &tar.Header{
+			Name: name, Typeflag: tar.TypeReg, Mode: int64(mode), Size: 4,
+		})
+		require.NoError(t, err)
+	}
+
+	for name, mode := range modes {
+		info, err := os.Stat(filepath.Join(dbDataDirectory, name))
+		require.NoError(t, err)
+		assert.Equal(t, mode, info.Mode().Perm(), name)
+	}
+}
+
+func TestUnwrapRegularFileNew_RestoresStoredFileModes(t *testing.T) {
+	dataDir := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	newPath := filepath.Join(dataDir, "server.key")
+	existingPath := filepath.Join(dataDir, "postgresql.conf")
+	require.NoError(t, os.WriteFile(existingPath, []byte("newer"), 0644))
+	require.NoError(t, os.Chmod(existingPath, 0644))
+
+	require.NoError(t, tarInterpreter.unwrapRegularFileNew(strings.NewReader("key"),
+		&tar.Header{Name: "/server.key", Typeflag: tar.TypeReg, Mode: 0600, Size: 3}, newPath, false, nil))
+	require.NoError(t, tarInterpreter.unwrapRegularFileNew(strings.NewReader("conf"),
+		&tar.Header{Name: "/postgresql.conf", Typeflag: tar.TypeReg, Mode: 0600, Size: 4}, existingPath, false, nil))
+
+	info, err := os.Stat(newPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	// the existing file is skipped as the newer one, but its permissions are tightened to the stored ones
+	info, err = os.Stat(existingPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestApplyStoredFileMode(t *testing.T) {
+	directory := t.TempDir()
+	writeFile := func(name string, mode os.FileMode) string {
+		filePath := filepath.Join(directory, name)
+		require.NoError(t, os.WriteFile(filePath, []byte("data"), mode))
+		require.NoError(t, os.Chmod(filePath, mode))
+		return filePath
+	}
+	getMode := func(filePath string) os.FileMode {
+		info, err := os.Stat(filePath)
+		require.NoError(t, err)
+		return info.Mode().Perm()
+	}
+
+	// the new file gets the exact stored mode
+	newFile := writeFile("new", 0600)
+	require.NoError(t, applyStoredFileMode(newFile, &tar.Header{Mode: 0644}, true))
+	assert.Equal(t, os.FileMode(0644), getMode(newFile))
+
+	// the existing file is tightened, but never loosened
+	looseFile := writeFile("loose", 0644)
+	require.NoError(t, applyStoredFileMode(looseFile, &tar.Header{Mode: 0600}, false))
+	assert.Equal(t, os.FileMode(0600), getMode(looseFile))
+	strictFile := writeFile("strict", 0600)
+	require.NoError(t, applyStoredFileMode(strictFile, &tar.Header{Mode: 0644}, false))
+	assert.Equal(t, os.FileMode(0600), getMode(strictFile))
+
+	// the entry without the stored mode leaves the file as is
+	require.NoError(t, applyStoredFileMode(newFile, &tar.Header{}, true))
+	assert.Equal(t, os.FileMode(0644), getMode(newFile))
+}
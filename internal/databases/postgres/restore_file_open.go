@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+var minOpenRetryWait = 50 * time.Millisecond
+var maxOpenRetryWait = 2 * time.Second
+
+// openFileFunc opens the file like os.OpenFile does
+type openFileFunc func(name string, flag int, perm os.FileMode) (*os.File, error)
+
+// retryableOpenErrors are the transient errors of opening the file: running out of the file descriptors,
+// the interrupted call and the NFS hiccups. The other errors, e.g. EACCES or ENOSPC, are not retried.
+var retryableOpenErrors = []syscall.Errno{
+	syscall.EMFILE, syscall.ENFILE, syscall.EINTR, syscall.EAGAIN, syscall.ESTALE, syscall.ETIMEDOUT,
+}
+
+func isRetryableOpenError(err error) bool {
+	for _, errno := range retryableOpenErrors {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// openRestoredFile opens the file like os.OpenFile does, the transient failures are retried
+// with the exponential backoff at most WALG_TAR_OPEN_RETRIES times
+func openRestoredFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return openFileWithRetries(os.OpenFile, name, flag, perm, viper.GetInt(internal.TarOpenRetriesSetting),
+		internal.NewExponentialSleeper(minOpenRetryWait, maxOpenRetryWait))
+}
+
+func openFileWithRetries(openFile openFileFunc, name string, flag int, perm os.FileMode,
+	retries int, sleeper internal.Sleeper) (*os.File, error) {
+	file, err := openFile(name, flag, perm)
+	for attempt := 1; err != nil && attempt <= retries && isRetryableOpenError(err); attempt++ {
+		tracelog.WarningLogger.Printf("opening of '%s' failed, retrying (%d/%d): %v\n", name, attempt, retries, err)
+		sleeper.Sleep()
+		file, err = openFile(name, flag, perm)
+	}
+	return file, err
+}
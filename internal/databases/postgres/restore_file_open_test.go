@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingOpenFile fails the first opens with the error, then opens the file
+func failingOpenFile(failures int, failure error) (openFileFunc, *int) {
+	opens := 0
+	return func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		opens++
+		if opens <= failures {
+			return nil, &os.PathError{Op: "open", Path: name, Err: failure}
+		}
+		return os.OpenFile(name, flag, perm)
+	}, &opens
+}
+
+func TestOpenFileWithRetries_RecoversFromEMFILE(t *testing.T) {
+	openFile, opens := failingOpenFile(2, syscall.EMFILE)
+	sleeper := &countingSleeper{}
+
+	file, err := openFileWithRetries(openFile, filepath.Join(t.TempDir(), "1259"),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666, 3, sleeper)
+
+	require.NoError(t, err)
+	assert.NoError(t, file.Close())
+	assert.Equal(t, 3, *opens)
+	assert.Equal(t, 2, sleeper.sleeps)
+}
+
+func TestOpenFileWithRetries_GivesUp(t *testing.T) {
+	openFile, opens := failingOpenFile(10, syscall.ESTALE)
+	sleeper := &countingSleeper{}
+
+	_, err := openFileWithRetries(openFile, filepath.Join(t.TempDir(), "1259"), os.O_RDWR, 0666, 2, sleeper)
+
+	assert.ErrorIs(t, err, syscall.ESTALE)
+	assert.Equal(t, 3, *opens)
+	assert.Equal(t, 2, sleeper.sleeps)
+}
+
+func TestOpenFileWithRetries_FailsFastOnENOSPC(t *testing.T) {
+	for _, failure := range []syscall.Errno{syscall.ENOSPC, syscall.EACCES} {
+		openFile, opens := failingOpenFile(1, failure)
+		sleeper := &countingSleeper{}
+
+		_, err := openFileWithRetries(openFile, filepath.Join(t.TempDir(), "1259"),
+			os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666, 3, sleeper)
+
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, 1, *opens)
+		assert.Zero(t, sleeper.sleeps)
+	}
+}
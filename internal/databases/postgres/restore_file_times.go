@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// applyStoredFileTimes sets the stored modification and access times to the restored file or directory,
+// the entry without the stored access time gets the modification time as both. The symlinks are skipped,
+// since setting their times would change the times of the link targets. The directory times are set
+// when its entry is restored, so the entries restored inside the directory later update its modification time.
+func applyStoredFileTimes(targetPath string, header *tar.Header) error {
+	if header.ModTime.IsZero() || header.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	accessTime := header.AccessTime
+	if accessTime.IsZero() {
+		accessTime = header.ModTime
+	}
+	if err := os.Chtimes(targetPath, accessTime, header.ModTime); err != nil {
+		return errors.Wrapf(err, "Interpret: failed to set the times of '%s'", targetPath)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func assertModTime(t *testing.T, expected time.Time, targetPath string) {
+	info, err := os.Stat(targetPath)
+	require.NoError(t, err)
+	assert.WithinDuration(t, expected, info.ModTime(), time.Second, targetPath)
+}
+
+func TestInterpretRestoresStoredFileTimes(t *testing.T) {
+	viper.Set(internal.RestoreFileTimesSetting, true)
+	defer viper.Set(internal.RestoreFileTimesSetting, nil)
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	modTime := time.Date(2020, 5, 17, 12, 30, 0, 0, time.UTC)
+	accessTime := modTime.Add(time.Hour)
+
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/base/", Typeflag: tar.TypeDir, Mode: 0700, ModTime: modTime}))
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader([]byte("data")), &tar.Header{
+		Name: "/postgresql.conf", Typeflag: tar.TypeReg, Mode: 0600, Size: 4, ModTime: modTime, AccessTime: accessTime,
+	}))
+
+	assertModTime(t, modTime, filepath.Join(dbDataDirectory, "base"))
+	assertModTime(t, modTime, filepath.Join(dbDataDirectory, "postgresql.conf"))
+}
+
+func TestUnwrapRegularFileNew_RestoresStoredFileTimes(t *testing.T) {
+	viper.Set(internal.RestoreFileTimesSetting, true)
+	defer viper.Set(internal.RestoreFileTimesSetting, nil)
+	dataDir := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	targetPath := filepath.Join(dataDir, "server.key")
+	modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, tarInterpreter.unwrapRegularFileNew(strings.NewReader("key"),
+		&tar.Header{Name: "/server.key", Typeflag: tar.TypeReg, Mode: 0600, Size: 3, ModTime: modTime}, targetPath, false, nil))
+
+	assertModTime(t, modTime, targetPath)
+}
+
+func TestInterpretKeepsFreshFileTimesIfDisabled(t *testing.T) {
+	viper.Set(internal.RestoreFileTimesSetting, false)
+	defer viper.Set(internal.RestoreFileTimesSetting, nil)
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	restoreTime := time.Now()
+
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader([]byte("data")), &tar.Header{
+		Name: "/postgresql.conf", Typeflag: tar.TypeReg, Mode: 0600, Size: 4, ModTime: restoreTime.Add(-24 * time.Hour),
+	}))
+
+	assertModTime(t, restoreTime, filepath.Join(dbDataDirectory, "postgresql.conf"))
+}
+
+func TestApplyStoredFileTimes_SkipsSymlinks(t *testing.T) {
+	directory := t.TempDir()
+	targetPath := filepath.Join(directory, "target")
+	require.NoError(t, os.WriteFile(targetPath, []byte("data"), 0600))
+	linkPath := filepath.Join(directory, "link")
+	require.NoError(t, os.Symlink(targetPath, linkPath))
+	restoreTime := time.Now()
+
+	require.NoError(t, applyStoredFileTimes(linkPath, &tar.Header{Typeflag: tar.TypeSymlink, ModTime: restoreTime.Add(-time.Hour)}))
+
+	assertModTime(t, restoreTime, targetPath)
+}
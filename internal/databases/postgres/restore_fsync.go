@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"archive/tar"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+var minFsyncRetryWait = 100 * time.Millisecond
+var maxFsyncRetryWait = 5 * time.Second
+
+type syncedFile interface {
+	Sync() error
+	Name() string
+}
+
+// syncRestoredFile fsyncs the restored file, the failed fsync is retried with the exponential backoff
+// at most WALG_TAR_FSYNC_RETRIES times
+var syncRestoredFile = func(file syncedFile) error {
+	return syncWithRetries(file, viper.GetInt(internal.TarFsyncRetriesSetting),
+		internal.NewExponentialSleeper(minFsyncRetryWait, maxFsyncRetryWait))
+}
+
+func syncWithRetries(file syncedFile, retries int, sleeper internal.Sleeper) error {
+	err := file.Sync()
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		tracelog.WarningLogger.Printf("fsync of '%s' failed, retrying (%d/%d): %v\n",
+			file.Name(), attempt, retries, err)
+		sleeper.Sleep()
+		err = file.Sync()
+	}
+	if err != nil && retries > 0 {
+		tracelog.ErrorLogger.Printf("fsync of '%s' failed %d times, the storage is likely faulty\n",
+			file.Name(), retries+1)
+	}
+	return err
+}
+
+// loggedSyncRestoredFile is the same as utility.LoggedSync, but retries the failed fsync
+func loggedSyncRestoredFile(file syncedFile, fsync bool) {
+	if !fsync {
+		return
+	}
+	if err := syncRestoredFile(file); err != nil {
+		tracelog.ErrorLogger.Printf("Problem with file sync: %v", err)
+	}
+}
+
+// maxFsyncBatchWorkers bounds the number of the concurrent fsyncs of one tar
+const maxFsyncBatchWorkers = 8
+
+type batchedFile interface {
+	syncedFile
+	io.Closer
+}
+
+// restoreFsyncBatch fsyncs and closes the restored files of one tar in the background. The files
+// are collected into the batches of WALG_TAR_FSYNC_BATCH_SIZE and every full batch is synced by the bounded
+// worker pool, so the extraction of the next files does not wait for the fsyncs. The parent directories
+// of the files are synced once all the files are, so the new files are durable as without the batching.
+type restoreFsyncBatch struct {
+	batchSize     int
+	workers       chan struct{}
+	syncFile      func(file syncedFile) error
+	syncDirectory func(directory string) error
+
+	mutex       sync.Mutex
+	pending     []batchedFile
+	directories map[string]bool
+	wg          sync.WaitGroup
+	firstErr    error
+}
+
+func newRestoreFsyncBatch(batchSize int) *restoreFsyncBatch {
+	return &restoreFsyncBatch{
+		batchSize:     batchSize,
+		workers:       make(chan struct{}, maxFsyncBatchWorkers),
+		syncFile:      syncRestoredFile,
+		syncDirectory: syncDirectory,
+		directories:   make(map[string]bool),
+	}
+}
+
+// add takes the ownership of the written file, it is synced and closed by the batch
+func (batch *restoreFsyncBatch) add(file batchedFile) {
+	batch.mutex.Lock()
+	batch.pending = append(batch.pending, file)
+	batch.directories[filepath.Dir(file.Name())] = true
+	var full []batchedFile
+	if len(batch.pending) >= batch.batchSize {
+		full, batch.pending = batch.pending, nil
+	}
+	batch.mutex.Unlock()
+	batch.flush(full)
+}
+
+func (batch *restoreFsyncBatch) flush(files []batchedFile) {
+	for _, file := range files {
+		batch.workers <- struct{}{}
+		batch.wg.Add(1)
+		go func(file batchedFile) {
+			defer func() {
+				<-batch.workers
+				batch.wg.Done()
+			}()
+			err := batch.syncFile(file)
+			utility.LoggedClose(file, "")
+			if err != nil {
+				batch.setError(errors.Wrapf(err, "failed to fsync '%s'", file.Name()))
+			}
+		}(file)
+	}
+}
+
+func (batch *restoreFsyncBatch) setError(err error) {
+	batch.mutex.Lock()
+	defer batch.mutex.Unlock()
+	if batch.firstErr == nil {
+		batch.firstErr = err
+	}
+}
+
+// finish syncs the rest of the files, waits for all the fsyncs and then syncs the parent directories
+// of the files, it returns the first failed fsync
+func (batch *restoreFsyncBatch) finish() error {
+	batch.mutex.Lock()
+	rest := batch.pending
+	batch.pending = nil
+	batch.mutex.Unlock()
+	batch.flush(rest)
+	batch.wg.Wait()
+
+	batch.mutex.Lock()
+	defer batch.mutex.Unlock()
+	directories := make([]string, 0, len(batch.directories))
+	for directory := range batch.directories {
+		directories = append(directories, directory)
+	}
+	sort.Strings(directories)
+	batch.directories = make(map[string]bool)
+	for _, directory := range directories {
+		// the directories can't be synced on some platforms
+		if err := batch.syncDirectory(directory); err != nil {
+			tracelog.WarningLogger.Printf("Failed to sync %s after syncing the restored files: %v\n", directory, err)
+		}
+	}
+	return batch.firstErr
+}
+
+// batchedFileTarInterpreter is the FileTarInterpreter of one tar which passes the written files to the fsync batch
+type batchedFileTarInterpreter struct {
+	*FileTarInterpreter
+	fsyncBatch *restoreFsyncBatch
+}
+
+func (tarInterpreter *batchedFileTarInterpreter) Interpret(fileReader io.Reader, fileInfo *tar.Header) error {
+	return tarInterpreter.interpret(fileReader, fileInfo, tarInterpreter.fsyncBatch)
+}
+
+// StartTarBatch returns the interpreter of one tar which batches the fsyncs of the restored files
+// if WALG_TAR_FSYNC_BATCH_SIZE is set. The returned finish function waits for the fsyncs of the tar.
+func (tarInterpreter *FileTarInterpreter) StartTarBatch() (internal.TarInterpreter, func() error) {
+	batchSize := viper.GetInt(internal.TarFsyncBatchSizeSetting)
+	// the resume manifest records the files once they are synced, so the fsyncs are not batched
+	if batchSize <= 0 || viper.GetBool(internal.TarDisableFsyncSetting) || tarInterpreter.resumeManifest != nil {
+		return tarInterpreter, func() error { return nil }
+	}
+	fsyncBatch := newRestoreFsyncBatch(batchSize)
+	return &batchedFileTarInterpreter{tarInterpreter, fsyncBatch}, fsyncBatch.finish
+}
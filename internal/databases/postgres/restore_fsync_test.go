@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+type flakySyncedFile struct {
+	failures int
+	syncs    int
+}
+
+func (file *flakySyncedFile) Sync() error {
+	file.syncs++
+	if file.syncs <= file.failures {
+		return errors.New("input/output error")
+	}
+	return nil
+}
+
+func (file *flakySyncedFile) Name() string {
+	return "/pgdata/base/1/1259"
+}
+
+type countingSleeper struct {
+	sleeps int
+}
+
+func (sleeper *countingSleeper) Sleep() {
+	sleeper.sleeps++
+}
+
+func TestSyncWithRetries_RecoversFromTransientFailures(t *testing.T) {
+	file := &flakySyncedFile{failures: 2}
+	sleeper := &countingSleeper{}
+
+	err := syncWithRetries(file, 3, sleeper)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, file.syncs)
+	assert.Equal(t, 2, sleeper.sleeps)
+}
+
+func TestSyncWithRetries_GivesUp(t *testing.T) {
+	file := &flakySyncedFile{failures: 10}
+	sleeper := &countingSleeper{}
+
+	err := syncWithRetries(file, 2, sleeper)
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, file.syncs)
+	assert.Equal(t, 2, sleeper.sleeps)
+}
+
+func TestSyncWithRetries_NoRetriesByDefault(t *testing.T) {
+	file := &flakySyncedFile{failures: 1}
+	sleeper := &countingSleeper{}
+
+	err := syncWithRetries(file, 0, sleeper)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, file.syncs)
+	assert.Zero(t, sleeper.sleeps)
+}
+
+type fakeBatchedFile struct {
+	name    string
+	syncErr error
+	synced  bool
+	closed  bool
+}
+
+func (file *fakeBatchedFile) Sync() error {
+	file.synced = true
+	return file.syncErr
+}
+
+func (file *fakeBatchedFile) Name() string {
+	return file.name
+}
+
+func (file *fakeBatchedFile) Close() error {
+	file.closed = true
+	return nil
+}
+
+func TestRestoreFsyncBatch_SyncsIncompleteBatchOnFinish(t *testing.T) {
+	batch := newRestoreFsyncBatch(10)
+	files := []*fakeBatchedFile{{name: "/pgdata/base/1/1259"}, {name: "/pgdata/base/1/1260"}}
+
+	for _, file := range files {
+		batch.add(file)
+	}
+	err := batch.finish()
+
+	assert.NoError(t, err)
+	for _, file := range files {
+		assert.True(t, file.synced, file.name)
+		assert.True(t, file.closed, file.name)
+	}
+}
+
+func TestRestoreFsyncBatch_ReturnsFsyncError(t *testing.T) {
+	batch := newRestoreFsyncBatch(2)
+	failed := &fakeBatchedFile{name: "/pgdata/base/1/1260", syncErr: errors.New("input/output error")}
+	files := []*fakeBatchedFile{{name: "/pgdata/base/1/1259"}, failed, {name: "/pgdata/base/1/1261"}}
+
+	for _, file := range files {
+		batch.add(file)
+	}
+	err := batch.finish()
+
+	assert.EqualError(t, err, "failed to fsync '/pgdata/base/1/1260': input/output error")
+	for _, file := range files {
+		assert.True(t, file.synced, file.name)
+		assert.True(t, file.closed, file.name)
+	}
+}
+
+func TestRestoreFsyncBatch_SyncsParentDirectoriesAfterFiles(t *testing.T) {
+	batch := newRestoreFsyncBatch(10)
+	files := []*fakeBatchedFile{{name: "/pgdata/base/1/1259"}, {name: "/pgdata/base/1/1260"}, {name: "/pgdata/global/1262"}}
+	syncedDirectories := make([]string, 0)
+	batch.syncDirectory = func(directory string) error {
+		for _, file := range files {
+			assert.True(t, file.synced, file.name)
+		}
+		syncedDirectories = append(syncedDirectories, directory)
+		return nil
+	}
+
+	for _, file := range files {
+		batch.add(file)
+	}
+	require.NoError(t, batch.finish())
+
+	assert.Equal(t, []string{"/pgdata/base/1", "/pgdata/global"}, syncedDirectories)
+}
+
+func TestFileTarInterpreter_StartTarBatch_SyncsInPlaceWriteDirectory(t *testing.T) {
+	dataDir := t.TempDir()
+	targetPath := filepath.Join(dataDir, "base", "1", "1259")
+	require.NoError(t, os.MkdirAll(filepath.Dir(targetPath), 0700))
+	require.NoError(t, os.WriteFile(targetPath, []byte("old"), 0600))
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	batch := newRestoreFsyncBatch(10)
+	syncedDirectories := make([]string, 0)
+	batch.syncDirectory = func(directory string) error {
+		syncedDirectories = append(syncedDirectories, directory)
+		return nil
+	}
+
+	require.NoError(t, tarInterpreter.unwrapRegularFileNew(strings.NewReader("data"),
+		&tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Mode: 0600, Size: 4}, targetPath, true, batch))
+	require.NoError(t, batch.finish())
+
+	assert.Equal(t, []string{filepath.Dir(targetPath)}, syncedDirectories)
+}
+
+func TestFileTarInterpreter_StartTarBatch_AtomicWriteIsNotBatched(t *testing.T) {
+	viper.Set(internal.TarFsyncBatchSizeSetting, 10)
+	defer viper.Set(internal.TarFsyncBatchSizeSetting, 0)
+	dataDir := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	batchTarInterpreter, finish := tarInterpreter.StartTarBatch()
+	fsyncBatch := batchTarInterpreter.(*batchedFileTarInterpreter).fsyncBatch
+
+	require.NoError(t, batchTarInterpreter.Interpret(strings.NewReader("data"),
+		&tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Mode: 0600, Size: 4}))
+
+	// the file is synced, renamed and its directory is synced by the write itself
+	assert.Empty(t, fsyncBatch.pending)
+	assert.Empty(t, fsyncBatch.directories)
+	content, err := os.ReadFile(filepath.Join(dataDir, "base", "1", "1259"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(content))
+	require.NoError(t, finish())
+}
+
+func TestFileTarInterpreter_StartTarBatch(t *testing.T) {
+	viper.Set(internal.TarFsyncBatchSizeSetting, 10)
+	defer viper.Set(internal.TarFsyncBatchSizeSetting, 0)
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+
+	batchTarInterpreter, finish := tarInterpreter.StartTarBatch()
+	require.IsType(t, &batchedFileTarInterpreter{}, batchTarInterpreter)
+	content := "14\n"
+	err := batchTarInterpreter.Interpret(strings.NewReader(content), &tar.Header{
+		Name: "/PG_VERSION", Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content)),
+	})
+	require.NoError(t, err)
+	require.NoError(t, finish())
+
+	restored, err := os.ReadFile(filepath.Join(dbDataDirectory, "PG_VERSION"))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(restored))
+}
+
+func TestFileTarInterpreter_StartTarBatch_DisabledByDefault(t *testing.T) {
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+
+	batchTarInterpreter, finish := tarInterpreter.StartTarBatch()
+
+	assert.Same(t, tarInterpreter, batchTarInterpreter)
+	assert.NoError(t, finish())
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+type InsufficientInodesError struct {
+	error
+}
+
+func newInsufficientInodesError(dbDataDirectory string, required, available uint64) InsufficientInodesError {
+	return InsufficientInodesError{errors.Errorf(
+		"out of inodes: restoring to '%s' requires %d inodes including the safety margin, "+
+			"but only %d inodes are free on the filesystem (there may be enough free bytes)",
+		dbDataDirectory, required, available)}
+}
+
+func (err InsufficientInodesError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// RestoreInodeCheck verifies that the filesystem containing the data directory has enough free inodes
+// for the restored files and directories. The filesystems storing millions of small relation segments
+// may run out of inodes long before running out of space.
+type RestoreInodeCheck struct {
+	// marginPercent is the number of inodes required in addition to the restored entries count, in percent
+	marginPercent int
+	getInodes     func(path string) (total, free uint64, err error)
+}
+
+func NewRestoreInodeCheck(marginPercent int) *RestoreInodeCheck {
+	return &RestoreInodeCheck{marginPercent: marginPercent, getInodes: getFilesystemInodes}
+}
+
+// ConfigureRestoreInodeCheck returns nil if the free inodes check is disabled
+func ConfigureRestoreInodeCheck() (*RestoreInodeCheck, error) {
+	if !viper.GetBool(internal.RestoreInodeCheckSetting) {
+		return nil, nil
+	}
+	marginPercent := viper.GetInt(internal.RestoreInodeMarginSetting)
+	if marginPercent < 0 {
+		return nil, errors.Errorf("%s must not be negative, got %d", internal.RestoreInodeMarginSetting, marginPercent)
+	}
+	return NewRestoreInodeCheck(marginPercent), nil
+}
+
+// Check fails with InsufficientInodesError if the restored entries do not fit into the free inodes.
+// The entries restored into tablespaces are not accounted, since tablespaces are usually located
+// on other filesystems.
+func (check *RestoreInodeCheck) Check(dbDataDirectory string, filesMeta FilesMetadataDto,
+	filesToUnwrap map[string]bool) error {
+	if len(filesMeta.Files) == 0 {
+		tracelog.WarningLogger.Println("Backup has no files metadata, skipping the free inodes check")
+		return nil
+	}
+	totalInodes, freeInodes, err := check.getInodes(findExistingDirectory(dbDataDirectory))
+	if err != nil {
+		return err
+	}
+	if totalInodes == 0 {
+		tracelog.InfoLogger.Println("Filesystem allocates inodes dynamically, skipping the free inodes check")
+		return nil
+	}
+
+	entryCount := countRestoredEntries(filesMeta, filesToUnwrap)
+	required := entryCount + entryCount*uint64(check.marginPercent)/100
+	if required > freeInodes {
+		return newInsufficientInodesError(dbDataDirectory, required, freeInodes)
+	}
+	tracelog.InfoLogger.Printf("Restore requires about %d inodes, %d inodes are free\n", entryCount, freeInodes)
+	return nil
+}
+
+// countRestoredEntries counts the restored files and their parent directories outside of the tablespaces
+func countRestoredEntries(filesMeta FilesMetadataDto, filesToUnwrap map[string]bool) uint64 {
+	directories := make(map[string]bool)
+	var count uint64
+	for fileName := range filesMeta.Files {
+		if filesToUnwrap != nil && !filesToUnwrap[fileName] {
+			continue
+		}
+		if _, ok := getTablespaceName(fileName); ok {
+			continue
+		}
+		count++
+		for dir := path.Dir(fileName); dir != "/" && dir != "." && !directories[dir]; dir = path.Dir(dir) {
+			directories[dir] = true
+		}
+	}
+	return count + uint64(len(directories))
+}
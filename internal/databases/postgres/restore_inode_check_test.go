@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func makeInodeCheckTestFilesMeta() FilesMetadataDto {
+	return FilesMetadataDto{Files: internal.BackupFileList{
+		"/PG_VERSION":              {},
+		"/base/1/1259":             {},
+		"/base/1/1249":             {},
+		"/base/5/1259":             {},
+		"/global/pg_control":       {},
+		"/pg_tblspc/16385/PG_15/1": {},
+	}}
+}
+
+func makeTestInodeCheck(marginPercent int, total, free uint64) *RestoreInodeCheck {
+	check := NewRestoreInodeCheck(marginPercent)
+	check.getInodes = func(string) (uint64, uint64, error) {
+		return total, free, nil
+	}
+	return check
+}
+
+func TestCountRestoredEntries(t *testing.T) {
+	// 5 files and 4 directories: /base, /base/1, /base/5, /global
+	assert.Equal(t, uint64(9), countRestoredEntries(makeInodeCheckTestFilesMeta(), UnwrapAll))
+	// 2 files and 2 directories: /base, /base/1
+	assert.Equal(t, uint64(4), countRestoredEntries(makeInodeCheckTestFilesMeta(),
+		map[string]bool{"/base/1/1259": true, "/base/1/1249": true}))
+}
+
+func TestRestoreInodeCheck_Enough(t *testing.T) {
+	err := makeTestInodeCheck(10, 1000, 10).Check("/tmp", makeInodeCheckTestFilesMeta(), UnwrapAll)
+
+	assert.NoError(t, err)
+}
+
+func TestRestoreInodeCheck_NotEnoughWithMargin(t *testing.T) {
+	err := makeTestInodeCheck(50, 1000, 10).Check("/tmp", makeInodeCheckTestFilesMeta(), UnwrapAll)
+
+	assert.IsType(t, InsufficientInodesError{}, err)
+	assert.Contains(t, err.Error(), "out of inodes")
+}
+
+func TestRestoreInodeCheck_DynamicInodes(t *testing.T) {
+	err := makeTestInodeCheck(10, 0, 0).Check("/tmp", makeInodeCheckTestFilesMeta(), UnwrapAll)
+
+	assert.NoError(t, err)
+}
+
+func TestRestoreInodeCheck_NoFilesMetadata(t *testing.T) {
+	err := makeTestInodeCheck(10, 1000, 0).Check("/tmp", FilesMetadataDto{}, UnwrapAll)
+
+	assert.NoError(t, err)
+}
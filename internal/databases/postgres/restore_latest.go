@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	RecoverySignalFilename = "recovery.signal"
+	RecoveryConfFilename   = "recovery.conf"
+	AutoConfFilename       = "postgresql.auto.conf"
+)
+
+type NoRestorableBackupError struct {
+	error
+}
+
+func newNoRestorableBackupError() NoRestorableBackupError {
+	return NoRestorableBackupError{errors.New(
+		"no backup has the WAL required to reach the consistent state in storage")}
+}
+
+func (err NoRestorableBackupError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// LatestRecoveryPoint is the most recent point the cluster can be recovered to
+// using the backups and WAL available in storage
+type LatestRecoveryPoint struct {
+	BackupName string
+	Timeline   uint32
+	// TargetLSN is the recovery target, it is never earlier than the backup finish LSN
+	TargetLSN uint64
+	// LastSegment is the last WAL segment of the sequence without gaps starting at the backup start
+	LastSegment string
+	// LatestStoredSegment is the latest WAL segment of the backup timeline in storage
+	LatestStoredSegment string
+	// MissingSegment is the first missing WAL segment before the latest stored one, if any
+	MissingSegment string
+}
+
+// IsWalComplete is false if there are WAL segments in storage after a gap,
+// so the recovery point is earlier than the latest WAL in storage
+func (point LatestRecoveryPoint) IsWalComplete() bool {
+	return point.MissingSegment == ""
+}
+
+// FindLatestRecoveryPoint picks the most recent backup which WAL sequence is complete up to
+// the consistent state and finds the latest LSN reachable by replaying the WAL without gaps
+// on the backup timeline. The recovery target is the beginning of the last segment
+// of the sequence: the end of the segment may contain an incomplete record.
+func FindLatestRecoveryPoint(rootFolder storage.Folder) (LatestRecoveryPoint, error) {
+	baseBackupFolder := rootFolder.GetSubFolder(utility.BaseBackupPath)
+	backupTimes, err := internal.GetBackups(baseBackupFolder)
+	if err != nil {
+		return LatestRecoveryPoint{}, err
+	}
+	// the newest backups go first
+	sort.SliceStable(backupTimes, func(i, j int) bool {
+		if backupTimes[i].Time.Equal(backupTimes[j].Time) {
+			return backupTimes[i].BackupName > backupTimes[j].BackupName
+		}
+		return backupTimes[i].Time.After(backupTimes[j].Time)
+	})
+
+	walFilenames, err := getFolderFilenames(rootFolder.GetSubFolder(utility.WalPath))
+	if err != nil {
+		return LatestRecoveryPoint{}, errors.Wrap(err, "failed to list the WAL folder")
+	}
+	walSegments := getSegmentsFromFiles(walFilenames)
+
+	for _, backupTime := range backupTimes {
+		point, ok, err := findBackupRecoveryPoint(baseBackupFolder, backupTime.BackupName, walSegments)
+		if err != nil {
+			return LatestRecoveryPoint{}, err
+		}
+		if ok {
+			return point, nil
+		}
+	}
+	return LatestRecoveryPoint{}, newNoRestorableBackupError()
+}
+
+func findBackupRecoveryPoint(baseBackupFolder storage.Folder, backupName string,
+	walSegments map[WalSegmentDescription]bool) (LatestRecoveryPoint, bool, error) {
+	backup := NewBackup(baseBackupFolder, backupName)
+	sentinelDto, err := backup.GetSentinel()
+	if err != nil {
+		return LatestRecoveryPoint{}, false, err
+	}
+	if sentinelDto.BackupStartLSN == nil || sentinelDto.BackupFinishLSN == nil {
+		tracelog.WarningLogger.Printf("Backup %s has no start or finish LSN, skipping it\n", backupName)
+		return LatestRecoveryPoint{}, false, nil
+	}
+	timeline, err := ParseTimelineFromBackupName(backupName)
+	if err != nil {
+		return LatestRecoveryPoint{}, false, err
+	}
+
+	startSegmentNo := newWalSegmentNo(*sentinelDto.BackupStartLSN)
+	finishSegmentNo := newWalSegmentNo(*sentinelDto.BackupFinishLSN - 1)
+	lastSegmentNo := startSegmentNo.previous()
+	for walSegments[WalSegmentDescription{Timeline: timeline, Number: lastSegmentNo.next()}] {
+		lastSegmentNo = lastSegmentNo.next()
+	}
+	if lastSegmentNo < finishSegmentNo {
+		tracelog.WarningLogger.Printf("Backup %s can't reach the consistent state: WAL segment %s is missing\n",
+			backupName, lastSegmentNo.next().getFilename(timeline))
+		return LatestRecoveryPoint{}, false, nil
+	}
+
+	latestStoredSegmentNo := lastSegmentNo
+	for segment := range walSegments {
+		if segment.Timeline == timeline && segment.Number > latestStoredSegmentNo {
+			latestStoredSegmentNo = segment.Number
+		}
+	}
+
+	targetLSN := lastSegmentNo.firstLsn()
+	if targetLSN < *sentinelDto.BackupFinishLSN {
+		targetLSN = *sentinelDto.BackupFinishLSN
+	}
+	point := LatestRecoveryPoint{
+		BackupName:          backupName,
+		Timeline:            timeline,
+		TargetLSN:           targetLSN,
+		LastSegment:         lastSegmentNo.getFilename(timeline),
+		LatestStoredSegment: latestStoredSegmentNo.getFilename(timeline),
+	}
+	if latestStoredSegmentNo != lastSegmentNo {
+		point.MissingSegment = lastSegmentNo.next().getFilename(timeline)
+	}
+	return point, true, nil
+}
+
+// WriteRecoveryConfig configures the restored cluster to recover to the recovery point and promote.
+// PostgreSQL 12 and newer read the settings from postgresql.auto.conf if recovery.signal is present,
+// the older versions read them from recovery.conf. The LSN target requires PostgreSQL 10 or newer,
+// the older versions replay all the available WAL.
+func WriteRecoveryConfig(dbDataDirectory string, pgVersion int, restoreCommand string,
+	point LatestRecoveryPoint) error {
+	settings := []string{fmt.Sprintf("restore_command = '%s'", strings.ReplaceAll(restoreCommand, "'", "''"))}
+	if pgVersion == 0 || pgVersion >= 100000 {
+		settings = append(settings,
+			fmt.Sprintf("recovery_target_lsn = '%s'", formatLSN(point.TargetLSN)),
+			fmt.Sprintf("recovery_target_timeline = '%d'", point.Timeline),
+			"recovery_target_action = 'promote'")
+	} else {
+		tracelog.WarningLogger.Printf("PostgreSQL %d does not support the LSN recovery target, "+
+			"all the available WAL is replayed\n", pgVersion)
+	}
+	config := "# recovery settings added by wal-g\n" + strings.Join(settings, "\n") + "\n"
+
+	if pgVersion != 0 && pgVersion < 120000 {
+		return errors.Wrap(os.WriteFile(filepath.Join(dbDataDirectory, RecoveryConfFilename), []byte(config), 0600),
+			"failed to write the recovery config")
+	}
+	autoConf, err := os.OpenFile(filepath.Join(dbDataDirectory, AutoConfFilename),
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open the recovery config")
+	}
+	_, err = autoConf.WriteString(config)
+	if closeErr := autoConf.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write the recovery config")
+	}
+	return errors.Wrap(os.WriteFile(filepath.Join(dbDataDirectory, RecoverySignalFilename), nil, 0600),
+		"failed to create the recovery signal file")
+}
+
+func formatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+// HandleRestoreLatest restores the most recent restorable backup, configures the recovery
+// to the latest point reachable with the WAL in storage and reports the recovery point
+func HandleRestoreLatest(rootFolder storage.Folder, dbDataDirectory, restoreCommand string,
+	fetcher func(folder storage.Folder, backup internal.Backup), output io.Writer) {
+	point, err := FindLatestRecoveryPoint(rootFolder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to find the latest recovery point: %v\n", err)
+	tracelog.InfoLogger.Printf("Restoring backup %s to the latest recovery point\n", point.BackupName)
+
+	backupSelector, err := internal.NewBackupNameSelector(point.BackupName, false)
+	tracelog.ErrorLogger.FatalOnError(err)
+	internal.HandleBackupFetch(rootFolder, backupSelector, fetcher)
+
+	backup := NewBackup(rootFolder.GetSubFolder(utility.BaseBackupPath), point.BackupName)
+	sentinelDto, err := backup.GetSentinel()
+	tracelog.ErrorLogger.FatalOnError(err)
+	err = WriteRecoveryConfig(dbDataDirectory, sentinelDto.PgVersion, restoreCommand, point)
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	_, err = fmt.Fprintf(output, "Restored backup %s, the recovery target is LSN %s on timeline %d "+
+		"(WAL segment %s)\n", point.BackupName, formatLSN(point.TargetLSN), point.Timeline, point.LastSegment)
+	tracelog.ErrorLogger.FatalOnError(err)
+	if !point.IsWalComplete() {
+		_, err = fmt.Fprintf(output, "WAL is incomplete: segment %s is missing, so the recovery point "+
+			"is short of the latest WAL segment %s in storage\n",
+			point.MissingSegment, point.LatestStoredSegment)
+		tracelog.ErrorLogger.FatalOnError(err)
+	}
+}
@@ -0,0 +1,109 @@
+package postgres_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	restoreLatestOldBackup = "base_000000010000000000000002"
+	restoreLatestNewBackup = "base_000000010000000000000006"
+)
+
+func createRestoreLatestTestFolder(t *testing.T, walSegments ...string) storage.Folder {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	oldSentinel := makeTestSentinel(0x2000028, "", "", 0)
+	oldFinishLSN := uint64(0x3000100)
+	oldSentinel.BackupFinishLSN = &oldFinishLSN
+	putTestSentinel(t, folder, restoreLatestOldBackup, oldSentinel)
+	newSentinel := makeTestSentinel(0x6000028, "", "", 0)
+	newFinishLSN := uint64(0x7000100)
+	newSentinel.BackupFinishLSN = &newFinishLSN
+	putTestSentinel(t, folder, restoreLatestNewBackup, newSentinel)
+
+	for _, segment := range walSegments {
+		err := folder.GetSubFolder(utility.WalPath).PutObject(segment+".lz4", strings.NewReader(""))
+		require.NoError(t, err)
+	}
+	return folder
+}
+
+func TestFindLatestRecoveryPoint_CompleteWal(t *testing.T) {
+	folder := createRestoreLatestTestFolder(t,
+		"000000010000000000000006", "000000010000000000000007", "000000010000000000000008")
+
+	point, err := postgres.FindLatestRecoveryPoint(folder)
+
+	require.NoError(t, err)
+	assert.Equal(t, restoreLatestNewBackup, point.BackupName)
+	assert.Equal(t, uint32(1), point.Timeline)
+	assert.Equal(t, uint64(0x8000000), point.TargetLSN)
+	assert.Equal(t, "000000010000000000000008", point.LastSegment)
+	assert.True(t, point.IsWalComplete())
+}
+
+func TestFindLatestRecoveryPoint_WalGap(t *testing.T) {
+	// segment 7 is missing, so the newest backup can't reach the consistent state
+	folder := createRestoreLatestTestFolder(t, "000000010000000000000002", "000000010000000000000003",
+		"000000010000000000000004", "000000010000000000000006", "000000010000000000000008")
+
+	point, err := postgres.FindLatestRecoveryPoint(folder)
+
+	require.NoError(t, err)
+	assert.Equal(t, restoreLatestOldBackup, point.BackupName)
+	assert.Equal(t, uint64(0x4000000), point.TargetLSN)
+	assert.False(t, point.IsWalComplete())
+	assert.Equal(t, "000000010000000000000005", point.MissingSegment)
+	assert.Equal(t, "000000010000000000000008", point.LatestStoredSegment)
+}
+
+func TestFindLatestRecoveryPoint_TargetIsNotEarlierThanBackupFinish(t *testing.T) {
+	folder := createRestoreLatestTestFolder(t, "000000010000000000000006", "000000010000000000000007")
+
+	point, err := postgres.FindLatestRecoveryPoint(folder)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x7000100), point.TargetLSN)
+}
+
+func TestFindLatestRecoveryPoint_NoRestorableBackup(t *testing.T) {
+	folder := createRestoreLatestTestFolder(t, "000000010000000000000002")
+
+	_, err := postgres.FindLatestRecoveryPoint(folder)
+
+	assert.IsType(t, postgres.NoRestorableBackupError{}, err)
+}
+
+func TestWriteRecoveryConfig_Pg12(t *testing.T) {
+	dir := t.TempDir()
+	point := postgres.LatestRecoveryPoint{Timeline: 2, TargetLSN: 0x108000000}
+
+	err := postgres.WriteRecoveryConfig(dir, 150002, "wal-g wal-fetch \"%f\" \"%p\"", point)
+
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, postgres.RecoverySignalFilename))
+	config, err := os.ReadFile(filepath.Join(dir, postgres.AutoConfFilename))
+	require.NoError(t, err)
+	assert.Contains(t, string(config), "restore_command = 'wal-g wal-fetch \"%f\" \"%p\"'")
+	assert.Contains(t, string(config), "recovery_target_lsn = '1/8000000'")
+	assert.Contains(t, string(config), "recovery_target_timeline = '2'")
+}
+
+func TestWriteRecoveryConfig_Pg11(t *testing.T) {
+	dir := t.TempDir()
+
+	err := postgres.WriteRecoveryConfig(dir, 110005, "wal-g wal-fetch", postgres.LatestRecoveryPoint{Timeline: 1})
+
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, postgres.RecoverySignalFilename))
+	assert.FileExists(t, filepath.Join(dir, postgres.RecoveryConfFilename))
+}
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const MerkleTreeHashAlgorithm = "sha256"
+
+// The prefixes separate the leaf hashes from the inner node hashes,
+// so the inner node can't be passed off as a leaf
+const (
+	merkleLeafPrefix byte = 0
+	merkleNodePrefix byte = 1
+)
+
+// MerkleTreeLeaf is the content hash of the single restored file
+type MerkleTreeLeaf struct {
+	// Name is the archive name of the file, e.g. /base/1/1259
+	Name string
+	Hash string
+}
+
+// MerkleTree attests the integrity of the whole restored tree with the single root hash.
+// The leaves are sorted by name, so the tree does not depend on the extraction order.
+type MerkleTree struct {
+	Algorithm string
+	RootHash  string
+	Leaves    []MerkleTreeLeaf
+	// Levels are the node hashes from the leaf level up to the root
+	Levels [][]string
+}
+
+// BuildMerkleTree builds the tree over the leaves. The nodes are paired level by level,
+// the last node of the level with the odd number of nodes is promoted to the next level as is.
+func BuildMerkleTree(leaves []MerkleTreeLeaf) (MerkleTree, error) {
+	sortedLeaves := make([]MerkleTreeLeaf, len(leaves))
+	copy(sortedLeaves, leaves)
+	sort.Slice(sortedLeaves, func(i, j int) bool {
+		return sortedLeaves[i].Name < sortedLeaves[j].Name
+	})
+
+	level := make([][]byte, 0, len(sortedLeaves))
+	for _, leaf := range sortedLeaves {
+		fileHash, err := hex.DecodeString(leaf.Hash)
+		if err != nil {
+			return MerkleTree{}, errors.Wrapf(err, "invalid hash of '%s'", leaf.Name)
+		}
+		level = append(level, hashMerkleLeaf(leaf.Name, fileHash))
+	}
+	tree := MerkleTree{Algorithm: MerkleTreeHashAlgorithm, Leaves: sortedLeaves}
+	if len(level) == 0 {
+		emptyHash := sha256.Sum256(nil)
+		tree.RootHash = hex.EncodeToString(emptyHash[:])
+		tree.Levels = [][]string{}
+		return tree, nil
+	}
+
+	tree.Levels = [][]string{encodeMerkleLevel(level)}
+	for len(level) > 1 {
+		nextLevel := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i+1 < len(level); i += 2 {
+			nextLevel = append(nextLevel, hashMerkleNode(level[i], level[i+1]))
+		}
+		if len(level)%2 == 1 {
+			nextLevel = append(nextLevel, level[len(level)-1])
+		}
+		level = nextLevel
+		tree.Levels = append(tree.Levels, encodeMerkleLevel(level))
+	}
+	tree.RootHash = hex.EncodeToString(level[0])
+	return tree, nil
+}
+
+func hashMerkleLeaf(name string, fileHash []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{merkleLeafPrefix})
+	hash.Write([]byte(name))
+	// the names can't contain the zero byte, so it separates the name from the hash
+	hash.Write([]byte{0})
+	hash.Write(fileHash)
+	return hash.Sum(nil)
+}
+
+func hashMerkleNode(left, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{merkleNodePrefix})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
+
+func encodeMerkleLevel(level [][]byte) []string {
+	encoded := make([]string, 0, len(level))
+	for _, node := range level {
+		encoded = append(encoded, hex.EncodeToString(node))
+	}
+	return encoded
+}
+
+// RestoreMerkleTree records the files written by FileTarInterpreter and builds the Merkle tree
+// over their contents once the restore is complete. The files are hashed after the restore,
+// so the increments applied to the files by the delta backups are taken into account.
+type RestoreMerkleTree struct {
+	outputPath string
+
+	mutex sync.Mutex
+	// files are the target paths of the restored files by their archive names
+	files map[string]string
+}
+
+// NewRestoreMerkleTree creates the tree which is written to the outputPath as JSON
+func NewRestoreMerkleTree(outputPath string) *RestoreMerkleTree {
+	return &RestoreMerkleTree{outputPath: outputPath, files: make(map[string]string)}
+}
+
+func (restoreTree *RestoreMerkleTree) trackFile(name, targetPath string) {
+	restoreTree.mutex.Lock()
+	defer restoreTree.mutex.Unlock()
+	restoreTree.files[name] = targetPath
+}
+
+// Build hashes the restored files and builds the tree
+func (restoreTree *RestoreMerkleTree) Build() (MerkleTree, error) {
+	restoreTree.mutex.Lock()
+	defer restoreTree.mutex.Unlock()
+	leaves := make([]MerkleTreeLeaf, 0, len(restoreTree.files))
+	for name, targetPath := range restoreTree.files {
+		fileHash, err := hashFile(targetPath)
+		if err != nil {
+			return MerkleTree{}, err
+		}
+		leaves = append(leaves, MerkleTreeLeaf{Name: name, Hash: fileHash})
+	}
+	return BuildMerkleTree(leaves)
+}
+
+// Finish builds the tree, writes it to the output path and logs the root hash
+func (restoreTree *RestoreMerkleTree) Finish() error {
+	tree, err := restoreTree.Build()
+	if err != nil {
+		return errors.Wrap(err, "failed to build the Merkle tree of the restored files")
+	}
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(restoreTree.outputPath, data, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to write the Merkle tree of the restored files")
+	}
+	tracelog.InfoLogger.Printf("Merkle tree of %d restored files is written to '%s', root hash: %s\n",
+		len(tree.Leaves), restoreTree.outputPath, tree.RootHash)
+	return nil
+}
+
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open '%s' to hash it", filePath)
+	}
+	defer utility.LoggedClose(file, "")
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", errors.Wrapf(err, "failed to hash '%s'", filePath)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hashTestContent(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestBuildMerkleTree_DoesNotDependOnOrder(t *testing.T) {
+	leaves := []MerkleTreeLeaf{
+		{Name: "/base/1/1259", Hash: hashTestContent("a")},
+		{Name: "/global/pg_control", Hash: hashTestContent("b")},
+		{Name: "/PG_VERSION", Hash: hashTestContent("c")},
+	}
+	reversed := []MerkleTreeLeaf{leaves[2], leaves[1], leaves[0]}
+
+	tree, err := BuildMerkleTree(leaves)
+	require.NoError(t, err)
+	reversedTree, err := BuildMerkleTree(reversed)
+	require.NoError(t, err)
+
+	assert.Equal(t, tree, reversedTree)
+	assert.Equal(t, "/PG_VERSION", tree.Leaves[0].Name)
+	// 3 leaves, 2 nodes, the root
+	require.Len(t, tree.Levels, 3)
+	assert.Len(t, tree.Levels[1], 2)
+	// the odd node is promoted as is
+	assert.Equal(t, tree.Levels[0][2], tree.Levels[1][1])
+	assert.Equal(t, []string{tree.RootHash}, tree.Levels[2])
+}
+
+func TestBuildMerkleTree_DetectsChanges(t *testing.T) {
+	tree, err := BuildMerkleTree([]MerkleTreeLeaf{
+		{Name: "/base/1/1259", Hash: hashTestContent("a")},
+		{Name: "/base/1/1260", Hash: hashTestContent("b")},
+	})
+	require.NoError(t, err)
+	changedTree, err := BuildMerkleTree([]MerkleTreeLeaf{
+		{Name: "/base/1/1259", Hash: hashTestContent("a")},
+		{Name: "/base/1/1260", Hash: hashTestContent("c")},
+	})
+	require.NoError(t, err)
+	renamedTree, err := BuildMerkleTree([]MerkleTreeLeaf{
+		{Name: "/base/1/1259", Hash: hashTestContent("a")},
+		{Name: "/base/1/1261", Hash: hashTestContent("b")},
+	})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, tree.RootHash, changedTree.RootHash)
+	assert.NotEqual(t, tree.RootHash, renamedTree.RootHash)
+}
+
+func TestBuildMerkleTree_Empty(t *testing.T) {
+	tree, err := BuildMerkleTree(nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, hashTestContent(""), tree.RootHash)
+	assert.Empty(t, tree.Leaves)
+}
+
+func TestBuildMerkleTree_InvalidHash(t *testing.T) {
+	_, err := BuildMerkleTree([]MerkleTreeLeaf{{Name: "/base/1/1259", Hash: "not a hash"}})
+
+	assert.Error(t, err)
+}
+
+func TestRestoreMerkleTree_Finish(t *testing.T) {
+	dataDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "PG_VERSION"), []byte("14\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "1259"), []byte("relation"), 0600))
+	outputPath := filepath.Join(t.TempDir(), "tree.json")
+	restoreTree := NewRestoreMerkleTree(outputPath)
+	restoreTree.trackFile("/base/1/1259", filepath.Join(dataDir, "1259"))
+	restoreTree.trackFile("/PG_VERSION", filepath.Join(dataDir, "PG_VERSION"))
+
+	require.NoError(t, restoreTree.Finish())
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	var tree MerkleTree
+	require.NoError(t, json.Unmarshal(data, &tree))
+	assert.Equal(t, MerkleTreeHashAlgorithm, tree.Algorithm)
+	assert.Equal(t, []MerkleTreeLeaf{
+		{Name: "/PG_VERSION", Hash: hashTestContent("14\n")},
+		{Name: "/base/1/1259", Hash: hashTestContent("relation")},
+	}, tree.Leaves)
+	expectedTree, err := BuildMerkleTree(tree.Leaves)
+	require.NoError(t, err)
+	assert.Equal(t, expectedTree.RootHash, tree.RootHash)
+}
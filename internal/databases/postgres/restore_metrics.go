@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// The gauges of the last restore, the names are prefixed with walg_restore_
+const (
+	restoreMetricDuration         = "last_duration_seconds"
+	restoreMetricFiles            = "last_files"
+	restoreMetricBytes            = "last_bytes"
+	restoreMetricSkippedFiles     = "last_skipped_files"
+	restoreMetricCreatedPageFiles = "last_created_page_files"
+	restoreMetricMissingBlocks    = "last_missing_blocks"
+	restoreMetricIncrementFiles   = "last_written_increment_files"
+	restoreMetricIncrementBlocks  = "last_written_increment_blocks"
+	restoreMetricSuccess          = "last_success"
+	restoreMetricTimestamp        = "last_timestamp_seconds"
+)
+
+// RestoreMetrics records the restore metrics and exposes them to Prometheus as the restore finishes.
+// The restored files are accounted as RestorePlugin, the skipped files and the unwrap results
+// are accounted by FileTarInterpreter. The methods are no-op on the nil metrics.
+type RestoreMetrics struct {
+	NopRestorePlugin
+	metrics *internal.PrometheusMetrics
+}
+
+func NewRestoreMetrics(metrics *internal.PrometheusMetrics) *RestoreMetrics {
+	return &RestoreMetrics{metrics: metrics}
+}
+
+// ConfigureRestoreMetrics creates the metrics from the settings, returns nil if the Prometheus metrics are not configured
+func ConfigureRestoreMetrics() *RestoreMetrics {
+	metrics := internal.ConfigurePrometheusMetrics("restore")
+	if metrics == nil {
+		return nil
+	}
+	return NewRestoreMetrics(metrics)
+}
+
+func (restoreMetrics *RestoreMetrics) OnRestoreStart(info RestoreStartInfo) {
+	restoreMetrics.metrics.Set(restoreMetricFiles, "Number of the files restored by the last restore", 0)
+	restoreMetrics.metrics.Set(restoreMetricBytes, "Size of the files restored by the last restore in bytes", 0)
+	restoreMetrics.metrics.Set(restoreMetricSkippedFiles, "Number of the files skipped by the last restore", 0)
+}
+
+func (restoreMetrics *RestoreMetrics) OnFileComplete(info RestoreFileInfo) {
+	restoreMetrics.metrics.Add(restoreMetricFiles, "Number of the files restored by the last restore", 1)
+	restoreMetrics.metrics.Add(restoreMetricBytes, "Size of the files restored by the last restore in bytes",
+		float64(info.Size))
+}
+
+func (restoreMetrics *RestoreMetrics) OnRestoreFinish(info RestoreFinishInfo) {
+	success := 1.0
+	if info.Err != nil {
+		success = 0
+	}
+	restoreMetrics.metrics.Set(restoreMetricDuration, "Duration of the last restore in seconds", info.Duration.Seconds())
+	restoreMetrics.metrics.Set(restoreMetricSuccess, "Whether the last restore succeeded", success)
+	restoreMetrics.metrics.Set(restoreMetricTimestamp, "Time the last restore finished as the Unix timestamp",
+		float64(utility.TimeNowCrossPlatformUTC().Unix()))
+	if err := restoreMetrics.metrics.Push(); err != nil {
+		tracelog.WarningLogger.Printf("Failed to expose the restore metrics: %v\n", err)
+	}
+}
+
+// trackSkippedFile accounts the file which is not restored, since it is unchanged, restored before
+// or does not fit into the byte budget
+func (restoreMetrics *RestoreMetrics) trackSkippedFile() {
+	if restoreMetrics == nil {
+		return
+	}
+	restoreMetrics.metrics.Add(restoreMetricSkippedFiles, "Number of the files skipped by the last restore", 1)
+}
+
+// trackUnwrapResult accounts the page files of the unwrapped backup created from the increments
+// and the page files the increments were applied to
+func (restoreMetrics *RestoreMetrics) trackUnwrapResult(result *UnwrapResult) {
+	if restoreMetrics == nil || result == nil {
+		return
+	}
+	totals := result.Totals()
+	restoreMetrics.metrics.Add(restoreMetricCreatedPageFiles,
+		"Number of the page files created from the increments by the last restore", float64(totals.CreatedPageFiles))
+	restoreMetrics.metrics.Add(restoreMetricMissingBlocks,
+		"Number of the blocks left to restore in the created page files by the last restore", float64(totals.MissingBlocks))
+	restoreMetrics.metrics.Add(restoreMetricIncrementFiles,
+		"Number of the page files the increments were applied to by the last restore", float64(totals.IncrementFiles))
+	restoreMetrics.metrics.Add(restoreMetricIncrementBlocks,
+		"Number of the increment blocks written by the last restore", float64(totals.IncrementBlocks))
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestRestoreMetrics_SimulatedRestore(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	textfileDirectory := t.TempDir()
+	metrics := internal.NewPrometheusMetrics("restore", textfileDirectory, "", "wal-g")
+	restoreMetrics := NewRestoreMetrics(metrics)
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithRestorePlugin(restoreMetrics), WithRestoreMetrics(restoreMetrics), WithByteBudget(NewRestoreByteBudget(10)))
+
+	restoreMetrics.OnRestoreStart(RestoreStartInfo{BackupName: "base_000000010000000000000002"})
+	content := []byte("data")
+	for _, name := range []string{"/PG_VERSION", "/global/1262", "/base/1/1259"} {
+		err := tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+			Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content)),
+		})
+		require.NoError(t, err)
+	}
+	tarInterpreter.AddFileUnwrapResult(NewCreatedFromIncrementResult(5), "/base/1/16384")
+	tarInterpreter.AddFileUnwrapResult(NewWroteIncrementBlocksResult(3), "/base/1/16385")
+	tarInterpreter.AddFileUnwrapResult(NewWroteIncrementBlocksResult(4), "/base/1/16386")
+	tarInterpreter.reportUnwrapResult("base_000000010000000000000002")
+	restoreMetrics.OnRestoreFinish(RestoreFinishInfo{Duration: 2 * time.Second})
+
+	// the third file does not fit into the byte budget
+	expected := map[string]float64{
+		"last_files":                    2,
+		"last_bytes":                    8,
+		"last_skipped_files":            1,
+		"last_created_page_files":       1,
+		"last_missing_blocks":           5,
+		"last_written_increment_files":  2,
+		"last_written_increment_blocks": 7,
+		"last_duration_seconds":         2,
+		"last_success":                  1,
+	}
+	for name, value := range expected {
+		assert.Equal(t, value, metrics.Value(name), name)
+	}
+	assert.Greater(t, metrics.Value("last_timestamp_seconds"), float64(0))
+
+	textfile, err := os.ReadFile(filepath.Join(textfileDirectory, "walg_restore.prom"))
+	require.NoError(t, err)
+	assert.Contains(t, string(textfile), "# TYPE walg_restore_last_files gauge\nwalg_restore_last_files 2\n")
+	assert.Contains(t, string(textfile), "walg_restore_last_skipped_files 1\n")
+	assert.Contains(t, string(textfile), "walg_restore_last_written_increment_blocks 7\n")
+}
+
+func TestRestoreMetrics_FailedRestore(t *testing.T) {
+	metrics := internal.NewPrometheusMetrics("restore", t.TempDir(), "", "wal-g")
+	restoreMetrics := NewRestoreMetrics(metrics)
+
+	restoreMetrics.OnRestoreStart(RestoreStartInfo{})
+	restoreMetrics.OnRestoreFinish(RestoreFinishInfo{Err: errors.New("failed")})
+
+	assert.Equal(t, float64(0), metrics.Value("last_success"))
+	assert.Equal(t, float64(0), metrics.Value("last_files"))
+}
+
+func TestRestoreMetrics_NopWhenUnconfigured(t *testing.T) {
+	assert.Nil(t, ConfigureRestoreMetrics())
+
+	// the interpreter without the metrics does not account anything
+	var restoreMetrics *RestoreMetrics
+	restoreMetrics.trackSkippedFile()
+	restoreMetrics.trackUnwrapResult(newUnwrapResult())
+}
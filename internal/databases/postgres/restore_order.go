@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"sort"
+
+	"github.com/wal-g/wal-g/internal"
+)
+
+// RestoreEntryPriority defines the order of the backup restore stages,
+// the entries with the lower priority are restored first
+type RestoreEntryPriority int
+
+const (
+	// InfrastructureEntryPriority is the priority of the entries describing the cluster layout
+	// which should be in place before the data files, so an interrupted restore is easier to inspect and resume
+	InfrastructureEntryPriority RestoreEntryPriority = iota
+	// DataEntryPriority is the priority of the rest of the backup files
+	DataEntryPriority
+	// PgControlEntryPriority is the priority of pg_control. It is always restored last,
+	// so the server can not be started on top of an incomplete restore.
+	PgControlEntryPriority
+)
+
+// restoreInfrastructureFiles are restored before the data files. Tablespace symlinks are not listed
+// here since they are created from the sentinel tablespace spec before the extraction starts.
+var restoreInfrastructureFiles = map[string]bool{
+	"/PG_VERSION":               true,
+	"/" + TablespaceMapFilename: true,
+	"/" + BackupLabelFilename:   true,
+	"/global/pg_filenode.map":   true,
+}
+
+// GetRestoreEntryPriority returns the restore priority of the backup file by its archive name
+func GetRestoreEntryPriority(fileName string) RestoreEntryPriority {
+	if fileName == PgControlPath {
+		return PgControlEntryPriority
+	}
+	if restoreInfrastructureFiles[fileName] {
+		return InfrastructureEntryPriority
+	}
+	return DataEntryPriority
+}
+
+// getTarRestorePriority returns the lowest priority of the files in the tar, so the tar which contains
+// at least one infrastructure file is extracted with the infrastructure. Without the information
+// about the tar contents the tar is considered a data one.
+func getTarRestorePriority(tarName string, filesMeta FilesMetadataDto) RestoreEntryPriority {
+	tarFiles, ok := filesMeta.TarFileSets[tarName]
+	if !ok {
+		return DataEntryPriority
+	}
+	priority := DataEntryPriority
+	for _, file := range tarFiles {
+		if filePriority := GetRestoreEntryPriority(file); filePriority < priority {
+			priority = filePriority
+		}
+	}
+	return priority
+}
+
+// splitTarsByRestorePriority groups the tars into the consecutive extraction stages ordered by priority
+func splitTarsByRestorePriority(tarNames []string, filesMeta FilesMetadataDto) [][]string {
+	tarsByPriority := make(map[RestoreEntryPriority][]string)
+	for _, tarName := range tarNames {
+		priority := getTarRestorePriority(tarName, filesMeta)
+		tarsByPriority[priority] = append(tarsByPriority[priority], tarName)
+	}
+	priorities := make([]RestoreEntryPriority, 0, len(tarsByPriority))
+	for priority := range tarsByPriority {
+		priorities = append(priorities, priority)
+	}
+	sort.Slice(priorities, func(i, j int) bool {
+		return priorities[i] < priorities[j]
+	})
+	stages := make([][]string, 0, len(priorities))
+	for _, priority := range priorities {
+		stages = append(stages, tarsByPriority[priority])
+	}
+	return stages
+}
+
+// extractTarsInStages extracts the stages one after another, so the files of the next stage
+// are not written until the previous stage is completely restored
+func extractTarsInStages(tarInterpreter internal.TarInterpreter, stages [][]internal.ReaderMaker) error {
+	if len(stages) == 0 {
+		return internal.ExtractAll(tarInterpreter, nil)
+	}
+	for _, stage := range stages {
+		err := internal.ExtractAll(tarInterpreter, stage)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
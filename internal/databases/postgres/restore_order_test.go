@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRestoreEntryPriority(t *testing.T) {
+	assert.Equal(t, InfrastructureEntryPriority, GetRestoreEntryPriority("/PG_VERSION"))
+	assert.Equal(t, InfrastructureEntryPriority, GetRestoreEntryPriority("/tablespace_map"))
+	assert.Equal(t, DataEntryPriority, GetRestoreEntryPriority("/base/1/1259"))
+	assert.Equal(t, DataEntryPriority, GetRestoreEntryPriority("/base/1/PG_VERSION"))
+	assert.Equal(t, PgControlEntryPriority, GetRestoreEntryPriority(PgControlPath))
+}
+
+func TestSplitTarsByRestorePriority(t *testing.T) {
+	filesMeta := FilesMetadataDto{TarFileSets: map[string][]string{
+		"part_1.tar.lz4": {"/base/1/1259", "/base/1/1260"},
+		"part_2.tar.lz4": {"/base/1/1261", "/PG_VERSION"},
+		"part_3.tar.lz4": {"/base/1/1262"},
+	}}
+
+	stages := splitTarsByRestorePriority([]string{"part_1.tar.lz4", "part_2.tar.lz4", "part_3.tar.lz4"}, filesMeta)
+
+	assert.Equal(t, [][]string{{"part_2.tar.lz4"}, {"part_1.tar.lz4", "part_3.tar.lz4"}}, stages)
+}
+
+func TestSplitTarsByRestorePriority_WithoutFilesMetadata(t *testing.T) {
+	stages := splitTarsByRestorePriority([]string{"part_1.tar.lz4", "part_2.tar.lz4"}, FilesMetadataDto{})
+
+	assert.Equal(t, [][]string{{"part_1.tar.lz4", "part_2.tar.lz4"}}, stages)
+}
+
+func TestSplitTarsByRestorePriority_Empty(t *testing.T) {
+	assert.Empty(t, splitTarsByRestorePriority(nil, FilesMetadataDto{}))
+}
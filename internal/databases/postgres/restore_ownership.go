@@ -0,0 +1,190 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// RestoreOwnership applies the owner stored in the tar headers to the restored files.
+// The stored ids are translated by the uid and gid maps, e.g. to restore the backup taken
+// under one user namespace onto the host with the different numeric ids.
+// The ids are applied as is if no map is configured. The uid and gid overrides, if set,
+// are applied to all the restored files instead of the stored ids.
+// The changes of the owner failed for the lack of the privileges are only reported,
+// unless the ownership is strict.
+type RestoreOwnership struct {
+	uidMap         map[int]int
+	gidMap         map[int]int
+	preserveStored bool
+	uidOverride    int
+	gidOverride    int
+	strict         bool
+
+	mutex            sync.Mutex
+	warnedUids       map[int]bool
+	warnedGids       map[int]bool
+	warnedPermission bool
+}
+
+// NewRestoreOwnership creates the ownership preservation with the id maps, the empty map means identity
+func NewRestoreOwnership(uidMap, gidMap map[int]int) *RestoreOwnership {
+	return &RestoreOwnership{
+		uidMap:         uidMap,
+		gidMap:         gidMap,
+		preserveStored: true,
+		uidOverride:    -1,
+		gidOverride:    -1,
+		warnedUids:     make(map[int]bool),
+		warnedGids:     make(map[int]bool),
+	}
+}
+
+// ConfigureRestoreOwnership creates the ownership preservation from the settings.
+// Returns nil if neither the ownership preservation nor the uid or gid override is enabled.
+func ConfigureRestoreOwnership() (*RestoreOwnership, error) {
+	uidMap, err := ParseIdMap(viper.GetString(internal.RestoreUidMapSetting))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", internal.RestoreUidMapSetting)
+	}
+	gidMap, err := ParseIdMap(viper.GetString(internal.RestoreGidMapSetting))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", internal.RestoreGidMapSetting)
+	}
+	uidOverride, err := configureIdOverride(internal.RestoreUidSetting)
+	if err != nil {
+		return nil, err
+	}
+	gidOverride, err := configureIdOverride(internal.RestoreGidSetting)
+	if err != nil {
+		return nil, err
+	}
+	preserveStored := viper.GetBool(internal.RestorePreserveOwnerSetting)
+	if !preserveStored && (len(uidMap) > 0 || len(gidMap) > 0) {
+		tracelog.WarningLogger.Printf("The uid and gid maps are ignored since %s is disabled\n",
+			internal.RestorePreserveOwnerSetting)
+	}
+	if !preserveStored && uidOverride < 0 && gidOverride < 0 {
+		return nil, nil
+	}
+	ownership := NewRestoreOwnership(uidMap, gidMap)
+	ownership.preserveStored = preserveStored
+	ownership.uidOverride = uidOverride
+	ownership.gidOverride = gidOverride
+	ownership.strict = viper.GetBool(internal.RestoreOwnerStrictSetting)
+	return ownership, nil
+}
+
+// configureIdOverride parses the uid or gid override setting, returns -1 if it is not set
+func configureIdOverride(setting string) (int, error) {
+	value := strings.TrimSpace(viper.GetString(setting))
+	if value == "" {
+		return -1, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return -1, errors.Errorf("invalid %s '%s', expected the numeric id", setting, value)
+	}
+	return int(id), nil
+}
+
+// ParseIdMap parses the comma-separated list of stored_id:target_id pairs, e.g. "26:999,1000:2000"
+func ParseIdMap(value string) (map[int]int, error) {
+	idMap := make(map[int]int)
+	if strings.TrimSpace(value) == "" {
+		return idMap, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), ":")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid id mapping '%s', expected stored_id:target_id", pair)
+		}
+		storedId, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("invalid stored id '%s'", parts[0])
+		}
+		targetId, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("invalid target id '%s'", parts[1])
+		}
+		if _, ok := idMap[int(storedId)]; ok {
+			return nil, errors.Errorf("stored id %d is mapped more than once", storedId)
+		}
+		idMap[int(storedId)] = int(targetId)
+	}
+	return idMap, nil
+}
+
+// mapIds translates the stored ids. The unmapped ids are applied as is with the warning,
+// unless the corresponding map is empty.
+func (ownership *RestoreOwnership) mapIds(uid, gid int) (int, int) {
+	return ownership.mapId(uid, ownership.uidMap, ownership.warnedUids, "uid"),
+		ownership.mapId(gid, ownership.gidMap, ownership.warnedGids, "gid")
+}
+
+func (ownership *RestoreOwnership) mapId(id int, idMap map[int]int, warned map[int]bool, kind string) int {
+	if len(idMap) == 0 {
+		return id
+	}
+	if targetId, ok := idMap[id]; ok {
+		return targetId
+	}
+	ownership.mutex.Lock()
+	defer ownership.mutex.Unlock()
+	if !warned[id] {
+		warned[id] = true
+		tracelog.WarningLogger.Printf("Stored %s %d is not mapped, it is applied as is\n", kind, id)
+	}
+	return id
+}
+
+// targetIds returns the owner to apply to the restored path, -1 keeps the id unchanged
+func (ownership *RestoreOwnership) targetIds(fileInfo *tar.Header) (int, int) {
+	uid, gid := -1, -1
+	if ownership.preserveStored {
+		uid, gid = ownership.mapIds(fileInfo.Uid, fileInfo.Gid)
+	}
+	if ownership.uidOverride >= 0 {
+		uid = ownership.uidOverride
+	}
+	if ownership.gidOverride >= 0 {
+		gid = ownership.gidOverride
+	}
+	return uid, gid
+}
+
+// apply changes the owner of the restored path, the symlinks themselves are changed rather than their targets
+func (ownership *RestoreOwnership) apply(targetPath string, fileInfo *tar.Header) error {
+	uid, gid := ownership.targetIds(fileInfo)
+	err := os.Lchown(targetPath, uid, gid)
+	if err == nil {
+		return nil
+	}
+	err = errors.Wrapf(err, "Interpret: failed to change the owner of %s", targetPath)
+	if ownership.strict || !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	ownership.warnPermission(err)
+	return nil
+}
+
+// warnPermission reports the first change of the owner failed for the lack of the privileges
+func (ownership *RestoreOwnership) warnPermission(err error) {
+	ownership.mutex.Lock()
+	defer ownership.mutex.Unlock()
+	if ownership.warnedPermission {
+		tracelog.DebugLogger.Println(err)
+		return
+	}
+	ownership.warnedPermission = true
+	tracelog.WarningLogger.Printf("%v; the restored files keep their current owner, "+
+		"run the restore with the privileges to change it or set %s to fail instead\n",
+		err, internal.RestoreOwnerStrictSetting)
+}
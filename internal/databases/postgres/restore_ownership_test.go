@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestParseIdMap(t *testing.T) {
+	idMap, err := ParseIdMap(" 26:999, 1000:2000")
+
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int{26: 999, 1000: 2000}, idMap)
+
+	idMap, err = ParseIdMap("")
+	require.NoError(t, err)
+	assert.Empty(t, idMap)
+}
+
+func TestParseIdMap_Invalid(t *testing.T) {
+	for _, value := range []string{"26", "26:", "a:1", "1:-1", "26:999,26:1000"} {
+		_, err := ParseIdMap(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRestoreOwnership_MapIds(t *testing.T) {
+	ownership := NewRestoreOwnership(map[int]int{26: 999}, map[int]int{})
+
+	uid, gid := ownership.mapIds(26, 26)
+	assert.Equal(t, 999, uid)
+	// the empty map is identity
+	assert.Equal(t, 26, gid)
+
+	// the unmapped id is applied as is
+	uid, _ = ownership.mapIds(1000, 26)
+	assert.Equal(t, 1000, uid)
+	assert.True(t, ownership.warnedUids[1000])
+}
+
+func TestInterpretRestoresOwner(t *testing.T) {
+	dataDir := t.TempDir()
+	uid, gid := os.Getuid(), os.Getgid()
+	// the stored ids are mapped to the ids of the current user, so the test does not need the privileges
+	ownership := NewRestoreOwnership(map[int]int{26: uid}, map[int]int{26: gid})
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithRestoreOwnership(ownership))
+
+	err := tarInterpreter.Interpret(strings.NewReader("14\n"), &tar.Header{Name: "PG_VERSION",
+		Typeflag: tar.TypeReg, Mode: 0600, Size: 3, Uid: 26, Gid: 26})
+	require.NoError(t, err)
+	err = tarInterpreter.Interpret(strings.NewReader(""), &tar.Header{Name: "base/",
+		Typeflag: tar.TypeDir, Mode: 0700, Uid: 26, Gid: 26})
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dataDir, "PG_VERSION"))
+	assert.NoError(t, err)
+	assert.Empty(t, ownership.warnedUids)
+
+	err = tarInterpreter.Interpret(strings.NewReader(""), &tar.Header{Name: "global/",
+		Typeflag: tar.TypeDir, Mode: 0700, Uid: uid, Gid: gid})
+	require.NoError(t, err)
+	assert.True(t, ownership.warnedUids[uid])
+}
+
+func TestRestoreOwnership_TargetIds(t *testing.T) {
+	header := &tar.Header{Uid: 26, Gid: 26}
+	ownership := NewRestoreOwnership(map[int]int{26: 999}, map[int]int{})
+	ownership.gidOverride = 1000
+
+	uid, gid := ownership.targetIds(header)
+	assert.Equal(t, 999, uid)
+	assert.Equal(t, 1000, gid)
+
+	// without the ownership preservation the id without the override is kept unchanged
+	ownership.preserveStored = false
+	uid, gid = ownership.targetIds(header)
+	assert.Equal(t, -1, uid)
+	assert.Equal(t, 1000, gid)
+}
+
+func TestConfigureRestoreOwnership_Overrides(t *testing.T) {
+	ownership, err := ConfigureRestoreOwnership()
+	require.NoError(t, err)
+	assert.Nil(t, ownership)
+
+	viper.Set(internal.RestoreUidSetting, "999")
+	defer viper.Set(internal.RestoreUidSetting, "")
+	ownership, err = ConfigureRestoreOwnership()
+	require.NoError(t, err)
+	require.NotNil(t, ownership)
+	assert.False(t, ownership.preserveStored)
+	assert.Equal(t, 999, ownership.uidOverride)
+	assert.Equal(t, -1, ownership.gidOverride)
+
+	viper.Set(internal.RestoreGidSetting, "postgres")
+	defer viper.Set(internal.RestoreGidSetting, "")
+	_, err = ConfigureRestoreOwnership()
+	assert.Error(t, err)
+}
+
+func TestInterpretAppliesOwnerOverride(t *testing.T) {
+	dataDir := t.TempDir()
+	ownership := NewRestoreOwnership(nil, nil)
+	ownership.preserveStored = false
+	ownership.uidOverride, ownership.gidOverride = os.Getuid(), os.Getgid()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithRestoreOwnership(ownership))
+
+	// the stored ids are ignored, so the test does not need the privileges
+	err := tarInterpreter.Interpret(strings.NewReader("14\n"), &tar.Header{Name: "PG_VERSION",
+		Typeflag: tar.TypeReg, Mode: 0600, Size: 3, Uid: 26, Gid: 26})
+	require.NoError(t, err)
+	err = tarInterpreter.Interpret(strings.NewReader(""), &tar.Header{Name: "pg_wal",
+		Typeflag: tar.TypeSymlink, Linkname: "/wal", Uid: 26, Gid: 26})
+	require.NoError(t, err)
+}
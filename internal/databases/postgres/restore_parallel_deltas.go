@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// deltaLayer is the backup of the delta chain with the files it should restore
+type deltaLayer struct {
+	backup        Backup
+	sentinelDto   BackupSentinelDto
+	filesMeta     FilesMetadataDto
+	filesToUnwrap map[string]bool
+}
+
+// writesFile returns true if the layer is expected to write the file, i.e. the file is stored in its tars
+func (layer deltaLayer) writesFile(fileName string) bool {
+	if layer.filesToUnwrap != nil && !layer.filesToUnwrap[fileName] {
+		return false
+	}
+	description, ok := layer.filesMeta.Files[fileName]
+	return ok && !description.IsSkipped
+}
+
+// collectDeltaLayers returns the layers of the delta chain ending with the backup, the full backup goes first
+func collectDeltaLayers(backup Backup, folder storage.Folder, tablespaceSpec *TablespaceSpec,
+	filesToUnwrap map[string]bool) ([]deltaLayer, error) {
+	sentinelDto, filesMetaDto, err := backup.GetSentinelAndFilesMetadata()
+	if err != nil {
+		return nil, err
+	}
+	tablespaceSpec = chooseTablespaceSpecification(sentinelDto.TablespaceSpec, tablespaceSpec)
+	sentinelDto.TablespaceSpec = tablespaceSpec
+	layer := deltaLayer{backup: backup, sentinelDto: sentinelDto, filesMeta: filesMetaDto, filesToUnwrap: filesToUnwrap}
+	if !sentinelDto.IsIncremental() {
+		return []deltaLayer{layer}, nil
+	}
+	baseFilesToUnwrap, err := GetBaseFilesToUnwrap(filesMetaDto.Files, filesToUnwrap)
+	if err != nil {
+		return nil, err
+	}
+	incrementFrom := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), *sentinelDto.IncrementFrom)
+	layers, err := collectDeltaLayers(incrementFrom, folder, tablespaceSpec, baseFilesToUnwrap)
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, layer), nil
+}
+
+type deltaLayerFile struct {
+	done chan struct{}
+	once sync.Once
+}
+
+// deltaLayerSequencer orders the concurrent restore of the delta chain layers: the file of the layer
+// is written once the previous layer writing the same file has finished it, so the increments of every file
+// are applied in the chain order while the different files are restored independently. pg_control is written
+// once all the previous layers are finished, so the pg_control of the latest backup is written the last.
+type deltaLayerSequencer struct {
+	layers    []deltaLayer
+	files     []map[string]*deltaLayerFile
+	layerDone []chan struct{}
+	layerErrs []error
+}
+
+func newDeltaLayerSequencer(layers []deltaLayer) *deltaLayerSequencer {
+	sequencer := &deltaLayerSequencer{
+		layers:    layers,
+		files:     make([]map[string]*deltaLayerFile, len(layers)),
+		layerDone: make([]chan struct{}, len(layers)),
+		layerErrs: make([]error, len(layers)),
+	}
+	for i, layer := range layers {
+		sequencer.files[i] = make(map[string]*deltaLayerFile)
+		for fileName := range layer.filesMeta.Files {
+			if layer.writesFile(fileName) {
+				sequencer.files[i][fileName] = &deltaLayerFile{done: make(chan struct{})}
+			}
+		}
+		sequencer.layerDone[i] = make(chan struct{})
+	}
+	return sequencer
+}
+
+// sequence writes the file of the layer with the write function once the previous layers allow it
+func (sequencer *deltaLayerSequencer) sequence(layer int, fileName string, write func() error) error {
+	err := sequencer.waitForPreviousLayers(layer, fileName)
+	if err != nil {
+		return err
+	}
+	err = write()
+	if err != nil {
+		return err
+	}
+	if file, ok := sequencer.files[layer][fileName]; ok {
+		file.once.Do(func() { close(file.done) })
+	}
+	return nil
+}
+
+func (sequencer *deltaLayerSequencer) waitForPreviousLayers(layer int, fileName string) error {
+	if fileName == PgControlPath {
+		for previous := 0; previous < layer; previous++ {
+			<-sequencer.layerDone[previous]
+			if err := sequencer.layerErrs[previous]; err != nil {
+				return newDeltaLayerFailedError(sequencer.layers[previous].backup.Name)
+			}
+		}
+		return nil
+	}
+	// the previous layer which has finished without writing the file, e.g. because of the part allowlist,
+	// does not order it, so the search goes on to the layers before it
+	for previous := layer - 1; previous >= 0; previous-- {
+		file, ok := sequencer.files[previous][fileName]
+		if !ok {
+			continue
+		}
+		select {
+		case <-file.done:
+			return nil
+		case <-sequencer.layerDone[previous]:
+			if err := sequencer.layerErrs[previous]; err != nil {
+				return newDeltaLayerFailedError(sequencer.layers[previous].backup.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// waitForTarFiles waits until the previous layers allow to write all the files of the tar which the layer writes.
+// pg_control is not waited for since it has its own tar extracted last.
+func (sequencer *deltaLayerSequencer) waitForTarFiles(layer int, fileNames []string) error {
+	for _, fileName := range fileNames {
+		if _, ok := sequencer.files[layer][fileName]; !ok || fileName == PgControlPath {
+			continue
+		}
+		if err := sequencer.waitForPreviousLayers(layer, fileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sequencedReaderMaker opens the tar of the layer only once the previous layers have written all of its files,
+// so its entries are interpreted without waiting and the tar stream is not held open meanwhile
+type sequencedReaderMaker struct {
+	internal.ReaderMaker
+	wait func() error
+}
+
+func (readerMaker *sequencedReaderMaker) Reader() (io.ReadCloser, error) {
+	if err := readerMaker.wait(); err != nil {
+		return nil, err
+	}
+	return readerMaker.ReaderMaker.Reader()
+}
+
+// sequenceTars schedules the tars of the delta chain layer restored concurrently after the tars of the previous
+// layers holding the same files. Without the tar file sets in the backup metadata the entries wait in the tar.
+func (backup *Backup) sequenceTars(tarInterpreter *FileTarInterpreter,
+	stages [][]internal.ReaderMaker) [][]internal.ReaderMaker {
+	sequencer := tarInterpreter.layerSequencer
+	if sequencer == nil || len(tarInterpreter.FilesMetadata.TarFileSets) == 0 {
+		return stages
+	}
+	for _, stage := range stages {
+		for i, readerMaker := range stage {
+			fileNames := tarInterpreter.FilesMetadata.TarFileSets[readerMaker.Path()]
+			stage[i] = &sequencedReaderMaker{ReaderMaker: readerMaker, wait: func() error {
+				return sequencer.waitForTarFiles(tarInterpreter.layer, fileNames)
+			}}
+		}
+	}
+	return stages
+}
+
+// finishLayer releases the files waiting for the layer, it must be called once the layer extraction returns
+func (sequencer *deltaLayerSequencer) finishLayer(layer int, err error) {
+	sequencer.layerErrs[layer] = err
+	close(sequencer.layerDone[layer])
+}
+
+func newDeltaLayerFailedError(backupName string) error {
+	return errors.Errorf("the restore of the previous delta chain layer %s has failed", backupName)
+}
+
+// deltaFetchParallelOld restores the layers of the delta chain concurrently. The layers of every file
+// are applied in the chain order, see deltaLayerSequencer, and the tars are opened in that order, see sequenceTars.
+func deltaFetchParallelOld(backup Backup, folder storage.Folder, dbDataDirectory string,
+	tablespaceSpec *TablespaceSpec, filesToUnwrap map[string]bool, interpreterOptions ...FileTarInterpreterOption) error {
+	layers, err := collectDeltaLayers(backup, folder, tablespaceSpec, filesToUnwrap)
+	if err != nil {
+		return err
+	}
+	if len(layers) == 1 {
+		return deltaFetchRecursionOld(backup, folder, dbDataDirectory, tablespaceSpec, filesToUnwrap,
+			interpreterOptions...)
+	}
+	for _, layer := range layers {
+		err = checkDBDirectoryForUnwrap(dbDataDirectory, layer.sentinelDto, layer.filesMeta, interpreterOptions...)
+		if err != nil {
+			return err
+		}
+	}
+	tracelog.InfoLogger.Printf("Restoring %d layers of the delta chain concurrently\n", len(layers))
+
+	sequencer := newDeltaLayerSequencer(layers)
+	var wg sync.WaitGroup
+	for i := range layers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			layer := layers[i]
+			options := append(append([]FileTarInterpreterOption{}, interpreterOptions...), withDeltaLayer(sequencer, i))
+			err := layer.backup.unwrapOld(dbDataDirectory, layer.sentinelDto, layer.filesMeta, layer.filesToUnwrap,
+				false, options...)
+			if err != nil {
+				err = errors.Wrapf(err, "failed to restore the delta chain layer %s", layer.backup.Name)
+			}
+			sequencer.finishLayer(i, err)
+		}(i)
+	}
+	wg.Wait()
+	// the first failed layer is the cause, the later ones may fail because of it
+	for _, err := range sequencer.layerErrs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
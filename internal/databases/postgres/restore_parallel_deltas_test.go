@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const parallelDeltasTestDelta2 = "base_000000010000000000000006_D_000000010000000000000004"
+
+func makeSequencerTestLayers(files ...internal.BackupFileList) []deltaLayer {
+	layers := make([]deltaLayer, 0, len(files))
+	for i, layerFiles := range files {
+		layers = append(layers, deltaLayer{
+			backup:    Backup{Backup: internal.Backup{Name: string(rune('a' + i))}},
+			filesMeta: FilesMetadataDto{Files: layerFiles},
+		})
+	}
+	return layers
+}
+
+// runSequencedWrites writes the file in every layer concurrently, the later layers start first,
+// and returns the order the layers have written it in
+func runSequencedWrites(t *testing.T, sequencer *deltaLayerSequencer, layers []int, fileName string) []int {
+	var mutex sync.Mutex
+	order := make([]int, 0, len(layers))
+	var wg sync.WaitGroup
+	for i := len(layers) - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(layer int) {
+			defer wg.Done()
+			err := sequencer.sequence(layer, fileName, func() error {
+				time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+				mutex.Lock()
+				defer mutex.Unlock()
+				order = append(order, layer)
+				return nil
+			})
+			assert.NoError(t, err)
+		}(layers[i])
+	}
+	wg.Wait()
+	return order
+}
+
+func TestDeltaLayerSequencer_AppliesLayersInOrder(t *testing.T) {
+	for iteration := 0; iteration < 50; iteration++ {
+		sequencer := newDeltaLayerSequencer(makeSequencerTestLayers(
+			internal.BackupFileList{"/base/1/1259": {}},
+			internal.BackupFileList{"/base/1/1259": {IsIncremented: true}},
+			internal.BackupFileList{"/base/1/1259": {IsIncremented: true}},
+			internal.BackupFileList{"/base/1/1259": {IsIncremented: true}},
+		))
+
+		assert.Equal(t, []int{0, 1, 2, 3}, runSequencedWrites(t, sequencer, []int{0, 1, 2, 3}, "/base/1/1259"))
+	}
+}
+
+func TestDeltaLayerSequencer_SkippedFileWaitsForEarlierLayer(t *testing.T) {
+	sequencer := newDeltaLayerSequencer(makeSequencerTestLayers(
+		internal.BackupFileList{"/base/1/1259": {}},
+		internal.BackupFileList{"/base/1/1259": {IsSkipped: true}},
+		internal.BackupFileList{"/base/1/1259": {IsIncremented: true}},
+	))
+
+	assert.Equal(t, []int{0, 2}, runSequencedWrites(t, sequencer, []int{0, 2}, "/base/1/1259"))
+}
+
+func TestDeltaLayerSequencer_FinishedLayerReleasesMissingFile(t *testing.T) {
+	sequencer := newDeltaLayerSequencer(makeSequencerTestLayers(
+		internal.BackupFileList{"/base/1/1259": {}},
+		internal.BackupFileList{"/base/1/1259": {IsIncremented: true}},
+	))
+	// the layer has finished without writing the file, e.g. because its tar was not in the allowlist
+	sequencer.finishLayer(0, nil)
+
+	assert.NoError(t, sequencer.sequence(1, "/base/1/1259", func() error { return nil }))
+}
+
+func TestDeltaLayerSequencer_FailedLayerFailsLaterLayers(t *testing.T) {
+	sequencer := newDeltaLayerSequencer(makeSequencerTestLayers(
+		internal.BackupFileList{"/base/1/1259": {}},
+		internal.BackupFileList{"/base/1/1259": {IsIncremented: true}},
+	))
+	sequencer.finishLayer(0, errors.New("broken tar"))
+
+	written := false
+	err := sequencer.sequence(1, "/base/1/1259", func() error {
+		written = true
+		return nil
+	})
+	assert.Error(t, err)
+	assert.False(t, written)
+}
+
+func TestDeltaLayerSequencer_PgControlWaitsForPreviousLayers(t *testing.T) {
+	sequencer := newDeltaLayerSequencer(makeSequencerTestLayers(
+		internal.BackupFileList{"/base/1/1259": {}},
+		internal.BackupFileList{},
+	))
+	pgControlWritten := make(chan struct{})
+	go func() {
+		assert.NoError(t, sequencer.sequence(1, PgControlPath, func() error { return nil }))
+		close(pgControlWritten)
+	}()
+
+	select {
+	case <-pgControlWritten:
+		t.Fatal("pg_control is written before the previous layer is finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	sequencer.finishLayer(0, nil)
+	<-pgControlWritten
+}
+
+type openedTestReaderMaker struct {
+	opened chan struct{}
+}
+
+func (readerMaker *openedTestReaderMaker) Reader() (io.ReadCloser, error) {
+	close(readerMaker.opened)
+	return io.NopCloser(bytes.NewReader(nil)), nil
+}
+func (readerMaker *openedTestReaderMaker) Path() string                { return "part_1.tar.lz4" }
+func (readerMaker *openedTestReaderMaker) FileType() internal.FileType { return internal.TarFileType }
+func (readerMaker *openedTestReaderMaker) Mode() int                   { return 0 }
+
+func TestSequenceTars_OpensTarAfterPreviousLayers(t *testing.T) {
+	layers := makeSequencerTestLayers(
+		internal.BackupFileList{"/base/1/1259": {}},
+		internal.BackupFileList{"/base/1/1259": {IsIncremented: true}, "/base/1/1260": {}},
+	)
+	sequencer := newDeltaLayerSequencer(layers)
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, FilesMetadataDto{
+		Files:       layers[1].filesMeta.Files,
+		TarFileSets: map[string][]string{"part_1.tar.lz4": {"/base/1/1259", "/base/1/1260"}},
+	}, nil, false, withDeltaLayer(sequencer, 1))
+	readerMaker := &openedTestReaderMaker{opened: make(chan struct{})}
+	stages := layers[1].backup.sequenceTars(tarInterpreter, [][]internal.ReaderMaker{{readerMaker}})
+	go func() {
+		reader, err := stages[0][0].Reader()
+		assert.NoError(t, err)
+		utility.LoggedClose(reader, "")
+	}()
+
+	select {
+	case <-readerMaker.opened:
+		t.Fatal("the tar is opened before the previous layer has written its file")
+	case <-time.After(20 * time.Millisecond):
+	}
+	require.NoError(t, sequencer.sequence(0, "/base/1/1259", func() error { return nil }))
+	<-readerMaker.opened
+}
+
+func putParallelDeltasTestPgControl(t *testing.T, folder *memory.Folder, backupName, content string) {
+	tarFolder := folder.GetSubFolder(utility.BaseBackupPath).GetSubFolder(backupName + internal.TarPartitionFolderName)
+	require.NoError(t, tarFolder.PutObject("pg_control.tar.lz4",
+		bytes.NewReader(makeCompressedTestTar(t, testTarEntry{name: PgControlPath, content: content}))))
+}
+
+func TestDeltaFetchParallelOld(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putDiffTestBackup(t, folder, diffTestFullBackup, "{}", internal.BackupFileList{
+		"/base/1/1259": {}, "/base/1/1260": {}, "/PG_VERSION": {}, PgControlPath: {},
+	},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestPage('a') + makeDiffTestPage('b') + makeDiffTestPage('c')},
+		testTarEntry{name: "/base/1/1260", content: makeDiffTestPage('d')},
+		testTarEntry{name: "/PG_VERSION", content: "14\n"})
+	putParallelDeltasTestPgControl(t, folder, diffTestFullBackup, "full")
+	putDiffTestBackup(t, folder, diffTestDeltaBackup,
+		`{"LSN":67108904,"DeltaFrom":"`+diffTestFullBackup+`","DeltaLSN":33554472,`+
+			`"DeltaFullName":"`+diffTestFullBackup+`","DeltaCount":1}`,
+		internal.BackupFileList{
+			"/base/1/1259": {IsIncremented: true}, "/base/1/1260": {IsSkipped: true}, "/PG_VERSION": {IsSkipped: true},
+			PgControlPath: {},
+		},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestIncrement(uint64(3*DatabasePageSize),
+			map[uint32]string{1: makeDiffTestPage('B')})})
+	putParallelDeltasTestPgControl(t, folder, diffTestDeltaBackup, "delta 1")
+	putDiffTestBackup(t, folder, parallelDeltasTestDelta2,
+		`{"LSN":100663336,"DeltaFrom":"`+diffTestDeltaBackup+`","DeltaLSN":67108904,`+
+			`"DeltaFullName":"`+diffTestFullBackup+`","DeltaCount":2}`,
+		internal.BackupFileList{
+			"/base/1/1259": {IsIncremented: true}, "/base/1/1260": {IsIncremented: true}, "/PG_VERSION": {IsSkipped: true},
+			PgControlPath: {},
+		},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestIncrement(uint64(3*DatabasePageSize),
+			map[uint32]string{1: makeDiffTestPage('X'), 2: makeDiffTestPage('C')})},
+		testTarEntry{name: "/base/1/1260", content: makeDiffTestIncrement(uint64(2*DatabasePageSize),
+			map[uint32]string{1: makeDiffTestPage('E')})})
+	putParallelDeltasTestPgControl(t, folder, parallelDeltasTestDelta2, "delta 2")
+
+	for iteration := 0; iteration < 10; iteration++ {
+		dbDataDirectory := t.TempDir()
+		backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), parallelDeltasTestDelta2)
+		filesToUnwrap, err := backup.GetFilesToUnwrap("")
+		require.NoError(t, err)
+
+		require.NoError(t, deltaFetchParallelOld(backup, folder, dbDataDirectory, nil, filesToUnwrap))
+
+		for name, expected := range map[string]string{
+			"base/1/1259":       makeDiffTestPage('a') + makeDiffTestPage('X') + makeDiffTestPage('C'),
+			"base/1/1260":       makeDiffTestPage('d') + makeDiffTestPage('E'),
+			"PG_VERSION":        "14\n",
+			"global/pg_control": "delta 2",
+		} {
+			content, err := os.ReadFile(filepath.Join(dbDataDirectory, name))
+			require.NoError(t, err)
+			assert.Equal(t, expected, string(content), name)
+		}
+	}
+}
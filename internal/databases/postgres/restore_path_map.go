@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"archive/tar"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// RestorePathMap rewrites the absolute paths of the backup host to the ones of the restore host, e.g. to restore
+// into the chroot or the differently laid out host. The path starting with the old prefix gets the new prefix
+// instead, the longest matching old prefix wins. It applies to the symlink targets, the tablespace locations
+// of the tablespace specification, and the absolute hardlink sources.
+type RestorePathMap struct {
+	// oldPrefixes are sorted by the length descending, so the longest matching prefix is found first
+	oldPrefixes []string
+	newPrefixes map[string]string
+}
+
+// NewRestorePathMap validates the path map: both prefixes must be the absolute paths, the old ones distinct
+func NewRestorePathMap(prefixes map[string]string) (*RestorePathMap, error) {
+	pathMap := &RestorePathMap{
+		oldPrefixes: make([]string, 0, len(prefixes)),
+		newPrefixes: make(map[string]string, len(prefixes)),
+	}
+	for oldPrefix, newPrefix := range prefixes {
+		if !path.IsAbs(oldPrefix) || !path.IsAbs(newPrefix) {
+			return nil, errors.Errorf("path map '%s=%s' must map the absolute paths", oldPrefix, newPrefix)
+		}
+		oldPrefix, newPrefix = path.Clean(oldPrefix), path.Clean(newPrefix)
+		if _, ok := pathMap.newPrefixes[oldPrefix]; ok {
+			return nil, errors.Errorf("path '%s' is mapped several times", oldPrefix)
+		}
+		pathMap.oldPrefixes = append(pathMap.oldPrefixes, oldPrefix)
+		pathMap.newPrefixes[oldPrefix] = newPrefix
+	}
+	sort.Slice(pathMap.oldPrefixes, func(i, j int) bool {
+		return len(pathMap.oldPrefixes[i]) > len(pathMap.oldPrefixes[j])
+	})
+	return pathMap, nil
+}
+
+// rewrite returns the absolute path with the old prefix replaced by the new one, or false if no prefix matches
+func (pathMap *RestorePathMap) rewrite(storedPath string) (string, bool) {
+	if pathMap == nil || !path.IsAbs(storedPath) {
+		return "", false
+	}
+	for _, oldPrefix := range pathMap.oldPrefixes {
+		if !isInsideDirectory(oldPrefix, storedPath) {
+			continue
+		}
+		relativePath, err := filepath.Rel(oldPrefix, path.Clean(storedPath))
+		if err != nil {
+			continue
+		}
+		return path.Join(pathMap.newPrefixes[oldPrefix], relativePath), true
+	}
+	return "", false
+}
+
+// remapSpec returns the copy of the tablespace specification with the tablespace locations rewritten
+func (pathMap *RestorePathMap) remapSpec(spec *TablespaceSpec) *TablespaceSpec {
+	if pathMap == nil || spec == nil {
+		return spec
+	}
+	remappedSpec := NewTablespaceSpec("")
+	remappedSpec.basePrefix = spec.basePrefix
+	for _, name := range spec.TablespaceNames() {
+		location, _ := spec.location(name)
+		newLocation, ok := pathMap.rewrite(location.Location)
+		if !ok {
+			newLocation = location.Location
+		} else {
+			tracelog.InfoLogger.Printf("Tablespace %s location is rewritten from '%s' to '%s'\n",
+				name, location.Location, newLocation)
+		}
+		remappedSpec.addTablespace(name, newLocation)
+	}
+	return &remappedSpec
+}
+
+// getSymlinkTarget returns the target of the symlink entry rewritten by the path map
+func (tarInterpreter *FileTarInterpreter) getSymlinkTarget(fileInfo *tar.Header) string {
+	linkname, ok := tarInterpreter.policy.pathMap.rewrite(fileInfo.Linkname)
+	if !ok {
+		return fileInfo.Linkname
+	}
+	tracelog.InfoLogger.Printf("Symlink '%s' target is rewritten from '%s' to '%s'\n",
+		fileInfo.Name, fileInfo.Linkname, linkname)
+	return linkname
+}
+
+// getHardlinkSourcePath returns the path of the hardlink source. The source is the archive path resolved against
+// the data directory, unless the path map rewrites it to the absolute path inside the data directory,
+// e.g. if the tar stores the absolute source path of the backup host.
+func (tarInterpreter *FileTarInterpreter) getHardlinkSourcePath(fileInfo *tar.Header) (string, error) {
+	sourcePath, ok := tarInterpreter.policy.pathMap.rewrite(fileInfo.Linkname)
+	if ok && isInsideDirectory(tarInterpreter.DBDataDirectory, sourcePath) {
+		tracelog.DebugLogger.Printf("Hardlink '%s' source is rewritten from '%s' to '%s'\n",
+			fileInfo.Name, fileInfo.Linkname, sourcePath)
+		return sourcePath, nil
+	}
+	return getTargetPath(tarInterpreter.DBDataDirectory, fileInfo.Linkname)
+}
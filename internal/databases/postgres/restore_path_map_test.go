@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRestorePathMap(t *testing.T) {
+	pathMap, err := NewRestorePathMap(map[string]string{"/mnt/ts/": "/srv/ts", "/mnt/ts/fast": "/nvme/ts", "/": "/chroot"})
+	require.NoError(t, err)
+
+	for storedPath, expected := range map[string]string{
+		"/mnt/ts/16385":       "/srv/ts/16385",
+		"/mnt/ts":             "/srv/ts",
+		"/mnt/ts/fast/16390":  "/nvme/ts/16390",
+		"/mnt/ts10/16395":     "/chroot/mnt/ts10/16395",
+		"/var/lib/pg/pg_wal/": "/chroot/var/lib/pg/pg_wal",
+	} {
+		rewritten, ok := pathMap.rewrite(storedPath)
+		assert.True(t, ok, storedPath)
+		assert.Equal(t, expected, rewritten, storedPath)
+	}
+	_, ok := pathMap.rewrite("../pg_wal")
+	assert.False(t, ok)
+
+	for _, prefixes := range []map[string]string{
+		{"mnt/ts": "/srv/ts"},
+		{"/mnt/ts": "srv/ts"},
+		{"/mnt/ts": "/srv/ts", "/mnt/ts/": "/srv/other"},
+	} {
+		_, err := NewRestorePathMap(prefixes)
+		assert.Error(t, err, prefixes)
+	}
+}
+
+func newPathMapTestInterpreter(t *testing.T, dataDir string, prefixes map[string]string,
+	options ...FileTarInterpreterOption) *FileTarInterpreter {
+	pathMap, err := NewRestorePathMap(prefixes)
+	require.NoError(t, err)
+	return NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		append(options, WithPathMap(pathMap))...)
+}
+
+func TestInterpretTablespaceSymlink_PathMap(t *testing.T) {
+	test := newTablespaceSymlinkTest(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(test.newLocation, "16385"), 0700))
+	tarInterpreter := newPathMapTestInterpreter(t, test.dataDir, map[string]string{test.backupLocation: test.newLocation})
+
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil), &tar.Header{
+		Name:     "/pg_tblspc/16385",
+		Typeflag: tar.TypeSymlink,
+		Linkname: filepath.Join(test.backupLocation, "16385"),
+	}))
+
+	test.requireSymlinkTarget(t, filepath.Join(test.newLocation, "16385"))
+}
+
+func TestInterpretTablespaceSymlink_TablespaceMappingPreferredOverPathMap(t *testing.T) {
+	test := newTablespaceSymlinkTest(t)
+	otherLocation := filepath.Join(t.TempDir(), "ts_other")
+	require.NoError(t, os.Mkdir(test.newLocation, 0700))
+	mapping, err := NewRestoreTablespaceMapping(map[string]string{"16385": test.newLocation})
+	require.NoError(t, err)
+	tarInterpreter := newPathMapTestInterpreter(t, test.dataDir, map[string]string{test.backupLocation: otherLocation},
+		WithTablespaceMapping(mapping))
+
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/pg_tblspc/16385", Typeflag: tar.TypeSymlink, Linkname: test.backupLocation}))
+
+	test.requireSymlinkTarget(t, test.newLocation)
+}
+
+func TestInterpretSymlink_PathMapRewritesWalDirectory(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	require.NoError(t, os.Mkdir(dataDir, 0700))
+	tarInterpreter := newPathMapTestInterpreter(t, dataDir, map[string]string{"/var/lib/pg_wal": filepath.Join(root, "wal")})
+
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/pg_wal", Typeflag: tar.TypeSymlink, Linkname: "/var/lib/pg_wal/main"}))
+
+	target, err := os.Readlink(filepath.Join(dataDir, "pg_wal"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "wal", "main"), target)
+}
+
+func TestInterpretSymlink_PathMapRewritesTargetIntoDataDirectory(t *testing.T) {
+	dataDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "base", "1"), 0700))
+	tarInterpreter := newPathMapTestInterpreter(t, dataDir, map[string]string{"/var/lib/pgsql/data": dataDir})
+
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/base/1/1259_link", Typeflag: tar.TypeSymlink, Linkname: "/var/lib/pgsql/data/global/1262"}))
+	err := tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/base/1/1260_link", Typeflag: tar.TypeSymlink, Linkname: "/var/lib/pgsql/other/global/1262"})
+
+	target, readErr := os.Readlink(filepath.Join(dataDir, "base", "1", "1259_link"))
+	require.NoError(t, readErr)
+	assert.Equal(t, filepath.Join(dataDir, "global", "1262"), target)
+	assert.IsType(t, TarEntryOutsideDataDirectoryError{}, err)
+}
+
+func TestInterpretSymlink_PathMapRewritesTargetIntoTablespace(t *testing.T) {
+	test := newTablespaceSymlinkTest(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(test.dataDir, "base", "1"), 0700))
+	spec := NewTablespaceSpec(test.dataDir)
+	spec.addTablespace("16385", test.backupLocation)
+	pathMap, err := NewRestorePathMap(map[string]string{test.backupLocation: test.newLocation})
+	require.NoError(t, err)
+	tarInterpreter := NewFileTarInterpreter(test.dataDir, BackupSentinelDto{TablespaceSpec: &spec}, FilesMetadataDto{},
+		nil, false, WithPathMap(pathMap))
+
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil), &tar.Header{
+		Name:     "/base/1/1259_link",
+		Typeflag: tar.TypeSymlink,
+		Linkname: filepath.Join(test.backupLocation, "PG_14_202107181", "1", "1259"),
+	}))
+
+	target, err := os.Readlink(filepath.Join(test.dataDir, "base", "1", "1259_link"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(test.newLocation, "PG_14_202107181", "1", "1259"), target)
+}
+
+func TestInterpretHardlink_PathMapRewritesSource(t *testing.T) {
+	dataDir := t.TempDir()
+	tarInterpreter := newPathMapTestInterpreter(t, dataDir, map[string]string{"/var/lib/pgsql/data": dataDir})
+	content := []byte("content")
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(content),
+		&tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))}))
+
+	// the absolute source of the backup host is rewritten, the archive path is resolved as usual
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/base/1/1259_copy", Typeflag: tar.TypeLink, Linkname: "/var/lib/pgsql/data/base/1/1259"}))
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/base/1/1259_link", Typeflag: tar.TypeLink, Linkname: "/base/1/1259"}))
+
+	for _, name := range []string{"1259_copy", "1259_link"} {
+		linkContent, err := os.ReadFile(filepath.Join(dataDir, "base", "1", name))
+		require.NoError(t, err)
+		assert.Equal(t, content, linkContent, name)
+	}
+}
+
+func TestInterpretHardlink_PathMapOutsideDataDirectory(t *testing.T) {
+	dataDir := t.TempDir()
+	tarInterpreter := newPathMapTestInterpreter(t, dataDir, map[string]string{"/var/lib/pgsql/data": t.TempDir()})
+
+	err := tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/base/1/1259_copy", Typeflag: tar.TypeLink, Linkname: "/var/lib/pgsql/data/base/1/1259"})
+
+	// the rewritten source outside of the data directory is not used, the archive path does not exist
+	assert.Error(t, err)
+	_, err = os.Lstat(filepath.Join(dataDir, "base", "1", "1259_copy"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSetTablespacePaths_PathMap(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionFail, "")
+	pathMap, err := NewRestorePathMap(map[string]string{test.backupLocation: test.otherLocation})
+	require.NoError(t, err)
+
+	remappedSpec := pathMap.remapSpec(&test.spec)
+	require.NoError(t, setTablespacePaths(*remappedSpec))
+
+	test.requireSymlinkTarget(t, test.otherLocation)
+	// the specification of the backup is not changed
+	location, _ := test.spec.location("16385")
+	assert.Equal(t, test.backupLocation, location.Location)
+	basePrefix, _ := remappedSpec.BasePrefix()
+	assert.Equal(t, test.dataDir, basePrefix)
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RestoreStartInfo describes the restore which is about to start
+type RestoreStartInfo struct {
+	BackupName      string
+	DBDataDirectory string
+}
+
+// RestoreFileInfo describes the single restored file
+type RestoreFileInfo struct {
+	// Name is the archive name of the file, e.g. /base/1/1259
+	Name       string
+	TargetPath string
+	Size       int64
+}
+
+// RestoreTablespaceInfo describes the tablespace which files are all restored
+type RestoreTablespaceInfo struct {
+	// Name is the tablespace symlink name inside pg_tblspc, e.g. 16385
+	Name      string
+	FileCount int
+}
+
+// RestoreFinishInfo describes the finished restore. Err is nil if restore succeeded.
+type RestoreFinishInfo struct {
+	BackupName      string
+	DBDataDirectory string
+	Duration        time.Duration
+	Err             error
+}
+
+// RestorePlugin receives notifications about the backup restore lifecycle.
+// Restore does not wait for anything that plugin does in background, so all
+// the methods should return quickly. OnFileComplete may be called concurrently
+// from the different extraction goroutines, so it must be safe for concurrent use.
+//
+// The order of the events for a single restore is the following:
+// OnRestoreStart, OnFileComplete for each restored file (in arbitrary order),
+// OnTablespaceComplete for each restored tablespace, OnRestoreFinish.
+// OnTablespaceComplete calls are skipped if the restore has failed.
+type RestorePlugin interface {
+	OnRestoreStart(info RestoreStartInfo)
+	OnFileComplete(info RestoreFileInfo)
+	OnTablespaceComplete(info RestoreTablespaceInfo)
+	OnRestoreFinish(info RestoreFinishInfo)
+}
+
+// NopRestorePlugin is the RestorePlugin which ignores all the events
+type NopRestorePlugin struct{}
+
+func (NopRestorePlugin) OnRestoreStart(RestoreStartInfo)            {}
+func (NopRestorePlugin) OnFileComplete(RestoreFileInfo)             {}
+func (NopRestorePlugin) OnTablespaceComplete(RestoreTablespaceInfo) {}
+func (NopRestorePlugin) OnRestoreFinish(RestoreFinishInfo)          {}
+
+// MultiRestorePlugin passes the events to every plugin in order
+type MultiRestorePlugin []RestorePlugin
+
+func (plugins MultiRestorePlugin) OnRestoreStart(info RestoreStartInfo) {
+	for _, plugin := range plugins {
+		plugin.OnRestoreStart(info)
+	}
+}
+
+func (plugins MultiRestorePlugin) OnFileComplete(info RestoreFileInfo) {
+	for _, plugin := range plugins {
+		plugin.OnFileComplete(info)
+	}
+}
+
+func (plugins MultiRestorePlugin) OnTablespaceComplete(info RestoreTablespaceInfo) {
+	for _, plugin := range plugins {
+		plugin.OnTablespaceComplete(info)
+	}
+}
+
+func (plugins MultiRestorePlugin) OnRestoreFinish(info RestoreFinishInfo) {
+	for _, plugin := range plugins {
+		plugin.OnRestoreFinish(info)
+	}
+}
+
+// tablespaceTrackingPlugin groups the restored files by tablespaces
+// and emits the OnTablespaceComplete events before the restore finish
+type tablespaceTrackingPlugin struct {
+	RestorePlugin
+	startTime time.Time
+
+	tablespaceFilesMutex sync.Mutex
+	// tablespaceFiles are the sets of the restored files of the tablespaces, the file restored
+	// by several backups of the delta chain is counted once
+	tablespaceFiles map[string]map[string]bool
+}
+
+func newTablespaceTrackingPlugin(plugin RestorePlugin) *tablespaceTrackingPlugin {
+	if plugin == nil {
+		plugin = NopRestorePlugin{}
+	}
+	return &tablespaceTrackingPlugin{RestorePlugin: plugin, tablespaceFiles: make(map[string]map[string]bool)}
+}
+
+func (p *tablespaceTrackingPlugin) OnRestoreStart(info RestoreStartInfo) {
+	p.startTime = time.Now()
+	p.RestorePlugin.OnRestoreStart(info)
+}
+
+func (p *tablespaceTrackingPlugin) OnFileComplete(info RestoreFileInfo) {
+	if tablespaceName, ok := getTablespaceName(info.Name); ok {
+		p.tablespaceFilesMutex.Lock()
+		if p.tablespaceFiles[tablespaceName] == nil {
+			p.tablespaceFiles[tablespaceName] = make(map[string]bool)
+		}
+		p.tablespaceFiles[tablespaceName][info.Name] = true
+		p.tablespaceFilesMutex.Unlock()
+	}
+	p.RestorePlugin.OnFileComplete(info)
+}
+
+func (p *tablespaceTrackingPlugin) OnRestoreFinish(info RestoreFinishInfo) {
+	if info.Err == nil {
+		p.tablespaceFilesMutex.Lock()
+		names := make([]string, 0, len(p.tablespaceFiles))
+		for name := range p.tablespaceFiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p.RestorePlugin.OnTablespaceComplete(RestoreTablespaceInfo{Name: name, FileCount: len(p.tablespaceFiles[name])})
+		}
+		p.tablespaceFilesMutex.Unlock()
+	}
+	info.Duration = time.Since(p.startTime)
+	p.RestorePlugin.OnRestoreFinish(info)
+}
+
+// getTablespaceName extracts the tablespace symlink name from the archive file name
+func getTablespaceName(fileName string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(fileName, "/"), "/")
+	if len(parts) < 3 || parts[0] != TablespaceFolder {
+		return "", false
+	}
+	return parts[1], true
+}
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tablespaceRecordingPlugin struct {
+	NopRestorePlugin
+	tablespaces []RestoreTablespaceInfo
+}
+
+func (plugin *tablespaceRecordingPlugin) OnTablespaceComplete(info RestoreTablespaceInfo) {
+	plugin.tablespaces = append(plugin.tablespaces, info)
+}
+
+func TestTablespaceTrackingPlugin_DeltaChain(t *testing.T) {
+	recorder := &tablespaceRecordingPlugin{}
+	plugin := newTablespaceTrackingPlugin(recorder)
+
+	plugin.OnRestoreStart(RestoreStartInfo{BackupName: "base_000000010000000000000004_D_000000010000000000000002"})
+	// every backup of the delta chain restores its version of the same files
+	for i := 0; i < 2; i++ {
+		for _, fileName := range []string{"/pg_tblspc/16385/PG_14_202107181/1/1259", "/pg_tblspc/16385/PG_14_202107181/1/1260",
+			"/pg_tblspc/16390/PG_14_202107181/1/1259", "/base/1/1259"} {
+			plugin.OnFileComplete(RestoreFileInfo{Name: fileName})
+		}
+	}
+	plugin.OnFileComplete(RestoreFileInfo{Name: "/pg_tblspc/16390/PG_14_202107181/1/1261"})
+	plugin.OnRestoreFinish(RestoreFinishInfo{})
+
+	assert.Equal(t, []RestoreTablespaceInfo{{Name: "16385", FileCount: 2}, {Name: "16390", FileCount: 2}},
+		recorder.tablespaces)
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"archive/tar"
+
+	"github.com/wal-g/tracelog"
+)
+
+// restorePolicy groups the restore options which only filter or redirect the tar entries: the exclusion,
+// the byte budget, the capacity guard and the concurrency limits admit the regular files, the best-effort
+// restore collects their errors and the path map redirects the link targets. The nil options are disabled.
+type restorePolicy struct {
+	exclusion          *RestoreExclusion
+	byteBudget         *RestoreByteBudget
+	capacityGuard      *RestoreCapacityGuard
+	concurrencyLimiter *RestoreConcurrencyLimiter
+	bestEffort         *BestEffortRestore
+	pathMap            *RestorePathMap
+}
+
+// admitRegularFile applies the policy to the regular file before it is written, in this order: the excluded file
+// and the file not fitting into the byte budget are skipped, then the capacity is reserved for the file
+// and its concurrency slot is acquired. The returned function releases the slot of the admitted file.
+func (tarInterpreter *FileTarInterpreter) admitRegularFile(fileInfo *tar.Header, targetPath string) (bool, func(), error) {
+	policy := tarInterpreter.policy
+	if policy.exclusion.excludes(fileInfo.Name) {
+		return false, nil, tarInterpreter.skipExcludedFile(fileInfo, targetPath)
+	}
+	if tarInterpreter.exceedsByteBudget(fileInfo) {
+		tracelog.DebugLogger.Printf("'%s' does not fit into the restore byte budget\n", fileInfo.Name)
+		tarInterpreter.metrics.trackSkippedFile()
+		return false, nil, nil
+	}
+	if err := tarInterpreter.reserveCapacity(fileInfo); err != nil {
+		return false, nil, err
+	}
+	if policy.concurrencyLimiter == nil {
+		return true, func() {}, nil
+	}
+	return true, policy.concurrencyLimiter.Acquire(fileInfo.Name, targetPath), nil
+}
+
+// exceedsByteBudget returns true if the file should be unwrapped, but does not fit into the byte budget
+func (tarInterpreter *FileTarInterpreter) exceedsByteBudget(fileInfo *tar.Header) bool {
+	if tarInterpreter.policy.byteBudget == nil {
+		return false
+	}
+	if !isSelectedFile(tarInterpreter, fileInfo.Name) {
+		return false
+	}
+	return !tarInterpreter.policy.byteBudget.allowFile(fileInfo.Name, fileInfo.Size)
+}
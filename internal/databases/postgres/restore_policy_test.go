@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmitRegularFile_ExcludedFileDoesNotUseByteBudget(t *testing.T) {
+	dataDir := t.TempDir()
+	exclusion, err := NewRestoreExclusion([]string{"/base/1/*"})
+	require.NoError(t, err)
+	budget := NewRestoreByteBudget(4)
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithRestoreExclusion(exclusion), WithByteBudget(budget))
+
+	for _, name := range []string{"/base/1/1259", "/global/1262"} {
+		require.NoError(t, tarInterpreter.Interpret(strings.NewReader("data"),
+			&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: 4}), name)
+	}
+
+	_, err = os.Stat(filepath.Join(dataDir, "base", "1", "1259"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dataDir, "global", "1262"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/global/1262"}, budget.RestoredFiles())
+	assert.Equal(t, int64(4), budget.UsedBytes())
+}
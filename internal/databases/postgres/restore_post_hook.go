@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// maxPostHookStderr bounds the stderr of the failed hook kept in the error
+const maxPostHookStderr = 4096
+
+type RestorePostHookError struct {
+	error
+}
+
+func newRestorePostHookError(err error, stderr string) RestorePostHookError {
+	message := fmt.Sprintf("post-restore hook has failed: %v", err)
+	if stderr != "" {
+		message += ", stderr: " + stderr
+	}
+	return RestorePostHookError{errors.New(message)}
+}
+
+func (err RestorePostHookError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// RunRestorePostHook runs the WALG_RESTORE_POST_HOOK command once the fetch has succeeded, e.g. to fix
+// the permissions or to create recovery.signal. The restored files which are not synced yet are synced first,
+// so the hook sees the durable data directory, which path is passed in WALG_RESTORE_DATA_DIRECTORY.
+// The output of the hook is logged, its failure fails the fetch.
+func RunRestorePostHook(dbDataDirectory string, unsyncedDataLimiter *UnsyncedDataLimiter) error {
+	if viper.GetString(internal.RestorePostHookSetting) == "" {
+		return nil
+	}
+	if unsyncedDataLimiter != nil {
+		if err := unsyncedDataLimiter.SyncAll(); err != nil {
+			return err
+		}
+	}
+	cmd, err := internal.GetCommandSetting(internal.RestorePostHookSetting)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", "WALG_RESTORE_DATA_DIRECTORY", dbDataDirectory))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	tracelog.InfoLogger.Printf("Running the post-restore hook for '%s'\n", dbDataDirectory)
+	err = cmd.Run()
+	logPostHookOutput(tracelog.InfoLogger.Printf, "stdout", stdout.String())
+	logPostHookOutput(tracelog.WarningLogger.Printf, "stderr", stderr.String())
+	if err != nil {
+		return newRestorePostHookError(err, tailString(strings.TrimSpace(stderr.String()), maxPostHookStderr))
+	}
+	tracelog.InfoLogger.Println("Post-restore hook has succeeded")
+	return nil
+}
+
+// logPostHookOutput logs every line of the captured hook output
+func logPostHookOutput(printf func(format string, v ...interface{}), stream, output string) {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return
+	}
+	for _, line := range strings.Split(output, "\n") {
+		printf("Post-restore hook %s: %s\n", stream, line)
+	}
+}
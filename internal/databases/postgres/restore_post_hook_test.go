@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestRunRestorePostHook_Succeeds(t *testing.T) {
+	dataDir := t.TempDir()
+	viper.Set(internal.RestorePostHookSetting, `echo "hook for $WALG_RESTORE_DATA_DIRECTORY" && `+
+		`touch "$WALG_RESTORE_DATA_DIRECTORY/recovery.signal"`)
+	defer viper.Set(internal.RestorePostHookSetting, nil)
+	restoredPath := filepath.Join(dataDir, "postgresql.conf")
+	require.NoError(t, os.WriteFile(restoredPath, []byte("data"), 0600))
+	limiter := NewUnsyncedDataLimiter(1 << 20)
+	require.NoError(t, limiter.AddWrittenFile(restoredPath, 4))
+
+	require.NoError(t, RunRestorePostHook(dataDir, limiter))
+
+	_, err := os.Stat(filepath.Join(dataDir, "recovery.signal"))
+	assert.NoError(t, err)
+	// the restored files are synced before the hook runs
+	assert.Equal(t, int64(0), limiter.GetUnsyncedBytes())
+}
+
+func TestRunRestorePostHook_Fails(t *testing.T) {
+	viper.Set(internal.RestorePostHookSetting, "echo 'permissions are broken' >&2; exit 3")
+	defer viper.Set(internal.RestorePostHookSetting, nil)
+
+	err := RunRestorePostHook(t.TempDir(), nil)
+
+	require.IsType(t, RestorePostHookError{}, err)
+	assert.Contains(t, err.Error(), "exit status 3")
+	assert.Contains(t, err.Error(), "permissions are broken")
+}
+
+func TestRunRestorePostHook_NotSet(t *testing.T) {
+	viper.Set(internal.RestorePostHookSetting, "")
+	defer viper.Set(internal.RestorePostHookSetting, nil)
+
+	assert.NoError(t, RunRestorePostHook(t.TempDir(), nil))
+}
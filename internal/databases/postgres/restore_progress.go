@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// The restore progress modes
+const (
+	// RestoreProgressBytes reports the restored bytes against the uncompressed size of the delta chain
+	RestoreProgressBytes = "bytes"
+	// RestoreProgressBlocks reports the applied increment blocks against the total increment blocks
+	// of the delta chain, which is more accurate for the restores dominated by the increment application
+	RestoreProgressBlocks = "blocks"
+)
+
+// RestoreProgress periodically logs the restore progress with the ETA. The totals are summed from
+// the sentinels and the files metadata of the delta chain before the restore starts. In the blocks mode
+// the byte progress is reported alongside if the uncompressed size of the chain is known.
+type RestoreProgress struct {
+	mode     string
+	interval time.Duration
+
+	totalBytes    int64
+	totalBlocks   int64
+	restoredBytes int64
+	appliedBlocks int64
+	startTime     time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func NewRestoreProgress(mode string, interval time.Duration) (*RestoreProgress, error) {
+	if mode != RestoreProgressBytes && mode != RestoreProgressBlocks {
+		return nil, errors.Errorf("unknown restore progress mode '%s', expected %s or %s",
+			mode, RestoreProgressBytes, RestoreProgressBlocks)
+	}
+	if interval <= 0 {
+		return nil, errors.Errorf("restore progress interval must be positive, got %v", interval)
+	}
+	return &RestoreProgress{mode: mode, interval: interval}, nil
+}
+
+// ConfigureRestoreProgress creates the progress from the settings, returns nil if the progress mode is not set
+func ConfigureRestoreProgress() (*RestoreProgress, error) {
+	mode := viper.GetString(internal.RestoreProgressSetting)
+	if mode == "" {
+		return nil, nil
+	}
+	interval, err := internal.GetDurationSetting(internal.RestoreProgressIntervalSetting)
+	if err != nil {
+		return nil, err
+	}
+	return NewRestoreProgress(mode, interval)
+}
+
+// setTotals sums the bytes and the increment blocks the layers of the delta chain are going to restore.
+// The blocks mode falls back to the bytes if the increment blocks are not recorded in the files metadata.
+func (progress *RestoreProgress) setTotals(layers []deltaLayer) {
+	blocksRecorded := true
+	for _, layer := range layers {
+		progress.totalBytes += layer.sentinelDto.UncompressedSize
+		if !layer.sentinelDto.IsIncremental() {
+			continue
+		}
+		for fileName, description := range layer.filesMeta.Files {
+			if !description.IsIncremented || !layer.writesFile(fileName) {
+				continue
+			}
+			if description.IncrementBlocks == nil {
+				blocksRecorded = false
+				continue
+			}
+			progress.totalBlocks += *description.IncrementBlocks
+		}
+	}
+	if progress.mode == RestoreProgressBlocks && (!blocksRecorded || progress.totalBlocks == 0) {
+		tracelog.WarningLogger.Printf("The increment blocks of the delta chain are not recorded, " +
+			"reporting the restore progress in bytes\n")
+		progress.mode = RestoreProgressBytes
+	}
+}
+
+// start computes the totals of the delta chain ending with the backup and starts the periodic reports
+func (progress *RestoreProgress) start(backup Backup, folder storage.Folder, filesToUnwrap map[string]bool) error {
+	layers, err := collectDeltaLayers(backup, folder, nil, filesToUnwrap)
+	if err != nil {
+		return errors.Wrap(err, "failed to compute the restore progress totals")
+	}
+	progress.setTotals(layers)
+	progress.startTime = time.Now()
+	progress.stop = make(chan struct{})
+	progress.done = make(chan struct{})
+	go progress.reportPeriodically()
+	return nil
+}
+
+func (progress *RestoreProgress) reportPeriodically() {
+	defer close(progress.done)
+	ticker := time.NewTicker(progress.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tracelog.InfoLogger.Printf("Restore progress: %s\n", progress.report(time.Since(progress.startTime)))
+		case <-progress.stop:
+			return
+		}
+	}
+}
+
+// finish stops the periodic reports and logs the final progress
+func (progress *RestoreProgress) finish() {
+	progress.stopOnce.Do(func() { close(progress.stop) })
+	<-progress.done
+	tracelog.InfoLogger.Printf("Restore progress: %s\n", progress.report(time.Since(progress.startTime)))
+}
+
+// trackFile accounts the restored tar entry and the increment blocks it has applied
+func (progress *RestoreProgress) trackFile(size, incrementBlocks int64) {
+	atomic.AddInt64(&progress.restoredBytes, size)
+	atomic.AddInt64(&progress.appliedBlocks, incrementBlocks)
+}
+
+// report describes the progress after the elapsed time, the ETA is extrapolated from the progress of the mode
+func (progress *RestoreProgress) report(elapsed time.Duration) string {
+	restoredBytes := atomic.LoadInt64(&progress.restoredBytes)
+	appliedBlocks := atomic.LoadInt64(&progress.appliedBlocks)
+	parts := make([]string, 0, 3)
+	done, total := restoredBytes, progress.totalBytes
+	if progress.mode == RestoreProgressBlocks {
+		done, total = appliedBlocks, progress.totalBlocks
+		parts = append(parts, fmt.Sprintf("applied %d of %d increment blocks (%s)",
+			appliedBlocks, progress.totalBlocks, formatProgressPercent(appliedBlocks, progress.totalBlocks)))
+	}
+	if progress.mode == RestoreProgressBytes || progress.totalBytes > 0 {
+		parts = append(parts, fmt.Sprintf("restored %d of %d bytes (%s)",
+			restoredBytes, progress.totalBytes, formatProgressPercent(restoredBytes, progress.totalBytes)))
+	}
+	if done > 0 && total > done {
+		eta := time.Duration(float64(elapsed) * float64(total-done) / float64(done))
+		parts = append(parts, fmt.Sprintf("ETA %v", eta.Round(time.Second)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatProgressPercent(done, total int64) string {
+	if total <= 0 {
+		return "unknown total"
+	}
+	percent := float64(done) * 100 / float64(total)
+	if percent > 100 {
+		percent = 100
+	}
+	return fmt.Sprintf("%.1f%%", percent)
+}
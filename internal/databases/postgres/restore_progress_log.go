@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// ProgressLogRestorePlugin periodically logs the number of the restored files and bytes with the restore rate.
+// Unlike RestoreProgress it does not compute the totals of the delta chain before the restore starts,
+// so it reports no ETA, but it needs nothing except the completed files.
+type ProgressLogRestorePlugin struct {
+	NopRestorePlugin
+	interval time.Duration
+
+	restoredFiles int64
+	restoredBytes int64
+	startTime     time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func NewProgressLogRestorePlugin(interval time.Duration) (*ProgressLogRestorePlugin, error) {
+	if interval <= 0 {
+		return nil, errors.Errorf("restore log interval must be positive, got %v", interval)
+	}
+	return &ProgressLogRestorePlugin{interval: interval}, nil
+}
+
+// ConfigureProgressLogRestorePlugin creates the plugin from the settings, returns nil if the log interval is not set
+func ConfigureProgressLogRestorePlugin() (*ProgressLogRestorePlugin, error) {
+	if viper.GetString(internal.RestoreLogIntervalSetting) == "" {
+		return nil, nil
+	}
+	interval, err := internal.GetDurationSetting(internal.RestoreLogIntervalSetting)
+	if err != nil {
+		return nil, err
+	}
+	return NewProgressLogRestorePlugin(interval)
+}
+
+func (plugin *ProgressLogRestorePlugin) OnRestoreStart(info RestoreStartInfo) {
+	plugin.startTime = time.Now()
+	plugin.stop = make(chan struct{})
+	plugin.done = make(chan struct{})
+	go plugin.logPeriodically()
+}
+
+func (plugin *ProgressLogRestorePlugin) OnFileComplete(info RestoreFileInfo) {
+	atomic.AddInt64(&plugin.restoredFiles, 1)
+	atomic.AddInt64(&plugin.restoredBytes, info.Size)
+}
+
+func (plugin *ProgressLogRestorePlugin) OnRestoreFinish(info RestoreFinishInfo) {
+	if plugin.stop == nil {
+		return
+	}
+	plugin.stopOnce.Do(func() { close(plugin.stop) })
+	<-plugin.done
+	tracelog.InfoLogger.Printf("Restore finished: %s\n", plugin.report(time.Since(plugin.startTime)))
+}
+
+func (plugin *ProgressLogRestorePlugin) logPeriodically() {
+	defer close(plugin.done)
+	ticker := time.NewTicker(plugin.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tracelog.InfoLogger.Printf("Restored so far: %s\n", plugin.report(time.Since(plugin.startTime)))
+		case <-plugin.stop:
+			return
+		}
+	}
+}
+
+// report describes the files and bytes restored in the elapsed time
+func (plugin *ProgressLogRestorePlugin) report(elapsed time.Duration) string {
+	files := atomic.LoadInt64(&plugin.restoredFiles)
+	bytes := atomic.LoadInt64(&plugin.restoredBytes)
+	message := fmt.Sprintf("%d files, %d bytes in %v", files, bytes, elapsed.Round(time.Second))
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		message += fmt.Sprintf(" (%.0f bytes/s)", float64(bytes)/seconds)
+	}
+	return message
+}
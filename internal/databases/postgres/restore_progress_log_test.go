@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressLogRestorePlugin(t *testing.T) {
+	plugin, err := NewProgressLogRestorePlugin(time.Millisecond)
+	require.NoError(t, err)
+
+	plugin.OnRestoreStart(RestoreStartInfo{BackupName: "base_000000010000000000000002"})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			plugin.OnFileComplete(RestoreFileInfo{Name: fmt.Sprintf("/base/1/%d", i), Size: 8192})
+		}(i)
+	}
+	wg.Wait()
+	time.Sleep(5 * time.Millisecond)
+	plugin.OnRestoreFinish(RestoreFinishInfo{})
+
+	assert.Equal(t, "100 files, 819200 bytes in 2s (409600 bytes/s)", plugin.report(2*time.Second))
+	assert.Equal(t, "100 files, 819200 bytes in 0s", plugin.report(0))
+}
+
+func TestNewProgressLogRestorePlugin_InvalidInterval(t *testing.T) {
+	_, err := NewProgressLogRestorePlugin(0)
+	assert.Error(t, err)
+}
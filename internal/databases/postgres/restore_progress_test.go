@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func progressTestBlocks(blocks int64) *int64 {
+	return &blocks
+}
+
+func putProgressTestChain(t *testing.T, deltaFiles internal.BackupFileList) *memory.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putDiffTestBackup(t, folder, diffTestFullBackup, `{"UncompressedSize":24576}`, internal.BackupFileList{
+		"/base/1/1259": {}, "/base/1/1260": {},
+	})
+	putDiffTestBackup(t, folder, diffTestDeltaBackup,
+		`{"LSN":67108904,"DeltaFrom":"`+diffTestFullBackup+`","DeltaLSN":33554472,`+
+			`"DeltaFullName":"`+diffTestFullBackup+`","DeltaCount":1,"UncompressedSize":8192}`, deltaFiles)
+	return folder
+}
+
+func startProgressTest(t *testing.T, mode string, folder *memory.Folder) *RestoreProgress {
+	progress, err := NewRestoreProgress(mode, time.Hour)
+	require.NoError(t, err)
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), diffTestDeltaBackup)
+	require.NoError(t, progress.start(backup, folder, nil))
+	t.Cleanup(progress.finish)
+	return progress
+}
+
+func TestIncrementBlockCount(t *testing.T) {
+	increment := makeDiffTestIncrement(uint64(3*DatabasePageSize),
+		map[uint32]string{0: makeDiffTestPage('A'), 2: makeDiffTestPage('C')})
+
+	assert.Equal(t, int64(2), incrementBlockCount(int64(len(increment))))
+	assert.Equal(t, int64(0), incrementBlockCount(0))
+}
+
+func TestRestoreProgress_ReportsIncrementBlocks(t *testing.T) {
+	progress := startProgressTest(t, RestoreProgressBlocks, putProgressTestChain(t, internal.BackupFileList{
+		"/base/1/1259": {IsIncremented: true, IncrementBlocks: progressTestBlocks(3)},
+		"/base/1/1260": {IsIncremented: true, IncrementBlocks: progressTestBlocks(1)},
+	}))
+	progress.trackFile(24576, 0)
+	progress.trackFile(8192, 1)
+
+	assert.Equal(t, int64(4), progress.totalBlocks)
+	assert.Equal(t, "applied 1 of 4 increment blocks (25.0%), restored 32768 of 32768 bytes (100.0%), ETA 30s",
+		progress.report(10*time.Second))
+}
+
+func TestRestoreProgress_FallsBackToBytesWithoutRecordedBlocks(t *testing.T) {
+	progress := startProgressTest(t, RestoreProgressBlocks, putProgressTestChain(t, internal.BackupFileList{
+		"/base/1/1259": {IsIncremented: true},
+		"/base/1/1260": {IsSkipped: true},
+	}))
+	progress.trackFile(8192, 1)
+
+	assert.Equal(t, RestoreProgressBytes, progress.mode)
+	assert.Equal(t, "restored 8192 of 32768 bytes (25.0%), ETA 30s", progress.report(10*time.Second))
+}
+
+func TestNewRestoreProgress_InvalidMode(t *testing.T) {
+	_, err := NewRestoreProgress("pages", time.Second)
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// RestoreProvenanceFilename is the sidecar file in the restored data directory recording its source.
+// It is excluded from the backups, so the backup of the restored cluster does not carry the stale record.
+const RestoreProvenanceFilename = "walg_restore_provenance.json"
+
+// RestoreProvenanceFormatVersion is incremented on the incompatible changes of RestoreProvenance
+const RestoreProvenanceFormatVersion = 1
+
+// RestoreProvenance records what the data directory was restored from, e.g. for audits
+type RestoreProvenance struct {
+	FormatVersion   int       `json:"format_version"`
+	BackupName      string    `json:"backup_name"`
+	StorageLocation string    `json:"storage_location"`
+	RestoreTime     time.Time `json:"restore_time"`
+	WalgVersion     string    `json:"walg_version"`
+}
+
+func NewRestoreProvenance(backupName, storageLocation, walgVersion string, restoreTime time.Time) RestoreProvenance {
+	return RestoreProvenance{
+		FormatVersion:   RestoreProvenanceFormatVersion,
+		BackupName:      backupName,
+		StorageLocation: storageLocation,
+		RestoreTime:     restoreTime.UTC(),
+		WalgVersion:     walgVersion,
+	}
+}
+
+// ReadRestoreProvenance reads the provenance of the restored data directory
+func ReadRestoreProvenance(dbDataDirectory string) (RestoreProvenance, error) {
+	var provenance RestoreProvenance
+	data, err := os.ReadFile(filepath.Join(dbDataDirectory, RestoreProvenanceFilename))
+	if err != nil {
+		return provenance, errors.Wrapf(err, "failed to read %s", RestoreProvenanceFilename)
+	}
+	err = json.Unmarshal(data, &provenance)
+	if err != nil {
+		return provenance, errors.Wrapf(err, "failed to unmarshal %s", RestoreProvenanceFilename)
+	}
+	return provenance, nil
+}
+
+// WriteRestoreProvenance writes the provenance to the data directory atomically,
+// so the sidecar is either absent or complete
+func WriteRestoreProvenance(dbDataDirectory string, provenance RestoreProvenance) error {
+	data, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(filepath.Join(dbDataDirectory, RestoreProvenanceFilename), data)
+}
+
+// writeFileAtomically writes the file by syncing the temporary file and renaming it,
+// so the file is either absent or complete
+func writeFileAtomically(targetPath string, data []byte) error {
+	tmpPath := targetPath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", tmpPath)
+	}
+	_, err = file.Write(append(data, '\n'))
+	if err == nil {
+		err = syncRestoredFile(file)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "failed to write %s", tmpPath)
+	}
+	if err = os.Rename(tmpPath, targetPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "failed to rename %s", tmpPath)
+	}
+	// the rename is durable once the directory is synced, the directories can't be synced on some platforms
+	if err = syncDirectory(filepath.Dir(targetPath)); err != nil {
+		tracelog.WarningLogger.Printf("Failed to sync %s after writing %s: %v\n",
+			filepath.Dir(targetPath), filepath.Base(targetPath), err)
+	}
+	return nil
+}
+
+func syncDirectory(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(file, "")
+	return file.Sync()
+}
+
+// writeProvenance stamps the successfully restored data directory with its source
+func (options FetchOptions) writeProvenance(backupName, dbDataDirectory string) error {
+	provenance := NewRestoreProvenance(backupName, internal.GetStorageLocation(), options.WalgVersion, time.Now())
+	err := WriteRestoreProvenance(dbDataDirectory, provenance)
+	if err != nil {
+		return errors.Wrap(err, "failed to write the restore provenance")
+	}
+	tracelog.DebugLogger.Printf("Restore provenance is written to %s\n", RestoreProvenanceFilename)
+	return nil
+}
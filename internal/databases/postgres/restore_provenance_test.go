@@ -0,0 +1,54 @@
+package postgres_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func TestWriteRestoreProvenance(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	restoreTime := time.Date(2022, 3, 1, 12, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+	provenance := postgres.NewRestoreProvenance("base_000000010000000000000002", "s3://bucket/path",
+		"v2.0.0", restoreTime)
+
+	require.NoError(t, postgres.WriteRestoreProvenance(dbDataDirectory, provenance))
+
+	restored, err := postgres.ReadRestoreProvenance(dbDataDirectory)
+	require.NoError(t, err)
+	assert.Equal(t, postgres.RestoreProvenanceFormatVersion, restored.FormatVersion)
+	assert.Equal(t, "base_000000010000000000000002", restored.BackupName)
+	assert.Equal(t, "s3://bucket/path", restored.StorageLocation)
+	assert.Equal(t, "v2.0.0", restored.WalgVersion)
+	assert.True(t, restoreTime.Equal(restored.RestoreTime))
+	assert.Equal(t, time.UTC, restored.RestoreTime.Location())
+
+	// only the sidecar itself is left in the data directory
+	entries, err := os.ReadDir(dbDataDirectory)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, postgres.RestoreProvenanceFilename, entries[0].Name())
+}
+
+func TestWriteRestoreProvenance_Overwrites(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dbDataDirectory, postgres.RestoreProvenanceFilename),
+		[]byte("stale"), 0600))
+
+	provenance := postgres.NewRestoreProvenance("base_000000010000000000000004", "", "devel", time.Now())
+	require.NoError(t, postgres.WriteRestoreProvenance(dbDataDirectory, provenance))
+
+	restored, err := postgres.ReadRestoreProvenance(dbDataDirectory)
+	require.NoError(t, err)
+	assert.Equal(t, "base_000000010000000000000004", restored.BackupName)
+}
+
+func TestRestoreProvenanceIsExcludedFromBackups(t *testing.T) {
+	_, ok := postgres.ExcludedFilenames[postgres.RestoreProvenanceFilename]
+	assert.True(t, ok)
+}
@@ -0,0 +1,246 @@
+package postgres
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+type ResumeManifestMismatchError struct {
+	error
+}
+
+func newResumeManifestMismatchError(path, manifestDirectory, dbDataDirectory string) ResumeManifestMismatchError {
+	return ResumeManifestMismatchError{errors.Errorf(
+		"resume manifest '%s' belongs to the restore to '%s', not to '%s'", path, manifestDirectory, dbDataDirectory)}
+}
+
+func (err ResumeManifestMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// resumeManifestHeaderDto is the first line of the resume manifest
+type resumeManifestHeaderDto struct {
+	DBDataDirectory string `json:"data_directory"`
+}
+
+// resumeManifestEntryDto is the line of the resume manifest recording the restored file of the backup
+type resumeManifestEntryDto struct {
+	BackupName string `json:"backup"`
+	FileName   string `json:"file"`
+	// Size is the size of the file in the data directory once it is restored, unknown in the older manifests
+	Size *int64 `json:"size,omitempty"`
+}
+
+// RestoreResumeManifest records the files restored from every backup of the chain, so the interrupted
+// restore can be resumed skipping them. The manifest is append-only, every line is synced before
+// the next file is restored, and the torn last line left by the crash is discarded when it is opened.
+// The files are recorded once they are synced, so the manifest is not usable with WALG_TAR_DISABLE_FSYNC.
+type RestoreResumeManifest struct {
+	path string
+
+	mutex    sync.Mutex
+	file     *os.File
+	restored map[string]map[string]bool
+	// entries are the loaded entries in the manifest order
+	entries     []resumeManifestEntryDto
+	warnedWrite bool
+}
+
+// OpenRestoreResumeManifest loads the manifest of the interrupted restore to the data directory,
+// or creates the new one if the manifest at the path does not exist
+func OpenRestoreResumeManifest(path, dbDataDirectory string) (*RestoreResumeManifest, error) {
+	manifest := &RestoreResumeManifest{path: path, restored: make(map[string]map[string]bool)}
+	dbDataDirectory = filepath.Clean(dbDataDirectory)
+	validLength, hasHeader, err := manifest.load(dbDataDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Truncate(path, validLength); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to discard the torn end of the resume manifest '%s'", path)
+	}
+	manifest.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open the resume manifest '%s'", path)
+	}
+	if !hasHeader {
+		if err = manifest.appendLine(resumeManifestHeaderDto{DBDataDirectory: dbDataDirectory}); err != nil {
+			utility.LoggedClose(manifest.file, "")
+			return nil, err
+		}
+	}
+	if manifest.isResuming() {
+		tracelog.InfoLogger.Printf("Resuming the restore to '%s' from the manifest '%s'\n", dbDataDirectory, path)
+	}
+	return manifest, nil
+}
+
+// load reads the complete lines of the manifest and returns their length
+func (manifest *RestoreResumeManifest) load(dbDataDirectory string) (validLength int64, hasHeader bool, err error) {
+	file, err := os.Open(manifest.path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "failed to open the resume manifest '%s'", manifest.path)
+	}
+	defer utility.LoggedClose(file, "")
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				tracelog.WarningLogger.Printf("Discarding the torn last line of the resume manifest '%s'\n", manifest.path)
+			}
+			return validLength, hasHeader, nil
+		}
+		if err != nil {
+			return 0, false, errors.Wrapf(err, "failed to read the resume manifest '%s'", manifest.path)
+		}
+		if !hasHeader {
+			var header resumeManifestHeaderDto
+			if err = json.Unmarshal(line, &header); err != nil {
+				return 0, false, errors.Wrapf(err, "invalid header of the resume manifest '%s'", manifest.path)
+			}
+			if header.DBDataDirectory != dbDataDirectory {
+				return 0, false, newResumeManifestMismatchError(manifest.path, header.DBDataDirectory, dbDataDirectory)
+			}
+			hasHeader = true
+		} else {
+			var entry resumeManifestEntryDto
+			if err = json.Unmarshal(line, &entry); err != nil {
+				return 0, false, errors.Wrapf(err, "invalid line of the resume manifest '%s'", manifest.path)
+			}
+			manifest.track(entry.BackupName, entry.FileName)
+			manifest.entries = append(manifest.entries, entry)
+		}
+		validLength += int64(len(line))
+	}
+}
+
+func (manifest *RestoreResumeManifest) track(backupName, fileName string) {
+	if manifest.restored[backupName] == nil {
+		manifest.restored[backupName] = make(map[string]bool)
+	}
+	manifest.restored[backupName][fileName] = true
+}
+
+func (manifest *RestoreResumeManifest) appendLine(dto interface{}) error {
+	line, err := json.Marshal(dto)
+	if err != nil {
+		return err
+	}
+	if _, err = manifest.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrapf(err, "failed to write the resume manifest '%s'", manifest.path)
+	}
+	return errors.Wrapf(manifest.file.Sync(), "failed to sync the resume manifest '%s'", manifest.path)
+}
+
+// isResuming returns whether some files were restored by the previous runs
+func (manifest *RestoreResumeManifest) isResuming() bool {
+	if manifest == nil {
+		return false
+	}
+	manifest.mutex.Lock()
+	defer manifest.mutex.Unlock()
+	return len(manifest.restored) > 0
+}
+
+func (manifest *RestoreResumeManifest) isRestored(backupName, fileName string) bool {
+	manifest.mutex.Lock()
+	defer manifest.mutex.Unlock()
+	return manifest.restored[backupName][fileName]
+}
+
+// markRestored records the restored file of the backup with its size in the data directory, if the file exists.
+// The failed write is logged, it only makes the later resumed restore fetch the file again.
+func (manifest *RestoreResumeManifest) markRestored(backupName, fileName, targetPath string) {
+	entry := resumeManifestEntryDto{BackupName: backupName, FileName: fileName}
+	if info, err := os.Stat(targetPath); err == nil {
+		size := info.Size()
+		entry.Size = &size
+	}
+	manifest.mutex.Lock()
+	defer manifest.mutex.Unlock()
+	err := manifest.appendLine(entry)
+	if err != nil {
+		if !manifest.warnedWrite {
+			manifest.warnedWrite = true
+			tracelog.WarningLogger.Printf("%v, the restored files are not recorded\n", err)
+		}
+		return
+	}
+	manifest.track(backupName, fileName)
+}
+
+// Finish closes the manifest, it is removed if the restore has succeeded
+func (manifest *RestoreResumeManifest) Finish(restoreErr error) {
+	manifest.mutex.Lock()
+	defer manifest.mutex.Unlock()
+	utility.LoggedClose(manifest.file, "")
+	if restoreErr != nil {
+		tracelog.InfoLogger.Printf("Rerun backup-fetch with the resume manifest '%s' to resume the restore\n",
+			manifest.path)
+		return
+	}
+	if err := os.Remove(manifest.path); err != nil {
+		tracelog.WarningLogger.Printf("Failed to remove the resume manifest '%s': %v\n", manifest.path, err)
+	}
+}
+
+// skipRestoredTars drops the stages' tars holding only the files restored by the previous run
+// of the resumed restore, so they are not fetched again
+func (backup *Backup) skipRestoredTars(tarInterpreter *FileTarInterpreter,
+	stages [][]internal.ReaderMaker) [][]internal.ReaderMaker {
+	if !tarInterpreter.resumeManifest.isResuming() || len(tarInterpreter.FilesMetadata.TarFileSets) == 0 {
+		return stages
+	}
+	remainingStages := make([][]internal.ReaderMaker, 0, len(stages))
+	skippedCount := 0
+	for _, stage := range stages {
+		remainingStage := make([]internal.ReaderMaker, 0, len(stage))
+		for _, readerMaker := range stage {
+			if tarInterpreter.isTarRestoredBefore(readerMaker.Path()) {
+				skippedCount++
+				continue
+			}
+			remainingStage = append(remainingStage, readerMaker)
+		}
+		if len(remainingStage) > 0 {
+			remainingStages = append(remainingStages, remainingStage)
+		}
+	}
+	tracelog.InfoLogger.Printf("%d tars of %s hold only the files restored by the previous run, they are skipped\n",
+		skippedCount, backup.Name)
+	return remainingStages
+}
+
+// isTarRestoredBefore returns whether all the files to unwrap from the tar are restored by the previous run.
+// The tar is fetched if none of its files are restored, since it may hold the directories as well.
+func (tarInterpreter *FileTarInterpreter) isTarRestoredBefore(tarName string) bool {
+	hasRestored := false
+	for _, fileName := range tarInterpreter.FilesMetadata.TarFileSets[tarName] {
+		if tarInterpreter.isRestoredBefore(fileName) {
+			hasRestored = true
+		} else if tarInterpreter.FilesToUnwrap == nil || tarInterpreter.FilesToUnwrap[fileName] {
+			return false
+		}
+	}
+	return hasRestored
+}
+
+// isRestoredBefore returns whether the file of the backup is restored by the previous run of the resumed restore
+func (tarInterpreter *FileTarInterpreter) isRestoredBefore(fileName string) bool {
+	return tarInterpreter.resumeManifest != nil &&
+		tarInterpreter.resumeManifest.isRestored(tarInterpreter.backupName, fileName)
+}
@@ -0,0 +1,164 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestRestoreResumeManifest_ReloadsRestoredFiles(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "manifest")
+	manifest, err := OpenRestoreResumeManifest(manifestPath, "/pgdata")
+	require.NoError(t, err)
+	assert.False(t, manifest.isResuming())
+	manifest.markRestored(diffTestFullBackup, "/base/1/1259", "")
+	manifest.markRestored(diffTestDeltaBackup, "/PG_VERSION", "")
+	manifest.Finish(errors.New("interrupted"))
+
+	manifest, err = OpenRestoreResumeManifest(manifestPath, "/pgdata/")
+	require.NoError(t, err)
+	defer manifest.Finish(nil)
+
+	assert.True(t, manifest.isResuming())
+	assert.True(t, manifest.isRestored(diffTestFullBackup, "/base/1/1259"))
+	assert.True(t, manifest.isRestored(diffTestDeltaBackup, "/PG_VERSION"))
+	assert.False(t, manifest.isRestored(diffTestFullBackup, "/PG_VERSION"))
+}
+
+func TestRestoreResumeManifest_DiscardsTornLine(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "manifest")
+	manifest, err := OpenRestoreResumeManifest(manifestPath, "/pgdata")
+	require.NoError(t, err)
+	manifest.markRestored(diffTestFullBackup, "/base/1/1259", "")
+	manifest.Finish(errors.New("interrupted"))
+	file, err := os.OpenFile(manifestPath, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"backup":"` + diffTestFullBackup + `","fi`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	manifest, err = OpenRestoreResumeManifest(manifestPath, "/pgdata")
+	require.NoError(t, err)
+	manifest.markRestored(diffTestFullBackup, "/PG_VERSION", "")
+	manifest.Finish(errors.New("interrupted"))
+
+	content, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSuffix(content, []byte("\n")), []byte("\n"))
+	require.Len(t, lines, 3)
+	for _, line := range lines {
+		assert.True(t, json.Valid(line), string(line))
+	}
+	manifest, err = OpenRestoreResumeManifest(manifestPath, "/pgdata")
+	require.NoError(t, err)
+	defer manifest.Finish(nil)
+	assert.True(t, manifest.isRestored(diffTestFullBackup, "/base/1/1259"))
+	assert.True(t, manifest.isRestored(diffTestFullBackup, "/PG_VERSION"))
+}
+
+func TestRestoreResumeManifest_RejectsOtherDataDirectory(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "manifest")
+	manifest, err := OpenRestoreResumeManifest(manifestPath, "/pgdata")
+	require.NoError(t, err)
+	manifest.Finish(errors.New("interrupted"))
+
+	_, err = OpenRestoreResumeManifest(manifestPath, "/other")
+
+	assert.IsType(t, ResumeManifestMismatchError{}, err)
+}
+
+func TestRestoreResumeManifest_IsRemovedAfterSuccess(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "manifest")
+	manifest, err := OpenRestoreResumeManifest(manifestPath, "/pgdata")
+	require.NoError(t, err)
+
+	manifest.Finish(nil)
+
+	_, err = os.Stat(manifestPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// putResumeTestBackup puts the full backup with the relation and PG_VERSION stored in the separate tars
+func putResumeTestBackup(t *testing.T, folder *memory.Folder) {
+	files := internal.BackupFileList{"/base/1/1259": {}, "/PG_VERSION": {}, PgControlPath: {}}
+	putDiffTestBackup(t, folder, diffTestFullBackup, `{"LSN":33554472,"FinishLSN":33554680}`, files,
+		testTarEntry{name: "/base", isDir: true},
+		testTarEntry{name: "/base/1", isDir: true},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestPage('a')})
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	tarFolder := baseBackupFolder.GetSubFolder(diffTestFullBackup + internal.TarPartitionFolderName)
+	require.NoError(t, tarFolder.PutObject("part_2.tar.lz4",
+		bytes.NewReader(makeCompressedTestTar(t, testTarEntry{name: "/PG_VERSION", content: "14\n"}))))
+	filesMetadata, err := json.Marshal(FilesMetadataDto{Files: files, TarFileSets: map[string][]string{
+		"part_1.tar.lz4": {"/base/1/1259"}, "part_2.tar.lz4": {"/PG_VERSION"},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, baseBackupFolder.PutObject(getFilesMetadataPath(diffTestFullBackup), bytes.NewReader(filesMetadata)))
+	putParallelDeltasTestPgControl(t, folder, diffTestFullBackup, "full")
+}
+
+func TestResumeRestore_RecordsRestoredFiles(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putResumeTestBackup(t, folder)
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), diffTestFullBackup)
+	dbDataDirectory := t.TempDir()
+	manifestPath := filepath.Join(t.TempDir(), "manifest")
+	manifest, err := OpenRestoreResumeManifest(manifestPath, dbDataDirectory)
+	require.NoError(t, err)
+
+	err = deltaFetchRecursionOld(backup, folder, dbDataDirectory, nil, nil, WithResumeManifest(manifest))
+	require.NoError(t, err)
+	manifest.Finish(errors.New("interrupted before the validation"))
+
+	manifest, err = OpenRestoreResumeManifest(manifestPath, dbDataDirectory)
+	require.NoError(t, err)
+	defer manifest.Finish(nil)
+	for _, name := range []string{"/base/1/1259", "/PG_VERSION", PgControlPath} {
+		assert.True(t, manifest.isRestored(diffTestFullBackup, name), name)
+	}
+}
+
+func TestResumeRestore_SkipsRestoredFiles(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putResumeTestBackup(t, folder)
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), diffTestFullBackup)
+	dbDataDirectory := t.TempDir()
+	manifestPath := filepath.Join(t.TempDir(), "manifest")
+	// the previous run restored the relation and was killed
+	manifest, err := OpenRestoreResumeManifest(manifestPath, dbDataDirectory)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dbDataDirectory, "base", "1"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dbDataDirectory, "base", "1", "1259"), []byte("restored"), 0600))
+	manifest.markRestored(diffTestFullBackup, "/base/1/1259", "")
+	manifest.Finish(errors.New("killed"))
+	// the tar holding only the restored files is not fetched
+	tarFolder := folder.GetSubFolder(utility.BaseBackupPath).GetSubFolder(diffTestFullBackup + internal.TarPartitionFolderName)
+	require.NoError(t, tarFolder.DeleteObjects([]string{"part_1.tar.lz4"}))
+
+	manifest, err = OpenRestoreResumeManifest(manifestPath, dbDataDirectory)
+	require.NoError(t, err)
+	err = deltaFetchRecursionOld(backup, folder, dbDataDirectory, nil, nil, WithResumeManifest(manifest))
+	manifest.Finish(err)
+
+	require.NoError(t, err)
+	for name, expected := range map[string]string{
+		"base/1/1259":       "restored",
+		"PG_VERSION":        "14\n",
+		"global/pg_control": "full",
+	} {
+		content, err := os.ReadFile(filepath.Join(dbDataDirectory, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content), name)
+	}
+	_, err = os.Stat(manifestPath)
+	assert.True(t, os.IsNotExist(err))
+}
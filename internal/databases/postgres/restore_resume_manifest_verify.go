@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// ResumeManifestVerification is the result of the resume manifest check against the data directory
+type ResumeManifestVerification struct {
+	CheckedFiles       int      `json:"checked_files"`
+	InvalidatedEntries int      `json:"invalidated_entries"`
+	InvalidatedFiles   []string `json:"invalidated_files"`
+}
+
+// VerifyRestoreResumeManifest checks that every file the manifest records as restored exists in the data directory
+// with the recorded size, the one of its latest entry. All the entries of the files failing the check are pruned,
+// so the resumed restore fetches such files again from every backup of the delta chain.
+// The manifest must not be used by the running restore.
+func VerifyRestoreResumeManifest(path, dbDataDirectory string) (ResumeManifestVerification, error) {
+	dbDataDirectory = filepath.Clean(dbDataDirectory)
+	manifest := &RestoreResumeManifest{path: path, restored: make(map[string]map[string]bool)}
+	if _, err := os.Stat(path); err != nil {
+		return ResumeManifestVerification{}, errors.Wrapf(err, "failed to open the resume manifest '%s'", path)
+	}
+	if _, _, err := manifest.load(dbDataDirectory); err != nil {
+		return ResumeManifestVerification{}, err
+	}
+
+	latestEntries := make(map[string]resumeManifestEntryDto)
+	for _, entry := range manifest.entries {
+		latestEntries[entry.FileName] = entry
+	}
+	invalidFiles := make(map[string]bool)
+	for fileName, entry := range latestEntries {
+		if err := checkResumeManifestEntry(dbDataDirectory, entry); err != nil {
+			tracelog.WarningLogger.Printf("Resume manifest entry of '%s' is invalidated: %v\n", fileName, err)
+			invalidFiles[fileName] = true
+		}
+	}
+	verification := ResumeManifestVerification{CheckedFiles: len(latestEntries), InvalidatedFiles: make([]string, 0)}
+	keptEntries := make([]resumeManifestEntryDto, 0, len(manifest.entries))
+	for _, entry := range manifest.entries {
+		if invalidFiles[entry.FileName] {
+			verification.InvalidatedEntries++
+		} else {
+			keptEntries = append(keptEntries, entry)
+		}
+	}
+	for fileName := range invalidFiles {
+		verification.InvalidatedFiles = append(verification.InvalidatedFiles, fileName)
+	}
+	sort.Strings(verification.InvalidatedFiles)
+	if verification.InvalidatedEntries == 0 {
+		return verification, nil
+	}
+	return verification, rewriteResumeManifest(path, dbDataDirectory, keptEntries)
+}
+
+// checkResumeManifestEntry checks the file recorded in the manifest is the regular file of the recorded size
+func checkResumeManifestEntry(dbDataDirectory string, entry resumeManifestEntryDto) error {
+	targetPath, err := getTargetPath(dbDataDirectory, entry.FileName)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.Errorf("'%s' is not a regular file", targetPath)
+	}
+	if entry.Size != nil && info.Size() != *entry.Size {
+		return errors.Errorf("'%s' has %d bytes, %d bytes are restored", targetPath, info.Size(), *entry.Size)
+	}
+	return nil
+}
+
+// rewriteResumeManifest replaces the manifest with the one of the kept entries atomically
+func rewriteResumeManifest(path, dbDataDirectory string, entries []resumeManifestEntryDto) error {
+	lines := make([][]byte, 0, len(entries)+1)
+	header, err := json.Marshal(resumeManifestHeaderDto{DBDataDirectory: dbDataDirectory})
+	if err != nil {
+		return err
+	}
+	lines = append(lines, header)
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, line)
+	}
+	return errors.Wrapf(writeFileAtomically(path, bytes.Join(lines, []byte("\n"))),
+		"failed to prune the resume manifest '%s'", path)
+}
+
+// HandleResumeManifestVerify verifies the resume manifest of the restore to the data directory
+// and prunes its stale entries
+func HandleResumeManifestVerify(path, dbDataDirectory string, output io.Writer) {
+	verification, err := VerifyRestoreResumeManifest(path, dbDataDirectory)
+	tracelog.ErrorLogger.FatalfOnError("Failed to verify the resume manifest: %v\n", err)
+	for _, fileName := range verification.InvalidatedFiles {
+		_, err = fmt.Fprintf(output, "invalidated: %s\n", fileName)
+		tracelog.ErrorLogger.FatalOnError(err)
+	}
+	_, err = fmt.Fprintf(output, "%d files checked, %d entries of %d files invalidated\n",
+		verification.CheckedFiles, verification.InvalidatedEntries, len(verification.InvalidatedFiles))
+	tracelog.ErrorLogger.FatalOnError(err)
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeResumeVerifyTestManifest restores the files to the data directory and records them in the manifest
+func writeResumeVerifyTestManifest(t *testing.T, dbDataDirectory string, files map[string]string) string {
+	manifestPath := filepath.Join(t.TempDir(), "manifest")
+	manifest, err := OpenRestoreResumeManifest(manifestPath, dbDataDirectory)
+	require.NoError(t, err)
+	for _, backupName := range []string{diffTestFullBackup, diffTestDeltaBackup} {
+		for fileName, content := range files {
+			targetPath := filepath.Join(dbDataDirectory, fileName)
+			require.NoError(t, os.MkdirAll(filepath.Dir(targetPath), 0700))
+			require.NoError(t, os.WriteFile(targetPath, []byte(content), 0600))
+			manifest.markRestored(backupName, fileName, targetPath)
+		}
+	}
+	manifest.Finish(errors.New("interrupted"))
+	return manifestPath
+}
+
+func TestVerifyRestoreResumeManifest_PrunesDeletedFile(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	manifestPath := writeResumeVerifyTestManifest(t, dbDataDirectory,
+		map[string]string{"/base/1/1259": "relation", "/PG_VERSION": "14\n"})
+	require.NoError(t, os.Remove(filepath.Join(dbDataDirectory, "base", "1", "1259")))
+
+	verification, err := VerifyRestoreResumeManifest(manifestPath, dbDataDirectory)
+
+	require.NoError(t, err)
+	assert.Equal(t, ResumeManifestVerification{CheckedFiles: 2, InvalidatedEntries: 2,
+		InvalidatedFiles: []string{"/base/1/1259"}}, verification)
+	manifest, err := OpenRestoreResumeManifest(manifestPath, dbDataDirectory)
+	require.NoError(t, err)
+	defer manifest.Finish(nil)
+	assert.False(t, manifest.isRestored(diffTestFullBackup, "/base/1/1259"))
+	assert.False(t, manifest.isRestored(diffTestDeltaBackup, "/base/1/1259"))
+	assert.True(t, manifest.isRestored(diffTestFullBackup, "/PG_VERSION"))
+	assert.True(t, manifest.isRestored(diffTestDeltaBackup, "/PG_VERSION"))
+}
+
+func TestVerifyRestoreResumeManifest_PrunesTruncatedFile(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	manifestPath := writeResumeVerifyTestManifest(t, dbDataDirectory,
+		map[string]string{"/base/1/1259": "relation", "/PG_VERSION": "14\n"})
+	require.NoError(t, os.Truncate(filepath.Join(dbDataDirectory, "base", "1", "1259"), 3))
+
+	verification, err := VerifyRestoreResumeManifest(manifestPath, dbDataDirectory)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, verification.InvalidatedEntries)
+	assert.Equal(t, []string{"/base/1/1259"}, verification.InvalidatedFiles)
+	manifest, err := OpenRestoreResumeManifest(manifestPath, dbDataDirectory)
+	require.NoError(t, err)
+	defer manifest.Finish(nil)
+	assert.False(t, manifest.isRestored(diffTestDeltaBackup, "/base/1/1259"))
+	assert.True(t, manifest.isRestored(diffTestDeltaBackup, "/PG_VERSION"))
+}
+
+func TestVerifyRestoreResumeManifest_KeepsValidManifest(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	manifestPath := writeResumeVerifyTestManifest(t, dbDataDirectory, map[string]string{"/PG_VERSION": "14\n"})
+	content, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+
+	verification, err := VerifyRestoreResumeManifest(manifestPath, dbDataDirectory)
+
+	require.NoError(t, err)
+	assert.Equal(t, ResumeManifestVerification{CheckedFiles: 1, InvalidatedFiles: []string{}}, verification)
+	verifiedContent, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(content, verifiedContent))
+}
+
+func TestVerifyRestoreResumeManifest_OtherDataDirectory(t *testing.T) {
+	manifestPath := writeResumeVerifyTestManifest(t, t.TempDir(), map[string]string{"/PG_VERSION": "14\n"})
+
+	_, err := VerifyRestoreResumeManifest(manifestPath, t.TempDir())
+
+	assert.IsType(t, ResumeManifestMismatchError{}, err)
+	_, err = VerifyRestoreResumeManifest(filepath.Join(t.TempDir(), "missing"), t.TempDir())
+	assert.Error(t, err)
+}
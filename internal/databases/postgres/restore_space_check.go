@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+type InsufficientSpaceError struct {
+	error
+}
+
+func newInsufficientSpaceError(directories []string, required, available int64) InsufficientSpaceError {
+	return InsufficientSpaceError{errors.Errorf(
+		"out of space: restoring to %v requires %d bytes including the safety margin, "+
+			"but only %d bytes are available on the filesystem", directories, required, available)}
+}
+
+func (err InsufficientSpaceError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// restoreSpaceTarget is the filesystem the restore writes to and the bytes it is going to write there
+type restoreSpaceTarget struct {
+	directories   []string
+	requiredBytes int64
+}
+
+// RestoreSpaceCheck verifies that the filesystems the restore writes to have enough free space
+// for the restored files, so the restore does not run out of space midway. The tablespaces
+// are checked against the filesystems of their locations.
+type RestoreSpaceCheck struct {
+	// marginPercent is the space required in addition to the restored files size, in percent
+	marginPercent int
+	getFreeSpace  func(path string) (int64, error)
+	getDevice     func(path string) (uint64, bool)
+}
+
+func NewRestoreSpaceCheck(marginPercent int) *RestoreSpaceCheck {
+	return &RestoreSpaceCheck{marginPercent: marginPercent, getFreeSpace: getAvailableDiskSpace,
+		getDevice: getPathDeviceID}
+}
+
+// ConfigureRestoreSpaceCheck returns nil if the free space check is disabled
+func ConfigureRestoreSpaceCheck() (*RestoreSpaceCheck, error) {
+	if !viper.GetBool(internal.RestoreSpaceCheckSetting) {
+		return nil, nil
+	}
+	marginPercent := viper.GetInt(internal.RestoreSpaceMarginSetting)
+	if marginPercent < 0 {
+		return nil, errors.Errorf("%s must not be negative, got %d", internal.RestoreSpaceMarginSetting, marginPercent)
+	}
+	return NewRestoreSpaceCheck(marginPercent), nil
+}
+
+func getPathDeviceID(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	return getDeviceID(info)
+}
+
+// Check fails with InsufficientSpaceError if the restored files do not fit into the free space of the
+// filesystem they are restored to. The sizes of the restored files are summed from the files metadata,
+// the files of the tablespace with the unknown location are accounted to the data directory.
+func (check *RestoreSpaceCheck) Check(dbDataDirectory string, filesMeta FilesMetadataDto,
+	filesToUnwrap map[string]bool, tablespaceSpec *TablespaceSpec) error {
+	if len(filesMeta.Files) == 0 {
+		tracelog.WarningLogger.Println("Backup has no files metadata, skipping the free space check")
+		return nil
+	}
+	requiredBytes, ok := sumRestoredSizes(dbDataDirectory, filesMeta, filesToUnwrap, tablespaceSpec)
+	if !ok {
+		tracelog.WarningLogger.Println("Backup files metadata has no file sizes, skipping the free space check")
+		return nil
+	}
+	targets := check.groupByFilesystem(requiredBytes)
+	for _, target := range targets {
+		availableBytes, err := check.getFreeSpace(findExistingDirectory(target.directories[0]))
+		if err != nil {
+			return err
+		}
+		required := target.requiredBytes + target.requiredBytes*int64(check.marginPercent)/100
+		if required > availableBytes {
+			return newInsufficientSpaceError(target.directories, required, availableBytes)
+		}
+		tracelog.InfoLogger.Printf("Restore to %v requires about %d bytes, %d bytes are available\n",
+			target.directories, target.requiredBytes, availableBytes)
+	}
+	return nil
+}
+
+// sumRestoredSizes sums the sizes of the restored files per the directory they are restored to:
+// the data directory or the tablespace location. It returns false if some file size is not recorded.
+func sumRestoredSizes(dbDataDirectory string, filesMeta FilesMetadataDto, filesToUnwrap map[string]bool,
+	tablespaceSpec *TablespaceSpec) (map[string]int64, bool) {
+	requiredBytes := make(map[string]int64)
+	for fileName, description := range filesMeta.Files {
+		if filesToUnwrap != nil && !filesToUnwrap[fileName] {
+			continue
+		}
+		if description.Size == nil {
+			return nil, false
+		}
+		directory := dbDataDirectory
+		if tablespaceName, ok := getTablespaceName(fileName); ok && tablespaceSpec != nil {
+			if location, ok := tablespaceSpec.location(tablespaceName); ok {
+				directory = location.Location
+			}
+		}
+		requiredBytes[directory] += *description.Size
+	}
+	return requiredBytes, true
+}
+
+// groupByFilesystem merges the directories located on the same filesystem, the directories
+// of the unknown filesystem are checked separately
+func (check *RestoreSpaceCheck) groupByFilesystem(requiredBytes map[string]int64) []*restoreSpaceTarget {
+	directories := make([]string, 0, len(requiredBytes))
+	for directory := range requiredBytes {
+		directories = append(directories, directory)
+	}
+	sort.Strings(directories)
+
+	targets := make([]*restoreSpaceTarget, 0, len(directories))
+	byDevice := make(map[uint64]*restoreSpaceTarget)
+	for _, directory := range directories {
+		deviceID, ok := check.getDevice(findExistingDirectory(filepath.Clean(directory)))
+		target, known := byDevice[deviceID]
+		if !ok || !known {
+			target = &restoreSpaceTarget{}
+			targets = append(targets, target)
+			if ok {
+				byDevice[deviceID] = target
+			}
+		}
+		target.directories = append(target.directories, directory)
+		target.requiredBytes += requiredBytes[directory]
+	}
+	return targets
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func makeSpaceCheckTestFileDescription(size int64) internal.BackupFileDescription {
+	return internal.BackupFileDescription{Size: &size}
+}
+
+func makeSpaceCheckTestFilesMeta() FilesMetadataDto {
+	return FilesMetadataDto{Files: internal.BackupFileList{
+		"/PG_VERSION":              makeSpaceCheckTestFileDescription(100),
+		"/base/1/1259":             makeSpaceCheckTestFileDescription(900),
+		"/pg_tblspc/16385/PG_15/1": makeSpaceCheckTestFileDescription(2000),
+	}}
+}
+
+// makeTestSpaceCheck fakes the statfs: the free space and the device of every directory
+func makeTestSpaceCheck(marginPercent int, freeSpace map[string]int64, devices map[string]uint64) *RestoreSpaceCheck {
+	check := NewRestoreSpaceCheck(marginPercent)
+	check.getFreeSpace = func(path string) (int64, error) {
+		return freeSpace[path], nil
+	}
+	check.getDevice = func(path string) (uint64, bool) {
+		device, ok := devices[path]
+		return device, ok
+	}
+	return check
+}
+
+func makeSpaceCheckTestTablespaceSpec(dbDataDirectory, location string) *TablespaceSpec {
+	spec := NewTablespaceSpec(dbDataDirectory)
+	spec.addTablespace("16385", location)
+	return &spec
+}
+
+func TestRestoreSpaceCheck_TablespaceOnOtherFilesystem(t *testing.T) {
+	dbDataDirectory, location := t.TempDir(), t.TempDir()
+	spec := makeSpaceCheckTestTablespaceSpec(dbDataDirectory, location)
+	devices := map[string]uint64{dbDataDirectory: 1, location: 2}
+
+	// 1000 bytes to the data directory and 2000 bytes to the tablespace, each checked separately
+	check := makeTestSpaceCheck(10, map[string]int64{dbDataDirectory: 1100, location: 2200}, devices)
+	assert.NoError(t, check.Check(dbDataDirectory, makeSpaceCheckTestFilesMeta(), UnwrapAll, spec))
+
+	check = makeTestSpaceCheck(10, map[string]int64{dbDataDirectory: 1100, location: 2199}, devices)
+	err := check.Check(dbDataDirectory, makeSpaceCheckTestFilesMeta(), UnwrapAll, spec)
+	assert.IsType(t, InsufficientSpaceError{}, err)
+	assert.Contains(t, err.Error(), location)
+	assert.NotContains(t, err.Error(), dbDataDirectory)
+
+	// the tablespace files are not selected
+	err = check.Check(dbDataDirectory, makeSpaceCheckTestFilesMeta(), map[string]bool{"/PG_VERSION": true}, spec)
+	assert.NoError(t, err)
+}
+
+func TestRestoreSpaceCheck_TablespaceOnSameFilesystem(t *testing.T) {
+	dbDataDirectory, location := t.TempDir(), t.TempDir()
+	spec := makeSpaceCheckTestTablespaceSpec(dbDataDirectory, location)
+	devices := map[string]uint64{dbDataDirectory: 1, location: 1}
+
+	// 3000 bytes are restored to the same filesystem
+	check := makeTestSpaceCheck(0, map[string]int64{dbDataDirectory: 2999, location: 2999}, devices)
+	err := check.Check(dbDataDirectory, makeSpaceCheckTestFilesMeta(), UnwrapAll, spec)
+	assert.IsType(t, InsufficientSpaceError{}, err)
+	assert.Contains(t, err.Error(), "requires 3000 bytes")
+
+	check = makeTestSpaceCheck(0, map[string]int64{dbDataDirectory: 3000, location: 3000}, devices)
+	assert.NoError(t, check.Check(dbDataDirectory, makeSpaceCheckTestFilesMeta(), UnwrapAll, spec))
+}
+
+func TestRestoreSpaceCheck_UnknownTablespaceLocation(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	check := makeTestSpaceCheck(0, map[string]int64{dbDataDirectory: 2999}, nil)
+
+	// the tablespace files are accounted to the data directory
+	err := check.Check(dbDataDirectory, makeSpaceCheckTestFilesMeta(), UnwrapAll, &TablespaceSpec{})
+	assert.IsType(t, InsufficientSpaceError{}, err)
+}
+
+func TestRestoreSpaceCheck_NoFileSizes(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	check := makeTestSpaceCheck(0, map[string]int64{dbDataDirectory: 0}, nil)
+	filesMeta := makeSpaceCheckTestFilesMeta()
+	filesMeta.Files["/global/pg_control"] = internal.BackupFileDescription{}
+
+	assert.NoError(t, check.Check(dbDataDirectory, filesMeta, UnwrapAll, nil))
+	assert.NoError(t, check.Check(dbDataDirectory, FilesMetadataDto{}, UnwrapAll, nil))
+}
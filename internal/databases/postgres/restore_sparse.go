@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/spf13/viper"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// sparseBlockSize is the granularity of the holes of the restored sparse files, the common filesystem block size
+const sparseBlockSize = 4096
+
+// sparseCopyBufferSize is the size of the chunk of the restored file inspected for the zero blocks at once
+const sparseCopyBufferSize = 64 * sparseBlockSize
+
+var zeroSparseBlock = make([]byte, sparseBlockSize)
+
+// isSparseRestoreEnabled returns whether the zero blocks of the restored files are left as holes, WALG_RESTORE_SPARSE_FILES
+func isSparseRestoreEnabled() bool {
+	return viper.GetBool(internal.RestoreSparseFilesSetting)
+}
+
+// truncater is the file which length can be set, the extended part reads as zeros
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// writeSparse copies the reader to the empty file seeking over the zero blocks instead of writing them,
+// so the filesystem supporting the sparse files does not allocate them. The file is truncated to the copied size
+// in the end to keep the trailing hole. The filesystem without the sparse files support fills the holes with zeros.
+func writeSparse(file *os.File, reader io.Reader) (int64, error) {
+	buffer := make([]byte, sparseCopyBufferSize)
+	var copied int64
+	for {
+		n, readErr := io.ReadFull(reader, buffer)
+		if err := writeSparseChunk(file, buffer[:n]); err != nil {
+			return copied, err
+		}
+		copied += int64(n)
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return copied, readErr
+		}
+	}
+	return copied, file.Truncate(copied)
+}
+
+// writeSparseChunk writes the runs of the non-zero blocks of the chunk and seeks over the zero blocks
+func writeSparseChunk(file *os.File, chunk []byte) error {
+	dataStart := 0
+	for offset := 0; offset < len(chunk); offset += sparseBlockSize {
+		end := offset + sparseBlockSize
+		if end > len(chunk) {
+			end = len(chunk)
+		}
+		if !bytes.Equal(chunk[offset:end], zeroSparseBlock[:end-offset]) {
+			continue
+		}
+		if _, err := file.Write(chunk[dataStart:offset]); err != nil {
+			return err
+		}
+		if _, err := file.Seek(int64(end-offset), io.SeekCurrent); err != nil {
+			return err
+		}
+		dataStart = end
+	}
+	_, err := file.Write(chunk[dataStart:])
+	return err
+}
+
+// isEmptyFile returns whether the file has no content, so the holes of the sparse write read as zeros
+func isEmptyFile(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Size() == 0
+}
@@ -0,0 +1,105 @@
+//go:build linux
+// +build linux
+
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// getAllocatedSize returns the physical size of the file
+func getAllocatedSize(t *testing.T, filePath string) int64 {
+	var stat syscall.Stat_t
+	require.NoError(t, syscall.Stat(filePath, &stat))
+	return stat.Blocks * 512
+}
+
+// skipIfNoSparseFiles skips the test on the filesystem which allocates the holes
+func skipIfNoSparseFiles(t *testing.T, directory string) {
+	filePath := filepath.Join(directory, "probe")
+	require.NoError(t, os.WriteFile(filePath, nil, 0600))
+	require.NoError(t, os.Truncate(filePath, 1<<20))
+	if getAllocatedSize(t, filePath) > 0 {
+		t.Skip("the filesystem does not support the sparse files")
+	}
+	require.NoError(t, os.Remove(filePath))
+}
+
+func TestInterpretRestoresSparseFile(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	skipIfNoSparseFiles(t, dbDataDirectory)
+	content := append(bytes.Repeat([]byte{'a'}, sparseBlockSize), make([]byte, 1<<20)...)
+	header := &tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))}
+	filePath := filepath.Join(dbDataDirectory, "base", "1", "1259")
+
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	viper.Set(internal.RestoreSparseFilesSetting, true)
+	defer viper.Set(internal.RestoreSparseFilesSetting, nil)
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(content), header))
+
+	restored, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, restored)
+	assert.Less(t, getAllocatedSize(t, filePath), int64(len(content))/2)
+
+	// the disabled sparse restore materializes the zero blocks
+	viper.Set(internal.RestoreSparseFilesSetting, false)
+	require.NoError(t, os.Remove(filePath))
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(content), header))
+	assert.GreaterOrEqual(t, getAllocatedSize(t, filePath), int64(len(content)))
+}
+
+// makeSparseTestIncrement returns the increment of the page file of pageCount pages with the only changed block
+func makeSparseTestIncrement(pageCount uint64, blockNo uint32) []byte {
+	var increment bytes.Buffer
+	increment.Write(IncrementFileHeader)
+	_ = binary.Write(&increment, binary.LittleEndian, pageCount*uint64(DatabasePageSize))
+	_ = binary.Write(&increment, binary.LittleEndian, uint32(1))
+	_ = binary.Write(&increment, binary.LittleEndian, blockNo)
+	increment.Write(bytes.Repeat([]byte{'p'}, int(DatabasePageSize)))
+	return increment.Bytes()
+}
+
+func TestCreateFileFromIncrement_Sparse(t *testing.T) {
+	directory := t.TempDir()
+	skipIfNoSparseFiles(t, directory)
+	const pageCount = 128
+	createFile := func(name string) (string, int64) {
+		filePath := filepath.Join(directory, name)
+		file, err := os.Create(filePath)
+		require.NoError(t, err)
+		defer file.Close()
+		target, err := NewReadWriterAtFrom(file)
+		require.NoError(t, err)
+		missingBlockCount, err := CreateFileFromIncrement(bytes.NewReader(makeSparseTestIncrement(pageCount, 3)), target)
+		require.NoError(t, err)
+		return filePath, missingBlockCount
+	}
+
+	viper.Set(internal.RestoreSparseFilesSetting, true)
+	defer viper.Set(internal.RestoreSparseFilesSetting, nil)
+	sparsePath, missingBlockCount := createFile("sparse")
+	viper.Set(internal.RestoreSparseFilesSetting, false)
+	densePath, _ := createFile("dense")
+
+	assert.Equal(t, int64(pageCount-1), missingBlockCount)
+	sparseContent, err := os.ReadFile(sparsePath)
+	require.NoError(t, err)
+	denseContent, err := os.ReadFile(densePath)
+	require.NoError(t, err)
+	assert.Equal(t, denseContent, sparseContent)
+	assert.Equal(t, pageCount*int(DatabasePageSize), len(sparseContent))
+	assert.Less(t, getAllocatedSize(t, sparsePath), int64(len(sparseContent))/2)
+	assert.GreaterOrEqual(t, getAllocatedSize(t, densePath), int64(len(denseContent)))
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeSparseTestContent returns the content with the leading, inner and trailing zero runs
+// which are not aligned to the sparse blocks
+func makeSparseTestContent() []byte {
+	content := make([]byte, 0)
+	content = append(content, bytes.Repeat([]byte{0}, 3*sparseBlockSize)...)
+	content = append(content, bytes.Repeat([]byte{'a'}, 100)...)
+	content = append(content, bytes.Repeat([]byte{0}, sparseCopyBufferSize+5000)...)
+	content = append(content, bytes.Repeat([]byte{'b'}, 2*sparseBlockSize+1)...)
+	return append(content, bytes.Repeat([]byte{0}, 3*sparseBlockSize+10)...)
+}
+
+func TestWriteSparse_PreservesContent(t *testing.T) {
+	content := makeSparseTestContent()
+	filePath := filepath.Join(t.TempDir(), "sparse")
+	file, err := os.Create(filePath)
+	require.NoError(t, err)
+
+	copied, err := writeSparse(file, bytes.NewReader(content))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	assert.Equal(t, int64(len(content)), copied)
+	restored, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, restored)
+}
+
+func TestWriteSparse_EmptyAndZeroContent(t *testing.T) {
+	for _, content := range [][]byte{{}, make([]byte, 10), make([]byte, 2*sparseCopyBufferSize)} {
+		filePath := filepath.Join(t.TempDir(), "sparse")
+		file, err := os.Create(filePath)
+		require.NoError(t, err)
+
+		_, err = writeSparse(file, bytes.NewReader(content))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		restored, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, len(content), len(restored))
+		assert.Equal(t, content, restored)
+	}
+}
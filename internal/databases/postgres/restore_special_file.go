@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// UnknownTarTypeflagError indicates the tar entry of the type the restore does not extract,
+// so the restored data directory lacks it
+type UnknownTarTypeflagError struct {
+	error
+}
+
+func newUnknownTarTypeflagError(fileInfo *tar.Header, reason string) UnknownTarTypeflagError {
+	return UnknownTarTypeflagError{errors.Errorf(
+		"tar entry '%s' of type '%c' is not restored: %s", fileInfo.Name, fileInfo.Typeflag, reason)}
+}
+
+func (err UnknownTarTypeflagError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// isSpecialFile returns whether the tar entry is the device or fifo node
+func isSpecialFile(fileInfo *tar.Header) bool {
+	switch fileInfo.Typeflag {
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return true
+	}
+	return false
+}
+
+// interpretUnknownEntry handles the tar entry of the type not extracted otherwise. The device and fifo nodes
+// are recreated if WALG_RESTORE_SPECIAL_FILES is enabled and the restore runs as root. The other entries
+// are reported as the warning, or fail the restore if WALG_RESTORE_STRICT_TYPEFLAG is enabled.
+func (tarInterpreter *FileTarInterpreter) interpretUnknownEntry(fileInfo *tar.Header, targetPath string) error {
+	reason := "the type is not supported"
+	if isSpecialFile(fileInfo) {
+		switch {
+		case !tarInterpreter.restoreSpecialFiles:
+			reason = fmt.Sprintf("the special files are restored only with %s enabled", internal.RestoreSpecialFilesSetting)
+		case os.Geteuid() != 0:
+			reason = "the special files are restored only by root"
+		default:
+			if err := createSpecialFile(fileInfo, targetPath); err != nil {
+				return errors.Wrapf(err, "Interpret: failed to create special file %s", targetPath)
+			}
+			return tarInterpreter.restoreAttributes(fileInfo, targetPath)
+		}
+	}
+	err := newUnknownTarTypeflagError(fileInfo, reason)
+	if tarInterpreter.strictTypeflag {
+		return err
+	}
+	tracelog.WarningLogger.Printf("%v, set %s to fail the restore instead\n", err, internal.RestoreStrictTypeflagSetting)
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package postgres
+
+import (
+	"archive/tar"
+
+	"github.com/pkg/errors"
+)
+
+func createSpecialFile(fileInfo *tar.Header, targetPath string) error {
+	return errors.New("the special files restore is supported on Linux only")
+}
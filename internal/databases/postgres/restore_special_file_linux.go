@@ -0,0 +1,33 @@
+//go:build linux
+// +build linux
+
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"syscall"
+)
+
+// createSpecialFile creates the device or fifo node of the tar entry with mknod
+func createSpecialFile(fileInfo *tar.Header, targetPath string) error {
+	mode := uint32(fileInfo.Mode & 07777)
+	switch fileInfo.Typeflag {
+	case tar.TypeChar:
+		mode |= syscall.S_IFCHR
+	case tar.TypeBlock:
+		mode |= syscall.S_IFBLK
+	default:
+		mode |= syscall.S_IFIFO
+	}
+	if err := syscall.Mknod(targetPath, mode, makeDeviceNumber(fileInfo.Devmajor, fileInfo.Devminor)); err != nil {
+		return err
+	}
+	// the mode of the created node is masked by umask
+	return os.Chmod(targetPath, fileInfo.FileInfo().Mode().Perm())
+}
+
+// makeDeviceNumber encodes the device number as glibc makedev does
+func makeDeviceNumber(major, minor int64) int {
+	return int((major&0xfffff000)<<32 | (major&0xfff)<<8 | (minor&0xffffff00)<<12 | minor&0xff)
+}
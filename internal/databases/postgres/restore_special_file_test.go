@@ -0,0 +1,60 @@
+package postgres_test
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+var fifoTestHeader = &tar.Header{Name: "/pg_stat_tmp/fifo", Typeflag: tar.TypeFifo, Mode: 0600}
+
+func interpretFifoTestHeader(t *testing.T) (string, error) {
+	dataDirectory := t.TempDir()
+	tarInterpreter := postgres.NewFileTarInterpreter(dataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDirectory, "pg_stat_tmp"), 0700))
+	return filepath.Join(dataDirectory, "pg_stat_tmp", "fifo"), tarInterpreter.Interpret(nil, fifoTestHeader)
+}
+
+func TestInterpret_FifoLenient(t *testing.T) {
+	targetPath, err := interpretFifoTestHeader(t)
+
+	// the entry is reported, but the restore goes on
+	require.NoError(t, err)
+	assert.NoFileExists(t, targetPath)
+}
+
+func TestInterpret_FifoStrict(t *testing.T) {
+	viper.Set(internal.RestoreStrictTypeflagSetting, true)
+	defer viper.Set(internal.RestoreStrictTypeflagSetting, nil)
+
+	targetPath, err := interpretFifoTestHeader(t)
+
+	assert.IsType(t, postgres.UnknownTarTypeflagError{}, err)
+	assert.NoFileExists(t, targetPath)
+}
+
+func TestInterpret_FifoRecreated(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("the special files are restored only by root")
+	}
+	viper.Set(internal.RestoreStrictTypeflagSetting, true)
+	defer viper.Set(internal.RestoreStrictTypeflagSetting, nil)
+	viper.Set(internal.RestoreSpecialFilesSetting, true)
+	defer viper.Set(internal.RestoreSpecialFilesSetting, nil)
+
+	targetPath, err := interpretFifoTestHeader(t)
+
+	require.NoError(t, err)
+	info, err := os.Lstat(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeNamedPipe, info.Mode().Type())
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const defaultStatsdFlushInterval = 10 * time.Second
+
+// StatsdRestorePlugin sends the restore metrics to the StatsD endpoint over UDP.
+// The restored files and bytes are sent as counters periodically, so the StatsD backend
+// computes the files/sec and MB/sec rates. The restore summary is sent as it finishes.
+type StatsdRestorePlugin struct {
+	NopRestorePlugin
+	conn          net.Conn
+	prefix        string
+	flushInterval time.Duration
+
+	// pendingFiles and pendingBytes are accounted since the previous flush
+	pendingFiles int64
+	pendingBytes int64
+	totalFiles   int64
+	totalBytes   int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	warnOnce sync.Once
+}
+
+// NewStatsdRestorePlugin creates the plugin sending the metrics to the address with the prefix, e.g. walg.restore
+func NewStatsdRestorePlugin(address, prefix string, flushInterval time.Duration) (*StatsdRestorePlugin, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to the StatsD endpoint %s", address)
+	}
+	plugin := &StatsdRestorePlugin{
+		conn:          conn,
+		prefix:        strings.TrimSuffix(prefix, "."),
+		flushInterval: flushInterval,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go plugin.flushPeriodically()
+	return plugin, nil
+}
+
+// ConfigureStatsdRestorePlugin creates the plugin from the settings, returns nil if the StatsD address is not set
+func ConfigureStatsdRestorePlugin() (*StatsdRestorePlugin, error) {
+	address := viper.GetString(internal.RestoreStatsdAddressSetting)
+	if address == "" {
+		return nil, nil
+	}
+	return NewStatsdRestorePlugin(address, viper.GetString(internal.RestoreStatsdPrefixSetting),
+		defaultStatsdFlushInterval)
+}
+
+func (plugin *StatsdRestorePlugin) flushPeriodically() {
+	defer close(plugin.done)
+	ticker := time.NewTicker(plugin.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			plugin.flush()
+		case <-plugin.stop:
+			return
+		}
+	}
+}
+
+func (plugin *StatsdRestorePlugin) OnFileComplete(info RestoreFileInfo) {
+	atomic.AddInt64(&plugin.pendingFiles, 1)
+	atomic.AddInt64(&plugin.pendingBytes, info.Size)
+	atomic.AddInt64(&plugin.totalFiles, 1)
+	atomic.AddInt64(&plugin.totalBytes, info.Size)
+}
+
+func (plugin *StatsdRestorePlugin) OnRestoreFinish(info RestoreFinishInfo) {
+	plugin.stopOnce.Do(func() { close(plugin.stop) })
+	<-plugin.done
+	plugin.flush()
+
+	metrics := []string{plugin.metric("duration", info.Duration.Milliseconds(), "ms")}
+	if info.Err != nil {
+		metrics = append(metrics, plugin.counter("failure", 1), plugin.counter("errors", 1))
+	} else {
+		metrics = append(metrics, plugin.counter("success", 1))
+	}
+	if seconds := info.Duration.Seconds(); seconds > 0 {
+		metrics = append(metrics,
+			fmt.Sprintf("%s.files_per_second:%.2f|g", plugin.prefix, float64(atomic.LoadInt64(&plugin.totalFiles))/seconds),
+			fmt.Sprintf("%s.bytes_per_second:%.2f|g", plugin.prefix, float64(atomic.LoadInt64(&plugin.totalBytes))/seconds))
+	}
+	plugin.send(metrics...)
+	if err := plugin.conn.Close(); err != nil {
+		tracelog.DebugLogger.Printf("Failed to close the StatsD connection: %v\n", err)
+	}
+}
+
+// flush sends the files and bytes restored since the previous flush
+func (plugin *StatsdRestorePlugin) flush() {
+	files := atomic.SwapInt64(&plugin.pendingFiles, 0)
+	bytes := atomic.SwapInt64(&plugin.pendingBytes, 0)
+	if files == 0 {
+		return
+	}
+	plugin.send(plugin.counter("files", files), plugin.counter("bytes", bytes))
+}
+
+func (plugin *StatsdRestorePlugin) counter(name string, value int64) string {
+	return plugin.metric(name, value, "c")
+}
+
+func (plugin *StatsdRestorePlugin) metric(name string, value int64, metricType string) string {
+	return fmt.Sprintf("%s.%s:%d|%s", plugin.prefix, name, value, metricType)
+}
+
+// send writes the metrics in the single datagram, the failures are logged once since StatsD is best effort
+func (plugin *StatsdRestorePlugin) send(metrics ...string) {
+	_, err := plugin.conn.Write([]byte(strings.Join(metrics, "\n")))
+	if err != nil {
+		plugin.warnOnce.Do(func() {
+			tracelog.WarningLogger.Printf("Failed to send the restore metrics to StatsD: %v\n", err)
+		})
+	}
+}
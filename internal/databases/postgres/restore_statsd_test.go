@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readStatsdMetrics(t *testing.T, conn net.PacketConn, packets int) []string {
+	metrics := make([]string, 0)
+	buffer := make([]byte, 65536)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for i := 0; i < packets; i++ {
+		n, _, err := conn.ReadFrom(buffer)
+		require.NoError(t, err)
+		metrics = append(metrics, strings.Split(string(buffer[:n]), "\n")...)
+	}
+	return metrics
+}
+
+func TestStatsdRestorePlugin(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	plugin, err := NewStatsdRestorePlugin(conn.LocalAddr().String(), "walg.restore.", time.Hour)
+	require.NoError(t, err)
+
+	plugin.OnRestoreStart(RestoreStartInfo{BackupName: "base_000000010000000000000002"})
+	plugin.OnFileComplete(RestoreFileInfo{Name: "/base/1/1259", Size: 8192})
+	plugin.OnFileComplete(RestoreFileInfo{Name: "/PG_VERSION", Size: 3})
+	plugin.OnRestoreFinish(RestoreFinishInfo{Duration: 2 * time.Second})
+
+	metrics := readStatsdMetrics(t, conn, 2)
+	assert.Equal(t, []string{
+		"walg.restore.files:2|c",
+		"walg.restore.bytes:8195|c",
+		"walg.restore.duration:2000|ms",
+		"walg.restore.success:1|c",
+		"walg.restore.files_per_second:1.00|g",
+		"walg.restore.bytes_per_second:4097.50|g",
+	}, metrics)
+}
+
+func TestStatsdRestorePlugin_Failure(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	plugin, err := NewStatsdRestorePlugin(conn.LocalAddr().String(), "walg.restore", time.Hour)
+	require.NoError(t, err)
+
+	plugin.OnRestoreStart(RestoreStartInfo{})
+	plugin.OnRestoreFinish(RestoreFinishInfo{Err: errors.New("failed")})
+
+	metrics := readStatsdMetrics(t, conn, 1)
+	assert.Equal(t, []string{
+		"walg.restore.duration:0|ms",
+		"walg.restore.failure:1|c",
+		"walg.restore.errors:1|c",
+	}, metrics)
+}
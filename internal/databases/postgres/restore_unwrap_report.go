@@ -0,0 +1,234 @@
+package postgres
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// UnwrapResultDto is the snapshot of UnwrapResult, all the files are sorted by their names
+type UnwrapResultDto struct {
+	CompletedFiles        []string                  `json:"completed_files"`
+	CreatedPageFiles      []CreatedPageFileDto      `json:"created_page_files"`
+	WrittenIncrementFiles []WrittenIncrementFileDto `json:"written_increment_files"`
+	PlannedActions        []PlannedActionDto        `json:"planned_actions,omitempty"`
+	SkippedFiles          []string                  `json:"skipped_files,omitempty"`
+	IdenticalFiles        []string                  `json:"identical_files,omitempty"`
+	FailedFiles           []FailedFileDto           `json:"failed_files,omitempty"`
+}
+
+// CreatedPageFileDto is the page file created from the increment with the count of the blocks left to restore
+type CreatedPageFileDto struct {
+	Path              string `json:"path"`
+	MissingBlockCount int64  `json:"missing_block_count"`
+}
+
+// WrittenIncrementFileDto is the page file to which the increment was applied with the count of the written blocks
+type WrittenIncrementFileDto struct {
+	Path              string `json:"path"`
+	WrittenBlockCount int64  `json:"written_block_count"`
+}
+
+// FailedFileDto is the file failed to restore in the best-effort restore with its error
+type FailedFileDto struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// PlannedActionDto is the action the dry run of the restore would do with the tar entry
+type PlannedActionDto struct {
+	Path   string        `json:"path"`
+	Action RestoreAction `json:"action"`
+}
+
+// UnwrapResultTotals are the totals of the unwrap result taken in one consistent read
+type UnwrapResultTotals struct {
+	CompletedFiles int
+	// CreatedPageFiles are the page files created from the increments,
+	// MissingBlocks are the blocks left to restore in them
+	CreatedPageFiles int
+	MissingBlocks    int64
+	// IncrementFiles are the page files the increments were applied to,
+	// IncrementBlocks are the increment blocks written to them
+	IncrementFiles  int
+	IncrementBlocks int64
+	// SkippedFiles are the existing files not rewritten, IdenticalFiles are the ones identical to the backup files
+	SkippedFiles   int
+	IdenticalFiles int
+	// FailedFiles are the files failed to restore in the best-effort restore
+	FailedFiles int
+}
+
+// lock acquires the mutexes of the unwrap result in the fixed order: the completed files, the created page files,
+// the written increment files, the planned actions, the skipped files and the failed files. The writers hold at most one of them at a time,
+// so holding all of them makes the read consistent without the deadlock.
+func (result *UnwrapResult) lock() {
+	result.completedFilesMutex.Lock()
+	result.createdPageFilesMutex.Lock()
+	result.writtenIncrementFilesMutex.Lock()
+	result.plannedActionsMutex.Lock()
+	result.skippedFilesMutex.Lock()
+	result.failedFilesMutex.Lock()
+}
+
+func (result *UnwrapResult) unlock() {
+	result.failedFilesMutex.Unlock()
+	result.skippedFilesMutex.Unlock()
+	result.plannedActionsMutex.Unlock()
+	result.writtenIncrementFilesMutex.Unlock()
+	result.createdPageFilesMutex.Unlock()
+	result.completedFilesMutex.Unlock()
+}
+
+// Totals takes the consistent snapshot of the unwrap result totals, e.g. for the end-of-restore summary
+func (result *UnwrapResult) Totals() UnwrapResultTotals {
+	result.lock()
+	defer result.unlock()
+	totals := UnwrapResultTotals{
+		CompletedFiles:   len(result.completedFiles),
+		CreatedPageFiles: len(result.createdPageFiles),
+		IncrementFiles:   len(result.writtenIncrementFiles),
+		SkippedFiles:     len(result.skippedFiles),
+		IdenticalFiles:   len(result.identicalFiles),
+		FailedFiles:      len(result.failedFiles),
+	}
+	for _, blockCount := range result.createdPageFiles {
+		totals.MissingBlocks += blockCount
+	}
+	for _, blockCount := range result.writtenIncrementFiles {
+		totals.IncrementBlocks += blockCount
+	}
+	return totals
+}
+
+// ToDto takes the consistent snapshot of the unwrap result
+func (result *UnwrapResult) ToDto() UnwrapResultDto {
+	dto := UnwrapResultDto{
+		CompletedFiles:        make([]string, 0),
+		CreatedPageFiles:      make([]CreatedPageFileDto, 0),
+		WrittenIncrementFiles: make([]WrittenIncrementFileDto, 0),
+	}
+	result.lock()
+	dto.CompletedFiles = append(dto.CompletedFiles, result.completedFiles...)
+	for path, missingBlockCount := range result.createdPageFiles {
+		dto.CreatedPageFiles = append(dto.CreatedPageFiles, CreatedPageFileDto{path, missingBlockCount})
+	}
+	for path, writtenBlockCount := range result.writtenIncrementFiles {
+		dto.WrittenIncrementFiles = append(dto.WrittenIncrementFiles, WrittenIncrementFileDto{path, writtenBlockCount})
+	}
+	for path, action := range result.plannedActions {
+		dto.PlannedActions = append(dto.PlannedActions, PlannedActionDto{path, action})
+	}
+	dto.SkippedFiles = append(dto.SkippedFiles, result.skippedFiles...)
+	dto.IdenticalFiles = append(dto.IdenticalFiles, result.identicalFiles...)
+	for path, failure := range result.failedFiles {
+		dto.FailedFiles = append(dto.FailedFiles, FailedFileDto{path, failure})
+	}
+	result.unlock()
+
+	sort.Strings(dto.CompletedFiles)
+	sort.Strings(dto.SkippedFiles)
+	sort.Strings(dto.IdenticalFiles)
+	sort.Slice(dto.CreatedPageFiles, func(i, j int) bool {
+		return dto.CreatedPageFiles[i].Path < dto.CreatedPageFiles[j].Path
+	})
+	sort.Slice(dto.WrittenIncrementFiles, func(i, j int) bool {
+		return dto.WrittenIncrementFiles[i].Path < dto.WrittenIncrementFiles[j].Path
+	})
+	sort.Slice(dto.PlannedActions, func(i, j int) bool {
+		return dto.PlannedActions[i].Path < dto.PlannedActions[j].Path
+	})
+	sort.Slice(dto.FailedFiles, func(i, j int) bool {
+		return dto.FailedFiles[i].Path < dto.FailedFiles[j].Path
+	})
+	return dto
+}
+
+// MarshalJSON serializes the snapshot of the unwrap result
+func (result *UnwrapResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(result.ToDto())
+}
+
+// UnwrapReportBackupDto is the unwrap result of one restored backup
+type UnwrapReportBackupDto struct {
+	BackupName string `json:"backup_name"`
+	UnwrapResultDto
+}
+
+// UnwrapReportDto lists the unwrap results of the restored backups sorted by their names
+type UnwrapReportDto struct {
+	Backups []UnwrapReportBackupDto `json:"backups"`
+}
+
+// RestoreUnwrapReport collects the unwrap results of every backup restored by the fetch
+// and writes them to the output path as the JSON document
+type RestoreUnwrapReport struct {
+	outputPath string
+
+	mutex   sync.Mutex
+	backups []UnwrapReportBackupDto
+}
+
+func NewRestoreUnwrapReport(outputPath string) *RestoreUnwrapReport {
+	return &RestoreUnwrapReport{outputPath: outputPath, backups: make([]UnwrapReportBackupDto, 0)}
+}
+
+func (report *RestoreUnwrapReport) trackBackup(backupName string, result *UnwrapResult) {
+	dto := UnwrapReportBackupDto{BackupName: backupName, UnwrapResultDto: result.ToDto()}
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+	report.backups = append(report.backups, dto)
+}
+
+// Build returns the report of the backups restored so far
+func (report *RestoreUnwrapReport) Build() UnwrapReportDto {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+	backups := append(make([]UnwrapReportBackupDto, 0, len(report.backups)), report.backups...)
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].BackupName < backups[j].BackupName
+	})
+	return UnwrapReportDto{Backups: backups}
+}
+
+// Finish writes the report to the output path
+func (report *RestoreUnwrapReport) Finish() error {
+	dto := report.Build()
+	data, err := json.MarshalIndent(dto, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(report.outputPath, append(data, '\n'), 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to write the unwrap report")
+	}
+	tracelog.InfoLogger.Printf("Unwrap report of %d restored backups is written to '%s'\n",
+		len(dto.Backups), report.outputPath)
+	return nil
+}
+
+// reportUnwrapResult logs the totals of the completed unwrap of the backup and passes its result
+// to the unwrap report, the completion marker and the restore metrics, if any
+func (tarInterpreter *FileTarInterpreter) reportUnwrapResult(backupName string) {
+	totals := tarInterpreter.UnwrapResult.Totals()
+	tracelog.InfoLogger.Printf("Backup %s unwrapped: %d files completed, %d page files created from the increments "+
+		"with %d blocks left to restore, %d increment blocks written to %d page files, "+
+		"%d existing files skipped, %d existing files identical to the backup ones\n", backupName,
+		totals.CompletedFiles, totals.CreatedPageFiles, totals.MissingBlocks, totals.IncrementBlocks, totals.IncrementFiles,
+		totals.SkippedFiles, totals.IdenticalFiles)
+	if totals.FailedFiles > 0 {
+		tracelog.ErrorLogger.Printf("Backup %s unwrapped in the best-effort mode: %d files failed to restore\n",
+			backupName, totals.FailedFiles)
+	}
+	tarInterpreter.metrics.trackUnwrapResult(tarInterpreter.UnwrapResult)
+	if tarInterpreter.unwrapReport != nil {
+		tarInterpreter.unwrapReport.trackBackup(backupName, tarInterpreter.UnwrapResult)
+	}
+	if tarInterpreter.completionMarker != nil {
+		tarInterpreter.completionMarker.trackBackup(backupName, tarInterpreter.UnwrapResult)
+	}
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestUnwrapResult_ToDtoIsSorted(t *testing.T) {
+	result := newUnwrapResult()
+	result.completedFiles = []string{"/base/1/1260", "/PG_VERSION", "/base/1/1259"}
+	result.createdPageFiles = map[string]int64{"/base/1/2": 3, "/base/1/1": 0}
+	result.writtenIncrementFiles = map[string]int64{"/base/1/4": 1, "/base/1/3": 2}
+
+	dto := result.ToDto()
+
+	assert.Equal(t, UnwrapResultDto{
+		CompletedFiles:        []string{"/PG_VERSION", "/base/1/1259", "/base/1/1260"},
+		CreatedPageFiles:      []CreatedPageFileDto{{"/base/1/1", 0}, {"/base/1/2", 3}},
+		WrittenIncrementFiles: []WrittenIncrementFileDto{{"/base/1/3", 2}, {"/base/1/4", 1}},
+	}, dto)
+	data, err := json.Marshal(newUnwrapResult())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"completed_files":[],"created_page_files":[],"written_increment_files":[]}`, string(data))
+}
+
+func TestUnwrapResult_TotalsAreConsistentUnderConcurrentUpdates(t *testing.T) {
+	const writers, filesPerWriter = 8, 200
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	done := make(chan struct{})
+	var writersGroup sync.WaitGroup
+	for writer := 0; writer < writers; writer++ {
+		writersGroup.Add(1)
+		go func(writer int) {
+			defer writersGroup.Done()
+			for i := 0; i < filesPerWriter; i++ {
+				// every file goes through the completed, created and written results in turn
+				fileName := fmt.Sprintf("/base/%d/%d", writer, i)
+				tarInterpreter.AddFileUnwrapResult(NewCompletedResult(), fileName)
+				tarInterpreter.AddFileUnwrapResult(NewCreatedFromIncrementResult(2), fileName)
+				tarInterpreter.AddFileUnwrapResult(NewWroteIncrementBlocksResult(3), fileName)
+				tarInterpreter.AddFileUnwrapResult(NewSkippedResult(), fileName)
+			}
+		}(writer)
+	}
+	go func() {
+		writersGroup.Wait()
+		close(done)
+	}()
+
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		totals := tarInterpreter.UnwrapResult.Totals()
+		// the snapshot never sees the later result of the file without the earlier one
+		require.GreaterOrEqual(t, totals.CompletedFiles, totals.CreatedPageFiles)
+		require.GreaterOrEqual(t, totals.CreatedPageFiles, totals.IncrementFiles)
+		require.Equal(t, int64(2*totals.CreatedPageFiles), totals.MissingBlocks)
+		require.Equal(t, int64(3*totals.IncrementFiles), totals.IncrementBlocks)
+		require.GreaterOrEqual(t, totals.IncrementFiles, totals.SkippedFiles)
+	}
+
+	assert.Equal(t, UnwrapResultTotals{
+		CompletedFiles:   writers * filesPerWriter,
+		CreatedPageFiles: writers * filesPerWriter,
+		MissingBlocks:    2 * writers * filesPerWriter,
+		IncrementFiles:   writers * filesPerWriter,
+		IncrementBlocks:  3 * writers * filesPerWriter,
+		SkippedFiles:     writers * filesPerWriter,
+	}, tarInterpreter.UnwrapResult.Totals())
+}
+
+func TestRestoreUnwrapReport_TracksRestoredBackups(t *testing.T) {
+	folder := putSyntheticTestChain(t)
+	outputPath := filepath.Join(t.TempDir(), "unwrap_report.json")
+	report := NewRestoreUnwrapReport(outputPath)
+	deltaBackup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), diffTestDeltaBackup)
+	filesToUnwrap, err := deltaBackup.GetFilesToUnwrap("")
+	require.NoError(t, err)
+
+	err = deltaFetchRecursionOld(deltaBackup, folder, t.TempDir(), nil, filesToUnwrap, WithUnwrapReport(report))
+	require.NoError(t, err)
+	require.NoError(t, report.Finish())
+
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	var dto UnwrapReportDto
+	require.NoError(t, json.Unmarshal(data, &dto))
+	require.Len(t, dto.Backups, 2)
+	assert.Equal(t, diffTestFullBackup, dto.Backups[0].BackupName)
+	// pg_control is restored from the fetched backup only
+	assert.Equal(t, []string{"/PG_VERSION", "/base/1/1259", "/base/1/1260"}, dto.Backups[0].CompletedFiles)
+	assert.Equal(t, diffTestDeltaBackup, dto.Backups[1].BackupName)
+	assert.Equal(t, []string{PgControlPath}, dto.Backups[1].CompletedFiles)
+}
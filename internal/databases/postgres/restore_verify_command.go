@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// maxVerifyCommandStderr bounds the stderr of the failed command kept in the error
+const maxVerifyCommandStderr = 4096
+
+type RestoreVerifyCommandError struct {
+	error
+}
+
+func newRestoreVerifyCommandError(fileName string, err error, stderr string) RestoreVerifyCommandError {
+	message := fmt.Sprintf("verify command has failed for the restored '%s': %v", fileName, err)
+	if stderr != "" {
+		message += ", stderr: " + stderr
+	}
+	return RestoreVerifyCommandError{errors.New(message)}
+}
+
+func (err RestoreVerifyCommandError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// RestoreVerifyCommand runs the WALG_RESTORE_VERIFY_COMMAND against every restored file, e.g. to run
+// the custom relation file validator. The files are verified once the restore is complete, so every file
+// is verified once in its final state even if it is restored by several delta backups. At most concurrency
+// commands run at the same time and the files smaller than minSize are not verified.
+type RestoreVerifyCommand struct {
+	concurrency int
+	minSize     int64
+
+	mutex sync.Mutex
+	files map[string]string
+}
+
+func NewRestoreVerifyCommand(concurrency int, minSize int64) *RestoreVerifyCommand {
+	return &RestoreVerifyCommand{concurrency: concurrency, minSize: minSize, files: make(map[string]string)}
+}
+
+// ConfigureRestoreVerifyCommand creates the verification from the settings, returns nil if no command is set
+func ConfigureRestoreVerifyCommand() (*RestoreVerifyCommand, error) {
+	if viper.GetString(internal.RestoreVerifyCommandSetting) == "" {
+		return nil, nil
+	}
+	concurrency := viper.GetInt(internal.RestoreVerifyConcurrencySetting)
+	if concurrency < internal.MinAllowedConcurrency {
+		return nil, errors.Errorf("%s must be positive, got %d", internal.RestoreVerifyConcurrencySetting, concurrency)
+	}
+	minSize := viper.GetInt64(internal.RestoreVerifyMinSizeSetting)
+	if minSize < 0 {
+		return nil, errors.Errorf("%s must not be negative, got %d", internal.RestoreVerifyMinSizeSetting, minSize)
+	}
+	return NewRestoreVerifyCommand(concurrency, minSize), nil
+}
+
+func (verifyCommand *RestoreVerifyCommand) trackFile(name, targetPath string) {
+	verifyCommand.mutex.Lock()
+	defer verifyCommand.mutex.Unlock()
+	verifyCommand.files[name] = targetPath
+}
+
+// VerifyFiles runs the command against every restored file and returns the first failure.
+// The files which are not verified yet are not verified once some command fails.
+func (verifyCommand *RestoreVerifyCommand) VerifyFiles() error {
+	names, paths, skippedCount, err := verifyCommand.selectFiles()
+	if err != nil {
+		return err
+	}
+
+	var failureOnce sync.Once
+	var failure error
+	failed := make(chan struct{})
+	fileNames := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < verifyCommand.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range fileNames {
+				if err := verifyCommand.verifyFile(name, paths[name]); err != nil {
+					failureOnce.Do(func() {
+						failure = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+dispatch:
+	for _, name := range names {
+		select {
+		case fileNames <- name:
+		case <-failed:
+			break dispatch
+		}
+	}
+	close(fileNames)
+	wg.Wait()
+	if failure != nil {
+		tracelog.ErrorLogger.Printf("%v\n", failure)
+		return failure
+	}
+	tracelog.InfoLogger.Printf("Verify command has passed for %d restored files, %d files smaller than %d bytes "+
+		"are not verified\n", len(names), skippedCount, verifyCommand.minSize)
+	return nil
+}
+
+// selectFiles returns the sorted names of the files to verify with their paths and the number of the too small files
+func (verifyCommand *RestoreVerifyCommand) selectFiles() ([]string, map[string]string, int, error) {
+	verifyCommand.mutex.Lock()
+	defer verifyCommand.mutex.Unlock()
+	names := make([]string, 0, len(verifyCommand.files))
+	paths := make(map[string]string, len(verifyCommand.files))
+	skippedCount := 0
+	for name, targetPath := range verifyCommand.files {
+		fileInfo, err := os.Stat(targetPath)
+		if err != nil {
+			return nil, nil, 0, errors.Wrapf(err, "failed to stat the restored '%s' to verify it", name)
+		}
+		if fileInfo.Size() < verifyCommand.minSize {
+			skippedCount++
+			continue
+		}
+		names = append(names, name)
+		paths[name] = targetPath
+	}
+	sort.Strings(names)
+	return names, paths, skippedCount, nil
+}
+
+// verifyFile runs the command with the restored file passed in WALG_RESTORE_FILE_PATH and WALG_RESTORE_FILE_NAME
+func (verifyCommand *RestoreVerifyCommand) verifyFile(name, targetPath string) error {
+	cmd, err := internal.GetCommandSetting(internal.RestoreVerifyCommandSetting)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%s", "WALG_RESTORE_FILE_PATH", targetPath),
+		fmt.Sprintf("%s=%s", "WALG_RESTORE_FILE_NAME", name))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	tracelog.DebugLogger.Printf("Running the verify command for '%s'\n", name)
+	if err = cmd.Run(); err != nil {
+		return newRestoreVerifyCommandError(name, err, tailString(strings.TrimSpace(stderr.String()),
+			maxVerifyCommandStderr))
+	}
+	return nil
+}
+
+func tailString(value string, maxLength int) string {
+	if len(value) <= maxLength {
+		return value
+	}
+	return "..." + value[len(value)-maxLength:]
+}
@@ -0,0 +1,89 @@
+package postgres_test
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func restoreVerifyTestFiles(t *testing.T, verifyCommand *postgres.RestoreVerifyCommand, files map[string]string) string {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithVerifyCommand(verifyCommand))
+	for name, content := range files {
+		err := tarInterpreter.Interpret(strings.NewReader(content), &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0600,
+			Size:     int64(len(content)),
+		})
+		require.NoError(t, err)
+	}
+	return dbDataDirectory
+}
+
+func setRestoreVerifyTestCommand(t *testing.T, command string) {
+	viper.Set(internal.RestoreVerifyCommandSetting, command)
+	t.Cleanup(func() { viper.Set(internal.RestoreVerifyCommandSetting, "") })
+}
+
+func TestRestoreVerifyCommand_VerifiesEveryFile(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "verified")
+	setRestoreVerifyTestCommand(t, `echo "$WALG_RESTORE_FILE_NAME $(cat "$WALG_RESTORE_FILE_PATH")" >> `+logFile)
+	verifyCommand := postgres.NewRestoreVerifyCommand(1, 0)
+	restoreVerifyTestFiles(t, verifyCommand, map[string]string{"/base/1/1259": "relation", "/PG_VERSION": "14"})
+
+	require.NoError(t, verifyCommand.VerifyFiles())
+
+	verified, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Equal(t, "/PG_VERSION 14\n/base/1/1259 relation\n", string(verified))
+}
+
+func TestRestoreVerifyCommand_SkipsSmallFiles(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "verified")
+	setRestoreVerifyTestCommand(t, `echo "$WALG_RESTORE_FILE_NAME" >> `+logFile)
+	verifyCommand := postgres.NewRestoreVerifyCommand(2, 4)
+	restoreVerifyTestFiles(t, verifyCommand, map[string]string{"/base/1/1259": "relation", "/PG_VERSION": "14"})
+
+	require.NoError(t, verifyCommand.VerifyFiles())
+
+	verified, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Equal(t, "/base/1/1259\n", string(verified))
+}
+
+func TestRestoreVerifyCommand_FailureReportsStderr(t *testing.T) {
+	setRestoreVerifyTestCommand(t, `if [ "$(cat "$WALG_RESTORE_FILE_PATH")" = corrupt ]; then `+
+		`echo "invalid page header in $WALG_RESTORE_FILE_NAME" >&2; exit 3; fi`)
+	verifyCommand := postgres.NewRestoreVerifyCommand(2, 0)
+	restoreVerifyTestFiles(t, verifyCommand, map[string]string{
+		"/base/1/1259": "relation", "/base/1/1260": "corrupt", "/PG_VERSION": "14",
+	})
+
+	err := verifyCommand.VerifyFiles()
+
+	require.IsType(t, postgres.RestoreVerifyCommandError{}, err)
+	assert.Contains(t, err.Error(), "/base/1/1260")
+	assert.Contains(t, err.Error(), "invalid page header in /base/1/1260")
+}
+
+func TestConfigureRestoreVerifyCommand(t *testing.T) {
+	verifyCommand, err := postgres.ConfigureRestoreVerifyCommand()
+	require.NoError(t, err)
+	assert.Nil(t, verifyCommand)
+
+	setRestoreVerifyTestCommand(t, "true")
+	viper.Set(internal.RestoreVerifyConcurrencySetting, 0)
+	defer viper.Set(internal.RestoreVerifyConcurrencySetting, 2)
+	_, err = postgres.ConfigureRestoreVerifyCommand()
+	assert.Error(t, err)
+}
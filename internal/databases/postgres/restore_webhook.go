@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	RestoreWebhookResultSuccess = "success"
+	RestoreWebhookResultFailure = "failure"
+)
+
+// RestoreWebhookPayload is the JSON body posted to the restore webhook
+type RestoreWebhookPayload struct {
+	BackupName      string  `json:"backup_name"`
+	Result          string  `json:"result"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	FileCount       int64   `json:"file_count"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// WebhookRestorePlugin posts the restore summary to the webhook URL when the restore finishes
+type WebhookRestorePlugin struct {
+	NopRestorePlugin
+	url     string
+	client  *http.Client
+	retries int
+	sleeper internal.Sleeper
+
+	fileCount int64
+}
+
+// NewWebhookRestorePlugin creates the plugin. Every request is limited by timeout
+// and failed requests are retried at most retries times.
+func NewWebhookRestorePlugin(url string, timeout time.Duration, retries int) *WebhookRestorePlugin {
+	return &WebhookRestorePlugin{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		sleeper: internal.NewExponentialSleeper(time.Second, 10*time.Second),
+	}
+}
+
+// ConfigureWebhookRestorePlugin creates the plugin from the settings, returns nil if the webhook URL is not set
+func ConfigureWebhookRestorePlugin() (*WebhookRestorePlugin, error) {
+	url := viper.GetString(internal.RestoreWebhookURLSetting)
+	if url == "" {
+		return nil, nil
+	}
+	timeout, err := internal.GetDurationSetting(internal.RestoreWebhookTimeoutSetting)
+	if err != nil {
+		return nil, err
+	}
+	retries := viper.GetInt(internal.RestoreWebhookRetriesSetting)
+	if retries < 0 {
+		return nil, errors.Errorf("%s should not be negative, got %d", internal.RestoreWebhookRetriesSetting, retries)
+	}
+	return NewWebhookRestorePlugin(url, timeout, retries), nil
+}
+
+func (plugin *WebhookRestorePlugin) OnFileComplete(RestoreFileInfo) {
+	atomic.AddInt64(&plugin.fileCount, 1)
+}
+
+func (plugin *WebhookRestorePlugin) OnRestoreFinish(info RestoreFinishInfo) {
+	payload := RestoreWebhookPayload{
+		BackupName:      info.BackupName,
+		Result:          RestoreWebhookResultSuccess,
+		DurationSeconds: info.Duration.Seconds(),
+		FileCount:       atomic.LoadInt64(&plugin.fileCount),
+	}
+	if info.Err != nil {
+		payload.Result = RestoreWebhookResultFailure
+		payload.Error = info.Err.Error()
+	}
+	err := plugin.send(payload)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to notify the restore webhook: %v\n", err)
+	}
+}
+
+func (plugin *WebhookRestorePlugin) send(payload RestoreWebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err = plugin.post(body)
+		if err == nil || attempt >= plugin.retries {
+			return err
+		}
+		tracelog.WarningLogger.Printf("Restore webhook attempt %d of %d failed: %v\n", attempt+1, plugin.retries+1, err)
+		plugin.sleeper.Sleep()
+	}
+}
+
+func (plugin *WebhookRestorePlugin) post(body []byte) error {
+	response, err := plugin.client.Post(plugin.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopSleeper struct{}
+
+func (nopSleeper) Sleep() {}
+
+func newTestWebhookServer(t *testing.T, failures int32, payloads chan<- RestoreWebhookPayload) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var payload RestoreWebhookPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestWebhookRestorePlugin_PostsSummary(t *testing.T) {
+	payloads := make(chan RestoreWebhookPayload, 1)
+	server, _ := newTestWebhookServer(t, 0, payloads)
+	plugin := NewWebhookRestorePlugin(server.URL, time.Second, 0)
+
+	plugin.OnFileComplete(RestoreFileInfo{Name: "/base/1/1259"})
+	plugin.OnFileComplete(RestoreFileInfo{Name: "/base/1/1260"})
+	plugin.OnRestoreFinish(RestoreFinishInfo{BackupName: "base_000000010000000000000002", Duration: 2 * time.Second})
+
+	payload := <-payloads
+	assert.Equal(t, RestoreWebhookPayload{
+		BackupName:      "base_000000010000000000000002",
+		Result:          RestoreWebhookResultSuccess,
+		DurationSeconds: 2,
+		FileCount:       2,
+	}, payload)
+}
+
+func TestWebhookRestorePlugin_RetriesOnFailure(t *testing.T) {
+	payloads := make(chan RestoreWebhookPayload, 1)
+	server, requests := newTestWebhookServer(t, 2, payloads)
+	plugin := NewWebhookRestorePlugin(server.URL, time.Second, 2)
+	plugin.sleeper = nopSleeper{}
+
+	plugin.OnRestoreFinish(RestoreFinishInfo{BackupName: "base_000000010000000000000002", Err: errors.New("boom")})
+
+	payload := <-payloads
+	assert.Equal(t, RestoreWebhookResultFailure, payload.Result)
+	assert.Equal(t, "boom", payload.Error)
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+}
+
+func TestWebhookRestorePlugin_RetriesAreBounded(t *testing.T) {
+	payloads := make(chan RestoreWebhookPayload, 1)
+	server, requests := newTestWebhookServer(t, 10, payloads)
+	plugin := NewWebhookRestorePlugin(server.URL, time.Second, 2)
+	plugin.sleeper = nopSleeper{}
+
+	plugin.OnRestoreFinish(RestoreFinishInfo{BackupName: "base_000000010000000000000002"})
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+	assert.Empty(t, payloads)
+}
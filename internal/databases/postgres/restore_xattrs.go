@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"archive/tar"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// paxXattrPrefix is the prefix of the PAX records which store the extended attributes of the tar entry
+const paxXattrPrefix = "SCHILY.xattr."
+
+// RestoreXattrs reapplies the extended attributes stored in the tar headers, e.g. the POSIX ACLs
+// and the SELinux labels, to the restored regular files and directories. If the platform or
+// the filesystem does not support the extended attributes, the restore continues with the warning.
+type RestoreXattrs struct {
+	mutex            sync.Mutex
+	warnedNotSupport bool
+}
+
+// ConfigureRestoreXattrs creates the extended attributes restore if WALG_RESTORE_XATTRS is enabled, returns nil otherwise
+func ConfigureRestoreXattrs() *RestoreXattrs {
+	if !viper.GetBool(internal.RestoreXattrsSetting) {
+		return nil
+	}
+	return &RestoreXattrs{}
+}
+
+// storedXattrs returns the extended attributes stored in the PAX records of the tar entry
+func storedXattrs(fileInfo *tar.Header) map[string]string {
+	var xattrs map[string]string
+	for key, value := range fileInfo.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string]string)
+		}
+		xattrs[strings.TrimPrefix(key, paxXattrPrefix)] = value
+	}
+	return xattrs
+}
+
+// apply sets the stored extended attributes of the regular file or directory on the restored path
+func (restoreXattrs *RestoreXattrs) apply(targetPath string, fileInfo *tar.Header) error {
+	if fileInfo.Typeflag == tar.TypeSymlink || fileInfo.Typeflag == tar.TypeLink {
+		return nil
+	}
+	xattrs := storedXattrs(fileInfo)
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := setXattr(targetPath, name, []byte(xattrs[name]))
+		if err == nil {
+			continue
+		}
+		if isXattrNotSupported(err) {
+			restoreXattrs.warnNotSupported(targetPath, err)
+			return nil
+		}
+		return errors.Wrapf(err, "Interpret: failed to set the extended attribute '%s' of %s", name, targetPath)
+	}
+	return nil
+}
+
+// warnNotSupported reports the first extended attribute which can't be set since it is not supported
+func (restoreXattrs *RestoreXattrs) warnNotSupported(targetPath string, err error) {
+	restoreXattrs.mutex.Lock()
+	defer restoreXattrs.mutex.Unlock()
+	if restoreXattrs.warnedNotSupport {
+		return
+	}
+	restoreXattrs.warnedNotSupport = true
+	tracelog.WarningLogger.Printf("The extended attributes are not restored, failed to set them on %s: %v\n",
+		targetPath, err)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package postgres
+
+import (
+	"github.com/pkg/errors"
+)
+
+var errXattrsNotSupported = errors.New("the extended attributes restore is supported on Linux only")
+
+func setXattr(path, name string, value []byte) error {
+	return errXattrsNotSupported
+}
+
+func isXattrNotSupported(err error) bool {
+	return errors.Is(err, errXattrsNotSupported)
+}
@@ -0,0 +1,19 @@
+//go:build linux
+// +build linux
+
+package postgres
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+func setXattr(path, name string, value []byte) error {
+	return syscall.Setxattr(path, name, value, 0)
+}
+
+// isXattrNotSupported checks if the filesystem does not support the extended attributes
+func isXattrNotSupported(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP)
+}
@@ -0,0 +1,35 @@
+//go:build linux
+// +build linux
+
+package postgres
+
+import (
+	"archive/tar"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpretRestoresXattrs(t *testing.T) {
+	dataDir := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithRestoreXattrs(&RestoreXattrs{}))
+
+	err := tarInterpreter.Interpret(strings.NewReader("14\n"), &tar.Header{Name: "PG_VERSION",
+		Typeflag: tar.TypeReg, Mode: 0600, Size: 3,
+		PAXRecords: map[string]string{"SCHILY.xattr.user.walg": "restored"}})
+	require.NoError(t, err)
+
+	value := make([]byte, 64)
+	size, err := syscall.Getxattr(filepath.Join(dataDir, "PG_VERSION"), "user.walg", value)
+	if err == syscall.ENOTSUP {
+		assert.True(t, tarInterpreter.xattrs.warnedNotSupport)
+		t.Skip("the filesystem does not support the extended attributes")
+	}
+	require.NoError(t, err)
+	assert.Equal(t, "restored", string(value[:size]))
+}
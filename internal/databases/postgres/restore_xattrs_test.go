@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoredXattrs(t *testing.T) {
+	xattrs := storedXattrs(&tar.Header{PAXRecords: map[string]string{
+		"SCHILY.xattr.security.selinux":        "system_u:object_r:postgresql_db_t:s0",
+		"SCHILY.xattr.system.posix_acl_access": "acl",
+		"path":                                 "base/1/1259",
+	}})
+
+	assert.Equal(t, map[string]string{
+		"security.selinux":        "system_u:object_r:postgresql_db_t:s0",
+		"system.posix_acl_access": "acl",
+	}, xattrs)
+	assert.Nil(t, storedXattrs(&tar.Header{}))
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/utility"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+type RestoredChecksumMismatchError struct {
+	error
+}
+
+func newRestoredChecksumMismatchError(name, targetPath string, expected internal.FileChecksum,
+	actual string) RestoredChecksumMismatchError {
+	return RestoredChecksumMismatchError{errors.Errorf(
+		"restored file '%s' (%s) is corrupted: %s checksum is %s, expected %s recorded in the backup",
+		name, targetPath, expected.Algorithm, actual, expected.Value)}
+}
+
+func (err RestoredChecksumMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func newFileChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case internal.Crc32cChecksumAlgorithm:
+		return crc32.New(crc32cTable), nil
+	default:
+		return nil, errors.Errorf("unknown file checksum algorithm '%s'", algorithm)
+	}
+}
+
+// fileChecksumReader computes the checksum of the file content read through it
+type fileChecksumReader struct {
+	io.ReadCloser
+	checksum hash.Hash
+}
+
+// newFileChecksumReader wraps the file reader to compute the CRC32C checksum of the packed content
+func newFileChecksumReader(fileReadCloser io.ReadCloser) *fileChecksumReader {
+	checksum := crc32.New(crc32cTable)
+	return &fileChecksumReader{
+		ReadCloser: &ioextensions.ReadCascadeCloser{
+			Reader: io.TeeReader(fileReadCloser, checksum),
+			Closer: fileReadCloser,
+		},
+		checksum: checksum,
+	}
+}
+
+func (reader *fileChecksumReader) fileChecksum() *internal.FileChecksum {
+	return &internal.FileChecksum{
+		Algorithm: internal.Crc32cChecksumAlgorithm,
+		Value:     hex.EncodeToString(reader.checksum.Sum(nil)),
+	}
+}
+
+// verifyRestoredChecksum compares the checksum of the materialized file with the one recorded
+// in its description. The files without the recorded checksum and the incremented ones are not verified.
+func (tarInterpreter *FileTarInterpreter) verifyRestoredChecksum(fileInfo *tar.Header, targetPath string) error {
+	if !tarInterpreter.verifyChecksums {
+		return nil
+	}
+	description, ok := tarInterpreter.FilesMetadata.Files[fileInfo.Name]
+	if !ok || description.Checksum == nil || description.IsIncremented {
+		tracelog.DebugLogger.Printf("'%s' has no recorded checksum, it is not verified\n", fileInfo.Name)
+		return nil
+	}
+	checksum, err := newFileChecksumHash(description.Checksum.Algorithm)
+	if err != nil {
+		tracelog.WarningLogger.Printf("'%s' is not verified: %v\n", fileInfo.Name, err)
+		return nil
+	}
+	file, err := os.Open(targetPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open the restored file '%s' to verify its checksum", targetPath)
+	}
+	defer utility.LoggedClose(file, "")
+	if _, err = io.Copy(checksum, file); err != nil {
+		return errors.Wrapf(err, "failed to read the restored file '%s' to verify its checksum", targetPath)
+	}
+	actual := hex.EncodeToString(checksum.Sum(nil))
+	if actual != description.Checksum.Value {
+		return newRestoredChecksumMismatchError(fileInfo.Name, targetPath, *description.Checksum, actual)
+	}
+	return nil
+}
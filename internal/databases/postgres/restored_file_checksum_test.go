@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func makeCrc32cTestChecksum(content string) *internal.FileChecksum {
+	checksum := crc32.Checksum([]byte(content), crc32.MakeTable(crc32.Castagnoli))
+	return &internal.FileChecksum{
+		Algorithm: internal.Crc32cChecksumAlgorithm,
+		Value:     hex.EncodeToString([]byte{byte(checksum >> 24), byte(checksum >> 16), byte(checksum >> 8), byte(checksum)}),
+	}
+}
+
+func TestVerifyRestoredChecksum(t *testing.T) {
+	viper.Set(internal.RestoredChecksumsSetting, true)
+	defer viper.Set(internal.RestoredChecksumsSetting, false)
+	folder := memory.NewFolder("", memory.NewStorage())
+	putDiffTestBackup(t, folder, diffTestFullBackup, `{"LSN":33554472,"FinishLSN":33554680}`, internal.BackupFileList{
+		"/PG_VERSION": {Checksum: makeCrc32cTestChecksum("14\n")}, "/base/1/1259": {}, PgControlPath: {},
+	},
+		testTarEntry{name: "/PG_VERSION", content: "14\n"},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestPage('a')})
+	putParallelDeltasTestPgControl(t, folder, diffTestFullBackup, "full")
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), diffTestFullBackup)
+	dbDataDirectory := t.TempDir()
+
+	err := deltaFetchRecursionOld(backup, folder, dbDataDirectory, nil, nil)
+
+	require.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(dbDataDirectory, "PG_VERSION"))
+	require.NoError(t, err)
+	assert.Equal(t, "14\n", string(content))
+}
+
+func TestVerifyRestoredChecksum_DetectsCorruptedMember(t *testing.T) {
+	viper.Set(internal.RestoredChecksumsSetting, true)
+	defer viper.Set(internal.RestoredChecksumsSetting, false)
+	filesMetadata := FilesMetadataDto{Files: internal.BackupFileList{
+		"/PG_VERSION": {Checksum: makeCrc32cTestChecksum("14\n")},
+	}}
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, filesMetadata, nil, false)
+
+	err := tarInterpreter.Interpret(strings.NewReader("15\n"),
+		&tar.Header{Name: "/PG_VERSION", Typeflag: tar.TypeReg, Size: 3})
+
+	var mismatchErr RestoredChecksumMismatchError
+	require.True(t, errors.As(err, &mismatchErr), "unexpected error: %v", err)
+	assert.Contains(t, mismatchErr.Error(), "'/PG_VERSION'")
+	assert.Contains(t, mismatchErr.Error(), makeCrc32cTestChecksum("14\n").Value)
+	assert.Contains(t, mismatchErr.Error(), makeCrc32cTestChecksum("15\n").Value)
+}
+
+func TestVerifyRestoredChecksum_IsDisabledByDefault(t *testing.T) {
+	filesMetadata := FilesMetadataDto{Files: internal.BackupFileList{
+		"/PG_VERSION": {Checksum: makeCrc32cTestChecksum("14\n")},
+	}}
+	tarInterpreter := NewFileTarInterpreter(t.TempDir(), BackupSentinelDto{}, filesMetadata, nil, false)
+
+	err := tarInterpreter.Interpret(strings.NewReader("15\n"),
+		&tar.Header{Name: "/PG_VERSION", Typeflag: tar.TypeReg, Size: 3})
+
+	assert.NoError(t, err)
+}
+
+func TestFileChecksumReader(t *testing.T) {
+	reader := newFileChecksumReader(io.NopCloser(strings.NewReader("content")))
+
+	_, err := io.Copy(io.Discard, reader)
+
+	require.NoError(t, err)
+	assert.Equal(t, makeCrc32cTestChecksum("content"), reader.fileChecksum())
+}
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+type RestoredPageChecksumError struct {
+	error
+}
+
+func newRestoredPageChecksumError(fileName string, corruptBlocks []uint32) RestoredPageChecksumError {
+	return RestoredPageChecksumError{errors.Errorf(
+		"restored file '%s' has %d pages failing the checksum verification: %v",
+		fileName, len(corruptBlocks), corruptBlocks)}
+}
+
+func (err RestoredPageChecksumError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// SuspectFile is the restored file which pages failed the checksum verification
+type SuspectFile struct {
+	// Name is the file path relative to the data directory
+	Name          string
+	CorruptBlocks []uint32
+}
+
+// RestoredPageVerifier verifies the page checksums of the restored relation files.
+// In the strict mode the first corrupt file fails the restore. In the forensic mode
+// the corrupt files are kept as is, reported as warnings and collected as suspect files.
+type RestoredPageVerifier struct {
+	forensic     bool
+	suspectFiles []SuspectFile
+}
+
+func NewRestoredPageVerifier(forensic bool) *RestoredPageVerifier {
+	return &RestoredPageVerifier{forensic: forensic}
+}
+
+// ConfigureRestoredPageVerifier returns nil if the page verification is disabled.
+// The forensic mode always enables the verification.
+func ConfigureRestoredPageVerifier(forensic bool) *RestoredPageVerifier {
+	if !forensic && !viper.GetBool(internal.VerifyRestoredPagesSetting) {
+		return nil
+	}
+	return NewRestoredPageVerifier(forensic)
+}
+
+// GetSuspectFiles returns the files which failed the verification in the forensic mode, sorted by name
+func (verifier *RestoredPageVerifier) GetSuspectFiles() []SuspectFile {
+	return verifier.suspectFiles
+}
+
+// VerifyDataDirectory verifies the page checksums of all the relation files in the data directory and tablespaces.
+// Pages without checksums, e.g. if the checksums are disabled in the cluster, are not verified. The corrupt pages
+// with LSN at or after the backup start LSN are skipped: they could be torn by the concurrent writes while
+// the backup was taken, and WAL replay restores them from the full page images. Zero backupStartLSN skips none.
+func (verifier *RestoredPageVerifier) VerifyDataDirectory(dbDataDirectory string, backupStartLSN uint64) error {
+	segmentSizes, err := getRelationSegmentSizes(dbDataDirectory)
+	if err != nil {
+		return err
+	}
+	fileNames := make([]string, 0, len(segmentSizes))
+	for fileName := range segmentSizes {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	verifier.suspectFiles = nil
+	for _, fileName := range fileNames {
+		corruptBlocks, err := verifyRestoredPagedFile(filepath.Join(dbDataDirectory, fileName), backupStartLSN)
+		if err != nil {
+			return errors.Wrapf(err, "failed to verify the pages of '%s'", fileName)
+		}
+		if len(corruptBlocks) == 0 {
+			continue
+		}
+		if !verifier.forensic {
+			return newRestoredPageChecksumError(fileName, corruptBlocks)
+		}
+		verifier.suspectFiles = append(verifier.suspectFiles, SuspectFile{Name: fileName, CorruptBlocks: corruptBlocks})
+	}
+	verifier.logReport(len(fileNames))
+	return nil
+}
+
+func (verifier *RestoredPageVerifier) logReport(verifiedFileCount int) {
+	if len(verifier.suspectFiles) == 0 {
+		tracelog.InfoLogger.Printf("Verified the page checksums of %d restored files, no corruption found\n",
+			verifiedFileCount)
+		return
+	}
+	tracelog.WarningLogger.Printf("Forensic restore: %d of %d restored files failed the page checksum verification "+
+		"and may contain corrupt data:\n", len(verifier.suspectFiles), verifiedFileCount)
+	for _, file := range verifier.suspectFiles {
+		tracelog.WarningLogger.Printf("  %s: %d corrupt pages %v\n", file.Name, len(file.CorruptBlocks), file.CorruptBlocks)
+	}
+}
+
+func verifyRestoredPagedFile(filePath string, backupStartLSN uint64) ([]uint32, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(file, "")
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	corruptBlocks, err := VerifyPagedFileBase(filePath, fileInfo, file)
+	if err != nil || backupStartLSN == 0 {
+		return corruptBlocks, err
+	}
+	return skipPagesChangedSinceBackupStart(file, corruptBlocks, backupStartLSN)
+}
+
+// skipPagesChangedSinceBackupStart returns the corrupt blocks with LSN before the backup start,
+// the later ones are restored by WAL replay
+func skipPagesChangedSinceBackupStart(file *os.File, corruptBlocks []uint32, backupStartLSN uint64) ([]uint32, error) {
+	keptBlocks := make([]uint32, 0, len(corruptBlocks))
+	for _, blockNo := range corruptBlocks {
+		header, err := parsePostgresPageHeader(io.NewSectionReader(file, int64(blockNo)*DatabasePageSize, headerSize))
+		if err != nil {
+			return nil, err
+		}
+		if header.lsn() >= backupStartLSN {
+			tracelog.DebugLogger.Printf("Page %d of '%s' is changed since the backup start, WAL replay restores it\n",
+				blockNo, file.Name())
+			continue
+		}
+		keptBlocks = append(keptBlocks, blockNo)
+	}
+	return keptBlocks, nil
+}
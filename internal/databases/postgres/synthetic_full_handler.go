@@ -0,0 +1,396 @@
+package postgres
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	syntheticChainDirectory       = "chain"
+	syntheticVerifyDirectory      = "verify"
+	syntheticTablespacesDirectory = "_tablespaces"
+	// maxReportedSyntheticMismatches bounds the number of the differences listed in the verification error
+	maxReportedSyntheticMismatches = 10
+)
+
+type SyntheticFullMismatchError struct {
+	error
+}
+
+func newSyntheticFullMismatchError(backupName string, mismatches []string) SyntheticFullMismatchError {
+	return SyntheticFullMismatchError{errors.Errorf(
+		"synthetic full backup '%s' is not restore-identical to its increment chain: %v", backupName, mismatches)}
+}
+
+func (err SyntheticFullMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// restoredFileState describes the single restored file for the comparison of the restored data directories
+type restoredFileState struct {
+	mode   os.FileMode
+	size   int64
+	digest string
+}
+
+// HandleSyntheticFull is invoked to perform wal-g backup-synthesize
+func HandleSyntheticFull(uploader *internal.Uploader, backupSelector internal.BackupSelector, workDirectory string) {
+	backupName, err := backupSelector.Select(uploader.Folder())
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	syntheticName, err := CreateSyntheticFull(uploader, internal.ConfigureCrypter(), backupName, workDirectory)
+	tracelog.ErrorLogger.FatalfOnError("Failed to create the synthetic full backup: %v\n", err)
+	tracelog.InfoLogger.Printf("Wrote synthetic full backup with name %s\n", syntheticName)
+}
+
+// CreateSyntheticFull reconstructs the increment chain of the backup in the work directory and uploads
+// the result as the new full backup, which does not depend on any other backup. The uploaded backup is
+// restored back into the work directory and compared with the reconstructed chain, the sentinel is
+// uploaded only if both restored data directories are identical, so the backup never becomes visible
+// unverified. The work directory must be empty and have the space for two copies of the data directory.
+func CreateSyntheticFull(uploader *internal.Uploader, crypter crypto.Crypter,
+	backupName, workDirectory string) (string, error) {
+	rootFolder := uploader.Folder()
+	baseBackupFolder := rootFolder.GetSubFolder(utility.BaseBackupPath)
+	backup := NewBackup(baseBackupFolder, backupName)
+	sentinelDto, filesMeta, err := backup.GetSentinelAndFilesMetadata()
+	if err != nil {
+		return "", err
+	}
+	if !sentinelDto.IsIncremental() {
+		return "", errors.Errorf("backup '%s' is already a full backup", backupName)
+	}
+	if sentinelDto.BackupStartLSN == nil || sentinelDto.BackupFinishLSN == nil {
+		return "", errors.Errorf("backup '%s' does not store its LSN range", backupName)
+	}
+	brokenLink, err := VerifyBackupChain(baseBackupFolder, backupName)
+	if err != nil {
+		return "", err
+	}
+	if brokenLink != nil {
+		return "", errors.Errorf("increment chain of backup '%s' is broken at '%s': %s",
+			backupName, brokenLink.BrokenAt, brokenLink.Reason)
+	}
+
+	syntheticName := utility.BackupNamePrefix + utility.StripWalFileName(backupName)
+	syntheticBackup := NewBackup(baseBackupFolder, syntheticName)
+	exists, err := syntheticBackup.SentinelExists()
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", errors.Errorf("backup '%s' already exists in storage", syntheticName)
+	}
+	isEmpty, err := isDirectoryEmpty(workDirectory)
+	if err != nil {
+		return "", err
+	}
+	if !isEmpty {
+		return "", errors.Errorf("work directory '%s' is not empty", workDirectory)
+	}
+	defer removeSyntheticWorkDirectory(workDirectory)
+
+	tracelog.InfoLogger.Printf("Reconstructing the increment chain of backup %s\n", backupName)
+	chainDirectory := filepath.Join(workDirectory, syntheticChainDirectory)
+	filesToUnwrap, err := backup.GetFilesToUnwrap("")
+	if err != nil {
+		return "", err
+	}
+	err = deltaFetchRecursionOld(backup, rootFolder, chainDirectory,
+		makeSyntheticTablespaceSpec(sentinelDto.TablespaceSpec, chainDirectory), filesToUnwrap)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to reconstruct the increment chain of backup '%s'", backupName)
+	}
+	err = restoreModificationTimes(chainDirectory, filesMeta.Files)
+	if err != nil {
+		return "", err
+	}
+
+	tracelog.InfoLogger.Printf("Uploading synthetic full backup %s\n", syntheticName)
+	syntheticDto, syntheticFilesMeta, err := uploadSyntheticFullTars(uploader, crypter, syntheticName,
+		chainDirectory, sentinelDto)
+	if err == nil {
+		tracelog.InfoLogger.Printf("Verifying synthetic full backup %s\n", syntheticName)
+		err = verifySyntheticFull(syntheticBackup, syntheticDto, syntheticFilesMeta,
+			chainDirectory, filepath.Join(workDirectory, syntheticVerifyDirectory))
+	}
+	if err == nil {
+		err = uploadSyntheticFullMetadata(uploader, backup, syntheticName, syntheticDto, syntheticFilesMeta)
+	}
+	if err != nil {
+		deleteErr := storage.DeleteObjectsWhere(baseBackupFolder.GetSubFolder(syntheticName), true,
+			func(storage.Object) bool { return true })
+		if deleteErr != nil {
+			tracelog.WarningLogger.Printf("Failed to delete the partially uploaded backup '%s': %v\n",
+				syntheticName, deleteErr)
+		}
+		return "", err
+	}
+	return syntheticName, nil
+}
+
+// makeSyntheticTablespaceSpec relocates the tablespaces of the backup next to the data directory restored
+// in the work directory, so the restore does not touch their original locations
+func makeSyntheticTablespaceSpec(spec *TablespaceSpec, dataDirectory string) *TablespaceSpec {
+	relocatedSpec := NewTablespaceSpec(dataDirectory)
+	if spec != nil {
+		for _, name := range spec.TablespaceNames() {
+			relocatedSpec.addTablespace(name, filepath.Join(dataDirectory+syntheticTablespacesDirectory, name))
+		}
+	}
+	return &relocatedSpec
+}
+
+// restoreModificationTimes sets the modification times of the reconstructed files to the ones recorded
+// in the files metadata, so the increments from the synthetic full skip the same unchanged files
+// as the increments from the original chain
+func restoreModificationTimes(dataDirectory string, files internal.BackupFileList) error {
+	for name, description := range files {
+		if description.MTime.IsZero() {
+			continue
+		}
+		err := os.Chtimes(filepath.Join(dataDirectory, name), description.MTime, description.MTime)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to set the modification time of '%s'", name)
+		}
+	}
+	return nil
+}
+
+// uploadSyntheticFullTars packs the reconstructed data directory as the full backup push does
+// and returns its sentinel and files metadata, which are not uploaded yet
+func uploadSyntheticFullTars(uploader *internal.Uploader, crypter crypto.Crypter, syntheticName,
+	dataDirectory string, chainSentinelDto BackupSentinelDto) (BackupSentinelDto, FilesMetadataDto, error) {
+	baseBackupUploader := uploader.Clone()
+	baseBackupUploader.ChangeDirectory(utility.BaseBackupPath)
+	bundle := NewBundle(dataDirectory, crypter, nil, nil, false, viper.GetInt64(internal.TarSizeThresholdSetting))
+	tarBallMaker := internal.NewStorageTarBallMaker(syntheticName, baseBackupUploader)
+	err := bundle.StartQueue(tarBallMaker)
+	if err != nil {
+		return BackupSentinelDto{}, FilesMetadataDto{}, err
+	}
+	tarFileSets := NewRegularTarFileSets()
+	err = bundle.SetupComposer(NewRegularTarBallComposerMaker(NewTarBallFilePackerOptions(false, false),
+		&RegularBundleFiles{}, tarFileSets))
+	if err != nil {
+		return BackupSentinelDto{}, FilesMetadataDto{}, err
+	}
+	err = filepath.Walk(dataDirectory, bundle.HandleWalkedFSObject)
+	if err != nil {
+		return BackupSentinelDto{}, FilesMetadataDto{}, err
+	}
+	if bundle.Sentinel == nil {
+		return BackupSentinelDto{}, FilesMetadataDto{}, newPgControlNotFoundError()
+	}
+	packedFileSets, err := bundle.PackTarballs()
+	if err != nil {
+		return BackupSentinelDto{}, FilesMetadataDto{}, err
+	}
+	err = bundle.FinishQueue()
+	if err != nil {
+		return BackupSentinelDto{}, FilesMetadataDto{}, err
+	}
+	err = bundle.UploadPgControl(baseBackupUploader.Compressor.FileExtension())
+	if err != nil {
+		return BackupSentinelDto{}, FilesMetadataDto{}, err
+	}
+	baseBackupUploader.Finish()
+	if baseBackupUploader.Failed.Load().(bool) {
+		return BackupSentinelDto{}, FilesMetadataDto{}, errors.Errorf("failed to upload backup '%s'", syntheticName)
+	}
+	compressedSize, err := baseBackupUploader.UploadedDataSize()
+	if err != nil {
+		return BackupSentinelDto{}, FilesMetadataDto{}, err
+	}
+
+	sentinelDto := chainSentinelDto
+	sentinelDto.IncrementFrom = nil
+	sentinelDto.IncrementFromLSN = nil
+	sentinelDto.IncrementFullName = nil
+	sentinelDto.IncrementCount = nil
+	sentinelDto.FilesMetadataDisabled = false
+	sentinelDto.UncompressedSize = atomic.LoadInt64(bundle.TarBallQueue.AllTarballsSize)
+	sentinelDto.CompressedSize = compressedSize
+	sentinelDto.TarChecksums = tarBallMaker.StreamChecksums()
+	var filesMeta FilesMetadataDto
+	filesMeta.setFiles(bundle.GetFiles())
+	filesMeta.TarFileSets = packedFileSets.Get()
+	return sentinelDto, filesMeta, nil
+}
+
+// verifySyntheticFull restores the uploaded synthetic full and compares it with the reconstructed chain
+func verifySyntheticFull(backup Backup, sentinelDto BackupSentinelDto, filesMeta FilesMetadataDto,
+	chainDirectory, verifyDirectory string) error {
+	verifySentinelDto := sentinelDto
+	verifySentinelDto.TablespaceSpec = makeSyntheticTablespaceSpec(sentinelDto.TablespaceSpec, verifyDirectory)
+	err := backup.unwrapToEmptyDirectory(verifyDirectory, verifySentinelDto, filesMeta, UnwrapAll, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to restore synthetic full backup '%s'", backup.Name)
+	}
+
+	expected, err := collectRestoredFileStates(chainDirectory)
+	if err != nil {
+		return err
+	}
+	actual, err := collectRestoredFileStates(verifyDirectory)
+	if err != nil {
+		return err
+	}
+	mismatches := compareRestoredFileStates(expected, actual)
+	if len(mismatches) > 0 {
+		return newSyntheticFullMismatchError(backup.Name, mismatches)
+	}
+	tracelog.InfoLogger.Printf("Synthetic full backup %s is restore-identical to the increment chain, %d entries compared\n",
+		backup.Name, len(expected))
+	return nil
+}
+
+// collectRestoredFileStates describes every entry of the restored data directory by its relative path,
+// the tablespace symlinks are followed, so the relocated tablespaces are compared by their contents
+func collectRestoredFileStates(dataDirectory string) (map[string]restoredFileState, error) {
+	states := make(map[string]restoredFileState)
+	err := collectRestoredTreeStates(dataDirectory, "", states)
+	return states, errors.Wrapf(err, "failed to read the restored data directory '%s'", dataDirectory)
+}
+
+func collectRestoredTreeStates(root, prefix string, states map[string]restoredFileState) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(prefix, relativePath))
+		if info.Mode()&os.ModeSymlink != 0 {
+			targetInfo, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if targetInfo.IsDir() {
+				return collectRestoredTreeStates(path+string(filepath.Separator), name, states)
+			}
+			info = targetInfo
+		}
+		state := restoredFileState{mode: info.Mode() & (os.ModeType | os.ModePerm)}
+		if info.Mode().IsRegular() {
+			state.size = info.Size()
+			state.digest, err = digestRestoredFile(path)
+			if err != nil {
+				return err
+			}
+		}
+		states[name] = state
+		return nil
+	})
+}
+
+func digestRestoredFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer utility.LoggedClose(file, "")
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func compareRestoredFileStates(expected, actual map[string]restoredFileState) []string {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	mismatches := make([]string, 0)
+	for _, name := range names {
+		expectedState, inExpected := expected[name]
+		actualState, inActual := actual[name]
+		switch {
+		case !inActual:
+			mismatches = append(mismatches, fmt.Sprintf("'%s' is missing", name))
+		case !inExpected:
+			mismatches = append(mismatches, fmt.Sprintf("'%s' is unexpected", name))
+		case expectedState.mode != actualState.mode:
+			mismatches = append(mismatches, fmt.Sprintf("'%s' has mode %v, expected %v",
+				name, actualState.mode, expectedState.mode))
+		case expectedState != actualState:
+			mismatches = append(mismatches, fmt.Sprintf("'%s' content differs", name))
+		}
+		if len(mismatches) == maxReportedSyntheticMismatches {
+			break
+		}
+	}
+	return mismatches
+}
+
+// uploadSyntheticFullMetadata uploads the metadata and, the last, the sentinel of the verified synthetic full
+func uploadSyntheticFullMetadata(uploader *internal.Uploader, chainBackup Backup, syntheticName string,
+	sentinelDto BackupSentinelDto, filesMeta FilesMetadataDto) error {
+	meta, err := chainBackup.FetchMeta()
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to fetch the metadata of backup '%s', using the current time: %v\n",
+			chainBackup.Name, err)
+		meta = NewExtendedMetadataDto(false, "", utility.TimeNowCrossPlatformUTC(), sentinelDto)
+	}
+	meta.IsPermanent = false
+	meta.UncompressedSize = sentinelDto.UncompressedSize
+	meta.CompressedSize = sentinelDto.CompressedSize
+
+	baseBackupFolder := uploader.Folder().GetSubFolder(utility.BaseBackupPath)
+	metaBody, err := json.Marshal(meta)
+	if err != nil {
+		return internal.NewSentinelMarshallingError(utility.MetadataFileName, err)
+	}
+	err = baseBackupFolder.PutObject(storage.JoinPath(syntheticName, utility.MetadataFileName), bytes.NewReader(metaBody))
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload the metadata of backup '%s'", syntheticName)
+	}
+	filesMetaBody, err := json.Marshal(filesMeta)
+	if err != nil {
+		return err
+	}
+	err = baseBackupFolder.PutObject(getFilesMetadataPath(syntheticName), bytes.NewReader(filesMetaBody))
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload the files metadata of backup '%s'", syntheticName)
+	}
+	return internal.UploadDto(baseBackupFolder, NewBackupSentinelDtoV2(sentinelDto, meta),
+		internal.SentinelNameFromBackup(syntheticName))
+}
+
+// removeSyntheticWorkDirectory removes the reconstructed data directories, which are not needed after the upload
+func removeSyntheticWorkDirectory(workDirectory string) {
+	for _, name := range []string{syntheticChainDirectory, syntheticVerifyDirectory} {
+		for _, directory := range []string{name, name + syntheticTablespacesDirectory} {
+			err := os.RemoveAll(filepath.Join(workDirectory, directory))
+			if err != nil {
+				tracelog.WarningLogger.Printf("Failed to remove '%s': %v\n", directory, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func putSyntheticTestChain(t *testing.T) *memory.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	putDiffTestBackup(t, folder, diffTestFullBackup, `{"LSN":33554472,"FinishLSN":33554680}`, internal.BackupFileList{
+		"/base/1/1259": {}, "/base/1/1260": {}, "/PG_VERSION": {}, PgControlPath: {},
+	},
+		testTarEntry{name: "/base", isDir: true},
+		testTarEntry{name: "/base/1", isDir: true},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestPage('a') + makeDiffTestPage('b') + makeDiffTestPage('c')},
+		testTarEntry{name: "/base/1/1260", content: makeDiffTestPage('d')},
+		testTarEntry{name: "/PG_VERSION", content: "14\n"})
+	putParallelDeltasTestPgControl(t, folder, diffTestFullBackup, "full")
+	putDiffTestBackup(t, folder, diffTestDeltaBackup,
+		`{"LSN":67108904,"FinishLSN":67109112,"DeltaFrom":"`+diffTestFullBackup+`","DeltaLSN":33554472,`+
+			`"DeltaFullName":"`+diffTestFullBackup+`","DeltaCount":1,"PgVersion":140005}`,
+		internal.BackupFileList{
+			"/base/1/1259": {IsIncremented: true}, "/base/1/1260": {IsSkipped: true}, "/PG_VERSION": {IsSkipped: true},
+			PgControlPath: {},
+		},
+		testTarEntry{name: "/base/1/1259", content: makeDiffTestIncrement(uint64(3*DatabasePageSize),
+			map[uint32]string{1: makeDiffTestPage('B')})})
+	putParallelDeltasTestPgControl(t, folder, diffTestDeltaBackup, "delta")
+	return folder
+}
+
+func TestCreateSyntheticFull(t *testing.T) {
+	folder := putSyntheticTestChain(t)
+	uploader := internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder)
+	workDirectory := t.TempDir()
+
+	syntheticName, err := CreateSyntheticFull(uploader, nil, diffTestDeltaBackup, workDirectory)
+
+	require.NoError(t, err)
+	assert.Equal(t, "base_000000010000000000000004", syntheticName)
+	isEmpty, err := isDirectoryEmpty(workDirectory)
+	require.NoError(t, err)
+	assert.True(t, isEmpty)
+
+	synthetic := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), syntheticName)
+	sentinel, filesMeta, err := synthetic.GetSentinelAndFilesMetadata()
+	require.NoError(t, err)
+	assert.False(t, sentinel.IsIncremental())
+	assert.Equal(t, uint64(67108904), *sentinel.BackupStartLSN)
+	assert.Equal(t, 140005, sentinel.PgVersion)
+	assert.False(t, filesMeta.Files["/base/1/1259"].IsIncremented)
+	assert.False(t, filesMeta.Files["/base/1/1260"].IsSkipped)
+
+	dbDataDirectory := t.TempDir()
+	filesToUnwrap, err := synthetic.GetFilesToUnwrap("")
+	require.NoError(t, err)
+	require.NoError(t, deltaFetchRecursionOld(synthetic, folder, dbDataDirectory, nil, filesToUnwrap))
+	for name, expected := range map[string]string{
+		"base/1/1259":       makeDiffTestPage('a') + makeDiffTestPage('B') + makeDiffTestPage('c'),
+		"base/1/1260":       makeDiffTestPage('d'),
+		"PG_VERSION":        "14\n",
+		"global/pg_control": "delta",
+	} {
+		content, err := os.ReadFile(filepath.Join(dbDataDirectory, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content), name)
+	}
+}
+
+func TestCreateSyntheticFull_RejectsFullBackup(t *testing.T) {
+	folder := putSyntheticTestChain(t)
+	uploader := internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder)
+
+	_, err := CreateSyntheticFull(uploader, nil, diffTestFullBackup, t.TempDir())
+
+	assert.Error(t, err)
+}
+
+func TestCompareRestoredFileStates(t *testing.T) {
+	expected := map[string]restoredFileState{
+		"base":         {mode: os.ModeDir | 0700},
+		"base/1/1259":  {mode: 0600, size: 3, digest: "a"},
+		"global/1262":  {mode: 0600, size: 3, digest: "b"},
+		"pg_tblspc/16": {mode: os.ModeDir | 0700},
+	}
+	actual := map[string]restoredFileState{
+		"base":         {mode: os.ModeDir | 0755},
+		"base/1/1259":  {mode: 0600, size: 3, digest: "c"},
+		"pg_tblspc/16": {mode: os.ModeDir | 0700},
+		"PG_VERSION":   {mode: 0600, size: 3, digest: "d"},
+	}
+
+	assert.Equal(t, []string{
+		"'PG_VERSION' is unexpected",
+		"'base' has mode drwxr-xr-x, expected drwx------",
+		"'base/1/1259' content differs",
+		"'global/1262' is missing",
+	}, compareRestoredFileStates(expected, actual))
+}
@@ -0,0 +1,174 @@
+package postgres
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// The policies of handling the tablespace which is already mapped to the other location in the restore target
+const (
+	// TablespaceCollisionFail fails the restore before anything is written
+	TablespaceCollisionFail = "fail"
+	// TablespaceCollisionRemap restores the tablespace to the location it is already mapped to
+	TablespaceCollisionRemap = "remap"
+	// TablespaceCollisionOverwrite replaces the existing tablespace symlink with the one to the backup location
+	TablespaceCollisionOverwrite = "overwrite"
+)
+
+// TablespaceCollision is the tablespace whose OID is already mapped to the other location
+type TablespaceCollision struct {
+	Name             string
+	BackupLocation   string
+	ExistingLocation string
+	// SymlinkExists is set if the conflicting symlink exists in pg_tblspc rather than only in the existing map
+	SymlinkExists bool
+}
+
+type TablespaceCollisionError struct {
+	error
+}
+
+func newTablespaceCollisionError(collisions []TablespaceCollision) TablespaceCollisionError {
+	descriptions := make([]string, 0, len(collisions))
+	for _, collision := range collisions {
+		descriptions = append(descriptions, collision.String())
+	}
+	return TablespaceCollisionError{errors.Errorf("%d tablespaces are already mapped to the other locations: %s, "+
+		"set %s to %s or %s to restore them anyway", len(collisions), strings.Join(descriptions, "; "),
+		internal.TablespaceCollisionSetting, TablespaceCollisionRemap, TablespaceCollisionOverwrite)}
+}
+
+func (err TablespaceCollisionError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func (collision TablespaceCollision) String() string {
+	return fmt.Sprintf("tablespace %s is restored to '%s', but is mapped to '%s'",
+		collision.Name, collision.BackupLocation, collision.ExistingLocation)
+}
+
+// ParseExistingTablespaces parses the comma-separated list of oid=/path pairs of the tablespaces
+// which already exist in the restore target, e.g. "16385=/mnt/ts1,16390=/mnt/ts2"
+func ParseExistingTablespaces(value string) (map[string]string, error) {
+	tablespaces := make(map[string]string)
+	if strings.TrimSpace(value) == "" {
+		return tablespaces, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		oid, location, found := cutString(strings.TrimSpace(pair), "=")
+		if !found || location == "" {
+			return nil, errors.Errorf("invalid tablespace mapping '%s', expected oid=/path", pair)
+		}
+		if _, err := strconv.ParseUint(oid, 10, 32); err != nil {
+			return nil, errors.Errorf("invalid tablespace oid '%s'", oid)
+		}
+		if _, ok := tablespaces[oid]; ok {
+			return nil, errors.Errorf("tablespace %s is mapped more than once", oid)
+		}
+		tablespaces[oid] = utility.NormalizePath(location)
+	}
+	return tablespaces, nil
+}
+
+// findTablespaceCollisions compares the tablespace locations of the spec with the existing tablespace map
+// and the symlinks already existing in pg_tblspc. The symlink which already points to the backup location
+// is not a collision.
+func findTablespaceCollisions(spec TablespaceSpec, basePrefix string,
+	existingTablespaces map[string]string) ([]TablespaceCollision, error) {
+	collisions := make([]TablespaceCollision, 0)
+	for _, name := range spec.TablespaceNames() {
+		location, _ := spec.location(name)
+		existingLocation, symlinkExists, err := readTablespaceSymlink(filepath.Join(basePrefix, location.Symlink))
+		if err != nil {
+			return nil, err
+		}
+		if !symlinkExists {
+			existingLocation = existingTablespaces[name]
+		}
+		if existingLocation == "" || existingLocation == location.Location {
+			continue
+		}
+		collisions = append(collisions, TablespaceCollision{Name: name, BackupLocation: location.Location,
+			ExistingLocation: existingLocation, SymlinkExists: symlinkExists})
+	}
+	return collisions, nil
+}
+
+// readTablespaceSymlink returns the target of the existing tablespace symlink
+func readTablespaceSymlink(symlinkPath string) (string, bool, error) {
+	fileInfo, err := os.Lstat(symlinkPath)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if fileInfo.Mode()&os.ModeSymlink == 0 {
+		return "", false, errors.Errorf("'%s' already exists and is not a tablespace symlink", symlinkPath)
+	}
+	target, err := os.Readlink(symlinkPath)
+	if err != nil {
+		return "", false, err
+	}
+	return utility.NormalizePath(target), true, nil
+}
+
+// resolveTablespaceCollisions reports all the collisions and returns the locations to restore the
+// tablespaces to according to the WALG_RESTORE_TABLESPACE_COLLISION policy
+func resolveTablespaceCollisions(spec TablespaceSpec, basePrefix string) (map[string]string, error) {
+	existingTablespaces, err := ParseExistingTablespaces(viper.GetString(internal.RestoreExistingTablespacesSetting))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", internal.RestoreExistingTablespacesSetting)
+	}
+	policy := viper.GetString(internal.TablespaceCollisionSetting)
+	switch policy {
+	case "":
+		policy = TablespaceCollisionFail
+	case TablespaceCollisionFail, TablespaceCollisionRemap, TablespaceCollisionOverwrite:
+	default:
+		return nil, errors.Errorf("unknown %s '%s', expected one of %s, %s, %s", internal.TablespaceCollisionSetting,
+			policy, TablespaceCollisionFail, TablespaceCollisionRemap, TablespaceCollisionOverwrite)
+	}
+	collisions, err := findTablespaceCollisions(spec, basePrefix, existingTablespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make(map[string]string)
+	for _, name := range spec.TablespaceNames() {
+		location, _ := spec.location(name)
+		locations[name] = location.Location
+	}
+	if len(collisions) == 0 {
+		return locations, nil
+	}
+	if policy == TablespaceCollisionFail {
+		return nil, newTablespaceCollisionError(collisions)
+	}
+	for _, collision := range collisions {
+		tracelog.WarningLogger.Printf("Tablespace collision: %s, the tablespace is restored with the %s policy\n",
+			collision, policy)
+	}
+	for _, collision := range collisions {
+		if policy == TablespaceCollisionRemap {
+			locations[collision.Name] = collision.ExistingLocation
+			continue
+		}
+		if collision.SymlinkExists {
+			location, _ := spec.location(collision.Name)
+			if err := os.Remove(filepath.Join(basePrefix, location.Symlink)); err != nil {
+				return nil, errors.Wrapf(err, "failed to remove the existing symlink of tablespace %s", collision.Name)
+			}
+		}
+	}
+	return locations, nil
+}
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestParseExistingTablespaces(t *testing.T) {
+	tablespaces, err := ParseExistingTablespaces(" 16385=/mnt/ts1, 16390=/mnt/ts2/")
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"16385": "/mnt/ts1", "16390": "/mnt/ts2"}, tablespaces)
+	for _, value := range []string{"16385", "16385=", "ts=/mnt/ts1", "16385=/mnt/ts1,16385=/mnt/ts2"} {
+		_, err := ParseExistingTablespaces(value)
+		assert.Error(t, err, value)
+	}
+}
+
+type tablespaceCollisionTest struct {
+	dataDir        string
+	backupLocation string
+	otherLocation  string
+	symlinkPath    string
+	spec           TablespaceSpec
+}
+
+func newTablespaceCollisionTest(t *testing.T, policy, existingTablespaces string) tablespaceCollisionTest {
+	viper.Set(internal.TablespaceCollisionSetting, policy)
+	viper.Set(internal.RestoreExistingTablespacesSetting, existingTablespaces)
+	t.Cleanup(func() {
+		viper.Set(internal.TablespaceCollisionSetting, TablespaceCollisionFail)
+		viper.Set(internal.RestoreExistingTablespacesSetting, "")
+	})
+	root := t.TempDir()
+	test := tablespaceCollisionTest{
+		dataDir:        filepath.Join(root, "data"),
+		backupLocation: filepath.Join(root, "ts_backup"),
+		otherLocation:  filepath.Join(root, "ts_other"),
+	}
+	test.symlinkPath = filepath.Join(test.dataDir, TablespaceFolder, "16385")
+	test.spec = NewTablespaceSpec(test.dataDir)
+	test.spec.addTablespace("16385", test.backupLocation)
+	return test
+}
+
+func (test tablespaceCollisionTest) createExistingSymlink(t *testing.T) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(test.symlinkPath), 0700))
+	require.NoError(t, os.Symlink(test.otherLocation, test.symlinkPath))
+}
+
+func (test tablespaceCollisionTest) requireSymlinkTarget(t *testing.T, expected string) {
+	target, err := os.Readlink(test.symlinkPath)
+	require.NoError(t, err)
+	assert.Equal(t, expected, target)
+}
+
+func TestSetTablespacePaths_FailsOnCollision(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionFail, "")
+	test.createExistingSymlink(t)
+
+	err := setTablespacePaths(test.spec)
+
+	require.IsType(t, TablespaceCollisionError{}, err)
+	assert.Contains(t, err.Error(), test.otherLocation)
+	test.requireSymlinkTarget(t, test.otherLocation)
+}
+
+func TestSetTablespacePaths_FailsOnExistingMapCollision(t *testing.T) {
+	test := newTablespaceCollisionTest(t, "", "16385=/mnt/ts1")
+
+	err := setTablespacePaths(test.spec)
+
+	require.IsType(t, TablespaceCollisionError{}, err)
+	_, err = os.Lstat(test.symlinkPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSetTablespacePaths_RemapsOnCollision(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionRemap, "")
+	test.createExistingSymlink(t)
+
+	require.NoError(t, setTablespacePaths(test.spec))
+
+	test.requireSymlinkTarget(t, test.otherLocation)
+	_, err := os.Stat(test.otherLocation)
+	assert.NoError(t, err)
+}
+
+func TestSetTablespacePaths_RemapsToExistingMap(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionRemap, "")
+	viper.Set(internal.RestoreExistingTablespacesSetting, "16385="+test.otherLocation)
+
+	require.NoError(t, setTablespacePaths(test.spec))
+
+	test.requireSymlinkTarget(t, test.otherLocation)
+}
+
+func TestSetTablespacePaths_OverwritesOnCollision(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionOverwrite, "")
+	test.createExistingSymlink(t)
+
+	require.NoError(t, setTablespacePaths(test.spec))
+
+	test.requireSymlinkTarget(t, test.backupLocation)
+}
+
+func TestSetTablespacePaths_ReusesMatchingSymlink(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionFail, "")
+	require.NoError(t, setTablespacePaths(test.spec))
+
+	// the next backup of the delta chain sets the same paths again
+	require.NoError(t, setTablespacePaths(test.spec))
+
+	test.requireSymlinkTarget(t, test.backupLocation)
+}
+
+func TestSetTablespacePaths_UnknownPolicy(t *testing.T) {
+	test := newTablespaceCollisionTest(t, "ignore", "")
+
+	assert.Error(t, setTablespacePaths(test.spec))
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"archive/tar"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// RestoreTablespaceMapping restores the tablespaces to the new locations instead of the stored ones,
+// both the tablespaces of the backup tablespace specification and the tablespace symlinks stored in the backup tars
+type RestoreTablespaceMapping struct {
+	// locations are the new tablespace locations by the tablespace OIDs
+	locations map[string]string
+}
+
+// NewRestoreTablespaceMapping validates the new tablespace locations: they must be the distinct absolute paths
+func NewRestoreTablespaceMapping(locations map[string]string) (*RestoreTablespaceMapping, error) {
+	mapping := &RestoreTablespaceMapping{locations: make(map[string]string, len(locations))}
+	usedLocations := make(map[string]string, len(locations))
+	for oid, location := range locations {
+		if _, err := strconv.ParseUint(oid, 10, 32); err != nil {
+			return nil, errors.Errorf("invalid tablespace OID '%s' in the tablespace mapping", oid)
+		}
+		if !filepath.IsAbs(location) {
+			return nil, errors.Errorf("new location '%s' of tablespace %s must be an absolute path", location, oid)
+		}
+		location = filepath.Clean(location)
+		if otherOid, ok := usedLocations[location]; ok {
+			return nil, errors.Errorf("tablespaces %s and %s are mapped to the same location '%s'", otherOid, oid, location)
+		}
+		usedLocations[location] = oid
+		mapping.locations[oid] = location
+	}
+	return mapping, nil
+}
+
+// location returns the location the tablespace is restored to, the stored one if the tablespace is not mapped
+func (mapping *RestoreTablespaceMapping) location(oid, storedLocation string) string {
+	if mapping == nil {
+		return storedLocation
+	}
+	if location, ok := mapping.locations[oid]; ok {
+		return location
+	}
+	return storedLocation
+}
+
+// remapSpec returns the copy of the tablespace specification with the mapped tablespaces restored to the new locations
+func (mapping *RestoreTablespaceMapping) remapSpec(spec *TablespaceSpec) *TablespaceSpec {
+	remappedSpec := NewTablespaceSpec("")
+	remappedSpec.basePrefix = spec.basePrefix
+	for _, name := range spec.TablespaceNames() {
+		location, _ := spec.location(name)
+		remappedSpec.addTablespace(name, mapping.location(name, location.Location))
+		if newLocation, _ := remappedSpec.location(name); newLocation.Location != location.Location {
+			tracelog.InfoLogger.Printf("Tablespace %s is remapped from '%s' to '%s'\n",
+				name, location.Location, newLocation.Location)
+		}
+	}
+	return &remappedSpec
+}
+
+// remapTablespaces returns the tablespace specification to restore the backup with, remapped by the tablespace
+// mapping and then by the path map. The restore specification is preferred over the one of the backup sentinel,
+// as the fetch does.
+func (options FetchOptions) remapTablespaces(backup Backup, spec *TablespaceSpec) (*TablespaceSpec, error) {
+	if options.TablespaceMapping == nil && options.PathMap == nil {
+		return spec, nil
+	}
+	sentinelDto, err := backup.GetSentinel()
+	if err != nil {
+		return nil, err
+	}
+	spec = chooseTablespaceSpecification(sentinelDto.TablespaceSpec, spec)
+	return options.PathMap.remapSpec(options.TablespaceMapping.remapSpec(spec)), nil
+}
+
+// getTablespaceOid returns the OID of the tablespace the symlink under pg_tblspc is restored for
+func getTablespaceOid(name string) (string, bool) {
+	relativeName := strings.Trim(path.Clean("/"+name), "/")
+	if path.Dir(relativeName) != TablespaceFolder {
+		return "", false
+	}
+	return path.Base(relativeName), true
+}
+
+// restoreTablespaceSymlink restores the tablespace symlink stored in the tar to the mapped location,
+// if any. The symlink target is checked to be the directory, the missing one is created
+// if WALG_RESTORE_CREATE_TABLESPACES is enabled, otherwise it is only reported, e.g. since
+// the symlink is replaced by the later backup of the delta chain.
+func (tarInterpreter *FileTarInterpreter) restoreTablespaceSymlink(fileInfo *tar.Header, targetPath, oid string) error {
+	linkname := tarInterpreter.tablespaceMapping.location(oid, fileInfo.Linkname)
+	if linkname != fileInfo.Linkname {
+		tracelog.InfoLogger.Printf("Tablespace %s is remapped from '%s' to '%s'\n", oid, fileInfo.Linkname, linkname)
+	} else {
+		linkname = tarInterpreter.getSymlinkTarget(fileInfo)
+	}
+	if err := checkSymlinkTarget(tarInterpreter.DBDataDirectory, fileInfo.Name, linkname, nil); err != nil {
+		return err
+	}
+	location := linkname
+	if !path.IsAbs(location) {
+		location = path.Join(tarInterpreter.DBDataDirectory, TablespaceFolder, location)
+	}
+	if err := ensureTablespaceLocation(fileInfo.Name, location, tarInterpreter.getDirMode(), tarInterpreter.cleanup); err != nil {
+		return err
+	}
+	if err := removeExistingSymlink(targetPath); err != nil {
+		return err
+	}
+	if err := os.Symlink(linkname, targetPath); err != nil {
+		return errors.Wrapf(err, "Interpret: failed to create tablespace symlink %s", targetPath)
+	}
+	tracelog.InfoLogger.Printf("Tablespace %s is restored as the symlink to '%s'\n", oid, linkname)
+	return tarInterpreter.restoreAttributes(fileInfo, targetPath)
+}
+
+// ensureTablespaceLocation checks that the tablespace symlink target is the directory, the missing one
+// is created if WALG_RESTORE_CREATE_TABLESPACES is enabled and reported otherwise. The created directory is tracked
+// by the restore cleanup, if any.
+func ensureTablespaceLocation(name, location string, dirMode os.FileMode, cleanup *RestoreCleanup) error {
+	info, err := os.Stat(location)
+	if os.IsNotExist(err) {
+		if !viper.GetBool(internal.CreateTablespacesSetting) {
+			tracelog.WarningLogger.Printf("Tablespace symlink '%s' points to the missing directory '%s', "+
+				"set %s to create it on restore\n", name, location, internal.CreateTablespacesSetting)
+			return nil
+		}
+		tracelog.InfoLogger.Printf("Creating the missing directory '%s' of tablespace symlink '%s'\n", location, name)
+		cleanup.trackExternalDirectory(location)
+		return errors.Wrapf(os.MkdirAll(location, dirMode), "Interpret: failed to create tablespace directory %s", location)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Interpret: failed to stat tablespace directory %s", location)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("tablespace symlink '%s' points to '%s', which is not a directory", name, location)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestNewRestoreTablespaceMapping(t *testing.T) {
+	mapping, err := NewRestoreTablespaceMapping(map[string]string{"16385": "/mnt/new_ts1/", "16390": "/mnt/new_ts2"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/new_ts1", mapping.location("16385", "/mnt/ts1"))
+	assert.Equal(t, "/mnt/ts3", mapping.location("16395", "/mnt/ts3"))
+	for _, locations := range []map[string]string{
+		{"ts": "/mnt/new_ts1"},
+		{"16385": "new_ts1"},
+		{"16385": "/mnt/new_ts", "16390": "/mnt/new_ts/"},
+	} {
+		_, err := NewRestoreTablespaceMapping(locations)
+		assert.Error(t, err, locations)
+	}
+}
+
+func TestSetTablespacePaths_DefaultLayout(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionFail, "")
+	var mapping *RestoreTablespaceMapping
+
+	require.NoError(t, setTablespacePaths(*mapping.remapSpec(&test.spec)))
+
+	test.requireSymlinkTarget(t, test.backupLocation)
+}
+
+func TestSetTablespacePaths_RemappedLayout(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionFail, "")
+	mapping, err := NewRestoreTablespaceMapping(map[string]string{"16385": test.otherLocation})
+	require.NoError(t, err)
+
+	remappedSpec := mapping.remapSpec(&test.spec)
+	require.NoError(t, setTablespacePaths(*remappedSpec))
+
+	test.requireSymlinkTarget(t, test.otherLocation)
+	_, err = os.Stat(test.otherLocation)
+	assert.NoError(t, err)
+	// the specification of the backup is not changed
+	location, _ := test.spec.location("16385")
+	assert.Equal(t, test.backupLocation, location.Location)
+	basePrefix, _ := remappedSpec.BasePrefix()
+	assert.Equal(t, test.dataDir, basePrefix)
+}
+
+type tablespaceSymlinkTest struct {
+	dataDir        string
+	backupLocation string
+	newLocation    string
+	symlinkPath    string
+}
+
+func newTablespaceSymlinkTest(t *testing.T) tablespaceSymlinkTest {
+	root := t.TempDir()
+	test := tablespaceSymlinkTest{
+		dataDir:        filepath.Join(root, "data"),
+		backupLocation: filepath.Join(root, "ts_backup"),
+		newLocation:    filepath.Join(root, "ts_new"),
+	}
+	test.symlinkPath = filepath.Join(test.dataDir, TablespaceFolder, "16385")
+	require.NoError(t, os.MkdirAll(filepath.Dir(test.symlinkPath), 0700))
+	return test
+}
+
+func (test tablespaceSymlinkTest) interpret(mapping *RestoreTablespaceMapping) error {
+	tarInterpreter := NewFileTarInterpreter(test.dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithTablespaceMapping(mapping))
+	return tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/pg_tblspc/16385", Typeflag: tar.TypeSymlink, Linkname: test.backupLocation})
+}
+
+func (test tablespaceSymlinkTest) requireSymlinkTarget(t *testing.T, expected string) {
+	target, err := os.Readlink(test.symlinkPath)
+	require.NoError(t, err)
+	assert.Equal(t, expected, target)
+}
+
+func TestInterpretTablespaceSymlink_DefaultLayout(t *testing.T) {
+	test := newTablespaceSymlinkTest(t)
+	require.NoError(t, os.Mkdir(test.backupLocation, 0700))
+
+	require.NoError(t, test.interpret(nil))
+
+	test.requireSymlinkTarget(t, test.backupLocation)
+}
+
+func TestInterpretTablespaceSymlink_RemappedLayout(t *testing.T) {
+	test := newTablespaceSymlinkTest(t)
+	require.NoError(t, os.Mkdir(test.newLocation, 0700))
+	mapping, err := NewRestoreTablespaceMapping(map[string]string{"16385": test.newLocation})
+	require.NoError(t, err)
+
+	require.NoError(t, test.interpret(mapping))
+
+	test.requireSymlinkTarget(t, test.newLocation)
+}
+
+func TestInterpretTablespaceSymlink_MissingTarget(t *testing.T) {
+	test := newTablespaceSymlinkTest(t)
+
+	require.NoError(t, test.interpret(nil))
+
+	// the missing target is only reported, the symlink may be replaced by the later backup of the delta chain
+	test.requireSymlinkTarget(t, test.backupLocation)
+	_, err := os.Stat(test.backupLocation)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestInterpretTablespaceSymlink_CreatesMissingTarget(t *testing.T) {
+	viper.Set(internal.CreateTablespacesSetting, true)
+	defer viper.Set(internal.CreateTablespacesSetting, nil)
+	test := newTablespaceSymlinkTest(t)
+	mapping, err := NewRestoreTablespaceMapping(map[string]string{"16385": test.newLocation})
+	require.NoError(t, err)
+
+	require.NoError(t, test.interpret(mapping))
+
+	test.requireSymlinkTarget(t, test.newLocation)
+	info, err := os.Stat(test.newLocation)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	_, err = os.Stat(test.backupLocation)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSetTablespacePaths_CleanupRemovesCreatedLocations(t *testing.T) {
+	test := newTablespaceCollisionTest(t, TablespaceCollisionFail, "")
+	// the location sharing the data directory prefix is outside of the data directory
+	createdLocation := test.dataDir + "_ts"
+	require.NoError(t, os.Mkdir(test.dataDir, 0700))
+	require.NoError(t, os.Mkdir(test.otherLocation, 0700))
+	spec := NewTablespaceSpec(test.dataDir)
+	spec.addTablespace("16385", filepath.Join(createdLocation, "16385"))
+	spec.addTablespace("16390", test.otherLocation)
+	cleanup, err := NewRestoreCleanup(test.dataDir)
+	require.NoError(t, err)
+
+	require.NoError(t, setTablespacePathsWithCleanup(spec, cleanup))
+	assert.NotContains(t, cleanup.createdPaths, createdLocation)
+	require.NoError(t, cleanup.Cleanup())
+
+	_, err = os.Lstat(createdLocation)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(test.otherLocation)
+	assert.NoError(t, err)
+	entries, err := os.ReadDir(test.dataDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestInterpretTablespaceSymlink_CleanupRemovesCreatedTarget(t *testing.T) {
+	viper.Set(internal.CreateTablespacesSetting, true)
+	defer viper.Set(internal.CreateTablespacesSetting, nil)
+	test := newTablespaceSymlinkTest(t)
+	cleanup, err := NewRestoreCleanup(test.dataDir)
+	require.NoError(t, err)
+	mapping, err := NewRestoreTablespaceMapping(map[string]string{"16385": test.newLocation})
+	require.NoError(t, err)
+	tarInterpreter := NewFileTarInterpreter(test.dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false,
+		WithTablespaceMapping(mapping), WithRestoreCleanup(cleanup))
+
+	require.NoError(t, tarInterpreter.Interpret(bytes.NewReader(nil),
+		&tar.Header{Name: "/pg_tblspc/16385", Typeflag: tar.TypeSymlink, Linkname: test.backupLocation}))
+	require.NoError(t, cleanup.Cleanup())
+
+	_, err = os.Lstat(test.newLocation)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(test.symlinkPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -101,6 +101,11 @@ func (p *TarBallFilePacker) PackFileIntoTar(cfi *ComposeFileInfo, tarBall intern
 			return err
 		}
 	}
+	var checksumReader *fileChecksumReader
+	if !cfi.isIncremented {
+		checksumReader = newFileChecksumReader(fileReadCloser)
+		fileReadCloser = checksumReader
+	}
 	errorGroup, _ := errgroup.WithContext(context.Background())
 
 	if p.options.verifyPageChecksums {
@@ -133,7 +138,24 @@ func (p *TarBallFilePacker) PackFileIntoTar(cfi *ComposeFileInfo, tarBall intern
 		return nil
 	})
 
-	return errorGroup.Wait()
+	if err = errorGroup.Wait(); err != nil {
+		return err
+	}
+	if checksumReader != nil {
+		p.addFileChecksum(cfi.header.Name, checksumReader.fileChecksum())
+	}
+	return nil
+}
+
+// addFileChecksum records the checksum of the packed file content in its description
+func (p *TarBallFilePacker) addFileChecksum(name string, checksum *internal.FileChecksum) {
+	value, ok := p.files.GetUnderlyingMap().Load(name)
+	if !ok {
+		return
+	}
+	description := value.(internal.BackupFileDescription)
+	description.Checksum = checksum
+	p.files.AddFileDescription(name, description)
 }
 
 func (p *TarBallFilePacker) createFileReadCloser(cfi *ComposeFileInfo) (io.ReadCloser, error) {
@@ -2,6 +2,8 @@ package postgres
 
 import (
 	"archive/tar"
+	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path"
@@ -12,9 +14,43 @@ import (
 	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
-	"github.com/wal-g/wal-g/utility"
 )
 
+type TarEntryOutsideDataDirectoryError struct {
+	error
+}
+
+func newTarEntryOutsideDataDirectoryError(name, targetPath, dbDataDirectory string) TarEntryOutsideDataDirectoryError {
+	return TarEntryOutsideDataDirectoryError{errors.Errorf(
+		"tar entry '%s' resolves to '%s', which is outside of the data directory '%s'", name, targetPath, dbDataDirectory)}
+}
+
+func newSymlinkOutsideDataDirectoryError(name, linkname, dbDataDirectory string) TarEntryOutsideDataDirectoryError {
+	return TarEntryOutsideDataDirectoryError{errors.Errorf(
+		"symlink '%s' points to '%s', which is outside of the data directory '%s'", name, linkname, dbDataDirectory)}
+}
+
+func (err TarEntryOutsideDataDirectoryError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// BackupTarInterpreter is the contract shared by the interpreters of the backup tars, e.g. FileTarInterpreter
+// extracting the backup to disk and FileStreamInterpreter streaming the single backup file:
+// only the entries of the backup files selected by SelectedFiles are interpreted.
+type BackupTarInterpreter interface {
+	internal.TarInterpreter
+	// SelectedFiles returns the backup files to interpret, nil selects all of them
+	SelectedFiles() map[string]bool
+}
+
+var _ BackupTarInterpreter = &FileTarInterpreter{}
+
+// isSelectedFile returns whether the backup file is to be interpreted by the interpreter
+func isSelectedFile(tarInterpreter BackupTarInterpreter, fileName string) bool {
+	selectedFiles := tarInterpreter.SelectedFiles()
+	return selectedFiles == nil || selectedFiles[fileName]
+}
+
 // FileTarInterpreter extracts input to disk.
 type FileTarInterpreter struct {
 	DBDataDirectory string
@@ -24,19 +60,397 @@ type FileTarInterpreter struct {
 	UnwrapResult    *UnwrapResult
 
 	createNewIncrementalFiles bool
+	fileUnwrapperType         FileUnwrapperType
+	restorePlugin             RestorePlugin
+	pgControlData             *PgControlData
+	unsyncedDataLimiter       *UnsyncedDataLimiter
+	backupMirror              *BackupMirror
+	cleanup                   *RestoreCleanup
+	partAllowlist             *TarPartAllowlist
+	merkleTree                *RestoreMerkleTree
+	unwrapReport              *RestoreUnwrapReport
+	dryRun                    *RestoreDryRun
+	dirMode                   os.FileMode
+	verifyChecksums           bool
+	restoreFileTimes          bool
+	strictTypeflag            bool
+	restoreSpecialFiles       bool
+	resumeManifest            *RestoreResumeManifest
+	allowNonEmptyDirectory    bool
+	backupName                string
+	databaseRelocation        *DatabaseRelocation
+	ownership                 *RestoreOwnership
+	xattrs                    *RestoreXattrs
+	tablespaceMapping         *RestoreTablespaceMapping
+	verifyCommand             *RestoreVerifyCommand
+	progress                  *RestoreProgress
+	metrics                   *RestoreMetrics
+	reflinkBase               *CatchupReflinkBase
+	completionMarker          *RestoreCompletionMarker
+	layerSequencer            *deltaLayerSequencer
+	layer                     int
+	policy                    restorePolicy
+}
+
+// FileTarInterpreterOption configures the optional behaviour of FileTarInterpreter
+type FileTarInterpreterOption func(tarInterpreter *FileTarInterpreter)
+
+// WithFileUnwrapperType makes FileTarInterpreter unwrap the files of the new unwrap implementation
+// with the given unwrapper instead of the one of the restore kind, e.g. DeltaApplyBackupFileUnwrapper
+func WithFileUnwrapperType(unwrapperType FileUnwrapperType) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.fileUnwrapperType = unwrapperType
+	}
+}
+
+// WithRestorePlugin makes FileTarInterpreter notify the plugin about every restored file
+func WithRestorePlugin(plugin RestorePlugin) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.restorePlugin = plugin
+	}
+}
+
+// WithConcurrencyLimiter makes FileTarInterpreter respect the per-tablespace and per-device concurrency limits
+func WithConcurrencyLimiter(limiter *RestoreConcurrencyLimiter) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.policy.concurrencyLimiter = limiter
+	}
+}
+
+// WithUnsyncedDataLimiter makes FileTarInterpreter account the files written without fsync in the limiter
+func WithUnsyncedDataLimiter(limiter *UnsyncedDataLimiter) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.unsyncedDataLimiter = limiter
+	}
+}
+
+// WithCapacityGuard makes FileTarInterpreter check that every restored file fits into the restore target
+func WithCapacityGuard(guard *RestoreCapacityGuard) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.policy.capacityGuard = guard
+	}
+}
+
+// WithBackupMirror makes the backup tars read by the restore be mirrored to the second storage
+func WithBackupMirror(mirror *BackupMirror) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.backupMirror = mirror
+	}
+}
+
+// WithRestoreCleanup makes FileTarInterpreter track the written paths and stop writing when the restore is cancelled
+func WithRestoreCleanup(cleanup *RestoreCleanup) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.cleanup = cleanup
+	}
+}
+
+// WithPartAllowlist makes the restore extract only the tar parts listed in the allowlist
+func WithPartAllowlist(allowlist *TarPartAllowlist) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.partAllowlist = allowlist
+	}
+}
+
+// WithMerkleTree makes FileTarInterpreter record the restored files to build the Merkle tree over them
+func WithMerkleTree(tree *RestoreMerkleTree) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.merkleTree = tree
+	}
+}
+
+// WithUnwrapReport makes the unwrap result of every restored backup be added to the report
+func WithUnwrapReport(report *RestoreUnwrapReport) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.unwrapReport = report
+	}
+}
+
+// WithRestoreDryRun makes FileTarInterpreter record the intended action for every entry instead of writing it
+func WithRestoreDryRun(dryRun *RestoreDryRun) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.dryRun = dryRun
+	}
+}
+
+// WithDatabaseRelocation makes FileTarInterpreter restore the relocated databases to their alternate directories
+func WithDatabaseRelocation(relocation *DatabaseRelocation) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.databaseRelocation = relocation
+	}
+}
+
+// WithRestoreOwnership makes FileTarInterpreter apply the stored owner, translated by the id maps, to the restored files
+func WithRestoreOwnership(ownership *RestoreOwnership) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.ownership = ownership
+	}
+}
+
+// WithTablespaceMapping makes FileTarInterpreter restore the tablespace symlinks stored in the tars to the new locations
+func WithTablespaceMapping(mapping *RestoreTablespaceMapping) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.tablespaceMapping = mapping
+	}
+}
+
+// WithPathMap makes FileTarInterpreter rewrite the absolute symlink targets and hardlink sources by the path map
+func WithPathMap(pathMap *RestorePathMap) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.policy.pathMap = pathMap
+	}
+}
+
+// WithRestoreXattrs makes FileTarInterpreter reapply the stored extended attributes to the restored files
+func WithRestoreXattrs(xattrs *RestoreXattrs) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.xattrs = xattrs
+	}
+}
+
+// WithByteBudget makes FileTarInterpreter skip the files which do not fit into the restore byte budget
+func WithByteBudget(budget *RestoreByteBudget) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.policy.byteBudget = budget
+	}
+}
+
+// WithRestoreExclusion makes FileTarInterpreter skip the regular files matching the exclusion patterns
+func WithRestoreExclusion(exclusion *RestoreExclusion) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.policy.exclusion = exclusion
+	}
+}
+
+// WithBestEffort makes FileTarInterpreter collect the errors of the regular files instead of failing the restore
+func WithBestEffort(bestEffort *BestEffortRestore) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.policy.bestEffort = bestEffort
+	}
+}
+
+// WithCompletionMarker makes FileTarInterpreter pass the unwrap result to the restore completion marker
+func WithCompletionMarker(completionMarker *RestoreCompletionMarker) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.completionMarker = completionMarker
+	}
+}
+
+// WithCatchupReflinkBase makes FileTarInterpreter clone the page files created from the increments from the base copy
+func WithCatchupReflinkBase(reflinkBase *CatchupReflinkBase) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.reflinkBase = reflinkBase
+	}
+}
+
+// WithVerifyCommand makes FileTarInterpreter record the restored files to run the verify command against them
+func WithVerifyCommand(verifyCommand *RestoreVerifyCommand) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.verifyCommand = verifyCommand
+	}
+}
+
+// WithRestoreProgress makes FileTarInterpreter account the restored bytes and the applied increment blocks
+func WithRestoreProgress(progress *RestoreProgress) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.progress = progress
+	}
+}
+
+// WithRestoreMetrics makes FileTarInterpreter account the skipped files and the unwrap results in the metrics
+func WithRestoreMetrics(metrics *RestoreMetrics) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.metrics = metrics
+	}
+}
+
+// WithResumeManifest makes FileTarInterpreter skip the files restored by the previous runs
+// of the interrupted restore and record the restored ones
+func WithResumeManifest(manifest *RestoreResumeManifest) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.resumeManifest = manifest
+	}
+}
+
+// WithNonEmptyDirectoryAllowed makes FileTarInterpreter unwrap the full backup into the non-empty directory
+func WithNonEmptyDirectoryAllowed() FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.allowNonEmptyDirectory = true
+	}
+}
+
+// withDeltaLayer makes FileTarInterpreter wait for the previous layers of the delta chain restored concurrently
+func withDeltaLayer(sequencer *deltaLayerSequencer, layer int) FileTarInterpreterOption {
+	return func(tarInterpreter *FileTarInterpreter) {
+		tarInterpreter.layerSequencer = sequencer
+		tarInterpreter.layer = layer
+	}
+}
+
+// defaultFileUnwrapperType returns the unwrapper of the restore kind: the catchup restore, which creates
+// the missing incremented files, gets CatchupBackupFileUnwrapper, the backup fetch gets DefaultBackupFileUnwrapper
+func defaultFileUnwrapperType(createNewIncrementalFiles bool) FileUnwrapperType {
+	if createNewIncrementalFiles {
+		return CatchupBackupFileUnwrapper
+	}
+	return DefaultBackupFileUnwrapper
 }
 
 func NewFileTarInterpreter(
 	dbDataDirectory string, sentinel BackupSentinelDto, filesMetadata FilesMetadataDto,
-	filesToUnwrap map[string]bool, createNewIncrementalFiles bool,
+	filesToUnwrap map[string]bool, createNewIncrementalFiles bool, options ...FileTarInterpreterOption,
 ) *FileTarInterpreter {
-	return &FileTarInterpreter{dbDataDirectory, sentinel, filesMetadata,
-		filesToUnwrap, newUnwrapResult(), createNewIncrementalFiles}
+	tarInterpreter := &FileTarInterpreter{
+		DBDataDirectory:           dbDataDirectory,
+		Sentinel:                  sentinel,
+		FilesMetadata:             filesMetadata,
+		FilesToUnwrap:             filesToUnwrap,
+		UnwrapResult:              newUnwrapResult(),
+		createNewIncrementalFiles: createNewIncrementalFiles,
+		fileUnwrapperType:         defaultFileUnwrapperType(createNewIncrementalFiles),
+		dirMode:                   configureRestoreDirMode(),
+		verifyChecksums:           viper.GetBool(internal.RestoredChecksumsSetting),
+		restoreFileTimes:          viper.GetBool(internal.RestoreFileTimesSetting),
+		strictTypeflag:            viper.GetBool(internal.RestoreStrictTypeflagSetting),
+		restoreSpecialFiles:       viper.GetBool(internal.RestoreSpecialFilesSetting),
+	}
+	for _, option := range options {
+		option(tarInterpreter)
+	}
+	return tarInterpreter
+}
+
+// SelectedFiles returns the backup files to extract, FilesToUnwrap
+func (tarInterpreter *FileTarInterpreter) SelectedFiles() map[string]bool {
+	return tarInterpreter.FilesToUnwrap
+}
+
+var _ internal.TarStreamChecksumInterpreter = &FileTarInterpreter{}
+
+// TarStreamChecksum returns the checksum of the decompressed stream of the backup tar recorded in the sentinel at push
+func (tarInterpreter *FileTarInterpreter) TarStreamChecksum(tarName string) (internal.FileChecksum, bool) {
+	checksum, ok := tarInterpreter.Sentinel.TarChecksums[tarName]
+	return checksum, ok
+}
+
+// notifyFileComplete passes the restored file to the Merkle tree, the verify command, the restore progress
+// and the restore plugin, if any
+func (tarInterpreter *FileTarInterpreter) notifyFileComplete(fileInfo *tar.Header, targetPath string) {
+	tarInterpreter.trackProgress(fileInfo)
+	if tarInterpreter.resumeManifest != nil {
+		tarInterpreter.resumeManifest.markRestored(tarInterpreter.backupName, fileInfo.Name, targetPath)
+	}
+	if tarInterpreter.merkleTree != nil {
+		tarInterpreter.merkleTree.trackFile(fileInfo.Name, targetPath)
+	}
+	if tarInterpreter.verifyCommand != nil {
+		tarInterpreter.verifyCommand.trackFile(fileInfo.Name, targetPath)
+	}
+	if tarInterpreter.restorePlugin == nil {
+		return
+	}
+	tarInterpreter.restorePlugin.OnFileComplete(RestoreFileInfo{
+		Name:       fileInfo.Name,
+		TargetPath: targetPath,
+		Size:       fileInfo.Size,
+	})
+}
+
+// trackProgress accounts the processed tar entry in the restore progress, if any
+func (tarInterpreter *FileTarInterpreter) trackProgress(fileInfo *tar.Header) {
+	if tarInterpreter.progress == nil {
+		return
+	}
+	var incrementBlocks int64
+	description, ok := tarInterpreter.FilesMetadata.Files[fileInfo.Name]
+	if ok && description.IsIncremented && tarInterpreter.Sentinel.IsIncremental() {
+		incrementBlocks = incrementBlockCount(fileInfo.Size)
+	}
+	tarInterpreter.progress.trackFile(fileInfo.Size, incrementBlocks)
+}
+
+// restoreAttributes applies the stored owner, the stored extended attributes and the stored times to the restored path,
+// if their restore is enabled. The extended attributes follow the owner, since the change of the owner may clear some.
+func (tarInterpreter *FileTarInterpreter) restoreAttributes(fileInfo *tar.Header, targetPath string) error {
+	if tarInterpreter.ownership != nil {
+		if err := tarInterpreter.ownership.apply(targetPath, fileInfo); err != nil {
+			return err
+		}
+	}
+	if tarInterpreter.xattrs != nil {
+		if err := tarInterpreter.xattrs.apply(targetPath, fileInfo); err != nil {
+			return err
+		}
+	}
+	if tarInterpreter.restoreFileTimes {
+		return applyStoredFileTimes(targetPath, fileInfo)
+	}
+	return nil
+}
+
+// GetPgControlData returns the data of the restored pg_control file or nil if it was not restored yet
+func (tarInterpreter *FileTarInterpreter) GetPgControlData() *PgControlData {
+	return tarInterpreter.pgControlData
+}
+
+// interpretPgControl restores the pg_control file and cross-checks its version against the sentinel,
+// unless its data was read before the extraction
+func (tarInterpreter *FileTarInterpreter) interpretPgControl(fileReader io.Reader, fileInfo *tar.Header,
+	unwrap func(fileReader io.Reader) error) error {
+	if tarInterpreter.pgControlData != nil {
+		return unwrap(fileReader)
+	}
+	var pgControlBytes bytes.Buffer
+	err := unwrap(io.TeeReader(fileReader, &pgControlBytes))
+	if err != nil {
+		return err
+	}
+	if pgControlBytes.Len() == 0 {
+		// pg_control is not unwrapped this time
+		return nil
+	}
+	pgControlData, err := extractPgControlData(&pgControlBytes)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to parse the restored '%s': %v\n", fileInfo.Name, err)
+		return nil
+	}
+	tarInterpreter.setPgControlData(pgControlData)
+	return nil
+}
+
+// setPgControlData remembers the pg_control data of the backup and cross-checks its version against the sentinel
+func (tarInterpreter *FileTarInterpreter) setPgControlData(pgControlData *PgControlData) {
+	tarInterpreter.pgControlData = pgControlData
+	if tarInterpreter.Sentinel.PgVersion != 0 {
+		CheckPgControlVersion(pgControlData, tarInterpreter.Sentinel.PgVersion)
+	}
+}
+
+// pgControlDataReader is the TarInterpreter reading the pg_control data without restoring any file
+type pgControlDataReader struct {
+	data *PgControlData
+}
+
+func (reader *pgControlDataReader) Interpret(fileReader io.Reader, fileInfo *tar.Header) error {
+	if fileInfo.Name != PgControlPath {
+		return nil
+	}
+	data, err := extractPgControlData(fileReader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse '%s'", fileInfo.Name)
+	}
+	reader.data = data
+	return nil
 }
 
 // write file from reader to local file
 func WriteLocalFile(fileReader io.Reader, header *tar.Header, localFile *os.File, fsync bool) error {
-	_, err := io.Copy(localFile, fileReader)
+	var err error
+	if isSparseRestoreEnabled() && isEmptyFile(localFile) {
+		_, err = writeSparse(localFile, fileReader)
+	} else {
+		_, err = io.Copy(localFile, fileReader)
+	}
 	if err != nil {
 		err1 := os.Remove(localFile.Name())
 		if err1 != nil {
@@ -52,7 +466,7 @@ func WriteLocalFile(fileReader io.Reader, header *tar.Header, localFile *os.File
 	}
 
 	if fsync {
-		err = localFile.Sync()
+		err = syncRestoredFile(localFile)
 		return errors.Wrap(err, "Interpret: fsync failed")
 	}
 
@@ -71,67 +485,247 @@ func (tarInterpreter *FileTarInterpreter) unwrapRegularFileOld(fileReader io.Rea
 			return nil
 		}
 	}
+	if tarInterpreter.isRestoredBefore(fileInfo.Name) {
+		tracelog.DebugLogger.Printf("'%s' is restored by the previous run\n", fileInfo.Name)
+		tarInterpreter.metrics.trackSkippedFile()
+		return nil
+	}
 	fileDescription, haveFileDescription := tarInterpreter.FilesMetadata.Files[fileInfo.Name]
 
 	// If this file is incremental we use it's base version from incremental path
 	if haveFileDescription && tarInterpreter.Sentinel.IsIncremental() && fileDescription.IsIncremented {
+		localFileInfo, _ := getLocalFileInfo(targetPath)
 		err := ApplyFileIncrement(targetPath, fileReader, tarInterpreter.createNewIncrementalFiles, fsync)
-		return errors.Wrapf(err, "Interpret: failed to apply increment for '%s'", targetPath)
+		if err != nil {
+			return errors.Wrapf(err, "Interpret: failed to apply increment for '%s'", targetPath)
+		}
+		if err = applyStoredFileMode(targetPath, fileInfo, localFileInfo == nil); err != nil {
+			return err
+		}
+		if err = tarInterpreter.restoreAttributes(fileInfo, targetPath); err != nil {
+			return err
+		}
+		tarInterpreter.notifyFileComplete(fileInfo, targetPath)
+		return nil
 	}
-	err := PrepareDirs(fileInfo.Name, targetPath)
+	err := writeRestoredFileAtomically(fileInfo, targetPath, fsync, tarInterpreter.getDirMode(),
+		func(file *os.File) error {
+			return WriteLocalFile(fileReader, fileInfo, file, false)
+		})
 	if err != nil {
-		return errors.Wrap(err, "Interpret: failed to create all directories")
+		return err
 	}
-	file, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create new file: '%s'", targetPath)
+	if err = tarInterpreter.verifyRestoredChecksum(fileInfo, targetPath); err != nil {
+		return err
 	}
-	defer utility.LoggedClose(file, "")
-
-	return WriteLocalFile(fileReader, fileInfo, file, fsync)
+	if tarInterpreter.UnwrapResult != nil {
+		tarInterpreter.addToCompletedFiles(fileInfo.Name)
+	}
+	if err = tarInterpreter.restoreAttributes(fileInfo, targetPath); err != nil {
+		return err
+	}
+	tarInterpreter.notifyFileComplete(fileInfo, targetPath)
+	return nil
 }
 
 // Interpret extracts a tar file to disk and creates needed directories.
 // Returns the first error encountered. Calls fsync after each file
-// is written successfully.
+// is written successfully, unless the fsyncs are batched by StartTarBatch.
 func (tarInterpreter *FileTarInterpreter) Interpret(fileReader io.Reader, fileInfo *tar.Header) error {
+	return tarInterpreter.interpret(fileReader, fileInfo, nil)
+}
+
+// TarEntryConcurrency returns the number of the regular files of one tar restored at once, WALG_TAR_EXTRACT_CONCURRENCY
+func (tarInterpreter *FileTarInterpreter) TarEntryConcurrency() int {
+	return viper.GetInt(internal.TarExtractConcurrencySetting)
+}
+
+// interpret extracts the tar entry, the written regular files are passed to the fsync batch if it is not nil
+func (tarInterpreter *FileTarInterpreter) interpret(fileReader io.Reader, fileInfo *tar.Header,
+	fsyncBatch *restoreFsyncBatch) error {
 	tracelog.DebugLogger.Println("Interpreting: ", fileInfo.Name)
-	targetPath := path.Join(tarInterpreter.DBDataDirectory, fileInfo.Name)
+	targetPath, err := getTargetPath(tarInterpreter.DBDataDirectory, fileInfo.Name)
+	if err != nil {
+		return err
+	}
+	if tarInterpreter.dryRun != nil {
+		tarInterpreter.dryRun.plan(tarInterpreter, fileInfo, targetPath)
+		return nil
+	}
 	fsync := !viper.GetBool(internal.TarDisableFsyncSetting)
+	if tarInterpreter.cleanup != nil {
+		if !tarInterpreter.cleanup.beginWrite() {
+			return newRestoreCancelledError()
+		}
+		defer tarInterpreter.cleanup.endWrite()
+		tarInterpreter.cleanup.trackPath(targetPath)
+		fileReader = tarInterpreter.cleanup.wrapReader(fileReader)
+	}
+	if tarInterpreter.databaseRelocation != nil {
+		if err := tarInterpreter.databaseRelocation.prepare(tarInterpreter.DBDataDirectory, fileInfo.Name); err != nil {
+			return err
+		}
+	}
 	switch fileInfo.Typeflag {
 	case tar.TypeReg, tar.TypeRegA:
-		// temporary switch to determine if new unwrap logic should be used
-		if useNewUnwrapImplementation {
-			return tarInterpreter.unwrapRegularFileNew(fileReader, fileInfo, targetPath, fsync)
+		if tarInterpreter.layerSequencer != nil {
+			return tarInterpreter.layerSequencer.sequence(tarInterpreter.layer, fileInfo.Name, func() error {
+				return tarInterpreter.interpretRegularFile(fileReader, fileInfo, targetPath, fsync, fsyncBatch)
+			})
 		}
-		return tarInterpreter.unwrapRegularFileOld(fileReader, fileInfo, targetPath, fsync)
+		return tarInterpreter.interpretRegularFile(fileReader, fileInfo, targetPath, fsync, fsyncBatch)
 	case tar.TypeDir:
-		err := os.MkdirAll(targetPath, 0755)
+		dirMode := tarInterpreter.getEntryDirMode(fileInfo)
+		err := os.MkdirAll(targetPath, dirMode)
 		if err != nil {
 			return errors.Wrapf(err, "Interpret: failed to create all directories in %s", targetPath)
 		}
-		if err = os.Chmod(targetPath, os.FileMode(fileInfo.Mode)); err != nil {
+		if err = os.Chmod(targetPath, dirMode); err != nil {
 			return errors.Wrap(err, "Interpret: chmod failed")
 		}
+		return tarInterpreter.restoreAttributes(fileInfo, targetPath)
 	case tar.TypeLink:
-		if err := os.Link(fileInfo.Name, targetPath); err != nil {
+		// the hardlink source is the archive path too, so it is resolved against the data directory
+		sourcePath, err := tarInterpreter.getHardlinkSourcePath(fileInfo)
+		if err != nil {
+			return err
+		}
+		if err := os.Link(sourcePath, targetPath); err != nil {
 			return errors.Wrapf(err, "Interpret: failed to create hardlink %s", targetPath)
 		}
 	case tar.TypeSymlink:
-		if err := os.Symlink(fileInfo.Name, targetPath); err != nil {
+		if oid, ok := getTablespaceOid(fileInfo.Name); ok {
+			return tarInterpreter.restoreTablespaceSymlink(fileInfo, targetPath, oid)
+		}
+		// the symlink target is stored as is, the relative one is resolved against the symlink directory
+		linkname := tarInterpreter.getSymlinkTarget(fileInfo)
+		err := checkSymlinkTarget(tarInterpreter.DBDataDirectory, fileInfo.Name, linkname, tarInterpreter.getTablespaceLocations())
+		if err != nil {
+			return err
+		}
+		if err := removeExistingSymlink(targetPath); err != nil {
+			return err
+		}
+		if err := os.Symlink(linkname, targetPath); err != nil {
 			return errors.Wrapf(err, "Interpret: failed to create symlink %s", targetPath)
 		}
+		return tarInterpreter.restoreAttributes(fileInfo, targetPath)
+	case tar.TypeXGlobalHeader:
+		// the global PAX header carries no file
+	default:
+		return tarInterpreter.interpretUnknownEntry(fileInfo, targetPath)
+	}
+	return nil
+}
+
+// interpretRegularFile writes the regular file or applies its increment
+func (tarInterpreter *FileTarInterpreter) interpretRegularFile(fileReader io.Reader, fileInfo *tar.Header,
+	targetPath string, fsync bool, fsyncBatch *restoreFsyncBatch) error {
+	isAdmitted, release, err := tarInterpreter.admitRegularFile(fileInfo, targetPath)
+	if !isAdmitted || err != nil {
+		return err
+	}
+	defer release()
+	unwrap := func(fileReader io.Reader) error {
+		return tarInterpreter.unwrapBestEffort(fileInfo.Name, func() error {
+			var err error
+			// temporary switch to determine if new unwrap logic should be used
+			if useNewUnwrapImplementation {
+				err = tarInterpreter.unwrapRegularFileNew(fileReader, fileInfo, targetPath, fsync, fsyncBatch)
+			} else {
+				err = tarInterpreter.unwrapRegularFileOld(fileReader, fileInfo, targetPath, fsync)
+			}
+			if err != nil || fsync || tarInterpreter.unsyncedDataLimiter == nil {
+				return err
+			}
+			return tarInterpreter.unsyncedDataLimiter.AddWrittenFile(targetPath, fileInfo.Size)
+		})
+	}
+	if fileInfo.Name == PgControlPath {
+		return tarInterpreter.interpretPgControl(fileReader, fileInfo, unwrap)
+	}
+	return unwrap(fileReader)
+}
+
+// removeExistingSymlink removes the symlink left at the target path, e.g. by the previous backup of the chain,
+// so it can be recreated with the stored target. The other existing entries are kept.
+func removeExistingSymlink(targetPath string) error {
+	info, err := os.Lstat(targetPath)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	if err = os.Remove(targetPath); err != nil {
+		return errors.Wrapf(err, "Interpret: failed to remove the existing symlink %s", targetPath)
+	}
+	return nil
+}
+
+// getTargetPath returns the path of the tar entry in the data directory. The absolute entry names
+// are relative to the data directory, the names escaping it with ".." are rejected.
+func getTargetPath(dbDataDirectory, name string) (string, error) {
+	targetPath := path.Join(dbDataDirectory, name)
+	if !isInsideDirectory(dbDataDirectory, targetPath) {
+		return "", newTarEntryOutsideDataDirectoryError(name, targetPath, dbDataDirectory)
+	}
+	return targetPath, nil
+}
+
+func isInsideDirectory(directory, targetPath string) bool {
+	relativePath, err := filepath.Rel(filepath.Clean(directory), filepath.Clean(targetPath))
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// checkSymlinkTarget rejects the symlink pointing outside of the data directory. Only pg_wal, pg_xlog
+// and the tablespace links in pg_tblspc may point to the absolute locations of the separate directories,
+// the absolute targets of the other symlinks must be inside the data directory or the tablespace locations.
+// The relative targets of any symlink must resolve inside the data directory.
+func checkSymlinkTarget(dbDataDirectory, name, linkname string, tablespaceLocations []string) error {
+	relativeName := strings.Trim(path.Clean("/"+name), "/")
+	if path.IsAbs(linkname) {
+		if relativeName == "pg_wal" || relativeName == "pg_xlog" || path.Dir(relativeName) == TablespaceFolder {
+			return nil
+		}
+		for _, directory := range append([]string{dbDataDirectory}, tablespaceLocations...) {
+			if isInsideDirectory(directory, linkname) {
+				return nil
+			}
+		}
+		return newSymlinkOutsideDataDirectoryError(name, linkname, dbDataDirectory)
+	}
+	resolvedPath := path.Join(dbDataDirectory, path.Dir(relativeName), linkname)
+	if !isInsideDirectory(dbDataDirectory, resolvedPath) {
+		return newSymlinkOutsideDataDirectoryError(name, linkname, dbDataDirectory)
 	}
 	return nil
 }
 
-// PrepareDirs makes sure all dirs exist
-func PrepareDirs(fileName string, targetPath string) error {
+// getTablespaceLocations returns the locations the tablespaces of the backup are restored to, both as stored
+// in the sentinel and as mapped by the tablespace mapping or the path map
+func (tarInterpreter *FileTarInterpreter) getTablespaceLocations() []string {
+	spec := tarInterpreter.Sentinel.TablespaceSpec
+	if spec == nil {
+		return nil
+	}
+	locations := make([]string, 0)
+	for _, name := range spec.TablespaceNames() {
+		location, _ := spec.location(name)
+		locations = append(locations, location.Location)
+		if mappedLocation := tarInterpreter.tablespaceMapping.location(name, location.Location); mappedLocation != location.Location {
+			locations = append(locations, mappedLocation)
+		} else if rewrittenLocation, ok := tarInterpreter.policy.pathMap.rewrite(location.Location); ok {
+			locations = append(locations, rewrittenLocation)
+		}
+	}
+	return locations
+}
+
+// PrepareDirs makes sure all dirs exist, the missing ones are created with the mode
+func PrepareDirs(fileName string, targetPath string, mode os.FileMode) error {
 	if fileName == targetPath {
 		return nil // because it runs in the local directory
 	}
 	base := filepath.Base(fileName)
 	dir := strings.TrimSuffix(targetPath, base)
-	err := os.MkdirAll(dir, 0755)
+	err := os.MkdirAll(dir, mode)
 	return err
 }
@@ -14,7 +14,8 @@ import (
 func (tarInterpreter *FileTarInterpreter) unwrapRegularFileNew(fileReader io.Reader,
 	header *tar.Header,
 	targetPath string,
-	fsync bool) error {
+	fsync bool,
+	fsyncBatch *restoreFsyncBatch) error {
 	if tarInterpreter.FilesToUnwrap != nil {
 		if _, ok := tarInterpreter.FilesToUnwrap[header.Name]; !ok {
 			// don't have to unwrap it this time
@@ -23,32 +24,92 @@ func (tarInterpreter *FileTarInterpreter) unwrapRegularFileNew(fileReader io.Rea
 		}
 	}
 	fileUnwrapper := getFileUnwrapper(tarInterpreter, header, targetPath)
-	localFile, isNewFile, err := getLocalFile(targetPath, header)
+	var unwrapResult *FileUnwrapResult
+	var err error
+	if localFileInfo, _ := getLocalFileInfo(targetPath); localFileInfo == nil && !isIncrementedFile(tarInterpreter, header) {
+		unwrapResult, err = unwrapNewFileAtomically(fileUnwrapper, fileReader, header, targetPath, fsync,
+			tarInterpreter.getDirMode())
+	} else {
+		unwrapResult, err = unwrapToLocalFile(fileUnwrapper, fileReader, header, targetPath, fsync, fsyncBatch,
+			tarInterpreter.getDirMode())
+	}
 	if err != nil {
 		return err
 	}
-	defer utility.LoggedClose(localFile, "")
-	defer utility.LoggedSync(localFile, "", fsync)
+	if unwrapResult.FileUnwrapResultType == Completed {
+		if err = tarInterpreter.verifyRestoredChecksum(header, targetPath); err != nil {
+			return err
+		}
+	}
+	tarInterpreter.AddFileUnwrapResult(unwrapResult, header.Name)
+	if unwrapResult.FileUnwrapResultType == Skipped {
+		// the skipped entry is processed as well, so it counts towards the progress totals
+		tarInterpreter.trackProgress(header)
+		tarInterpreter.metrics.trackSkippedFile()
+		return nil
+	}
+	if unwrapResult.FileUnwrapResultType == SkippedIdentical {
+		// the identical file is not written, but it is restored as well
+		tarInterpreter.metrics.trackSkippedFile()
+	}
+	if err = tarInterpreter.restoreAttributes(header, targetPath); err != nil {
+		return err
+	}
+	tarInterpreter.notifyFileComplete(header, targetPath)
+	return nil
+}
+
+// unwrapToLocalFile writes the file in place, the existing file is updated and the missing one is created
+func unwrapToLocalFile(fileUnwrapper IBackupFileUnwrapper, fileReader io.Reader, header *tar.Header,
+	targetPath string, fsync bool, fsyncBatch *restoreFsyncBatch, dirMode os.FileMode) (*FileUnwrapResult, error) {
+	localFile, isNewFile, err := getLocalFile(targetPath, header, dirMode)
+	if err != nil {
+		return nil, err
+	}
+	if fsyncBatch != nil {
+		defer fsyncBatch.add(localFile)
+		fsync = false
+	} else {
+		defer utility.LoggedClose(localFile, "")
+		defer loggedSyncRestoredFile(localFile, fsync)
+	}
 	var unwrapResult *FileUnwrapResult
-	var unwrapError error
 	if isNewFile {
-		unwrapResult, unwrapError = fileUnwrapper.UnwrapNewFile(fileReader, header, localFile, fsync)
+		unwrapResult, err = fileUnwrapper.UnwrapNewFile(fileReader, header, localFile, fsync)
 	} else {
-		unwrapResult, unwrapError = fileUnwrapper.UnwrapExistingFile(fileReader, header, localFile, fsync)
+		unwrapResult, err = fileUnwrapper.UnwrapExistingFile(fileReader, header, localFile, fsync)
 	}
-	if unwrapError != nil {
-		return unwrapError
+	if err != nil {
+		return nil, err
 	}
-	tarInterpreter.AddFileUnwrapResult(unwrapResult, header.Name)
-	return nil
+	if err = applyStoredFileMode(targetPath, header, isNewFile); err != nil {
+		return nil, err
+	}
+	return unwrapResult, nil
+}
+
+// unwrapNewFileAtomically writes the new file, whose whole content is in the tar, atomically.
+// The fsync is not batched, since the rename has to wait for it.
+func unwrapNewFileAtomically(fileUnwrapper IBackupFileUnwrapper, fileReader io.Reader, header *tar.Header,
+	targetPath string, fsync bool, dirMode os.FileMode) (*FileUnwrapResult, error) {
+	var unwrapResult *FileUnwrapResult
+	err := writeRestoredFileAtomically(header, targetPath, fsync, dirMode, func(file *os.File) error {
+		var err error
+		unwrapResult, err = fileUnwrapper.UnwrapNewFile(fileReader, header, file, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unwrapResult, nil
 }
 
 // get local file, create new if not existed
-func getLocalFile(targetPath string, header *tar.Header) (localFile *os.File, isNewFile bool, err error) {
+func getLocalFile(targetPath string, header *tar.Header, dirMode os.FileMode) (localFile *os.File, isNewFile bool, err error) {
 	if localFileInfo, _ := getLocalFileInfo(targetPath); localFileInfo != nil {
-		localFile, err = os.OpenFile(targetPath, os.O_RDWR, 0666)
+		localFile, err = openRestoredFile(targetPath, os.O_RDWR, 0666)
 	} else {
-		localFile, err = createLocalFile(targetPath, header.Name)
+		localFile, err = createLocalFile(targetPath, header, dirMode)
 		isNewFile = true
 	}
 	return localFile, isNewFile, err
@@ -56,20 +117,26 @@ func getLocalFile(targetPath string, header *tar.Header) (localFile *os.File, is
 
 // get file unwrapper for file depending on backup type
 func getFileUnwrapper(tarInterpreter *FileTarInterpreter, header *tar.Header, targetPath string) IBackupFileUnwrapper {
-	fileDescription, haveFileDescription := tarInterpreter.FilesMetadata.Files[header.Name]
-	isIncremented := haveFileDescription && fileDescription.IsIncremented
+	isIncremented := isIncrementedFile(tarInterpreter, header)
 	var isPageFile bool
 	if localFileInfo, _ := getLocalFileInfo(targetPath); localFileInfo != nil {
 		isPageFile = isPagedFile(localFileInfo, targetPath)
 	}
 	options := &BackupFileOptions{isIncremented: isIncremented, isPageFile: isPageFile}
-
-	// todo: clearer catchup backup detection logic
-	isCatchup := tarInterpreter.createNewIncrementalFiles
-	if isCatchup {
-		return NewFileUnwrapper(CatchupBackupFileUnwrapper, options)
+	if description, ok := tarInterpreter.FilesMetadata.Files[header.Name]; ok {
+		options.checksum = description.Checksum
+	}
+	options.reflinkBase = tarInterpreter.reflinkBase
+	if fileUnwrapper := newCustomFileUnwrapper(header.Name, options); fileUnwrapper != nil {
+		return fileUnwrapper
 	}
-	return NewFileUnwrapper(DefaultBackupFileUnwrapper, options)
+	return NewFileUnwrapper(tarInterpreter.fileUnwrapperType, options)
+}
+
+// isIncrementedFile checks if the tar entry is the increment of the file rather than its whole content
+func isIncrementedFile(tarInterpreter *FileTarInterpreter, header *tar.Header) bool {
+	fileDescription, haveFileDescription := tarInterpreter.FilesMetadata.Files[header.Name]
+	return haveFileDescription && fileDescription.IsIncremented
 }
 
 // get file info by file path
@@ -85,12 +152,12 @@ func getLocalFileInfo(targetPath string) (fileInfo os.FileInfo, err error) {
 }
 
 // create new local file on disk
-func createLocalFile(targetPath, name string) (*os.File, error) {
-	err := PrepareDirs(name, targetPath)
+func createLocalFile(targetPath string, header *tar.Header, dirMode os.FileMode) (*os.File, error) {
+	err := PrepareDirs(header.Name, targetPath, dirMode)
 	if err != nil {
 		return nil, errors.Wrap(err, "Interpret: failed to create all directories")
 	}
-	file, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	file, err := openRestoredFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, restoredFileCreateMode(header))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create new file: '%s'", targetPath)
 	}
@@ -100,7 +167,9 @@ func createLocalFile(targetPath, name string) (*os.File, error) {
 func (tarInterpreter *FileTarInterpreter) AddFileUnwrapResult(result *FileUnwrapResult, fileName string) {
 	switch result.FileUnwrapResultType {
 	case Skipped:
-		return
+		tarInterpreter.addToSkippedFiles(fileName, false)
+	case SkippedIdentical:
+		tarInterpreter.addToSkippedFiles(fileName, true)
 	case Completed:
 		tarInterpreter.addToCompletedFiles(fileName)
 	case CreatedFromIncrement:
@@ -116,6 +185,28 @@ func (tarInterpreter *FileTarInterpreter) addToCompletedFiles(fileName string) {
 	tarInterpreter.UnwrapResult.completedFilesMutex.Unlock()
 }
 
+func (tarInterpreter *FileTarInterpreter) addToSkippedFiles(fileName string, isIdentical bool) {
+	tarInterpreter.UnwrapResult.skippedFilesMutex.Lock()
+	if isIdentical {
+		tarInterpreter.UnwrapResult.identicalFiles = append(tarInterpreter.UnwrapResult.identicalFiles, fileName)
+	} else {
+		tarInterpreter.UnwrapResult.skippedFiles = append(tarInterpreter.UnwrapResult.skippedFiles, fileName)
+	}
+	tarInterpreter.UnwrapResult.skippedFilesMutex.Unlock()
+}
+
+func (tarInterpreter *FileTarInterpreter) addToFailedFiles(fileName string, err error) {
+	tarInterpreter.UnwrapResult.failedFilesMutex.Lock()
+	tarInterpreter.UnwrapResult.failedFiles[fileName] = err.Error()
+	tarInterpreter.UnwrapResult.failedFilesMutex.Unlock()
+}
+
+func (tarInterpreter *FileTarInterpreter) removeFromFailedFiles(fileName string) {
+	tarInterpreter.UnwrapResult.failedFilesMutex.Lock()
+	delete(tarInterpreter.UnwrapResult.failedFiles, fileName)
+	tarInterpreter.UnwrapResult.failedFilesMutex.Unlock()
+}
+
 func (tarInterpreter *FileTarInterpreter) addToCreatedPageFiles(fileName string, blocksToRestoreCount int64) {
 	tarInterpreter.UnwrapResult.createdPageFilesMutex.Lock()
 	tarInterpreter.UnwrapResult.createdPageFiles[fileName] = blocksToRestoreCount
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnwrapRegularFileNew_WritesNewFileAtomically(t *testing.T) {
+	dataDir := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	targetPath := filepath.Join(dataDir, "base", "1", "1259")
+
+	err := tarInterpreter.unwrapRegularFileNew(strings.NewReader("data"),
+		&tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Size: 4}, targetPath, true, nil)
+
+	require.NoError(t, err)
+	content, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(content))
+	_, err = os.Stat(targetPath + restoreTemporaryFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, []string{"/base/1/1259"}, tarInterpreter.UnwrapResult.completedFiles)
+}
+
+func TestUnwrapRegularFileNew_LeavesNoPartialFileOnWriteError(t *testing.T) {
+	dataDir := t.TempDir()
+	tarInterpreter := NewFileTarInterpreter(dataDir, BackupSentinelDto{}, FilesMetadataDto{}, nil, false)
+	targetPath := filepath.Join(dataDir, "base", "1", "1259")
+	reader := io.MultiReader(strings.NewReader("partial"), &failingReader{err: errors.New("connection reset")})
+
+	err := tarInterpreter.unwrapRegularFileNew(reader,
+		&tar.Header{Name: "/base/1/1259", Typeflag: tar.TypeReg, Size: 16}, targetPath, true, nil)
+
+	assert.Error(t, err)
+	entries, err := os.ReadDir(filepath.Join(dataDir, "base", "1"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Empty(t, tarInterpreter.UnwrapResult.completedFiles)
+}
+
+type failingReader struct {
+	err error
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	return 0, reader.err
+}
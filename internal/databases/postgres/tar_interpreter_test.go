@@ -3,13 +3,21 @@ package postgres_test
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"os"
 	"path"
+	"sync"
 	"testing"
 
 	"github.com/wal-g/wal-g/internal/databases/postgres"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/testtools"
 )
 
 func testInterpret(t *testing.T,
@@ -128,34 +136,328 @@ func TestInterpretTypeDirNested(t *testing.T) {
 }
 
 func TestInterpretTypeLink(t *testing.T) {
-	srcFileInfo, dstFileInfo := testInterpret(t,
-		os.TempDir(),
-
-		"test_file",
-		tar.TypeLink,
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	content := []byte("content")
+	err := tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+		Name:     "/base/1/1259",
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     int64(len(content)),
+	})
+	assert.NoError(t, err)
 
-		createFile,
-		os.Remove,
-	)
+	// the data directory is not the working directory, so the link source must be resolved against it
+	err = tarInterpreter.Interpret(&bytes.Buffer{}, &tar.Header{
+		Name:     "/base/1/1259_link",
+		Linkname: "/base/1/1259",
+		Typeflag: tar.TypeLink,
+	})
+	assert.NoError(t, err)
 
+	srcFileInfo, err := os.Lstat(path.Join(dbDataDirectory, "base/1/1259"))
+	assert.NoError(t, err)
+	dstFileInfo, err := os.Lstat(path.Join(dbDataDirectory, "base/1/1259_link"))
+	assert.NoError(t, err)
 	assert.True(t, os.SameFile(srcFileInfo, dstFileInfo))
 }
 
-func TestInterpretTypeSymlink(t *testing.T) {
-	_, dstFileInfo := testInterpret(t,
-		os.TempDir(),
+func TestInterpretTypeLinkOutsideDataDirectory(t *testing.T) {
+	tarInterpreter := postgres.NewFileTarInterpreter(t.TempDir(), postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
 
-		"test_file",
-		tar.TypeSymlink,
+	err := tarInterpreter.Interpret(&bytes.Buffer{}, &tar.Header{
+		Name:     "/base/1/1259_link",
+		Linkname: "../../etc/passwd",
+		Typeflag: tar.TypeLink,
+	})
 
-		createFile,
-		os.Remove,
-	)
+	assert.IsType(t, postgres.TarEntryOutsideDataDirectoryError{}, err)
+}
 
+func TestInterpretTypeSymlink(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+
+	err := tarInterpreter.Interpret(&bytes.Buffer{}, &tar.Header{
+		Name:     "/pg_wal",
+		Linkname: "/mnt/wal",
+		Typeflag: tar.TypeSymlink,
+	})
+	assert.NoError(t, err)
+
+	dstFileInfo, err := os.Lstat(path.Join(dbDataDirectory, "pg_wal"))
+	assert.NoError(t, err)
 	assert.True(t, dstFileInfo.Mode()&os.ModeSymlink != 0)
+	linkTarget, err := os.Readlink(path.Join(dbDataDirectory, "pg_wal"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/wal", linkTarget)
+}
+
+func TestInterpretTypeSymlinkToTablespace(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tablespaceLocation := t.TempDir()
+	assert.NoError(t, os.WriteFile(path.Join(tablespaceLocation, "PG_VERSION"), []byte("14\n"), 0600))
+	var tarBuffer bytes.Buffer
+	tarWriter := tar.NewWriter(&tarBuffer)
+	for _, header := range []*tar.Header{
+		{Name: "/pg_tblspc", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "/pg_tblspc/16384", Linkname: "/stale/location", Typeflag: tar.TypeSymlink},
+		{Name: "/pg_tblspc/16384", Linkname: tablespaceLocation, Typeflag: tar.TypeSymlink},
+	} {
+		assert.NoError(t, tarWriter.WriteHeader(header))
+	}
+	assert.NoError(t, tarWriter.Close())
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+
+	tarReader := tar.NewReader(&tarBuffer)
+	for header, err := tarReader.Next(); err != io.EOF; header, err = tarReader.Next() {
+		assert.NoError(t, err)
+		// the second symlink replaces the first one
+		assert.NoError(t, tarInterpreter.Interpret(tarReader, header))
+	}
+
+	content, err := os.ReadFile(path.Join(dbDataDirectory, "pg_tblspc/16384/PG_VERSION"))
+	assert.NoError(t, err)
+	assert.Equal(t, "14\n", string(content))
 }
 
 func TestPrepareDirsForLocalDirectory(t *testing.T) {
-	err := postgres.PrepareDirs("filename", "filename")
+	err := postgres.PrepareDirs("filename", "filename", postgres.DefaultRestoreDirMode)
+	assert.NoError(t, err)
+}
+
+type recordingRestorePlugin struct {
+	postgres.NopRestorePlugin
+	mutex sync.Mutex
+	files []postgres.RestoreFileInfo
+}
+
+func (plugin *recordingRestorePlugin) OnFileComplete(info postgres.RestoreFileInfo) {
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	plugin.files = append(plugin.files, info)
+}
+
+func TestInterpretNotifiesRestorePlugin(t *testing.T) {
+	dbDataDirectory, err := os.MkdirTemp("", "restore_plugin")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dbDataDirectory)
+
+	plugin := &recordingRestorePlugin{}
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithRestorePlugin(plugin))
+
+	content := []byte("content")
+	err = tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+		Name:     "/base/1/1259",
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     int64(len(content)),
+	})
 	assert.NoError(t, err)
+	err = tarInterpreter.Interpret(&bytes.Buffer{}, &tar.Header{
+		Name:     "/base/2",
+		Typeflag: tar.TypeDir,
+		Mode:     0700,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []postgres.RestoreFileInfo{{
+		Name:       "/base/1/1259",
+		TargetPath: path.Join(dbDataDirectory, "/base/1/1259"),
+		Size:       int64(len(content)),
+	}}, plugin.files)
+}
+
+func TestInterpretPgControlReadsVersion(t *testing.T) {
+	dbDataDirectory, err := os.MkdirTemp("", "pg_control")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dbDataDirectory)
+
+	pgControl := make([]byte, 8192)
+	binary.LittleEndian.PutUint32(pgControl[8:12], 1300)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{PgVersion: 140005},
+		postgres.FilesMetadataDto{}, nil, false)
+
+	err = tarInterpreter.Interpret(bytes.NewReader(pgControl), &tar.Header{
+		Name:     postgres.PgControlPath,
+		Typeflag: tar.TypeReg,
+		Mode:     0600,
+		Size:     int64(len(pgControl)),
+	})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, tarInterpreter.GetPgControlData())
+	assert.Equal(t, uint32(1300), tarInterpreter.GetPgControlData().GetPgControlVersion())
+	restored, err := os.ReadFile(path.Join(dbDataDirectory, postgres.PgControlPath))
+	assert.NoError(t, err)
+	assert.Equal(t, pgControl, restored)
+}
+
+func TestInterpretAbsoluteNameStaysInDataDirectory(t *testing.T) {
+	dbDataDirectory, err := os.MkdirTemp("", "absolute_name")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dbDataDirectory)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+
+	for _, name := range []string{"/base/1/1259", "//global//1262", "/base/../global/1260"} {
+		err = tarInterpreter.Interpret(&bytes.Buffer{}, &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600})
+		assert.NoError(t, err, name)
+		_, err = os.Stat(path.Join(dbDataDirectory, name))
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestInterpretRejectsNamesEscapingDataDirectory(t *testing.T) {
+	parentDirectory, err := os.MkdirTemp("", "escaping_name")
+	assert.NoError(t, err)
+	defer os.RemoveAll(parentDirectory)
+	dbDataDirectory := path.Join(parentDirectory, "data")
+	assert.NoError(t, os.Mkdir(dbDataDirectory, 0700))
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+
+	for _, name := range []string{"../escaped", "/../escaped", "base/../../escaped", "/base/1/../../../escaped", ".."} {
+		err = tarInterpreter.Interpret(&bytes.Buffer{}, &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600})
+		assert.IsType(t, postgres.TarEntryOutsideDataDirectoryError{}, err, name)
+		assert.Contains(t, err.Error(), "'"+name+"'")
+	}
+	_, err = os.Stat(path.Join(parentDirectory, "escaped"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestInterpretRejectsEntriesEscapingDataDirectory(t *testing.T) {
+	parentDirectory := t.TempDir()
+	dbDataDirectory := path.Join(parentDirectory, "data")
+	assert.NoError(t, os.Mkdir(dbDataDirectory, 0700))
+	assert.NoError(t, os.WriteFile(path.Join(parentDirectory, "outside"), []byte("secret"), 0600))
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+
+	for _, header := range []*tar.Header{
+		{Name: "/base/../../escaped", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "/base/1/1259_link", Linkname: "/../outside", Typeflag: tar.TypeLink},
+		{Name: "/base/1/../../../escaped", Linkname: "/base/1/1259", Typeflag: tar.TypeLink},
+		{Name: "/base/1/1259_symlink", Linkname: "../../../outside", Typeflag: tar.TypeSymlink},
+		{Name: "/escaped_symlink", Linkname: "..", Typeflag: tar.TypeSymlink},
+		{Name: "/base/1/1259_symlink", Linkname: path.Join(parentDirectory, "outside"), Typeflag: tar.TypeSymlink},
+		{Name: "/pg_tblspc/16384/../../escaped", Linkname: "/mnt/tablespace", Typeflag: tar.TypeSymlink},
+	} {
+		err := tarInterpreter.Interpret(&bytes.Buffer{}, header)
+		assert.IsType(t, postgres.TarEntryOutsideDataDirectoryError{}, err, header.Name)
+	}
+	entries, err := os.ReadDir(parentDirectory)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	_, err = os.Lstat(path.Join(dbDataDirectory, "base/1/1259_symlink"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestInterpretTypeSymlinkInsideDataDirectory(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+
+	for _, header := range []*tar.Header{
+		{Name: "/base/1", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "/base/1/1259_symlink", Linkname: "../../global/1262", Typeflag: tar.TypeSymlink},
+		{Name: "/base/1/1260_symlink", Linkname: path.Join(dbDataDirectory, "global") + "/../global/1262", Typeflag: tar.TypeSymlink},
+		{Name: "/pg_xlog", Linkname: "/mnt/wal", Typeflag: tar.TypeSymlink},
+	} {
+		assert.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{}, header), header.Name)
+	}
+	linkTarget, err := os.Readlink(path.Join(dbDataDirectory, "base/1/1259_symlink"))
+	assert.NoError(t, err)
+	assert.Equal(t, "../../global/1262", linkTarget)
+}
+
+func TestInterpretNotifiesRestorePluginConcurrently(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	plugin := &recordingRestorePlugin{}
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false, postgres.WithRestorePlugin(plugin))
+
+	content := []byte("content")
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := tarInterpreter.Interpret(bytes.NewReader(content), &tar.Header{
+				Name:     fmt.Sprintf("/base/1/%d", i),
+				Typeflag: tar.TypeReg,
+				Mode:     0600,
+				Size:     int64(len(content)),
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// one event for every completed file
+	names := make(map[string]int)
+	for _, info := range plugin.files {
+		names[info.Name]++
+		assert.Equal(t, int64(len(content)), info.Size)
+	}
+	assert.Len(t, names, 50)
+	for name, count := range names {
+		assert.Equal(t, 1, count, name)
+	}
+}
+
+func TestInterpretScrambledTarConcurrently(t *testing.T) {
+	viper.Set(internal.TarExtractConcurrencySetting, 4)
+	defer viper.Set(internal.TarExtractConcurrencySetting, nil)
+	dbDataDirectory := t.TempDir()
+	tarPath := path.Join(t.TempDir(), "part_1.tar")
+	tarFile, err := os.Create(tarPath)
+	require.NoError(t, err)
+	tarWriter := tar.NewWriter(tarFile)
+	writeEntry := func(header *tar.Header, content string) {
+		header.Size = int64(len(content))
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	// the files come before their directory and the hardlink comes before its target
+	contents := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("/base/1/%d", i)
+		contents[name] = fmt.Sprintf("content %d", i)
+		writeEntry(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600}, contents[name])
+	}
+	writeEntry(&tar.Header{Name: "/base/1/link", Typeflag: tar.TypeLink, Linkname: "/base/1/target"}, "")
+	writeEntry(&tar.Header{Name: "/base/1", Typeflag: tar.TypeDir, Mode: 0750}, "")
+	writeEntry(&tar.Header{Name: "/base/1/target", Typeflag: tar.TypeReg, Mode: 0600}, "target")
+	writeEntry(&tar.Header{Name: "/base/1/symlink", Typeflag: tar.TypeSymlink, Linkname: "target"}, "")
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, tarFile.Close())
+
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	err = internal.ExtractAll(tarInterpreter, []internal.ReaderMaker{&testtools.FileReaderMaker{Key: tarPath}})
+	require.NoError(t, err)
+
+	for name, content := range contents {
+		restored, err := os.ReadFile(path.Join(dbDataDirectory, name))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(restored), name)
+	}
+	directoryInfo, err := os.Stat(path.Join(dbDataDirectory, "base/1"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), directoryInfo.Mode().Perm())
+	targetInfo, err := os.Stat(path.Join(dbDataDirectory, "base/1/target"))
+	require.NoError(t, err)
+	linkInfo, err := os.Stat(path.Join(dbDataDirectory, "base/1/link"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(targetInfo, linkInfo))
+	restored, err := os.ReadFile(path.Join(dbDataDirectory, "base/1/symlink"))
+	require.NoError(t, err)
+	assert.Equal(t, "target", string(restored))
 }
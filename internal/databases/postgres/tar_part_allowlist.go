@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// ExcludedTarPart is the tar part of the restored backup which was not extracted
+// because it is missing from the allowlist
+type ExcludedTarPart struct {
+	BackupName string
+	TarName    string
+	// Files are the selected files stored in the part, nil if the backup has no files metadata
+	Files []string
+}
+
+// TarPartAllowlist restricts the restore to the explicitly listed tar parts, so the backup with
+// the known-corrupt parts can be restored from the good ones. The parts are identified by their
+// object keys relative to the base backups folder: <backup_name>/tar_partitions/<tar_name>.
+// The excluded parts are recorded to report the files which were not restored.
+type TarPartAllowlist struct {
+	allowedKeys map[string]bool
+
+	mutex         sync.Mutex
+	excludedParts []ExcludedTarPart
+}
+
+func NewTarPartAllowlist(keys []string) *TarPartAllowlist {
+	allowedKeys := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		key = strings.TrimPrefix(strings.TrimPrefix(key, "/"), utility.BaseBackupPath)
+		allowedKeys[key] = true
+	}
+	return &TarPartAllowlist{allowedKeys: allowedKeys}
+}
+
+// ReadTarPartAllowlist reads the allowlist file containing one part key per line.
+// The empty lines and the lines starting with '#' are ignored.
+func ReadTarPartAllowlist(path string) (*TarPartAllowlist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the tar part allowlist")
+	}
+	defer utility.LoggedClose(file, "")
+
+	keys := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read the tar part allowlist")
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("the tar part allowlist '%s' is empty", path)
+	}
+	return NewTarPartAllowlist(keys), nil
+}
+
+func getTarPartKey(backupName, tarName string) string {
+	return backupName + internal.TarPartitionFolderName + tarName
+}
+
+// allowTar reports whether the tar part may be extracted, the excluded part is recorded
+func (allowlist *TarPartAllowlist) allowTar(backupName, tarName string, filesMeta FilesMetadataDto,
+	filesToUnwrap map[string]bool) bool {
+	if allowlist.allowedKeys[getTarPartKey(backupName, tarName)] {
+		return true
+	}
+	excludedPart := ExcludedTarPart{BackupName: backupName, TarName: tarName}
+	if len(filesMeta.TarFileSets) > 0 {
+		excludedPart.Files = make([]string, 0)
+		for _, file := range filesMeta.TarFileSets[tarName] {
+			if filesToUnwrap == nil || filesToUnwrap[file] {
+				excludedPart.Files = append(excludedPart.Files, file)
+			}
+		}
+		sort.Strings(excludedPart.Files)
+	}
+	tracelog.WarningLogger.Printf("Skipping tar part '%s': it is not in the allowlist\n",
+		getTarPartKey(backupName, tarName))
+
+	allowlist.mutex.Lock()
+	defer allowlist.mutex.Unlock()
+	allowlist.excludedParts = append(allowlist.excludedParts, excludedPart)
+	return false
+}
+
+// ExcludedParts returns the parts excluded from the restore so far
+func (allowlist *TarPartAllowlist) ExcludedParts() []ExcludedTarPart {
+	allowlist.mutex.Lock()
+	defer allowlist.mutex.Unlock()
+	excludedParts := make([]ExcludedTarPart, len(allowlist.excludedParts))
+	copy(excludedParts, allowlist.excludedParts)
+	return excludedParts
+}
+
+// LogReport logs the files which were not restored because their parts were excluded
+func (allowlist *TarPartAllowlist) LogReport() {
+	excludedParts := allowlist.ExcludedParts()
+	if len(excludedParts) == 0 {
+		tracelog.InfoLogger.Println("All the tar parts of the restored backups are in the allowlist")
+		return
+	}
+	for _, part := range excludedParts {
+		key := getTarPartKey(part.BackupName, part.TarName)
+		if part.Files == nil {
+			tracelog.WarningLogger.Printf("Excluded tar part '%s': the files are unknown, "+
+				"the backup has no files metadata\n", key)
+			continue
+		}
+		tracelog.WarningLogger.Printf("Excluded tar part '%s': %d files are not restored\n", key, len(part.Files))
+		for _, file := range part.Files {
+			tracelog.WarningLogger.Printf("Not restored: %s\n", file)
+		}
+	}
+}
+
+// allowTars drops the stages' tars which are not in the allowlist of the interpreter, if any
+func (backup *Backup) allowTars(tarInterpreter *FileTarInterpreter,
+	stages [][]internal.ReaderMaker) [][]internal.ReaderMaker {
+	if tarInterpreter.partAllowlist == nil {
+		return stages
+	}
+	allowedStages := make([][]internal.ReaderMaker, 0, len(stages))
+	for _, stage := range stages {
+		allowedStage := make([]internal.ReaderMaker, 0, len(stage))
+		for _, readerMaker := range stage {
+			if backup.allowTar(tarInterpreter, readerMaker.Path()) {
+				allowedStage = append(allowedStage, readerMaker)
+			}
+		}
+		if len(allowedStage) > 0 {
+			allowedStages = append(allowedStages, allowedStage)
+		}
+	}
+	return allowedStages
+}
+
+func (backup *Backup) allowTar(tarInterpreter *FileTarInterpreter, tarName string) bool {
+	if tarInterpreter.partAllowlist == nil {
+		return true
+	}
+	return tarInterpreter.partAllowlist.allowTar(backup.Name, tarName, tarInterpreter.FilesMetadata,
+		tarInterpreter.FilesToUnwrap)
+}
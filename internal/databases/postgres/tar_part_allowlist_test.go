@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+)
+
+const allowlistTestBackup = "base_000000010000000000000002"
+
+func TestReadTarPartAllowlist(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "parts.txt")
+	err := os.WriteFile(listPath, []byte("# good parts\n\n"+
+		"basebackups_005/"+allowlistTestBackup+"/tar_partitions/part_1.tar.lz4\n"+
+		"  "+allowlistTestBackup+"/tar_partitions/part_3.tar.lz4  \n"), 0600)
+	require.NoError(t, err)
+
+	allowlist, err := ReadTarPartAllowlist(listPath)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		allowlistTestBackup + "/tar_partitions/part_1.tar.lz4": true,
+		allowlistTestBackup + "/tar_partitions/part_3.tar.lz4": true,
+	}, allowlist.allowedKeys)
+}
+
+func TestReadTarPartAllowlist_Empty(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "parts.txt")
+	require.NoError(t, os.WriteFile(listPath, []byte("# nothing\n"), 0600))
+
+	_, err := ReadTarPartAllowlist(listPath)
+
+	assert.Error(t, err)
+}
+
+func TestAllowTars(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	backup := NewBackup(folder, allowlistTestBackup)
+	filesMeta := FilesMetadataDto{TarFileSets: map[string][]string{
+		"part_1.tar.lz4": {"/base/1/1259"},
+		"part_2.tar.lz4": {"/base/1/16384", "/base/1/16385", "/base/1/16390"},
+		"part_3.tar.lz4": {"/global/1262"},
+	}}
+	filesToUnwrap := map[string]bool{"/base/1/1259": true, "/base/1/16384": true, "/base/1/16390": true,
+		"/global/1262": true}
+	allowlist := NewTarPartAllowlist([]string{allowlistTestBackup + "/tar_partitions/part_1.tar.lz4"})
+	tarInterpreter := NewFileTarInterpreter("", BackupSentinelDto{}, filesMeta, filesToUnwrap, false,
+		WithPartAllowlist(allowlist))
+	stages := [][]internal.ReaderMaker{
+		{internal.NewStorageReaderMaker(folder, "part_1.tar.lz4"), internal.NewStorageReaderMaker(folder, "part_2.tar.lz4")},
+		{internal.NewStorageReaderMaker(folder, "part_3.tar.lz4")},
+	}
+
+	allowedStages := backup.allowTars(tarInterpreter, stages)
+
+	require.Len(t, allowedStages, 1)
+	require.Len(t, allowedStages[0], 1)
+	assert.Equal(t, "part_1.tar.lz4", allowedStages[0][0].Path())
+	assert.Equal(t, []ExcludedTarPart{
+		{BackupName: allowlistTestBackup, TarName: "part_2.tar.lz4", Files: []string{"/base/1/16384", "/base/1/16390"}},
+		{BackupName: allowlistTestBackup, TarName: "part_3.tar.lz4", Files: []string{"/global/1262"}},
+	}, allowlist.ExcludedParts())
+}
+
+func TestAllowTars_WithoutAllowlist(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	backup := NewBackup(folder, allowlistTestBackup)
+	tarInterpreter := NewFileTarInterpreter("", BackupSentinelDto{}, FilesMetadataDto{}, UnwrapAll, false)
+	stages := [][]internal.ReaderMaker{{internal.NewStorageReaderMaker(folder, "part_1.tar.lz4")}}
+
+	assert.Equal(t, stages, backup.allowTars(tarInterpreter, stages))
+	assert.True(t, backup.allowTar(tarInterpreter, "pg_control.tar.lz4"))
+}
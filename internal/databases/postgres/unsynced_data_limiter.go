@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// UnsyncedDataLimiter caps the total size of the restored files which are written but not synced yet.
+// It is used when the per-file fsync is disabled: when the cap is reached, all the unsynced files are synced.
+// It is safe for concurrent use.
+type UnsyncedDataLimiter struct {
+	maxUnsyncedBytes int64
+
+	mutex         sync.Mutex
+	unsyncedBytes int64
+	unsyncedFiles []string
+}
+
+func NewUnsyncedDataLimiter(maxUnsyncedBytes int64) *UnsyncedDataLimiter {
+	return &UnsyncedDataLimiter{maxUnsyncedBytes: maxUnsyncedBytes}
+}
+
+// ConfigureUnsyncedDataLimiter creates the limiter from the settings.
+// Returns nil if the limit is not set or fsync is enabled, since every file is synced right after the write then.
+func ConfigureUnsyncedDataLimiter() (*UnsyncedDataLimiter, error) {
+	maxUnsyncedBytes := viper.GetInt64(internal.TarMaxUnsyncedBytesSetting)
+	if maxUnsyncedBytes < 0 {
+		return nil, errors.Errorf("%s should not be negative, got %d",
+			internal.TarMaxUnsyncedBytesSetting, maxUnsyncedBytes)
+	}
+	if maxUnsyncedBytes == 0 || !viper.GetBool(internal.TarDisableFsyncSetting) {
+		return nil, nil
+	}
+	return NewUnsyncedDataLimiter(maxUnsyncedBytes), nil
+}
+
+// AddWrittenFile accounts the written file and syncs all the unsynced files if the cap is reached
+func (limiter *UnsyncedDataLimiter) AddWrittenFile(filePath string, size int64) error {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.unsyncedFiles = append(limiter.unsyncedFiles, filePath)
+	limiter.unsyncedBytes += size
+	if limiter.unsyncedBytes < limiter.maxUnsyncedBytes {
+		return nil
+	}
+	// the writers are blocked while syncing, so the cap is never exceeded by the completed files
+	return limiter.syncFiles()
+}
+
+// GetUnsyncedBytes returns the total size of the files written but not synced yet
+func (limiter *UnsyncedDataLimiter) GetUnsyncedBytes() int64 {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return limiter.unsyncedBytes
+}
+
+// SyncAll syncs all the files written but not synced yet
+func (limiter *UnsyncedDataLimiter) SyncAll() error {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return limiter.syncFiles()
+}
+
+func (limiter *UnsyncedDataLimiter) syncFiles() error {
+	tracelog.DebugLogger.Printf("Syncing %d restored files (%d bytes)\n",
+		len(limiter.unsyncedFiles), limiter.unsyncedBytes)
+	for _, filePath := range limiter.unsyncedFiles {
+		err := syncFile(filePath)
+		if err != nil {
+			return err
+		}
+	}
+	limiter.unsyncedFiles = nil
+	limiter.unsyncedBytes = 0
+	return nil
+}
+
+func syncFile(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open '%s' for fsync", filePath)
+	}
+	defer utility.LoggedClose(file, "")
+	return errors.Wrapf(syncRestoredFile(file), "failed to fsync '%s'", filePath)
+}
@@ -0,0 +1,54 @@
+package postgres_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+)
+
+func TestUnsyncedDataLimiter_SyncsWhenCapReached(t *testing.T) {
+	dir := t.TempDir()
+	limiter := postgres.NewUnsyncedDataLimiter(100)
+	for _, name := range []string{"first", "second"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), make([]byte, 60), 0600))
+	}
+
+	require.NoError(t, limiter.AddWrittenFile(filepath.Join(dir, "first"), 60))
+	assert.Equal(t, int64(60), limiter.GetUnsyncedBytes())
+
+	require.NoError(t, limiter.AddWrittenFile(filepath.Join(dir, "second"), 60))
+	assert.Equal(t, int64(0), limiter.GetUnsyncedBytes())
+}
+
+func TestUnsyncedDataLimiter_ConcurrentAccounting(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(filePath, make([]byte, 10), 0600))
+	limiter := postgres.NewUnsyncedDataLimiter(1000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, limiter.AddWrittenFile(filePath, 7))
+		}()
+	}
+	wg.Wait()
+
+	// 350 bytes written in total, the cap is never reached
+	assert.Equal(t, int64(350), limiter.GetUnsyncedBytes())
+}
+
+func TestUnsyncedDataLimiter_MissingFile(t *testing.T) {
+	limiter := postgres.NewUnsyncedDataLimiter(1)
+
+	err := limiter.AddWrittenFile(filepath.Join(t.TempDir(), "missing"), 10)
+
+	assert.Error(t, err)
+}
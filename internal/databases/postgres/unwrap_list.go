@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// ReadUnwrapList reads the list of the files to restore containing one file path per line, the paths are relative
+// to the data directory as the names of the backup files, e.g. "base/16384/16385". The empty lines
+// and the lines starting with '#' are ignored.
+func ReadUnwrapList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the unwrap list")
+	}
+	defer utility.LoggedClose(file, "")
+
+	fileNames := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fileNames = append(fileNames, "/"+strings.TrimPrefix(line, "/"))
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read the unwrap list")
+	}
+	if len(fileNames) == 0 {
+		return nil, errors.Errorf("the unwrap list '%s' is empty", path)
+	}
+	return fileNames, nil
+}
+
+// SelectListedFiles narrows the filesToUnwrap down to the files of the unwrap list. The listed files
+// which are not in the backup files metadata, or are not selected by the other options, are reported
+// and skipped. Returns an error if none of the listed files is in the backup.
+func SelectListedFiles(files internal.BackupFileList, filesToUnwrap map[string]bool,
+	listedFiles []string) (map[string]bool, error) {
+	if len(files) == 0 || filesToUnwrap == nil {
+		return nil, errors.New("can't select the files of the unwrap list: backup has no files metadata")
+	}
+	result := make(map[string]bool)
+	for _, fileName := range listedFiles {
+		if _, ok := files[fileName]; !ok {
+			tracelog.WarningLogger.Printf("File '%s' of the unwrap list is not in the backup, skipping it\n", fileName)
+			continue
+		}
+		if !filesToUnwrap[fileName] {
+			tracelog.WarningLogger.Printf("File '%s' of the unwrap list is excluded by the other fetch options\n", fileName)
+			continue
+		}
+		result[fileName] = true
+	}
+	if len(result) == 0 {
+		return nil, errors.New("none of the files of the unwrap list is in the backup")
+	}
+	tracelog.InfoLogger.Printf("Selected %d of %d files of the unwrap list\n", len(result), len(listedFiles))
+	return result, nil
+}
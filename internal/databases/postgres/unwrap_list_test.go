@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func writeTestUnwrapList(t *testing.T, content string) string {
+	listPath := filepath.Join(t.TempDir(), "files.txt")
+	require.NoError(t, os.WriteFile(listPath, []byte(content), 0600))
+	return listPath
+}
+
+var unwrapListTestFiles = internal.BackupFileList{
+	"/base/16384/16385":  {},
+	"/base/16384/16386":  {},
+	"/global/pg_control": {},
+	"/postgresql.conf":   {},
+}
+
+func getUnwrapListTestFilesToUnwrap() map[string]bool {
+	filesToUnwrap := make(map[string]bool, len(unwrapListTestFiles))
+	for fileName := range unwrapListTestFiles {
+		filesToUnwrap[fileName] = true
+	}
+	return filesToUnwrap
+}
+
+func TestReadUnwrapList(t *testing.T) {
+	listPath := writeTestUnwrapList(t, "# the damaged relation\n\nbase/16384/16385\n  /global/pg_control  \n")
+
+	fileNames, err := ReadUnwrapList(listPath)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/base/16384/16385", "/global/pg_control"}, fileNames)
+}
+
+func TestReadUnwrapList_Empty(t *testing.T) {
+	_, err := ReadUnwrapList(writeTestUnwrapList(t, "# nothing\n\n"))
+	assert.Error(t, err)
+
+	_, err = ReadUnwrapList(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestSelectListedFiles_Valid(t *testing.T) {
+	fileNames, err := ReadUnwrapList(writeTestUnwrapList(t, "base/16384/16385\nglobal/pg_control\n"))
+	require.NoError(t, err)
+
+	selected, err := SelectListedFiles(unwrapListTestFiles, getUnwrapListTestFilesToUnwrap(), fileNames)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/base/16384/16385": true, "/global/pg_control": true}, selected)
+}
+
+func TestSelectListedFiles_Partial(t *testing.T) {
+	fileNames, err := ReadUnwrapList(writeTestUnwrapList(t, "base/16384/16385\nbase/16384/99999\npostgresql.conf\n"))
+	require.NoError(t, err)
+	// the file excluded by the other fetch options is skipped as well
+	filesToUnwrap := getUnwrapListTestFilesToUnwrap()
+	delete(filesToUnwrap, "/postgresql.conf")
+
+	selected, err := SelectListedFiles(unwrapListTestFiles, filesToUnwrap, fileNames)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/base/16384/16385": true}, selected)
+}
+
+func TestSelectListedFiles_UnknownFiles(t *testing.T) {
+	fileNames, err := ReadUnwrapList(writeTestUnwrapList(t, "base/1/1259\nbase/1/1260\n"))
+	require.NoError(t, err)
+
+	_, err = SelectListedFiles(unwrapListTestFiles, getUnwrapListTestFilesToUnwrap(), fileNames)
+	assert.Error(t, err)
+
+	// the backup without the files metadata can't be validated against the list
+	_, err = SelectListedFiles(internal.BackupFileList{}, UnwrapAll, fileNames)
+	assert.Error(t, err)
+}
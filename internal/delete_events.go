@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	DeleteEventActionDelete = "delete"
+	DeleteEventActionKeep   = "keep"
+
+	// deleteEventLogStdout makes the delete events written to the standard output
+	deleteEventLogStdout = "-"
+)
+
+// DeleteEvent is the structured record of the decision the delete made for the storage object
+type DeleteEvent struct {
+	Time      time.Time `json:"time"`
+	Object    string    `json:"object"`
+	Permanent bool      `json:"permanent"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason"`
+	DryRun    bool      `json:"dry_run"`
+}
+
+// DeleteEventLogger records the delete decisions, e.g. for the audit
+type DeleteEventLogger interface {
+	LogDeleteEvent(event DeleteEvent)
+}
+
+// JSONDeleteEventLogger writes every delete event as the separate JSON line
+type JSONDeleteEventLogger struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewJSONDeleteEventLogger(output io.Writer) *JSONDeleteEventLogger {
+	return &JSONDeleteEventLogger{encoder: json.NewEncoder(output)}
+}
+
+func (logger *JSONDeleteEventLogger) LogDeleteEvent(event DeleteEvent) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	if err := logger.encoder.Encode(event); err != nil {
+		tracelog.WarningLogger.Printf("Failed to write the delete event of '%s': %v\n", event.Object, err)
+	}
+}
+
+// ConfigureDeleteEventLogger creates the delete event logger appending to the WALG_DELETE_EVENT_LOG file,
+// '-' means the standard output. Returns nil if the setting is not set.
+func ConfigureDeleteEventLogger() (DeleteEventLogger, error) {
+	eventLogPath := viper.GetString(DeleteEventLogSetting)
+	if eventLogPath == "" {
+		return nil, nil
+	}
+	if eventLogPath == deleteEventLogStdout {
+		return NewJSONDeleteEventLogger(os.Stdout), nil
+	}
+	// the file is left open until the process exits, as the delete events are written to the very end
+	file, err := os.OpenFile(eventLogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open the delete event log '%s'", eventLogPath)
+	}
+	return NewJSONDeleteEventLogger(file), nil
+}
+
+// newDeleteEvent creates the event of the decision made for the object at the current time
+func newDeleteEvent(objectName string, permanent, shouldDelete bool, reason string, dryRun bool) DeleteEvent {
+	action := DeleteEventActionKeep
+	if shouldDelete {
+		action = DeleteEventActionDelete
+	}
+	return DeleteEvent{
+		Time:      utility.TimeNowCrossPlatformUTC(),
+		Object:    objectName,
+		Permanent: permanent,
+		Action:    action,
+		Reason:    reason,
+		DryRun:    dryRun,
+	}
+}
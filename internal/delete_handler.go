@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -21,7 +22,9 @@ const (
 	FindFullDeleteModifier
 	ForceDeleteModifier
 	ConfirmFlag            = "confirm"
+	ForceFlag              = "force"
 	DeleteShortDescription = "Clears old backups and WALs"
+	ForceDeleteDescription = "Allows to delete the last full backups, leaving no backup to restore"
 
 	DeleteRetainExamples = `  retain 5                      keep 5 backups
   retain FULL 5                 keep 5 full backups and all deltas of them
@@ -38,15 +41,23 @@ const (
 	DeleteTargetExamples = `  target base_0000000100000000000000C4	delete base backup by name
   target --target-user-data "{ \"x\": [3], \"y\": 4 }"	delete backup specified by user data
   target base_0000000100000000000000C9_D_0000000100000000000000C4	delete delta backup and all dependant delta backups 
-  target FIND_FULL base_0000000100000000000000C9_D_0000000100000000000000C4	delete delta backup and all delta backups with the same base backup`  //nolint:lll
+  target FIND_FULL base_0000000100000000000000C9_D_0000000100000000000000C4	delete delta backup and all delta backups with the same base backup
+  target --pattern "base_00000001000000000000000?"	delete backups which names match the glob pattern and all dependant delta backups
+  target --after 2019-12-12T00:00:00Z --before 2020-01-01T00:00:00Z	delete backups created within the time range and all dependant delta backups`  //nolint:lll
 
 	DeleteEverythingUsageExample = "everything [FORCE]"
 	DeleteRetainUsageExample     = "retain [FULL|FIND_FULL] backup_count"
 	DeleteBeforeUsageExample     = "before [FIND_FULL] backup_name|timestamp"
-	DeleteTargetUsageExample     = "target [FIND_FULL] backup_name | --target-user-data <data>"
+	DeleteTargetUsageExample     = "target [FIND_FULL] backup_name | --target-user-data <data> | --after <time> --before <time>"
 
 	DeleteTargetUserDataFlag        = "target-user-data"
 	DeleteTargetUserDataDescription = "delete storage backup which has the specified user data"
+	DeleteTargetAfterFlag           = "after"
+	DeleteTargetAfterDescription    = "delete storage backups created at or after the specified RFC 3339 time"
+	DeleteTargetBeforeFlag          = "before"
+	DeleteTargetBeforeDescription   = "delete storage backups created before the specified RFC 3339 time"
+	DeleteTargetPatternFlag         = "pattern"
+	DeleteTargetPatternDescription  = "treat the target name as the glob pattern, or as the regular expression with --pattern=regex"
 )
 
 var StringModifiers = []string{"FULL", "FIND_FULL"}
@@ -54,6 +65,30 @@ var StringModifiersDeleteEverything = []string{"FORCE"}
 var errNotFound = errors.New("not found")
 var errIncorrectArguments = errors.New("incorrect arguments")
 
+// DeleteObjectsError lists the objects the delete failed to delete, the other objects are deleted
+type DeleteObjectsError struct {
+	error
+	FailedObjects []string
+}
+
+func newDeleteObjectsError(failures map[string]error, objectCount int) DeleteObjectsError {
+	failedObjects := make([]string, 0, len(failures))
+	for name := range failures {
+		failedObjects = append(failedObjects, name)
+	}
+	sort.Strings(failedObjects)
+	descriptions := make([]string, 0, len(failedObjects))
+	for _, name := range failedObjects {
+		descriptions = append(descriptions, fmt.Sprintf("'%s': %v", name, failures[name]))
+	}
+	return DeleteObjectsError{errors.Errorf("failed to delete %d of %d objects: %s",
+		len(failedObjects), objectCount, strings.Join(descriptions, "; ")), failedObjects}
+}
+
+func (err DeleteObjectsError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
 // BackupObject represents
 // the backup sentinel object uploaded on storage
 type BackupObject interface {
@@ -81,6 +116,45 @@ func IsIgnoredFunc(isIgnored func(storage.Object) bool) DeleteHandlerOption {
 	}
 }
 
+// AllowDeleteLastFullBackup makes the handler delete the last remaining full backups,
+// which is forbidden by default since it leaves no backup to restore
+func AllowDeleteLastFullBackup(allow bool) DeleteHandlerOption {
+	return func(h *DeleteHandler) {
+		h.allowDeleteLastFull = allow
+	}
+}
+
+// DeleteMetrics makes the handler record the deleted objects to the metrics, nil metrics record nothing
+func DeleteMetrics(metrics *PrometheusMetrics) DeleteHandlerOption {
+	return func(h *DeleteHandler) {
+		h.metrics = metrics
+	}
+}
+
+// DeleteConcurrency makes the handler delete the objects by the given number of workers
+// instead of WALG_DELETE_CONCURRENCY ones
+func DeleteConcurrency(concurrency int) DeleteHandlerOption {
+	return func(h *DeleteHandler) {
+		h.concurrency = concurrency
+	}
+}
+
+// DeleteToTrash makes the handler move the deleted objects to the trash instead of removing them,
+// nil trash removes them
+func DeleteToTrash(trash *DeleteTrash) DeleteHandlerOption {
+	return func(h *DeleteHandler) {
+		h.trash = trash
+	}
+}
+
+// DeleteEvents makes the handler record the decision made for every listed object to the logger,
+// nil logger records nothing
+func DeleteEvents(logger DeleteEventLogger) DeleteHandlerOption {
+	return func(h *DeleteHandler) {
+		h.events = logger
+	}
+}
+
 func NewDeleteHandler(
 	folder storage.Folder,
 	backups []BackupObject,
@@ -99,7 +173,6 @@ func NewDeleteHandler(
 		// by default, all storage objects are not ignored
 		isIgnored: func(storage.Object) bool { return false },
 	}
-
 	for _, option := range options {
 		option(deleteHandler)
 	}
@@ -116,8 +189,19 @@ type DeleteHandler struct {
 
 	isPermanent func(object storage.Object) bool
 	isIgnored   func(object storage.Object) bool
+
+	allowDeleteLastFull bool
+	metrics             *PrometheusMetrics
+	events              DeleteEventLogger
+	concurrency         int
+	trash               *DeleteTrash
+	// isTrashPurged makes the expired objects be removed from the trash once per command
+	isTrashPurged bool
 }
 
+// deleteDecisionFunc decides whether the object is deleted and returns the reason of the decision
+type deleteDecisionFunc func(object storage.Object) (bool, string)
+
 func (h *DeleteHandler) HandleDeleteBefore(args []string, confirmed bool) {
 	modifier, beforeStr := ExtractDeleteModifierFromArgs(args)
 
@@ -165,35 +249,62 @@ func (h *DeleteHandler) HandleDeleteRetainAfter(args []string, confirmed bool) {
 }
 
 func (h *DeleteHandler) HandleDeleteTarget(targetSelector BackupSelector, confirmed, findFull bool) {
-	targetName, err := targetSelector.Select(h.Folder)
+	targetNames, err := selectTargetNames(targetSelector, h.Folder)
 	tracelog.ErrorLogger.FatalOnError(err)
 
-	var target BackupObject
-	for idx := range h.backups {
-		if h.backups[idx].GetBackupName() == targetName {
-			target = h.backups[idx]
-			break
+	backupsToDelete := make([]BackupObject, 0)
+	selectedNames := make(map[string]bool)
+	for _, target := range h.findTargets(targetNames) {
+		var targetBackups []BackupObject
+		if findFull {
+			// delete all backups with the same base backup as the target
+			targetBackups = h.findRelatedBackups(target)
+		} else {
+			// delete all dependant backups
+			targetBackups = h.findDependantBackups(target)
+		}
+		for _, backup := range targetBackups {
+			if !selectedNames[backup.GetBackupName()] {
+				selectedNames[backup.GetBackupName()] = true
+				backupsToDelete = append(backupsToDelete, backup)
+			}
 		}
 	}
 
-	if target == nil {
+	if len(backupsToDelete) == 0 {
 		tracelog.InfoLogger.Printf("No backup found for deletion")
 		os.Exit(0)
 	}
 
-	var backupsToDelete []BackupObject
-	if findFull {
-		// delete all backups with the same base backup as the target
-		backupsToDelete = h.findRelatedBackups(target)
-	} else {
-		// delete all dependant backups
-		backupsToDelete = h.findDependantBackups(target)
-	}
-
 	err = h.DeleteTargets(backupsToDelete, confirmed)
 	tracelog.ErrorLogger.FatalOnError(err)
 }
 
+// selectTargetNames selects the names of the backups to delete, several ones if the selector supports it
+func selectTargetNames(targetSelector BackupSelector, folder storage.Folder) ([]string, error) {
+	if multipleSelector, ok := targetSelector.(MultipleBackupSelector); ok {
+		return multipleSelector.SelectAll(folder)
+	}
+	targetName, err := targetSelector.Select(folder)
+	if err != nil {
+		return nil, err
+	}
+	return []string{targetName}, nil
+}
+
+func (h *DeleteHandler) findTargets(targetNames []string) []BackupObject {
+	targets := make([]BackupObject, 0, len(targetNames))
+	for _, targetName := range targetNames {
+		for idx := range h.backups {
+			if h.backups[idx].GetBackupName() == targetName {
+				targets = append(targets, h.backups[idx])
+				break
+			}
+		}
+	}
+	return targets
+}
+
 func (h *DeleteHandler) HandleDeleteEverything(args []string, permanentBackups map[string]bool, confirmed bool) {
 	forceModifier := false
 	modifier := ExtractDeleteEverythingModifierFromArgs(args)
@@ -342,8 +453,9 @@ func (h *DeleteHandler) FindTargetRetainAfterTime(retentionCount int, timeLine t
 }
 
 func (h *DeleteHandler) DeleteEverything(confirmed bool) {
-	filter := func(object storage.Object) bool { return true }
-	err := storage.DeleteObjectsWhere(h.Folder, confirmed, filter)
+	decide := func(object storage.Object) (bool, string) { return true, "deleting everything" }
+	// the permanent backups are deleted only with FORCE, which is checked by HandleDeleteEverything
+	err := h.deleteObjectsWhere(h.Folder, confirmed, decide, true)
 	tracelog.ErrorLogger.FatalOnError(err)
 }
 
@@ -358,24 +470,300 @@ func (h *DeleteHandler) DeleteBeforeTargetWhere(target BackupObject, confirmed b
 	}
 	tracelog.InfoLogger.Println("Start delete")
 
-	return storage.DeleteObjectsWhere(h.Folder, confirmed, func(object storage.Object) bool {
-		return selector(object) && h.less(object, target) && !h.isPermanent(object) && !h.isIgnored(object)
-	})
+	return h.deleteObjectsWhere(h.Folder, confirmed, func(object storage.Object) (bool, string) {
+		switch {
+		case !selector(object):
+			return false, "not selected by the delete mode"
+		case !h.less(object, target):
+			return false, fmt.Sprintf("not older than the target backup %s", target.GetBackupName())
+		case h.isPermanent(object):
+			return false, "permanent"
+		case h.isIgnored(object):
+			return false, "ignored"
+		default:
+			return true, fmt.Sprintf("older than the target backup %s", target.GetBackupName())
+		}
+	}, false)
 }
 
 func (h *DeleteHandler) DeleteTargets(targets []BackupObject, confirmed bool) error {
 	backupNamesToDelete := make(map[string]bool)
 	for _, target := range targets {
 		if h.isPermanent(target) {
+			h.logDeleteEvent(newDeleteEvent(target.GetName(), true, false, "permanent delete target", !confirmed))
 			tracelog.ErrorLogger.Fatalf("Unable to delete permanent backup %s\n", target.GetName())
 		}
 		backupNamesToDelete[target.GetBackupName()] = true
 	}
+	if !h.allowDeleteLastFull {
+		if err := h.checkRestorableBackupRemains(backupNamesToDelete); err != nil {
+			return err
+		}
+	}
+
+	return h.deleteObjectsWhere(h.Folder.GetSubFolder(utility.BaseBackupPath),
+		confirmed, func(object storage.Object) (bool, string) {
+			backupName := utility.StripLeftmostBackupName(object.GetName())
+			switch {
+			case !backupNamesToDelete[backupName]:
+				return false, "not a delete target"
+			case h.isPermanent(object):
+				return false, "permanent"
+			case h.isIgnored(object):
+				return false, "ignored"
+			default:
+				return true, fmt.Sprintf("belongs to the delete target %s", backupName)
+			}
+		}, false)
+}
+
+// deleteObjectsWhere deletes the objects like storage.DeleteObjectsWhere does, records the decision made
+// for every object to the delete events and the deleted objects, bytes and backups to the metrics.
+// The objects are deleted by the bounded pool of workers, see deleteObjects.
+func (h *DeleteHandler) deleteObjectsWhere(folder storage.Folder, confirmed bool, decide deleteDecisionFunc,
+	deletePermanent bool) error {
+	// the objects are reported relative to the handler folder, as the delete folder may be its subfolder
+	folderPrefix := strings.TrimPrefix(folder.GetPath(), h.Folder.GetPath())
+	objects, err := storage.ListFolderRecursively(folder)
+	if err != nil {
+		return err
+	}
+	objectsToDelete := make([]storage.Object, 0)
+	tracelog.InfoLogger.Println("Objects in folder:")
+	for _, object := range objects {
+		if h.trash != nil && h.trash.contains(folderPrefix+object.GetName()) {
+			// the trashed objects are removed only once they expire
+			continue
+		}
+		shouldDelete, reason := decide(object)
+		if h.events != nil {
+			h.logDeleteEvent(newDeleteEvent(folderPrefix+object.GetName(),
+				h.isPermanent(object), shouldDelete, reason, !confirmed))
+		}
+		if shouldDelete {
+			tracelog.InfoLogger.Println("\twill be deleted: " + object.GetName())
+			objectsToDelete = append(objectsToDelete, object)
+		} else {
+			tracelog.DebugLogger.Println("\tskipped: " + object.GetName())
+		}
+	}
+	if h.trash != nil && confirmed && !h.isTrashPurged {
+		h.isTrashPurged = true
+		if err := h.trash.Purge(h.Folder); err != nil {
+			tracelog.WarningLogger.Printf("Failed to remove the expired objects from the trash: %v\n", err)
+		}
+	}
+	if len(objectsToDelete) == 0 {
+		return nil
+	}
+	if !confirmed {
+		tracelog.InfoLogger.Println("Dry run, nothing were deleted")
+		return nil
+	}
 
-	return storage.DeleteObjectsWhere(h.Folder.GetSubFolder(utility.BaseBackupPath),
-		confirmed, func(object storage.Object) bool {
-			return backupNamesToDelete[utility.StripLeftmostBackupName(object.GetName())] && !h.isPermanent(object) && !h.isIgnored(object)
-		})
+	startTime := utility.TimeNowCrossPlatformUTC()
+	deletedObjects, err := h.deleteObjects(folder, objectsToDelete, deletePermanent)
+	if h.metrics != nil {
+		var bytes, backups int64
+		for _, object := range deletedObjects {
+			bytes += object.GetSize()
+			if strings.HasSuffix(object.GetName(), utility.SentinelSuffix) {
+				backups++
+			}
+		}
+		h.recordDeleteMetrics(int64(len(deletedObjects)), bytes, backups, time.Since(startTime), err)
+	}
+	return err
+}
+
+// deleteObjectsChunkSize is the number of the objects deleted by one storage request, the limit of S3
+const deleteObjectsChunkSize = 1000
+
+// deleteObjects deletes the objects in chunks by the pool of WALG_DELETE_CONCURRENCY workers, the failure
+// to delete one object does not stop the deletion of the others. Every object is checked to be impermanent
+// right before its deletion, unless deletePermanent is set. Returns the deleted objects and DeleteObjectsError
+// listing the objects not deleted, if any.
+func (h *DeleteHandler) deleteObjects(folder storage.Folder, objects []storage.Object,
+	deletePermanent bool) ([]storage.Object, error) {
+	concurrency := h.concurrency
+	if concurrency < MinAllowedConcurrency {
+		var err error
+		concurrency, err = GetMaxConcurrency(DeleteConcurrencySetting)
+		if err != nil {
+			tracelog.WarningLogger.Printf("%v, deleting the objects by %d workers\n", err, concurrency)
+		}
+	}
+	chunks := make([][]storage.Object, 0, (len(objects)+deleteObjectsChunkSize-1)/deleteObjectsChunkSize)
+	for i := 0; i < len(objects); i += deleteObjectsChunkSize {
+		end := i + deleteObjectsChunkSize
+		if end > len(objects) {
+			end = len(objects)
+		}
+		chunks = append(chunks, objects[i:end])
+	}
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	deletedObjects := make([]storage.Object, 0, len(objects))
+	failures := make(map[string]error)
+	chunksToDelete := make(chan []storage.Object)
+	for i := 0; i < concurrency && i < len(chunks); i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for chunk := range chunksToDelete {
+				chunkDeleted, chunkFailures := h.deleteChunk(folder, chunk, deletePermanent)
+				mutex.Lock()
+				deletedObjects = append(deletedObjects, chunkDeleted...)
+				for name, err := range chunkFailures {
+					failures[name] = err
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, chunk := range chunks {
+		chunksToDelete <- chunk
+	}
+	close(chunksToDelete)
+	waitGroup.Wait()
+
+	if len(failures) > 0 {
+		return deletedObjects, newDeleteObjectsError(failures, len(objects))
+	}
+	return deletedObjects, nil
+}
+
+// deleteChunk deletes the impermanent objects of the chunk by one storage request. If it fails, the objects
+// are deleted one by one, so only the failing ones are reported. The trashed objects are always moved one by one.
+func (h *DeleteHandler) deleteChunk(folder storage.Folder, objects []storage.Object,
+	deletePermanent bool) ([]storage.Object, map[string]error) {
+	if h.trash != nil {
+		return h.deleteEachObject(folder, objects, deletePermanent)
+	}
+	failures := make(map[string]error)
+	objectsToDelete := make([]storage.Object, 0, len(objects))
+	paths := make([]string, 0, len(objects))
+	for _, object := range objects {
+		if !deletePermanent && h.isPermanent(object) {
+			failures[object.GetName()] = errors.New("the object is permanent")
+			continue
+		}
+		objectsToDelete = append(objectsToDelete, object)
+		paths = append(paths, object.GetName())
+	}
+	if len(paths) == 0 {
+		return nil, failures
+	}
+	lockedPaths, err := storage.DeleteUnlockedObjects(folder, paths)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to delete %d objects at once, deleting them one by one: %v\n",
+			len(paths), err)
+		deletedObjects, eachFailures := h.deleteEachObject(folder, objectsToDelete, deletePermanent)
+		for name, err := range eachFailures {
+			failures[name] = err
+		}
+		return deletedObjects, failures
+	}
+	isLocked := make(map[string]bool, len(lockedPaths))
+	for _, lockedPath := range lockedPaths {
+		isLocked[lockedPath] = true
+	}
+	deletedObjects := make([]storage.Object, 0, len(objectsToDelete))
+	for _, object := range objectsToDelete {
+		if !isLocked[object.GetName()] {
+			deletedObjects = append(deletedObjects, object)
+		}
+	}
+	return deletedObjects, failures
+}
+
+// deleteEachObject deletes the objects one by one, see deleteObject
+func (h *DeleteHandler) deleteEachObject(folder storage.Folder, objects []storage.Object,
+	deletePermanent bool) ([]storage.Object, map[string]error) {
+	deletedObjects := make([]storage.Object, 0, len(objects))
+	failures := make(map[string]error)
+	for _, object := range objects {
+		isDeleted, err := h.deleteObject(folder, object, deletePermanent)
+		if err != nil {
+			failures[object.GetName()] = err
+		} else if isDeleted {
+			deletedObjects = append(deletedObjects, object)
+		}
+	}
+	return deletedObjects, failures
+}
+
+// deleteObject deletes the object or moves it to the trash, if any, unless it is permanent or retention locked.
+// Returns whether it is deleted.
+func (h *DeleteHandler) deleteObject(folder storage.Folder, object storage.Object, deletePermanent bool) (bool, error) {
+	if !deletePermanent && h.isPermanent(object) {
+		return false, errors.New("the object is permanent")
+	}
+	if h.trash != nil {
+		isMoved, err := h.trash.moveToTrash(h.Folder, folder, object.GetName())
+		if err != nil {
+			tracelog.ErrorLogger.Printf("Failed to move '%s' to the trash: %v\n", object.GetName(), err)
+		}
+		return isMoved && err == nil, err
+	}
+	lockedPaths, err := storage.DeleteUnlockedObjects(folder, []string{object.GetName()})
+	if err != nil {
+		tracelog.ErrorLogger.Printf("Failed to delete '%s': %v\n", object.GetName(), err)
+		return false, err
+	}
+	return len(lockedPaths) == 0, nil
+}
+
+func (h *DeleteHandler) logDeleteEvent(event DeleteEvent) {
+	if h.events != nil {
+		h.events.LogDeleteEvent(event)
+	}
+}
+
+func (h *DeleteHandler) recordDeleteMetrics(objects, bytes, backups int64, duration time.Duration, err error) {
+	success := 1.0
+	if err != nil {
+		success = 0
+	}
+	h.metrics.Add("deleted_objects", "Number of the objects deleted by the last delete", float64(objects))
+	h.metrics.Add("deleted_bytes", "Size of the objects deleted by the last delete in bytes", float64(bytes))
+	h.metrics.Add("deleted_backups", "Number of the backups deleted by the last delete", float64(backups))
+	h.metrics.Add("duration_seconds", "Duration of the last delete in seconds", duration.Seconds())
+	h.metrics.Set("success", "Whether the last delete succeeded", success)
+	h.metrics.Set("timestamp_seconds", "Time the last delete finished as the Unix timestamp",
+		float64(utility.TimeNowCrossPlatformUTC().Unix()))
+	if pushErr := h.metrics.Push(); pushErr != nil {
+		tracelog.WarningLogger.Printf("Failed to expose the delete metrics: %v\n", pushErr)
+	}
+}
+
+// checkRestorableBackupRemains forbids the deletion of the last remaining full backups, since no restore chain
+// survives it and the remaining increments become orphaned
+func (h *DeleteHandler) checkRestorableBackupRemains(backupNamesToDelete map[string]bool) error {
+	deletedFullBackups := make([]string, 0)
+	orphanedBackups := make([]string, 0)
+	for _, backup := range h.backups {
+		deleted := backupNamesToDelete[backup.GetBackupName()]
+		switch {
+		case backup.IsFullBackup() && !deleted:
+			return nil
+		case backup.IsFullBackup():
+			deletedFullBackups = append(deletedFullBackups, backup.GetBackupName())
+		case !deleted:
+			orphanedBackups = append(orphanedBackups, backup.GetBackupName())
+		}
+	}
+	if len(deletedFullBackups) == 0 {
+		return nil
+	}
+	sort.Strings(deletedFullBackups)
+	sort.Strings(orphanedBackups)
+	message := fmt.Sprintf("deleting %v leaves no full backup to restore", deletedFullBackups)
+	if len(orphanedBackups) > 0 {
+		message += fmt.Sprintf(", the backups %v would be orphaned", orphanedBackups)
+	}
+	return utility.NewForbiddenActionError(fmt.Sprintf("%s. Use the --%s flag to delete anyway.", message, ForceFlag))
 }
 
 // Find all backups related to the target.
@@ -557,8 +945,9 @@ func DeleteTargetArgsValidator(cmd *cobra.Command, args []string) error {
 	}
 
 	switch {
-	case len(args) == 0 && !cmd.Flags().Changed(DeleteTargetUserDataFlag):
-		// allow 0 arguments only when target user data flag is set
+	case len(args) == 0 && !cmd.Flags().Changed(DeleteTargetUserDataFlag) &&
+		!cmd.Flags().Changed(DeleteTargetAfterFlag) && !cmd.Flags().Changed(DeleteTargetBeforeFlag):
+		// allow 0 arguments only when target user data or time range flag is set
 		return errIncorrectArguments
 
 	case len(args) == 2 && args[0] != StringModifiers[1]:
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// DeleteTrash is the folder of the storage the deleted objects are moved to instead of being removed,
+// so the accidentally deleted backups can be restored with backup-restore-deleted. The trashed objects
+// keep their paths relative to the storage root under the trash prefix. The objects kept in the trash
+// longer than the retention are removed by the next delete.
+type DeleteTrash struct {
+	prefix    string
+	retention time.Duration
+}
+
+func NewDeleteTrash(prefix string, retention time.Duration) *DeleteTrash {
+	return &DeleteTrash{prefix: strings.Trim(prefix, "/"), retention: retention}
+}
+
+// ConfigureDeleteTrash creates the trash from the settings, returns nil if WALG_DELETE_TRASH_PREFIX is not set
+func ConfigureDeleteTrash() (*DeleteTrash, error) {
+	prefix := strings.Trim(viper.GetString(DeleteTrashPrefixSetting), "/")
+	if prefix == "" {
+		return nil, nil
+	}
+	retention, err := GetDurationSetting(DeleteTrashRetentionSetting)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeleteTrash(prefix, retention), nil
+}
+
+// Folder returns the trash folder of the storage
+func (trash *DeleteTrash) Folder(rootFolder storage.Folder) storage.Folder {
+	return rootFolder.GetSubFolder(trash.prefix)
+}
+
+// contains returns whether the object path relative to the storage root is in the trash
+func (trash *DeleteTrash) contains(objectPath string) bool {
+	return strings.HasPrefix(objectPath, trash.prefix+"/")
+}
+
+// moveToTrash moves the object of the folder to the trash, the retention locked objects are skipped.
+// Returns whether the object is moved.
+func (trash *DeleteTrash) moveToTrash(rootFolder, folder storage.Folder, objectName string) (bool, error) {
+	if lockFolder, ok := folder.(storage.RetentionLockFolder); ok {
+		locked, err := lockFolder.IsRetentionLocked(objectName)
+		if err != nil {
+			return false, err
+		}
+		if locked {
+			tracelog.WarningLogger.Println("	skipped due to the retention lock: " + objectName)
+			return false, nil
+		}
+	}
+	objectPath := strings.TrimPrefix(folder.GetPath(), rootFolder.GetPath()) + objectName
+	return true, moveObject(rootFolder, objectPath, path.Join(trash.prefix, objectPath))
+}
+
+// Purge removes the objects kept in the trash longer than the retention
+func (trash *DeleteTrash) Purge(rootFolder storage.Folder) error {
+	trashFolder := trash.Folder(rootFolder)
+	objects, err := storage.ListFolderRecursively(trashFolder)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the trash")
+	}
+	expirationTime := utility.TimeNowCrossPlatformUTC().Add(-trash.retention)
+	expiredPaths := make([]string, 0)
+	for _, object := range objects {
+		if object.GetLastModified().Before(expirationTime) {
+			expiredPaths = append(expiredPaths, object.GetName())
+		}
+	}
+	if len(expiredPaths) == 0 {
+		return nil
+	}
+	tracelog.InfoLogger.Printf("Removing %d objects kept in the trash longer than %v\n", len(expiredPaths), trash.retention)
+	_, err = storage.DeleteUnlockedObjects(trashFolder, expiredPaths)
+	return err
+}
+
+// RestoreDeleted moves the objects of the trashed backup back to their paths, all the trashed objects
+// if the backup name is empty. The objects existing at their paths are not overwritten and are kept
+// in the trash. Returns the number of the restored objects.
+func (trash *DeleteTrash) RestoreDeleted(rootFolder storage.Folder, backupName string) (int, error) {
+	trashFolder := trash.Folder(rootFolder)
+	objectPaths, err := trash.findTrashedObjects(trashFolder, backupName)
+	if err != nil {
+		return 0, err
+	}
+	restoredCount := 0
+	for _, objectPath := range objectPaths {
+		exists, err := rootFolder.Exists(objectPath)
+		if err != nil {
+			return restoredCount, err
+		}
+		if exists {
+			tracelog.WarningLogger.Printf("'%s' exists, its deleted version is kept in the trash\n", objectPath)
+			continue
+		}
+		if err = moveObject(rootFolder, path.Join(trash.prefix, objectPath), objectPath); err != nil {
+			return restoredCount, err
+		}
+		tracelog.InfoLogger.Println("\trestored: " + objectPath)
+		restoredCount++
+	}
+	return restoredCount, nil
+}
+
+// findTrashedObjects returns the paths of the trashed objects of the backup relative to the storage root,
+// all of them if the backup name is empty
+func (trash *DeleteTrash) findTrashedObjects(trashFolder storage.Folder, backupName string) ([]string, error) {
+	if backupName == "" {
+		objects, err := storage.ListFolderRecursively(trashFolder)
+		if err != nil {
+			return nil, err
+		}
+		objectPaths := make([]string, 0, len(objects))
+		for _, object := range objects {
+			objectPaths = append(objectPaths, object.GetName())
+		}
+		return objectPaths, nil
+	}
+
+	backups, err := FindBackupObjects(trashFolder)
+	if err != nil {
+		return nil, err
+	}
+	isTrashed := false
+	for _, backup := range backups {
+		isTrashed = isTrashed || backup.GetBackupName() == backupName
+	}
+	if !isTrashed {
+		return nil, errors.Errorf("backup '%s' is not found in the trash", backupName)
+	}
+	objects, err := storage.ListFolderRecursively(trashFolder.GetSubFolder(utility.BaseBackupPath))
+	if err != nil {
+		return nil, err
+	}
+	objectPaths := make([]string, 0)
+	for _, object := range objects {
+		if utility.StripLeftmostBackupName(object.GetName()) == backupName {
+			objectPaths = append(objectPaths, utility.BaseBackupPath+object.GetName())
+		}
+	}
+	return objectPaths, nil
+}
+
+// moveObject moves the object between the paths relative to the folder
+func moveObject(folder storage.Folder, srcPath, dstPath string) error {
+	if err := folder.CopyObject(srcPath, dstPath); err != nil {
+		return errors.Wrapf(err, "failed to copy '%s' to '%s'", srcPath, dstPath)
+	}
+	return folder.DeleteObjects([]string{srcPath})
+}
+
+// HandleBackupRestoreDeleted is invoked to perform wal-g backup-restore-deleted
+func HandleBackupRestoreDeleted(folder storage.Folder, backupName string) {
+	trash, err := ConfigureDeleteTrash()
+	tracelog.ErrorLogger.FatalOnError(err)
+	if trash == nil {
+		tracelog.ErrorLogger.Fatalf("%s is not set, the deleted objects are not kept\n", DeleteTrashPrefixSetting)
+	}
+	restoredCount, err := trash.RestoreDeleted(folder, backupName)
+	tracelog.ErrorLogger.FatalfOnError("Failed to restore the deleted objects: %v\n", err)
+	tracelog.InfoLogger.Printf("Restored %d deleted objects\n", restoredCount)
+}
@@ -0,0 +1,139 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	trashTestPrefix      = "trash"
+	trashTestFullBackup  = "base_000000010000000000000007"
+	trashTestDeltaBackup = "base_000000010000000000000009_D_000000010000000000000007"
+)
+
+func newTrashTestDeleteHandler(t *testing.T, folder storage.Folder, trash *internal.DeleteTrash,
+	options ...internal.DeleteHandlerOption) *internal.DeleteHandler {
+	backups, err := internal.FindBackupObjects(folder)
+	require.NoError(t, err)
+	lessByBackupName := func(object1, object2 storage.Object) bool {
+		return strings.TrimPrefix(object1.GetName(), utility.BaseBackupPath) <
+			strings.TrimPrefix(object2.GetName(), utility.BaseBackupPath)
+	}
+	options = append(options, internal.DeleteToTrash(trash), internal.AllowDeleteLastFullBackup(true))
+	return internal.NewDeleteHandler(folder, backups, lessByBackupName, options...)
+}
+
+func findTrashTestBackups(t *testing.T, folder storage.Folder) []string {
+	backups, err := internal.FindBackupObjects(folder)
+	require.NoError(t, err)
+	backupNames := make([]string, 0, len(backups))
+	for _, backup := range backups {
+		backupNames = append(backupNames, backup.GetBackupName())
+	}
+	return backupNames
+}
+
+func findTrashTestBackup(t *testing.T, folder storage.Folder, backupName string) internal.BackupObject {
+	backups, err := internal.FindBackupObjects(folder)
+	require.NoError(t, err)
+	for _, backup := range backups {
+		if backup.GetBackupName() == backupName {
+			return backup
+		}
+	}
+	require.FailNow(t, "backup is not found", backupName)
+	return nil
+}
+
+func TestDeleteTargets_MovesToTrashAndRestores(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	trash := internal.NewDeleteTrash(trashTestPrefix, time.Hour)
+	deleteHandler := newTrashTestDeleteHandler(t, folder, trash)
+
+	err := deleteHandler.DeleteTargets([]internal.BackupObject{findTrashTestBackup(t, folder, trashTestDeltaBackup)}, true)
+
+	require.NoError(t, err)
+	assert.NotContains(t, findTrashTestBackups(t, folder), trashTestDeltaBackup)
+	assert.Equal(t, []string{trashTestDeltaBackup}, findTrashTestBackups(t, trash.Folder(folder)))
+
+	restoredCount, err := trash.RestoreDeleted(folder, trashTestDeltaBackup)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, restoredCount)
+	assert.Contains(t, findTrashTestBackups(t, folder), trashTestDeltaBackup)
+	assert.Empty(t, findTrashTestBackups(t, trash.Folder(folder)))
+}
+
+func TestDeleteTargets_PurgesTrashOncePerHandler(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	trash := internal.NewDeleteTrash(trashTestPrefix, time.Millisecond)
+	deleteHandler := newTrashTestDeleteHandler(t, folder, trash)
+	otherDeltaBackup := "base_000000010000000000000005_D_000000010000000000000003"
+
+	err := deleteHandler.DeleteTargets([]internal.BackupObject{findTrashTestBackup(t, folder, trashTestDeltaBackup)}, true)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	err = deleteHandler.DeleteTargets([]internal.BackupObject{findTrashTestBackup(t, folder, otherDeltaBackup)}, true)
+	require.NoError(t, err)
+
+	// the expired objects trashed by the first deletion are kept until the next command
+	assert.ElementsMatch(t, []string{trashTestDeltaBackup, otherDeltaBackup}, findTrashTestBackups(t, trash.Folder(folder)))
+}
+
+func TestDeleteBeforeTarget_DoesNotTrashPermanentBackups(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	trash := internal.NewDeleteTrash(trashTestPrefix, time.Hour)
+	permanentBackups := map[string]bool{"base_000000010000000000000003": true}
+	deleteHandler := newTrashTestDeleteHandler(t, folder, trash, internal.IsPermanentFunc(func(object storage.Object) bool {
+		return internal.IsPermanent(object.GetName(), permanentBackups)
+	}))
+
+	err := deleteHandler.DeleteBeforeTarget(findTrashTestBackup(t, folder, trashTestFullBackup), true)
+
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"base_000000010000000000000003", trashTestFullBackup, trashTestDeltaBackup},
+		findTrashTestBackups(t, folder))
+	assert.Equal(t, []string{"base_000000010000000000000005_D_000000010000000000000003"},
+		findTrashTestBackups(t, trash.Folder(folder)))
+}
+
+func TestDeleteTrash_RestoreDeletedDoesNotOverwrite(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithDeltaBackups(t)
+	trash := internal.NewDeleteTrash(trashTestPrefix, time.Hour)
+	sentinelPath := utility.BaseBackupPath + trashTestDeltaBackup + utility.SentinelSuffix
+	require.NoError(t, trash.Folder(folder).PutObject(sentinelPath, strings.NewReader("{}")))
+
+	restoredCount, err := trash.RestoreDeleted(folder, trashTestDeltaBackup)
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, restoredCount)
+	assert.Equal(t, []string{trashTestDeltaBackup}, findTrashTestBackups(t, trash.Folder(folder)))
+
+	_, err = trash.RestoreDeleted(folder, "base_000000010000000000000011")
+	assert.Error(t, err)
+}
+
+func TestDeleteTrash_PurgesExpiredObjects(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	trash := internal.NewDeleteTrash(trashTestPrefix, time.Hour)
+	require.NoError(t, trash.Folder(folder).PutObject("wal_005/000000010000000000000001", strings.NewReader("wal")))
+
+	require.NoError(t, trash.Purge(folder))
+	exists, err := trash.Folder(folder).Exists("wal_005/000000010000000000000001")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, internal.NewDeleteTrash(trashTestPrefix, time.Millisecond).Purge(folder))
+	exists, err = trash.Folder(folder).Exists("wal_005/000000010000000000000001")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
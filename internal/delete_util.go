@@ -3,45 +3,99 @@ package internal
 import (
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"github.com/wal-g/wal-g/utility"
 )
 
-func FindPermanentBackups(folder storage.Folder, metaFetcher GenericMetaFetcher) map[string]bool {
+// backupFileSuffixPrefix starts the names of the backup files stored next to the backup folders, e.g. the sentinel
+const backupFileSuffixPrefix = "_backup"
+
+// FindPermanentBackups returns the names of the permanent backups. The backups which meta can't be fetched
+// are treated as impermanent, but the failure to list the backups is returned, since treating all of them
+// as impermanent may make the delete remove the permanent ones.
+// The metadata is fetched by WALG_META_FETCH_CONCURRENCY workers.
+func FindPermanentBackups(folder storage.Folder, metaFetcher GenericMetaFetcher) (map[string]bool, error) {
+	concurrency, err := GetMaxConcurrency(MetaFetchConcurrencySetting)
+	if err != nil {
+		tracelog.WarningLogger.Printf("%v, fetching the metadata by %d workers\n", err, concurrency)
+	}
+	return FindPermanentBackupsConcurrently(folder, metaFetcher, concurrency)
+}
+
+// FindPermanentBackupsConcurrently is FindPermanentBackups fetching the metadata by the given number of workers
+func FindPermanentBackupsConcurrently(folder storage.Folder, metaFetcher GenericMetaFetcher,
+	concurrency int) (map[string]bool, error) {
 	tracelog.InfoLogger.Println("retrieving permanent objects")
 	backupTimes, err := GetBackups(folder.GetSubFolder(utility.BaseBackupPath))
+	if _, ok := err.(NoBackupsFoundError); ok {
+		return map[string]bool{}, nil
+	}
 	if err != nil {
-		return map[string]bool{}
+		return nil, errors.Wrap(err, "failed to list the backups to find the permanent ones")
+	}
+	if concurrency < MinAllowedConcurrency {
+		concurrency = MinAllowedConcurrency
 	}
 
 	permanentBackups := map[string]bool{}
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	backupNames := make(chan string)
+	for i := 0; i < concurrency && i < len(backupTimes); i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for backupName := range backupNames {
+				meta, err := metaFetcher.Fetch(backupName, folder.GetSubFolder(utility.BaseBackupPath))
+				if err != nil {
+					tracelog.ErrorLogger.Printf("failed to fetch backup meta for backup %s with error %s, ignoring...",
+						backupName, err.Error())
+					continue
+				}
+				if meta.IsPermanent {
+					mutex.Lock()
+					permanentBackups[backupName] = true
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
 	for _, backupTime := range backupTimes {
-		meta, err := metaFetcher.Fetch(
-			backupTime.BackupName, folder.GetSubFolder(utility.BaseBackupPath))
-		if err != nil {
-			tracelog.ErrorLogger.Printf("failed to fetch backup meta for backup %s with error %s, ignoring...",
-				backupTime.BackupName, err.Error())
-			continue
-		}
-		if meta.IsPermanent {
-			permanentBackups[backupTime.BackupName] = true
-		}
+		backupNames <- backupTime.BackupName
 	}
-	return permanentBackups
+	close(backupNames)
+	waitGroup.Wait()
+	return permanentBackups, nil
 }
 
 // IsPermanent is a generic function to determine if the storage object is permanent.
-// It does not support permanent WALs or binlogs.
-func IsPermanent(objectName string, permanentBackups map[string]bool, backupNameLength int) bool {
-	if strings.HasPrefix(objectName, utility.BaseBackupPath) &&
-		len(objectName) >= len(utility.BaseBackupPath)+backupNameLength {
-		backup := objectName[len(utility.BaseBackupPath) : len(utility.BaseBackupPath)+backupNameLength]
-		return permanentBackups[backup]
-	}
-	// impermanent backup or binlogs
+// The object belongs to the backup if it is stored in the backup folder, e.g. the tar part or the metadata,
+// or it is the backup file stored next to the folder, e.g. the sentinel. The backup name is matched against
+// the names of the permanent backups, so the backup names of any length are supported.
+// It does not support permanent binlogs, the WAL of the permanent PostgreSQL backups
+// is handled by postgres.IsPermanent.
+func IsPermanent(objectName string, permanentBackups map[string]bool) bool {
+	if !strings.HasPrefix(objectName, utility.BaseBackupPath) {
+		// binlogs and the other objects outside of the backups folder
+		return false
+	}
+	relativeName := strings.TrimLeft(objectName[len(utility.BaseBackupPath):], "/")
+	if separator := strings.Index(relativeName, "/"); separator >= 0 {
+		return permanentBackups[relativeName[:separator]]
+	}
+	for backupName := range permanentBackups {
+		// the prefix is matched up to the backup file suffix, so the backup named as the prefix
+		// of the other backup, e.g. the base of the delta backup, does not match its files
+		if relativeName == backupName || strings.HasPrefix(relativeName, backupName+backupFileSuffixPrefix) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -67,10 +121,65 @@ func CreateTargetDeleteBackupSelector(cmd *cobra.Command,
 		targetName = args[0]
 	}
 
-	backupSelector, err := NewTargetBackupSelector(targetUserData, targetName, metaFetcher)
+	var backupSelector BackupSelector
+	after, before, err := getTargetDeleteTimeRange(cmd)
+	patternMode := getTargetDeletePatternMode(cmd)
+	switch {
+	case err != nil:
+	case after != nil || before != nil:
+		if targetName != "" || targetUserData != "" || patternMode != "" {
+			err = errors.New("incorrect arguments. Specify target backup name, userdata OR time range, not several")
+			break
+		}
+		tracelog.InfoLogger.Println("Selecting the backups within the time range...")
+		backupSelector, err = NewBackupTimeRangeSelector(after, before, metaFetcher, false)
+	case patternMode != "":
+		if targetUserData != "" || targetName == "" {
+			err = errors.New("incorrect arguments. Specify target backup name pattern without userdata")
+			break
+		}
+		tracelog.InfoLogger.Printf("Selecting the backups matching the %s pattern %s...\n", patternMode, targetName)
+		backupSelector, err = NewBackupNamePatternSelector(targetName, patternMode, metaFetcher, false)
+	default:
+		backupSelector, err = NewTargetBackupSelector(targetUserData, targetName, metaFetcher)
+	}
 	if err != nil {
 		fmt.Println(cmd.UsageString())
 		return nil, err
 	}
 	return backupSelector, nil
 }
+
+// getTargetDeletePatternMode returns the pattern mode of the target name set by the command flag, if the command has it
+func getTargetDeletePatternMode(cmd *cobra.Command) string {
+	flag := cmd.Flags().Lookup(DeleteTargetPatternFlag)
+	if flag == nil || !flag.Changed {
+		return ""
+	}
+	return flag.Value.String()
+}
+
+// getTargetDeleteTimeRange returns the time range set by the command flags, if the command has them
+func getTargetDeleteTimeRange(cmd *cobra.Command) (after, before *time.Time, err error) {
+	after, err = getTimeFlag(cmd, DeleteTargetAfterFlag)
+	if err != nil {
+		return nil, nil, err
+	}
+	before, err = getTimeFlag(cmd, DeleteTargetBeforeFlag)
+	if err != nil {
+		return nil, nil, err
+	}
+	return after, before, nil
+}
+
+func getTimeFlag(cmd *cobra.Command, name string) (*time.Time, error) {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil || !flag.Changed {
+		return nil, nil
+	}
+	value, err := time.Parse(time.RFC3339, flag.Value.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --%s time, the RFC 3339 format is expected", name)
+	}
+	return &value, nil
+}
@@ -0,0 +1,161 @@
+package internal_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/test/mocks"
+	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+type permanentTestMetaFetcher struct {
+	permanent map[string]bool
+}
+
+func (fetcher permanentTestMetaFetcher) Fetch(backupName string, _ storage.Folder) (internal.GenericMetadata, error) {
+	isPermanent, ok := fetcher.permanent[backupName]
+	if !ok {
+		return internal.GenericMetadata{}, errors.New("no meta")
+	}
+	return internal.GenericMetadata{BackupName: backupName, IsPermanent: isPermanent}, nil
+}
+
+func TestFindPermanentBackups(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	for _, name := range []string{"base_1", "base_2", "base_3"} {
+		assert.NoError(t, folder.PutObject(utility.BaseBackupPath+name+utility.SentinelSuffix, &bytes.Buffer{}))
+	}
+	metaFetcher := permanentTestMetaFetcher{permanent: map[string]bool{"base_1": true, "base_2": false}}
+
+	permanentBackups, err := internal.FindPermanentBackups(folder, metaFetcher)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"base_1": true}, permanentBackups)
+}
+
+func TestFindPermanentBackups_NoBackups(t *testing.T) {
+	permanentBackups, err := internal.FindPermanentBackups(testtools.MakeDefaultInMemoryStorageFolder(),
+		permanentTestMetaFetcher{})
+
+	assert.NoError(t, err)
+	assert.Empty(t, permanentBackups)
+}
+
+func TestFindPermanentBackups_ReturnsListingError(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	folder := mocks.NewMockFolder(mockController)
+	baseBackupFolder := mocks.NewMockFolder(mockController)
+	folder.EXPECT().GetSubFolder(utility.BaseBackupPath).Return(baseBackupFolder)
+	listErr := errors.New("storage is unavailable")
+	baseBackupFolder.EXPECT().ListFolder().Return(nil, nil, listErr)
+
+	permanentBackups, err := internal.FindPermanentBackups(folder, permanentTestMetaFetcher{})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), listErr.Error())
+	assert.Nil(t, permanentBackups)
+}
+
+type slowTestMetaFetcher struct {
+	permanentTestMetaFetcher
+	delay time.Duration
+}
+
+func (fetcher slowTestMetaFetcher) Fetch(backupName string, folder storage.Folder) (internal.GenericMetadata, error) {
+	time.Sleep(fetcher.delay)
+	return fetcher.permanentTestMetaFetcher.Fetch(backupName, folder)
+}
+
+func createManyBackupsTestFolder(t testing.TB, count int) (storage.Folder, permanentTestMetaFetcher, map[string]bool) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	metaFetcher := permanentTestMetaFetcher{permanent: map[string]bool{}}
+	expected := map[string]bool{}
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("base_%03d", i)
+		assert.NoError(t, folder.PutObject(utility.BaseBackupPath+name+utility.SentinelSuffix, &bytes.Buffer{}))
+		// every fifth backup has no meta and every third one is permanent
+		if i%5 == 0 {
+			continue
+		}
+		metaFetcher.permanent[name] = i%3 == 0
+		if i%3 == 0 {
+			expected[name] = true
+		}
+	}
+	return folder, metaFetcher, expected
+}
+
+func TestFindPermanentBackupsConcurrently(t *testing.T) {
+	folder, metaFetcher, expected := createManyBackupsTestFolder(t, 50)
+
+	for _, concurrency := range []int{0, 1, 2, 7, 50, 100} {
+		permanentBackups, err := internal.FindPermanentBackupsConcurrently(folder, metaFetcher, concurrency)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expected, permanentBackups, "concurrency %d", concurrency)
+	}
+}
+
+func BenchmarkFindPermanentBackups(b *testing.B) {
+	folder, metaFetcher, _ := createManyBackupsTestFolder(b, 100)
+	slowMetaFetcher := slowTestMetaFetcher{permanentTestMetaFetcher: metaFetcher, delay: time.Millisecond}
+
+	for _, concurrency := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("concurrency_%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := internal.FindPermanentBackupsConcurrently(folder, slowMetaFetcher, concurrency)
+				assert.NoError(b, err)
+			}
+		})
+	}
+}
+
+func TestIsPermanent_BackupNamesOfDifferentLengths(t *testing.T) {
+	permanentBackups := map[string]bool{
+		"stream_20200101T000000Z":       true,
+		"base_000000010000000000000003": true,
+		"catchup_base_1":                true,
+	}
+	objects := map[string]bool{
+		utility.BaseBackupPath + "stream_20200101T000000Z" + utility.SentinelSuffix:            true,
+		utility.BaseBackupPath + "stream_20200101T000000Z/stream.br":                           true,
+		utility.BaseBackupPath + "base_000000010000000000000003" + utility.SentinelSuffix:      true,
+		utility.BaseBackupPath + "base_000000010000000000000003/tar_partitions/part_1.tar.lz4": true,
+		utility.BaseBackupPath + "catchup_base_1" + utility.SentinelSuffix:                     true,
+		utility.BaseBackupPath + "catchup_base_1/metadata.json":                                true,
+		utility.BaseBackupPath + "stream_20200102T000000Z" + utility.SentinelSuffix:            false,
+		utility.BaseBackupPath + "catchup_base_12" + utility.SentinelSuffix:                    false,
+		utility.BaseBackupPath + "catchup_base_12/metadata.json":                               false,
+		utility.WalPath + "000000010000000000000003.lz4":                                       false,
+	}
+
+	for objectName, expected := range objects {
+		assert.Equal(t, expected, internal.IsPermanent(objectName, permanentBackups), objectName)
+	}
+}
+
+func TestIsPermanent_CollidingBackupNamePrefix(t *testing.T) {
+	// the permanent full backup name is the prefix of the impermanent delta backup name
+	permanentBackups := map[string]bool{"base_000000010000000000000003": true}
+	delta := "base_000000010000000000000003_D_000000010000000000000001"
+
+	assert.False(t, internal.IsPermanent(utility.BaseBackupPath+delta+utility.SentinelSuffix, permanentBackups))
+	assert.False(t, internal.IsPermanent(utility.BaseBackupPath+delta+"/metadata.json", permanentBackups))
+	assert.True(t, internal.IsPermanent(
+		utility.BaseBackupPath+"base_000000010000000000000003"+utility.SentinelSuffix, permanentBackups))
+
+	// and vice versa
+	permanentBackups = map[string]bool{delta: true}
+	assert.False(t, internal.IsPermanent(
+		utility.BaseBackupPath+"base_000000010000000000000003"+utility.SentinelSuffix, permanentBackups))
+	assert.True(t, internal.IsPermanent(utility.BaseBackupPath+delta+utility.SentinelSuffix, permanentBackups))
+}
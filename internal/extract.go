@@ -2,7 +2,8 @@ package internal
 
 import (
 	"archive/tar"
-	"context"
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"strings"
@@ -10,11 +11,12 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/limiters"
 	"github.com/wal-g/wal-g/utility"
-	"golang.org/x/sync/semaphore"
 )
 
 var MinExtractRetryWait = time.Minute
@@ -46,12 +48,30 @@ func (err UnsupportedFileTypeError) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+// extractionStartError is the decompression or tar header error raised before the first entry of the file
+// is interpreted, so the file may be extracted again with the other decompressor
+type extractionStartError struct {
+	error
+}
+
+func (err extractionStartError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
 // TarInterpreter behaves differently
 // for different file types.
 type TarInterpreter interface {
 	Interpret(reader io.Reader, header *tar.Header) error
 }
 
+// TarBatchInterpreter is the TarInterpreter which defers some work on the entries of one tar,
+// e.g. fsync, until the whole tar is interpreted. The tar is extracted successfully
+// only if the returned finish function succeeds.
+type TarBatchInterpreter interface {
+	TarInterpreter
+	StartTarBatch() (tarInterpreter TarInterpreter, finish func() error)
+}
+
 type DevNullWriter struct {
 	io.WriteCloser
 	statPrinter sync.Once
@@ -76,6 +96,29 @@ var _ io.Writer = &DevNullWriter{}
 // TODO : unit tests
 // Extract exactly one tar bundle.
 func extractOneTar(tarInterpreter TarInterpreter, source io.Reader) error {
+	concurrency := getTarEntryConcurrency(tarInterpreter)
+	batchInterpreter, ok := tarInterpreter.(TarBatchInterpreter)
+	if !ok {
+		return extractTarEntriesWith(tarInterpreter, source, concurrency)
+	}
+	batchTarInterpreter, finish := batchInterpreter.StartTarBatch()
+	err := extractTarEntriesWith(batchTarInterpreter, source, concurrency)
+	if finishErr := finish(); err == nil && finishErr != nil {
+		err = errors.Wrap(finishErr, "extractOne: finishing the tar failed")
+	}
+	return err
+}
+
+// extractTarEntriesWith interprets the entries of the tar sequentially or, if the concurrency
+// is greater than one, the regular files concurrently
+func extractTarEntriesWith(tarInterpreter TarInterpreter, source io.Reader, concurrency int) error {
+	if concurrency > 1 {
+		return extractTarEntriesConcurrently(tarInterpreter, source, concurrency)
+	}
+	return extractTarEntries(tarInterpreter, source)
+}
+
+func extractTarEntries(tarInterpreter TarInterpreter, source io.Reader) error {
 	tarReader := tar.NewReader(source)
 
 	for {
@@ -111,27 +154,74 @@ func extractNonTar(tarInterpreter TarInterpreter, source io.Reader, path string,
 
 // DecryptAndDecompressTar decrypts file and checks its extension.
 // If it's tar, a decompression is not needed.
-// Otherwise it uses corresponding decompressor. If none found an error will be returned.
+// Otherwise it uses corresponding decompressor. If none found, the compression is detected
+// by the content of the decrypted file, and if it is not recognized an error will be returned.
 func DecryptAndDecompressTar(reader io.Reader, filePath string, crypter crypto.Crypter) (io.ReadCloser, error) {
-	var err error
+	fileExtension := utility.GetFileExtension(filePath)
+	if fileExtension == "tar" {
+		return decryptAndDecompressWith(reader, crypter, nil)
+	}
 
+	decompressor := compression.FindDecompressor(fileExtension)
+	if decompressor == nil {
+		return decryptAndDetectDecompressor(reader, filePath, fileExtension, crypter)
+	}
+
+	return decryptAndDecompressWith(reader, crypter, decompressor)
+}
+
+// decryptAndDetectDecompressor decrypts the file which extension matches no decompressor and chooses
+// the decompressor by the magic number the decrypted content starts with. The content starting
+// with the tar header is not decompressed. E.g. the objects renamed or copied by the external tools
+// may lose the extension of the compression they were made with.
+func decryptAndDetectDecompressor(reader io.Reader, filePath, fileExtension string,
+	crypter crypto.Crypter) (io.ReadCloser, error) {
+	var err error
 	if crypter != nil {
 		reader, err = crypter.Decrypt(reader)
 		if err != nil {
 			return nil, errors.Wrap(err, "DecryptAndDecompressTar: decrypt failed")
 		}
 	}
+	bufferedReader := bufio.NewReaderSize(reader, tarHeaderBlockSize)
+	header, _ := bufferedReader.Peek(tarHeaderBlockSize)
+	if decompressor := compression.DetectDecompressor(header); decompressor != nil {
+		tracelog.InfoLogger.Printf("Extension '%s' of %s matches no decompressor, it is decompressed with "+
+			"the %s decompressor detected by its content\n", fileExtension, filePath, decompressor.FileExtension())
+		return decompressor.Decompress(bufferedReader)
+	}
+	if isTarHeader(header) {
+		tracelog.InfoLogger.Printf("Extension '%s' of %s matches no decompressor, it is extracted as "+
+			"the uncompressed tar\n", fileExtension, filePath)
+		return io.NopCloser(bufferedReader), nil
+	}
+	return nil, newUnsupportedFileTypeError(filePath, fileExtension)
+}
 
-	fileExtension := utility.GetFileExtension(filePath)
-	if fileExtension == "tar" {
-		return io.NopCloser(reader), nil
+// tarHeaderBlockSize is the size of the tar header block, it holds the magic number of the tar format
+const tarHeaderBlockSize = 512
+
+// isTarHeader checks whether the content starts with the header of the ustar, pax or gnu tar
+func isTarHeader(header []byte) bool {
+	return len(header) >= tarHeaderBlockSize && bytes.HasPrefix(header[257:], []byte("ustar"))
+}
+
+// decryptAndDecompressWith decrypts the reader and decompresses it with the given decompressor.
+// Nil decompressor means that the data is not compressed.
+func decryptAndDecompressWith(reader io.Reader, crypter crypto.Crypter,
+	decompressor compression.Decompressor) (io.ReadCloser, error) {
+	var err error
+
+	if crypter != nil {
+		reader, err = crypter.Decrypt(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "DecryptAndDecompressTar: decrypt failed")
+		}
 	}
 
-	decompressor := compression.FindDecompressor(fileExtension)
 	if decompressor == nil {
-		return nil, newUnsupportedFileTypeError(filePath, fileExtension)
+		return io.NopCloser(reader), nil
 	}
-
 	return decompressor.Decompress(reader)
 }
 
@@ -194,49 +284,36 @@ func extractFile(tarInterpreter TarInterpreter, extractingReader io.Reader, file
 func tryExtractFiles(files []ReaderMaker,
 	tarInterpreter TarInterpreter,
 	downloadingConcurrency int) (failed []ReaderMaker) {
-	downloadingContext := context.TODO()
-	downloadingSemaphore := semaphore.NewWeighted(int64(downloadingConcurrency))
+	concurrency, err := configureExtractConcurrency(downloadingConcurrency)
+	if err != nil {
+		tracelog.ErrorLogger.Println(err)
+		return files
+	}
 	crypter := ConfigureCrypter()
+	decompressorFallback := viper.GetBool(DecompressorFallbackSetting)
 	isFailed := sync.Map{}
 
 	for _, file := range files {
-		err := downloadingSemaphore.Acquire(downloadingContext, 1)
-		if err != nil {
-			tracelog.ErrorLogger.Println(err)
-			return files //Should never happen, but if we are asked to cancel - consider all files unfinished
-		}
+		epoch := concurrency.acquire()
 		fileClosure := file
 
 		go func() {
-			defer downloadingSemaphore.Release(1)
-
-			readCloser, err := fileClosure.Reader()
-			if err == nil {
-				defer utility.LoggedClose(readCloser, "")
-
-				filePath := fileClosure.Path()
-				var extractingReader io.ReadCloser
-				extractingReader, err = DecryptAndDecompressTar(readCloser, filePath, crypter)
-				if err == nil {
-					defer extractingReader.Close()
-					err = extractFile(tarInterpreter, extractingReader, fileClosure)
-					err = errors.Wrapf(err, "Extraction error in %s", filePath)
-					tracelog.InfoLogger.Printf("Finished extraction of %s", filePath)
-				}
+			err := extractReaderMaker(tarInterpreter, fileClosure, decompressorFallback,
+				func(reader io.Reader) (io.ReadCloser, error) {
+					return DecryptAndDecompressTar(reader, fileClosure.Path(), crypter)
+				})
+			if _, ok := errors.Cause(err).(extractionStartError); ok && decompressorFallback {
+				err = extractWithAlternateDecompressors(tarInterpreter, fileClosure, crypter, err)
 			}
 
 			if err != nil {
 				isFailed.Store(fileClosure, true)
 				tracelog.ErrorLogger.Println(err)
 			}
+			concurrency.release(epoch, err != nil)
 		}()
 	}
-
-	err := downloadingSemaphore.Acquire(downloadingContext, int64(downloadingConcurrency))
-	if err != nil {
-		tracelog.ErrorLogger.Println(err)
-		return files //Should never happen, but if we are asked to cancel - consider all files unfinished
-	}
+	concurrency.wait()
 
 	isFailed.Range(func(failedFile, _ interface{}) bool {
 		failed = append(failed, failedFile.(ReaderMaker))
@@ -245,6 +322,103 @@ func tryExtractFiles(files []ReaderMaker,
 	return failed
 }
 
+// extractReaderMaker extracts the file decompressed by the given function. The errors raised before the first entry
+// is interpreted are returned as extractionStartError, with checkTarStart the decompressed tar must also start
+// with the tar header for its extraction to start.
+func extractReaderMaker(tarInterpreter TarInterpreter, fileClosure ReaderMaker, checkTarStart bool,
+	decryptAndDecompress func(reader io.Reader) (io.ReadCloser, error)) error {
+	readCloser, err := fileClosure.Reader()
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(readCloser, "")
+
+	filePath := fileClosure.Path()
+	extractingReader, err := decryptAndDecompress(limiters.NewRestoreLimitReader(readCloser))
+	if err != nil {
+		return extractionStartError{errors.Wrapf(err, "Extraction error in %s", filePath)}
+	}
+	defer extractingReader.Close()
+	var decompressedReader io.Reader = extractingReader
+	if checkTarStart && fileClosure.FileType() == TarFileType {
+		bufferedReader := bufio.NewReaderSize(extractingReader, tarHeaderBlockSize)
+		if err = checkTarHeaderStart(bufferedReader); err != nil {
+			return extractionStartError{errors.Wrapf(err, "Extraction error in %s", filePath)}
+		}
+		decompressedReader = bufferedReader
+	}
+	// the decompressed data is limited as it is written to disk by the interpreter
+	source := limiters.NewRestoreDiskLimitReader(decompressedReader)
+	checksumVerifier := newTarStreamChecksumVerifier(tarInterpreter, fileClosure)
+	if checksumVerifier != nil {
+		source = checksumVerifier.wrap(source)
+	}
+	err = extractFile(tarInterpreter, source, fileClosure)
+	if err == nil && checksumVerifier != nil {
+		err = checksumVerifier.verify()
+	}
+	err = errors.Wrapf(err, "Extraction error in %s", filePath)
+	tracelog.InfoLogger.Printf("Finished extraction of %s", filePath)
+	return err
+}
+
+// checkTarHeaderStart checks the decompressed data starts with the tar header or the zero block of the empty tar
+func checkTarHeaderStart(reader *bufio.Reader) error {
+	header, err := reader.Peek(tarHeaderBlockSize)
+	if err == io.EOF && len(header) == 0 {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read the first tar header")
+	}
+	if !isTarHeader(header) && !bytes.Equal(header, make([]byte, tarHeaderBlockSize)) {
+		return errors.New("the decompressed data does not start with the tar header")
+	}
+	return nil
+}
+
+// extractWithAlternateDecompressors retries the extraction failed before its first entry with every other
+// registered decompressor, and as the uncompressed tar. It helps when the file extension does not match the codec
+// the file was actually compressed with. The extraction failed after its start is not retried, since the matching
+// decompressor is found. Returns the original error if none of the decompressors succeeds.
+func extractWithAlternateDecompressors(tarInterpreter TarInterpreter, fileClosure ReaderMaker,
+	crypter crypto.Crypter, originalErr error) error {
+	filePath := fileClosure.Path()
+	fileExtension := utility.GetFileExtension(filePath)
+	decompressors := make([]compression.Decompressor, 0, len(compression.Decompressors)+1)
+	for _, decompressor := range compression.Decompressors {
+		if decompressor.FileExtension() != fileExtension {
+			decompressors = append(decompressors, decompressor)
+		}
+	}
+	if fileExtension != "tar" {
+		// nil decompressor stands for the uncompressed tar
+		decompressors = append(decompressors, nil)
+	}
+	for _, decompressor := range decompressors {
+		alternateDecompressor := decompressor
+		codec := "tar"
+		if decompressor != nil {
+			codec = decompressor.FileExtension()
+		}
+		tracelog.WarningLogger.Printf("Failed to extract %s, retrying with the %s decompressor: %v\n",
+			filePath, codec, originalErr)
+		err := extractReaderMaker(tarInterpreter, fileClosure, true, func(reader io.Reader) (io.ReadCloser, error) {
+			return decryptAndDecompressWith(reader, crypter, alternateDecompressor)
+		})
+		if err == nil {
+			tracelog.WarningLogger.Printf("Extracted %s with the %s decompressor, though its extension is '%s', "+
+				"the backup metadata should be corrected\n", filePath, codec, fileExtension)
+			return nil
+		}
+		if _, ok := errors.Cause(err).(extractionStartError); !ok {
+			return err
+		}
+		tracelog.DebugLogger.Printf("Failed to extract %s with the %s decompressor: %v\n", filePath, codec, err)
+	}
+	return originalErr
+}
+
 func readTrailingZeros(r io.Reader) error {
 	// on first iteration we read small chunk
 	// in most cases we will return fast without memory allocation
@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxBufferedTarEntrySize is the size of the largest regular file which is read into memory to be written
+// concurrently, the larger files are streamed from the tar by the reading goroutine
+const maxBufferedTarEntrySize = 16 << 20
+
+// ConcurrentTarInterpreter is the TarInterpreter which may interpret the entries of one tar concurrently
+type ConcurrentTarInterpreter interface {
+	TarInterpreter
+	// TarEntryConcurrency returns the maximum number of the entries of one tar interpreted at once
+	TarEntryConcurrency() int
+}
+
+// getTarEntryConcurrency returns the number of the entries of one tar the interpreter may interpret at once
+func getTarEntryConcurrency(tarInterpreter TarInterpreter) int {
+	concurrentInterpreter, ok := tarInterpreter.(ConcurrentTarInterpreter)
+	if !ok {
+		return 1
+	}
+	return concurrentInterpreter.TarEntryConcurrency()
+}
+
+// tarEntryTask is the regular file read into memory which waits for a worker
+type tarEntryTask struct {
+	header  *tar.Header
+	content []byte
+}
+
+// concurrentTarExtractor extracts the regular files of one tar concurrently and keeps the result
+// of the sequential extraction: the entries which paths are related are interpreted in the tar order.
+// That is, the directory or the file is interpreted only once the previous entries inside it are written,
+// and the hardlink is created only once its target is written. The hardlinks to the targets which
+// come later in the tar are created after the rest of the tar is extracted.
+type concurrentTarExtractor struct {
+	tarInterpreter TarInterpreter
+	tasks          chan *tarEntryTask
+	workers        sync.WaitGroup
+
+	mutex sync.Mutex
+	// written is signalled as the tasks complete
+	written *sync.Cond
+	// pendingEntries counts the dispatched and not yet written tasks of every path and its parent directories
+	pendingEntries map[string]int
+	seenEntries    map[string]bool
+	deferredLinks  []*tar.Header
+	err            error
+}
+
+func newConcurrentTarExtractor(tarInterpreter TarInterpreter, concurrency int) *concurrentTarExtractor {
+	extractor := &concurrentTarExtractor{
+		tarInterpreter: tarInterpreter,
+		tasks:          make(chan *tarEntryTask, concurrency),
+		pendingEntries: make(map[string]int),
+		seenEntries:    make(map[string]bool),
+	}
+	extractor.written = sync.NewCond(&extractor.mutex)
+	for i := 0; i < concurrency; i++ {
+		extractor.workers.Add(1)
+		go extractor.work()
+	}
+	return extractor
+}
+
+func extractTarEntriesConcurrently(tarInterpreter TarInterpreter, source io.Reader, concurrency int) error {
+	extractor := newConcurrentTarExtractor(tarInterpreter, concurrency)
+	err := extractor.extract(tar.NewReader(source))
+	close(extractor.tasks)
+	extractor.workers.Wait()
+	if err == nil {
+		err = extractor.getError()
+	}
+	if err == nil {
+		err = extractor.createDeferredLinks()
+	}
+	return err
+}
+
+func (extractor *concurrentTarExtractor) extract(tarReader *tar.Reader) error {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "extractOne: tar extract failed")
+		}
+		if err = extractor.getError(); err != nil {
+			return err
+		}
+		name := normalizeTarEntryName(header.Name)
+		switch {
+		case header.Typeflag == tar.TypeLink && !extractor.isSeen(normalizeTarEntryName(header.Linkname)):
+			extractor.deferLink(header)
+		case header.Typeflag == tar.TypeReg && header.Size <= maxBufferedTarEntrySize:
+			content := make([]byte, header.Size)
+			if _, err = io.ReadFull(tarReader, content); err != nil {
+				return errors.Wrapf(err, "extractOne: failed to read '%s'", header.Name)
+			}
+			extractor.dispatch(name, &tarEntryTask{header, content})
+		default:
+			extractor.waitWritten(name)
+			if header.Typeflag == tar.TypeLink {
+				extractor.waitWritten(normalizeTarEntryName(header.Linkname))
+			}
+			extractor.markSeen(name)
+			if err = extractor.tarInterpreter.Interpret(tarReader, header); err != nil {
+				return errors.Wrap(err, "extractOne: Interpret failed")
+			}
+		}
+	}
+}
+
+// dispatch passes the task to the workers once the previous entries of the same path are written
+func (extractor *concurrentTarExtractor) dispatch(name string, task *tarEntryTask) {
+	extractor.mutex.Lock()
+	for extractor.pendingEntries[name] > 0 {
+		extractor.written.Wait()
+	}
+	extractor.seenEntries[name] = true
+	for _, entryPath := range getPathWithParents(name) {
+		extractor.pendingEntries[entryPath]++
+	}
+	extractor.mutex.Unlock()
+	extractor.tasks <- task
+}
+
+func (extractor *concurrentTarExtractor) work() {
+	defer extractor.workers.Done()
+	for task := range extractor.tasks {
+		var err error
+		if extractor.getError() == nil {
+			err = extractor.tarInterpreter.Interpret(bytes.NewReader(task.content), task.header)
+		}
+		extractor.mutex.Lock()
+		if err != nil && extractor.err == nil {
+			extractor.err = errors.Wrap(err, "extractOne: Interpret failed")
+		}
+		for _, entryPath := range getPathWithParents(normalizeTarEntryName(task.header.Name)) {
+			extractor.pendingEntries[entryPath]--
+		}
+		extractor.written.Broadcast()
+		extractor.mutex.Unlock()
+	}
+}
+
+// waitWritten waits until the dispatched tasks of the path and the paths inside it are written
+func (extractor *concurrentTarExtractor) waitWritten(name string) {
+	extractor.mutex.Lock()
+	defer extractor.mutex.Unlock()
+	for extractor.pendingEntries[name] > 0 {
+		extractor.written.Wait()
+	}
+}
+
+func (extractor *concurrentTarExtractor) isSeen(name string) bool {
+	extractor.mutex.Lock()
+	defer extractor.mutex.Unlock()
+	return extractor.seenEntries[name]
+}
+
+func (extractor *concurrentTarExtractor) markSeen(name string) {
+	extractor.mutex.Lock()
+	defer extractor.mutex.Unlock()
+	extractor.seenEntries[name] = true
+}
+
+func (extractor *concurrentTarExtractor) deferLink(header *tar.Header) {
+	extractor.mutex.Lock()
+	defer extractor.mutex.Unlock()
+	extractor.deferredLinks = append(extractor.deferredLinks, header)
+}
+
+func (extractor *concurrentTarExtractor) getError() error {
+	extractor.mutex.Lock()
+	defer extractor.mutex.Unlock()
+	return extractor.err
+}
+
+// createDeferredLinks creates the hardlinks which targets come later in the tar, in the tar order
+func (extractor *concurrentTarExtractor) createDeferredLinks() error {
+	for _, header := range extractor.deferredLinks {
+		if err := extractor.tarInterpreter.Interpret(bytes.NewReader(nil), header); err != nil {
+			return errors.Wrap(err, "extractOne: Interpret failed")
+		}
+	}
+	return nil
+}
+
+// normalizeTarEntryName makes the names of the same path equal, e.g. the directory with and without the trailing slash
+func normalizeTarEntryName(name string) string {
+	return path.Clean("/" + name)
+}
+
+// getPathWithParents returns the normalized path with all its parent directories except the root
+func getPathWithParents(name string) []string {
+	paths := make([]string, 0, strings.Count(name, "/"))
+	for name != "/" && name != "." {
+		paths = append(paths, name)
+		name = path.Dir(name)
+	}
+	return paths
+}
@@ -0,0 +1,126 @@
+package internal_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// recordingConcurrentTarInterpreter records the start and the end of every interpreted entry
+type recordingConcurrentTarInterpreter struct {
+	concurrency int
+
+	mutex         sync.Mutex
+	events        []string
+	contents      map[string]string
+	running       int
+	maxConcurrent int
+}
+
+func (tarInterpreter *recordingConcurrentTarInterpreter) TarEntryConcurrency() int {
+	return tarInterpreter.concurrency
+}
+
+func (tarInterpreter *recordingConcurrentTarInterpreter) Interpret(reader io.Reader, header *tar.Header) error {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	tarInterpreter.record("start " + header.Name)
+	if header.Typeflag == tar.TypeReg {
+		time.Sleep(20 * time.Millisecond)
+	}
+	tarInterpreter.mutex.Lock()
+	tarInterpreter.contents[header.Name] = string(content)
+	tarInterpreter.mutex.Unlock()
+	tarInterpreter.record("end " + header.Name)
+	return nil
+}
+
+func (tarInterpreter *recordingConcurrentTarInterpreter) record(event string) {
+	tarInterpreter.mutex.Lock()
+	defer tarInterpreter.mutex.Unlock()
+	if event[0] == 's' {
+		tarInterpreter.running++
+		if tarInterpreter.running > tarInterpreter.maxConcurrent {
+			tarInterpreter.maxConcurrent = tarInterpreter.running
+		}
+	} else {
+		tarInterpreter.running--
+	}
+	tarInterpreter.events = append(tarInterpreter.events, event)
+}
+
+// assertBefore checks that the first event happened before the second one
+func (tarInterpreter *recordingConcurrentTarInterpreter) assertBefore(t *testing.T, first, second string) {
+	firstIndex, secondIndex := -1, -1
+	for i, event := range tarInterpreter.events {
+		switch event {
+		case first:
+			firstIndex = i
+		case second:
+			secondIndex = i
+		}
+	}
+	require.NotEqual(t, -1, firstIndex, first)
+	require.NotEqual(t, -1, secondIndex, second)
+	assert.Less(t, firstIndex, secondIndex, "%s should happen before %s", first, second)
+}
+
+func makeScrambledTar(t *testing.T) *BytesReaderMaker {
+	var buffer bytes.Buffer
+	tarWriter := tar.NewWriter(&buffer)
+	writeEntry := func(header *tar.Header, content string) {
+		header.Size = int64(len(content))
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	// the file comes before its directory and the hardlink comes before its target
+	writeEntry(&tar.Header{Name: "/base/1/2", Typeflag: tar.TypeReg, Mode: 0600}, "2")
+	writeEntry(&tar.Header{Name: "/base/1/link", Typeflag: tar.TypeLink, Linkname: "/base/1/3"}, "")
+	writeEntry(&tar.Header{Name: "/base/1/", Typeflag: tar.TypeDir, Mode: 0700}, "")
+	writeEntry(&tar.Header{Name: "/base/1/3", Typeflag: tar.TypeReg, Mode: 0600}, "3")
+	writeEntry(&tar.Header{Name: "/base/1/4", Typeflag: tar.TypeReg, Mode: 0600}, "4")
+	writeEntry(&tar.Header{Name: "/global/1", Typeflag: tar.TypeReg, Mode: 0600}, "g")
+	writeEntry(&tar.Header{Name: "/global/link", Typeflag: tar.TypeLink, Linkname: "/global/1"}, "")
+	require.NoError(t, tarWriter.Close())
+	return &BytesReaderMaker{Bytes: buffer.Bytes(), Key: "scrambled.tar"}
+}
+
+func TestExtractAll_concurrentTarEntries(t *testing.T) {
+	tarInterpreter := &recordingConcurrentTarInterpreter{concurrency: 4, contents: make(map[string]string)}
+
+	err := internal.ExtractAllWithSleeper(tarInterpreter, []internal.ReaderMaker{makeScrambledTar(t)}, NOPSleeper{})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/base/1/2": "2", "/base/1/link": "", "/base/1/": "", "/base/1/3": "3",
+		"/base/1/4": "4", "/global/1": "g", "/global/link": "",
+	}, tarInterpreter.contents)
+	assert.Greater(t, tarInterpreter.maxConcurrent, 1)
+	// the directory is interpreted after the previous file inside it is written
+	tarInterpreter.assertBefore(t, "end /base/1/2", "start /base/1/")
+	// the hardlinks are created after their targets are written
+	tarInterpreter.assertBefore(t, "end /base/1/3", "start /base/1/link")
+	tarInterpreter.assertBefore(t, "end /global/1", "start /global/link")
+}
+
+func TestExtractAll_sequentialTarEntries(t *testing.T) {
+	tarInterpreter := &recordingConcurrentTarInterpreter{concurrency: 1, contents: make(map[string]string)}
+
+	err := internal.ExtractAllWithSleeper(tarInterpreter, []internal.ReaderMaker{makeScrambledTar(t)}, NOPSleeper{})
+
+	require.NoError(t, err)
+	assert.Len(t, tarInterpreter.contents, 7)
+	assert.Equal(t, 1, tarInterpreter.maxConcurrent)
+	// the entries are interpreted in the tar order
+	tarInterpreter.assertBefore(t, "end /base/1/link", "start /base/1/")
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+)
+
+// minRampUpTick bounds how often the growing concurrency limit wakes up the waiting extractions
+const minRampUpTick = 10 * time.Millisecond
+
+// extractConcurrency limits the number of the concurrently extracted files. If the ramp-up is enabled,
+// the limit grows linearly from the start to the maximum concurrency over the window, so the cold storage
+// caches and the rate limited backends are not hit by the full fan-out at once. Every failed extraction
+// halves the limit and restarts the ramp-up from there (additive increase, multiplicative decrease).
+// The failures of the extractions started before the previous decrease do not decrease the limit again,
+// so the burst of the failures halves it once.
+type extractConcurrency struct {
+	maxConcurrency int
+	window         time.Duration
+	now            func() time.Time
+
+	mutex         sync.Mutex
+	cond          *sync.Cond
+	rampStart     int
+	rampStartTime time.Time
+	epoch         int
+	inFlight      int
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+func newExtractConcurrency(maxConcurrency, start int, window time.Duration) *extractConcurrency {
+	if start < 1 {
+		start = 1
+	}
+	if start > maxConcurrency {
+		start = maxConcurrency
+	}
+	if window <= 0 {
+		start, window = maxConcurrency, 0
+	}
+	concurrency := &extractConcurrency{
+		maxConcurrency: maxConcurrency,
+		window:         window,
+		now:            time.Now,
+		rampStart:      start,
+		stop:           make(chan struct{}),
+	}
+	concurrency.cond = sync.NewCond(&concurrency.mutex)
+	concurrency.rampStartTime = concurrency.now()
+	if window > 0 {
+		go concurrency.wakeUpPeriodically()
+	}
+	return concurrency
+}
+
+// configureExtractConcurrency creates the fixed concurrency limit or the ramping up one if WALG_RESTORE_RAMP_UP is set
+func configureExtractConcurrency(maxConcurrency int) (*extractConcurrency, error) {
+	if !viper.GetBool(RestoreRampUpSetting) {
+		return newExtractConcurrency(maxConcurrency, maxConcurrency, 0), nil
+	}
+	start, err := GetMaxConcurrency(RestoreRampUpStartSetting)
+	if err != nil {
+		return nil, err
+	}
+	window, err := GetDurationSetting(RestoreRampUpWindowSetting)
+	if err != nil {
+		return nil, err
+	}
+	return newExtractConcurrency(maxConcurrency, start, window), nil
+}
+
+// wakeUpPeriodically makes the waiting extractions recheck the limit while it is growing
+func (concurrency *extractConcurrency) wakeUpPeriodically() {
+	tick := concurrency.window / time.Duration(concurrency.maxConcurrency)
+	if tick < minRampUpTick {
+		tick = minRampUpTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			concurrency.cond.Broadcast()
+		case <-concurrency.stop:
+			return
+		}
+	}
+}
+
+// limit returns the current concurrency limit, the caller must hold the mutex
+func (concurrency *extractConcurrency) limit() int {
+	if concurrency.rampStart >= concurrency.maxConcurrency {
+		return concurrency.maxConcurrency
+	}
+	elapsed := concurrency.now().Sub(concurrency.rampStartTime)
+	if elapsed >= concurrency.window {
+		return concurrency.maxConcurrency
+	}
+	growth := float64(concurrency.maxConcurrency-concurrency.rampStart) * float64(elapsed) / float64(concurrency.window)
+	return concurrency.rampStart + int(growth)
+}
+
+// acquire waits for the free extraction slot and returns the epoch to pass to release
+func (concurrency *extractConcurrency) acquire() int {
+	concurrency.mutex.Lock()
+	defer concurrency.mutex.Unlock()
+	for concurrency.inFlight >= concurrency.limit() {
+		concurrency.cond.Wait()
+	}
+	concurrency.inFlight++
+	return concurrency.epoch
+}
+
+// release frees the extraction slot, the failed extraction decreases the limit if the ramp-up is enabled
+func (concurrency *extractConcurrency) release(epoch int, failed bool) {
+	concurrency.mutex.Lock()
+	defer concurrency.mutex.Unlock()
+	concurrency.inFlight--
+	if failed && concurrency.window > 0 && epoch == concurrency.epoch {
+		decreased := concurrency.limit() / 2
+		if decreased < 1 {
+			decreased = 1
+		}
+		tracelog.WarningLogger.Printf("Extraction failed, decreasing the concurrency to %d and ramping it up again\n",
+			decreased)
+		concurrency.rampStart = decreased
+		concurrency.rampStartTime = concurrency.now()
+		concurrency.epoch++
+	}
+	concurrency.cond.Broadcast()
+}
+
+// wait waits for all the extractions to release their slots and stops the ramp-up
+func (concurrency *extractConcurrency) wait() {
+	concurrency.mutex.Lock()
+	for concurrency.inFlight > 0 {
+		concurrency.cond.Wait()
+	}
+	concurrency.mutex.Unlock()
+	concurrency.stopOnce.Do(func() { close(concurrency.stop) })
+}
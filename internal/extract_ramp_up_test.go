@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestExtractConcurrency(maxConcurrency, start int, window time.Duration) (*extractConcurrency, *time.Time) {
+	concurrency := newExtractConcurrency(maxConcurrency, start, window)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	concurrency.now = func() time.Time { return now }
+	concurrency.rampStartTime = now
+	return concurrency, &now
+}
+
+func TestExtractConcurrency_RampsUpOverWindow(t *testing.T) {
+	concurrency, now := newTestExtractConcurrency(8, 2, 10*time.Second)
+	defer concurrency.wait()
+
+	assert.Equal(t, 2, concurrency.limit())
+	*now = now.Add(5 * time.Second)
+	assert.Equal(t, 5, concurrency.limit())
+	*now = now.Add(5 * time.Second)
+	assert.Equal(t, 8, concurrency.limit())
+}
+
+func TestExtractConcurrency_FailureHalvesLimitOnce(t *testing.T) {
+	concurrency, now := newTestExtractConcurrency(8, 2, 10*time.Second)
+	defer concurrency.wait()
+	*now = now.Add(10 * time.Second)
+	first := concurrency.acquire()
+	second := concurrency.acquire()
+
+	concurrency.release(first, true)
+	assert.Equal(t, 4, concurrency.limit())
+	// the extraction started before the decrease does not decrease the limit again
+	concurrency.release(second, true)
+	assert.Equal(t, 4, concurrency.limit())
+
+	*now = now.Add(5 * time.Second)
+	assert.Equal(t, 6, concurrency.limit())
+}
+
+func TestExtractConcurrency_FixedLimitIgnoresFailures(t *testing.T) {
+	concurrency, _ := newTestExtractConcurrency(4, 1, 0)
+	defer concurrency.wait()
+
+	concurrency.release(concurrency.acquire(), true)
+	assert.Equal(t, 4, concurrency.limit())
+}
+
+func TestExtractConcurrency_AcquireWaitsForLimit(t *testing.T) {
+	concurrency := newExtractConcurrency(4, 1, time.Hour)
+	epoch := concurrency.acquire()
+	acquired := make(chan struct{})
+	go func() {
+		concurrency.release(concurrency.acquire(), false)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the extraction slot is acquired over the limit")
+	case <-time.After(30 * time.Millisecond):
+	}
+	concurrency.release(epoch, false)
+	<-acquired
+	concurrency.wait()
+}
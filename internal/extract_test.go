@@ -1,15 +1,21 @@
 package internal_test
 
 import (
+	"archive/tar"
 	"bufio"
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"strconv"
 	"testing"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/compression/lzma"
 	"github.com/wal-g/wal-g/internal/crypto/openpgp"
 	"github.com/wal-g/wal-g/testtools"
 	"github.com/wal-g/wal-g/utility"
@@ -142,10 +148,177 @@ func TestExtractAll_multipleConcurrentTars(t *testing.T) {
 	}
 }
 
+func makeMislabeledLz4Tar(t *testing.T, name string) (*BytesReaderMaker, []byte) {
+	brm, b := makeTar(name)
+	compressed := internal.CompressAndEncrypt(brm.Buf, GetLz4Compressor(), nil)
+	compressedBytes, err := io.ReadAll(compressed)
+	assert.NoError(t, err)
+	// the extension claims lzma, but the content is compressed with lz4
+	return &BytesReaderMaker{Bytes: compressedBytes, Key: "/usr/local.tar.lzma"}, b
+}
+
+func TestExtractAll_decompressorFallback(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	viper.Set(internal.DecompressorFallbackSetting, true)
+	defer viper.Set(internal.DecompressorFallbackSetting, false)
+
+	readerMaker, b := makeMislabeledLz4Tar(t, "booba")
+	buf := &testtools.BufferTarInterpreter{}
+
+	err := internal.ExtractAllWithSleeper(buf, []internal.ReaderMaker{readerMaker}, NOPSleeper{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, b, buf.Out)
+}
+
+func TestExtractAll_decompressorFallbackDisabled(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	readerMaker, _ := makeMislabeledLz4Tar(t, "booba")
+
+	err := internal.ExtractAllWithSleeper(&testtools.BufferTarInterpreter{},
+		[]internal.ReaderMaker{readerMaker}, NOPSleeper{})
+
+	assert.Error(t, err)
+}
+
+func TestExtractAll_decompressorFallbackToUncompressedTar(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	viper.Set(internal.DecompressorFallbackSetting, true)
+	defer viper.Set(internal.DecompressorFallbackSetting, false)
+
+	brm, b := makeTar("booba")
+	// the extension claims lz4, but the tar is not compressed
+	readerMaker := &BytesReaderMaker{Bytes: brm.Buf.Bytes(), Key: "/usr/local.tar.lz4"}
+	buf := &testtools.BufferTarInterpreter{}
+
+	err := internal.ExtractAllWithSleeper(buf, []internal.ReaderMaker{readerMaker}, NOPSleeper{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, b, buf.Out)
+}
+
+type countingFailingTarInterpreter struct {
+	interpreted int
+}
+
+func (tarInterpreter *countingFailingTarInterpreter) Interpret(reader io.Reader, header *tar.Header) error {
+	tarInterpreter.interpreted++
+	return errors.New("disk is full")
+}
+
+func TestExtractAll_decompressorFallbackAfterFirstEntry(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	viper.Set(internal.DecompressorFallbackSetting, true)
+	defer viper.Set(internal.DecompressorFallbackSetting, false)
+
+	brm, _ := makeTar("booba")
+	compressed, err := io.ReadAll(internal.CompressAndEncrypt(brm.Buf, GetLz4Compressor(), nil))
+	assert.NoError(t, err)
+	tarInterpreter := &countingFailingTarInterpreter{}
+
+	err = internal.ExtractAllWithSleeper(tarInterpreter,
+		[]internal.ReaderMaker{&BytesReaderMaker{Bytes: compressed, Key: "/usr/local.tar.lz4"}}, NOPSleeper{})
+
+	// the error of the interpreter is not the decompression one, the file is not extracted again
+	assert.Error(t, err)
+	assert.Equal(t, 1, tarInterpreter.interpreted)
+}
+
+type failingBatchTarInterpreter struct {
+	testtools.BufferTarInterpreter
+	finished int
+}
+
+func (tarInterpreter *failingBatchTarInterpreter) StartTarBatch() (internal.TarInterpreter, func() error) {
+	return tarInterpreter, func() error {
+		tarInterpreter.finished++
+		return errors.New("fsync failed")
+	}
+}
+
+func TestExtractAll_tarBatchFinishError(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	readerMaker, b := makeTar("booba")
+	tarInterpreter := &failingBatchTarInterpreter{}
+
+	err := internal.ExtractAllWithSleeper(tarInterpreter, []internal.ReaderMaker{&readerMaker}, NOPSleeper{})
+
+	assert.Error(t, err)
+	assert.Equal(t, b, tarInterpreter.Out)
+	assert.NotZero(t, tarInterpreter.finished)
+}
+
 func noPassphrase() (string, bool) {
 	return "", false
 }
 
+// makeCompressedTar compresses the named tar with the compressor, the nil compressor leaves it uncompressed
+func makeCompressedTar(t *testing.T, name, key string, compressor compression.Compressor) (*BytesReaderMaker, []byte) {
+	brm, b := makeTar(name)
+	compressed := internal.CompressAndEncrypt(brm.Buf, compressor, nil)
+	compressedBytes, err := io.ReadAll(compressed)
+	assert.NoError(t, err)
+	return &BytesReaderMaker{Bytes: compressedBytes, Key: key}, b
+}
+
+type compressedTarPart struct {
+	key        string
+	compressor compression.Compressor
+}
+
+// testExtractMixedCompressions extracts the tars compressed with the different compressors at once
+func testExtractMixedCompressions(t *testing.T, parts []compressedTarPart) {
+	os.Setenv(internal.DownloadConcurrencySetting, "4")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	expected := make(map[string][]byte)
+	readerMakers := make([]internal.ReaderMaker, 0, len(parts))
+	for i, part := range parts {
+		name := strconv.Itoa(i)
+		readerMaker, b := makeCompressedTar(t, name, part.key, part.compressor)
+		expected[name] = b
+		readerMakers = append(readerMakers, readerMaker)
+	}
+	buf := testtools.NewConcurrentConcatBufferTarInterpreter()
+
+	err := internal.ExtractAllWithSleeper(buf, readerMakers, NOPSleeper{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.Out)
+}
+
+func TestExtractAll_mixedCompressions(t *testing.T) {
+	testExtractMixedCompressions(t, []compressedTarPart{
+		{"/part_1.tar.lz4", lz4.Compressor{}},
+		{"/part_2.tar.lzma", lzma.Compressor{}},
+		{"/part_3.tar", nil},
+		// the extensions do not name the compression, it is detected by the content
+		{"/part_4.tar.copy", lz4.Compressor{}},
+		{"/part_5", lzma.Compressor{}},
+		{"/part_6.tar.copy", nil},
+	})
+}
+
+func TestDecryptAndDecompressTar_detectedCompression(t *testing.T) {
+	b := generateRandomBytes()
+	crypter := openpgp.CrypterFromKeyPath(PrivateKeyFilePath, noPassphrase)
+	compressed := internal.CompressAndEncrypt(bytes.NewReader(b), lzma.Compressor{}, crypter)
+
+	// the compression is detected by the decrypted content
+	reader, err := internal.DecryptAndDecompressTar(compressed, "/usr/local/test.tar.unknown", crypter)
+	assert.NoError(t, err)
+
+	decompressed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, b, decompressed)
+}
+
 func TestDecryptAndDecompressTar_unencrypted(t *testing.T) {
 	b := generateRandomBytes()
 	bCopy := make([]byte, len(b))
@@ -290,6 +463,19 @@ func (b *BufferReaderMaker) Path() string                   { return b.Key }
 func (b *BufferReaderMaker) FileType() internal.FileType    { return internal.TarFileType }
 func (b *BufferReaderMaker) Mode() int                      { return 0 }
 
+// Used to mock files in memory which can be read multiple times.
+type BytesReaderMaker struct {
+	Bytes []byte
+	Key   string
+}
+
+func (b *BytesReaderMaker) Reader() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(b.Bytes)), nil
+}
+func (b *BytesReaderMaker) Path() string                { return b.Key }
+func (b *BytesReaderMaker) FileType() internal.FileType { return internal.TarFileType }
+func (b *BytesReaderMaker) Mode() int                   { return 0 }
+
 type NOPSleeper struct{}
 
 func (s NOPSleeper) Sleep() {}
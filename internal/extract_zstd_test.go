@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/compression/zstd"
+)
+
+func TestExtractAll_mixedCompressionsWithZstd(t *testing.T) {
+	testExtractMixedCompressions(t, []compressedTarPart{
+		{"/part_1.tar.zst", zstd.Compressor{}},
+		{"/part_2.tar.lz4", lz4.Compressor{}},
+		{"/part_3.tar.copy", zstd.Compressor{}},
+	})
+}
@@ -9,6 +9,17 @@ import (
 var DiskLimiter *rate.Limiter
 var NetworkLimiter *rate.Limiter
 
+// RestoreNetworkLimiter and RestoreDiskLimiter, if set, limit the download of the restored data
+// and the write of the decompressed data to disk respectively
+var RestoreNetworkLimiter *rate.Limiter
+var RestoreDiskLimiter *rate.Limiter
+
+// NewRateLimiter creates the token bucket limiter of the rate in bytes per second,
+// the burst is added to the rate to allow the reads of up to a second of data at once
+func NewRateLimiter(bytesPerSecond, burst int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond+burst))
+}
+
 // NewNetworkLimitReader returns a reader that is rate limited by network limiter
 func NewNetworkLimitReader(r io.Reader) io.Reader {
 	if NetworkLimiter == nil {
@@ -24,3 +35,11 @@ func NewDiskLimitReader(r io.Reader) io.Reader {
 	}
 	return NewReader(r, DiskLimiter)
 }
+
+// NewRestoreDiskLimitReader returns a reader that is rate limited by the restore disk limiter
+func NewRestoreDiskLimitReader(r io.Reader) io.Reader {
+	if RestoreDiskLimiter == nil {
+		return r
+	}
+	return NewReader(r, RestoreDiskLimiter)
+}
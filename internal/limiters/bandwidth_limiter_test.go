@@ -45,3 +45,33 @@ func TestLimiter(t *testing.T) {
 		t.Errorf("Rate limiter did not work")
 	}
 }
+
+func TestRestoreLimitReaders_ApproximateThroughput(t *testing.T) {
+	const bytesPerSecond = 10000
+	limiters.RestoreNetworkLimiter = limiters.NewRateLimiter(bytesPerSecond, 0)
+	limiters.RestoreDiskLimiter = limiters.NewRateLimiter(bytesPerSecond, 0)
+	defer func() {
+		limiters.RestoreNetworkLimiter = nil
+		limiters.RestoreDiskLimiter = nil
+	}()
+	// the first second of data is the burst, the rest is read at the limited rate
+	r := &fakeCloser{bytes.NewReader(make([]byte, bytesPerSecond*3/2))}
+	start := utility.TimeNowCrossPlatformLocal()
+
+	reader := limiters.NewRestoreDiskLimitReader(limiters.NewRestoreLimitReader(r))
+	read, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	elapsed := utility.TimeNowCrossPlatformLocal().Sub(start)
+
+	assert.Len(t, read, bytesPerSecond*3/2)
+	// both limiters refill concurrently, so the chained readers are limited to the same rate
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 1500*time.Millisecond)
+}
+
+func TestRestoreLimitReaders_NotLimitedByDefault(t *testing.T) {
+	r := bytes.NewReader(nil)
+
+	assert.Equal(t, r, limiters.NewRestoreDiskLimitReader(r))
+	assert.Equal(t, r, limiters.NewRestoreLimitReader(r))
+}
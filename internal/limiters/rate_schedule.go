@@ -0,0 +1,188 @@
+package limiters
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// RestoreLimiter, if set, limits the restore download rate according to the schedule
+var RestoreLimiter *ScheduledLimiter
+
+// RateScheduleWindow is the rate limit applied during the daily time window
+type RateScheduleWindow struct {
+	// Start and End are the offsets from midnight, the window wraps around midnight if End is before Start
+	Start time.Duration
+	End   time.Duration
+	// Limit is the rate limit in bytes per second, zero means unlimited
+	Limit int64
+}
+
+func (window RateScheduleWindow) contains(offset time.Duration) bool {
+	if window.Start <= window.End {
+		return offset >= window.Start && offset < window.End
+	}
+	return offset >= window.Start || offset < window.End
+}
+
+// RateSchedule is the list of the daily time windows, the first window containing the moment is applied.
+// The rate is unlimited outside of the windows.
+type RateSchedule []RateScheduleWindow
+
+// ParseRateSchedule parses the comma-separated windows in the HH:MM-HH:MM=bytes_per_second format,
+// e.g. "09:00-18:00=52428800,18:00-09:00=0". The times are local.
+func ParseRateSchedule(value string) (RateSchedule, error) {
+	schedule := make(RateSchedule, 0)
+	for _, windowValue := range strings.Split(value, ",") {
+		windowValue = strings.TrimSpace(windowValue)
+		if windowValue == "" {
+			continue
+		}
+		window, err := parseRateScheduleWindow(windowValue)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rate schedule window '%s'", windowValue)
+		}
+		schedule = append(schedule, window)
+	}
+	if len(schedule) == 0 {
+		return nil, errors.New("rate schedule is empty")
+	}
+	return schedule, nil
+}
+
+func parseRateScheduleWindow(value string) (RateScheduleWindow, error) {
+	parts := strings.Split(value, "=")
+	if len(parts) != 2 {
+		return RateScheduleWindow{}, errors.New("expected HH:MM-HH:MM=bytes_per_second")
+	}
+	times := strings.Split(parts[0], "-")
+	if len(times) != 2 {
+		return RateScheduleWindow{}, errors.New("expected HH:MM-HH:MM time range")
+	}
+	start, err := parseDayOffset(times[0])
+	if err != nil {
+		return RateScheduleWindow{}, err
+	}
+	end, err := parseDayOffset(times[1])
+	if err != nil {
+		return RateScheduleWindow{}, err
+	}
+	if start == end {
+		return RateScheduleWindow{}, errors.New("time range is empty")
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	if err != nil || limit < 0 {
+		return RateScheduleWindow{}, errors.Errorf("invalid rate limit '%s'", parts[1])
+	}
+	return RateScheduleWindow{Start: start, End: end, Limit: limit}, nil
+}
+
+func parseDayOffset(value string) (time.Duration, error) {
+	moment, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, errors.Errorf("invalid time '%s'", value)
+	}
+	return time.Duration(moment.Hour())*time.Hour + time.Duration(moment.Minute())*time.Minute, nil
+}
+
+// LimitAt returns the rate limit at the moment, zero means unlimited
+func (schedule RateSchedule) LimitAt(moment time.Time) int64 {
+	midnight := time.Date(moment.Year(), moment.Month(), moment.Day(), 0, 0, 0, 0, moment.Location())
+	offset := moment.Sub(midnight)
+	for _, window := range schedule {
+		if window.contains(offset) {
+			return window.Limit
+		}
+	}
+	return 0
+}
+
+func (schedule RateSchedule) maxLimit() int64 {
+	var maxLimit int64
+	for _, window := range schedule {
+		if window.Limit > maxLimit {
+			maxLimit = window.Limit
+		}
+	}
+	return maxLimit
+}
+
+// ScheduledLimiter is the rate limiter which limit follows the daily schedule.
+// The limit is updated on every read, so the in-flight transfers follow the schedule changes:
+// the reads are split into the chunks not larger than the burst, each waiting for the current limit.
+type ScheduledLimiter struct {
+	limiter  *rate.Limiter
+	schedule RateSchedule
+	now      func() time.Time
+
+	mutex        sync.Mutex
+	currentLimit int64
+}
+
+// NewScheduledLimiter creates the limiter, the burst is added to the largest limit of the schedule
+func NewScheduledLimiter(schedule RateSchedule, burst int64) *ScheduledLimiter {
+	limiter := &ScheduledLimiter{
+		limiter:      rate.NewLimiter(rate.Inf, int(schedule.maxLimit()+burst)),
+		schedule:     schedule,
+		now:          time.Now,
+		currentLimit: -1,
+	}
+	limiter.update()
+	return limiter
+}
+
+// update applies the limit of the current schedule window and returns the limiter
+func (limiter *ScheduledLimiter) update() *rate.Limiter {
+	now := limiter.now()
+	limit := limiter.schedule.LimitAt(now)
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	if limit != limiter.currentLimit {
+		limiter.currentLimit = limit
+		if limit == 0 {
+			limiter.limiter.SetLimitAt(now, rate.Inf)
+		} else {
+			limiter.limiter.SetLimitAt(now, rate.Limit(limit))
+		}
+	}
+	return limiter.limiter
+}
+
+// CurrentLimit returns the limit applied now, zero means unlimited
+func (limiter *ScheduledLimiter) CurrentLimit() int64 {
+	limiter.update()
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return limiter.currentLimit
+}
+
+// NewScheduledReader returns the reader which rate is limited according to the schedule
+func NewScheduledReader(reader io.Reader, limiter *ScheduledLimiter) io.Reader {
+	return &scheduledReader{reader: reader, limiter: limiter}
+}
+
+type scheduledReader struct {
+	reader  io.Reader
+	limiter *ScheduledLimiter
+}
+
+func (r *scheduledReader) Read(buf []byte) (int, error) {
+	return NewReader(r.reader, r.limiter.update()).Read(buf)
+}
+
+// NewRestoreLimitReader returns a reader that is rate limited by the restore limiter
+// and the restore network limiter, if any
+func NewRestoreLimitReader(r io.Reader) io.Reader {
+	if RestoreNetworkLimiter != nil {
+		r = NewReader(r, RestoreNetworkLimiter)
+	}
+	if RestoreLimiter == nil {
+		return r
+	}
+	return NewScheduledReader(r, RestoreLimiter)
+}
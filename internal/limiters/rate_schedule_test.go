@@ -0,0 +1,67 @@
+package limiters_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/limiters"
+)
+
+func TestParseRateSchedule(t *testing.T) {
+	schedule, err := limiters.ParseRateSchedule("09:00-18:00=52428800, 18:00-09:00=0")
+
+	require.NoError(t, err)
+	assert.Equal(t, limiters.RateSchedule{
+		{Start: 9 * time.Hour, End: 18 * time.Hour, Limit: 52428800},
+		{Start: 18 * time.Hour, End: 9 * time.Hour, Limit: 0},
+	}, schedule)
+}
+
+func TestParseRateSchedule_Invalid(t *testing.T) {
+	for _, value := range []string{"", "09:00-18:00", "09:00=100", "9-18=100", "09:00-09:00=100",
+		"09:00-18:00=-1", "25:00-18:00=100"} {
+		_, err := limiters.ParseRateSchedule(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRateSchedule_LimitAt(t *testing.T) {
+	schedule, err := limiters.ParseRateSchedule("22:00-06:00=100,09:00-18:00=200,12:00-13:00=300")
+	require.NoError(t, err)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2022, 3, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	assert.Equal(t, int64(100), schedule.LimitAt(at(23, 0)))
+	assert.Equal(t, int64(100), schedule.LimitAt(at(5, 59)))
+	assert.Equal(t, int64(0), schedule.LimitAt(at(6, 0)))
+	assert.Equal(t, int64(200), schedule.LimitAt(at(9, 0)))
+	// the first matching window wins
+	assert.Equal(t, int64(200), schedule.LimitAt(at(12, 30)))
+	assert.Equal(t, int64(0), schedule.LimitAt(at(18, 0)))
+}
+
+func TestScheduledReader(t *testing.T) {
+	now := time.Now()
+	minute := now.Hour()*60 + now.Minute()
+	// the limit is applied from the current minute for the next two minutes
+	schedule := limiters.RateSchedule{{
+		Start: time.Duration(minute) * time.Minute,
+		End:   time.Duration((minute+2)%(24*60)) * time.Minute,
+		Limit: 10000,
+	}}
+	limiter := limiters.NewScheduledLimiter(schedule, 1024)
+	assert.Equal(t, int64(10000), limiter.CurrentLimit())
+
+	start := time.Now()
+	_, err := io.ReadAll(limiters.NewScheduledReader(bytes.NewReader(make([]byte, 13000)), limiter))
+	require.NoError(t, err)
+
+	if time.Since(start) < time.Millisecond*80 {
+		t.Errorf("Scheduled rate limiter did not work")
+	}
+}
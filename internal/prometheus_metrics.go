@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+const (
+	prometheusMetricPrefix   = "walg"
+	prometheusContentType    = "text/plain; version=0.0.4"
+	prometheusPushTimeout    = 10 * time.Second
+	prometheusTextfileMode   = 0644
+	prometheusOperationLabel = "operation"
+)
+
+type prometheusGauge struct {
+	help  string
+	value float64
+}
+
+// PrometheusMetrics collects the gauges of one operation, e.g. restore or delete, and exposes them
+// in the Prometheus text format via the node_exporter textfile collector directory and/or the Pushgateway.
+// All the methods are no-op on the nil metrics, so the unconfigured metrics cost nothing.
+type PrometheusMetrics struct {
+	operation         string
+	textfileDirectory string
+	pushgatewayURL    string
+	job               string
+	client            *http.Client
+
+	mutex  sync.Mutex
+	gauges map[string]*prometheusGauge
+}
+
+func NewPrometheusMetrics(operation, textfileDirectory, pushgatewayURL, job string) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		operation:         operation,
+		textfileDirectory: textfileDirectory,
+		pushgatewayURL:    strings.TrimSuffix(pushgatewayURL, "/"),
+		job:               job,
+		client:            &http.Client{Timeout: prometheusPushTimeout},
+		gauges:            make(map[string]*prometheusGauge),
+	}
+}
+
+// ConfigurePrometheusMetrics creates the metrics of the operation from the settings,
+// returns nil if neither the textfile directory nor the Pushgateway URL is set
+func ConfigurePrometheusMetrics(operation string) *PrometheusMetrics {
+	textfileDirectory := viper.GetString(PrometheusTextfileSetting)
+	pushgatewayURL := viper.GetString(PrometheusPushgatewaySetting)
+	if textfileDirectory == "" && pushgatewayURL == "" {
+		return nil
+	}
+	return NewPrometheusMetrics(operation, textfileDirectory, pushgatewayURL, viper.GetString(PrometheusJobSetting))
+}
+
+// MetricName returns the full name of the operation metric, e.g. walg_restore_last_files
+func (metrics *PrometheusMetrics) MetricName(name string) string {
+	return fmt.Sprintf("%s_%s_%s", prometheusMetricPrefix, metrics.operation, name)
+}
+
+func (metrics *PrometheusMetrics) Set(name, help string, value float64) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.gauge(name, help).value = value
+}
+
+func (metrics *PrometheusMetrics) Add(name, help string, delta float64) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.gauge(name, help).value += delta
+}
+
+// Value returns the current value of the gauge, zero if it is not set
+func (metrics *PrometheusMetrics) Value(name string) float64 {
+	if metrics == nil {
+		return 0
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	if gauge, ok := metrics.gauges[name]; ok {
+		return gauge.value
+	}
+	return 0
+}
+
+func (metrics *PrometheusMetrics) gauge(name, help string) *prometheusGauge {
+	gauge, ok := metrics.gauges[name]
+	if !ok {
+		gauge = &prometheusGauge{help: help}
+		metrics.gauges[name] = gauge
+	}
+	return gauge
+}
+
+// Format renders the gauges in the Prometheus text exposition format sorted by name
+func (metrics *PrometheusMetrics) Format() string {
+	if metrics == nil {
+		return ""
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	names := make([]string, 0, len(metrics.gauges))
+	for name := range metrics.gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		fullName := metrics.MetricName(name)
+		fmt.Fprintf(&builder, "# HELP %s %s\n", fullName, metrics.gauges[name].help)
+		fmt.Fprintf(&builder, "# TYPE %s gauge\n", fullName)
+		fmt.Fprintf(&builder, "%s %v\n", fullName, metrics.gauges[name].value)
+	}
+	return builder.String()
+}
+
+// Push exposes the gauges to the configured textfile directory and Pushgateway
+func (metrics *PrometheusMetrics) Push() error {
+	if metrics == nil {
+		return nil
+	}
+	body := metrics.Format()
+	if metrics.textfileDirectory != "" {
+		if err := metrics.writeTextfile(body); err != nil {
+			return err
+		}
+	}
+	if metrics.pushgatewayURL != "" {
+		return metrics.pushToGateway(body)
+	}
+	return nil
+}
+
+// writeTextfile replaces the operation file atomically, so the collector never reads the partial file
+func (metrics *PrometheusMetrics) writeTextfile(body string) error {
+	fileName := filepath.Join(metrics.textfileDirectory, fmt.Sprintf("%s_%s.prom", prometheusMetricPrefix, metrics.operation))
+	tmpFile, err := os.CreateTemp(metrics.textfileDirectory, filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create the metrics textfile")
+	}
+	_, err = tmpFile.WriteString(body)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), prometheusTextfileMode)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), fileName)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return errors.Wrapf(err, "failed to write the metrics textfile %s", fileName)
+	}
+	return nil
+}
+
+func (metrics *PrometheusMetrics) pushToGateway(body string) error {
+	pushURL := fmt.Sprintf("%s/metrics/job/%s/%s/%s", metrics.pushgatewayURL,
+		url.PathEscape(metrics.job), prometheusOperationLabel, url.PathEscape(metrics.operation))
+	request, err := http.NewRequest(http.MethodPut, pushURL, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", prometheusContentType)
+	response, err := metrics.client.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "failed to push the metrics to the Pushgateway")
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return errors.Errorf("pushgateway responded with status %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package internal_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestPrometheusMetrics_Format(t *testing.T) {
+	metrics := internal.NewPrometheusMetrics("restore", "", "", "wal-g")
+	metrics.Add("last_files", "Number of the restored files", 2)
+	metrics.Add("last_files", "Number of the restored files", 3)
+	metrics.Set("last_duration_seconds", "Duration of the restore", 1.5)
+
+	assert.Equal(t, float64(5), metrics.Value("last_files"))
+	assert.Equal(t, "# HELP walg_restore_last_duration_seconds Duration of the restore\n"+
+		"# TYPE walg_restore_last_duration_seconds gauge\n"+
+		"walg_restore_last_duration_seconds 1.5\n"+
+		"# HELP walg_restore_last_files Number of the restored files\n"+
+		"# TYPE walg_restore_last_files gauge\n"+
+		"walg_restore_last_files 5\n", metrics.Format())
+}
+
+func TestPrometheusMetrics_NopWhenUnconfigured(t *testing.T) {
+	metrics := internal.ConfigurePrometheusMetrics("restore")
+	assert.Nil(t, metrics)
+
+	metrics.Add("last_files", "Number of the restored files", 1)
+	assert.Equal(t, float64(0), metrics.Value("last_files"))
+	assert.Empty(t, metrics.Format())
+	assert.NoError(t, metrics.Push())
+}
+
+func TestPrometheusMetrics_PushTextfile(t *testing.T) {
+	textfileDirectory := t.TempDir()
+	viper.Set(internal.PrometheusTextfileSetting, textfileDirectory)
+	defer viper.Set(internal.PrometheusTextfileSetting, nil)
+	metrics := internal.ConfigurePrometheusMetrics("delete")
+	require.NotNil(t, metrics)
+	metrics.Set("deleted_backups", "Number of the deleted backups", 3)
+
+	require.NoError(t, metrics.Push())
+	textfile, err := os.ReadFile(filepath.Join(textfileDirectory, "walg_delete.prom"))
+	require.NoError(t, err)
+	assert.Equal(t, metrics.Format(), string(textfile))
+	// no temporary files are left behind
+	entries, err := os.ReadDir(textfileDirectory)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestPrometheusMetrics_PushGateway(t *testing.T) {
+	var method, path, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+	metrics := internal.NewPrometheusMetrics("restore", "", server.URL+"/", "wal-g")
+	metrics.Set("last_success", "Whether the last restore succeeded", 1)
+
+	require.NoError(t, metrics.Push())
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/wal-g/operation/restore", path)
+	assert.Equal(t, "text/plain; version=0.0.4", contentType)
+	assert.Equal(t, metrics.Format(), body)
+}
+
+func TestPrometheusMetrics_PushGatewayFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	metrics := internal.NewPrometheusMetrics("restore", "", server.URL, "wal-g")
+
+	assert.Error(t, metrics.Push())
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"archive/tar"
 	"fmt"
+	"hash"
 	"io"
 	"sync/atomic"
 
@@ -25,6 +26,10 @@ type StorageTarBall struct {
 	tarWriter   *tar.Writer
 	uploader    *Uploader
 	name        string
+	// streamChecksum is the checksum of the tar stream before the compression,
+	// collected to streamChecksums once the tar is closed
+	streamChecksum  hash.Hash
+	streamChecksums *TarStreamChecksums
 }
 
 func (tarBall *StorageTarBall) Name() string {
@@ -45,7 +50,12 @@ func (tarBall *StorageTarBall) SetUp(crypter crypto.Crypter, names ...string) {
 		writeCloser := tarBall.startUpload(tarBall.name, crypter)
 
 		tarBall.writeCloser = writeCloser
-		tarBall.tarWriter = tar.NewWriter(writeCloser)
+		if tarBall.streamChecksums != nil {
+			tarBall.streamChecksum = newTarStreamChecksumHash()
+			tarBall.tarWriter = tar.NewWriter(io.MultiWriter(writeCloser, tarBall.streamChecksum))
+		} else {
+			tarBall.tarWriter = tar.NewWriter(writeCloser)
+		}
 	}
 }
 
@@ -56,6 +66,9 @@ func (tarBall *StorageTarBall) CloseTar() error {
 	if err != nil {
 		return errors.Wrap(err, "CloseTar: failed to close tar writer")
 	}
+	if tarBall.streamChecksum != nil {
+		tarBall.streamChecksums.add(tarBall.name, tarBall.streamChecksum)
+	}
 
 	err = tarBall.writeCloser.Close()
 	if err != nil {
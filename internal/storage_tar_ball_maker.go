@@ -2,13 +2,20 @@ package internal
 
 // StorageTarBallMaker creates tarballs that are uploaded to storage.
 type StorageTarBallMaker struct {
-	partCount  int
-	backupName string
-	uploader   *Uploader
+	partCount       int
+	backupName      string
+	uploader        *Uploader
+	streamChecksums *TarStreamChecksums
 }
 
 func NewStorageTarBallMaker(backupName string, uploader *Uploader) *StorageTarBallMaker {
-	return &StorageTarBallMaker{0, backupName, uploader}
+	return &StorageTarBallMaker{0, backupName, uploader, NewTarStreamChecksums()}
+}
+
+// StreamChecksums returns the checksums of the tar streams before the compression of the closed tarballs,
+// so it must be called once all the tarballs of the backup, including the pg_control and the label ones, are closed
+func (tarBallMaker *StorageTarBallMaker) StreamChecksums() map[string]FileChecksum {
+	return tarBallMaker.streamChecksums.Get()
 }
 
 // Make returns a tarball with required storage fields.
@@ -24,5 +31,7 @@ func (tarBallMaker *StorageTarBallMaker) Make(dedicatedUploader bool) TarBall {
 		backupName: tarBallMaker.backupName,
 		uploader:   uploader,
 		partSize:   &size,
+
+		streamChecksums: tarBallMaker.streamChecksums,
 	}
 }
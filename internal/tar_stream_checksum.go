@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+var tarStreamCrc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+type TarStreamChecksumMismatchError struct {
+	error
+}
+
+func newTarStreamChecksumMismatchError(tarPath string, expected FileChecksum, actual string) TarStreamChecksumMismatchError {
+	return TarStreamChecksumMismatchError{errors.Errorf(
+		"tar '%s' is truncated or corrupted: %s checksum of the decompressed stream is %s, expected %s recorded in the backup",
+		tarPath, expected.Algorithm, actual, expected.Value)}
+}
+
+func (err TarStreamChecksumMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// TarStreamChecksumInterpreter is the TarInterpreter which knows the checksums of the decompressed tar streams
+// recorded at push, so the extraction detects the truncated tar, even the one ending at the entry boundary
+type TarStreamChecksumInterpreter interface {
+	TarInterpreter
+	// TarStreamChecksum returns the checksum recorded for the tar, false if there is none
+	TarStreamChecksum(tarName string) (FileChecksum, bool)
+}
+
+// TarStreamChecksums collects the checksums of the decompressed streams of the uploaded tars by the tar names
+type TarStreamChecksums struct {
+	mutex     sync.Mutex
+	checksums map[string]FileChecksum
+}
+
+func NewTarStreamChecksums() *TarStreamChecksums {
+	return &TarStreamChecksums{checksums: make(map[string]FileChecksum)}
+}
+
+func (checksums *TarStreamChecksums) add(tarName string, checksum hash.Hash) {
+	checksums.mutex.Lock()
+	defer checksums.mutex.Unlock()
+	checksums.checksums[tarName] = FileChecksum{
+		Algorithm: Crc32cChecksumAlgorithm,
+		Value:     hex.EncodeToString(checksum.Sum(nil)),
+	}
+}
+
+// Get returns the copy of the collected checksums
+func (checksums *TarStreamChecksums) Get() map[string]FileChecksum {
+	checksums.mutex.Lock()
+	defer checksums.mutex.Unlock()
+	result := make(map[string]FileChecksum, len(checksums.checksums))
+	for tarName, checksum := range checksums.checksums {
+		result[tarName] = checksum
+	}
+	return result
+}
+
+func newTarStreamChecksumHash() hash.Hash {
+	return crc32.New(tarStreamCrc32cTable)
+}
+
+// tarStreamChecksumVerifier computes the checksum of the decompressed tar stream read through it
+// and compares it with the one recorded at push
+type tarStreamChecksumVerifier struct {
+	tarPath  string
+	expected FileChecksum
+	checksum hash.Hash
+}
+
+// newTarStreamChecksumVerifier returns the verifier of the tar, nil if the interpreter does not know its checksum,
+// e.g. the backup is pushed by the older version
+func newTarStreamChecksumVerifier(tarInterpreter TarInterpreter, fileClosure ReaderMaker) *tarStreamChecksumVerifier {
+	checksumInterpreter, ok := tarInterpreter.(TarStreamChecksumInterpreter)
+	if !ok || fileClosure.FileType() != TarFileType {
+		return nil
+	}
+	expected, ok := checksumInterpreter.TarStreamChecksum(path.Base(fileClosure.Path()))
+	if !ok {
+		return nil
+	}
+	if expected.Algorithm != Crc32cChecksumAlgorithm {
+		tracelog.WarningLogger.Printf("Unknown checksum algorithm '%s' of tar '%s', the tar stream is not verified\n",
+			expected.Algorithm, fileClosure.Path())
+		return nil
+	}
+	return &tarStreamChecksumVerifier{tarPath: fileClosure.Path(), expected: expected, checksum: newTarStreamChecksumHash()}
+}
+
+func (verifier *tarStreamChecksumVerifier) wrap(reader io.Reader) io.Reader {
+	return io.TeeReader(reader, verifier.checksum)
+}
+
+// verify is called once the whole stream is read
+func (verifier *tarStreamChecksumVerifier) verify() error {
+	actual := hex.EncodeToString(verifier.checksum.Sum(nil))
+	if actual != verifier.expected.Value {
+		return newTarStreamChecksumMismatchError(verifier.tarPath, verifier.expected, actual)
+	}
+	tracelog.DebugLogger.Printf("Verified the %s checksum of tar '%s'\n", verifier.expected.Algorithm, verifier.tarPath)
+	return nil
+}
@@ -0,0 +1,116 @@
+package internal_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+const streamChecksumTarKey = "base_000000010000000000000002/tar_partitions/part_001.tar"
+
+type streamChecksumEntry struct {
+	name    string
+	content []byte
+}
+
+var streamChecksumEntries = []streamChecksumEntry{
+	{"/base/1/1259", bytes.Repeat([]byte{'a'}, 1024)},
+	{"/base/1/1249", bytes.Repeat([]byte{'b'}, 1024)},
+}
+
+func writeStreamChecksumEntries(t *testing.T, tarWriter *tar.Writer) {
+	for _, entry := range streamChecksumEntries {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Name: entry.name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(entry.content)),
+		}))
+		_, err := tarWriter.Write(entry.content)
+		require.NoError(t, err)
+	}
+}
+
+func makeStreamChecksumTar(t *testing.T) []byte {
+	var buffer bytes.Buffer
+	tarWriter := tar.NewWriter(&buffer)
+	writeStreamChecksumEntries(t, tarWriter)
+	require.NoError(t, tarWriter.Close())
+	return buffer.Bytes()
+}
+
+func makeStreamChecksum(content []byte) internal.FileChecksum {
+	checksum := crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli))
+	return internal.FileChecksum{
+		Algorithm: internal.Crc32cChecksumAlgorithm,
+		Value:     hex.EncodeToString([]byte{byte(checksum >> 24), byte(checksum >> 16), byte(checksum >> 8), byte(checksum)}),
+	}
+}
+
+// streamChecksumTarInterpreter knows the checksums of the tars by the tar names
+type streamChecksumTarInterpreter struct {
+	*testtools.ConcurrentConcatBufferTarInterpreter
+	checksums map[string]internal.FileChecksum
+}
+
+func (tarInterpreter *streamChecksumTarInterpreter) TarStreamChecksum(tarName string) (internal.FileChecksum, bool) {
+	checksum, ok := tarInterpreter.checksums[tarName]
+	return checksum, ok
+}
+
+func TestStorageTarBall_RecordsStreamChecksums(t *testing.T) {
+	tarBallMaker := internal.NewStorageTarBallMaker("mockBackup", testtools.NewMockUploader(false, false))
+	tarBallQueue := internal.NewTarBallQueue(int64(100), tarBallMaker)
+	require.NoError(t, tarBallQueue.StartQueue())
+	tarBall := tarBallQueue.NewTarBall(false)
+	tarBall.SetUp(nil, "part_001.tar")
+
+	writeStreamChecksumEntries(t, tarBall.TarWriter())
+	require.NoError(t, tarBall.CloseTar())
+	tarBall.AwaitUploads()
+
+	assert.Equal(t, map[string]internal.FileChecksum{"part_001.tar": makeStreamChecksum(makeStreamChecksumTar(t))},
+		tarBallMaker.StreamChecksums())
+}
+
+func TestExtractAll_VerifiesTarStreamChecksum(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	tarContent := makeStreamChecksumTar(t)
+	tarInterpreter := &streamChecksumTarInterpreter{
+		ConcurrentConcatBufferTarInterpreter: testtools.NewConcurrentConcatBufferTarInterpreter(),
+		checksums:                            map[string]internal.FileChecksum{"part_001.tar": makeStreamChecksum(tarContent)},
+	}
+
+	err := internal.ExtractAllWithSleeper(tarInterpreter,
+		[]internal.ReaderMaker{&BytesReaderMaker{Bytes: tarContent, Key: streamChecksumTarKey}}, NOPSleeper{})
+
+	require.NoError(t, err)
+	assert.Len(t, tarInterpreter.Out, len(streamChecksumEntries))
+}
+
+func TestExtractAll_TruncatedTarStreamFails(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	tarContent := makeStreamChecksumTar(t)
+	// the tar is truncated at the boundary of the entries, so it reads as the complete tar of the first entry only
+	truncatedContent := tarContent[:512+len(streamChecksumEntries[0].content)]
+	truncatedTar := &BytesReaderMaker{Bytes: truncatedContent, Key: streamChecksumTarKey}
+
+	withoutChecksums := testtools.NewConcurrentConcatBufferTarInterpreter()
+	err := internal.ExtractAllWithSleeper(withoutChecksums, []internal.ReaderMaker{truncatedTar}, NOPSleeper{})
+	require.NoError(t, err)
+	assert.Len(t, withoutChecksums.Out, 1)
+
+	tarInterpreter := &streamChecksumTarInterpreter{
+		ConcurrentConcatBufferTarInterpreter: testtools.NewConcurrentConcatBufferTarInterpreter(),
+		checksums:                            map[string]internal.FileChecksum{"part_001.tar": makeStreamChecksum(tarContent)},
+	}
+	err = internal.ExtractAllWithSleeper(tarInterpreter, []internal.ReaderMaker{truncatedTar}, NOPSleeper{})
+	assert.Error(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 )
 
@@ -19,6 +21,8 @@ const (
 	NotFoundAWSErrorCode  = "NotFound"
 	NoSuchKeyAWSErrorCode = "NoSuchKey"
 
+	ObjectLockConfigurationNotFoundAWSErrorCode = "ObjectLockConfigurationNotFoundError"
+
 	EndpointSetting          = "AWS_ENDPOINT"
 	RegionSetting            = "AWS_REGION"
 	ForcePathStyleSetting    = "AWS_S3_FORCE_PATH_STYLE"
@@ -98,6 +102,14 @@ type Folder struct {
 	settings map[string]string
 
 	useListObjectsV1 bool
+	// objectLock is shared by the folder and its subfolders
+	objectLock *objectLockState
+}
+
+// objectLockState caches whether the object lock is enabled for the bucket
+type objectLockState struct {
+	once    sync.Once
+	enabled bool
 }
 
 func NewFolder(uploader Uploader, s3API s3iface.S3API, settings map[string]string, bucket, path string, useListObjectsV1 bool) *Folder {
@@ -108,6 +120,7 @@ func NewFolder(uploader Uploader, s3API s3iface.S3API, settings map[string]strin
 		Bucket:           aws.String(bucket),
 		Path:             storage.AddDelimiterToPath(path),
 		useListObjectsV1: useListObjectsV1,
+		objectLock:       &objectLockState{},
 	}
 }
 
@@ -155,6 +168,49 @@ func (folder *Folder) Exists(objectRelativePath string) (bool, error) {
 	return true, nil
 }
 
+// IsRetentionLocked reports whether the object is protected by the retention period or the legal hold.
+// The objects are never locked if the object lock is not enabled for the bucket.
+func (folder *Folder) IsRetentionLocked(objectRelativePath string) (bool, error) {
+	if !folder.isObjectLockEnabled() {
+		return false, nil
+	}
+	objectPath := folder.Path + objectRelativePath
+	output, err := folder.S3API.HeadObject(&s3.HeadObjectInput{
+		Bucket: folder.Bucket,
+		Key:    aws.String(objectPath),
+	})
+	if err != nil {
+		if isAwsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to check s3 object '%s' retention lock", objectPath)
+	}
+	if aws.StringValue(output.ObjectLockLegalHoldStatus) == s3.ObjectLockLegalHoldStatusOn {
+		return true, nil
+	}
+	return output.ObjectLockRetainUntilDate != nil && output.ObjectLockRetainUntilDate.After(time.Now()), nil
+}
+
+// isObjectLockEnabled fetches the object lock configuration of the bucket once. If it can't be fetched,
+// for example if the S3-compatible storage does not support the object lock, the lock is considered disabled.
+func (folder *Folder) isObjectLockEnabled() bool {
+	folder.objectLock.once.Do(func() {
+		output, err := folder.S3API.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{
+			Bucket: folder.Bucket,
+		})
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != ObjectLockConfigurationNotFoundAWSErrorCode {
+				tracelog.WarningLogger.Printf("Failed to fetch the object lock configuration of bucket '%s', "+
+					"the retention locks are not checked: %v\n", *folder.Bucket, err)
+			}
+			return
+		}
+		folder.objectLock.enabled = output.ObjectLockConfiguration != nil &&
+			aws.StringValue(output.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled
+	})
+	return folder.objectLock.enabled
+}
+
 func (folder *Folder) PutObject(name string, content io.Reader) error {
 	return folder.uploader.upload(*folder.Bucket, folder.Path+name, content)
 }
@@ -231,6 +287,7 @@ func (folder *Folder) getReaderSettings() (rangeEnabled bool, retriesCount int,
 func (folder *Folder) GetSubFolder(subFolderRelativePath string) storage.Folder {
 	subFolder := NewFolder(folder.uploader, folder.S3API, folder.settings, *folder.Bucket,
 		storage.JoinPath(folder.Path, subFolderRelativePath)+"/", folder.useListObjectsV1)
+	subFolder.objectLock = folder.objectLock
 	return subFolder
 }
 
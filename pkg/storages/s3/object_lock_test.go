@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type objectLockTestAPI struct {
+	s3iface.S3API
+	lockEnabled       bool
+	objects           map[string]*s3.HeadObjectOutput
+	configCallsNumber int
+}
+
+func (api *objectLockTestAPI) GetObjectLockConfiguration(
+	*s3.GetObjectLockConfigurationInput) (*s3.GetObjectLockConfigurationOutput, error) {
+	api.configCallsNumber++
+	if !api.lockEnabled {
+		return nil, awserr.New(ObjectLockConfigurationNotFoundAWSErrorCode, "not found", nil)
+	}
+	return &s3.GetObjectLockConfigurationOutput{ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+		ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+	}}, nil
+}
+
+func (api *objectLockTestAPI) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	output, ok := api.objects[*input.Key]
+	if !ok {
+		return nil, awserr.New(NotFoundAWSErrorCode, "not found", nil)
+	}
+	return output, nil
+}
+
+func TestIsRetentionLocked(t *testing.T) {
+	api := &objectLockTestAPI{lockEnabled: true, objects: map[string]*s3.HeadObjectOutput{
+		"backups/retained": {ObjectLockMode: aws.String(s3.ObjectLockModeCompliance),
+			ObjectLockRetainUntilDate: aws.Time(time.Now().Add(time.Hour))},
+		"backups/expired": {ObjectLockMode: aws.String(s3.ObjectLockModeGovernance),
+			ObjectLockRetainUntilDate: aws.Time(time.Now().Add(-time.Hour))},
+		"backups/held":     {ObjectLockLegalHoldStatus: aws.String(s3.ObjectLockLegalHoldStatusOn)},
+		"backups/unlocked": {},
+	}}
+	folder := NewFolder(Uploader{}, api, nil, "bucket", "", false).GetSubFolder("backups").(*Folder)
+
+	for name, expected := range map[string]bool{"retained": true, "expired": false, "held": true,
+		"unlocked": false, "missing": false} {
+		locked, err := folder.IsRetentionLocked(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, locked, name)
+	}
+	assert.Equal(t, 1, api.configCallsNumber)
+}
+
+func TestIsRetentionLocked_LockDisabled(t *testing.T) {
+	api := &objectLockTestAPI{objects: map[string]*s3.HeadObjectOutput{
+		"held": {ObjectLockLegalHoldStatus: aws.String(s3.ObjectLockLegalHoldStatusOn)},
+	}}
+	folder := NewFolder(Uploader{}, api, nil, "bucket", "", false)
+
+	locked, err := folder.IsRetentionLocked("held")
+
+	require.NoError(t, err)
+	assert.False(t, locked)
+}
@@ -31,6 +31,43 @@ type Folder interface {
 	CopyObject(srcPath string, dstPath string) error
 }
 
+// RetentionLockFolder is implemented by the folders of the storages supporting the object retention locks (WORM).
+// The locked objects can't be deleted until the retention period expires or the legal hold is removed.
+type RetentionLockFolder interface {
+	Folder
+
+	IsRetentionLocked(objectRelativePath string) (bool, error)
+}
+
+// DeleteUnlockedObjects deletes the objects, skipping the ones protected by the retention locks
+// if the folder supports them. Returns the paths of the skipped objects.
+func DeleteUnlockedObjects(folder Folder, objectRelativePaths []string) (lockedPaths []string, err error) {
+	lockFolder, ok := folder.(RetentionLockFolder)
+	if !ok {
+		return nil, folder.DeleteObjects(objectRelativePaths)
+	}
+	unlockedPaths := make([]string, 0, len(objectRelativePaths))
+	for _, objectRelativePath := range objectRelativePaths {
+		locked, err := lockFolder.IsRetentionLocked(objectRelativePath)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			tracelog.WarningLogger.Println("	skipped due to the retention lock: " + objectRelativePath)
+			lockedPaths = append(lockedPaths, objectRelativePath)
+		} else {
+			unlockedPaths = append(unlockedPaths, objectRelativePath)
+		}
+	}
+	if len(lockedPaths) > 0 {
+		tracelog.WarningLogger.Printf("%d objects are skipped due to the retention locks\n", len(lockedPaths))
+	}
+	if len(unlockedPaths) == 0 {
+		return lockedPaths, nil
+	}
+	return lockedPaths, folder.DeleteObjects(unlockedPaths)
+}
+
 func DeleteObjectsWhere(folder Folder, confirm bool, filter func(object1 Object) bool) error {
 	relativePathObjects, err := ListFolderRecursively(folder)
 	if err != nil {
@@ -50,7 +87,8 @@ func DeleteObjectsWhere(folder Folder, confirm bool, filter func(object1 Object)
 		return nil
 	}
 	if confirm {
-		return folder.DeleteObjects(filteredRelativePaths)
+		_, err = DeleteUnlockedObjects(folder, filteredRelativePaths)
+		return err
 	} else {
 		tracelog.InfoLogger.Println("Dry run, nothing were deleted")
 	}
@@ -64,3 +64,47 @@ func TestDeleteOldObjects(t *testing.T) {
 	assert.Equal(t, 1, len(savedObjects))
 	assert.Equal(t, expectedOnlyOneSavedObjectName, savedObjects[0].GetName())
 }
+
+type retentionLockFolder struct {
+	storage.Folder
+	lockedPaths map[string]bool
+}
+
+func (folder *retentionLockFolder) IsRetentionLocked(objectRelativePath string) (bool, error) {
+	return folder.lockedPaths[objectRelativePath], nil
+}
+
+func TestDeleteObjectsWhere_SkipsRetentionLocked(t *testing.T) {
+	folder := &retentionLockFolder{Folder: CreateMockStorageFolder(), lockedPaths: map[string]bool{
+		"basebackups_005/base_456/tar_partitions/2": true,
+		"basebackups_005/base_321/nop":              true,
+	}}
+	err := storage.DeleteObjectsWhere(folder, true, func(object storage.Object) bool { return true })
+	assert.NoError(t, err)
+	savedObjects, err := storage.ListFolderRecursively(folder)
+	assert.NoError(t, err)
+	savedNames := make([]string, 0, len(savedObjects))
+	for _, object := range savedObjects {
+		savedNames = append(savedNames, object.GetName())
+	}
+	assert.ElementsMatch(t, []string{"basebackups_005/base_456/tar_partitions/2", "basebackups_005/base_321/nop"},
+		savedNames)
+}
+
+func TestDeleteUnlockedObjects(t *testing.T) {
+	folder := &retentionLockFolder{Folder: memory.NewFolder("in_memory/", memory.NewStorage()),
+		lockedPaths: map[string]bool{"locked": true}}
+	assert.NoError(t, folder.PutObject("locked", &bytes.Buffer{}))
+	assert.NoError(t, folder.PutObject("unlocked", &bytes.Buffer{}))
+
+	lockedPaths, err := storage.DeleteUnlockedObjects(folder, []string{"locked", "unlocked"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"locked"}, lockedPaths)
+	exists, err := folder.Exists("locked")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = folder.Exists("unlocked")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"io"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ListingCacheFolder decorates the folder to reuse the listings of its folders within one command,
+// e.g. the backups listed several times by delete. The cache is shared by the subfolders of the folder.
+// The change made through them invalidates the listings of the folders containing the changed objects,
+// so it must not be used if the storage is changed by the other processes during the command.
+type ListingCacheFolder struct {
+	Folder
+	cache *listingCache
+}
+
+type folderListing struct {
+	objects    []Object
+	subFolders []Folder
+}
+
+type listingCache struct {
+	mutex    sync.Mutex
+	listings map[string]folderListing
+	// generation is incremented on every invalidation, so the listing started before it is not cached
+	generation uint64
+}
+
+func NewListingCacheFolder(folder Folder) *ListingCacheFolder {
+	return &ListingCacheFolder{Folder: folder, cache: &listingCache{listings: make(map[string]folderListing)}}
+}
+
+func (cache *listingCache) get(folderPath string) (folderListing, uint64, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	listing, ok := cache.listings[folderPath]
+	return listing, cache.generation, ok
+}
+
+func (cache *listingCache) put(folderPath string, listing folderListing, generation uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if generation == cache.generation {
+		cache.listings[folderPath] = listing
+	}
+}
+
+// invalidate drops the listings of the folders containing the objects at the paths, at any depth
+func (cache *listingCache) invalidate(objectPaths ...string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for folderPath := range cache.listings {
+		for _, objectPath := range objectPaths {
+			if isInsideFolder(folderPath, objectPath) {
+				delete(cache.listings, folderPath)
+				break
+			}
+		}
+	}
+	cache.generation++
+}
+
+func isInsideFolder(folderPath, objectPath string) bool {
+	folderPrefix := strings.TrimSuffix(folderPath, "/")
+	return folderPrefix == "" || strings.HasPrefix(objectPath, folderPrefix+"/")
+}
+
+// getObjectPath returns the storage path of the object, comparable to the folder paths of the cached listings
+func (folder *ListingCacheFolder) getObjectPath(objectRelativePath string) string {
+	return path.Join(folder.GetPath(), objectRelativePath)
+}
+
+func (folder *ListingCacheFolder) ListFolder() (objects []Object, subFolders []Folder, err error) {
+	listing, generation, ok := folder.cache.get(folder.GetPath())
+	if !ok {
+		objects, subFolders, err = folder.Folder.ListFolder()
+		if err != nil {
+			return nil, nil, err
+		}
+		listing = folderListing{objects: objects, subFolders: make([]Folder, 0, len(subFolders))}
+		for _, subFolder := range subFolders {
+			listing.subFolders = append(listing.subFolders, &ListingCacheFolder{Folder: subFolder, cache: folder.cache})
+		}
+		folder.cache.put(folder.GetPath(), listing, generation)
+	}
+	// the callers may modify the returned slices
+	return append([]Object(nil), listing.objects...), append([]Folder(nil), listing.subFolders...), nil
+}
+
+// Exists answers from the cached listing of the folder if there is one
+func (folder *ListingCacheFolder) Exists(objectRelativePath string) (bool, error) {
+	if strings.Contains(objectRelativePath, "/") {
+		return folder.Folder.Exists(objectRelativePath)
+	}
+	listing, _, ok := folder.cache.get(folder.GetPath())
+	if !ok {
+		return folder.Folder.Exists(objectRelativePath)
+	}
+	for _, object := range listing.objects {
+		if object.GetName() == objectRelativePath {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (folder *ListingCacheFolder) GetSubFolder(subFolderRelativePath string) Folder {
+	return &ListingCacheFolder{Folder: folder.Folder.GetSubFolder(subFolderRelativePath), cache: folder.cache}
+}
+
+func (folder *ListingCacheFolder) DeleteObjects(objectRelativePaths []string) error {
+	objectPaths := make([]string, 0, len(objectRelativePaths))
+	for _, objectRelativePath := range objectRelativePaths {
+		objectPaths = append(objectPaths, folder.getObjectPath(objectRelativePath))
+	}
+	defer folder.cache.invalidate(objectPaths...)
+	return folder.Folder.DeleteObjects(objectRelativePaths)
+}
+
+func (folder *ListingCacheFolder) PutObject(name string, content io.Reader) error {
+	defer folder.cache.invalidate(folder.getObjectPath(name))
+	return folder.Folder.PutObject(name, content)
+}
+
+func (folder *ListingCacheFolder) CopyObject(srcPath string, dstPath string) error {
+	defer folder.cache.invalidate(folder.getObjectPath(dstPath))
+	return folder.Folder.CopyObject(srcPath, dstPath)
+}
+
+// IsRetentionLocked keeps the retention locks of the decorated folder respected,
+// the objects of the folders not supporting them are never locked
+func (folder *ListingCacheFolder) IsRetentionLocked(objectRelativePath string) (bool, error) {
+	lockFolder, ok := folder.Folder.(RetentionLockFolder)
+	if !ok {
+		return false, nil
+	}
+	return lockFolder.IsRetentionLocked(objectRelativePath)
+}
@@ -0,0 +1,167 @@
+package storage_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// listCountingFolder counts the listings of the folder and of its subfolders
+type listCountingFolder struct {
+	storage.Folder
+	mutex  *sync.Mutex
+	counts map[string]int
+}
+
+func newListCountingFolder() *listCountingFolder {
+	folder := CreateMockStorageFolder()
+	return &listCountingFolder{Folder: folder, mutex: &sync.Mutex{}, counts: make(map[string]int)}
+}
+
+func (folder *listCountingFolder) ListFolder() ([]storage.Object, []storage.Folder, error) {
+	folder.mutex.Lock()
+	folder.counts[folder.GetPath()]++
+	folder.mutex.Unlock()
+	objects, subFolders, err := folder.Folder.ListFolder()
+	for i, subFolder := range subFolders {
+		subFolders[i] = &listCountingFolder{Folder: subFolder, mutex: folder.mutex, counts: folder.counts}
+	}
+	return objects, subFolders, err
+}
+
+func (folder *listCountingFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return &listCountingFolder{Folder: folder.Folder.GetSubFolder(subFolderRelativePath),
+		mutex: folder.mutex, counts: folder.counts}
+}
+
+func (folder *listCountingFolder) totalCount() int {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	total := 0
+	for _, count := range folder.counts {
+		total += count
+	}
+	return total
+}
+
+func TestListingCacheFolder_ReusesListings(t *testing.T) {
+	underlying := newListCountingFolder()
+	folder := storage.NewListingCacheFolder(underlying)
+
+	first, err := storage.ListFolderRecursively(folder)
+	require.NoError(t, err)
+	listCount := underlying.totalCount()
+	second, err := storage.ListFolderRecursively(folder)
+	require.NoError(t, err)
+	objects, _, err := folder.GetSubFolder("basebackups_005/").ListFolder()
+	require.NoError(t, err)
+
+	assert.Equal(t, listCount, underlying.totalCount())
+	assert.ElementsMatch(t, first, second)
+	assert.Len(t, objects, 4)
+}
+
+func TestListingCacheFolder_InvalidatedByDelete(t *testing.T) {
+	underlying := newListCountingFolder()
+	folder := storage.NewListingCacheFolder(underlying)
+	backupFolder := folder.GetSubFolder("basebackups_005/")
+
+	objects, _, err := backupFolder.ListFolder()
+	require.NoError(t, err)
+	require.Len(t, objects, 4)
+	require.NoError(t, folder.DeleteObjects([]string{"basebackups_005/base_123312"}))
+	objects, _, err = backupFolder.ListFolder()
+	require.NoError(t, err)
+
+	assert.Len(t, objects, 3)
+	assert.Equal(t, 2, underlying.totalCount())
+}
+
+func TestListingCacheFolder_InvalidatedByPut(t *testing.T) {
+	underlying := newListCountingFolder()
+	folder := storage.NewListingCacheFolder(underlying)
+	backupFolder := folder.GetSubFolder("basebackups_005/")
+
+	_, _, err := backupFolder.ListFolder()
+	require.NoError(t, err)
+	require.NoError(t, backupFolder.PutObject("base_789_backup_stop_sentinel.json", &bytes.Buffer{}))
+	exists, err := backupFolder.Exists("base_789_backup_stop_sentinel.json")
+	require.NoError(t, err)
+
+	assert.True(t, exists)
+}
+
+func TestListingCacheFolder_InvalidatesOnlyChangedFolders(t *testing.T) {
+	underlying := newListCountingFolder()
+	folder := storage.NewListingCacheFolder(underlying)
+
+	_, err := storage.ListFolderRecursively(folder)
+	require.NoError(t, err)
+	listCount := underlying.totalCount()
+	require.NoError(t, folder.GetSubFolder("basebackups_005/base_456").DeleteObjects([]string{"tar_partitions/1"}))
+	require.NoError(t, folder.GetSubFolder("wal_005").PutObject("000000010000000000000001", &bytes.Buffer{}))
+	objects, err := storage.ListFolderRecursively(folder)
+	require.NoError(t, err)
+
+	// the root, basebackups_005, base_456 and tar_partitions folders are listed again, the new wal_005 folder
+	// is listed for the first time, base_321 and folder123 are not listed again
+	assert.Equal(t, listCount+5, underlying.totalCount())
+	assert.Len(t, objects, 9)
+}
+
+func TestListingCacheFolder_ExistsFromListing(t *testing.T) {
+	underlying := newListCountingFolder()
+	folder := storage.NewListingCacheFolder(underlying)
+	backupFolder := folder.GetSubFolder("basebackups_005/")
+	_, _, err := backupFolder.ListFolder()
+	require.NoError(t, err)
+	// the object put around the cache is not seen until the cache is invalidated
+	require.NoError(t, underlying.GetSubFolder("basebackups_005/").PutObject("base_789", &bytes.Buffer{}))
+
+	exists, err := backupFolder.Exists("base_123312")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = backupFolder.Exists("base_789")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = folder.Exists("basebackups_005/base_789")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestListingCacheFolder_ReturnsCopies(t *testing.T) {
+	folder := storage.NewListingCacheFolder(memory.NewFolder("in_memory/", memory.NewStorage()))
+	require.NoError(t, folder.PutObject("a", &bytes.Buffer{}))
+
+	objects, _, err := folder.ListFolder()
+	require.NoError(t, err)
+	objects[0] = storage.NewLocalObject("b", objects[0].GetLastModified(), 0)
+	objects, _, err = folder.ListFolder()
+	require.NoError(t, err)
+
+	assert.Equal(t, "a", objects[0].GetName())
+}
+
+func TestListingCacheFolder_KeepsRetentionLocks(t *testing.T) {
+	lockFolder := &retentionLockFolder{
+		Folder:      memory.NewFolder("in_memory/", memory.NewStorage()),
+		lockedPaths: map[string]bool{"locked": true},
+	}
+	folder := storage.NewListingCacheFolder(lockFolder)
+	require.NoError(t, folder.PutObject("locked", &bytes.Buffer{}))
+	require.NoError(t, folder.PutObject("unlocked", &bytes.Buffer{}))
+
+	lockedPaths, err := storage.DeleteUnlockedObjects(folder, []string{"locked", "unlocked"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"locked"}, lockedPaths)
+	objects, _, err := folder.ListFolder()
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "locked", objects[0].GetName())
+}